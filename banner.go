@@ -0,0 +1,57 @@
+package panicwrap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// CrashBanners are the lines written around a panic that is mirrored to
+// Writer, so that log collectors can tell where the crash starts and
+// ends. See WrapConfig.Banners.
+type CrashBanners struct {
+	// Start and End are text/template templates that are executed with
+	// the PanicInfo of the crash, such as
+	// "=== CRASH START pid={{.PID}} fingerprint={{.Fingerprint}} ===".
+	// Each is written on a line of its own, and left out if empty. With
+	// StreamPanics, only End is written, since the crash is forwarded
+	// before it is known to be one.
+	Start string
+	End   string
+}
+
+// validate returns an error if one of the templates doesn't parse.
+func (b *CrashBanners) validate() error {
+	for _, t := range []struct{ name, text string }{{"Start", b.Start}, {"End", b.End}} {
+		if _, err := template.New(t.name).Parse(t.text); err != nil {
+			return fmt.Errorf("invalid Banners.%s: %w", t.name, err)
+		}
+	}
+
+	return nil
+}
+
+// writeBanner writes the banner for the crash on a line of its own, after
+// the given output that came before it.
+func writeBanner(c *WrapConfig, w io.Writer, name, text, before string, info *PanicInfo) {
+	if text == "" {
+		return
+	}
+
+	var b strings.Builder
+	t, err := template.New(name).Parse(text)
+	if err == nil {
+		err = t.Execute(&b, info)
+	}
+	if err != nil {
+		reportInternal(c, "writing the banner", err)
+		return
+	}
+
+	line := strings.TrimSuffix(b.String(), "\n") + "\n"
+	if before != "" && !strings.HasSuffix(before, "\n") {
+		line = "\n" + line
+	}
+	io.WriteString(w, line)
+}
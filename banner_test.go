@@ -0,0 +1,69 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMirrorPanic_banners(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &WrapConfig{
+		Writer: out,
+		Banners: &CrashBanners{
+			Start: "=== CRASH START pid={{.PID}} fingerprint={{.Fingerprint}} ===",
+			End:   "=== CRASH END pid={{.PID}} ===\n",
+		},
+	}
+
+	mirrorPanic(c, &PanicInfo{Text: "panic: boom", PID: 42, Fingerprint: "abc"}, false)
+
+	expected := "=== CRASH START pid=42 fingerprint=abc ===\npanic: boom\n=== CRASH END pid=42 ===\n"
+	if out.String() != expected {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestMirrorPanic_bannersStreamed(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &WrapConfig{
+		Writer:  out,
+		Banners: &CrashBanners{Start: "start", End: "end {{.ExitStatus}}"},
+	}
+
+	mirrorPanic(c, &PanicInfo{Text: "panic: boom\n", ExitStatus: 2}, true)
+
+	if out.String() != "end 2\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestMirrorPanic_bannerFails(t *testing.T) {
+	var internal error
+	out := new(bytes.Buffer)
+	c := &WrapConfig{
+		Writer:               out,
+		Banners:              &CrashBanners{Start: "{{.Missing}}"},
+		InternalErrorHandler: func(err error) { internal = err },
+	}
+
+	mirrorPanic(c, &PanicInfo{Text: "panic: boom\n"}, false)
+
+	// The panic is still mirrored.
+	if out.String() != "panic: boom\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+	var e *InternalError
+	if !errors.As(internal, &e) {
+		t.Fatalf("bad: %v", internal)
+	}
+}
+
+func TestCrashBanners_validate(t *testing.T) {
+	if err := (&CrashBanners{Start: "{{.PID}}"}).validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := (&CrashBanners{End: "{{.PID"}).validate(); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,273 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BenchConfig is the configuration of Benchmark.
+type BenchConfig struct {
+	// Rates are the rates of output to measure, in lines per second. A
+	// rate of 0 writes as fast as the pipe takes it, which measures the
+	// throughput. Defaults to 0, 1000, 10000 and 100000.
+	Rates []int
+
+	// Duration is how long each rate is measured for, once through the
+	// detection of panics and once as a plain copy. Defaults to a
+	// second.
+	Duration time.Duration
+
+	// LineSize is the length of a line of output, including its newline.
+	// Defaults to 100.
+	LineSize int
+}
+
+// BenchResult is what Benchmark measured at a rate of output.
+type BenchResult struct {
+	// Rate is the rate of output in lines per second, or 0 if it was as
+	// fast as it could be.
+	Rate int `json:"rate"`
+
+	// Lines is the number of lines that went through the detection, and
+	// Throughput how many bytes a second they came to. BaselineThroughput
+	// is the same for the plain copy.
+	Lines              int     `json:"lines"`
+	Throughput         float64 `json:"throughput"`
+	BaselineThroughput float64 `json:"baseline_throughput"`
+
+	// Latency is how long the lines took from being written to the pipe
+	// to coming out of the detection, and BaselineLatency how long they
+	// took to come out of the plain copy. The difference is the latency
+	// that the parent adds.
+	Latency         LatencySummary `json:"latency"`
+	BaselineLatency LatencySummary `json:"baseline_latency"`
+}
+
+// LatencySummary sums up the latencies of a BenchResult.
+type LatencySummary struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// maxBenchSamples is how many latencies a run of Benchmark keeps for its
+// percentiles.
+const maxBenchSamples = 100000
+
+// Benchmark measures the overhead of forwarding the stderr of a child
+// through the detection of panics, against copying it as is, at each of
+// the rates of the configuration, which may be nil. The output goes
+// through a pipe, as the stderr of a child does, and is discarded on the
+// other end, so that only the detection is measured, not the writers.
+//
+// In the parent of a running Wrap call, it measures with the detection
+// settings of its configuration, and the results are kept in
+// WrapStats.Benchmark until the next time. Elsewhere, the defaults of
+// WrapConfig are used. Each rate takes twice BenchConfig.Duration.
+func Benchmark(c *BenchConfig) ([]BenchResult, error) {
+	if ch := activeChild.Load(); ch != nil && ch.bench != nil {
+		return ch.bench(c)
+	}
+
+	wc := &WrapConfig{}
+	setDefaults(wc)
+	return benchmark(c, wc)
+}
+
+// benchmark is Benchmark with the detection settings of the
+// configuration.
+func benchmark(c *BenchConfig, wc *WrapConfig) ([]BenchResult, error) {
+	bc := BenchConfig{}
+	if c != nil {
+		bc = *c
+	}
+	if bc.Rates == nil {
+		bc.Rates = []int{0, 1000, 10000, 100000}
+	}
+	if bc.Duration == 0 {
+		bc.Duration = time.Second
+	}
+	if bc.LineSize == 0 {
+		bc.LineSize = 100
+	}
+	if bc.LineSize < benchStampSize+1 {
+		return nil, fmt.Errorf("panicwrap: LineSize must be at least %d", benchStampSize+1)
+	}
+	for _, rate := range bc.Rates {
+		if rate < 0 {
+			return nil, errors.New("panicwrap: Rates must not be negative")
+		}
+	}
+
+	track := func(r io.Reader, w io.Writer) {
+		result := make(chan string, 1)
+		trackPanic(r, w, detectWindow(wc), wc.PartialHeaderWait, realClock{}, defaultTrackSize, false, newHeaderRules(wc), nil, nil, result)
+	}
+	plain := func(r io.Reader, w io.Writer) {
+		io.CopyBuffer(w, r, make([]byte, defaultTrackSize))
+	}
+
+	results := make([]BenchResult, 0, len(bc.Rates))
+	for _, rate := range bc.Rates {
+		tracked, err := benchRun(&bc, rate, track)
+		if err != nil {
+			return nil, err
+		}
+		baseline, err := benchRun(&bc, rate, plain)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, BenchResult{
+			Rate:               rate,
+			Lines:              tracked.lines,
+			Throughput:         tracked.throughput,
+			BaselineThroughput: baseline.throughput,
+			Latency:            tracked.latency.summary(),
+			BaselineLatency:    baseline.latency.summary(),
+		})
+	}
+
+	return results, nil
+}
+
+// benchStampSize is the length of the time stamp that starts each line of
+// output of Benchmark.
+const benchStampSize = 19
+
+// benchOutcome is the outcome of a run of Benchmark.
+type benchOutcome struct {
+	lines      int
+	throughput float64
+	latency    *latencySink
+}
+
+// benchRun writes lines at the rate through a pipe, whose other end the
+// consumer forwards to a latencySink, for the duration of the
+// configuration.
+func benchRun(c *BenchConfig, rate int, consume func(io.Reader, io.Writer)) (*benchOutcome, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	start := time.Now()
+	sink := &latencySink{start: start, rand: rand.New(rand.NewSource(1))}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consume(r, sink)
+	}()
+
+	line := bytes.Repeat([]byte("x"), c.LineSize)
+	line[benchStampSize] = ' '
+	line[c.LineSize-1] = '\n'
+	written := 0
+	for i := 0; ; i++ {
+		if rate > 0 {
+			at := time.Duration(i) * time.Second / time.Duration(rate)
+			if at >= c.Duration {
+				break
+			}
+			time.Sleep(time.Until(start.Add(at)))
+		} else if time.Since(start) >= c.Duration {
+			break
+		}
+
+		stamp := strconv.AppendInt(nil, int64(time.Since(start)), 10)
+		copy(line, "0000000000000000000"[:benchStampSize-len(stamp)])
+		copy(line[benchStampSize-len(stamp):], stamp)
+		if _, err := w.Write(line); err != nil {
+			w.Close()
+			return nil, err
+		}
+		written += len(line)
+	}
+	w.Close()
+	<-done
+
+	return &benchOutcome{
+		lines:      sink.lines,
+		throughput: float64(written) / time.Since(start).Seconds(),
+		latency:    sink,
+	}, nil
+}
+
+// latencySink takes the output of Benchmark and measures how long each
+// line took since the time stamp it starts with. It keeps a sample of
+// the latencies.
+type latencySink struct {
+	start time.Time
+	rand  *rand.Rand
+
+	mu      sync.Mutex
+	partial []byte
+	lines   int
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+func (s *latencySink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Since(s.start)
+	data := p
+	if len(s.partial) > 0 {
+		data = append(s.partial, p...)
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if stamp, err := strconv.ParseInt(string(data[:min(i, benchStampSize)]), 10, 64); err == nil {
+			s.add(now - time.Duration(stamp))
+		}
+		data = data[i+1:]
+	}
+	s.partial = append(s.partial[:0], data...)
+
+	return len(p), nil
+}
+
+// add records the latency of a line, sampling it if there are more lines
+// than fit.
+func (s *latencySink) add(d time.Duration) {
+	s.lines++
+	s.total += d
+	s.max = max(s.max, d)
+	if len(s.samples) < maxBenchSamples {
+		s.samples = append(s.samples, d)
+	} else if i := s.rand.Intn(s.lines); i < maxBenchSamples {
+		s.samples[i] = d
+	}
+}
+
+// summary sums up the latencies that were measured.
+func (s *latencySink) summary() LatencySummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lines == 0 {
+		return LatencySummary{}
+	}
+
+	slices.Sort(s.samples)
+	return LatencySummary{
+		Mean: s.total / time.Duration(s.lines),
+		P50:  s.samples[len(s.samples)*50/100],
+		P99:  s.samples[len(s.samples)*99/100],
+		Max:  s.max,
+	}
+}
@@ -0,0 +1,124 @@
+package panicwrap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBenchmark(t *testing.T) {
+	results, err := Benchmark(&BenchConfig{Rates: []int{0, 1000}, Duration: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(results) != 2 || results[0].Rate != 0 || results[1].Rate != 1000 {
+		t.Fatalf("bad: %#v", results)
+	}
+	for _, r := range results {
+		if r.Lines == 0 || r.Throughput <= 0 || r.BaselineThroughput <= 0 {
+			t.Fatalf("bad: %#v", r)
+		}
+		if l := r.Latency; l.Mean <= 0 || l.P50 > l.P99 || l.P99 > l.Max {
+			t.Fatalf("bad: %#v", l)
+		}
+	}
+
+	// The paced run writes a line a millisecond.
+	if n := results[1].Lines; n != 50 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestBenchmark_invalid(t *testing.T) {
+	if _, err := Benchmark(&BenchConfig{Rates: []int{-1}}); err == nil {
+		t.Fatal("should reject a negative rate")
+	}
+	if _, err := Benchmark(&BenchConfig{LineSize: 10}); err == nil {
+		t.Fatal("should reject a line too short for its time stamp")
+	}
+}
+
+func TestBenchmark_stats(t *testing.T) {
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	var st *WrapStats
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(*PanicInfo) {
+			if _, err := Benchmark(&BenchConfig{Rates: []int{1000}, Duration: 20 * time.Millisecond}); err != nil {
+				t.Errorf("err: %s", err)
+			}
+			st, _ = Stats()
+		},
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if st == nil || len(st.Benchmark) != 1 || st.Benchmark[0].Rate != 1000 {
+		t.Fatalf("bad: %#v", st)
+	}
+}
+
+func TestLatencySink(t *testing.T) {
+	s := &latencySink{start: time.Now()}
+	s.Write([]byte("0000000000000000000 a\n00000000"))
+	s.Write([]byte("00000000001 b\nnot a stamp\n"))
+
+	if s.lines != 2 || string(s.partial) != "" {
+		t.Fatalf("bad: %d %q", s.lines, s.partial)
+	}
+	if sum := s.summary(); sum.Max <= 0 || sum.P50 > sum.Max {
+		t.Fatalf("bad: %#v", sum)
+	}
+}
+
+// benchLines is the output the benchmarks of the detection forward.
+var benchLines = bytes.Repeat([]byte("level=info msg=\"handled request\" path=/api/v1/items status=200\n"), 64)
+
+func BenchmarkTrackPanic(b *testing.B) {
+	b.SetBytes(int64(len(benchLines)))
+	r, w := io.Pipe()
+	result := make(chan string, 1)
+	go trackPanic(r, io.Discard, time.Second, time.Second, realClock{}, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	for i := 0; i < b.N; i++ {
+		w.Write(benchLines)
+	}
+	w.Close()
+	<-result
+}
+
+func BenchmarkTrackPanic_strict(b *testing.B) {
+	b.SetBytes(int64(len(benchLines)))
+	r, w := io.Pipe()
+	result := make(chan string, 1)
+	go trackPanic(r, io.Discard, time.Second, time.Second, realClock{}, defaultTrackSize, false, headerRules{strict: true, skipJSON: true}, nil, nil, result)
+
+	for i := 0; i < b.N; i++ {
+		w.Write(benchLines)
+	}
+	w.Close()
+	<-result
+}
+
+func BenchmarkCopy(b *testing.B) {
+	b.SetBytes(int64(len(benchLines)))
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		io.CopyBuffer(io.Discard, r, make([]byte, defaultTrackSize))
+		close(done)
+	}()
+
+	for i := 0; i < b.N; i++ {
+		w.Write(benchLines)
+	}
+	w.Close()
+	<-done
+}
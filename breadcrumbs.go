@@ -0,0 +1,152 @@
+package panicwrap
+
+import (
+	"encoding/binary"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"unsafe"
+)
+
+// breadcrumbsEnvKey passes the file descriptor of the breadcrumb ring to
+// the child. See WrapConfig.BreadcrumbSize.
+const breadcrumbsEnvKey = "PANICWRAP_BREADCRUMBS_FD"
+
+// The layout of the breadcrumb ring. It starts with a header of
+// breadcrumbHeaderSize bytes, whose first 8 bytes count the breadcrumbs
+// that were started so far, followed by slots of breadcrumbSlotSize bytes.
+// A slot starts with the number of its breadcrumb, counting from 1,
+// shifted left by one, whose low bit is set while the slot is written. It
+// is followed by the length of the message in 2 bytes, then the message,
+// cut to breadcrumbMaxLen bytes. Slots are only accessed a word of 8 bytes
+// at a time, atomically, since the child may write one while another
+// goroutine writes or reads it.
+const (
+	breadcrumbHeaderSize = 64
+	breadcrumbSlotSize   = 128
+	breadcrumbMaxLen     = breadcrumbSlotSize - 10
+)
+
+// breadcrumbRing is a ring of breadcrumbs in memory that the parent and
+// the child share, so that the parent can read what the child wrote once
+// it died.
+type breadcrumbRing struct {
+	mem   []byte
+	slots uint64
+}
+
+// activeBreadcrumbs is the ring of this child, if the parent passed one.
+var activeBreadcrumbs atomic.Pointer[breadcrumbRing]
+
+// Breadcrumb records a short message, such as the step a request is at,
+// in the ring of breadcrumbs that the parent reads when the child
+// crashes, and passes to the handlers in PanicInfo.Breadcrumbs. It writes
+// to memory that the parent shares rather than to a pipe, so that it costs
+// no more than a few atomic operations, and can be called from hot paths,
+// and what was written survives the child. Messages are cut to
+// 118 bytes.
+//
+// It is meant to be called from the child, and does nothing unless
+// WrapConfig.BreadcrumbSize is set.
+func Breadcrumb(msg string) {
+	if r := activeBreadcrumbs.Load(); r != nil {
+		r.add(msg)
+	}
+}
+
+// newBreadcrumbRing returns the ring in the memory, which is at least
+// breadcrumbHeaderSize plus one slot long.
+func newBreadcrumbRing(mem []byte) *breadcrumbRing {
+	return &breadcrumbRing{mem: mem, slots: uint64((len(mem) - breadcrumbHeaderSize) / breadcrumbSlotSize)}
+}
+
+// word returns the 8 bytes of the ring at the offset, which is a multiple
+// of 8, to be accessed atomically.
+func (r *breadcrumbRing) word(off uint64) *atomic.Uint64 {
+	return (*atomic.Uint64)(unsafe.Pointer(&r.mem[off]))
+}
+
+// add writes a breadcrumb to the next slot. It marks the slot as being
+// written until it is done, so that readers skip it. A writer that finds
+// the slot being written by another one that lapped the ring waits for
+// it, and one that finds a newer breadcrumb there drops its own, which
+// would be overwritten anyway.
+func (r *breadcrumbRing) add(msg string) {
+	n := r.word(0).Add(1)
+	off := breadcrumbHeaderSize + (n-1)%r.slots*breadcrumbSlotSize
+	state := r.word(off)
+	for {
+		cur := state.Load()
+		if cur&1 == 0 {
+			if cur>>1 >= n {
+				return
+			}
+			if state.CompareAndSwap(cur, n<<1|1) {
+				break
+			}
+		}
+		runtime.Gosched()
+	}
+
+	var payload [breadcrumbSlotSize - 8]byte
+	l := copy(payload[2:], msg)
+	binary.NativeEndian.PutUint16(payload[:], uint16(l))
+	for i := 0; i < len(payload); i += 8 {
+		r.word(off + 8 + uint64(i)).Store(binary.NativeEndian.Uint64(payload[i:]))
+	}
+	state.Store(n << 1)
+}
+
+// read returns the breadcrumbs in the ring, oldest first.
+func (r *breadcrumbRing) read() []string {
+	type crumb struct {
+		n   uint64
+		msg string
+	}
+	// Slots whose breadcrumb is older than the last that were started are
+	// being written, or were when the child died.
+	var oldest uint64
+	if started := r.word(0).Load(); started > r.slots {
+		oldest = started - r.slots
+	}
+	var crumbs []crumb
+	for i := uint64(0); i < r.slots; i++ {
+		off := breadcrumbHeaderSize + i*breadcrumbSlotSize
+
+		cur := r.word(off).Load()
+		n := cur >> 1
+		if cur&1 != 0 || n == 0 || n <= oldest {
+			continue
+		}
+		var payload [breadcrumbSlotSize - 8]byte
+		for j := 0; j < len(payload); j += 8 {
+			binary.NativeEndian.PutUint64(payload[j:], r.word(off+8+uint64(j)).Load())
+		}
+		if r.word(off).Load() != cur {
+			continue
+		}
+		l := int(binary.NativeEndian.Uint16(payload[:]))
+		if l > breadcrumbMaxLen {
+			continue
+		}
+		crumbs = append(crumbs, crumb{n, string(payload[2 : 2+l])})
+	}
+
+	slices.SortFunc(crumbs, func(a, b crumb) int {
+		if a.n < b.n {
+			return -1
+		}
+		return 1
+	})
+	result := make([]string, len(crumbs))
+	for i, c := range crumbs {
+		result[i] = c.msg
+	}
+	return result
+}
+
+// breadcrumbRingSize returns the size of the ring for the configured
+// size, rounded down to whole slots.
+func breadcrumbRingSize(size int) int {
+	return breadcrumbHeaderSize + (size-breadcrumbHeaderSize)/breadcrumbSlotSize*breadcrumbSlotSize
+}
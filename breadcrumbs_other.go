@@ -0,0 +1,26 @@
+//go:build !unix
+
+package panicwrap
+
+import (
+	"errors"
+	"os"
+)
+
+// breadcrumbsSupported is whether WrapConfig.BreadcrumbSize can be used.
+const breadcrumbsSupported = false
+
+type parentBreadcrumbs struct {
+	*breadcrumbRing
+	f *os.File
+}
+
+func createBreadcrumbs(size int) (*parentBreadcrumbs, error) {
+	return nil, errors.New("panicwrap: breadcrumbs are not supported on this platform")
+}
+
+func (p *parentBreadcrumbs) close() {}
+
+func startBreadcrumbs() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package panicwrap
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBreadcrumbRing(t *testing.T) {
+	r := newBreadcrumbRing(make([]byte, breadcrumbRingSize(64+3*128+100)))
+	if r.slots != 3 {
+		t.Fatalf("bad: %d", r.slots)
+	}
+	if crumbs := r.read(); len(crumbs) != 0 {
+		t.Fatalf("bad: %q", crumbs)
+	}
+
+	r.add("a")
+	r.add("b")
+	if crumbs := r.read(); !reflect.DeepEqual(crumbs, []string{"a", "b"}) {
+		t.Fatalf("bad: %q", crumbs)
+	}
+
+	// The oldest are overwritten.
+	r.add("c")
+	r.add("d")
+	r.add(strings.Repeat("x", 200))
+	expected := []string{"c", "d", strings.Repeat("x", breadcrumbMaxLen)}
+	if crumbs := r.read(); !reflect.DeepEqual(crumbs, expected) {
+		t.Fatalf("bad: %q", crumbs)
+	}
+}
+
+func TestBreadcrumbRing_torn(t *testing.T) {
+	r := newBreadcrumbRing(make([]byte, breadcrumbRingSize(64+2*128)))
+	r.add("a")
+	r.add("b")
+
+	// A writer started on the slot of "a", and died before it was done.
+	r.word(0).Add(1)
+	copy(r.mem[64+10:], "half")
+
+	if crumbs := r.read(); !reflect.DeepEqual(crumbs, []string{"b"}) {
+		t.Fatalf("bad: %q", crumbs)
+	}
+
+	// One died while it wrote the slot of "b", after it marked it.
+	r.word(0).Add(1)
+	r.word(64 + 128).Store(4<<1 | 1)
+
+	if crumbs := r.read(); len(crumbs) != 0 {
+		t.Fatalf("bad: %q", crumbs)
+	}
+}
+
+func TestBreadcrumbRing_concurrent(t *testing.T) {
+	r := newBreadcrumbRing(make([]byte, breadcrumbRingSize(64+64*128)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				r.add(fmt.Sprintf("%d-%d", i, j))
+			}
+		}()
+	}
+	wg.Wait()
+
+	crumbs := r.read()
+	if len(crumbs) != 64 {
+		t.Fatalf("bad: %d", len(crumbs))
+	}
+	// What each writer wrote is in its order.
+	last := make(map[string]int)
+	for _, c := range crumbs {
+		var w string
+		var n int
+		fmt.Sscanf(strings.Replace(c, "-", " ", 1), "%s %d", &w, &n)
+		if prev, ok := last[w]; ok && n <= prev {
+			t.Fatalf("out of order: %q", crumbs)
+		}
+		last[w] = n
+	}
+}
+
+func TestBreadcrumb_inactive(t *testing.T) {
+	// Outside of a child, it does nothing.
+	Breadcrumb("nothing")
+}
+
+func BenchmarkBreadcrumb(b *testing.B) {
+	r := newBreadcrumbRing(make([]byte, breadcrumbRingSize(1<<16)))
+	for i := 0; i < b.N; i++ {
+		r.add("handling request")
+	}
+}
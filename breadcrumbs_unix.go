@@ -0,0 +1,80 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// breadcrumbsSupported is whether WrapConfig.BreadcrumbSize can be used.
+const breadcrumbsSupported = true
+
+// parentBreadcrumbs is the parent side of the breadcrumb ring of a child.
+type parentBreadcrumbs struct {
+	*breadcrumbRing
+	f *os.File
+}
+
+// createBreadcrumbs creates the breadcrumb ring of a child, in a file that
+// is removed right away and only lives on as the descriptor passed to the
+// child.
+func createBreadcrumbs(size int) (*parentBreadcrumbs, error) {
+	f, err := os.CreateTemp("", "panicwrap-breadcrumbs-")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+
+	size = breadcrumbRingSize(size)
+	if err := f.Truncate(int64(size)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &parentBreadcrumbs{breadcrumbRing: newBreadcrumbRing(mem), f: f}, nil
+}
+
+// close unmaps the ring and closes its file.
+func (p *parentBreadcrumbs) close() {
+	syscall.Munmap(p.mem)
+	p.f.Close()
+}
+
+// startBreadcrumbs maps the breadcrumb ring the parent passed, if any.
+func startBreadcrumbs() error {
+	v := os.Getenv(breadcrumbsEnvKey)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(breadcrumbsEnvKey)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("panicwrap: invalid %s %q", breadcrumbsEnvKey, v)
+	}
+	f := os.NewFile(uintptr(fd), "panicwrap-breadcrumbs")
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < breadcrumbHeaderSize+breadcrumbSlotSize {
+		return fmt.Errorf("panicwrap: breadcrumb ring of %d bytes is too small", fi.Size())
+	}
+	mem, err := syscall.Mmap(fd, 0, int(fi.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+
+	activeBreadcrumbs.Store(newBreadcrumbRing(mem))
+	return nil
+}
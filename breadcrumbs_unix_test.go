@@ -0,0 +1,40 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPanicWrap_breadcrumbs(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("breadcrumbs")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err == nil {
+		t.Fatal("should exit with the panic")
+	}
+
+	if out := stdout.String(); !strings.Contains(out, "breadcrumbs: [\"step 2\" \"step 3\" \"step 4\"]\n") {
+		t.Fatalf("bad: %q", out)
+	}
+}
+
+func TestCreateBreadcrumbs(t *testing.T) {
+	p, err := createBreadcrumbs(1000)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer p.close()
+
+	if len(p.mem) != 64+7*128 || p.slots != 7 {
+		t.Fatalf("bad: %d %d", len(p.mem), p.slots)
+	}
+	p.add("hello")
+	if crumbs := p.read(); len(crumbs) != 1 || crumbs[0] != "hello" {
+		t.Fatalf("bad: %q", crumbs)
+	}
+}
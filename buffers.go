@@ -0,0 +1,58 @@
+package panicwrap
+
+import (
+	"io"
+)
+
+// defaultTrackSize is how much of stderr is inspected for panic headers
+// at once unless WrapConfig.StderrBuffers sets the read size.
+const defaultTrackSize = 2048
+
+// StreamBuffers sets the sizes of the buffers for one output stream of
+// the child. See WrapConfig.StdoutBuffers and StderrBuffers.
+type StreamBuffers struct {
+	// ReadSize is how much the parent reads from the stream at once.
+	// Larger reads take fewer system calls for a child that writes a lot
+	// of output, smaller ones less memory for each child. Defaults to 32
+	// KiB.
+	ReadSize int
+
+	// PipeSize is the capacity of the pipe the child writes the stream
+	// to, which holds its output while the parent is busy writing it
+	// out. The child blocks once it is full. The kernel rounds it up to
+	// whole pages and refuses sizes above /proc/sys/fs/pipe-max-size to
+	// unprivileged processes, which is reported to InternalErrorHandler.
+	// Defaults to that of the system, 64 KiB on Linux. This is only
+	// supported on Linux and ignored elsewhere.
+	PipeSize int
+}
+
+// bufferWriter applies StreamBuffers to the stream the command copies
+// into it. Like eofWriter, it relies on io.Copy handing it the whole pipe
+// through ReadFrom.
+type bufferWriter struct {
+	w      io.Writer
+	config *StreamBuffers
+	report func(error)
+}
+
+func (b *bufferWriter) Write(p []byte) (int, error) {
+	return b.w.Write(p)
+}
+
+func (b *bufferWriter) ReadFrom(r io.Reader) (int64, error) {
+	if b.config.PipeSize > 0 {
+		if err := setPipeSize(r, b.config.PipeSize); err != nil {
+			b.report(err)
+		}
+	}
+
+	size := b.config.ReadSize
+	if size <= 0 {
+		size = 32 * 1024
+	}
+
+	// Hide the ReadFrom of the writer, if any, so that the buffer is
+	// used.
+	return io.CopyBuffer(struct{ io.Writer }{b.w}, r, make([]byte, size))
+}
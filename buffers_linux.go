@@ -0,0 +1,32 @@
+package panicwrap
+
+import (
+	"io"
+	"syscall"
+)
+
+// setPipeSize sets the capacity of the pipe the reader reads from. Readers
+// other than pipes, such as those of an Executor, are left alone.
+func setPipeSize(r io.Reader, size int) error {
+	sc, ok := r.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var errno syscall.Errno
+	err = raw.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETPIPE_SZ, uintptr(size))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
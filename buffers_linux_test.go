@@ -0,0 +1,28 @@
+package panicwrap
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestSetPipeSize(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if err := setPipeSize(r, 128*1024); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	size, _, errno := syscall.Syscall(syscall.SYS_FCNTL, r.Fd(), syscall.F_GETPIPE_SZ, 0)
+	if errno != 0 {
+		t.Fatalf("err: %s", errno)
+	}
+	if size != 128*1024 {
+		t.Fatalf("bad: %d", size)
+	}
+}
@@ -0,0 +1,58 @@
+package panicwrap
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// sizeReader records the sizes of the reads from it.
+type sizeReader struct {
+	r     io.Reader
+	sizes []int
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	s.sizes = append(s.sizes, len(p))
+	return s.r.Read(p)
+}
+
+func TestBufferWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := &bufferWriter{w: out, config: &StreamBuffers{ReadSize: 5}, report: func(err error) {
+		t.Fatalf("err: %s", err)
+	}}
+
+	r := &sizeReader{r: strings.NewReader("some output")}
+	if _, err := io.Copy(w, r); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if out.String() != "some output" {
+		t.Fatalf("bad: %#v", out.String())
+	}
+	for _, n := range r.sizes {
+		if n != 5 {
+			t.Fatalf("bad: %v", r.sizes)
+		}
+	}
+}
+
+func TestPanicWrap_buffers(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("buffers")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(stdout.String(), strings.Repeat("output ", 1000)) {
+		t.Fatalf("should forward all of stdout: %#v", stdout.String())
+	}
+	if wrapRe.FindString(stdout.String()) == "" {
+		t.Fatalf("didn't wrap: %#v", stdout.String())
+	}
+}
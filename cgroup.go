@@ -0,0 +1,122 @@
+package panicwrap
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CgroupConfig places each child in a cgroup v2 cgroup of its own, which
+// limits its resources. An out of memory child is then killed by the
+// kernel without the parent, which reports its crashes, being at risk.
+// This is only supported on Linux, and only used if WrapConfig.Cgroup is
+// set.
+type CgroupConfig struct {
+	// Dir is the cgroup under which the parent creates the cgroup of each
+	// child, such as "/sys/fs/cgroup/myapp". It is required. It must be
+	// writable by the parent, and have the controllers of the limits
+	// below enabled in its cgroup.subtree_control.
+	Dir string
+
+	// If greater than zero, the memory.max of the child in bytes. The
+	// child is killed as a whole when it goes over it.
+	MemoryMax int64
+
+	// If greater than zero, the number of CPUs the child may use, such as
+	// 1.5, which is set as the quota of its cpu.max.
+	CPUMax float64
+}
+
+// oomKillText follows the signal in the text of a child that was killed
+// for going over the memory.max of its cgroup. See KindOOMKill.
+const oomKillText = "killed for going over the memory.max of its cgroup\n"
+
+// CgroupStats describes the resource usage of a child in the cgroup of
+// its own. See WrapConfig.Cgroup.
+type CgroupStats struct {
+	// Path is the path of the cgroup, which is removed once the child
+	// exited.
+	Path string `json:"path"`
+
+	// MemoryPeak is the largest memory usage of the cgroup in bytes. It
+	// is zero on kernels before 5.19.
+	MemoryPeak int64 `json:"memory_peak"`
+
+	// OOMKills is the number of processes of the cgroup that were killed
+	// for going over its memory.max.
+	OOMKills int `json:"oom_kills"`
+
+	// The pressure stall information of the cgroup. They are nil if the
+	// kernel doesn't provide it.
+	MemoryPressure *Pressure `json:"memory_pressure,omitempty"`
+	CPUPressure    *Pressure `json:"cpu_pressure,omitempty"`
+}
+
+// Pressure is the pressure stall information of a resource: how much
+// some of the tasks of a cgroup were stalled waiting for it.
+type Pressure struct {
+	// The percentage of time the tasks were stalled over the last 10, 60
+	// and 300 seconds.
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+
+	// Total is the total time the tasks were stalled.
+	Total time.Duration `json:"total"`
+}
+
+// parsePressure parses the "some" line of a pressure file such as
+// memory.pressure.
+func parsePressure(data string) *Pressure {
+	s := bufio.NewScanner(strings.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+
+		p := new(Pressure)
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			switch k {
+			case "avg10":
+				p.Avg10, _ = strconv.ParseFloat(v, 64)
+			case "avg60":
+				p.Avg60, _ = strconv.ParseFloat(v, 64)
+			case "avg300":
+				p.Avg300, _ = strconv.ParseFloat(v, 64)
+			case "total":
+				us, _ := strconv.ParseInt(v, 10, 64)
+				p.Total = time.Duration(us) * time.Microsecond
+			}
+		}
+		return p
+	}
+
+	return nil
+}
+
+// parseKeyed returns the value of the given key in a flat keyed cgroup
+// file such as memory.events.
+func parseKeyed(data, key string) int64 {
+	s := bufio.NewScanner(strings.NewReader(data))
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), " ")
+		if ok && k == key {
+			n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return n
+		}
+	}
+
+	return 0
+}
+
+// cgroupCPUPeriod is the period of the cpu.max of a child.
+const cgroupCPUPeriod = 100 * time.Millisecond
+
+// cpuMax returns the cpu.max value for the given number of CPUs.
+func cpuMax(cpus float64) string {
+	period := cgroupCPUPeriod.Microseconds()
+	return strconv.FormatInt(int64(cpus*float64(period)), 10) + " " + strconv.FormatInt(period, 10)
+}
@@ -0,0 +1,105 @@
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// cgroupSeq numbers the cgroups of the children of this parent.
+var cgroupSeq atomic.Int64
+
+// cgroup is the cgroup of a child.
+type cgroup struct {
+	path string
+	dir  *os.File
+}
+
+// newCgroup creates a cgroup for a child under the configured directory
+// and sets its limits.
+func newCgroup(c *CgroupConfig) (*cgroup, error) {
+	name := fmt.Sprintf("panicwrap-%d-%d", os.Getpid(), cgroupSeq.Add(1))
+	g := &cgroup{path: filepath.Join(c.Dir, name)}
+	if err := os.Mkdir(g.path, 0755); err != nil {
+		return nil, err
+	}
+
+	var files [][2]string
+	if c.MemoryMax > 0 {
+		files = append(files,
+			[2]string{"memory.max", strconv.FormatInt(c.MemoryMax, 10)},
+			[2]string{"memory.oom.group", "1"})
+	}
+	if c.CPUMax > 0 {
+		files = append(files, [2]string{"cpu.max", cpuMax(c.CPUMax)})
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(g.path, f[0]), []byte(f[1]), 0644); err != nil {
+			os.Remove(g.path)
+			return nil, err
+		}
+	}
+
+	dir, err := os.Open(g.path)
+	if err != nil {
+		os.Remove(g.path)
+		return nil, err
+	}
+	g.dir = dir
+
+	return g, nil
+}
+
+// setCgroup makes the command start in the given cgroup.
+func setCgroup(cmd *exec.Cmd, g *cgroup) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(g.dir.Fd())
+}
+
+// oomKilled returns whether the child was killed by the kernel for going
+// over the memory.max of its cgroup. Its cgroup is its own, so any
+// oom_kill in it counts.
+func oomKilled(res *childResult) bool {
+	return res.cgroup != nil && res.cgroup.OOMKills > 0 && syscall.Signal(res.signal) == syscall.SIGKILL
+}
+
+func (g *cgroup) stats() *CgroupStats {
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(g.path, name))
+		return string(data)
+	}
+
+	s := &CgroupStats{
+		Path:     g.path,
+		OOMKills: int(parseKeyed(read("memory.events"), "oom_kill")),
+	}
+	s.MemoryPeak, _ = strconv.ParseInt(strings.TrimSpace(read("memory.peak")), 10, 64)
+	s.MemoryPressure = parsePressure(read("memory.pressure"))
+	s.CPUPressure = parsePressure(read("cpu.pressure"))
+
+	return s
+}
+
+// remove kills what is left in the cgroup, such as processes the child
+// started, and removes it.
+func (g *cgroup) remove() {
+	g.dir.Close()
+	os.WriteFile(filepath.Join(g.path, "cgroup.kill"), []byte("1"), 0644)
+
+	// The cgroup can only be removed once the killed processes are gone.
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(g.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,70 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// testCgroupDir returns a cgroup v2 cgroup the test can create cgroups
+// in, or skips the test.
+func testCgroupDir(t *testing.T) string {
+	for _, root := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"} {
+		if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+			continue
+		}
+
+		dir, err := os.MkdirTemp(root, "panicwrap-test-")
+		if err != nil {
+			continue
+		}
+		t.Cleanup(func() { os.Remove(dir) })
+		return dir
+	}
+
+	t.Skip("no writable cgroup v2 hierarchy")
+	return ""
+}
+
+func TestPanicWrap_cgroup(t *testing.T) {
+	dir := testCgroupDir(t)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("cgroup", dir)
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s\n%s", err, stderr)
+	}
+
+	_, path, ok := strings.Cut(stdout.String(), "cgroup: ")
+	if !ok || filepath.Dir(path) != dir {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("should remove the cgroup: %v", err)
+	}
+}
+
+func TestOOMKilled(t *testing.T) {
+	killed := &childResult{signal: int(syscall.SIGKILL), cgroup: &CgroupStats{OOMKills: 1}}
+	if !oomKilled(killed) {
+		t.Fatal("should be killed for going over memory.max")
+	}
+
+	for _, res := range []*childResult{
+		{signal: int(syscall.SIGKILL)},
+		{signal: int(syscall.SIGKILL), cgroup: &CgroupStats{}},
+		{signal: int(syscall.SIGSEGV), cgroup: &CgroupStats{OOMKills: 1}},
+		{signal: -1, cgroup: &CgroupStats{OOMKills: 1}},
+	} {
+		if oomKilled(res) {
+			t.Fatalf("bad: %#v", res)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package panicwrap
+
+import (
+	"errors"
+	"os/exec"
+)
+
+type cgroup struct{}
+
+func newCgroup(*CgroupConfig) (*cgroup, error) {
+	return nil, errors.New("panicwrap: Cgroup is only supported on Linux")
+}
+
+func setCgroup(*exec.Cmd, *cgroup) {}
+
+func (*cgroup) stats() *CgroupStats { return nil }
+
+func (*cgroup) remove() {}
+
+func oomKilled(*childResult) bool { return false }
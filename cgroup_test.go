@@ -0,0 +1,47 @@
+package panicwrap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePressure(t *testing.T) {
+	data := "some avg10=1.50 avg60=0.25 avg300=0.00 total=2500\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=100\n"
+
+	expected := &Pressure{Avg10: 1.5, Avg60: 0.25, Total: 2500 * time.Microsecond}
+	if p := parsePressure(data); !reflect.DeepEqual(p, expected) {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	if p := parsePressure(""); p != nil {
+		t.Fatalf("bad: %#v", p)
+	}
+}
+
+func TestParseKeyed(t *testing.T) {
+	data := "low 0\nhigh 0\nmax 12\noom 2\noom_kill 1\n"
+
+	if n := parseKeyed(data, "oom_kill"); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := parseKeyed(data, "missing"); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestCPUMax(t *testing.T) {
+	if s := cpuMax(1.5); s != "150000 100000" {
+		t.Fatalf("bad: %s", s)
+	}
+}
+
+func TestWrap_cgroupDir(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler: func(string) {},
+		Cgroup:  &CgroupConfig{},
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
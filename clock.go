@@ -0,0 +1,29 @@
+package panicwrap
+
+import (
+	"time"
+)
+
+// Clock is the source of time for the detection of panics, the restart
+// backoff and the crash times. It is meant for tests, which can use it to
+// run through timing-dependent cases without real delays. See
+// WrapConfig.Clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel on which the current time is sent once the
+	// duration elapsed, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the default Clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
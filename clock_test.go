@@ -0,0 +1,339 @@
+package panicwrap
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when told to.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+
+	// waiting receives a value whenever After is called.
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		waiting: make(chan struct{}, 16),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{c.now.Add(d), ch})
+	c.mu.Unlock()
+
+	c.waiting <- struct{}{}
+	return ch
+}
+
+// waitTimer waits until a timer is due d or more from now, whatever the
+// timers that were set before it.
+func (c *fakeClock) waitTimer(d time.Duration) {
+	for {
+		c.mu.Lock()
+		for _, t := range c.timers {
+			if !t.at.Before(c.now.Add(d)) {
+				c.mu.Unlock()
+				return
+			}
+		}
+		c.mu.Unlock()
+		<-c.waiting
+	}
+}
+
+// Advance moves the time forward and fires the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = timers
+}
+
+// syncBuffer is a bytes.Buffer that can be written and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTrackPanic_notPanicAfterTimeout(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, 0, clock, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	w.Write([]byte("panic: not really\n"))
+	<-clock.waiting
+
+	// Nothing else happens before the detection timer fires, so the
+	// output is forwarded once more of it arrives.
+	clock.Advance(time.Second)
+	w.Write([]byte("still running\n"))
+	w.Close()
+
+	if text, ok := <-result; ok {
+		t.Fatalf("shouldn't be a panic: %q", text)
+	}
+	if out.String() != "panic: not really\nstill running\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_panicBeforeTimeout(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, 0, clock, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	w.Write([]byte("starting\npanic: boom\n"))
+	<-clock.waiting
+	clock.Advance(time.Second - time.Millisecond)
+	w.Write([]byte("\ngoroutine 1 [running]:\n"))
+	w.Close()
+
+	if text := <-result; text != "panic: boom\n\ngoroutine 1 [running]:\n" {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "starting\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_splitHeader(t *testing.T) {
+	// Headers split across reads aren't detected if the start isn't held
+	// back for the rest.
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, 0, clock, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	w.Write([]byte("pan"))
+	w.Write([]byte("ic: oh crap\n"))
+	w.Close()
+
+	if text, ok := <-result; ok {
+		t.Fatalf("detected: %q", text)
+	}
+	if out.String() != "panic: oh crap\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_splitHeaderHeld(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, time.Second, clock, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	w.Write([]byte("starting\npan"))
+	<-clock.waiting
+	w.Write([]byte("ic: oh crap\n"))
+	w.Close()
+
+	if text := <-result; text != "panic: oh crap\n" {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "starting\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_splitHeaderTimeout(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, time.Second, clock, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	// What is held back is written out once the wait is over, even
+	// though nothing else arrives.
+	w.Write([]byte("starting\npan"))
+	<-clock.waiting
+	clock.Advance(time.Second)
+	for out.String() != "starting\npan" {
+		time.Sleep(time.Millisecond)
+	}
+
+	w.Write([]byte("ic: not one\n"))
+	w.Close()
+	if text, ok := <-result; ok {
+		t.Fatalf("detected: %q", text)
+	}
+	if out.String() != "starting\npanic: not one\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestPartialHeader(t *testing.T) {
+	headers := [][]byte{[]byte("panic:"), []byte("fatal error:")}
+	cases := []struct {
+		buf string
+		n   int
+	}{
+		{"pan", 3},
+		{"output\nfatal e", 7},
+		{"output\n", 0},
+		{"a pan", 0},
+		{"panic:", 0},
+		{"", 0},
+	}
+
+	for _, tc := range cases {
+		if n := partialHeader([]byte(tc.buf), headers); n != tc.n {
+			t.Fatalf("%q: bad: %d", tc.buf, n)
+		}
+	}
+}
+
+func TestWrap_restartBackoffClock(t *testing.T) {
+	clock := newFakeClock()
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	var infos []*PanicInfo
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Wrap(&WrapConfig{
+			InfoHandler: func(i *PanicInfo) { infos = append(infos, i) },
+			Writer:      new(bytes.Buffer),
+			Executor:    e,
+			Clock:       clock,
+			Restart:     &RestartPolicy{MaxRestarts: 1, Backoff: time.Hour, MaxBackoff: 2 * time.Hour},
+		})
+	}()
+
+	// The restart waits for the clock, not for an hour.
+	clock.waitTimer(time.Hour)
+	clock.Advance(time.Hour)
+	<-done
+
+	if len(infos) != 2 || e.started != 2 {
+		t.Fatalf("bad: %d, %d", len(infos), e.started)
+	}
+	if infos[1].SinceFirstCrash != time.Hour || infos[0].Backoff != time.Hour {
+		t.Fatalf("bad: %s, %s", infos[1].SinceFirstCrash, infos[0].Backoff)
+	}
+}
+
+// runningExecutor is a fakeExecutor whose children run for the given times
+// on the clock, one after the other.
+type runningExecutor struct {
+	fakeExecutor
+	clock *fakeClock
+	runs  []time.Duration
+}
+
+func (e *runningExecutor) Start(cmd *exec.Cmd) (Process, error) {
+	p, err := e.fakeExecutor.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return &runningProcess{p, e.clock, e.runs[e.started-1]}, nil
+}
+
+type runningProcess struct {
+	Process
+	clock *fakeClock
+	run   time.Duration
+}
+
+func (p *runningProcess) Wait() (ProcessExit, error) {
+	p.clock.Advance(p.run)
+	return p.Process.Wait()
+}
+
+func TestWrap_restartResetAfter(t *testing.T) {
+	clock := newFakeClock()
+	e := &runningExecutor{
+		fakeExecutor: fakeExecutor{
+			stderr: []string{"panic: boom\n"},
+			exit:   ProcessExit{Status: 2},
+		},
+		clock: clock,
+		runs:  []time.Duration{time.Second, 4 * time.Hour, time.Second},
+	}
+
+	var infos []*PanicInfo
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Wrap(&WrapConfig{
+			InfoHandler: func(i *PanicInfo) { infos = append(infos, i) },
+			Writer:      new(bytes.Buffer),
+			Executor:    e,
+			Clock:       clock,
+			Restart:     &RestartPolicy{MaxRestarts: 1, Backoff: time.Hour, MaxBackoff: time.Hour, ResetAfter: 3 * time.Hour},
+		})
+	}()
+
+	// The second child ran long enough to be healthy, so it is
+	// restarted again, and the third one isn't.
+	go func() {
+		for range 2 {
+			clock.waitTimer(time.Hour)
+			clock.Advance(time.Hour)
+		}
+	}()
+	<-done
+
+	if len(infos) != 3 || e.started != 3 {
+		t.Fatalf("bad: %d, %d", len(infos), e.started)
+	}
+	if infos[1].Restarts != 0 || infos[1].SinceFirstCrash != 0 {
+		t.Fatalf("bad: %d, %s", infos[1].Restarts, infos[1].SinceFirstCrash)
+	}
+	if infos[2].Restarts != 1 || infos[2].SinceFirstCrash != time.Hour+time.Second {
+		t.Fatalf("bad: %d, %s", infos[2].Restarts, infos[2].SinceFirstCrash)
+	}
+}
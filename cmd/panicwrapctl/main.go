@@ -0,0 +1,100 @@
+// Command panicwrapctl sends a command to a parent process of panicwrap
+// that listens on a command socket (see WrapConfig.CommandSocket):
+//
+//	panicwrapctl -socket /run/app.sock status
+//
+// The socket may also be taken from the command_socket of a configuration
+// file (see panicwrap.LoadConfig), which is validated along the way:
+//
+//	panicwrapctl -config /etc/app/panicwrap.json status
+//
+// The commands are status, dump-stacks, restart, shutdown, tail-crash,
+// upgrade, reload, disable-detection, enable-detection and bench. Without
+// a socket, bench measures the overhead of panicwrap in panicwrapctl
+// itself, with the default configuration (see panicwrap.Benchmark):
+//
+//	panicwrapctl bench
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mohsenpashna/panicwrap"
+)
+
+func main() {
+	socket := flag.String("socket", "", "path of the command socket of the parent")
+	config := flag.String("config", "", "path of a configuration file with the command socket")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: panicwrapctl -socket path command\n")
+		fmt.Fprintf(os.Stderr, "       panicwrapctl -config path command\n")
+		fmt.Fprintf(os.Stderr, "       panicwrapctl bench\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *config != "" && *socket == "" {
+		c, err := panicwrap.LoadConfig(*config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "panicwrapctl: %s\n", err)
+			os.Exit(1)
+		}
+		*socket = c.CommandSocket
+	}
+	if flag.NArg() != 1 || *socket == "" && flag.Arg(0) != panicwrap.CommandBench {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var resp *panicwrap.CommandResponse
+	var err error
+	if *socket == "" {
+		resp = new(panicwrap.CommandResponse)
+		resp.Benchmark, err = panicwrap.Benchmark(nil)
+	} else {
+		resp, err = panicwrap.SendCommand(*socket, flag.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "panicwrapctl: %s\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case len(resp.Benchmark) > 0:
+		printBenchmark(resp.Benchmark)
+	case resp.Text != "":
+		fmt.Print(resp.Text)
+	case resp.PID != 0:
+		fmt.Printf("parent: %d\n", resp.PID)
+		for _, pid := range resp.ChildPIDs {
+			fmt.Printf("child: %d\n", pid)
+		}
+	}
+}
+
+// printBenchmark prints the results of a benchmark as a table, with the
+// figures of the plain copy in parentheses.
+func printBenchmark(results []panicwrap.BenchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "rate (lines/s)\tlines\tthroughput (MB/s)\tp50\tp99\tmax\t")
+	for _, r := range results {
+		rate := "max"
+		if r.Rate > 0 {
+			rate = fmt.Sprint(r.Rate)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.1f (%.1f)\t%s (%s)\t%s (%s)\t%s (%s)\t\n", rate, r.Lines,
+			r.Throughput/1e6, r.BaselineThroughput/1e6,
+			round(r.Latency.P50), round(r.BaselineLatency.P50),
+			round(r.Latency.P99), round(r.BaselineLatency.P99),
+			round(r.Latency.Max), round(r.BaselineLatency.Max))
+	}
+	w.Flush()
+}
+
+// round rounds a latency to a readable precision.
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,399 @@
+package panicwrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CollectorConfig ships the crashes of the child to a remote collector
+// over a TLS connection that the parent keeps open, and on which both
+// ends present a certificate, so that crashes leave the host as soon as
+// they are handled. This suits fleets whose hosts keep nothing on disk.
+// See WrapConfig.Collector, and panicwrapcollector for a collector.
+//
+// Every crash is sent as a line of JSON with a unique "id" and the
+// PanicInfo as "crash", and the collector answers each with a line with
+// the same "id" once it took the crash. Crashes that weren't answered
+// are kept, and sent again once the parent connects again, so the
+// collector may get a crash twice, and should drop those it has seen.
+type CollectorConfig struct {
+	// Address is the host and port of the collector. It must be set.
+	Address string
+
+	// CertFile and KeyFile are the PEM files of the certificate that the
+	// parent presents to the collector. CAFile, if set, has the
+	// certificates of the authorities that the certificate of the
+	// collector is checked against, instead of those of the system.
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	// TLSConfig, if set, is used instead of the files, such as for
+	// certificates that the program rotates. It must have a certificate
+	// for the parent to present.
+	TLSConfig *tls.Config
+
+	// SpoolDir, if set, is the directory where the crashes are kept until
+	// the collector took them, so that they are sent by the next parent
+	// if this one exits first. They are kept in memory otherwise.
+	SpoolDir string
+
+	// MaxSpooled is the most crashes kept for the collector, past which
+	// the oldest are dropped. Defaults to 1000.
+	MaxSpooled int
+
+	// Timeout is how long connecting to the collector, and sending it a
+	// crash, may take. It is also how long Wrap waits before it returns
+	// for the collector to take the crashes that are left. Defaults to 10
+	// seconds.
+	Timeout time.Duration
+
+	// MaxBackoff is the longest wait before connecting again, after the
+	// connection failed. The wait starts at a second and doubles.
+	// Defaults to a minute.
+	MaxBackoff time.Duration
+}
+
+// tlsConfig returns the TLS configuration of the connections to the
+// collector.
+func (c *CollectorConfig) tlsConfig() (*tls.Config, error) {
+	if c.TLSConfig != nil {
+		return c.TLSConfig.Clone(), nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("panicwrap: loading the certificate for the collector: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("panicwrap: loading the authorities of the collector: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("panicwrap: no certificates in %s", c.CAFile)
+		}
+	}
+
+	return cfg, nil
+}
+
+// collectorReport is a crash sent to the collector.
+type collectorReport struct {
+	ID    string     `json:"id"`
+	Crash *PanicInfo `json:"crash"`
+}
+
+// collectorAck is the answer of the collector to a collectorReport.
+type collectorAck struct {
+	ID string `json:"id"`
+}
+
+// activeCollector is the connection to the collector of the running Wrap
+// call, if any.
+var activeCollector atomic.Pointer[collector]
+
+// collector sends crashes to the collector of WrapConfig.Collector from a
+// goroutine of its own, connecting again whenever the connection fails.
+type collector struct {
+	wc         *WrapConfig
+	c          *CollectorConfig
+	tls        *tls.Config
+	maxSpooled int
+	timeout    time.Duration
+	maxBackoff time.Duration
+
+	// pending are the crashes that the collector didn't take yet, oldest
+	// first.
+	mu      sync.Mutex
+	pending []*collectorReport
+
+	wake  chan struct{}
+	acked chan struct{}
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+// startCollector starts sending crashes to the collector, beginning with
+// those left in SpoolDir.
+func startCollector(wc *WrapConfig) (*collector, error) {
+	c := wc.Collector
+	cfg, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	col := &collector{
+		wc:         wc,
+		c:          c,
+		tls:        cfg,
+		maxSpooled: c.MaxSpooled,
+		timeout:    c.Timeout,
+		maxBackoff: c.MaxBackoff,
+		wake:       make(chan struct{}, 1),
+		acked:      make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if col.maxSpooled == 0 {
+		col.maxSpooled = 1000
+	}
+	if col.timeout == 0 {
+		col.timeout = 10 * time.Second
+	}
+	if col.maxBackoff == 0 {
+		col.maxBackoff = time.Minute
+	}
+	if c.SpoolDir != "" {
+		if col.pending, err = loadSpool(c.SpoolDir); err != nil {
+			return nil, err
+		}
+		col.trim()
+	}
+
+	go col.run()
+	return col, nil
+}
+
+// loadSpool reads the crashes left in the spool directory, oldest first.
+// Those that can't be read are removed.
+func loadSpool(dir string) ([]*collectorReport, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var reports []*collectorReport
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		r := new(collectorReport)
+		if err == nil {
+			err = json.Unmarshal(data, r)
+		}
+		if err != nil || r.Crash == nil || r.ID+".json" != filepath.Base(path) {
+			os.Remove(path)
+			continue
+		}
+		reports = append(reports, r)
+	}
+
+	return reports, nil
+}
+
+// add queues the crash for the collector.
+func (col *collector) add(info *PanicInfo) {
+	// IDs start with the time, so that the spool sorts by age.
+	r := &collectorReport{
+		ID:    fmt.Sprintf("%016x-%s", col.wc.Clock.Now().UnixNano(), newRunID()[:16]),
+		Crash: info,
+	}
+	if col.c.SpoolDir != "" {
+		if err := col.spool(r); err != nil {
+			reportInternal(col.wc, "spooling a crash for the collector", err)
+		}
+	}
+
+	col.mu.Lock()
+	col.pending = append(col.pending, r)
+	col.trim()
+	col.mu.Unlock()
+
+	select {
+	case col.wake <- struct{}{}:
+	default:
+	}
+}
+
+// spool writes the crash to the spool directory.
+func (col *collector) spool(r *collectorReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(col.c.SpoolDir, r.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), col.spoolPath(r.ID))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (col *collector) spoolPath(id string) string {
+	return filepath.Join(col.c.SpoolDir, id+".json")
+}
+
+// trim drops the oldest crashes past MaxSpooled. The lock must be held.
+func (col *collector) trim() {
+	for len(col.pending) > col.maxSpooled {
+		debugf(col.wc, "dropping crash %s, which the collector didn't take", col.pending[0].ID)
+		col.remove(0)
+	}
+}
+
+// remove forgets the crash at index i of pending. The lock must be held.
+func (col *collector) remove(i int) {
+	if col.c.SpoolDir != "" {
+		os.Remove(col.spoolPath(col.pending[i].ID))
+	}
+	col.pending = append(col.pending[:i], col.pending[i+1:]...)
+}
+
+// ack forgets a crash that the collector took.
+func (col *collector) ack(id string) {
+	col.mu.Lock()
+	for i, r := range col.pending {
+		if r.ID == id {
+			col.remove(i)
+			break
+		}
+	}
+	col.mu.Unlock()
+
+	select {
+	case col.acked <- struct{}{}:
+	default:
+	}
+}
+
+func (col *collector) run() {
+	defer close(col.done)
+	backoff := time.Second
+	for {
+		dialer := &net.Dialer{Timeout: col.timeout}
+		conn, err := tls.DialWithDialer(dialer, "tcp", col.c.Address, col.tls)
+		if err == nil {
+			if col.serve(conn) {
+				backoff = time.Second
+			}
+			conn.Close()
+		} else {
+			debugf(col.wc, "connecting to the collector: %s", err)
+		}
+
+		select {
+		case <-col.wc.Clock.After(backoff):
+		case <-col.quit:
+			return
+		}
+		backoff = min(backoff*2, col.maxBackoff)
+	}
+}
+
+// serve sends the crashes to the collector over the connection until it
+// fails or the collector is closed. It returns whether the collector took
+// any crash over it.
+func (col *collector) serve(conn *tls.Conn) bool {
+	debugf(col.wc, "connected to the collector %s", conn.RemoteAddr())
+
+	var took atomic.Bool
+	failed := make(chan struct{})
+	go func() {
+		defer close(failed)
+		dec := json.NewDecoder(conn)
+		for {
+			var a collectorAck
+			if err := dec.Decode(&a); err != nil {
+				debugf(col.wc, "reading from the collector: %s", err)
+				return
+			}
+			took.Store(true)
+			col.ack(a.ID)
+		}
+	}()
+
+	// sent are the IDs of the crashes sent over this connection.
+	sent := make(map[string]bool)
+	enc := json.NewEncoder(conn)
+	for {
+		col.mu.Lock()
+		unsent := make([]*collectorReport, 0, len(col.pending))
+		pending := make(map[string]bool, len(col.pending))
+		for _, r := range col.pending {
+			if sent[r.ID] {
+				pending[r.ID] = true
+			} else {
+				unsent = append(unsent, r)
+			}
+		}
+		col.mu.Unlock()
+		sent = pending
+
+		for _, r := range unsent {
+			conn.SetWriteDeadline(time.Now().Add(col.timeout))
+			if err := enc.Encode(r); err != nil {
+				debugf(col.wc, "sending crash %s to the collector: %s", r.ID, err)
+				conn.Close()
+				<-failed
+				return took.Load()
+			}
+			sent[r.ID] = true
+		}
+
+		select {
+		case <-col.wake:
+		case <-failed:
+			return took.Load()
+		case <-col.quit:
+			conn.Close()
+			<-failed
+			return took.Load()
+		}
+	}
+}
+
+// close waits up to the timeout for the collector to take the crashes
+// that are left, and stops sending. Those it didn't take are reported,
+// and are left in SpoolDir if it is set.
+func (col *collector) close() {
+	deadline := col.wc.Clock.After(col.timeout)
+wait:
+	for {
+		col.mu.Lock()
+		n := len(col.pending)
+		col.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		select {
+		case <-col.acked:
+		case <-deadline:
+			break wait
+		}
+	}
+	close(col.quit)
+	<-col.done
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if n := len(col.pending); n > 0 {
+		where := "lost"
+		if col.c.SpoolDir != "" {
+			where = "left in " + col.c.SpoolDir
+		}
+		reportInternal(col.wc, "sending crashes to the collector", fmt.Errorf("%d crashes weren't taken and are %s", n, where))
+	}
+}
@@ -0,0 +1,320 @@
+package panicwrap
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPKI has the certificates of a collector and of a parent that sends
+// crashes to it.
+type testPKI struct {
+	client *tls.Config
+	server *tls.Config
+
+	// The PEM of the authority, and of the certificate and key of the
+	// parent.
+	caPEM, certPEM, keyPEM []byte
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	caKey := newKey()
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (tls.Certificate, []byte, []byte) {
+		key := newKey()
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, certPEM, keyPEM
+	}
+	serverCert, _, _ := issue(2, "collector", x509.ExtKeyUsageServerAuth)
+	clientCert, certPEM, keyPEM := issue(3, "host-1", x509.ExtKeyUsageClientAuth)
+
+	return &testPKI{
+		client:  &tls.Config{Certificates: []tls.Certificate{clientCert}, RootCAs: pool},
+		server:  &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert},
+		caPEM:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		certPEM: certPEM,
+		keyPEM:  keyPEM,
+	}
+}
+
+// acceptReports accepts a connection to the collector, checks that the
+// parent presented its certificate, and returns the crashes it reads.
+func acceptReports(t *testing.T, l net.Listener) (*tls.Conn, *bufio.Scanner) {
+	t.Helper()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := conn.(*tls.Conn)
+	if err := tc.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if peers := tc.ConnectionState().PeerCertificates; len(peers) == 0 || peers[0].Subject.CommonName != "host-1" {
+		t.Fatalf("bad peer: %v", peers)
+	}
+	return tc, bufio.NewScanner(tc)
+}
+
+func readReport(t *testing.T, s *bufio.Scanner) *collectorReport {
+	t.Helper()
+	if !s.Scan() {
+		t.Fatalf("no report: %v", s.Err())
+	}
+	r := new(collectorReport)
+	if err := json.Unmarshal(s.Bytes(), r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// internalErrors collects the internal errors of a configuration.
+type internalErrors struct {
+	mu   sync.Mutex
+	errs []string
+}
+
+func (e *internalErrors) handle(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs = append(e.errs, err.Error())
+}
+
+func (e *internalErrors) String() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return strings.Join(e.errs, "\n")
+}
+
+func TestCollector(t *testing.T) {
+	pki := newTestPKI(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", pki.server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	errs := new(internalErrors)
+	c := &WrapConfig{
+		Collector:            &CollectorConfig{Address: l.Addr().String(), TLSConfig: pki.client},
+		InternalErrorHandler: errs.handle,
+		Clock:                realClock{},
+	}
+	col, err := startCollector(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.add(&PanicInfo{Text: "panic: boom\n", Value: "boom"})
+
+	conn, s := acceptReports(t, l)
+	defer conn.Close()
+	r := readReport(t, s)
+	if r.ID == "" || r.Crash.Value != "boom" {
+		t.Fatalf("bad: %#v", r)
+	}
+	json.NewEncoder(conn).Encode(collectorAck{ID: r.ID})
+
+	col.close()
+	if len(col.pending) != 0 || errs.String() != "" {
+		t.Fatalf("should be taken: %d, %q", len(col.pending), errs)
+	}
+}
+
+func TestCollector_resend(t *testing.T) {
+	pki := newTestPKI(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", pki.server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	clock := newFakeClock()
+	c := &WrapConfig{
+		Collector: &CollectorConfig{Address: l.Addr().String(), TLSConfig: pki.client},
+		Clock:     clock,
+	}
+	col, err := startCollector(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.add(&PanicInfo{Value: "boom"})
+
+	// The collector goes away before it takes the crash.
+	conn, s := acceptReports(t, l)
+	first := readReport(t, s)
+	conn.Close()
+
+	<-clock.waiting
+	clock.Advance(time.Second)
+	conn, s = acceptReports(t, l)
+	defer conn.Close()
+	again := readReport(t, s)
+	if again.ID != first.ID || again.Crash.Value != "boom" {
+		t.Fatalf("should send the crash again: %#v, %#v", first, again)
+	}
+	json.NewEncoder(conn).Encode(collectorAck{ID: again.ID})
+
+	col.close()
+	if len(col.pending) != 0 {
+		t.Fatalf("bad: %d", len(col.pending))
+	}
+}
+
+func TestCollector_spool(t *testing.T) {
+	pki := newTestPKI(t)
+	dir := filepath.Join(t.TempDir(), "spool")
+
+	// Nothing listens at the address of a closed listener.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	errs := new(internalErrors)
+	c := &WrapConfig{
+		Collector:            &CollectorConfig{Address: addr, TLSConfig: pki.client, SpoolDir: dir, Timeout: 100 * time.Millisecond},
+		InternalErrorHandler: errs.handle,
+		Clock:                realClock{},
+	}
+	col, err := startCollector(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col.add(&PanicInfo{Value: "boom"})
+	col.close()
+
+	if !strings.Contains(errs.String(), "1 crashes weren't taken and are left in "+dir) {
+		t.Fatalf("bad: %q", errs)
+	}
+	spooled, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(spooled) != 1 || filepath.Ext(spooled[0]) != ".json" {
+		t.Fatalf("should spool the crash: %v", spooled)
+	}
+
+	// The next parent sends it.
+	tl, err := tls.Listen("tcp", addr, pki.server)
+	if err != nil {
+		t.Skipf("can't listen at %s again: %s", addr, err)
+	}
+	defer tl.Close()
+	col, err = startCollector(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, s := acceptReports(t, tl)
+	defer conn.Close()
+	r := readReport(t, s)
+	if r.ID+".json" != filepath.Base(spooled[0]) || r.Crash.Value != "boom" {
+		t.Fatalf("bad: %#v", r)
+	}
+	json.NewEncoder(conn).Encode(collectorAck{ID: r.ID})
+
+	col.close()
+	if _, err := os.Stat(spooled[0]); !os.IsNotExist(err) {
+		t.Fatalf("should remove the crash once taken: %v", err)
+	}
+}
+
+func TestCollector_maxSpooled(t *testing.T) {
+	col := &collector{
+		wc:         &WrapConfig{Clock: realClock{}},
+		c:          &CollectorConfig{},
+		maxSpooled: 2,
+		wake:       make(chan struct{}, 1),
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		col.add(&PanicInfo{Value: v})
+	}
+
+	if len(col.pending) != 2 || col.pending[0].Crash.Value != "b" || col.pending[1].Crash.Value != "c" {
+		t.Fatalf("should drop the oldest: %v", col.pending)
+	}
+}
+
+func TestCollectorConfig_tlsConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	c := &CollectorConfig{
+		CertFile: write("cert.pem", pki.certPEM),
+		KeyFile:  write("key.pem", pki.keyPEM),
+		CAFile:   write("ca.pem", pki.caPEM),
+	}
+
+	cfg, err := c.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Certificates) != 1 || cfg.RootCAs == nil {
+		t.Fatalf("bad: %#v", cfg)
+	}
+
+	c.CAFile = c.KeyFile
+	if _, err := c.tlsConfig(); err == nil || !strings.Contains(err.Error(), "no certificates in") {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package panicwrap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The commands the parent accepts on WrapConfig.CommandSocket.
+const (
+	// CommandStatus returns the process IDs of the parent and of the
+	// running children, and the statistics of Stats.
+	CommandStatus = "status"
+
+	// CommandDumpStacks returns a goroutine dump of the child. See
+	// DumpStacks.
+	CommandDumpStacks = "dump-stacks"
+
+	// CommandRestart interrupts the running children and starts them
+	// again right away, whatever WrapConfig.Restart says.
+	CommandRestart = "restart"
+
+	// CommandShutdown asks the children to shut down and keeps them from
+	// being restarted. See Interrupt.
+	CommandShutdown = "shutdown"
+
+	// CommandTailCrash returns the text of the last panic the parent
+	// handled.
+	CommandTailCrash = "tail-crash"
+
+	// CommandUpgrade replaces the running children with ones started from
+	// the executable as it is now. See Upgrade.
+	CommandUpgrade = "upgrade"
+
+	// CommandReload reloads the configuration of the parent. See
+	// WrapConfig.Reload.
+	CommandReload = "reload"
+
+	// CommandDisableDetection turns off the detection of panics until
+	// CommandEnableDetection. See DisableDetection.
+	CommandDisableDetection = "disable-detection"
+
+	// CommandEnableDetection turns the detection of panics back on. See
+	// EnableDetection.
+	CommandEnableDetection = "enable-detection"
+
+	// CommandBench measures the overhead of the detection of panics in
+	// the parent with its configuration, which takes a few seconds. See
+	// Benchmark.
+	CommandBench = "bench"
+)
+
+// commandDumpTimeout is how long CommandDumpStacks waits for the dump.
+const commandDumpTimeout = 10 * time.Second
+
+// commandUpgradeTimeout is how long CommandUpgrade waits for each new
+// child to be ready.
+const commandUpgradeTimeout = time.Minute
+
+// CommandResponse is the answer of the parent to a command.
+type CommandResponse struct {
+	// Error is set if the command failed.
+	Error string `json:"error,omitempty"`
+
+	// PID is the process ID of the parent and ChildPIDs those of the
+	// running children, for CommandStatus.
+	PID       int   `json:"pid,omitempty"`
+	ChildPIDs []int `json:"child_pids,omitempty"`
+
+	// Stats is the snapshot of Stats, for CommandStatus.
+	Stats *WrapStats `json:"stats,omitempty"`
+
+	// Text is the goroutine dump or the panic, for CommandDumpStacks and
+	// CommandTailCrash.
+	Text string `json:"text,omitempty"`
+
+	// Benchmark is what Benchmark measured, for CommandBench.
+	Benchmark []BenchResult `json:"benchmark,omitempty"`
+}
+
+type commandRequest struct {
+	Command string `json:"command"`
+}
+
+// SendCommand sends the command to the parent listening on the given
+// socket and returns its response. An error is returned if the parent
+// can't be reached or the command failed.
+func SendCommand(socket, command string) (*CommandResponse, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(commandRequest{Command: command}); err != nil {
+		return nil, err
+	}
+
+	var resp CommandResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+
+	return &resp, nil
+}
+
+// listenCommands starts accepting commands for the children on the
+// socket at the given path. A socket left behind at the path is replaced,
+// unless a parent is still listening on it.
+func listenCommands(path string, ch *child) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("command socket %s is already in use", path)
+		}
+		if !connRefused(err) {
+			return nil, err
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The socket is created in a directory that only this user can enter
+	// and moved to the path once it is private, so that nobody else can
+	// connect to it in between.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".panicwrap-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dir)
+
+	tmp := filepath.Join(dir, "socket")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(tmp, 0600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveCommand(conn, ch)
+		}
+	}()
+
+	return l, nil
+}
+
+func serveCommand(conn net.Conn, ch *child) {
+	defer conn.Close()
+
+	var req commandRequest
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+
+	var resp *CommandResponse
+	if err != nil {
+		resp = &CommandResponse{Error: err.Error()}
+	} else {
+		resp = runCommand(req.Command, ch)
+	}
+
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func runCommand(command string, ch *child) *CommandResponse {
+	var err error
+	resp := new(CommandResponse)
+	switch command {
+	case CommandStatus:
+		resp.PID = os.Getpid()
+		ch.each(func(w *child) {
+			w.with(func(p Process) error {
+				resp.ChildPIDs = append(resp.ChildPIDs, p.Pid())
+				return nil
+			})
+		})
+		if ch.stats != nil {
+			resp.Stats = ch.stats.snapshot(ch)
+		}
+	case CommandDumpStacks:
+		var d *Dump
+		if d, err = DumpStacks(commandDumpTimeout); err == nil {
+			resp.Text = d.Text
+		}
+	case CommandRestart:
+		ch.each(func(w *child) {
+			w.requestRestart()
+			if werr := w.send(os.Interrupt); err == nil {
+				err = werr
+			}
+		})
+	case CommandShutdown:
+		err = Interrupt()
+	case CommandTailCrash:
+		if resp.Text = ch.lastCrashText(); resp.Text == "" {
+			err = errors.New("panicwrap: no crash yet")
+		}
+	case CommandUpgrade:
+		err = Upgrade(commandUpgradeTimeout)
+	case CommandReload:
+		err = Reload()
+	case CommandDisableDetection:
+		err = DisableDetection()
+	case CommandEnableDetection:
+		err = EnableDetection()
+	case CommandBench:
+		resp.Benchmark, err = Benchmark(nil)
+	default:
+		err = fmt.Errorf("panicwrap: unknown command %q", command)
+	}
+
+	if err != nil {
+		return &CommandResponse{Error: err.Error()}
+	}
+
+	return resp
+}
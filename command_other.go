@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+
+package panicwrap
+
+import (
+	"errors"
+	"syscall"
+)
+
+// connRefused returns whether err is from connecting to a socket that
+// nothing listens on.
+func connRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,7 @@
+package panicwrap
+
+// connRefused returns whether err is from connecting to a socket that
+// nothing listens on. Plan 9 has no Unix sockets.
+func connRefused(err error) bool {
+	return false
+}
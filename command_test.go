@@ -0,0 +1,131 @@
+package panicwrap
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSendCommand(t *testing.T) {
+	e := &fakeExecutor{}
+	ch := new(child)
+	ch.set(&fakeProcess{e: e})
+
+	socket := filepath.Join(t.TempDir(), "s")
+	l, err := listenCommands(socket, ch)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer l.Close()
+
+	resp, err := SendCommand(socket, CommandStatus)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if resp.PID != os.Getpid() || !reflect.DeepEqual(resp.ChildPIDs, []int{4242}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	if _, err := SendCommand(socket, CommandTailCrash); err == nil {
+		t.Fatal("should fail without a crash")
+	}
+	ch.setLastCrash("panic: boom\n")
+	if resp, err := SendCommand(socket, CommandTailCrash); err != nil || resp.Text != "panic: boom\n" {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+
+	if _, err := SendCommand(socket, CommandRestart); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(e.signals, []os.Signal{os.Interrupt}) || !ch.takeRestart() {
+		t.Fatalf("should restart: %#v", e.signals)
+	}
+
+	if _, err := SendCommand(socket, "explode"); err == nil {
+		t.Fatal("should fail")
+	}
+
+	if fi, err := os.Stat(socket); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad: %v, %v", fi, err)
+	}
+}
+
+func TestListenCommands_inUse(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "s")
+	l, err := listenCommands(socket, new(child))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer l.Close()
+
+	if _, err := listenCommands(socket, new(child)); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Fatalf("should fail: %v", err)
+	}
+	if _, err := SendCommand(socket, CommandStatus); err != nil {
+		t.Fatalf("the first should keep the socket: %s", err)
+	}
+}
+
+func TestListenCommands_stale(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = listenCommands(socket, new(child))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer l.Close()
+
+	if _, err := SendCommand(socket, CommandStatus); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("should only leave the socket: %v", entries)
+	}
+
+	file := filepath.Join(dir, "f")
+	os.WriteFile(file, nil, 0644)
+	if _, err := listenCommands(file, new(child)); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+// restartingExecutor asks for a restart while the first child runs.
+type restartingExecutor struct {
+	fakeExecutor
+}
+
+func (e *restartingExecutor) Start(cmd *exec.Cmd) (Process, error) {
+	if e.started == 0 {
+		activeChild.Load().requestRestart()
+	}
+
+	return e.fakeExecutor.Start(cmd)
+}
+
+func TestWrap_restartCommand(t *testing.T) {
+	e := new(restartingExecutor)
+	_, _, err := Wrap(&WrapConfig{
+		Handler:  func(string) {},
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if e.started != 2 {
+		t.Fatalf("should restart once: %d", e.started)
+	}
+}
@@ -0,0 +1,16 @@
+package panicwrap
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaeConnRefused is WSAECONNREFUSED, which Windows returns for a socket
+// that nothing listens on. syscall.ECONNREFUSED is a different number.
+const wsaeConnRefused = syscall.Errno(10061)
+
+// connRefused returns whether err is from connecting to a socket that
+// nothing listens on.
+func connRefused(err error) bool {
+	return errors.Is(err, wsaeConnRefused)
+}
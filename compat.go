@@ -0,0 +1,66 @@
+package panicwrap
+
+import (
+	"strconv"
+	"strings"
+)
+
+// formatQuirks describes the differences between Go versions in how crash
+// output is formatted, where those differences matter for parsing. The
+// corpus in testdata/crashes holds real crash output of every supported
+// version to keep this honest, and is embedded for ParseCompat.
+//
+// Differences that can be told apart from the output itself are handled
+// by the parser directly, without a quirk:
+//
+//   - Go 1.21 added " in goroutine N" to "created by" lines.
+//   - Go 1.22 added "gp=... m=..." to goroutine headers with
+//     GOTRACEBACK=system.
+//   - Go 1.25 prints a re-raised panic with the same value as a single
+//     "panic: X [recovered, repanicked]" instead of a chain.
+type formatQuirks struct {
+	// indentedValues is set if continuation lines of multi-line panic
+	// values are indented with a tab, which Go 1.23 started doing. Before
+	// that, a leading tab in a continuation line is part of the value.
+	indentedValues bool
+}
+
+// latestQuirks are the quirks of the most recent Go version, which are
+// assumed if the version is unknown.
+var latestQuirks = formatQuirks{
+	indentedValues: true,
+}
+
+// quirksFor returns the formatQuirks of the given Go version, in the form
+// of runtime.Version such as "go1.22.5".
+func quirksFor(goVersion string) formatQuirks {
+	minor, ok := goMinorVersion(goVersion)
+	if !ok {
+		return latestQuirks
+	}
+
+	return formatQuirks{
+		indentedValues: minor >= 23,
+	}
+}
+
+// goMinorVersion returns the minor version of the given Go 1 version, such
+// as 22 for "go1.22.5" or "go1.22rc1".
+func goMinorVersion(goVersion string) (int, bool) {
+	v, ok := strings.CutPrefix(goVersion, "go1.")
+	if !ok {
+		return 0, false
+	}
+
+	end := 0
+	for end < len(v) && v[end] >= '0' && v[end] <= '9' {
+		end++
+	}
+
+	minor, err := strconv.Atoi(v[:end])
+	if err != nil {
+		return 0, false
+	}
+
+	return minor, true
+}
@@ -0,0 +1,173 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// corpusCase holds what is expected from parsing a scenario of the crash
+// corpus in testdata/crashes. See gen.go in there for the scenarios.
+type corpusCase struct {
+	values []string
+	kind   CrashKind
+}
+
+var corpusCases = map[string]corpusCase{
+	"panic-string":    {[]string{"oh no"}, KindPanic},
+	"panic-error":     {[]string{"reading config: unexpected EOF"}, KindPanic},
+	"panic-multiline": {[]string{"first line\nsecond line"}, KindPanic},
+	"nil-deref":       {[]string{"runtime error: invalid memory address or nil pointer dereference"}, KindPanic},
+	"index":           {[]string{"runtime error: index out of range [5] with length 3"}, KindPanic},
+	"goroutine":       {[]string{"in goroutine"}, KindPanic},
+	"deadlock":        {[]string{"all goroutines are asleep - deadlock!"}, KindDeadlock},
+	"goexit-deadlock": {[]string{"all goroutines are asleep - deadlock!"}, KindDeadlock},
+	"repanic":         {[]string{"original", "re-raised: original"}, KindPanic},
+	"unlock-unlocked": {[]string{"sync: unlock of unlocked mutex"}, KindFatal},
+}
+
+// readCorpus returns the crash texts of the corpus by Go version and file
+// name, such as "go1.22" and "nil-deref.system".
+func readCorpus(t *testing.T) map[string]map[string]string {
+	paths, err := filepath.Glob(filepath.Join("testdata", "crashes", "go*", "*.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no crash corpus")
+	}
+
+	result := make(map[string]map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		version := filepath.Base(filepath.Dir(path))
+		if result[version] == nil {
+			result[version] = make(map[string]string)
+		}
+		result[version][strings.TrimSuffix(filepath.Base(path), ".txt")] = string(data)
+	}
+
+	return result
+}
+
+func TestCorpus_detect(t *testing.T) {
+	for version, files := range readCorpus(t) {
+		for name, text := range files {
+			result := make(chan string, 1)
+			w := new(bytes.Buffer)
+			trackPanic(strings.NewReader(text), w, time.Minute, time.Minute, realClock{}, defaultTrackSize, false, headerRules{}, nil, nil, result)
+			if actual := <-result; actual != text {
+				t.Fatalf("%s/%s: not detected, forwarded %q", version, name, w.String())
+			}
+		}
+	}
+}
+
+func TestCorpus_parse(t *testing.T) {
+	for version, files := range readCorpus(t) {
+		quirks := quirksFor(version)
+		for name, text := range files {
+			scenario, _, _ := strings.Cut(name, ".")
+			values := parseValues(text, quirks)
+			if scenario == "sigquit" {
+				if !isDump(text) || len(values) != 0 {
+					t.Fatalf("%s/%s: bad dump: %q", version, name, values)
+				}
+			} else if isDump(text) {
+				t.Fatalf("%s/%s: should not be a dump", version, name)
+			} else if c, ok := corpusCases[scenario]; ok {
+				if !reflect.DeepEqual(values, c.values) {
+					t.Fatalf("%s/%s: bad values: %q", version, name, values)
+				}
+				if kind := classify(text, values[0]); kind != c.kind {
+					t.Fatalf("%s/%s: bad kind: %s", version, name, kind)
+				}
+			} else if len(values) == 0 {
+				t.Fatalf("%s/%s: no values", version, name)
+			}
+
+			gs := parseGoroutines(text, nil)
+			if len(gs) == 0 || len(gs[0].Frames) == 0 {
+				t.Fatalf("%s/%s: no frames: %#v", version, name, gs)
+			}
+			for _, g := range gs {
+				for _, f := range g.Frames {
+					if f.Function == "" || f.File == "" || f.Line == 0 {
+						t.Fatalf("%s/%s: bad frame: %#v", version, name, f)
+					}
+				}
+			}
+
+			// The goroutine of a dump is in syscall.Kill.
+			frame := topFrame(gs)
+			if scenario != "sigquit" && (frame == nil ||
+				!strings.HasSuffix(frame.File, "/main.go") &&
+					!strings.HasSuffix(frame.File, "/sync/mutex.go")) {
+				t.Fatalf("%s/%s: bad top frame: %#v", version, name, frame)
+			}
+		}
+	}
+}
+
+func TestCorpus_repanicked(t *testing.T) {
+	// Go 1.25 stopped printing a chain when the same value is re-raised.
+	for version, files := range readCorpus(t) {
+		values := parseValues(files["repanic-same"], quirksFor(version))
+		if minor, _ := goMinorVersion(version); minor >= 25 {
+			if !reflect.DeepEqual(values, []string{"same value"}) {
+				t.Fatalf("%s: bad: %q", version, values)
+			}
+		} else if !reflect.DeepEqual(values, []string{"same value", "same value"}) {
+			t.Fatalf("%s: bad: %q", version, values)
+		}
+	}
+}
+
+func TestCorpus_fingerprint(t *testing.T) {
+	// The fingerprint must not depend on GOTRACEBACK.
+	for version, files := range readCorpus(t) {
+		for name, text := range files {
+			scenario, level, ok := strings.Cut(name, ".")
+			if !ok {
+				continue
+			}
+
+			if fingerprint(text, nil) != fingerprint(files[scenario], nil) {
+				t.Fatalf("%s/%s: fingerprint differs from GOTRACEBACK=%s", version, scenario, level)
+			}
+		}
+	}
+}
+
+func TestQuirksFor(t *testing.T) {
+	cases := map[string]formatQuirks{
+		"go1.21.13": {indentedValues: false},
+		"go1.22rc1": {indentedValues: false},
+		"go1.23":    {indentedValues: true},
+		"go1.27.1":  {indentedValues: true},
+		"devel":     latestQuirks,
+	}
+	for version, expected := range cases {
+		if actual := quirksFor(version); actual != expected {
+			t.Fatalf("%s: %#v", version, actual)
+		}
+	}
+}
+
+func TestCorpus_trimPaths(t *testing.T) {
+	for version, files := range readCorpus(t) {
+		text := files["unlock-unlocked"]
+		gs := parseGoroutines(text, newPathTrimmer(&WrapConfig{TrimPaths: true}, text))
+		if f := gs[0].Frames[0].File; f != "runtime/panic.go" {
+			t.Fatalf("%s: bad: %s", version, f)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package panicwrap
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// crashCorpus is the crash output of every supported Go version that
+// ParseCompat compares crashes with. See testdata/crashes/gen.go.
+//
+//go:embed testdata/crashes/go*/*.txt
+var crashCorpus embed.FS
+
+// CompatReport is what ParseCompat made of the output of a crash, and how
+// well it understood it.
+type CompatReport struct {
+	// Info is the crash, parsed as the parent parses it.
+	Info *PanicInfo `json:"info"`
+
+	// Variant names the format the output was recognized as, by the Go
+	// versions of the corpus that print crashes that way, such as
+	// "go1.18-go1.22" or "go1.23+". It is "unknown" if no version of the
+	// corpus prints crashes that way, and GoVersions is empty then.
+	Variant    string   `json:"variant"`
+	GoVersions []string `json:"go_versions,omitempty"`
+
+	// Traceback is the GOTRACEBACK level the output was printed with:
+	// "none", "single", "all" or "system". It is empty if it can't be
+	// told, such as for fatal errors, which print every goroutine at the
+	// "single" level as well.
+	Traceback string `json:"traceback,omitempty"`
+
+	// Confidence is between 0 and 1: the share of the lines of the output
+	// that were understood, halved if the format is unknown, and 0 if
+	// there is no crash in the output at all.
+	Confidence float64 `json:"confidence"`
+
+	// Unrecognized are the first lines that weren't understood, and
+	// Missing the fields of Info that were expected but came out empty:
+	// "value", "goroutines" or "frames".
+	Unrecognized []string `json:"unrecognized,omitempty"`
+	Missing      []string `json:"missing,omitempty"`
+}
+
+// maxUnrecognized is how many lines CompatReport.Unrecognized holds.
+const maxUnrecognized = 10
+
+// The features of crash output that tell the Go versions apart. See
+// formatQuirks.
+const (
+	featureCreatedInGoroutine = "created-in-goroutine"
+	featureCreatedPlain       = "created-plain"
+	featureHeaderGP           = "header-gp"
+	featureSystemNoGP         = "system-no-gp"
+	featureRepanicked         = "repanicked"
+	featureIndentedValue      = "indented-value"
+	featureUnindentedValue    = "unindented-value"
+)
+
+// compatLineRes match the lines of crash output, beyond the panic values,
+// that the parser understands or knows to skip.
+var compatLineRes = []*regexp.Regexp{
+	stackGoroutineRe,
+	stackFileRe,
+	stackCreatedRe,
+	regexp.MustCompile(`^[^\t ].*\)$`),
+	regexp.MustCompile(`^\[signal `),
+	regexp.MustCompile(`^\[originating from goroutine [0-9]+\]:$`),
+	regexp.MustCompile(`^runtime stack:$`),
+	regexp.MustCompile(`^runtime: `),
+	regexp.MustCompile(`^unexpected fault address `),
+	regexp.MustCompile(`^\t?\.\.\.[0-9a-z ]+\.\.\.$`),
+	regexp.MustCompile(`^(PC|SIGQUIT: quit|exit status|signal arrived during)`),
+	regexp.MustCompile(`^[a-z0-9]+ +0x[0-9a-f]+$`),
+}
+
+// The features of the crash output of each version of the corpus, which
+// corpusFeatures reads once. They aren't read when the package is
+// initialized, so that programs that don't use ParseCompat don't link in
+// the corpus.
+var (
+	corpusOnce     sync.Once
+	corpusFeatured map[string]map[string]bool
+)
+
+// corpusFeatures returns the features of the crash output of each version
+// of the corpus.
+func corpusFeatures() map[string]map[string]bool {
+	corpusOnce.Do(func() { corpusFeatured = readCorpusFeatures() })
+	return corpusFeatured
+}
+
+// readCorpusFeatures reads the features of the corpus.
+func readCorpusFeatures() map[string]map[string]bool {
+	result := make(map[string]map[string]bool)
+	paths, _ := fs.Glob(crashCorpus, "testdata/crashes/go*/*.txt")
+	for _, p := range paths {
+		data, err := crashCorpus.ReadFile(p)
+		if err != nil {
+			continue
+		}
+
+		version := path.Base(path.Dir(p))
+		if result[version] == nil {
+			result[version] = make(map[string]bool)
+		}
+		for f := range scanCompat(string(data)).features {
+			result[version][f] = true
+		}
+	}
+	return result
+}
+
+// compatScan is what scanCompat found in crash output.
+type compatScan struct {
+	features     map[string]bool
+	lines        int
+	recognized   int
+	unrecognized []string
+	header       bool
+	fatal        bool
+	goroutines   int
+	system       bool
+}
+
+// scanCompat goes through the lines of crash output for its features and
+// the lines that aren't understood.
+func scanCompat(text string) *compatScan {
+	s := &compatScan{features: make(map[string]bool)}
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	// inValue is set while in the lines of the panic values, which end at
+	// a blank line or at the stacks. valueIndent is the indentation of
+	// the panic line whose value continues.
+	inValue, valueIndent := false, ""
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		s.lines++
+		if line == "" {
+			s.recognized++
+			inValue = false
+			continue
+		}
+
+		trimmed := strings.TrimLeft(line, "\t")
+		switch {
+		case strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: "):
+			s.header = true
+			s.fatal = s.fatal || strings.HasPrefix(line, "fatal error: ")
+			inValue, valueIndent = true, ""
+			if strings.HasSuffix(line, "[recovered, repanicked]") {
+				s.features[featureRepanicked] = true
+			}
+		case inValue && strings.HasPrefix(trimmed, "panic: "):
+			inValue, valueIndent = true, line[:len(line)-len(trimmed)]
+		case inValue && (strings.HasPrefix(line, "[signal ") || stackGoroutineRe.MatchString(line)):
+			inValue = false
+		case inValue:
+			// A continuation line of a multi-line value.
+			if strings.HasPrefix(line, valueIndent+"\t") {
+				s.features[featureIndentedValue] = true
+			} else {
+				s.features[featureUnindentedValue] = true
+			}
+		}
+		if inValue {
+			s.recognized++
+			continue
+		}
+
+		if m := stackGoroutineRe.FindStringSubmatch(line); m != nil {
+			s.goroutines++
+			if strings.Contains(line, " gp=") {
+				s.features[featureHeaderGP] = true
+			}
+		}
+		if strings.HasPrefix(line, "created by ") {
+			if strings.Contains(line, " in goroutine ") {
+				s.features[featureCreatedInGoroutine] = true
+			} else {
+				s.features[featureCreatedPlain] = true
+			}
+		}
+		if strings.HasPrefix(line, "\t") && strings.Contains(line, " fp=") {
+			s.system = true
+		}
+
+		if slices.ContainsFunc(compatLineRes, func(re *regexp.Regexp) bool { return re.MatchString(line) }) {
+			s.recognized++
+		} else if len(s.unrecognized) < maxUnrecognized {
+			s.unrecognized = append(s.unrecognized, line)
+		}
+	}
+	if s.system && !s.features[featureHeaderGP] {
+		s.features[featureSystemNoGP] = true
+	}
+
+	return s
+}
+
+// ParseCompat parses the output of a crash like the parent does, and
+// reports which format it recognized it as, by comparing it with a corpus
+// of crash output of the Go versions panicwrap supports at the GOTRACEBACK
+// levels, and how much of it it understood. A crash that was only partly
+// understood has a low Confidence, and the lines and fields that weren't
+// are listed, rather than coming out as empty fields.
+func ParseCompat(text string) *CompatReport {
+	s := scanCompat(text)
+	versions := corpusFeatures()
+
+	r := &CompatReport{Variant: "unknown"}
+	for v, features := range versions {
+		compatible := true
+		for f := range s.features {
+			if !features[f] {
+				compatible = false
+				break
+			}
+		}
+		if compatible {
+			r.GoVersions = append(r.GoVersions, v)
+		}
+	}
+	slices.SortFunc(r.GoVersions, compareGoVersions)
+	if len(r.GoVersions) > 0 {
+		all := make([]string, 0, len(versions))
+		for v := range versions {
+			all = append(all, v)
+		}
+		r.Variant = versionRange(r.GoVersions, slices.MaxFunc(all, compareGoVersions))
+	}
+
+	quirks := latestQuirks
+	if len(r.GoVersions) > 0 {
+		quirks = quirksFor(r.GoVersions[0])
+	}
+	r.Info = detectedCrash(text, quirks)
+
+	switch {
+	case s.system:
+		r.Traceback = "system"
+	case s.header && s.goroutines == 0:
+		r.Traceback = "none"
+	case s.fatal || isDump(text):
+	case s.goroutines > 1:
+		r.Traceback = "all"
+	case s.goroutines == 1:
+		r.Traceback = "single"
+	}
+
+	if s.header && len(r.Info.Values) == 0 {
+		r.Missing = append(r.Missing, "value")
+	}
+	if r.Traceback != "none" && len(r.Info.Goroutines) == 0 {
+		r.Missing = append(r.Missing, "goroutines")
+	}
+	for _, g := range r.Info.Goroutines {
+		if slices.ContainsFunc(g.Frames, func(f Frame) bool { return f.File == "" || f.Line == 0 }) {
+			r.Missing = append(r.Missing, "frames")
+			break
+		}
+	}
+
+	r.Unrecognized = s.unrecognized
+	if (s.header || isDump(text)) && s.lines > 0 {
+		r.Confidence = float64(s.recognized) / float64(s.lines)
+		if len(r.GoVersions) == 0 {
+			r.Confidence /= 2
+		}
+	}
+
+	return r
+}
+
+// compareGoVersions orders Go versions such as "go1.9" and "go1.21".
+func compareGoVersions(a, b string) int {
+	ma, _ := goMinorVersion(a)
+	mb, _ := goMinorVersion(b)
+	return ma - mb
+}
+
+// versionRange names the sorted versions, which run up to the latest
+// version of the corpus, as a range.
+func versionRange(versions []string, latest string) string {
+	first, last := versions[0], versions[len(versions)-1]
+	switch {
+	case last == latest:
+		return first + "+"
+	case first == last:
+		return first
+	default:
+		return first + "-" + last
+	}
+}
@@ -0,0 +1,97 @@
+package panicwrap
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCompat_corpus(t *testing.T) {
+	for version, files := range readCorpus(t) {
+		for name, text := range files {
+			r := ParseCompat(text)
+			if r.Confidence != 1 || len(r.Unrecognized) > 0 || len(r.Missing) > 0 {
+				t.Fatalf("%s/%s: %#v", version, name, r)
+			}
+			if !slices.Contains(r.GoVersions, version) {
+				t.Fatalf("%s/%s: bad versions: %s", version, name, r.GoVersions)
+			}
+
+			_, level, _ := strings.Cut(name, ".")
+			if level == "system" && r.Traceback != "system" {
+				t.Fatalf("%s/%s: bad traceback: %q", version, name, r.Traceback)
+			}
+		}
+	}
+}
+
+func TestParseCompat_variants(t *testing.T) {
+	files := readCorpus(t)
+	cases := []struct {
+		text      string
+		variant   string
+		traceback string
+	}{
+		{files["go1.21"]["panic-multiline"], "go1.18-go1.22", "single"},
+		{files["go1.20"]["goroutine"], "go1.18-go1.20", "single"},
+		{files["go1.23"]["panic-multiline"], "go1.23+", "single"},
+		{files["go1.25"]["repanic-same"], "go1.25+", "single"},
+		{files["go1.21"]["nil-deref.system"], "go1.21", "system"},
+		{files["go1.23"]["goroutine.all"], "go1.21+", "all"},
+		{files["go1.23"]["deadlock"], "go1.21+", ""},
+		{"panic: boom\n", "go1.18+", "none"},
+	}
+	for _, c := range cases {
+		r := ParseCompat(c.text)
+		if r.Variant != c.variant || r.Traceback != c.traceback {
+			t.Fatalf("%q: bad: %s %q", c.text, r.Variant, r.Traceback)
+		}
+	}
+}
+
+func TestParseCompat_partial(t *testing.T) {
+	// Go 1.20 and earlier didn't say which goroutine created another, and
+	// only Go 1.25 and later print repanicked values on one line.
+	text := "panic: boom [recovered, repanicked]\n\ngoroutine 6 [running]:\nmain.work()\n\t/app/main.go:12 +0x1d\ncreated by main.main\n\t/app/main.go:5 +0x25\n"
+	r := ParseCompat(text)
+	if r.Variant != "unknown" || len(r.GoVersions) != 0 || r.Confidence != 0.5 {
+		t.Fatalf("bad: %#v", r)
+	}
+	if r.Info.Value != "boom" {
+		t.Fatalf("bad: %#v", r.Info)
+	}
+
+	// Output mangled on the way.
+	text = "panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n##garbled##\n"
+	r = ParseCompat(text)
+	if r.Confidence >= 1 || r.Confidence <= 0 {
+		t.Fatalf("bad: %v", r.Confidence)
+	}
+	if !reflect.DeepEqual(r.Unrecognized, []string{"##garbled##"}) || !reflect.DeepEqual(r.Missing, []string{"frames"}) {
+		t.Fatalf("bad: %q %q", r.Unrecognized, r.Missing)
+	}
+}
+
+func TestParseCompat_notCrash(t *testing.T) {
+	r := ParseCompat("starting\nlistening on :8080\n")
+	if r.Confidence != 0 || len(r.Unrecognized) != 2 {
+		t.Fatalf("bad: %#v", r)
+	}
+}
+
+func TestVersionRange(t *testing.T) {
+	cases := []struct {
+		versions []string
+		expected string
+	}{
+		{[]string{"go1.21"}, "go1.21"},
+		{[]string{"go1.21", "go1.22"}, "go1.21-go1.22"},
+		{[]string{"go1.23", "go1.24", "go1.27"}, "go1.23+"},
+	}
+	for _, c := range cases {
+		if actual := versionRange(c.versions, "go1.27"); actual != c.expected {
+			t.Fatalf("%q: bad: %s", c.versions, actual)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package panicwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LoadConfig reads a WrapConfig from the JSON file at path, so that
+// operators can change how a program is wrapped without rebuilding it.
+// The keys are the names of the fields in snake_case, durations are
+// strings such as "500ms", and nested configurations are objects:
+//
+//	{
+//		"detect_duration": "500ms",
+//		"restart": {"max_restarts": 5, "backoff": "1s"},
+//		"log": {"path": "${LOG_DIR}/app.log"},
+//		"workers": $WORKERS
+//	}
+//
+// Only the fields that can be written as JSON are read: the handlers,
+// writers, sinks, signals and other Go values are left for the program to
+// set. $NAME and ${NAME} are replaced with the environment variables of
+// that name, escaped inside strings, and it is an error if one isn't set;
+// $$ stands for a single $.
+//
+// The configuration is validated, except that it needn't have a handler.
+// Errors name the line of the file they are about, such as
+// "app.json:3: DetectDuration must not be negative, got -1s".
+//
+// The panicwrapconfig module reads YAML and TOML files as well.
+func LoadConfig(path string) (*WrapConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseConfig(path, data)
+}
+
+// ParseConfig is LoadConfig for JSON that was already read from the file
+// at path, which only names it in errors.
+func ParseConfig(path string, data []byte) (*WrapConfig, error) {
+	l := &configLoader{path: path, lines: make(map[string]int)}
+	data, err := l.expand(data)
+	if err != nil {
+		return nil, err
+	}
+	l.data = data
+
+	c := new(WrapConfig)
+	if err := l.decode(0, data, reflect.ValueOf(c).Elem()); err != nil {
+		return nil, err
+	}
+
+	// The handlers are set by the program, so one isn't required here.
+	v := *c
+	if v.PanicWriter == nil {
+		v.PanicWriter = io.Discard
+	}
+	if err := v.Validate(); err != nil {
+		return nil, l.validationError(err)
+	}
+
+	return c, nil
+}
+
+// configLoader decodes a configuration file for LoadConfig.
+type configLoader struct {
+	path string
+	data []byte
+
+	// lines has the line of every field that was set in the file, by
+	// its name in Go, such as "DetectDuration".
+	lines map[string]int
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	regexpType   = reflect.TypeOf((*regexp.Regexp)(nil))
+)
+
+// errf returns an error about the given offset of the file.
+func (l *configLoader) errf(offset int64, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", l.path, l.line(offset), fmt.Sprintf(format, args...))
+}
+
+func (l *configLoader) line(offset int64) int {
+	if offset > int64(len(l.data)) {
+		offset = int64(len(l.data))
+	}
+	return bytes.Count(l.data[:offset], []byte("\n")) + 1
+}
+
+// expand replaces the environment variables in the file. See LoadConfig.
+func (l *configLoader) expand(data []byte) ([]byte, error) {
+	l.data = data
+	var out bytes.Buffer
+	var err error
+	expand := func(s string, offset int, quoted bool) {
+		out.WriteString(os.Expand(s, func(name string) string {
+			if name == "$" {
+				return "$"
+			}
+			v, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = l.errf(int64(offset), "$%s is not set", name)
+			}
+			if quoted {
+				b, _ := json.Marshal(v)
+				return string(b[1 : len(b)-1])
+			}
+			return v
+		}))
+	}
+
+	start, inString := 0, false
+	for i := 0; i < len(data); i++ {
+		switch {
+		case inString && data[i] == '\\':
+			i++
+		case data[i] == '"':
+			expand(string(data[start:i]), start, inString)
+			out.WriteByte('"')
+			start, inString = i+1, !inString
+		}
+	}
+	expand(string(data[start:]), start, inString)
+
+	return out.Bytes(), err
+}
+
+// decode decodes the JSON object in data, which starts at the given offset
+// of the file, into the struct v.
+func (l *configLoader) decode(base int64, data []byte, v reflect.Value) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return l.syntaxError(base, dec, err)
+	} else if tok != json.Delim('{') {
+		return l.errf(base+dec.InputOffset(), "expected an object")
+	}
+
+	fields := configFields(v.Type())
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return l.syntaxError(base, dec, err)
+		}
+		key := tok.(string)
+		offset := base + dec.InputOffset()
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return l.syntaxError(base, dec, err)
+		}
+		// The value starts after the colon and any space before it.
+		rawOffset := base + dec.InputOffset() - int64(len(raw))
+
+		i, ok := fields[key]
+		if !ok {
+			return l.errf(offset, "unknown setting %q", key)
+		}
+		f := v.Type().Field(i)
+		l.lines[f.Name] = l.line(offset)
+		if err := l.decodeValue(rawOffset, key, raw, v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return l.syntaxError(base, dec, err)
+	}
+	return nil
+}
+
+// decodeValue decodes a JSON value into the field of the given key.
+func (l *configLoader) decodeValue(offset int64, key string, raw json.RawMessage, v reflect.Value) error {
+	switch t := v.Type(); {
+	case t == durationType:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return l.errf(offset, "%s must be a duration such as \"1s\"", key)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return l.errf(offset, "invalid %s: %s", key, err)
+		}
+		v.SetInt(int64(d))
+	case t == regexpType:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return l.errf(offset, "%s must be a regular expression", key)
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return l.errf(offset, "invalid %s: %s", key, err)
+		}
+		v.Set(reflect.ValueOf(re))
+	case t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct:
+		if string(raw) == "null" {
+			return nil
+		}
+		v.Set(reflect.New(t.Elem()))
+		return l.decodeValue(offset, key, raw, v.Elem())
+	case t.Kind() == reflect.Struct:
+		return l.decode(offset, raw, v)
+	case t.Kind() == reflect.Slice && (t.Elem().Kind() == reflect.Struct || t.Elem() == regexpType):
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			if t.Elem() == regexpType {
+				return l.errf(offset, "%s must be a list of regular expressions", key)
+			}
+			return l.errf(offset, "%s must be a list of objects", key)
+		}
+		s := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			// The offsets of the items aren't known, so errors are about
+			// the line of the list.
+			if err := l.decodeValue(offset, key, item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	default:
+		if err := json.Unmarshal(raw, v.Addr().Interface()); err != nil {
+			return l.errf(offset, "invalid %s: %s", key, typeErrorText(err))
+		}
+	}
+
+	return nil
+}
+
+// syntaxError returns the error of the decoder at the given offset of the
+// file.
+func (l *configLoader) syntaxError(base int64, dec *json.Decoder, err error) error {
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		// The offset is that of the byte after the one in error, unless
+		// the file ended.
+		offset := base + se.Offset
+		if offset < int64(len(l.data)) {
+			offset--
+		}
+		return l.errf(offset, "%s", se)
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return l.errf(int64(len(l.data)), "unexpected end of JSON input")
+	}
+	return l.errf(base+dec.InputOffset(), "%s", err)
+}
+
+// validationError adds the line of the field that err is about to it,
+// which is the first field named in the message that was set in the file.
+func (l *configLoader) validationError(err error) error {
+	msg := err.Error()
+	words := strings.FieldsFunc(msg, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if line, ok := l.lines[w]; ok {
+			return fmt.Errorf("%s:%d: %s", l.path, line, msg)
+		}
+	}
+	return fmt.Errorf("%s: %s", l.path, msg)
+}
+
+// typeErrorText describes a JSON type error without the Go types.
+func typeErrorText(err error) string {
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		return fmt.Sprintf("got a %s, want a %s", te.Value, jsonKind(te.Type))
+	}
+	return err.Error()
+}
+
+// jsonKind names the kind of JSON value that decodes into t.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "number"
+}
+
+// configFields returns the fields of the struct type t that can be set in
+// a configuration file, by key.
+func configFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.IsExported() && configurable(f.Type) {
+			fields[snakeCase(f.Name)] = i
+		}
+	}
+	return fields
+}
+
+// configurable returns whether values of type t can be written as JSON in
+// a configuration file. Named numeric types other than durations are left
+// out, as their numbers would be meaningless to operators.
+func configurable(t reflect.Type) bool {
+	switch {
+	case t == durationType || t == regexpType:
+		return true
+	case t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct:
+		return configurable(t.Elem())
+	case t.Kind() == reflect.Slice && t.Name() == "":
+		return configurable(t.Elem())
+	case t.Kind() == reflect.Struct:
+		return t.PkgPath() == reflect.TypeOf(WrapConfig{}).PkgPath() && len(configFields(t)) > 0
+	case t.Kind() == reflect.Map:
+		return t.Key().Kind() == reflect.String && configurable(t.Elem())
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return true
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint32, reflect.Uint64, reflect.Float64:
+		return t.PkgPath() == ""
+	}
+	return false
+}
+
+// snakeCase converts a field name to snake_case, keeping acronyms
+// together: ExecutableSHA256 becomes executable_sha256 and JSONLines
+// json_lines.
+func snakeCase(name string) string {
+	var b strings.Builder
+	r := []rune(name)
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) && (unicode.IsLower(r[i-1]) || i+1 < len(r) && unicode.IsLower(r[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "app.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("LOG_DIR", `/var/log/"app"`)
+	t.Setenv("WORKERS", "3")
+
+	path := writeConfig(t, `{
+	"detect_duration": "500ms",
+	"hide_panic": true,
+	"workers": $WORKERS,
+	"capture_env": ["HOME", "PRICE_$$"],
+	"executable_sha256": "`+strings.Repeat("ab", 32)+`",
+	"json_lines": true,
+	"restart": {"max_restarts": 5, "backoff": "1s", "exit_statuses": [2]},
+	"log": {"path": "${LOG_DIR}/app.log", "max_files": 3},
+	"scrub_patterns": [{"name": "ticket", "pattern": "T-[0-9]+"}],
+	"severities": {"deadlock": "critical", "oom": "warning"},
+	"ignore_patterns": ["panic: recovered", "^echo "],
+	"handler_commands": [{"args": ["notify.sh", "--team", "ops"], "timeout": "5s", "required": true}]
+}`)
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.DetectDuration != 500*time.Millisecond || !c.HidePanic || c.Workers != 3 || c.ExecutableSHA256 != strings.Repeat("ab", 32) || !c.JSONLines {
+		t.Fatalf("bad: %#v", c)
+	}
+	if !reflect.DeepEqual(c.CaptureEnv, []string{"HOME", "PRICE_$"}) {
+		t.Fatalf("bad: %#v", c.CaptureEnv)
+	}
+	if !reflect.DeepEqual(c.Restart, &RestartPolicy{MaxRestarts: 5, Backoff: time.Second, ExitStatuses: []int{2}}) {
+		t.Fatalf("bad: %#v", c.Restart)
+	}
+	if c.Log.Path != `/var/log/"app"/app.log` || c.Log.MaxFiles != 3 {
+		t.Fatalf("bad: %#v", c.Log)
+	}
+	if !reflect.DeepEqual(c.HandlerCommands, []HandlerCommand{{Args: []string{"notify.sh", "--team", "ops"}, Timeout: 5 * time.Second, Required: true}}) {
+		t.Fatalf("bad: %#v", c.HandlerCommands)
+	}
+	if !reflect.DeepEqual(c.Severities, map[CrashKind]Severity{KindDeadlock: SeverityCritical, KindOutOfMemory: SeverityWarning}) {
+		t.Fatalf("bad: %#v", c.Severities)
+	}
+	if len(c.IgnorePatterns) != 2 || c.IgnorePatterns[1].String() != "^echo " {
+		t.Fatalf("bad: %#v", c.IgnorePatterns)
+	}
+	if len(c.ScrubPatterns) != 1 || c.ScrubPatterns[0].Name != "ticket" || !c.ScrubPatterns[0].Pattern.MatchString("T-42") {
+		t.Fatalf("bad: %#v", c.ScrubPatterns)
+	}
+}
+
+func TestLoadConfig_errors(t *testing.T) {
+	t.Setenv("NEGATIVE", "-1s")
+	os.Unsetenv("PANICWRAP_UNSET")
+
+	cases := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"syntax", "{\n\t\"hide_panic\": true,\n\t\"debug\": tru\n}", "app.json:3: "},
+		{"unknown", "{\n\t\"handler\": \"x\"\n}", `app.json:2: unknown setting "handler"`},
+		{"type", "{\n\n\t\"workers\": \"two\"\n}", "app.json:3: invalid workers: got a string, want a number"},
+		{"duration", "{\n\t\"restart\": {\n\t\t\"backoff\": \"soon\"\n\t}\n}", `app.json:3: invalid backoff: time: invalid duration "soon"`},
+		{"regexp list", "{\n\t\"ignore_patterns\": [\"(\"]\n}", "app.json:2: invalid ignore_patterns: error parsing regexp"},
+		{"unset", "{\n\t\"core_dir\": \"$PANICWRAP_UNSET\"\n}", "app.json:2: $PANICWRAP_UNSET is not set"},
+		{"truncated", "{\n\t\"debug\": true,\n", "app.json:3: unexpected end of JSON input"},
+		{"validation", "{\n\t\"handler_limit_window\": \"1s\",\n\t\"handler_limit\": 1,\n\t\"hide_panic\": true\n}", "app.json:4: HidePanic can't be combined with HandlerLimit"},
+		{"validation nested", "{\n\t\"debug\": true,\n\t\"dedup_window\": \"$NEGATIVE\"\n}", "app.json:3: DedupWindow must not be negative"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tc.data))
+			if err == nil {
+				t.Fatal("should fail")
+			}
+			if msg := filepath.Base(err.Error()); !strings.HasPrefix(msg, tc.expected) {
+				t.Fatalf("bad: %s", err)
+			}
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig("app.yaml", []byte("{\n\t\"workers\": 2\n}"))
+	if err != nil || c.Workers != 2 {
+		t.Fatalf("bad: %#v, %v", c, err)
+	}
+
+	if _, err := ParseConfig("app.yaml", []byte("{\n\t\"workers\": \"two\"\n}")); err == nil || !strings.HasPrefix(err.Error(), "app.yaml:2: ") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"DetectDuration":   "detect_duration",
+		"ExecutableSHA256": "executable_sha256",
+		"JSONLines":        "json_lines",
+		"PIDFile":          "pid_file",
+		"CPUMax":           "cpu_max",
+		"UID":              "uid",
+	}
+	for name, expected := range cases {
+		if got := snakeCase(name); got != expected {
+			t.Errorf("%s: got %s, want %s", name, got, expected)
+		}
+	}
+}
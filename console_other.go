@@ -0,0 +1,16 @@
+//go:build !windows
+
+package panicwrap
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setConsoleGroup(*exec.Cmd) {}
+
+func setHideConsole(*exec.Cmd) {}
+
+func signalProcess(p *os.Process, s os.Signal) error {
+	return p.Signal(s)
+}
@@ -0,0 +1,16 @@
+package panicwrap
+
+import (
+	"testing"
+)
+
+func TestWrap_consoleGroupHideConsole(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:      func(string) {},
+		ConsoleGroup: true,
+		HideConsole:  true,
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
@@ -0,0 +1,49 @@
+package panicwrap
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var procGenerateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// setConsoleGroup starts the command in a process group of its own, which
+// console control events can be sent to. See WrapConfig.ConsoleGroup.
+func setConsoleGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// signalProcess sends the signal to the process. Windows has no signals
+// other than killing, so os.Interrupt and SIGTERM are sent as a
+// CTRL_BREAK_EVENT, which the Go runtime of the child turns back into
+// os.Interrupt. This only reaches children in a process group of their
+// own.
+func signalProcess(p *os.Process, s os.Signal) error {
+	if s != os.Interrupt && s != syscall.SIGTERM {
+		return p.Signal(s)
+	}
+
+	r, _, err := procGenerateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(p.Pid))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// createNoWindow is the CREATE_NO_WINDOW process creation flag.
+const createNoWindow = 0x08000000
+
+// setHideConsole starts the command without a console window. See
+// WrapConfig.HideConsole.
+func setHideConsole(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.CreationFlags |= createNoWindow
+	cmd.SysProcAttr.HideWindow = true
+}
@@ -0,0 +1,29 @@
+package panicwrap
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestWrap_consoleFlags(t *testing.T) {
+	cases := []struct {
+		config *WrapConfig
+		flags  uint32
+	}{
+		{&WrapConfig{ConsoleGroup: true}, syscall.CREATE_NEW_PROCESS_GROUP},
+		{&WrapConfig{HideConsole: true}, createNoWindow},
+	}
+
+	for _, tc := range cases {
+		e := &fakeExecutor{}
+		tc.config.Handler = func(string) {}
+		tc.config.Executor = e
+		if _, _, err := Wrap(tc.config); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if e.cmd.SysProcAttr == nil || e.cmd.SysProcAttr.CreationFlags != tc.flags {
+			t.Fatalf("bad: %#v", e.cmd.SysProcAttr)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package panicwrap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The parent contains its own failures, such as a writer that fails or
+// panics, so that they don't cost the outcome of the child. What is kept
+// in the face of them, in order:
+//
+//  1. The exit status of the child is always returned by Wrap, even if
+//     forwarding its output failed.
+//  2. The output of the child is forwarded as long as the writers accept
+//     it. If detecting panics fails, the rest of stderr is forwarded as
+//     is, so that the child never blocks on a full pipe.
+//  3. The handlers are called for every detected panic, with whatever of
+//     the PanicInfo could be filled in.
+//
+// Each failure is passed to WrapConfig.InternalErrorHandler.
+
+// InternalError is a failure of the parent itself that it recovered from.
+// See WrapConfig.InternalErrorHandler.
+type InternalError struct {
+	// Op is what the parent was doing, such as "forwarding stdout".
+	Op string
+
+	// Err is the error, or the panic the parent recovered from.
+	Err error
+}
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("panicwrap: %s: %s", e.Op, e.Err)
+}
+
+func (e *InternalError) Unwrap() error {
+	return e.Err
+}
+
+// reportInternal passes a failure of the parent to the handler of the
+// configuration, or prints it to stderr if there is none.
+func reportInternal(c *WrapConfig, op string, err error) {
+	e := &InternalError{Op: op, Err: err}
+	if c.InternalErrorHandler == nil {
+		fmt.Fprintln(os.Stderr, e)
+		return
+	}
+
+	defer func() { recover() }()
+	c.InternalErrorHandler(e)
+}
+
+// bestEffort runs a step of the parent that may fail without affecting
+// the rest, and reports it if it panics.
+func bestEffort(c *WrapConfig, op string, f func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			reportInternal(c, op, fmt.Errorf("panic: %v", v))
+		}
+	}()
+
+	f()
+}
+
+// trackPanicContained is trackPanic, except that if it fails, no panic is
+// detected and the rest of the output is forwarded as is, or dropped if
+// the writer is what failed.
+func trackPanicContained(c *WrapConfig, r io.Reader, w io.Writer, dur, hold time.Duration, clock Clock, size int, stream bool, rules headerRules, bypass *atomic.Bool, budget *memoryBudget, result chan<- string) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		reportInternal(c, "detecting panics", fmt.Errorf("panic: %v", v))
+
+		defer func() {
+			if recover() != nil {
+				io.Copy(io.Discard, r)
+			}
+		}()
+		io.Copy(w, r)
+	}()
+
+	trackPanic(r, w, dur, hold, clock, size, stream, rules, bypass, budget, result)
+}
+
+// reportingWriter reports the first error of the writer, which is still
+// returned as usual.
+type reportingWriter struct {
+	w      io.Writer
+	report func(error)
+	once   sync.Once
+}
+
+func (r *reportingWriter) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	if err != nil {
+		r.once.Do(func() { r.report(err) })
+	}
+
+	return n, err
+}
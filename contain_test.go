@@ -0,0 +1,99 @@
+package panicwrap
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type panicWriter struct{}
+
+func (panicWriter) Write(p []byte) (int, error) { panic("writer") }
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errors.New("broken") }
+
+func TestTrackPanicContained(t *testing.T) {
+	var reported error
+	c := &WrapConfig{InternalErrorHandler: func(err error) { reported = err }}
+
+	r, w := io.Pipe()
+	result := make(chan string)
+	go trackPanicContained(c, r, panicWriter{}, time.Second, 0, realClock{}, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	// The output is still consumed after the writer failed.
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write([]byte("output\n")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	w.Close()
+
+	if txt := <-result; txt != "" {
+		t.Fatalf("bad: %#v", txt)
+	}
+	var e *InternalError
+	if !errors.As(reported, &e) || e.Op != "detecting panics" {
+		t.Fatalf("bad: %#v", reported)
+	}
+}
+
+func TestHandlePanic_contained(t *testing.T) {
+	var ops []string
+	var handled string
+	c := &WrapConfig{
+		Handler:     func(s string) { handled = s },
+		PanicWriter: panicWriter{},
+		Writer:      io.Discard,
+		InternalErrorHandler: func(err error) {
+			ops = append(ops, err.(*InternalError).Op)
+		},
+	}
+	setDefaults(c)
+
+	err := handlePanic(c, newCrashTracker(c.DedupWindow), &PanicInfo{Text: "panic: boom\n"}, false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if handled != "panic: boom\n" {
+		t.Fatalf("should still call the handler: %#v", handled)
+	}
+	if len(ops) != 1 || ops[0] != "writing to PanicWriter" {
+		t.Fatalf("bad: %#v", ops)
+	}
+}
+
+func TestExecProcess_outputFails(t *testing.T) {
+	cmd := helperProcess("no-panic-output")
+	cmd.Stdout = failWriter{}
+	cmd.Stderr = io.Discard
+
+	p, err := execExecutor{}.Start(cmd)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The exit status wins over the failure to copy the output.
+	exit, err := p.Wait()
+	if err != nil || exit.Status != 0 {
+		t.Fatalf("bad: %#v %v", exit, err)
+	}
+}
+
+func TestReportingWriter(t *testing.T) {
+	var reports []string
+	w := &reportingWriter{w: failWriter{}, report: func(err error) {
+		reports = append(reports, err.Error())
+	}}
+
+	w.Write([]byte("a"))
+	if _, err := w.Write([]byte("b")); err == nil {
+		t.Fatal("should return the error")
+	}
+	if strings.Join(reports, ",") != "broken" {
+		t.Fatalf("should report once: %#v", reports)
+	}
+}
@@ -0,0 +1,62 @@
+package panicwrap
+
+import (
+	"runtime"
+	"time"
+)
+
+// contractPoll is how often the parent checks whether the processes of
+// the contract of a child exited. See WrapConfig.Contract.
+const contractPoll = time.Second
+
+// startInContract starts the child in a process contract of its own, and
+// returns the ID of the contract, or 0 if it can't be told. Templates are
+// active for the thread that activated them, so it is the one that
+// starts the child.
+func startInContract(c *WrapConfig, start func() (Process, error)) (Process, int, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	tmpl, err := activateContract()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tmpl.clear()
+
+	proc, err := start()
+	if err != nil {
+		return nil, 0, err
+	}
+	id, err := latestContract()
+	if err != nil {
+		reportInternal(c, "reading the contract of the child", err)
+	}
+	return proc, id, nil
+}
+
+// waitContract waits until the processes left in the contract of a child
+// that exited exited as well, such as those it daemonized, and abandons
+// the contract then. Those left once the worker stops are killed.
+func waitContract(c *WrapConfig, ch *child, id int) {
+	defer func() {
+		if err := abandonContract(id); err != nil {
+			reportInternal(c, "abandoning the contract of the child", err)
+		}
+	}()
+
+	for {
+		pids, err := contractMembers(id)
+		if err != nil {
+			reportInternal(c, "reading the contract of the child", err)
+			return
+		}
+		if len(pids) == 0 {
+			return
+		}
+		if ch.stopping() {
+			killContract(pids)
+		}
+		debugf(c, "waiting for %d processes in contract %d", len(pids), id)
+		<-c.Clock.After(contractPoll)
+	}
+}
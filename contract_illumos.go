@@ -0,0 +1,164 @@
+//go:build illumos && cgo
+
+package panicwrap
+
+/*
+#cgo LDFLAGS: -lcontract
+#include <errno.h>
+#include <fcntl.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+#include <libcontract.h>
+#include <sys/contract/process.h>
+#include <sys/ctfs.h>
+
+// panicwrap_activate opens the process contract template and activates it
+// for the calling thread, returning the template or -errno. No events are
+// queued for the contract.
+static int panicwrap_activate(void) {
+	int fd = open(CTFS_ROOT "/process/template", O_RDWR);
+	if (fd == -1)
+		return -errno;
+	int err;
+	if ((err = ct_tmpl_set_critical(fd, 0)) != 0 ||
+	    (err = ct_tmpl_set_informative(fd, 0)) != 0 ||
+	    (err = ct_tmpl_activate(fd)) != 0) {
+		close(fd);
+		return -err;
+	}
+	return fd;
+}
+
+static void panicwrap_clear(int fd) {
+	ct_tmpl_clear(fd);
+	close(fd);
+}
+
+// panicwrap_latest returns the ID of the contract the calling thread
+// created last, or -errno.
+static int panicwrap_latest(void) {
+	int fd = open(CTFS_ROOT "/process/latest", O_RDONLY);
+	if (fd == -1)
+		return -errno;
+	ct_stathdl_t st;
+	int err = ct_status_read(fd, CTD_COMMON, &st);
+	close(fd);
+	if (err != 0)
+		return -err;
+	int id = (int)ct_status_get_id(st);
+	ct_status_free(st);
+	return id;
+}
+
+// panicwrap_members copies up to max of the processes in the contract to
+// pids, and returns how many there are, or -errno.
+static int panicwrap_members(int id, pid_t *pids, int max) {
+	char path[PATH_MAX];
+	snprintf(path, sizeof (path), CTFS_ROOT "/process/%d/status", id);
+	int fd = open(path, O_RDONLY);
+	if (fd == -1)
+		return -errno;
+	ct_stathdl_t st;
+	int err = ct_status_read(fd, CTD_ALL, &st);
+	close(fd);
+	if (err != 0)
+		return -err;
+	pid_t *members;
+	uint_t n;
+	if ((err = ct_pr_status_get_members(st, &members, &n)) != 0) {
+		ct_status_free(st);
+		return -err;
+	}
+	memcpy(pids, members, (n < max ? n : max) * sizeof (pid_t));
+	ct_status_free(st);
+	return (int)n;
+}
+
+static int panicwrap_abandon(int id) {
+	char path[PATH_MAX];
+	snprintf(path, sizeof (path), CTFS_ROOT "/process/%d/ctl", id);
+	int fd = open(path, O_WRONLY);
+	if (fd == -1)
+		return errno;
+	int err = ct_ctl_abandon(fd);
+	close(fd);
+	return err;
+}
+*/
+import "C"
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// contractSupported is whether WrapConfig.Contract can be used.
+const contractSupported = true
+
+// contractTemplate is an activated process contract template.
+type contractTemplate struct {
+	fd C.int
+}
+
+// activateContract activates a process contract template for the calling
+// thread, so that the processes it starts are in a new contract.
+func activateContract() (*contractTemplate, error) {
+	fd := C.panicwrap_activate()
+	if fd < 0 {
+		return nil, syscall.Errno(-fd)
+	}
+	return &contractTemplate{fd: fd}, nil
+}
+
+// clear deactivates the template.
+func (t *contractTemplate) clear() {
+	C.panicwrap_clear(t.fd)
+}
+
+// latestContract returns the ID of the contract the calling thread
+// created last.
+func latestContract() (int, error) {
+	id := C.panicwrap_latest()
+	if id < 0 {
+		return 0, syscall.Errno(-id)
+	}
+	return int(id), nil
+}
+
+// contractMembers returns the process IDs of the processes in the
+// contract.
+func contractMembers(id int) ([]int, error) {
+	buf := make([]C.pid_t, 64)
+	for {
+		n := C.panicwrap_members(C.int(id), (*C.pid_t)(unsafe.Pointer(&buf[0])), C.int(len(buf)))
+		if n < 0 {
+			return nil, syscall.Errno(-n)
+		}
+		if int(n) <= len(buf) {
+			pids := make([]int, n)
+			for i := range pids {
+				pids[i] = int(buf[i])
+			}
+			return pids, nil
+		}
+		buf = make([]C.pid_t, n)
+	}
+}
+
+// killContract kills the processes.
+func killContract(pids []int) {
+	for _, pid := range pids {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
+
+// abandonContract gives up the contract, which the system removes once it
+// is empty.
+func abandonContract(id int) error {
+	if err := C.panicwrap_abandon(C.int(id)); err != 0 {
+		return syscall.Errno(err)
+	}
+	return nil
+}
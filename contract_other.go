@@ -0,0 +1,32 @@
+//go:build !illumos || !cgo
+
+package panicwrap
+
+import "errors"
+
+// contractSupported is whether WrapConfig.Contract can be used.
+const contractSupported = false
+
+var errContractUnsupported = errors.New("panicwrap: Contract isn't supported on this platform")
+
+type contractTemplate struct{}
+
+func activateContract() (*contractTemplate, error) {
+	return nil, errContractUnsupported
+}
+
+func (*contractTemplate) clear() {}
+
+func latestContract() (int, error) {
+	return 0, errContractUnsupported
+}
+
+func contractMembers(int) ([]int, error) {
+	return nil, errContractUnsupported
+}
+
+func killContract([]int) {}
+
+func abandonContract(int) error {
+	return errContractUnsupported
+}
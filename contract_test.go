@@ -0,0 +1,31 @@
+package panicwrap
+
+import (
+	"testing"
+)
+
+func TestValidate_contractUnsupported(t *testing.T) {
+	if contractSupported {
+		t.Skip("Contract is supported here")
+	}
+
+	err := (&WrapConfig{Handler: func(string) {}, Contract: true}).Validate()
+	if err == nil || err.Error() != "Contract is only supported on illumos, with cgo" {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestStartInContract_unsupported(t *testing.T) {
+	if contractSupported {
+		t.Skip("Contract is supported here")
+	}
+
+	started := false
+	_, _, err := startInContract(&WrapConfig{}, func() (Process, error) {
+		started = true
+		return nil, nil
+	})
+	if err == nil || started {
+		t.Fatalf("should not start the child without a contract: %v", err)
+	}
+}
@@ -0,0 +1,405 @@
+package panicwrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// controlEnvKey passes the file descriptor of the control pipe the child
+// reads from. It writes to the next one. See WrapConfig.Control.
+const controlEnvKey = "PANICWRAP_CONTROL_FD"
+
+// Report is a problem the child reported to the parent with SendReport,
+// without crashing.
+type Report struct {
+	// Text is the text the child reported.
+	Text string
+
+	// Metadata holds the entries the child set with SetMetadata up to
+	// the report.
+	Metadata map[string]string
+
+	// PID is the process ID of the child, Worker the index of its worker
+	// and Time when the parent received the report.
+	PID    int
+	Worker int
+	Time   time.Time
+}
+
+// ReportHandlerFunc is the type called when the child reports a problem.
+type ReportHandlerFunc func(*Report)
+
+// ErrNoControl is returned by the functions the child uses to talk to the
+// parent if there is no control channel, because the process isn't
+// wrapped or WrapConfig.Control isn't set.
+var ErrNoControl = errors.New("panicwrap: no control channel to the parent")
+
+// childControl is the child side of the control channel.
+type childControl struct {
+	mu sync.Mutex
+	w  *os.File
+}
+
+var (
+	// activeControl is the control channel of this child, if any.
+	activeControl atomic.Pointer[childControl]
+
+	// shutdownCh is closed once the parent asks for a shutdown.
+	shutdownCh   = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+// startControl opens the child side of the control channel, if the parent
+// passed one, and exchanges the handshake with the parent.
+func startControl() error {
+	v := os.Getenv(controlEnvKey)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(controlEnvKey)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("panicwrap: invalid %s %q", controlEnvKey, v)
+	}
+	r := os.NewFile(uintptr(fd), "panicwrap-control-in")
+	w := os.NewFile(uintptr(fd+1), "panicwrap-control-out")
+
+	if err := writeMessage(w, messageHandshake, handshakeMessage{Version: protocolVersion, PID: os.Getpid()}); err != nil {
+		return err
+	}
+	typ, _, err := readMessage(r)
+	if err != nil {
+		return err
+	}
+	if typ != messageHandshake {
+		return fmt.Errorf("panicwrap: unexpected control message %d", typ)
+	}
+
+	activeControl.Store(&childControl{w: w})
+	go func() {
+		for {
+			typ, _, err := readMessage(r)
+			if err != nil {
+				return
+			}
+
+			switch typ {
+			case messageShutdown:
+				shutdownOnce.Do(func() { close(shutdownCh) })
+			case messageSample:
+				sendControl(messageSample, currentSample())
+			case messageStacks:
+				sendControl(messageStacks, currentStacks())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// sendControl sends a message from the child to the parent.
+func sendControl(typ messageType, payload interface{}) error {
+	c := activeControl.Load()
+	if c == nil {
+		return ErrNoControl
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return writeMessage(c.w, typ, payload)
+}
+
+// SetMetadata sets an entry of the metadata the parent attaches to the
+// panics and reports of this child, such as the request being served. It
+// is meant to be called from the child and returns ErrNoControl if there
+// is no control channel to the parent.
+func SetMetadata(key, value string) error {
+	return sendControl(messageMetadata, metadataMessage{Key: key, Value: value})
+}
+
+// Heartbeat tells the parent that the child is alive. See LastHeartbeat.
+// It also counts as a sample of WrapConfig.LeakWatchdog. It returns
+// ErrNoControl if there is no control channel to the parent.
+func Heartbeat() error {
+	return sendControl(messageHeartbeat, currentSample())
+}
+
+// SendReport reports a problem that doesn't crash the child to the
+// parent, which passes it to WrapConfig.ReportHandler. It returns ErrNoControl if
+// there is no control channel to the parent.
+func SendReport(text string) error {
+	return sendControl(messageReport, reportMessage{Text: text})
+}
+
+// ShutdownRequested returns a channel that is closed once the parent asks
+// the child to shut down with RequestShutdown. Without a control channel,
+// it is never closed.
+func ShutdownRequested() <-chan struct{} {
+	return shutdownCh
+}
+
+// parentControl is the parent side of the control channel of a child.
+type parentControl struct {
+	c      *WrapConfig
+	worker int
+	r      *os.File
+
+	// ready is closed once the child calls Ready, if it is set.
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	mu        sync.Mutex
+	w         *os.File
+	metadata  map[string]string
+	heartbeat time.Time
+	readied   bool
+
+	// leaks is the watchdog of WrapConfig.LeakWatchdog, if it is set.
+	leaks *leakWatchdog
+
+	// stackWaiters are waiting for the goroutine dump of the child. See
+	// stacks.
+	stackWaiters []chan string
+
+	// recovered are the recovered panics of the child being handled. See
+	// ReportRecovered.
+	recovered sync.WaitGroup
+
+	done chan struct{}
+	once sync.Once
+}
+
+// newParentControl starts serving the control channel of a child, which
+// the parent reads from r and writes to w. The ready channel, if any, is
+// closed once the child is ready.
+func newParentControl(c *WrapConfig, worker int, ready chan struct{}, r, w *os.File) *parentControl {
+	p := &parentControl{c: c, worker: worker, ready: ready, r: r, w: w, done: make(chan struct{})}
+	if c.LeakWatchdog != nil {
+		p.leaks = &leakWatchdog{l: c.LeakWatchdog}
+	}
+	go p.serve()
+	return p
+}
+
+func (p *parentControl) serve() {
+	defer close(p.done)
+
+	typ, data, err := readMessage(p.r)
+	if err != nil || typ != messageHandshake {
+		return
+	}
+	var hello handshakeMessage
+	if json.Unmarshal(data, &hello) != nil {
+		return
+	}
+	if p.send(messageHandshake, handshakeMessage{Version: protocolVersion, PID: os.Getpid()}) != nil {
+		return
+	}
+	if p.leaks != nil {
+		go p.sample()
+	}
+
+	for {
+		typ, data, err := readMessage(p.r)
+		if err != nil {
+			return
+		}
+
+		// Messages of types this parent doesn't know are skipped, so
+		// that newer children can talk to it.
+		switch typ {
+		case messageReady:
+			p.mu.Lock()
+			p.readied = true
+			p.mu.Unlock()
+			if p.ready != nil {
+				p.readyOnce.Do(func() { close(p.ready) })
+			}
+		case messageHeartbeat:
+			p.mu.Lock()
+			p.heartbeat = p.c.Clock.Now()
+			p.mu.Unlock()
+			var m sampleMessage
+			if json.Unmarshal(data, &m) == nil {
+				p.addSample(m, hello.PID)
+			}
+		case messageSample:
+			var m sampleMessage
+			if json.Unmarshal(data, &m) == nil {
+				p.addSample(m, hello.PID)
+			}
+		case messageMetadata:
+			var m metadataMessage
+			if json.Unmarshal(data, &m) != nil {
+				continue
+			}
+			p.mu.Lock()
+			if p.metadata == nil {
+				p.metadata = make(map[string]string)
+			}
+			p.metadata[m.Key] = m.Value
+			p.mu.Unlock()
+		case messageReport:
+			var m reportMessage
+			if json.Unmarshal(data, &m) != nil || p.c.ReportHandler == nil {
+				continue
+			}
+			p.c.ReportHandler(&Report{
+				Text:     m.Text,
+				Metadata: p.copyMetadata(),
+				PID:      hello.PID,
+				Worker:   p.worker,
+				Time:     p.c.Clock.Now(),
+			})
+		case messageStacks:
+			var m stacksMessage
+			if json.Unmarshal(data, &m) == nil {
+				p.deliverStacks(m.Text)
+			}
+		case messageSubprocessCrash:
+			var m subprocessCrashMessage
+			if json.Unmarshal(data, &m) != nil {
+				continue
+			}
+			info := subprocessCrash(p.c, &m, hello.PID, p.worker)
+			info.Metadata = p.copyMetadata()
+			emit(Event{Type: EventSubprocessCrashed, Time: p.c.Clock.Now(), Worker: p.worker, PID: m.PID, Panic: info})
+			if p.c.SubprocessHandler != nil {
+				p.c.SubprocessHandler(info)
+			}
+		case messageRecovered:
+			var m recoveredMessage
+			root := activeChild.Load()
+			if json.Unmarshal(data, &m) != nil || root == nil || root.inject == nil {
+				continue
+			}
+			info := &PanicInfo{
+				Text:      m.Text,
+				Recovered: true,
+				Request:   m.Request,
+				PID:       hello.PID,
+				Worker:    p.worker,
+				Metadata:  p.copyMetadata(),
+			}
+			// The handlers may take a while, and the heartbeats of the
+			// child mustn't wait for them.
+			p.recovered.Add(1)
+			go func() {
+				defer p.recovered.Done()
+				root.inject(info)
+			}()
+		}
+	}
+}
+
+// send sends a message from the parent to the child.
+func (p *parentControl) send(typ messageType, payload interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return writeMessage(p.w, typ, payload)
+}
+
+func (p *parentControl) copyMetadata() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(p.metadata))
+	for k, v := range p.metadata {
+		result[k] = v
+	}
+
+	return result
+}
+
+func (p *parentControl) lastHeartbeat() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.heartbeat
+}
+
+// isReady returns whether the child called Ready.
+func (p *parentControl) isReady() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.readied
+}
+
+// close waits until the child closed its end of the channel, which it
+// does at the latest when it exits, and returns the metadata it set.
+func (p *parentControl) close() map[string]string {
+	p.once.Do(func() {
+		<-p.done
+		p.recovered.Wait()
+		p.r.Close()
+		p.w.Close()
+	})
+
+	return p.copyMetadata()
+}
+
+func (c *child) setControl(p *parentControl) {
+	c.Lock()
+	defer c.Unlock()
+	c.control = p
+}
+
+func (c *child) getControl() (*parentControl, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.control == nil {
+		return nil, errors.New("panicwrap: the child has no control channel")
+	}
+
+	return c.control, nil
+}
+
+// RequestShutdown asks the running child, or all workers, to shut down
+// gracefully over the control channel, and keeps it from being restarted.
+// The child learns about it from ShutdownRequested. This requires
+// WrapConfig.Control.
+func RequestShutdown() error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	var err error
+	ch.each(func(w *child) {
+		w.stop()
+		p, cerr := w.getControl()
+		if cerr == nil {
+			cerr = p.send(messageShutdown, struct{}{})
+		}
+		if err == nil {
+			err = cerr
+		}
+	})
+
+	return err
+}
+
+// LastHeartbeat returns when the running child last called Heartbeat. It
+// is zero if it didn't yet. This requires WrapConfig.Control.
+func LastHeartbeat() (time.Time, error) {
+	ch := activeChild.Load()
+	if ch == nil {
+		return time.Time{}, errors.New("panicwrap: not wrapping a child")
+	}
+
+	p, err := ch.getControl()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return p.lastHeartbeat(), nil
+}
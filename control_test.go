@@ -0,0 +1,92 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetMetadata_noControl(t *testing.T) {
+	if err := SetMetadata("a", "b"); err != ErrNoControl {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := SendReport("a"); err != ErrNoControl {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestParentControl(t *testing.T) {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer inR.Close()
+
+	var report *Report
+	c := &WrapConfig{
+		Clock:         realClock{},
+		ReportHandler: func(r *Report) { report = r },
+	}
+	p := newParentControl(c, 2, nil, outR, inW)
+
+	// Play the child.
+	writeMessage(outW, messageHandshake, handshakeMessage{Version: protocolVersion, PID: 42})
+	if typ, _, err := readMessage(inR); err != nil || typ != messageHandshake {
+		t.Fatalf("bad: %d, %v", typ, err)
+	}
+	writeMessage(outW, messageMetadata, metadataMessage{Key: "request", Value: "7"})
+	writeMessage(outW, messageType(200), struct{}{})
+	writeMessage(outW, messageHeartbeat, struct{}{})
+	writeMessage(outW, messageReport, reportMessage{Text: "slow"})
+	outW.Close()
+
+	metadata := p.close()
+	if metadata["request"] != "7" {
+		t.Fatalf("bad: %#v", metadata)
+	}
+	if p.lastHeartbeat().IsZero() {
+		t.Fatal("should record the heartbeat")
+	}
+	if report == nil || report.Text != "slow" || report.PID != 42 || report.Worker != 2 || report.Metadata["request"] != "7" {
+		t.Fatalf("bad: %#v", report)
+	}
+}
+
+func TestPanicWrap_control(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("control")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The report is handled before the panic.
+	out := stdout.String()
+	report := strings.Index(out, "report: slow\n")
+	metadata := strings.Index(out, "metadata: 42\n")
+	if report < 0 || metadata < report {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestPanicWrap_controlShutdown(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("control", "shutdown")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if stdout.String() != "shutting down\n" {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+}
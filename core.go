@@ -0,0 +1,131 @@
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CoreInfo describes the core file the child dumped when it crashed, which
+// it does with GOTRACEBACK=crash (see WrapConfig.GoTraceback) if the core
+// size limit allows it.
+type CoreInfo struct {
+	// Path is the path of the core file, after it was moved to
+	// WrapConfig.CoreDir if that is set. It is empty if the core file
+	// couldn't be found, such as when the kernel passes cores to a
+	// program like systemd-coredump instead of writing them to a file.
+	Path string `json:"path"`
+
+	// Size is the size of the core file in bytes.
+	Size int64 `json:"size"`
+
+	// Pattern is the core file name pattern of the system, such as the
+	// contents of /proc/sys/kernel/core_pattern on Linux. It tells where
+	// to look for the core if Path is empty.
+	Pattern string `json:"pattern"`
+}
+
+// findCore looks for the core file dumped by the child with the given
+// process ID and executable path, and moves it to dir if that isn't empty,
+// where it is encrypted if e is set. A core that can't be encrypted is
+// removed, and the error is returned along with the info without its path.
+// Relative core file patterns are resolved against the working directory
+// of the parent, which the child inherits.
+func findCore(pid int, exePath, dir string, e Encrypter) (*CoreInfo, error) {
+	info := &CoreInfo{Pattern: corePattern()}
+	if info.Pattern == "" || strings.HasPrefix(info.Pattern, "|") {
+		return info, nil
+	}
+
+	pattern := expandCorePattern(info.Pattern, pid, exePath)
+	if coreUsesPID() && !strings.Contains(info.Pattern, "%p") {
+		pattern += "." + strconv.Itoa(pid)
+	}
+
+	matches, _ := filepath.Glob(pattern)
+	var newest os.FileInfo
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if newest == nil || fi.ModTime().After(newest.ModTime()) {
+			info.Path, newest = m, fi
+		}
+	}
+	if newest == nil {
+		return info, nil
+	}
+	info.Size = newest.Size()
+
+	if dir != "" {
+		dst := filepath.Join(dir, fmt.Sprintf("core.%s.%d", filepath.Base(exePath), pid))
+		if err := os.MkdirAll(dir, 0755); err == nil {
+			if err := os.Rename(info.Path, dst); err == nil {
+				info.Path = dst
+			}
+		}
+		if e != nil && info.Path == dst {
+			path, err := encryptFile(dst, e)
+			if err != nil {
+				os.Remove(dst)
+				info.Path = ""
+				return info, err
+			}
+			info.Path = path
+		}
+	}
+
+	return info, nil
+}
+
+// expandCorePattern turns a core file name pattern using the Linux
+// specifiers into a glob for the core of the given process. Specifiers
+// whose values the parent can't know, such as the time of the dump, match
+// anything.
+func expandCorePattern(pattern string, pid int, exePath string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		if ch != '%' || i+1 == len(pattern) {
+			b.WriteString(globEscape(string(ch)))
+			continue
+		}
+
+		i++
+		switch pattern[i] {
+		case '%':
+			b.WriteByte('%')
+		case 'p', 'P':
+			b.WriteString(strconv.Itoa(pid))
+		case 'u':
+			b.WriteString(strconv.Itoa(os.Getuid()))
+		case 'g':
+			b.WriteString(strconv.Itoa(os.Getgid()))
+		case 'h':
+			hostname, _ := os.Hostname()
+			b.WriteString(globEscape(hostname))
+		case 'e':
+			// The kernel uses the command name, which is truncated.
+			name := filepath.Base(exePath)
+			if len(name) > 15 {
+				name = name[:15]
+			}
+			b.WriteString(globEscape(name))
+		case 'E':
+			b.WriteString(globEscape(strings.ReplaceAll(exePath, "/", "!")))
+		default:
+			b.WriteByte('*')
+		}
+	}
+
+	return b.String()
+}
+
+// globEscape escapes the characters that are special to filepath.Match.
+func globEscape(s string) string {
+	r := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return r.Replace(s)
+}
@@ -0,0 +1,20 @@
+package panicwrap
+
+import (
+	"os"
+	"strings"
+)
+
+func corePattern() string {
+	data, err := os.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		return "core"
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func coreUsesPID() bool {
+	data, err := os.ReadFile("/proc/sys/kernel/core_uses_pid")
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
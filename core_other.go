@@ -0,0 +1,22 @@
+//go:build !linux
+
+package panicwrap
+
+import "runtime"
+
+func corePattern() string {
+	switch runtime.GOOS {
+	case "windows", "plan9", "js", "wasip1":
+		return ""
+	case "darwin", "ios":
+		// The default of the kern.corefile sysctl.
+		return "/cores/core.%p"
+	default:
+		// The BSDs default to "%N.core", %N being the process name.
+		return "%e.core"
+	}
+}
+
+func coreUsesPID() bool {
+	return false
+}
@@ -0,0 +1,132 @@
+package panicwrap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestExpandCorePattern(t *testing.T) {
+	uid := strconv.Itoa(os.Getuid())
+	cases := []struct {
+		pattern string
+		want    string
+	}{
+		{"core", "core"},
+		{"core.%p", "core.42"},
+		{"/var/crash/%e.%p.%t", "/var/crash/averyveryverylo.42.*"},
+		{"/tmp/core-%E-%u-%%", "/tmp/core-!usr!bin!averyveryverylongname-" + uid + "-%"},
+		{"%s.core[%P]", "*.core\\[42]"},
+	}
+
+	for _, tc := range cases {
+		got := expandCorePattern(tc.pattern, 42, "/usr/bin/averyveryverylongname")
+		if got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestFindCore_piped(t *testing.T) {
+	p := corePattern()
+	if p == "" || p[0] != '|' {
+		t.Skip("cores aren't piped to a program on this system")
+	}
+
+	info, err := findCore(42, "/usr/bin/foo", "", nil)
+	if err != nil || info.Path != "" || info.Pattern != p {
+		t.Fatalf("bad: %#v", info)
+	}
+}
+
+func TestFindCore_move(t *testing.T) {
+	if corePattern() != "core" || coreUsesPID() {
+		t.Skip("the core file pattern isn't the default")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	src := t.TempDir()
+	if err := os.Chdir(src); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile("core", []byte("core"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "cores")
+	info, err := findCore(42, "/usr/bin/foo", dir, nil)
+	if err != nil || info.Path != filepath.Join(dir, "core.foo.42") || info.Size != 4 {
+		t.Fatalf("bad: %#v", info)
+	}
+	if _, err := os.Stat(info.Path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestFindCore_encrypt(t *testing.T) {
+	if corePattern() != "core" || coreUsesPID() {
+		t.Skip("the core file pattern isn't the default")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile("core", []byte("core"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir := t.TempDir()
+	info, err := findCore(42, "/usr/bin/foo", dir, &xorEncrypter{})
+	if err != nil || info.Path != filepath.Join(dir, "core.foo.42.xor") {
+		t.Fatalf("bad: %#v, %v", info, err)
+	}
+
+	data, err := os.ReadFile(info.Path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if decrypted, err := xorDecrypt(data); err != nil || string(decrypted) != "core" {
+		t.Fatalf("bad: %q, %v", decrypted, err)
+	}
+}
+
+func TestFindCore_encryptFails(t *testing.T) {
+	if corePattern() != "core" || coreUsesPID() {
+		t.Skip("the core file pattern isn't the default")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile("core", []byte("core"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir := t.TempDir()
+	info, err := findCore(42, "/usr/bin/foo", dir, &xorEncrypter{err: errors.New("no entropy")})
+	if err == nil || info.Path != "" {
+		t.Fatalf("bad: %#v, %v", info, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("should remove the plain core: %v", entries)
+	}
+}
@@ -0,0 +1,46 @@
+package panicwrap
+
+import (
+	"os"
+	"runtime/coverage"
+	"time"
+)
+
+// startCoverage starts the child side of WrapConfig.CoverFlushInterval. It
+// does nothing unless the binary is built with -cover -covermode=atomic and
+// GOCOVERDIR is set.
+func startCoverage(c *WrapConfig) {
+	dir := os.Getenv("GOCOVERDIR")
+	if dir == "" || c.CoverFlushInterval == 0 {
+		return
+	}
+
+	// The runtime only writes the meta-data file at exit, which a crashing
+	// child never gets to, and the counters are useless without it.
+	if err := coverage.WriteMetaDir(dir); err != nil {
+		return
+	}
+
+	go func() {
+		for range time.Tick(c.CoverFlushInterval) {
+			if err := coverage.WriteCountersDir(dir); err != nil {
+				return
+			}
+
+			// Each write starts a new counter file, which go tool covdata
+			// sums up, so start from zero again.
+			coverage.ClearCounters()
+		}
+	}()
+}
+
+// writeCoverage writes the coverage of the current process to the given
+// directory. This does nothing unless the binary is built with -cover
+// -covermode=atomic.
+func writeCoverage(dir string) {
+	if err := coverage.WriteMetaDir(dir); err != nil {
+		return
+	}
+
+	coverage.WriteCountersDir(dir)
+}
@@ -0,0 +1,28 @@
+package panicwrap
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCoverage_notCovered(t *testing.T) {
+	if testing.CoverMode() != "" {
+		t.Skip("built with -cover")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("GOCOVERDIR", dir)
+
+	startCoverage(&WrapConfig{CoverFlushInterval: time.Millisecond})
+	writeCoverage(dir)
+	time.Sleep(10 * time.Millisecond)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("shouldn't write anything: %v", entries)
+	}
+}
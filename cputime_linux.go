@@ -0,0 +1,45 @@
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userHZ is the unit of the times in procfs, which the kernel fixes at
+// 100 per second for userspace.
+const userHZ = 100
+
+// readCPUTime returns the user and system CPU time the process used, from
+// its stat file.
+func readCPUTime(pid int) (time.Duration, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name in parentheses may hold spaces, so the fields are
+	// counted from its end: utime and stime are the 14th and 15th.
+	s := string(data)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("panicwrap: invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(s[i+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("panicwrap: invalid stat of process %d", pid)
+	}
+
+	var ticks int64
+	for _, f := range fields[11:13] {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ticks += n
+	}
+
+	return time.Duration(ticks) * time.Second / userHZ, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package panicwrap
+
+import (
+	"errors"
+	"time"
+)
+
+func readCPUTime(int) (time.Duration, error) {
+	return 0, errors.New("panicwrap: SpinWatchdog isn't supported on this platform")
+}
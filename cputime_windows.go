@@ -0,0 +1,26 @@
+package panicwrap
+
+import (
+	"syscall"
+	"time"
+)
+
+// readCPUTime returns the user and kernel CPU time the process used.
+func readCPUTime(pid int) (time.Duration, error) {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(h)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+
+	// The times are in units of 100 nanoseconds.
+	ticks := func(t syscall.Filetime) int64 {
+		return int64(t.HighDateTime)<<32 | int64(t.LowDateTime)
+	}
+	return time.Duration(ticks(kernel)+ticks(user)) * 100, nil
+}
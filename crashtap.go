@@ -0,0 +1,84 @@
+package panicwrap
+
+import (
+	"sync"
+)
+
+// crashTap reads what WrapConfig.OpenFiles and ProcStatus ask for from
+// /proc as soon as the output the child writes to stderr starts a crash,
+// and notes the descendants of the child for Subreaper.
+// The child is usually still writing the stacks that follow then, so it
+// hasn't exited and closed its files or given back its memory yet.
+type crashTap struct {
+	rules headerRules
+	files bool
+	proc  bool
+	tree  bool
+
+	mu      sync.Mutex
+	pid     int
+	midLine bool
+	taken   bool
+	snap    crashSnapshot
+}
+
+// crashSnapshot is what a crashTap read when the child crashed.
+type crashSnapshot struct {
+	files []OpenFile
+	proc  *ProcStatus
+}
+
+// newCrashTap returns a crashTap for what c asks for, or nil if it asks
+// for nothing.
+func newCrashTap(c *WrapConfig) *crashTap {
+	if !c.OpenFiles && !c.ProcStatus && !c.Subreaper {
+		return nil
+	}
+	return &crashTap{rules: newHeaderRules(c), files: c.OpenFiles, proc: c.ProcStatus, tree: c.Subreaper}
+}
+
+// setPID sets the process ID of the child once it started.
+func (t *crashTap) setPID(pid int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pid = pid
+}
+
+func (t *crashTap) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.taken || t.pid == 0 || len(p) == 0 {
+		return len(p), nil
+	}
+
+	for _, header := range []string{"panic:", "fatal error:", "runtime: out of memory:"} {
+		if indexHeader(p, []byte(header), t.rules, t.midLine) >= 0 {
+			t.take()
+			break
+		}
+	}
+	t.midLine = p[len(p)-1] != '\n'
+
+	return len(p), nil
+}
+
+// take reads the snapshot. What can't be read is left out.
+func (t *crashTap) take() {
+	t.taken = true
+	if t.files {
+		t.snap.files, _ = readOpenFiles(t.pid)
+	}
+	if t.proc {
+		t.snap.proc, _ = readProcStatus(t.pid)
+	}
+	if t.tree {
+		trackDescendants(t.pid)
+	}
+}
+
+// snapshot returns what was read, which is empty if no crash was seen.
+func (t *crashTap) snapshot() crashSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.snap
+}
@@ -0,0 +1,35 @@
+package panicwrap
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCrashTap(t *testing.T) {
+	tap := newCrashTap(&WrapConfig{OpenFiles: true, ProcStatus: true})
+	tap.Write([]byte("panic: before the child started\n"))
+	if tap.snapshot().files != nil {
+		t.Fatal("should wait for the child to start")
+	}
+
+	tap.setPID(os.Getpid())
+	tap.Write([]byte("ordinary output\n"))
+	if tap.snapshot().files != nil {
+		t.Fatal("should only read on a crash")
+	}
+
+	tap.Write([]byte("panic: boom\n"))
+	snap := tap.snapshot()
+	if len(snap.files) == 0 {
+		t.Fatal("should list the open files")
+	}
+	if snap.proc == nil || snap.proc.Status["Pid"] == "" {
+		t.Fatalf("should read the status: %#v", snap.proc)
+	}
+}
+
+func TestNewCrashTap(t *testing.T) {
+	if newCrashTap(&WrapConfig{}) != nil {
+		t.Fatal("should have nothing to read")
+	}
+}
@@ -0,0 +1,12 @@
+package panicwrap
+
+// Credential is the user and groups the child runs as. It is only used if
+// WrapConfig.Credential is set.
+type Credential struct {
+	UID uint32
+	GID uint32
+
+	// Groups are the supplementary groups of the child. The groups of the
+	// parent aren't kept, so the child has none if this is empty.
+	Groups []uint32
+}
@@ -0,0 +1,106 @@
+package panicwrap
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// DaemonConfig configures how the parent detaches into the background.
+// It is only used if WrapConfig.Daemon is set.
+type DaemonConfig struct {
+	// PIDFile, if set, is the path of a file the detached parent writes
+	// its process ID to. It is removed when Wrap returns.
+	PIDFile string
+
+	// The files the stdout and stderr of the detached parent, and so of
+	// the child, are appended to. They may be the same file. If one isn't
+	// set, the stream is discarded.
+	Stdout string
+	Stderr string
+}
+
+// daemonEnvKey marks the copy of the program that was started in the
+// background to supervise the child. See WrapConfig.Daemon.
+const daemonEnvKey = "PANICWRAP_DAEMON"
+
+// isDaemon reports whether this is the detached copy of the program, and
+// unsets the environment variable that marks it.
+func isDaemon() bool {
+	if os.Getenv(daemonEnvKey) == "" {
+		return false
+	}
+
+	os.Unsetenv(daemonEnvKey)
+	return true
+}
+
+// startDaemon starts a copy of the program that is detached from the
+// terminal and the session of this one, with its output going to the
+// configured files.
+func startDaemon(c *DaemonConfig, exePath string) error {
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer stdin.Close()
+
+	stdout, err := openDaemonOutput(c.Stdout)
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+
+	stderr := stdout
+	if c.Stderr != c.Stdout {
+		if stderr, err = openDaemonOutput(c.Stderr); err != nil {
+			return err
+		}
+		defer stderr.Close()
+	}
+
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnvKey+"=1")
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setDetached(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Nobody waits for the detached copy, so let it go.
+	return cmd.Process.Release()
+}
+
+func openDaemonOutput(path string) (*os.File, error) {
+	if path == "" {
+		return os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	}
+
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+// writePIDFile writes the process ID to the file, replacing it at once so
+// that readers never see a partial one.
+func writePIDFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,7 @@
+//go:build !unix && !windows
+
+package panicwrap
+
+import "os/exec"
+
+func setDetached(*exec.Cmd) {}
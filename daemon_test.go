@@ -0,0 +1,71 @@
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.pid")
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := writePIDFile(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Fatalf("bad: %#v", string(data))
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Fatalf("should clean up: %v", entries)
+	}
+}
+
+func TestPanicWrap_daemon(t *testing.T) {
+	dir := t.TempDir()
+	p := helperProcess("daemon", dir)
+	p.Stdout = nil
+	p.Stderr = nil
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The detached parent writes the output of the child and removes its
+	// PID file once the child exited.
+	var out string
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(dir, "out"))
+		out = string(data)
+		_, err := os.Stat(filepath.Join(dir, "pid"))
+		if strings.Contains(out, "\n") && os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out: %#v", out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var pidFile, ppid int
+	if _, err := fmt.Sscanf(out, "%d %d", &pidFile, &ppid); err != nil {
+		t.Fatalf("err: %s: %#v", err, out)
+	}
+	if pidFile != ppid {
+		t.Fatalf("should write the PID file: %#v", out)
+	}
+	if ppid == p.Process.Pid {
+		t.Fatalf("should detach: %#v", out)
+	}
+}
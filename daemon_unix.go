@@ -0,0 +1,17 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setDetached makes the command start in a new session, without a
+// controlling terminal.
+func setDetached(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setsid = true
+}
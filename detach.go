@@ -0,0 +1,44 @@
+package panicwrap
+
+import (
+	"io"
+	"time"
+)
+
+// stderrDetachGrace is how long the child may keep running after its
+// stderr ended before it counts as detached. A child that exits closes
+// its stderr shortly before it can be waited for.
+const stderrDetachGrace = time.Second
+
+// eofWriter notices when the stderr of the child ends. The command copies
+// the output of the child into it with io.Copy, which hands the whole pipe
+// to ReadFrom.
+type eofWriter struct {
+	w   io.Writer
+	eof chan struct{}
+}
+
+func (e *eofWriter) Write(p []byte) (int, error) {
+	return e.w.Write(p)
+}
+
+func (e *eofWriter) ReadFrom(r io.Reader) (int64, error) {
+	defer close(e.eof)
+	return io.Copy(e.w, r)
+}
+
+// watchStderr calls WrapConfig.StderrDetachedHandler if the stderr of the
+// child with the given process ID ends while the child keeps running.
+func watchStderr(c *WrapConfig, pid int, eof, exited <-chan struct{}) {
+	select {
+	case <-exited:
+		return
+	case <-eof:
+	}
+
+	select {
+	case <-exited:
+	case <-c.Clock.After(stderrDetachGrace):
+		bestEffort(c, "calling StderrDetachedHandler", func() { c.StderrDetachedHandler(pid) })
+	}
+}
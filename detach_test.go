@@ -0,0 +1,59 @@
+package panicwrap
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEOFWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := &eofWriter{w: out, eof: make(chan struct{})}
+
+	if _, err := io.Copy(w, struct{ io.Reader }{strings.NewReader("output")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-w.eof:
+	default:
+		t.Fatal("should notice the end")
+	}
+	if out.String() != "output" {
+		t.Fatalf("bad: %#v", out.String())
+	}
+}
+
+func TestWatchStderr_exited(t *testing.T) {
+	c := &WrapConfig{
+		StderrDetachedHandler: func(int) { t.Fatal("shouldn't be called") },
+	}
+	setDefaults(c)
+
+	eof := make(chan struct{})
+	exited := make(chan struct{})
+	close(eof)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(exited)
+	}()
+
+	watchStderr(c, 42, eof, exited)
+}
+
+func TestPanicWrap_detachStderr(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("detach-stderr")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err == nil {
+		t.Fatal("should exit with the status of the child")
+	}
+
+	if !strings.Contains(stdout.String(), "detached\n") {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+}
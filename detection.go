@@ -0,0 +1,59 @@
+package panicwrap
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// DetectTimeoutAction is what happens to the output that follows a panic
+// header once the child didn't exit within WrapConfig.DetectDuration. It
+// trades the latency of stderr for the capture of crashes that take long
+// to print.
+type DetectTimeoutAction int
+
+const (
+	// DetectTimeoutFlush takes the output for ordinary output: it is
+	// written out, and the output that follows it is forwarded as it
+	// arrives again. This is the default.
+	DetectTimeoutFlush DetectTimeoutAction = iota
+
+	// DetectTimeoutCrash takes the output for a crash that is still
+	// being printed: everything that follows the header is held back
+	// until the child exits, however long that takes, and handled as a
+	// crash if it exits with a non-zero status. A header that a child
+	// which keeps running printed holds back the rest of its stderr, so
+	// this is best combined with StrictDetection or IgnoreJSONLines.
+	DetectTimeoutCrash
+)
+
+// detectionDisabled is set while detection is turned off for the running
+// Wrap call. See DisableDetection.
+var detectionDisabled atomic.Bool
+
+// DisableDetection turns off the detection of panics for the running
+// child, or all workers, and the children started after it, until
+// EnableDetection is called. The stderr of the child is then written out
+// as it arrives, without looking for panics or holding anything back, so
+// that bulk output costs as little as it can. A panic in the meantime
+// isn't handled, and the child exiting from it is seen as a plain exit
+// with a non-zero status. A panic that was already being gathered is
+// still handled. Detection is on again once Wrap returns.
+func DisableDetection() error {
+	if activeChild.Load() == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	detectionDisabled.Store(true)
+	return nil
+}
+
+// EnableDetection turns the detection of panics back on after
+// DisableDetection.
+func EnableDetection() error {
+	if activeChild.Load() == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	detectionDisabled.Store(false)
+	return nil
+}
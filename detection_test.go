@@ -0,0 +1,206 @@
+package panicwrap
+
+import (
+	"io"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTrackPanic_bypass(t *testing.T) {
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	bypass := new(atomic.Bool)
+	bypass.Store(true)
+	go trackPanic(r, out, time.Minute, time.Minute, realClock{}, defaultTrackSize, false, headerRules{}, bypass, nil, result)
+
+	w.Write([]byte("bulk\npanic: not detected\n"))
+	w.Write([]byte("pan"))
+
+	// Nothing is held back, so the output arrives without the child
+	// exiting.
+	deadline := time.Now().Add(5 * time.Second)
+	for out.String() != "bulk\npanic: not detected\npan" {
+		if time.Now().After(deadline) {
+			t.Fatalf("bad: %q", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	bypass.Store(false)
+	w.Write([]byte("ic: detected\n"))
+	w.Write([]byte("panic: boom\n"))
+	w.Close()
+
+	if text := <-result; text != "panic: boom\n" {
+		t.Fatalf("bad: %q", text)
+	}
+}
+
+func TestDisableDetection(t *testing.T) {
+	if err := DisableDetection(); err == nil {
+		t.Fatal("should fail without a child")
+	}
+
+	ch := new(child)
+	activeChild.Store(ch)
+	defer activeChild.CompareAndSwap(ch, nil)
+	defer detectionDisabled.Store(false)
+
+	if resp := runCommand(CommandDisableDetection, ch); resp.Error != "" {
+		t.Fatalf("err: %s", resp.Error)
+	}
+	if !detectionDisabled.Load() {
+		t.Fatal("should be disabled")
+	}
+	if resp := runCommand(CommandEnableDetection, ch); resp.Error != "" {
+		t.Fatalf("err: %s", resp.Error)
+	}
+	if detectionDisabled.Load() {
+		t.Fatal("should be enabled")
+	}
+}
+
+func TestIndexHeader(t *testing.T) {
+	header := []byte("panic:")
+	cases := []struct {
+		buf      string
+		skipJSON bool
+		strict   bool
+		midLine  bool
+		idx      int
+	}{
+		{`{"msg":"panic: boom"}` + "\n", false, false, false, 8},
+		{`{"msg":"panic: boom"}` + "\n", true, false, false, -1},
+		{`{"msg":"panic: boom"}` + "\npanic: boom\n", true, false, false, 22},
+		{`  {"level":"error","msg":"panic: boom"}  ` + "\n", true, false, false, -1},
+		{`{"msg":"half panic: boom` + "\n", true, false, false, 13},
+		{`{"msg":"partial panic: boom`, true, false, false, 16},
+		{"log panic: boom\n", true, false, false, 4},
+		{"log panic: boom\n", false, true, false, -1},
+		{"log panic: boom\npanic: boom\n", false, true, false, 16},
+		{"panic: boom\n", false, true, false, 0},
+		{"panic: boom\n", false, true, true, -1},
+	}
+	for _, tc := range cases {
+		if idx := indexHeader([]byte(tc.buf), header, headerRules{skipJSON: tc.skipJSON, strict: tc.strict}, tc.midLine); idx != tc.idx {
+			t.Errorf("%q: got %d, want %d", tc.buf, idx, tc.idx)
+		}
+	}
+}
+
+func TestJSONTail(t *testing.T) {
+	cases := map[string]int{
+		"done\n":                -1,
+		"starting\n{\"msg\":":   9,
+		"starting\n  {\"msg\":": 9,
+		"starting\npanic: boom": -1,
+		"":                      -1,
+	}
+	for buf, want := range cases {
+		if got := jsonTail([]byte(buf)); got != want {
+			t.Errorf("%q: got %d, want %d", buf, got, want)
+		}
+	}
+}
+
+func TestTrackPanic_skipJSON(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, time.Second, clock, defaultTrackSize, false, headerRules{skipJSON: true}, nil, nil, result)
+
+	// A JSON line written in pieces is held back until it is complete.
+	w.Write([]byte("{\"level\":\"error\",\"msg\":\"recovered"))
+	w.Write([]byte(" panic: boom\"}\n"))
+	w.Write([]byte("panic: real\n"))
+	w.Close()
+
+	if text := <-result; text != "panic: real\n" {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "{\"level\":\"error\",\"msg\":\"recovered panic: boom\"}\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_strict(t *testing.T) {
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Minute, 0, realClock{}, defaultTrackSize, false, headerRules{strict: true}, nil, nil, result)
+
+	// A logged header doesn't start a line, and one that starts a line
+	// needs the stacks after it.
+	w.Write([]byte("retrying after panic: timeout\n"))
+	w.Write([]byte("panic: config missing, exiting\n"))
+	w.Close()
+
+	if text, ok := <-result; ok {
+		t.Fatalf("detected: %q", text)
+	}
+	if out.String() != "retrying after panic: timeout\npanic: config missing, exiting\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_strictCrash(t *testing.T) {
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Minute, 0, realClock{}, defaultTrackSize, false, headerRules{strict: true}, nil, nil, result)
+
+	w.Write([]byte("starting\n"))
+	w.Write([]byte(testPanicText))
+	w.Close()
+
+	if text := <-result; text != testPanicText {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "starting\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_detectForever(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, detectForever, 0, clock, defaultTrackSize, false, headerRules{}, nil, nil, result)
+
+	// However long the crash takes to print, it is kept together.
+	w.Write([]byte("starting\npanic: boom\n\n"))
+	clock.Advance(time.Hour)
+	w.Write([]byte("goroutine 1 [running]:\n"))
+	w.Close()
+
+	if text := <-result; text != "panic: boom\n\ngoroutine 1 [running]:\n" {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "starting\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_ignorePatterns(t *testing.T) {
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	rules := headerRules{ignore: []*regexp.Regexp{regexp.MustCompile(`^panic: recovered`)}}
+	go trackPanic(r, out, time.Minute, 0, realClock{}, defaultTrackSize, false, rules, nil, nil, result)
+
+	w.Write([]byte("panic: recovered from bad input\n"))
+	w.Write([]byte(testPanicText))
+	w.Close()
+
+	if text := <-result; text != testPanicText {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "panic: recovered from bad input\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
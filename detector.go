@@ -0,0 +1,173 @@
+package panicwrap
+
+import (
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DetectorConfig is the configuration of a Detector or a
+// PanicDetectingWriter. The fields mean what
+// the fields of WrapConfig of the same name do.
+type DetectorConfig struct {
+	// Handler and InfoHandler are called with a crash found in the
+	// output. Either may be nil.
+	Handler     HandlerFunc
+	InfoHandler InfoHandlerFunc
+
+	// DumpHandler is called with a goroutine dump found in the output.
+	// Dumps aren't passed to the other handlers.
+	DumpHandler DumpHandlerFunc
+
+	// DetectDuration is how long what follows a panic header is held
+	// back before it is taken for ordinary output. For a
+	// PanicDetectingWriter, it is how long the output has to go quiet
+	// for a crash to be over. Defaults to 300ms.
+	DetectDuration time.Duration
+
+	// PartialHeaderWait is how long a write that ends with what may be
+	// the start of a panic header is held back for the rest of it.
+	// Defaults to 300ms. A PanicDetectingWriter doesn't hold anything
+	// back.
+	PartialHeaderWait time.Duration
+
+	StrictDetection bool
+	IgnoreJSONLines bool
+	IgnorePatterns  []*regexp.Regexp
+
+	// Clock is the source of time of the detection. Defaults to the time
+	// package.
+	Clock Clock
+}
+
+// Detector looks for crashes in output that it is given, the way Wrap
+// looks for them in the stderr of the child, without a child: such as the
+// stderr of a container that was captured some other way. It is an
+// io.WriteCloser; what is written to it that isn't part of a crash is
+// written on to the writer it was created with as it arrives.
+//
+// Wrap only takes what it tracked for a crash once the child exited with
+// a non-zero status. A Detector doesn't know how the output ends, so it
+// takes what it tracked when it is closed for a crash, and closing it is
+// what calls the handlers.
+type Detector struct {
+	c      *DetectorConfig
+	pw     *io.PipeWriter
+	result chan string
+	w      io.Writer
+
+	closeOnce sync.Once
+}
+
+// NewDetector returns a Detector that writes the output that isn't part
+// of a crash on to w. The configuration may be nil.
+func NewDetector(w io.Writer, c *DetectorConfig) *Detector {
+	cfg := detectorDefaults(c)
+	pr, pw := io.Pipe()
+	d := &Detector{c: cfg, pw: pw, result: make(chan string), w: w}
+	rules := cfg.rules()
+	go func() {
+		trackPanic(pr, w, cfg.DetectDuration, cfg.PartialHeaderWait, cfg.Clock, defaultTrackSize, false, rules, nil, nil, d.result)
+		pr.Close()
+	}()
+
+	return d
+}
+
+// detectorDefaults returns a copy of the configuration, which may be nil,
+// with the defaults filled in.
+func detectorDefaults(c *DetectorConfig) *DetectorConfig {
+	cfg := DetectorConfig{}
+	if c != nil {
+		cfg = *c
+	}
+	if cfg.DetectDuration == 0 {
+		cfg.DetectDuration = 300 * time.Millisecond
+	}
+	if cfg.PartialHeaderWait == 0 {
+		cfg.PartialHeaderWait = 300 * time.Millisecond
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = realClock{}
+	}
+	return &cfg
+}
+
+// rules returns the header rules of the configuration.
+func (c *DetectorConfig) rules() headerRules {
+	return headerRules{skipJSON: c.IgnoreJSONLines, strict: c.StrictDetection, ignore: c.IgnorePatterns}
+}
+
+// Write looks for crashes in p. It only fails once the Detector was
+// closed.
+func (d *Detector) Write(p []byte) (int, error) {
+	return d.pw.Write(p)
+}
+
+// Close ends the output. What was tracked for a crash by then is passed
+// to the handlers, or to DumpHandler if it is a goroutine dump, before
+// Close returns. Without a handler for it, it is written on to the
+// writer instead. Closing it again does nothing.
+func (d *Detector) Close() error {
+	d.closeOnce.Do(func() {
+		d.pw.Close()
+		text := <-d.result
+		for range d.result {
+		}
+		if text == "" {
+			return
+		}
+
+		handleDetected(d.c, d.w, text)
+	})
+
+	return nil
+}
+
+// handleDetected passes what a Detector or a PanicDetectingWriter found
+// to the handlers of the configuration, or writes it to w if there is no
+// handler for it.
+func handleDetected(c *DetectorConfig, w io.Writer, text string) {
+	if isDump(text) {
+		if c.DumpHandler != nil {
+			c.DumpHandler(&Dump{Text: text, Goroutines: parseGoroutines(text, nil), Time: c.Clock.Now()})
+		} else {
+			io.WriteString(w, text)
+		}
+		return
+	}
+
+	if c.Handler == nil && c.InfoHandler == nil {
+		io.WriteString(w, text)
+		return
+	}
+	if c.Handler != nil {
+		c.Handler(text)
+	}
+	if c.InfoHandler != nil {
+		c.InfoHandler(detectedCrash(text, latestQuirks))
+	}
+}
+
+// detectedCrash describes a crash found by a Detector, or parsed by
+// ParseCompat, whose output has the given quirks.
+func detectedCrash(text string, q formatQuirks) *PanicInfo {
+	info := &PanicInfo{Text: text}
+	info.Values = parseValues(info.Text, q)
+	if len(info.Values) > 0 {
+		info.Value = info.Values[0]
+	}
+	info.Fingerprint = fingerprint(info.Text, nil)
+	info.Goroutines = parseGoroutines(info.Text, nil)
+	info.Kind = classify(info.Text, info.Value)
+	info.Severity = SeverityError
+	switch info.Kind {
+	case KindDeadlock:
+		info.Deadlock = summarizeDeadlock(info.Goroutines)
+	case KindOutOfMemory:
+		info.Memory = parseMemory(info.Text)
+	}
+
+	return info
+}
@@ -0,0 +1,93 @@
+package panicwrap
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestDetector(t *testing.T) {
+	out := new(bytes.Buffer)
+	var text string
+	var info *PanicInfo
+	d := NewDetector(out, &DetectorConfig{
+		Handler:     func(s string) { text = s },
+		InfoHandler: func(i *PanicInfo) { info = i },
+	})
+
+	d.Write([]byte("starting\n"))
+	d.Write([]byte("panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n"))
+	if err := d.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if out.String() != "starting\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+	if text != "panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n" {
+		t.Fatalf("bad: %q", text)
+	}
+	if info == nil || info.Text != text || info.Value != "boom" || info.Kind != KindPanic || info.Fingerprint == "" {
+		t.Fatalf("bad: %#v", info)
+	}
+
+	// Closing again does nothing.
+	text = ""
+	d.Close()
+	if text != "" {
+		t.Fatal("should only be handled once")
+	}
+	if _, err := d.Write([]byte("more")); err == nil {
+		t.Fatal("should fail once closed")
+	}
+}
+
+func TestDetector_noCrash(t *testing.T) {
+	out := new(bytes.Buffer)
+	called := false
+	d := NewDetector(out, &DetectorConfig{
+		Handler:        func(string) { called = true },
+		IgnorePatterns: []*regexp.Regexp{regexp.MustCompile(`^level=`)},
+	})
+
+	d.Write([]byte("level=info msg=\"panic: not really\"\n"))
+	d.Close()
+
+	if called {
+		t.Fatal("should not be a crash")
+	}
+	if out.String() != "level=info msg=\"panic: not really\"\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestDetector_noHandler(t *testing.T) {
+	out := new(bytes.Buffer)
+	d := NewDetector(out, nil)
+
+	d.Write([]byte("panic: boom\n"))
+	d.Close()
+
+	if out.String() != "panic: boom\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestDetector_dump(t *testing.T) {
+	var dump *Dump
+	called := false
+	d := NewDetector(new(bytes.Buffer), &DetectorConfig{
+		Handler:     func(string) { called = true },
+		DumpHandler: func(d *Dump) { dump = d },
+	})
+
+	d.Write([]byte(dumpHeader + "\nPC=0x0 m=0 sigcode=0\n\ngoroutine 1 [running]:\nmain.main()\n"))
+	d.Close()
+
+	if called {
+		t.Fatal("a dump isn't a crash")
+	}
+	if dump == nil || len(dump.Goroutines) != 1 {
+		t.Fatalf("bad: %#v", dump)
+	}
+}
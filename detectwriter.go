@@ -0,0 +1,185 @@
+package panicwrap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxDetectedCrash is how much of a crash a PanicDetectingWriter keeps.
+const maxDetectedCrash = 1 << 20
+
+// detectedDroppedLine ends the text of a crash that a
+// PanicDetectingWriter cut short at maxDetectedCrash.
+const detectedDroppedLine = "\n[panicwrap: %d more bytes of this crash were dropped]\n"
+
+// maxPendingLine is how much of a line a PanicDetectingWriter waits for
+// the end of before it inspects it as it is.
+const maxPendingLine = 64 << 10
+
+// PanicDetectingWriter is an io.Writer that looks for crashes in what is
+// written through it, such as a log sink, or the writer of a logger or of
+// the stderr of a command, in the process that crashes or is about to.
+// It gives the detection and the parsing of Wrap without the child
+// process, so it doesn't see the crashes the runtime prints to the stderr
+// of the process itself, only the crash output that goes through it, such
+// as a recovered panic that is logged with its stacks.
+//
+// Everything is written on to the wrapped writer as it arrives; nothing
+// is held back. What follows a panic header is taken for a crash once the
+// output went quiet for DetectDuration, if it holds the stacks of a
+// goroutine, and passed to the handlers of the configuration then, from a
+// goroutine of its own. A handler that writes the crash back through the
+// writer has it detected again.
+type PanicDetectingWriter struct {
+	w     io.Writer
+	c     *DetectorConfig
+	rules headerRules
+
+	mu sync.Mutex
+
+	// pending is the start of a line that didn't end yet.
+	pending []byte
+
+	// crash is what was tracked since the header of a crash, or nil if no
+	// crash is being tracked, and dropped is how much didn't fit in it.
+	// last is when the latest write to it happened.
+	crash   *bytes.Buffer
+	dropped int
+	last    time.Time
+}
+
+// NewPanicDetectingWriter returns a PanicDetectingWriter that writes on to
+// w. The configuration may be nil.
+func NewPanicDetectingWriter(w io.Writer, c *DetectorConfig) *PanicDetectingWriter {
+	cfg := detectorDefaults(c)
+	return &PanicDetectingWriter{w: w, c: cfg, rules: cfg.rules()}
+}
+
+// Write writes p on to the wrapped writer and looks for crashes in what
+// it took.
+func (p *PanicDetectingWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inspect(b[:n])
+
+	return n, err
+}
+
+// Flush handles the crash being tracked right away, rather than once the
+// output went quiet, such as before the process exits. It returns once
+// the handlers returned.
+func (p *PanicDetectingWriter) Flush() error {
+	p.mu.Lock()
+	text := p.finish()
+	p.mu.Unlock()
+
+	if text != "" {
+		handleDetected(p.c, io.Discard, text)
+	}
+	return nil
+}
+
+// inspect looks for crashes in the complete lines of what was written. The
+// caller holds the lock.
+func (p *PanicDetectingWriter) inspect(b []byte) {
+	if p.crash != nil {
+		p.last = p.c.Clock.Now()
+	}
+
+	p.pending = append(p.pending, b...)
+	off := 0
+	for off < len(p.pending) {
+		end := bytes.IndexByte(p.pending[off:], '\n') + 1
+		if end == 0 {
+			if len(p.pending)-off < maxPendingLine {
+				break
+			}
+			end = len(p.pending) - off
+		}
+		p.line(p.pending[off : off+end])
+		off += end
+	}
+	p.pending = append(p.pending[:0], p.pending[off:]...)
+}
+
+// line inspects a line of output. The caller holds the lock.
+func (p *PanicDetectingWriter) line(l []byte) {
+	if p.crash != nil {
+		p.capture(l)
+		return
+	}
+
+	for _, header := range panicHeaders {
+		if idx := indexHeader(l, header, p.rules, false); idx >= 0 {
+			p.crash, p.dropped = new(bytes.Buffer), 0
+			p.last = p.c.Clock.Now()
+			p.capture(l[idx:])
+			go p.watch(p.crash)
+			return
+		}
+	}
+}
+
+// capture adds to the crash being tracked what there is room for.
+func (p *PanicDetectingWriter) capture(b []byte) {
+	room := max(maxDetectedCrash-p.crash.Len(), 0)
+	if len(b) > room {
+		p.dropped += len(b) - room
+		b = b[:room]
+	}
+	p.crash.Write(b)
+}
+
+// watch handles the crash once the output went quiet, unless it was
+// flushed before.
+func (p *PanicDetectingWriter) watch(crash *bytes.Buffer) {
+	wait := p.c.DetectDuration
+	for {
+		<-p.c.Clock.After(wait)
+
+		p.mu.Lock()
+		if p.crash != crash {
+			p.mu.Unlock()
+			return
+		}
+		if idle := p.c.Clock.Now().Sub(p.last); idle < p.c.DetectDuration {
+			wait = p.c.DetectDuration - idle
+			p.mu.Unlock()
+			continue
+		}
+		text := p.finish()
+		p.mu.Unlock()
+
+		if text != "" {
+			handleDetected(p.c, io.Discard, text)
+		}
+		return
+	}
+}
+
+// finish stops tracking the crash and returns its text, or "" if there is
+// none or it doesn't hold the stacks of a goroutine. The caller holds the
+// lock.
+func (p *PanicDetectingWriter) finish() string {
+	if p.crash == nil {
+		return ""
+	}
+
+	p.capture(p.pending)
+	p.pending = p.pending[:0]
+	text := p.crash.String()
+	if p.dropped > 0 {
+		text += fmt.Sprintf(detectedDroppedLine, p.dropped)
+	}
+	p.crash = nil
+
+	if !goroutineHeaderRe.MatchString(text) {
+		return ""
+	}
+	return text
+}
@@ -0,0 +1,103 @@
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicDetectingWriter(t *testing.T) {
+	clock := newFakeClock()
+	out := new(syncBuffer)
+	infos := make(chan *PanicInfo, 1)
+	w := NewPanicDetectingWriter(out, &DetectorConfig{
+		InfoHandler: func(i *PanicInfo) { infos <- i },
+		Clock:       clock,
+	})
+
+	crash := "panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n"
+	w.Write([]byte("level=info msg=started\n"))
+	w.Write([]byte(crash[:20]))
+	<-clock.waiting
+	clock.Advance(200 * time.Millisecond)
+	w.Write([]byte(crash[20:]))
+
+	// Everything is forwarded as it arrives.
+	if out.String() != "level=info msg=started\n"+crash {
+		t.Fatalf("bad: %q", out.String())
+	}
+
+	// The output didn't go quiet for long enough yet.
+	clock.Advance(200 * time.Millisecond)
+	<-clock.waiting
+	select {
+	case <-infos:
+		t.Fatal("should wait for the output to go quiet")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	select {
+	case info := <-infos:
+		if info.Text != crash || info.Value != "boom" || info.Kind != KindPanic {
+			t.Fatalf("bad: %#v", info)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("should handle the crash")
+	}
+}
+
+func TestPanicDetectingWriter_noStacks(t *testing.T) {
+	called := false
+	w := NewPanicDetectingWriter(new(bytes.Buffer), &DetectorConfig{
+		Handler: func(string) { called = true },
+		Clock:   newFakeClock(),
+	})
+
+	w.Write([]byte("msg=\"panic: not a crash\"\nmore\n"))
+	w.Flush()
+
+	if called {
+		t.Fatal("should not be a crash without stacks")
+	}
+}
+
+func TestPanicDetectingWriter_flush(t *testing.T) {
+	var text string
+	out := new(bytes.Buffer)
+	w := NewPanicDetectingWriter(out, &DetectorConfig{
+		Handler: func(s string) { text = s },
+		Clock:   newFakeClock(),
+	})
+
+	w.Write([]byte("before\nfatal error: all goroutines are asleep - deadlock!\n\ngoroutine 1 [chan receive]:\nmain.main()"))
+	w.Flush()
+
+	if text != "fatal error: all goroutines are asleep - deadlock!\n\ngoroutine 1 [chan receive]:\nmain.main()" {
+		t.Fatalf("bad: %q", text)
+	}
+
+	// Flushing again finds nothing.
+	text = ""
+	w.Flush()
+	if text != "" {
+		t.Fatalf("bad: %q", text)
+	}
+}
+
+func TestPanicDetectingWriter_limit(t *testing.T) {
+	var text string
+	w := NewPanicDetectingWriter(new(bytes.Buffer), &DetectorConfig{
+		Handler: func(s string) { text = s },
+		Clock:   newFakeClock(),
+	})
+
+	w.Write([]byte("panic: boom\n\ngoroutine 1 [running]:\n"))
+	w.Write([]byte(strings.Repeat("x\n", maxDetectedCrash)))
+	w.Flush()
+
+	if len(text) < maxDetectedCrash || !strings.Contains(text, "more bytes of this crash were dropped") {
+		t.Fatalf("bad: %d", len(text))
+	}
+}
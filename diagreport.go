@@ -0,0 +1,92 @@
+package panicwrap
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diagnosticReportPoll is how often the parent looks for the report of
+// ReportCrash while it waits for it. See WrapConfig.DiagnosticReports.
+const diagnosticReportPoll = 500 * time.Millisecond
+
+// diagnosticReportDirs returns the directories macOS writes the reports
+// of crashed processes to: that of the user, and that of the system for
+// processes of root.
+func diagnosticReportDirs() []string {
+	dirs := []string{"/Library/Logs/DiagnosticReports"}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append([]string{filepath.Join(home, "Library", "Logs", "DiagnosticReports")}, dirs...)
+	}
+	return dirs
+}
+
+// waitDiagnosticReport waits up to WrapConfig.DiagnosticReportWait for
+// the report of the crashed child to show up in one of the directories,
+// since ReportCrash writes it a few seconds after the child died, and
+// returns its path, or "" if it didn't.
+func waitDiagnosticReport(c *WrapConfig, dirs []string, exePath string, pid int, started time.Time) string {
+	deadline := c.Clock.Now().Add(c.DiagnosticReportWait)
+	for {
+		if path := findDiagnosticReport(dirs, exePath, pid, started); path != "" {
+			return path
+		}
+		if !c.Clock.Now().Before(deadline) {
+			return ""
+		}
+		<-c.Clock.After(diagnosticReportPoll)
+	}
+}
+
+// findDiagnosticReport returns the path of the report of the process
+// among the .ips and .crash files of the directories that were written
+// since it started, or "" if there is none.
+func findDiagnosticReport(dirs []string, exePath string, pid int, started time.Time) string {
+	name := strings.TrimSuffix(filepath.Base(exePath), filepath.Ext(exePath))
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if !strings.HasPrefix(e.Name(), name+"-") || ext != ".ips" && ext != ".crash" {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil || !fi.Mode().IsRegular() || fi.ModTime().Before(started) {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if diagnosticReportOf(path, pid) {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// diagnosticReportOf returns whether the report at path is that of the
+// process, from the "pid" field of an .ips report, or the "Process:" line
+// of a .crash report.
+func diagnosticReportOf(path string, pid int) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// The process ID is near the start of both.
+	head, err := io.ReadAll(io.LimitReader(f, 64<<10))
+	if err != nil {
+		return false
+	}
+
+	p := strconv.Itoa(pid)
+	re := regexp.MustCompile(`"pid"\s*:\s*` + p + `\b|(?m)^Process:\s+.*\[` + p + `\]`)
+	return re.Match(head)
+}
@@ -0,0 +1,70 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindDiagnosticReport(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Now().Add(-time.Minute)
+	ips := `{"app_name":"server","timestamp":"2024-01-01 12:00:00.00 +0000","bug_type":"309"}
+{
+  "pid" : 4321,
+  "procName" : "server"
+}
+`
+	crash := "Process:               server [1234]\nPath:                  /usr/bin/server\n"
+	os.WriteFile(filepath.Join(dir, "server-2024-01-01-120000.ips"), []byte(ips), 0644)
+	os.WriteFile(filepath.Join(dir, "server-2024-01-01-120001.crash"), []byte(crash), 0644)
+	os.WriteFile(filepath.Join(dir, "other-2024-01-01-120000.crash"), []byte("Process: other [99]\n"), 0644)
+
+	if path := findDiagnosticReport([]string{dir}, "/usr/bin/server", 4321, started); filepath.Base(path) != "server-2024-01-01-120000.ips" {
+		t.Fatalf("should find the .ips report: %q", path)
+	}
+	if path := findDiagnosticReport([]string{"/nonexistent", dir}, "/usr/bin/server", 1234, started); filepath.Base(path) != "server-2024-01-01-120001.crash" {
+		t.Fatalf("should find the .crash report: %q", path)
+	}
+	if path := findDiagnosticReport([]string{dir}, "/usr/bin/server", 123, started); path != "" {
+		t.Fatalf("should match the whole process ID: %q", path)
+	}
+	if path := findDiagnosticReport([]string{dir}, "/usr/bin/other", 99, time.Now().Add(time.Minute)); path != "" {
+		t.Fatalf("should skip reports from before the child started: %q", path)
+	}
+}
+
+func TestWaitDiagnosticReport(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock()
+	c := &WrapConfig{Clock: clock, DiagnosticReportWait: time.Second}
+	started := time.Now().Add(-time.Minute)
+
+	result := make(chan string)
+	go func() { result <- waitDiagnosticReport(c, []string{dir}, "/usr/bin/server", 7, started) }()
+
+	<-clock.waiting
+	os.WriteFile(filepath.Join(dir, "server-2024-01-01-120000.crash"), []byte("Process: server [7]\n"), 0644)
+	clock.Advance(diagnosticReportPoll)
+
+	if path := <-result; path == "" {
+		t.Fatal("should wait for the report")
+	}
+}
+
+func TestWaitDiagnosticReport_timeout(t *testing.T) {
+	clock := newFakeClock()
+	c := &WrapConfig{Clock: clock, DiagnosticReportWait: time.Second}
+
+	result := make(chan string)
+	go func() { result <- waitDiagnosticReport(c, []string{t.TempDir()}, "/usr/bin/server", 7, time.Now()) }()
+
+	for range 2 {
+		<-clock.waiting
+		clock.Advance(diagnosticReportPoll)
+	}
+	if path := <-result; path != "" {
+		t.Fatalf("should give up: %q", path)
+	}
+}
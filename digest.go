@@ -0,0 +1,131 @@
+package panicwrap
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digest sums up the crashes of the children over a window of
+// WrapConfig.DigestWindow, so that they can be sent as a single
+// notification rather than one per crash.
+type Digest struct {
+	// Start is when the first crash of the window was handled, and End
+	// when the digest was made.
+	Start time.Time
+	End   time.Time
+
+	// Crashes is the number of crashes in the window, and Entries has
+	// them by fingerprint, in the order they were first seen.
+	Crashes int
+	Entries []DigestEntry
+}
+
+// DigestEntry is the crashes with the same fingerprint in a Digest.
+type DigestEntry struct {
+	// Fingerprint, Kind and Value are those of the crashes, see
+	// PanicInfo.
+	Fingerprint string
+	Kind        CrashKind
+	Value       string
+
+	// Count is the number of crashes with the fingerprint in the window,
+	// and First and Last when the first and last of them were handled.
+	Count int
+	First time.Time
+	Last  time.Time
+}
+
+// String formats the digest as a short message, one line per fingerprint.
+func (d *Digest) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d crashes between %s and %s\n", d.Crashes, d.Start.Format(time.RFC3339), d.End.Format(time.RFC3339))
+	for _, e := range d.Entries {
+		fmt.Fprintf(&b, "%dx %s %s: %s (first %s, last %s)\n", e.Count, e.Kind, e.Fingerprint, e.Value, e.First.Format(time.RFC3339), e.Last.Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// DigestHandlerFunc is the type called with the digest of a window of
+// crashes.
+type DigestHandlerFunc func(*Digest)
+
+// digester collects the crashes of a window into a Digest and passes it to
+// WrapConfig.DigestHandler once the window is over.
+type digester struct {
+	c    *WrapConfig
+	done func(error)
+
+	mu      sync.Mutex
+	cur     *Digest
+	entries map[string]int
+
+	stop    chan struct{}
+	stopped sync.Once
+	wg      sync.WaitGroup
+}
+
+func newDigester(c *WrapConfig, done func(error)) *digester {
+	return &digester{c: c, done: done, stop: make(chan struct{})}
+}
+
+// add adds the crash to the current window, which it starts if there is
+// none.
+func (d *digester) add(info *PanicInfo) {
+	if d.c.DigestHandler == nil {
+		return
+	}
+
+	now := d.c.Clock.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cur == nil {
+		d.cur = &Digest{Start: now}
+		d.entries = make(map[string]int)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			select {
+			case <-d.c.Clock.After(d.c.DigestWindow):
+			case <-d.stop:
+			}
+			d.flush()
+		}()
+	}
+
+	d.cur.Crashes++
+	i, ok := d.entries[info.Fingerprint]
+	if !ok {
+		i = len(d.cur.Entries)
+		d.entries[info.Fingerprint] = i
+		d.cur.Entries = append(d.cur.Entries, DigestEntry{
+			Fingerprint: info.Fingerprint,
+			Kind:        info.Kind,
+			Value:       info.Value,
+			First:       now,
+		})
+	}
+	e := &d.cur.Entries[i]
+	e.Count++
+	e.Last = now
+}
+
+// flush passes the current digest to the handler and ends the window.
+func (d *digester) flush() {
+	d.mu.Lock()
+	digest := d.cur
+	d.cur = nil
+	d.mu.Unlock()
+
+	digest.End = d.c.Clock.Now()
+	d.done(callHandler(digest.String(), func() { d.c.DigestHandler(digest) }))
+}
+
+// close cuts the current window short, if there is one, and waits for its
+// digest to be handled.
+func (d *digester) close() {
+	d.stopped.Do(func() { close(d.stop) })
+	d.wg.Wait()
+}
@@ -0,0 +1,63 @@
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigester(t *testing.T) {
+	clock := newFakeClock()
+	digests := make(chan *Digest, 2)
+	c := &WrapConfig{
+		DigestHandler: func(d *Digest) { digests <- d },
+		DigestWindow:  time.Minute,
+		Clock:         clock,
+	}
+	d := newDigester(c, func(error) {})
+
+	start := clock.Now()
+	d.add(&PanicInfo{Fingerprint: "a", Kind: KindPanic, Value: "boom"})
+	<-clock.waiting
+	clock.Advance(time.Second)
+	d.add(&PanicInfo{Fingerprint: "b", Kind: KindDeadlock})
+	clock.Advance(time.Second)
+	d.add(&PanicInfo{Fingerprint: "a", Kind: KindPanic, Value: "boom"})
+	clock.Advance(time.Minute)
+
+	digest := <-digests
+	if digest.Crashes != 3 || !digest.Start.Equal(start) || len(digest.Entries) != 2 {
+		t.Fatalf("bad: %#v", digest)
+	}
+	e := digest.Entries[0]
+	if e.Fingerprint != "a" || e.Count != 2 || !e.First.Equal(start) || !e.Last.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("bad: %#v", e)
+	}
+	if !strings.Contains(digest.String(), "2x panic a: boom") {
+		t.Fatalf("bad: %q", digest.String())
+	}
+
+	// The next crash starts a new window, which close cuts short.
+	d.add(&PanicInfo{Fingerprint: "b", Kind: KindDeadlock})
+	d.close()
+	if digest := <-digests; digest.Crashes != 1 || digest.Entries[0].Fingerprint != "b" {
+		t.Fatalf("bad: %#v", digest)
+	}
+}
+
+func TestWrap_digestHandler(t *testing.T) {
+	var digest *Digest
+	_, _, err := Wrap(&WrapConfig{
+		DigestHandler: func(d *Digest) { digest = d },
+		Writer:        new(bytes.Buffer),
+		Executor:      &fakeExecutor{stderr: []string{testPanicText}, exit: ProcessExit{Status: 2}},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if digest == nil || digest.Crashes != 1 || digest.Entries[0].Value != "runtime error: index out of range [5] with length 3" {
+		t.Fatalf("bad: %#v", digest)
+	}
+}
@@ -0,0 +1,69 @@
+package panicwrap
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Drain writes out the output of the child that the parent of the running
+// Wrap call holds back, and waits until it reached its destinations. This
+// is the line that hasn't ended yet with WrapConfig.JSONLines, and what
+// the writers of the configuration buffer if they have a Flush method,
+// such as a bufio.Writer used as a Sink.
+//
+// Wrap already drains the output once a child exited, before calling the
+// handlers and before returning. Drain is for parents that exit by other
+// means while the child runs, such as calling os.Exit from a signal
+// handler. A line drained while the child is still writing it is split
+// in two. If the output doesn't drain within the timeout, an error is
+// returned.
+func Drain(timeout time.Duration) error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	return ch.drain(timeout)
+}
+
+// outputWriters returns the writers of the configuration given by the
+// user, which may buffer output. It must be called before Wrap wraps them
+// in its own writers.
+func outputWriters(c *WrapConfig) []io.Writer {
+	ws := []io.Writer{c.Stdout, c.Writer, c.PanicWriter}
+	for _, sinks := range [][]Sink{c.StdoutSinks, c.StderrSinks, c.PanicSinks} {
+		for _, s := range sinks {
+			ws = append(ws, s.Writer)
+		}
+	}
+
+	return ws
+}
+
+// drainOutput flushes the given writers in order, so the outermost ones
+// must come first for the output to make its way through all of them.
+// Flushing goes on in the background when the timeout expires.
+func drainOutput(ws []io.Writer, timeout time.Duration, clock Clock) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, w := range ws {
+			switch f := w.(type) {
+			case interface{ flush() }:
+				f.flush()
+			case interface{ Flush() error }:
+				f.Flush()
+			case interface{ Flush() }:
+				f.Flush()
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-clock.After(timeout):
+		return errors.New("panicwrap: timed out draining the output")
+	}
+}
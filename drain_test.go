@@ -0,0 +1,74 @@
+package panicwrap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainOutput(t *testing.T) {
+	out := new(bytes.Buffer)
+	buffered := bufio.NewWriter(out)
+	w := newJSONLineWriter(buffered, "stderr")
+	w.Write([]byte("unfinished"))
+
+	if err := drainOutput([]io.Writer{w, buffered}, time.Second, realClock{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(out.String(), `"line":"unfinished"}`) {
+		t.Fatalf("bad: %#v", out.String())
+	}
+}
+
+type blockingFlusher struct {
+	bytes.Buffer
+	unblock chan struct{}
+}
+
+func (f *blockingFlusher) Flush() error {
+	<-f.unblock
+	return nil
+}
+
+func TestDrainOutput_timeout(t *testing.T) {
+	f := &blockingFlusher{unblock: make(chan struct{})}
+	defer close(f.unblock)
+
+	clock := newFakeClock()
+	go func() {
+		<-clock.waiting
+		clock.Advance(time.Minute)
+	}()
+
+	if err := drainOutput([]io.Writer{f}, time.Minute, clock); err == nil {
+		t.Fatal("should time out")
+	}
+}
+
+func TestDrain_notWrapping(t *testing.T) {
+	if err := Drain(time.Second); err == nil {
+		t.Fatal("should fail without a child")
+	}
+}
+
+func TestWrap_drainStdout(t *testing.T) {
+	out := new(bytes.Buffer)
+	e := &fakeExecutor{stdout: []string{"hello\n", "unfinished"}}
+
+	_, _, err := Wrap(&WrapConfig{
+		Handler:  func(string) {},
+		Stdout:   bufio.NewWriter(out),
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if out.String() != "hello\nunfinished" {
+		t.Fatalf("bad: %#v", out.String())
+	}
+}
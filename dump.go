@@ -0,0 +1,88 @@
+package panicwrap
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// dumpHeader is the banner the runtime prints before the goroutine dump it
+// writes when it receives SIGQUIT.
+const dumpHeader = "SIGQUIT: quit"
+
+// Dump is a goroutine dump that the child printed because it received
+// SIGQUIT, usually because an operator asked for it. Dumps are diagnostics
+// rather than crashes, so they are passed to WrapConfig.DumpHandler instead
+// of the panic handlers.
+type Dump struct {
+	// Text is the raw dump output.
+	Text string
+
+	// Goroutines are the parsed goroutine stacks of the dump.
+	Goroutines []Goroutine
+
+	// PID is the process ID of the child that printed the dump and Time
+	// is when the parent captured it.
+	PID  int
+	Time time.Time
+}
+
+// DumpHandlerFunc is the type called when the child prints a goroutine
+// dump.
+type DumpHandlerFunc func(*Dump)
+
+// isDump returns whether the text detected by trackPanic is a goroutine
+// dump rather than a crash.
+func isDump(text string) bool {
+	return strings.HasPrefix(text, dumpHeader)
+}
+
+// handleDump mirrors the dump to the configured writer, even with
+// HidePanic set since it was asked for, unless it was streamed there
+// already, and passes it on to the DumpHandler and DumpStacks.
+func handleDump(c *WrapConfig, ch *child, d *Dump, streamed bool) error {
+	if !streamed {
+		c.Writer.Write([]byte(d.Text))
+	}
+
+	d.Goroutines = parseGoroutines(d.Text, newPathTrimmer(c, d.Text))
+	ch.deliverDump(d)
+	if c.DumpHandler == nil {
+		return nil
+	}
+
+	return callHandler(d.Text, func() { c.DumpHandler(d) })
+}
+
+// activeChild is the child of the Wrap call that is currently running in
+// this process, if any. Like Wrapped(nil), this is process-global, which
+// lets other parts of the parent, such as a status endpoint, reach the
+// child without having access to the WrapConfig.
+var activeChild atomic.Pointer[child]
+
+// DumpStacks asks the running child for a goroutine dump and returns it.
+//
+// The dump is requested by sending the child SIGQUIT. The Go runtime exits
+// after printing the dump, so the child stops running: supervision goes on
+// as usual, which means it is restarted if WrapConfig.Restart allows it.
+// If the child doesn't exit with a dump within the timeout, an error is
+// returned. This isn't supported on Windows, which has no SIGQUIT.
+func DumpStacks(timeout time.Duration) (*Dump, error) {
+	ch := activeChild.Load()
+	if ch == nil {
+		return nil, errors.New("panicwrap: not wrapping a child")
+	}
+
+	dumpCh := ch.waitDump()
+	if err := ch.send(quitSignal); err != nil {
+		return nil, err
+	}
+
+	select {
+	case d := <-dumpCh:
+		return d, nil
+	case <-time.After(timeout):
+		return nil, errors.New("panicwrap: timed out waiting for the goroutine dump")
+	}
+}
@@ -0,0 +1,34 @@
+package panicwrap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDumpStacks_notWrapping(t *testing.T) {
+	if _, err := DumpStacks(time.Second); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestChild_deliverDump(t *testing.T) {
+	ch := new(child)
+	w1 := ch.waitDump()
+	w2 := ch.waitDump()
+
+	d := &Dump{PID: 42}
+	ch.deliverDump(d)
+	if <-w1 != d || <-w2 != d {
+		t.Fatal("should deliver to every waiter")
+	}
+
+	// Nobody is waiting anymore, so this must not block.
+	ch.deliverDump(d)
+}
+
+func TestChild_send(t *testing.T) {
+	ch := new(child)
+	if err := ch.send(nil); err == nil {
+		t.Fatal("should error without a child")
+	}
+}
@@ -0,0 +1,117 @@
+package panicwrap
+
+import (
+	"io"
+	"sync"
+	"unicode/utf16"
+)
+
+// The values of WrapConfig.StderrEncoding.
+const (
+	// EncodingUTF16LE decodes the stderr of the child from UTF-16LE, as
+	// some Windows programs and injected DLLs write it.
+	EncodingUTF16LE = "utf-16le"
+
+	// EncodingOEM decodes the stderr of the child from the OEM code page
+	// of the console. This is only supported on Windows.
+	EncodingOEM = "oem"
+
+	// EncodingAuto decodes the stderr of the child from UTF-16LE if it
+	// starts with a byte order mark or an ASCII character in UTF-16LE,
+	// and leaves it alone otherwise.
+	EncodingAuto = "auto"
+)
+
+// validEncoding reports whether the encoding is a valid
+// WrapConfig.StderrEncoding on this platform.
+func validEncoding(encoding string) bool {
+	switch encoding {
+	case EncodingUTF16LE, EncodingAuto:
+		return true
+	case EncodingOEM:
+		return oemSupported
+	default:
+		return false
+	}
+}
+
+// decodingWriter decodes what is written through it to UTF-8. Characters
+// may span several writes, so the bytes of an incomplete one are held
+// back until the next write.
+type decodingWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	encoding string
+	started  bool
+	buf      []byte
+}
+
+func newDecodingWriter(w io.Writer, encoding string) *decodingWriter {
+	return &decodingWriter{w: w, encoding: encoding}
+}
+
+func (d *decodingWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data := append(d.buf, p...)
+	d.buf = nil
+
+	first := !d.started
+	if first {
+		// Both detecting the encoding and dropping a byte order mark need
+		// the first two bytes.
+		if len(data) < 2 {
+			d.buf = data
+			return len(p), nil
+		}
+		d.started = true
+
+		if d.encoding == EncodingAuto {
+			d.encoding = ""
+			if data[0] == 0xff && data[1] == 0xfe || data[0] != 0 && data[1] == 0 {
+				d.encoding = EncodingUTF16LE
+			}
+		}
+	}
+
+	var out []byte
+	switch d.encoding {
+	case EncodingUTF16LE:
+		out, d.buf = decodeUTF16LE(data, first)
+	case EncodingOEM:
+		out, d.buf = decodeOEM(data)
+	default:
+		out = data
+	}
+
+	if len(out) > 0 {
+		if _, err := d.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// decodeUTF16LE decodes the given UTF-16LE data and returns the bytes at
+// its end that don't make up a whole character yet. A byte order mark at
+// the start is dropped.
+func decodeUTF16LE(data []byte, start bool) (out, rest []byte) {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+	}
+
+	n := len(units) * 2
+	if len(units) > 0 && utf16.IsSurrogate(rune(units[len(units)-1])) && units[len(units)-1] < 0xdc00 {
+		// The second half of the surrogate pair is yet to come.
+		units = units[:len(units)-1]
+		n -= 2
+	}
+	if start && len(units) > 0 && units[0] == 0xfeff {
+		units = units[1:]
+	}
+
+	return []byte(string(utf16.Decode(units))), data[n:]
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package panicwrap
+
+const oemSupported = false
+
+func decodeOEM(data []byte) (out, rest []byte) {
+	return data, nil
+}
@@ -0,0 +1,105 @@
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func TestDecodingWriter_utf16(t *testing.T) {
+	data := append([]byte{0xff, 0xfe}, utf16le("panic: 💥 é\n")...)
+
+	// Every split must decode the same, including ones in the middle of
+	// a code unit or a surrogate pair.
+	for i := 1; i < len(data); i++ {
+		out := new(bytes.Buffer)
+		w := newDecodingWriter(out, EncodingUTF16LE)
+		w.Write(data[:i])
+		w.Write(data[i:])
+
+		if out.String() != "panic: 💥 é\n" {
+			t.Fatalf("%d: bad: %#v", i, out.String())
+		}
+	}
+}
+
+func TestDecodingWriter_auto(t *testing.T) {
+	cases := []struct {
+		input    []byte
+		expected string
+	}{
+		{utf16le("panic: boom\n"), "panic: boom\n"},
+		{append([]byte{0xff, 0xfe}, utf16le("hi")...), "hi"},
+		{[]byte("panic: boom\n"), "panic: boom\n"},
+	}
+
+	for _, tc := range cases {
+		out := new(bytes.Buffer)
+		newDecodingWriter(out, EncodingAuto).Write(tc.input)
+
+		if out.String() != tc.expected {
+			t.Fatalf("bad: %#v, want %#v", out.String(), tc.expected)
+		}
+	}
+}
+
+func TestWrap_stderrEncoding(t *testing.T) {
+	var info *PanicInfo
+	e := &fakeExecutor{
+		stderr: []string{string(utf16le("starting\npanic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"))},
+		exit:   ProcessExit{Status: 2},
+	}
+	stderr := new(bytes.Buffer)
+
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler:    func(i *PanicInfo) { info = i },
+		Writer:         stderr,
+		StderrEncoding: EncodingUTF16LE,
+		Executor:       e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if info == nil || info.Value != "boom" {
+		t.Fatalf("bad: %#v", info)
+	}
+	if !strings.HasPrefix(stderr.String(), "starting\n") {
+		t.Fatalf("bad: %#v", stderr.String())
+	}
+}
+
+func TestWrap_invalidStderrEncoding(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:        func(string) {},
+		StderrEncoding: "latin1",
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestReplay_stderrEncoding(t *testing.T) {
+	var text string
+	err := Replay(bytes.NewReader(utf16le("panic: boom\n\ngoroutine 1 [running]:\n")), &WrapConfig{
+		Handler:        func(s string) { text = s },
+		Writer:         new(bytes.Buffer),
+		StderrEncoding: EncodingUTF16LE,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.HasPrefix(text, "panic: boom\n") {
+		t.Fatalf("bad: %#v", text)
+	}
+}
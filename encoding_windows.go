@@ -0,0 +1,52 @@
+package panicwrap
+
+import (
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+const oemSupported = true
+
+var (
+	procMultiByteToWideChar = syscall.NewLazyDLL("kernel32.dll").NewProc("MultiByteToWideChar")
+	procIsDBCSLeadByteEx    = syscall.NewLazyDLL("kernel32.dll").NewProc("IsDBCSLeadByteEx")
+)
+
+// cpOEMCP is CP_OEMCP, the OEM code page of the system.
+const cpOEMCP = 1
+
+// decodeOEM decodes the given data from the OEM code page and returns the
+// lead byte at its end if the code page uses two bytes for it.
+func decodeOEM(data []byte) (out, rest []byte) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	// Trail bytes may look like lead bytes, so the characters are walked
+	// from the start.
+	for i := 0; i < len(data); i++ {
+		if r, _, _ := procIsDBCSLeadByteEx.Call(cpOEMCP, uintptr(data[i])); r == 0 {
+			continue
+		}
+		if i == len(data)-1 {
+			data, rest = data[:i], data[i:]
+			break
+		}
+		i++
+	}
+	if len(data) == 0 {
+		return nil, rest
+	}
+
+	wide := make([]uint16, len(data))
+	n, _, _ := procMultiByteToWideChar.Call(cpOEMCP, 0,
+		uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)),
+		uintptr(unsafe.Pointer(&wide[0])), uintptr(len(wide)))
+	if n == 0 {
+		// Pass on what can't be decoded rather than losing it.
+		return data, rest
+	}
+
+	return []byte(string(utf16.Decode(wide[:n]))), rest
+}
@@ -0,0 +1,59 @@
+package panicwrap
+
+import (
+	"io"
+	"os"
+)
+
+// An Encrypter encrypts the crash files the parent writes. See
+// WrapConfig.Encrypter. The panicwrapage module has one for age
+// recipients.
+type Encrypter interface {
+	// Encrypt returns a writer that writes what is written to it to w,
+	// encrypted. Closing it writes the rest, but doesn't close w.
+	Encrypt(w io.Writer) (io.WriteCloser, error)
+
+	// Suffix is appended to the names of the encrypted files, such as
+	// ".age".
+	Suffix() string
+}
+
+// encryptFile encrypts the file at the given path to the same path with
+// the suffix of the Encrypter, and removes it. It returns the path of the
+// encrypted file. If it fails, the file is left as it is.
+func encryptFile(path string, e Encrypter) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dstPath := path + e.Suffix()
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	err = writeEncrypted(dst, src, e)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+		return "", err
+	}
+
+	return dstPath, os.Remove(path)
+}
+
+// writeEncrypted writes what it reads from r to w encrypted.
+func writeEncrypted(w io.Writer, r io.Reader, e Encrypter) error {
+	enc, err := e.Encrypt(w)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(enc, r); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
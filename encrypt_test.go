@@ -0,0 +1,99 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// xorEncrypter stands in for a real Encrypter: it flips the bits of what
+// is written after a header, or fails if err is set.
+type xorEncrypter struct {
+	err error
+}
+
+func (e *xorEncrypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	if _, err := io.WriteString(w, "xor\n"); err != nil {
+		return nil, err
+	}
+	return &xorWriter{w}, nil
+}
+
+func (e *xorEncrypter) Suffix() string { return ".xor" }
+
+type xorWriter struct {
+	w io.Writer
+}
+
+func (x *xorWriter) Write(p []byte) (int, error) {
+	return x.w.Write(xorBytes(p))
+}
+
+func (x *xorWriter) Close() error { return nil }
+
+func xorBytes(p []byte) []byte {
+	out := make([]byte, len(p))
+	for i, b := range p {
+		out[i] = ^b
+	}
+	return out
+}
+
+// xorDecrypt is the inverse of xorEncrypter.
+func xorDecrypt(data []byte) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(data, []byte("xor\n"))
+	if !ok {
+		return nil, errors.New("bad header")
+	}
+	return xorBytes(rest), nil
+}
+
+func TestEncryptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "core.app.42")
+	if err := os.WriteFile(path, []byte("memory"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	encrypted, err := encryptFile(path, &xorEncrypter{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if encrypted != path+".xor" {
+		t.Fatalf("bad: %s", encrypted)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("should remove the plain file: %v", err)
+	}
+
+	fi, err := os.Stat(encrypted)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+	data, _ := os.ReadFile(encrypted)
+	if decrypted, err := xorDecrypt(data); err != nil || string(decrypted) != "memory" {
+		t.Fatalf("bad: %q, %v", decrypted, err)
+	}
+}
+
+func TestEncryptFile_fails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "core.app.42")
+	if err := os.WriteFile(path, []byte("memory"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := encryptFile(path, &xorEncrypter{err: errors.New("no entropy")}); err == nil {
+		t.Fatal("should fail")
+	}
+	if _, err := os.Stat(path + ".xor"); !os.IsNotExist(err) {
+		t.Fatalf("should remove the encrypted file: %v", err)
+	}
+}
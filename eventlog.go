@@ -0,0 +1,128 @@
+package panicwrap
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// EventLogConfig writes the crashes of the child to the Application event
+// log of Windows, where Windows fleets are monitored. Each crash is one
+// event, with an ID for its kind and a type for its severity: critical
+// and error crashes are errors, warnings are warnings and the rest are
+// information. See WrapConfig.EventLog.
+//
+// The source is registered with EventCreate.exe as its message file, as
+// the eventcreate command does, the first time it is used, which needs
+// the parent to run as an administrator. Events of a source that isn't
+// registered are still written, but Event Viewer doesn't show their
+// message without a note that its description can't be found.
+type EventLogConfig struct {
+	// Source is the name the events are written under. Defaults to the
+	// name of the executable without its extension.
+	Source string
+
+	// EventIDs are the event IDs of the kinds of crashes, which must be
+	// between 1 and 1000 for EventCreate.exe. The kinds that aren't set
+	// default to 1 for KindPanic, 2 for KindFatal, 3 for KindDeadlock,
+	// 4 for KindOutOfMemory, 5 for KindStartup, 6 for KindSignal, 7 for
+	// KindOOMKill and 100 for any other kind.
+	EventIDs map[CrashKind]uint32
+
+	// MaxMessage is the most characters of the message of an event,
+	// beyond which the crash text in it is cut short. Defaults to 31839,
+	// the most the event log takes.
+	MaxMessage int
+}
+
+// defaultEventIDs are the event IDs of EventLogConfig.EventIDs.
+var defaultEventIDs = map[CrashKind]uint32{
+	KindPanic:       1,
+	KindFatal:       2,
+	KindDeadlock:    3,
+	KindOutOfMemory: 4,
+	KindStartup:     5,
+	KindSignal:      6,
+	KindOOMKill:     7,
+}
+
+// otherEventID is the event ID of the kinds of crashes that have none.
+const otherEventID = 100
+
+// maxEventMessage is the most characters of a string ReportEvent takes.
+const maxEventMessage = 31839
+
+// eventSource returns the source of the events, given the path of the
+// executable.
+func (e *EventLogConfig) eventSource(exePath string) string {
+	if e.Source != "" {
+		return e.Source
+	}
+	base := filepath.Base(exePath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// eventID returns the event ID of a crash of the given kind.
+func (e *EventLogConfig) eventID(kind CrashKind) uint32 {
+	if id, ok := e.EventIDs[kind]; ok {
+		return id
+	}
+	if id, ok := defaultEventIDs[kind]; ok {
+		return id
+	}
+	return otherEventID
+}
+
+// eventMessage returns the message of the event of a crash: a line that
+// says what crashed, and the crash text, cut short to fit.
+func (e *EventLogConfig) eventMessage(info *PanicInfo) string {
+	max := e.MaxMessage
+	if max == 0 {
+		max = maxEventMessage
+	}
+
+	msg := crashHeadline(info) + "\r\n\r\n" + strings.ReplaceAll(info.Text, "\n", "\r\n")
+
+	return truncate(max-len("..."), msg)
+}
+
+// crashHeadline returns a line that says what crashed, such as "panic of
+// server, process 12, worker 2, run 0f3c".
+func crashHeadline(info *PanicInfo) string {
+	head := fmt.Sprintf("%s of %s, process %d", info.Kind, filepath.Base(info.Executable), info.PID)
+	if info.Worker > 0 {
+		head += fmt.Sprintf(", worker %d", info.Worker)
+	}
+	if info.RunID != "" {
+		head += ", run " + info.RunID
+	}
+	return head
+}
+
+// writeEventLog writes the crash to the event log of WrapConfig.EventLog.
+func writeEventLog(c *WrapConfig, info *PanicInfo) {
+	e := c.EventLog
+	err := reportEvent(e.eventSource(info.Executable), eventType(info.Severity), e.eventID(info.Kind), e.eventMessage(info))
+	if err != nil {
+		reportInternal(c, "writing to the event log", err)
+	}
+}
+
+// The types of events.
+const (
+	eventError       = 0x1
+	eventWarning     = 0x2
+	eventInformation = 0x4
+)
+
+// eventType returns the type of the event of a crash of the severity.
+func eventType(s Severity) uint16 {
+	switch s {
+	case SeverityCritical, SeverityError, "":
+		return eventError
+	case SeverityWarning:
+		return eventWarning
+	default:
+		return eventInformation
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package panicwrap
+
+import "errors"
+
+func reportEvent(string, uint16, uint32, string) error {
+	return errors.New("panicwrap: EventLog is only supported on Windows")
+}
@@ -0,0 +1,64 @@
+package panicwrap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEventLogConfig_eventSource(t *testing.T) {
+	e := &EventLogConfig{}
+	if s := e.eventSource(`C:\app\server.exe`); s != "server" && s != `C:\app\server` {
+		t.Fatalf("bad: %q", s)
+	}
+	if s := e.eventSource("/usr/bin/server"); s != "server" {
+		t.Fatalf("bad: %q", s)
+	}
+
+	e.Source = "Payments"
+	if s := e.eventSource("/usr/bin/server"); s != "Payments" {
+		t.Fatalf("bad: %q", s)
+	}
+}
+
+func TestEventLogConfig_eventID(t *testing.T) {
+	e := &EventLogConfig{EventIDs: map[CrashKind]uint32{KindDeadlock: 42}}
+
+	for kind, want := range map[CrashKind]uint32{
+		KindPanic:    1,
+		KindDeadlock: 42,
+		KindSignal:   6,
+		KindOOMKill:  7,
+		"other":      otherEventID,
+	} {
+		if id := e.eventID(kind); id != want {
+			t.Fatalf("%s: got %d, want %d", kind, id, want)
+		}
+	}
+}
+
+func TestEventLogConfig_eventMessage(t *testing.T) {
+	info := &PanicInfo{Kind: KindPanic, Executable: "/usr/bin/server", PID: 12, Worker: 2, RunID: "abc", Text: "panic: boom\n\ngoroutine 1 [running]:\n"}
+
+	msg := (&EventLogConfig{}).eventMessage(info)
+	if msg != "panic of server, process 12, worker 2, run abc\r\n\r\npanic: boom\r\n\r\ngoroutine 1 [running]:\r\n" {
+		t.Fatalf("bad: %q", msg)
+	}
+
+	msg = (&EventLogConfig{MaxMessage: 30}).eventMessage(info)
+	if len(msg) != 30 || !strings.HasSuffix(msg, "...") {
+		t.Fatalf("should be cut short: %q", msg)
+	}
+}
+
+func TestEventType(t *testing.T) {
+	for s, want := range map[Severity]uint16{
+		SeverityCritical: eventError,
+		SeverityError:    eventError,
+		SeverityWarning:  eventWarning,
+		SeverityInfo:     eventInformation,
+	} {
+		if typ := eventType(s); typ != want {
+			t.Fatalf("%s: got %d, want %d", s, typ, want)
+		}
+	}
+}
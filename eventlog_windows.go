@@ -0,0 +1,107 @@
+package panicwrap
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procRegisterEventSourceW  = syscall.NewLazyDLL("advapi32.dll").NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = syscall.NewLazyDLL("advapi32.dll").NewProc("DeregisterEventSource")
+	procReportEventW          = syscall.NewLazyDLL("advapi32.dll").NewProc("ReportEventW")
+	procRegCreateKeyExW       = syscall.NewLazyDLL("advapi32.dll").NewProc("RegCreateKeyExW")
+	procRegSetValueExW        = syscall.NewLazyDLL("advapi32.dll").NewProc("RegSetValueExW")
+)
+
+// eventSourceKey is the registry key under HKEY_LOCAL_MACHINE that the
+// sources of the Application event log are registered under.
+const eventSourceKey = `SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+
+// eventCreateMessageFile is the message file of the registered sources,
+// whose messages 1 to 1000 are the string they are written with.
+const eventCreateMessageFile = `%SystemRoot%\System32\EventCreate.exe`
+
+// regCreatedNewKey is the REG_CREATED_NEW_KEY disposition of
+// RegCreateKeyExW.
+const regCreatedNewKey = 1
+
+// registeredEventSources are the sources that reportEvent tried to
+// register.
+var registeredEventSources sync.Map
+
+// reportEvent writes an event with the message to the Application event
+// log, registering its source first if it isn't yet.
+func reportEvent(source string, typ uint16, id uint32, msg string) error {
+	if _, done := registeredEventSources.LoadOrStore(source, true); !done {
+		// Without the rights to register it, the events are still
+		// written.
+		registerEventSource(source)
+	}
+
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return err
+	}
+	h, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if h == 0 {
+		return err
+	}
+	defer procDeregisterEventSource.Call(h)
+
+	text, err := syscall.UTF16PtrFromString(msg)
+	if err != nil {
+		return err
+	}
+	strs := []*uint16{text}
+	if ok, _, err := procReportEventW.Call(h, uintptr(typ), 0, uintptr(id), 0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0); ok == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// registerEventSource registers the source with EventCreate.exe as its
+// message file, unless it is registered already.
+func registerEventSource(source string) error {
+	path, err := syscall.UTF16PtrFromString(eventSourceKey + source)
+	if err != nil {
+		return err
+	}
+
+	var key syscall.Handle
+	var disposition uint32
+	if r, _, _ := procRegCreateKeyExW.Call(uintptr(syscall.HKEY_LOCAL_MACHINE), uintptr(unsafe.Pointer(path)), 0, 0, 0, syscall.KEY_WRITE, 0, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(&disposition))); r != 0 {
+		return syscall.Errno(r)
+	}
+	defer syscall.RegCloseKey(key)
+	if disposition != regCreatedNewKey {
+		return nil
+	}
+
+	if err := setRegistryString(key, "EventMessageFile", eventCreateMessageFile); err != nil {
+		return err
+	}
+	types := uint32(eventError | eventWarning | eventInformation)
+	name, _ := syscall.UTF16PtrFromString("TypesSupported")
+	if r, _, _ := procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(name)), 0, syscall.REG_DWORD, uintptr(unsafe.Pointer(&types)), unsafe.Sizeof(types)); r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+// setRegistryString sets a REG_EXPAND_SZ value of the key.
+func setRegistryString(key syscall.Handle, name, value string) error {
+	n, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	v, err := syscall.UTF16FromString(value)
+	if err != nil {
+		return err
+	}
+	if r, _, _ := procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(n)), 0, syscall.REG_EXPAND_SZ, uintptr(unsafe.Pointer(&v[0])), uintptr(len(v)*2)); r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package panicwrap
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventChildStarted is sent once a child started.
+	EventChildStarted EventType = "child-started"
+
+	// EventPanicDetected is sent once a crash was detected and analyzed,
+	// before its handlers are called. Panic is set.
+	EventPanicDetected EventType = "panic-detected"
+
+	// EventHandlerFinished is sent once the handlers of a crash or a
+	// goroutine dump returned. Panic or Dump is set, and Err if a
+	// handler panicked.
+	EventHandlerFinished EventType = "handler-finished"
+
+	// EventChildExited is sent once a child exited. ExitStatus is set.
+	EventChildExited EventType = "child-exited"
+
+	// EventRestartScheduled is sent once a child that exited is going to
+	// be restarted. Backoff is set.
+	EventRestartScheduled EventType = "restart-scheduled"
+
+	// EventSubprocessCrashed is sent once a process the child started
+	// with StartSubprocess crashed. Panic is set, and PID is the process
+	// ID of the subprocess.
+	EventSubprocessCrashed EventType = "subprocess-crashed"
+)
+
+// eventBuffer is the number of events an Events channel holds.
+const eventBuffer = 64
+
+// Event is something that happened to the children of Wrap. See Events.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Worker is the index of the worker, and PID and RunID identify the
+	// child. They aren't set for a crash of InjectCrash.
+	Worker int
+	PID    int
+	RunID  string
+
+	// ExitStatus is the exit status of the child, for
+	// EventChildExited.
+	ExitStatus int
+
+	// Panic is the crash, for EventPanicDetected and
+	// EventHandlerFinished, and Dump the goroutine dump, for
+	// EventHandlerFinished. Err is the *HandlerPanicError of a handler
+	// that panicked.
+	Panic *PanicInfo
+	Dump  *Dump
+	Err   error
+
+	// Backoff is how long the parent waits before it restarts the
+	// child, for EventRestartScheduled.
+	Backoff time.Duration
+}
+
+// Events returns a channel on which the events of Wrap in this process
+// are sent from now on, until it is passed to StopEvents. It can be
+// called before Wrap, so that no event is missed. Events are sent
+// without blocking the parent: if the channel is full, they are dropped,
+// so it should be read from continuously.
+func Events() <-chan Event {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+
+	ch := make(chan Event, eventBuffer)
+	eventSubs = append(eventSubs, ch)
+	return ch
+}
+
+// StopEvents stops sending events on a channel returned by Events, and
+// closes it.
+func StopEvents(events <-chan Event) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+
+	for i, ch := range eventSubs {
+		if ch == events {
+			eventSubs = append(eventSubs[:i], eventSubs[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// The channels of Events, guarded by eventMu.
+var (
+	eventMu   sync.Mutex
+	eventSubs []chan Event
+)
+
+// emit sends the event to every channel of Events that has room for it.
+func emit(e Event) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+
+	for _, ch := range eventSubs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
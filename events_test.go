@@ -0,0 +1,66 @@
+package panicwrap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	events := Events()
+	defer StopEvents(events)
+
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:  func(string) {},
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+		Restart:  &RestartPolicy{MaxRestarts: 1, Backoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var types []EventType
+	for len(events) > 0 {
+		ev := <-events
+		if ev.PID != 4242 || ev.RunID == "" {
+			t.Fatalf("bad: %#v", ev)
+		}
+		switch ev.Type {
+		case EventChildExited:
+			if ev.ExitStatus != 2 {
+				t.Fatalf("bad: %#v", ev)
+			}
+		case EventPanicDetected, EventHandlerFinished:
+			if ev.Panic == nil || ev.Panic.Value != "boom" || ev.Err != nil {
+				t.Fatalf("bad: %#v", ev)
+			}
+		case EventRestartScheduled:
+			if ev.Backoff != time.Millisecond {
+				t.Fatalf("bad: %#v", ev)
+			}
+		}
+		types = append(types, ev.Type)
+	}
+
+	crash := []EventType{EventChildStarted, EventChildExited, EventPanicDetected, EventHandlerFinished}
+	expected := append(append(append([]EventType(nil), crash...), EventRestartScheduled), crash...)
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("bad: %v", types)
+	}
+}
+
+func TestStopEvents(t *testing.T) {
+	events := Events()
+	StopEvents(events)
+	emit(Event{Type: EventChildStarted})
+
+	if _, ok := <-events; ok {
+		t.Fatal("should be closed")
+	}
+}
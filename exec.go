@@ -0,0 +1,89 @@
+package panicwrap
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Executor starts the child processes. The default, used if
+// WrapConfig.Executor is nil, runs the command with os/exec. Replacing it
+// lets tests simulate children, such as ones that fail to start, are
+// killed by a signal or write a panic in pieces, without forking.
+type Executor interface {
+	// Start starts the given command, which is fully set up to run the
+	// child, including its environment, standard streams and extra
+	// files.
+	Start(cmd *exec.Cmd) (Process, error)
+}
+
+// Process is a child process started by an Executor.
+type Process interface {
+	// Pid returns the process ID.
+	Pid() int
+
+	// Signal sends the signal to the process.
+	Signal(os.Signal) error
+
+	// Wait waits for the process to exit, and for all of its output to
+	// be written to the writers of the command. An error is only
+	// returned if waiting itself failed, not for non-zero exit statuses.
+	Wait() (ProcessExit, error)
+}
+
+// ProcessExit describes how a Process exited.
+type ProcessExit struct {
+	// Status is the exit status, or -1 if the process was killed by a
+	// signal.
+	Status int
+
+	// Signal is the number of the signal that killed the process, or 0
+	// if it exited by itself.
+	Signal int
+
+	// CoreDumped is whether the process dumped a core file.
+	CoreDumped bool
+}
+
+// execExecutor is the default Executor.
+type execExecutor struct{}
+
+func (execExecutor) Start(cmd *exec.Cmd) (Process, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return execProcess{cmd}, nil
+}
+
+type execProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p execProcess) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+func (p execProcess) Signal(s os.Signal) error {
+	return signalProcess(p.cmd.Process, s)
+}
+
+func (p execProcess) Wait() (ProcessExit, error) {
+	err := p.cmd.Wait()
+
+	// Once the process was waited for, its exit status is all that
+	// matters. Failing to copy its output, which is returned otherwise,
+	// is reported by the writers.
+	state := p.cmd.ProcessState
+	if state == nil {
+		// This is some other kind of subprocessing error.
+		return ProcessExit{}, err
+	}
+
+	exit := ProcessExit{Status: state.ExitCode()}
+	if status, ok := state.Sys().(interface{ CoreDump() bool }); ok {
+		exit.CoreDumped = status.CoreDump()
+	}
+	exit.Signal = exitSignal(state)
+
+	return exit, nil
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package panicwrap
+
+import "os"
+
+// exitSignal returns 0, since processes aren't killed by signals here.
+func exitSignal(state *os.ProcessState) int {
+	return 0
+}
+
+// signalText returns "", since processes aren't killed by signals here.
+func signalText(sig int) string {
+	return ""
+}
+
+// crashSignal returns false, since processes aren't killed by signals here.
+func crashSignal(sig int) bool {
+	return false
+}
@@ -0,0 +1,219 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeExecutor simulates a child that writes the given chunks to stdout
+// and stderr and exits with the given status, without starting a process.
+type fakeExecutor struct {
+	stdout   []string
+	stderr   []string
+	exit     ProcessExit
+	startErr error
+
+	mu      sync.Mutex
+	started int
+	cmd     *exec.Cmd
+	signals []os.Signal
+}
+
+func (e *fakeExecutor) Start(cmd *exec.Cmd) (Process, error) {
+	if e.startErr != nil {
+		return nil, e.startErr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.started++
+	e.cmd = cmd
+	return &fakeProcess{cmd: cmd, e: e}, nil
+}
+
+type fakeProcess struct {
+	cmd *exec.Cmd
+	e   *fakeExecutor
+}
+
+func (p *fakeProcess) Pid() int { return 4242 }
+func (p *fakeProcess) Signal(s os.Signal) error {
+	p.e.mu.Lock()
+	defer p.e.mu.Unlock()
+	p.e.signals = append(p.e.signals, s)
+	return nil
+}
+func (p *fakeProcess) Wait() (ProcessExit, error) {
+	for _, s := range p.e.stdout {
+		p.cmd.Stdout.Write([]byte(s))
+	}
+	for _, s := range p.e.stderr {
+		p.cmd.Stderr.Write([]byte(s))
+	}
+
+	return p.e.exit, nil
+}
+
+func TestWrap_executor(t *testing.T) {
+	var info *PanicInfo
+	e := &fakeExecutor{
+		stderr: []string{"starting\n", "panic: boom\n", "\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+	stderr := new(bytes.Buffer)
+	clock := newFakeClock()
+
+	done, exitStatus, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		Writer:      stderr,
+		Executor:    e,
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !done || exitStatus != 2 {
+		t.Fatalf("bad: %t, %d", done, exitStatus)
+	}
+
+	if info == nil || info.Value != "boom" || info.PID != 4242 || info.ParentPID != os.Getpid() || !info.StartTime.Equal(clock.Now()) {
+		t.Fatalf("bad: %#v", info)
+	}
+	if !strings.HasPrefix(stderr.String(), "starting\npanic: boom\n") {
+		t.Fatalf("bad: %q", stderr.String())
+	}
+}
+
+func TestWrap_executorSignaled(t *testing.T) {
+	var info *PanicInfo
+	e := &fakeExecutor{
+		stderr: []string{"fatal error: unexpected signal\n"},
+		exit:   ProcessExit{Status: -1, CoreDumped: true},
+	}
+
+	_, exitStatus, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		Writer:      new(bytes.Buffer),
+		Executor:    e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitStatus != -1 {
+		t.Fatalf("bad: %d", exitStatus)
+	}
+	if info == nil || info.Kind != KindFatal || info.Core == nil {
+		t.Fatalf("bad: %#v", info)
+	}
+}
+
+func TestWrap_executorStartError(t *testing.T) {
+	e := &fakeExecutor{startErr: errors.New("no such file")}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:  func(string) { t.Fatal("shouldn't be called") },
+		Executor: e,
+	})
+	if err == nil || err.Error() != "no such file" {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestWrap_executorNoPanic(t *testing.T) {
+	e := &fakeExecutor{
+		stderr: []string{"panic: this isn't one, since the child exits cleanly\n"},
+	}
+	_, exitStatus, err := Wrap(&WrapConfig{
+		Handler:  func(string) { t.Fatal("shouldn't be called") },
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+	})
+	if err != nil || exitStatus != 0 {
+		t.Fatalf("bad: %d, %v", exitStatus, err)
+	}
+}
+
+func TestWrap_procSelfExe(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only on Linux")
+	}
+
+	e := &fakeExecutor{}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:     func(string) {},
+		ProcSelfExe: true,
+		Executor:    e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	exe, _ := os.Executable()
+	if e.cmd.Path != "/proc/self/exe" {
+		t.Fatalf("bad: %s", e.cmd.Path)
+	}
+	if e.cmd.Args[0] != exe {
+		t.Fatalf("bad: %s", e.cmd.Args[0])
+	}
+}
+
+func TestWrap_panicExitStatus(t *testing.T) {
+	cases := []struct {
+		stderr   []string
+		expected int
+	}{
+		{[]string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"}, 70},
+		{[]string{"not a panic\n"}, 2},
+	}
+
+	for _, tc := range cases {
+		e := &fakeExecutor{stderr: tc.stderr, exit: ProcessExit{Status: 2}}
+		_, exitStatus, err := Wrap(&WrapConfig{
+			Handler:         func(string) {},
+			Writer:          new(bytes.Buffer),
+			Executor:        e,
+			PanicExitStatus: 70,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if exitStatus != tc.expected {
+			t.Fatalf("bad: %d", exitStatus)
+		}
+	}
+}
+
+func TestWrap_signalExitStatus(t *testing.T) {
+	for _, signalStatus := range []bool{false, true} {
+		var info *PanicInfo
+		e := &fakeExecutor{
+			stderr: []string{"fatal error: unexpected signal\n"},
+			exit:   ProcessExit{Status: -1, Signal: 9},
+		}
+		_, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler:      func(i *PanicInfo) { info = i },
+			Writer:           new(bytes.Buffer),
+			Executor:         e,
+			SignalExitStatus: signalStatus,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		expected := -1
+		if signalStatus {
+			expected = 137
+		}
+		if exitStatus != expected {
+			t.Fatalf("bad: %d", exitStatus)
+		}
+		if info == nil || info.ExitStatus != expected || info.Signal != 9 {
+			t.Fatalf("bad: %#v", info)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// exitSignal returns the number of the signal that killed the process, or
+// 0 if it exited by itself.
+func exitSignal(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return int(status.Signal())
+	}
+
+	return 0
+}
+
+// signalText returns the Text of a crash that is only the signal that
+// killed the child, as "signal: killed".
+func signalText(sig int) string {
+	return fmt.Sprintf("signal: %s\n", syscall.Signal(sig))
+}
+
+// crashSignal returns whether the signal is one a process is killed with
+// when it crashes, rather than when it is asked to stop.
+func crashSignal(sig int) bool {
+	switch syscall.Signal(sig) {
+	case syscall.SIGSEGV, syscall.SIGBUS, syscall.SIGILL, syscall.SIGABRT, syscall.SIGFPE, syscall.SIGTRAP:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package panicwrap
+
+import "time"
+
+// FDConfig has the file descriptor watchdog of the parent, which counts
+// the open file descriptors of the child against its RLIMIT_NOFILE and
+// warns once it approaches the limit, before the child fails with "too
+// many open files". This is only supported on Linux, where the counts
+// come from procfs.
+type FDConfig struct {
+	// Threshold is the part of the limit past which the watchdog warns,
+	// between 0 and 1. Defaults to 0.8.
+	Threshold float64
+
+	// Interval is how often the descriptors are counted. Defaults to 30
+	// seconds.
+	Interval time.Duration
+}
+
+// FDWarning is a child whose open file descriptors approach its limit.
+// The watchdog warns once per child, until it falls below the threshold
+// again.
+type FDWarning struct {
+	// Open is the number of open file descriptors of the child, and
+	// Limit its soft RLIMIT_NOFILE.
+	Open  int
+	Limit int
+
+	// Types counts the open descriptors by type, so that the kind of
+	// leak shows: "file", "socket", "pipe", "anon_inode:" followed by the
+	// kind of the inode, such as "anon_inode:[eventpoll]", or "other".
+	Types map[string]int
+
+	// PID is the process ID of the child, Worker the index of its worker
+	// and Time when the parent counted.
+	PID    int
+	Worker int
+	Time   time.Time
+}
+
+// FDHandlerFunc is the type called when the open file descriptors of the
+// child approach its limit.
+type FDHandlerFunc func(*FDWarning)
+
+// fdWatcher counts the descriptors of the children of an FDConfig.
+type fdWatcher struct {
+	c    *WrapConfig
+	f    *FDConfig
+	ch   *child
+	quit chan struct{}
+	done chan struct{}
+
+	// warned has the process ID of the child of each worker that the
+	// watchdog warned about.
+	warned map[*child]int
+}
+
+// startFDWatcher starts counting the descriptors of the child until stop
+// is called.
+func startFDWatcher(c *WrapConfig, ch *child) *fdWatcher {
+	w := &fdWatcher{c: c, f: c.FDWatchdog, ch: ch, quit: make(chan struct{}), done: make(chan struct{}), warned: make(map[*child]int)}
+	go w.run()
+	return w
+}
+
+func (w *fdWatcher) run() {
+	defer close(w.done)
+	interval := w.f.Interval
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+	for {
+		select {
+		case <-w.c.Clock.After(interval):
+		case <-w.quit:
+			return
+		}
+		w.check()
+	}
+}
+
+// check counts the descriptors of every worker and warns about those past
+// the threshold.
+func (w *fdWatcher) check() {
+	threshold := w.f.Threshold
+	if threshold == 0 {
+		threshold = 0.8
+	}
+
+	w.ch.each(func(wk *child) {
+		pid := 0
+		wk.with(func(p Process) error {
+			pid = p.Pid()
+			return nil
+		})
+		if pid == 0 {
+			return
+		}
+
+		limit, err := readFDLimit(pid)
+		if err != nil {
+			debugf(w.c, "reading the file descriptor limit of child %d: %s", pid, err)
+			return
+		}
+		if limit < 0 {
+			return
+		}
+		types, err := readFDTypes(pid)
+		if err != nil {
+			debugf(w.c, "reading the file descriptors of child %d: %s", pid, err)
+			return
+		}
+		open := 0
+		for _, n := range types {
+			open += n
+		}
+
+		if float64(open) < threshold*float64(limit) {
+			delete(w.warned, wk)
+			return
+		}
+		if w.warned[wk] == pid {
+			return
+		}
+		w.warned[wk] = pid
+
+		debugf(w.c, "child %d has %d of %d file descriptors open", pid, open, limit)
+		if w.c.FDHandler != nil {
+			w.c.FDHandler(&FDWarning{
+				Open:   open,
+				Limit:  limit,
+				Types:  types,
+				PID:    pid,
+				Worker: wk.index,
+				Time:   w.c.Clock.Now(),
+			})
+		}
+	})
+}
+
+// stop stops counting.
+func (w *fdWatcher) stop() {
+	close(w.quit)
+	<-w.done
+}
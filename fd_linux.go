@@ -0,0 +1,76 @@
+package panicwrap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readFDTypes counts the open file descriptors of the process by type,
+// from the links of its fd directory.
+func readFDTypes(pid int) (map[string]int, error) {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]int)
+	for _, e := range entries {
+		// A descriptor closed since the directory was read is skipped.
+		target, err := os.Readlink(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		types[fdType(target)]++
+	}
+
+	return types, nil
+}
+
+// fdType returns the type of the descriptor with the given link target.
+func fdType(target string) string {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return "socket"
+	case strings.HasPrefix(target, "pipe:"):
+		return "pipe"
+	case strings.HasPrefix(target, "anon_inode:"):
+		return target
+	case strings.HasPrefix(target, "/"):
+		return "file"
+	default:
+		return "other"
+	}
+}
+
+// readFDLimit returns the soft RLIMIT_NOFILE of the process, from its
+// limits file, or -1 if it is unlimited.
+func readFDLimit(pid int) (int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		rest, ok := strings.CutPrefix(s.Text(), "Max open files")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			break
+		}
+		if fields[0] == "unlimited" {
+			return -1, nil
+		}
+		return strconv.Atoi(fields[0])
+	}
+
+	return 0, fmt.Errorf("panicwrap: no open files limit for process %d", pid)
+}
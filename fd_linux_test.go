@@ -0,0 +1,78 @@
+package panicwrap
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFDType(t *testing.T) {
+	cases := map[string]string{
+		"/dev/null":               "file",
+		"socket:[1234]":           "socket",
+		"pipe:[5678]":             "pipe",
+		"anon_inode:[eventpoll]":  "anon_inode:[eventpoll]",
+		"/memfd:buffer (deleted)": "file",
+		"net:[4026531840]":        "other",
+	}
+	for target, want := range cases {
+		if got := fdType(target); got != want {
+			t.Errorf("%s: got %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestReadFDLimit(t *testing.T) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	limit, err := readFDLimit(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if uint64(limit) != rlim.Cur {
+		t.Fatalf("bad: %d, want %d", limit, rlim.Cur)
+	}
+}
+
+func TestFDWatcher(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	clock := newFakeClock()
+	warnings := make(chan *FDWarning, 2)
+	c := &WrapConfig{
+		Clock:      clock,
+		FDWatchdog: &FDConfig{Threshold: 1e-9, Interval: time.Second},
+		FDHandler:  func(w *FDWarning) { warnings <- w },
+	}
+	ch := &child{index: 1}
+	ch.set(&selfProcess{fakeProcess{e: new(fakeExecutor)}})
+
+	fw := startFDWatcher(c, ch)
+	defer fw.stop()
+	<-clock.waiting
+	clock.Advance(time.Second)
+	<-clock.waiting
+
+	warning := <-warnings
+	if warning.Open == 0 || warning.Limit == 0 || warning.Types["pipe"] < 2 || warning.PID != os.Getpid() || warning.Worker != 1 {
+		t.Fatalf("bad: %#v", warning)
+	}
+
+	// The watchdog warns once per child.
+	clock.Advance(time.Second)
+	<-clock.waiting
+	select {
+	case warning := <-warnings:
+		t.Fatalf("bad: %#v", warning)
+	default:
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package panicwrap
+
+import "errors"
+
+var errFDUnsupported = errors.New("panicwrap: FDWatchdog isn't supported on this platform")
+
+func readFDTypes(int) (map[string]int, error) {
+	return nil, errFDUnsupported
+}
+
+func readFDLimit(int) (int, error) {
+	return 0, errFDUnsupported
+}
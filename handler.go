@@ -0,0 +1,39 @@
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// HandlerPanicError is returned when one of the handlers panicked while it
+// handled a crash or dump. The parent recovers, prints the crash to its
+// own stderr, so that it isn't lost, and carries on. Wrap still returns
+// the exit status of the child along with the first such error.
+type HandlerPanicError struct {
+	// Value is what the handler panicked with, and Stack where.
+	Value interface{}
+	Stack []byte
+
+	// Text is the crash or dump the handler was called for.
+	Text string
+}
+
+func (e *HandlerPanicError) Error() string {
+	return fmt.Sprintf("panicwrap: handler panicked: %v", e.Value)
+}
+
+// callHandler calls a handler for the crash or dump with the given text
+// and returns a *HandlerPanicError if it panics.
+func callHandler(text string, f func()) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			e := &HandlerPanicError{Value: v, Stack: debug.Stack(), Text: text}
+			fmt.Fprintf(os.Stderr, "%s\n\n%s\nIt was handling:\n\n%s", e, e.Stack, text)
+			err = e
+		}
+	}()
+
+	f()
+	return nil
+}
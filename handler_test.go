@@ -0,0 +1,44 @@
+package panicwrap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCallHandler(t *testing.T) {
+	if err := callHandler("panic: boom\n", func() {}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := callHandler("panic: boom\n", func() { panic("handler") })
+	var hpe *HandlerPanicError
+	if !errors.As(err, &hpe) || hpe.Value != "handler" || hpe.Text != "panic: boom\n" || len(hpe.Stack) == 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestWrap_handlerPanic(t *testing.T) {
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	var info *PanicInfo
+	done, exitStatus, err := Wrap(&WrapConfig{
+		Handler:     func(string) { panic("handler") },
+		InfoHandler: func(i *PanicInfo) { info = i },
+		HidePanic:   true,
+		Executor:    e,
+	})
+	if !done || exitStatus != 2 {
+		t.Fatalf("bad: %t %d", done, exitStatus)
+	}
+
+	var hpe *HandlerPanicError
+	if !errors.As(err, &hpe) || hpe.Text != "panic: boom\n" {
+		t.Fatalf("bad: %#v", err)
+	}
+	if info == nil {
+		t.Fatal("should still call the other handler")
+	}
+}
@@ -0,0 +1,156 @@
+package panicwrap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// HandlerCommand is an external program that handles crashes, so that a
+// crash can be handled with a script rather than with Go. It is run with
+// the PanicInfo of the crash as JSON on its stdin (see PanicInfoSchema) and
+// a summary of it in environment variables:
+//
+//	PANICWRAP_KIND         the kind of crash, such as "panic"
+//	PANICWRAP_SEVERITY     the severity of the crash, such as "error"
+//	PANICWRAP_VALUE        the panic value
+//	PANICWRAP_FINGERPRINT  the fingerprint of the crash
+//	PANICWRAP_OCCURRENCE   how many times it was seen, see PanicInfo
+//	PANICWRAP_PID          the process ID of the child
+//	PANICWRAP_WORKER       the index of the worker
+//	PANICWRAP_RUN_ID       the run ID of the child
+//	PANICWRAP_EXIT_STATUS  the exit status of the child
+//	PANICWRAP_EXECUTABLE   the path of the executable of the child
+//	PANICWRAP_CORE         the path of the core file, if any
+//	PANICWRAP_RECORDING    the path of the recording, if any
+//
+// on top of the environment of the parent. It succeeded if it exits with
+// status 0.
+type HandlerCommand struct {
+	// Args is the program and its arguments.
+	Args []string
+
+	// Timeout is the time the program may take before it is killed,
+	// which counts as a failure. Defaults to 1 minute.
+	Timeout time.Duration
+
+	// Retries is the number of times the program is run again after it
+	// fails, a second apart.
+	Retries int
+
+	// If Required is set, a failure is a failure of the handlers: Wrap
+	// returns a *HandlerCommandError along with the exit status of the
+	// child, like when a handler panics. Otherwise it is reported like an
+	// InternalError, and the parent carries on.
+	Required bool
+}
+
+// HandlerCommandError is the failure of a HandlerCommand, after its
+// retries.
+type HandlerCommandError struct {
+	// Args is the program and its arguments.
+	Args []string
+
+	// Output is the combined stdout and stderr of the last run.
+	Output string
+
+	// Err is why it failed, such as its exit status or that it timed out.
+	Err error
+}
+
+func (e *HandlerCommandError) Error() string {
+	return fmt.Sprintf("panicwrap: handler command %s failed: %s", e.Args[0], e.Err)
+}
+
+func (e *HandlerCommandError) Unwrap() error {
+	return e.Err
+}
+
+// runHandlerCommands runs the configured handler commands for the crash
+// one after the other. It returns the failure of the first required one
+// that failed, if any.
+func runHandlerCommands(c *WrapConfig, info *PanicInfo) error {
+	if len(c.HandlerCommands) == 0 {
+		return nil
+	}
+
+	report, err := json.Marshal(info)
+	if err != nil {
+		reportInternal(c, "encoding the crash for the handler commands", err)
+		return nil
+	}
+	env := append(os.Environ(), handlerCommandEnv(info)...)
+
+	var first error
+	for _, hc := range c.HandlerCommands {
+		err := runHandlerCommand(c, &hc, report, env)
+		for i := 0; err != nil && i < hc.Retries; i++ {
+			debugf(c, "retrying the handler command %s: %s", hc.Args[0], err.Err)
+			<-c.Clock.After(time.Second)
+			err = runHandlerCommand(c, &hc, report, env)
+		}
+		switch {
+		case err == nil:
+		case hc.Required:
+			if first == nil {
+				first = err
+			}
+		default:
+			reportInternal(c, "running a handler command", err)
+		}
+	}
+
+	return first
+}
+
+// runHandlerCommand runs a handler command once.
+func runHandlerCommand(c *WrapConfig, hc *HandlerCommand, report []byte, env []string) *HandlerCommandError {
+	timeout := hc.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hc.Args[0], hc.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(report)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return &HandlerCommandError{Args: hc.Args, Output: string(out), Err: err}
+	}
+
+	return nil
+}
+
+// handlerCommandEnv returns the environment variables that describe the
+// crash to a HandlerCommand.
+func handlerCommandEnv(info *PanicInfo) []string {
+	var core string
+	if info.Core != nil {
+		core = info.Core.Path
+	}
+
+	return []string{
+		"PANICWRAP_KIND=" + string(info.Kind),
+		"PANICWRAP_SEVERITY=" + string(info.Severity),
+		"PANICWRAP_VALUE=" + info.Value,
+		"PANICWRAP_FINGERPRINT=" + info.Fingerprint,
+		"PANICWRAP_OCCURRENCE=" + strconv.Itoa(info.Occurrence),
+		"PANICWRAP_PID=" + strconv.Itoa(info.PID),
+		"PANICWRAP_WORKER=" + strconv.Itoa(info.Worker),
+		"PANICWRAP_RUN_ID=" + info.RunID,
+		"PANICWRAP_EXIT_STATUS=" + strconv.Itoa(info.ExitStatus),
+		"PANICWRAP_EXECUTABLE=" + info.Executable,
+		"PANICWRAP_CORE=" + core,
+		"PANICWRAP_RECORDING=" + info.Recording,
+	}
+}
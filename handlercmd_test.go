@@ -0,0 +1,104 @@
+package panicwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHandlerCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+
+	dir := t.TempDir()
+	out, envOut := filepath.Join(dir, "out"), filepath.Join(dir, "env")
+	info := &PanicInfo{Text: testPanicText, Kind: KindPanic, PID: 42, Fingerprint: "abc"}
+	c := &WrapConfig{
+		HandlerCommands: []HandlerCommand{{
+			Args: []string{"sh", "-c", `cat > "$0"; echo "$PANICWRAP_KIND $PANICWRAP_PID $PANICWRAP_FINGERPRINT" > "$1"`, out, envOut},
+		}},
+		Clock: realClock{},
+	}
+
+	if err := runHandlerCommands(c, info); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	report, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var got PanicInfo
+	if err := json.Unmarshal(report, &got); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got.Text != testPanicText || got.PID != 42 {
+		t.Fatalf("bad: %#v", got)
+	}
+	if env, _ := os.ReadFile(envOut); string(env) != "panic 42 abc\n" {
+		t.Fatalf("bad: %q", env)
+	}
+}
+
+func TestRunHandlerCommands_failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+
+	clock := newFakeClock()
+	var internal []error
+	runs := filepath.Join(t.TempDir(), "runs")
+	c := &WrapConfig{
+		HandlerCommands: []HandlerCommand{
+			{Args: []string{"sh", "-c", `echo run >> "$0"; echo oops; exit 3`, runs}, Retries: 1, Required: true},
+			{Args: []string{"sleep", "10"}, Timeout: 10 * time.Millisecond},
+		},
+		InternalErrorHandler: func(err error) { internal = append(internal, err) },
+		Clock:                clock,
+	}
+
+	done := make(chan error)
+	go func() { done <- runHandlerCommands(c, &PanicInfo{Text: testPanicText}) }()
+	<-clock.waiting
+	clock.Advance(time.Second)
+
+	err := <-done
+	var cmdErr *HandlerCommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Output != "oops\n" || cmdErr.Args[0] != "sh" {
+		t.Fatalf("bad: %#v", err)
+	}
+	if data, _ := os.ReadFile(runs); string(data) != "run\nrun\n" {
+		t.Fatalf("should retry once: %q", data)
+	}
+
+	// The command that isn't required is only reported.
+	if len(internal) != 1 || !strings.Contains(internal[0].Error(), "timed out after 10ms") {
+		t.Fatalf("bad: %v", internal)
+	}
+}
+
+func TestWrap_handlerCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+
+	_, exitStatus, err := Wrap(&WrapConfig{
+		HandlerCommands: []HandlerCommand{{Args: []string{"false"}, Required: true}},
+		Writer:          new(bytes.Buffer),
+		Executor:        &fakeExecutor{stderr: []string{testPanicText}, exit: ProcessExit{Status: 2}},
+	})
+	var cmdErr *HandlerCommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if exitStatus != 2 {
+		t.Fatalf("bad: %d", exitStatus)
+	}
+}
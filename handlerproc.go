@@ -0,0 +1,79 @@
+package panicwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// handlerProcessEnv is set in the environment of the helper process that
+// calls the handlers. See WrapConfig.HandlerProcess.
+const handlerProcessEnv = "PANICWRAP_HANDLER_PROCESS"
+
+// HandlerProcessError is returned when the helper process that calls the
+// handlers fails, such as when a handler panics in it. See
+// WrapConfig.HandlerProcess.
+type HandlerProcessError struct {
+	// Err is how the helper process failed, such as its exit status.
+	Err error
+}
+
+func (e *HandlerProcessError) Error() string {
+	return fmt.Sprintf("panicwrap: handler process failed: %s", e.Err)
+}
+
+func (e *HandlerProcessError) Unwrap() error {
+	return e.Err
+}
+
+// isHandlerProcess returns whether this process is the helper that calls
+// the handlers for a crash.
+func isHandlerProcess() bool {
+	return os.Getenv(handlerProcessEnv) != ""
+}
+
+// runHandlerProcess starts the helper process that calls the handlers for
+// the crash and waits for it. It returns false if the process couldn't be
+// started, in which case the parent calls the handlers itself.
+func runHandlerProcess(c *WrapConfig, info *PanicInfo) (bool, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return false, err
+	}
+	report, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), handlerProcessEnv+"=1")
+	cmd.Stdin = bytes.NewReader(report)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+	debugf(c, "calling the handlers in process %d", cmd.Process.Pid)
+
+	if err := cmd.Wait(); err != nil {
+		return true, &HandlerProcessError{Err: err}
+	}
+	return true, nil
+}
+
+// serveHandlerProcess reads the crash that the parent passed to the helper
+// process and calls the handlers for it. It returns the exit status of the
+// helper process.
+func serveHandlerProcess(c *WrapConfig) (int, error) {
+	var info PanicInfo
+	if err := json.NewDecoder(os.Stdin).Decode(&info); err != nil {
+		return 1, fmt.Errorf("panicwrap: reading the crash to handle: %w", err)
+	}
+	if err := callHandlers(c, &info); err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,38 @@
+package panicwrap
+
+import (
+	"errors"
+)
+
+// syntheticPanicText is the panic InjectCrash uses by default.
+const syntheticPanicText = `panic: panicwrap: synthetic crash
+
+goroutine 1 [running]:
+main.main()
+	panicwrap/synthetic.go:1 +0x0
+`
+
+// InjectCrash runs a fake panic through the handling of the running Wrap
+// call, as if the child had crashed with it, without touching the child.
+// This checks that crash reports actually reach their destination. The
+// PanicInfo is marked as Synthetic and isn't recorded in the StateFile,
+// but otherwise goes through the same steps as a real crash, including
+// being mirrored to Writer unless HidePanic is set. If text is empty, a
+// generic panic is used. A *HandlerPanicError is returned if a handler
+// panicked.
+func InjectCrash(text string) error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	if text == "" {
+		text = syntheticPanicText
+	}
+
+	return ch.inject(&PanicInfo{
+		Text:       text,
+		ExitStatus: 2,
+		Synthetic:  true,
+	})
+}
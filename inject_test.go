@@ -0,0 +1,35 @@
+package panicwrap
+
+import (
+	"testing"
+)
+
+func TestInjectCrash_notWrapping(t *testing.T) {
+	if err := InjectCrash(""); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestInjectCrash(t *testing.T) {
+	var info *PanicInfo
+	ch := &child{inject: func(i *PanicInfo) error {
+		info = i
+		return nil
+	}}
+	activeChild.Store(ch)
+	defer activeChild.Store(nil)
+
+	if err := InjectCrash(""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if info == nil || !info.Synthetic || info.Text != syntheticPanicText {
+		t.Fatalf("bad: %#v", info)
+	}
+	if parseValue(info.Text) != "panicwrap: synthetic crash" {
+		t.Fatalf("bad: %#v", parseValue(info.Text))
+	}
+	if gs := parseGoroutines(info.Text, nil); len(gs) != 1 || len(gs[0].Frames) != 1 {
+		t.Fatalf("should parse: %#v", gs)
+	}
+}
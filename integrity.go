@@ -0,0 +1,115 @@
+package panicwrap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrExecutableMismatch is returned by Wrap when the binary it is about to
+// start as the child doesn't have the expected SHA-256 digest. See
+// WrapConfig.ExecutableSHA256.
+var ErrExecutableMismatch = errors.New("panicwrap: executable doesn't match its expected digest")
+
+// validSHA256 reports whether s is a hex encoded SHA-256 digest.
+func validSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
+
+// runningExecutable returns the path under which the binary of the current
+// process can be read. On Linux, this is the running image itself even if
+// its path was since deleted or replaced.
+func runningExecutable(exePath string) string {
+	if runtime.GOOS == "linux" {
+		return "/proc/self/exe"
+	}
+	return exePath
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of the given file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return readSHA256(f)
+}
+
+func readSHA256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openVerified opens the binary at the given path and checks that it has
+// the given digest. The file is returned open so that, on Linux, the child
+// can be started from exactly the file that was checked, rather than from
+// a path that may have been swapped in the meantime.
+func openVerified(path, digest string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	got, err := readSHA256(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !strings.EqualFold(got, digest) {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s has sha256 %s, want %s", ErrExecutableMismatch, path, got, digest)
+	}
+
+	return f, nil
+}
+
+// exeDigestCache holds the digest of the binary the children were last
+// started from, so that a child that keeps crashing doesn't have the
+// whole binary hashed again every time. It is shared by all workers.
+type exeDigestCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	digest  string
+}
+
+// executableDigest returns the hex encoded SHA-256 digest of the binary a
+// child was started from, given the path and modification time it had
+// then, or an empty string if it changed since or can't be read. The
+// digest of ExecutableSHA256 is used if it is set, since the binary was
+// checked against it.
+func (d *exeDigestCache) executableDigest(c *WrapConfig, path string, modTime time.Time) string {
+	if c.ExecutableSHA256 != "" {
+		return c.ExecutableSHA256
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil || !fi.ModTime().Equal(modTime) {
+		return ""
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.digest != "" && d.path == path && d.modTime.Equal(modTime) {
+		return d.digest
+	}
+	digest, err := fileSHA256(path)
+	if err == nil {
+		d.path, d.modTime, d.digest = path, modTime, digest
+	}
+	return digest
+}
@@ -0,0 +1,123 @@
+package panicwrap
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-256 digest of "hello".
+const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestOpenVerified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exe")
+	if err := os.WriteFile(path, []byte("hello"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := openVerified(path, strings.ToUpper(helloSHA256))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.Close()
+
+	if err := os.WriteFile(path, []byte("swapped"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := openVerified(path, helloSHA256); !errors.Is(err, ErrExecutableMismatch) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestWrap_executableMismatch(t *testing.T) {
+	e := &fakeExecutor{}
+	done, _, err := Wrap(&WrapConfig{
+		Handler:          func(string) {},
+		ExecutableSHA256: helloSHA256,
+		Executor:         e,
+	})
+	if !errors.Is(err, ErrExecutableMismatch) {
+		t.Fatalf("bad: %v", err)
+	}
+	if !done {
+		t.Fatal("should be done")
+	}
+	if e.started != 0 {
+		t.Fatalf("shouldn't start a child: %d", e.started)
+	}
+}
+
+func TestWrap_invalidExecutableSHA256(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:          func(string) {},
+		ExecutableSHA256: "abc",
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestExecutableDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bin")
+	if err := os.WriteFile(path, []byte("binary"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected, _ := fileSHA256(path)
+
+	c := new(WrapConfig)
+	cache := new(exeDigestCache)
+	if d := cache.executableDigest(c, path, fi.ModTime()); d != expected {
+		t.Fatalf("bad: %q", d)
+	}
+
+	// The binary is only hashed once for its modification time.
+	os.WriteFile(path, []byte("changed"), 0755)
+	os.Chtimes(path, fi.ModTime(), fi.ModTime())
+	if d := cache.executableDigest(c, path, fi.ModTime()); d != expected {
+		t.Fatalf("should be cached: %q", d)
+	}
+
+	// The binary was replaced since the child started.
+	if d := cache.executableDigest(c, path, fi.ModTime().Add(-time.Hour)); d != "" {
+		t.Fatalf("bad: %q", d)
+	}
+
+	c.ExecutableSHA256 = strings.Repeat("ab", 32)
+	if d := cache.executableDigest(c, path, time.Time{}); d != c.ExecutableSHA256 {
+		t.Fatalf("bad: %q", d)
+	}
+}
+
+func TestWrap_commandLine(t *testing.T) {
+	var info *PanicInfo
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		Writer:      io.Discard,
+		Executor:    e,
+		IgnoreEnv:   true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(info.Args, e.cmd.Args) {
+		t.Fatalf("bad: %q", info.Args)
+	}
+	if info.ExecutableModTime.IsZero() || !validSHA256(info.ExecutableSHA256) {
+		t.Fatalf("bad: %s %q", info.ExecutableModTime, info.ExecutableSHA256)
+	}
+}
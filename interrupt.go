@@ -0,0 +1,34 @@
+package panicwrap
+
+import (
+	"errors"
+	"os"
+)
+
+// Interrupt asks the running child, or all workers, to shut down
+// gracefully by sending it os.Interrupt, and keeps it from being
+// restarted. It is meant for parents
+// that are asked to stop by other means than a signal, such as the stop
+// request of a Windows service. On Windows, this requires
+// WrapConfig.ConsoleGroup.
+func Interrupt() error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	return interruptChild(ch)
+}
+
+// interruptChild is Interrupt for the given child.
+func interruptChild(ch *child) error {
+	var err error
+	ch.each(func(w *child) {
+		w.stop()
+		if werr := w.send(os.Interrupt); err == nil {
+			err = werr
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,32 @@
+package panicwrap
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInterrupt_notWrapping(t *testing.T) {
+	if err := Interrupt(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	e := &fakeExecutor{}
+	ch := new(child)
+	ch.set(&fakeProcess{e: e})
+	activeChild.Store(ch)
+	defer activeChild.Store(nil)
+
+	if err := Interrupt(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(e.signals, []os.Signal{os.Interrupt}) {
+		t.Fatalf("bad: %#v", e.signals)
+	}
+	if !ch.stopping() {
+		t.Fatal("shouldn't restart the child")
+	}
+}
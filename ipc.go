@@ -0,0 +1,129 @@
+package panicwrap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// protocolVersion is the version of the protocol between parent and
+// child, made up of the environment the parent passes and the messages of
+// the control channel. See WrapConfig.Control and VersionPolicy.
+//
+// Every message is a frame of a 6 byte header, the protocol version, the
+// message type and the big-endian length of the payload, followed by the
+// payload, which is a JSON object.
+const protocolVersion = 1
+
+// maxMessageSize limits the payload of a message, so that a broken peer
+// can't make the other side allocate without bounds.
+const maxMessageSize = 1 << 20
+
+// messageType is the type of a control message.
+type messageType uint8
+
+const (
+	// messageHandshake is the first message each side sends. See
+	// handshakeMessage.
+	messageHandshake messageType = iota + 1
+
+	// messageHeartbeat tells the parent that the child is alive.
+	messageHeartbeat
+
+	// messageMetadata sets a metadata entry of the child. See
+	// metadataMessage.
+	messageMetadata
+
+	// messageReport reports a problem of the child that isn't a crash.
+	// See reportMessage.
+	messageReport
+
+	// messageShutdown asks the child to shut down gracefully.
+	messageShutdown
+
+	// messageReady tells the parent that the child is ready to take over.
+	// See Ready.
+	messageReady
+
+	// messageSubprocessCrash reports the crash of a process the child
+	// started with StartSubprocess. See subprocessCrashMessage.
+	messageSubprocessCrash
+
+	// messageSample asks the child for a sample of its goroutine count,
+	// and carries the answer back. See sampleMessage.
+	messageSample
+
+	// messageStacks asks the child for its goroutine dump, and carries
+	// the answer back. See stacksMessage.
+	messageStacks
+
+	// messageRecovered reports a panic the child recovered from. See
+	// ReportRecovered.
+	messageRecovered
+)
+
+type handshakeMessage struct {
+	Version int `json:"version"`
+	PID     int `json:"pid"`
+}
+
+type metadataMessage struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type reportMessage struct {
+	Text string `json:"text"`
+}
+
+// errProtocolVersion is returned when reading a message of another
+// version of the protocol.
+var errProtocolVersion = errors.New("panicwrap: unsupported control protocol version")
+
+// writeMessage writes the message with the given payload as one frame.
+func writeMessage(w io.Writer, typ messageType, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return fmt.Errorf("panicwrap: control message of %d bytes is too large", len(data))
+	}
+
+	frame := make([]byte, 6+len(data))
+	frame[0] = protocolVersion
+	frame[1] = byte(typ)
+	binary.BigEndian.PutUint32(frame[2:], uint32(len(data)))
+	copy(frame[6:], data)
+
+	_, err = w.Write(frame)
+	return err
+}
+
+// readMessage reads the next frame and returns its type and payload.
+func readMessage(r io.Reader) (messageType, []byte, error) {
+	var header [6]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if header[0] != protocolVersion {
+		return 0, nil, errProtocolVersion
+	}
+
+	n := binary.BigEndian.Uint32(header[2:])
+	if n > maxMessageSize {
+		return 0, nil, fmt.Errorf("panicwrap: control message of %d bytes is too large", n)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	return messageType(header[1]), data, nil
+}
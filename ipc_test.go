@@ -0,0 +1,49 @@
+package panicwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMessage_roundTrip(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := writeMessage(buf, messageMetadata, metadataMessage{Key: "a", Value: "b"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := writeMessage(buf, messageHeartbeat, struct{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	typ, data, err := readMessage(buf)
+	if err != nil || typ != messageMetadata {
+		t.Fatalf("bad: %d, %v", typ, err)
+	}
+	var m metadataMessage
+	if err := json.Unmarshal(data, &m); err != nil || m.Key != "a" || m.Value != "b" {
+		t.Fatalf("bad: %#v, %v", m, err)
+	}
+
+	if typ, _, err := readMessage(buf); err != nil || typ != messageHeartbeat {
+		t.Fatalf("bad: %d, %v", typ, err)
+	}
+	if _, _, err := readMessage(buf); err != io.EOF {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestReadMessage_invalid(t *testing.T) {
+	cases := map[string]string{
+		"version":   "\x09\x02\x00\x00\x00\x02{}",
+		"too large": "\x01\x02\xff\xff\xff\xff",
+		"truncated": "\x01\x02\x00\x00\x00\x05{}",
+	}
+
+	for name, input := range cases {
+		if _, _, err := readMessage(strings.NewReader(input)); err == nil {
+			t.Fatalf("%s: should fail", name)
+		}
+	}
+}
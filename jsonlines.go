@@ -0,0 +1,88 @@
+package panicwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// jsonLineMaxSize is the length at which a line that doesn't end is
+// written out anyway, so that output without newlines, such as a progress
+// bar, doesn't pile up in memory.
+const jsonLineMaxSize = 64 * 1024
+
+// jsonLine is a line of output as written with WrapConfig.JSONLines.
+type jsonLine struct {
+	Time   time.Time `json:"ts"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
+
+// jsonLineWriter writes every line written through it as a JSON object on
+// a line of its own. Lines may span several writes, so the last line is
+// held back until it ends or the writer is flushed.
+type jsonLineWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	stream string
+	buf    []byte
+}
+
+func newJSONLineWriter(w io.Writer, stream string) *jsonLineWriter {
+	return &jsonLineWriter{w: w, stream: stream}
+}
+
+func (w *jsonLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	var out bytes.Buffer
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		w.encode(&out, w.buf[:idx])
+		w.buf = w.buf[idx+1:]
+	}
+	if len(w.buf) >= jsonLineMaxSize {
+		w.encode(&out, w.buf)
+		w.buf = nil
+	}
+
+	if out.Len() > 0 {
+		if _, err := w.w.Write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// flush writes out the line that hasn't ended yet, if any.
+func (w *jsonLineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return
+	}
+
+	var out bytes.Buffer
+	w.encode(&out, w.buf)
+	w.buf = nil
+	w.w.Write(out.Bytes())
+}
+
+func (w *jsonLineWriter) encode(out *bytes.Buffer, line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	json.NewEncoder(out).Encode(jsonLine{
+		Time:   time.Now(),
+		Stream: w.stream,
+		Line:   string(line),
+	})
+}
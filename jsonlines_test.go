@@ -0,0 +1,82 @@
+package panicwrap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func readJSONLines(t *testing.T, data string) []jsonLine {
+	var result []jsonLine
+	s := bufio.NewScanner(strings.NewReader(data))
+	s.Buffer(nil, 2*jsonLineMaxSize)
+	for s.Scan() {
+		var l jsonLine
+		if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+			t.Fatalf("err: %s: %q", err, s.Text())
+		}
+		result = append(result, l)
+	}
+
+	return result
+}
+
+func TestJSONLineWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := newJSONLineWriter(buf, "stderr")
+
+	for _, s := range []string{"one\r\ntw", "o \"quoted\"\n", "three"} {
+		if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("bad: %d, %s", n, err)
+		}
+	}
+
+	lines := readJSONLines(t, buf.String())
+	if len(lines) != 2 {
+		t.Fatalf("should hold back the last line: %q", buf.String())
+	}
+
+	w.flush()
+	lines = readJSONLines(t, buf.String())
+	var got []string
+	for _, l := range lines {
+		if l.Stream != "stderr" || l.Time.IsZero() {
+			t.Fatalf("bad: %#v", l)
+		}
+		got = append(got, l.Line)
+	}
+	if strings.Join(got, "|") != `one|two "quoted"|three` {
+		t.Fatalf("bad: %q", got)
+	}
+
+	// Flushing again has nothing to write.
+	n := buf.Len()
+	w.flush()
+	if buf.Len() != n {
+		t.Fatal("should only flush once")
+	}
+}
+
+func TestJSONLineWriter_long(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := newJSONLineWriter(buf, "stdout")
+	w.Write(bytes.Repeat([]byte("a"), jsonLineMaxSize))
+
+	lines := readJSONLines(t, buf.String())
+	if len(lines) != 1 || len(lines[0].Line) != jsonLineMaxSize {
+		t.Fatal("should write out long lines")
+	}
+}
+
+func TestWrap_jsonLinesAndPrefixes(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:      func(string) {},
+		JSONLines:    true,
+		StreamLabels: true,
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
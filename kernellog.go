@@ -0,0 +1,35 @@
+package panicwrap
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// maxKernelLogLines is the number of the most recent kernel log lines
+// about the child that are kept. See WrapConfig.KernelLog.
+const maxKernelLogLines = 20
+
+// filterKernelLog returns the last lines of the kernel log that mention
+// the process ID, such as "Out of memory: Killed process 1234 (app)" or
+// "app[1234]: segfault at 0 ip ...". split returns the message of a line,
+// and whether the line is one.
+func filterKernelLog(data []byte, pid int, split func(string) (string, bool)) []string {
+	re := regexp.MustCompile(`(^|[^0-9])` + strconv.Itoa(pid) + `([^0-9]|$)`)
+
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		msg, ok := split(s.Text())
+		if !ok || !re.MatchString(msg) {
+			continue
+		}
+		lines = append(lines, msg)
+		if len(lines) > maxKernelLogLines {
+			lines = lines[1:]
+		}
+	}
+
+	return lines
+}
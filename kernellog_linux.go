@@ -0,0 +1,85 @@
+package panicwrap
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// kernelKill returns whether a child that was killed by the signal, and
+// didn't write a crash, is reported with WrapConfig.KernelLog: the
+// signals of the OOM killer and of hardware faults in code outside of
+// the Go runtime.
+func kernelKill(sig int) bool {
+	switch syscall.Signal(sig) {
+	case syscall.SIGKILL, syscall.SIGSEGV, syscall.SIGBUS:
+		return true
+	}
+	return false
+}
+
+// readKernelLog returns the recent kernel log lines that mention the
+// process ID, from /dev/kmsg, or from dmesg if that can't be read.
+func readKernelLog(pid int) ([]string, error) {
+	data, err := readKmsg()
+	if err == nil {
+		return filterKernelLog(data, pid, kmsgMessage), nil
+	}
+
+	out, dmesgErr := exec.Command("dmesg").Output()
+	if dmesgErr != nil {
+		return nil, errors.Join(err, dmesgErr)
+	}
+	return filterKernelLog(out, pid, dmesgMessage), nil
+}
+
+// readKmsg reads the records of the kernel log buffer from /dev/kmsg
+// without waiting for new ones. Each read returns one record.
+func readKmsg() ([]byte, error) {
+	fd, err := syscall.Open("/dev/kmsg", syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	var data []byte
+	buf := make([]byte, 8192)
+	for {
+		n, err := syscall.Read(fd, buf)
+		switch {
+		case err == syscall.EAGAIN:
+			return data, nil
+		case err == syscall.EPIPE:
+			// The record was overwritten while it was read.
+			continue
+		case err != nil:
+			return nil, err
+		case n <= 0:
+			return data, nil
+		}
+		data = append(data, buf[:n]...)
+	}
+}
+
+// kmsgMessage returns the message of a /dev/kmsg record, such as
+// "6,1234,5678901,-;Out of memory: ...". Continuation lines, which start
+// with a space, aren't records.
+func kmsgMessage(line string) (string, bool) {
+	if strings.HasPrefix(line, " ") {
+		return "", false
+	}
+	_, msg, ok := strings.Cut(line, ";")
+	return msg, ok
+}
+
+// dmesgMessage returns the message of a dmesg line, without the
+// timestamp it starts with, such as "[12345.678901] ".
+func dmesgMessage(line string) (string, bool) {
+	if strings.HasPrefix(line, "[") {
+		if _, msg, ok := strings.Cut(line, "] "); ok {
+			return msg, true
+		}
+	}
+	return line, true
+}
@@ -0,0 +1,56 @@
+package panicwrap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKmsgMessage(t *testing.T) {
+	if msg, ok := kmsgMessage("6,1234,5678901,-;Out of memory: Killed process 1"); !ok || msg != "Out of memory: Killed process 1" {
+		t.Fatalf("bad: %q %v", msg, ok)
+	}
+	if _, ok := kmsgMessage(" SUBSYSTEM=pci"); ok {
+		t.Fatal("should skip continuation lines")
+	}
+}
+
+func TestDmesgMessage(t *testing.T) {
+	if msg, _ := dmesgMessage("[12345.678901] app[1]: segfault at 0"); msg != "app[1]: segfault at 0" {
+		t.Fatalf("bad: %q", msg)
+	}
+}
+
+func TestWrap_kernelLog(t *testing.T) {
+	var info *PanicInfo
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		KernelLog:   true,
+		HidePanic:   true,
+		Writer:      new(bytes.Buffer),
+		Executor:    &fakeExecutor{exit: ProcessExit{Status: -1, Signal: 9}},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if info == nil || info.Kind != KindSignal || info.Text != "signal: killed\n" || info.Signal != 9 {
+		t.Fatalf("bad: %#v", info)
+	}
+}
+
+func TestWrap_kernelLogOtherSignal(t *testing.T) {
+	called := false
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(*PanicInfo) { called = true },
+		KernelLog:   true,
+		Writer:      new(bytes.Buffer),
+		Executor:    &fakeExecutor{exit: ProcessExit{Status: -1, Signal: 15}},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if called {
+		t.Fatal("should only report the signals of the kernel")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package panicwrap
+
+import "errors"
+
+func kernelKill(int) bool {
+	return false
+}
+
+func readKernelLog(int) ([]string, error) {
+	return nil, errors.New("panicwrap: KernelLog isn't supported on this platform")
+}
@@ -0,0 +1,42 @@
+package panicwrap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterKernelLog(t *testing.T) {
+	data := []byte(`Out of memory: Killed process 1234 (app) total-vm:1024kB
+oom-kill:constraint=CONSTRAINT_NONE,task=app,pid=1234,uid=0
+Out of memory: Killed process 12345 (other) total-vm:1024kB
+skipped 1234
+app[1234]: segfault at 0 ip 0000000000401000
+`)
+	split := func(line string) (string, bool) {
+		return line, !strings.HasPrefix(line, "skipped")
+	}
+
+	lines := filterKernelLog(data, 1234, split)
+	want := []string{
+		"Out of memory: Killed process 1234 (app) total-vm:1024kB",
+		"oom-kill:constraint=CONSTRAINT_NONE,task=app,pid=1234,uid=0",
+		"app[1234]: segfault at 0 ip 0000000000401000",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("bad: %#v", lines)
+	}
+}
+
+func TestFilterKernelLog_max(t *testing.T) {
+	var data []byte
+	for range maxKernelLogLines + 5 {
+		data = append(data, "killed 7\n"...)
+	}
+	data = append(data, "last 7\n"...)
+
+	lines := filterKernelLog(data, 7, func(line string) (string, bool) { return line, true })
+	if len(lines) != maxKernelLogLines || lines[len(lines)-1] != "last 7" {
+		t.Fatalf("should keep the last lines: %#v", lines)
+	}
+}
@@ -0,0 +1,152 @@
+package panicwrap
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CrashKind classifies a detected crash so that different kinds of crashes
+// can be routed differently.
+type CrashKind string
+
+const (
+	// KindPanic is a regular panic.
+	KindPanic CrashKind = "panic"
+
+	// KindFatal is a fatal runtime error that isn't classified any
+	// further, such as "concurrent map writes".
+	KindFatal CrashKind = "fatal"
+
+	// KindDeadlock is the fatal error the runtime raises when all
+	// goroutines are blocked. See PanicInfo.Deadlock.
+	KindDeadlock CrashKind = "deadlock"
+
+	// KindOutOfMemory is the fatal error the runtime raises when it can't
+	// allocate memory. See PanicInfo.Memory.
+	KindOutOfMemory CrashKind = "oom"
+
+	// KindStartup is a child that failed before it came up, such as one
+	// that the dynamic linker or the initialization of the runtime
+	// refused to start. Text holds whatever it wrote to stderr, which may
+	// not be a panic at all. See WrapConfig.DetectStartup.
+	KindStartup CrashKind = "startup"
+
+	// KindSignal is a child that was killed by a signal without writing
+	// a crash, such as by the OOM killer outside of WrapConfig.Cgroup
+	// (see KindOOMKill). Text only says which signal it
+	// was, and PanicInfo.KernelLog has what the kernel logged about it.
+	// On Windows, it is a child that died of an exception, and Text
+	// only says which. It is only reported with WrapConfig.KernelLog,
+	// DiagnosticReports or WERReports.
+	KindSignal CrashKind = "signal"
+
+	// KindOOMKill is a child that the kernel killed for going over the
+	// memory.max of its cgroup, which it can't report itself. It is
+	// always reported, and PanicInfo.Cgroup has the resource usage of
+	// the cgroup. See WrapConfig.Cgroup.
+	KindOOMKill CrashKind = "oom_kill"
+)
+
+// DeadlockInfo summarizes the blocked goroutines of a deadlock.
+type DeadlockInfo struct {
+	// Goroutines is the number of blocked goroutines.
+	Goroutines int `json:"goroutines"`
+
+	// States counts the blocked goroutines by what they were blocked on,
+	// such as "chan receive" or "sync.Mutex.Lock".
+	States map[string]int `json:"states,omitempty"`
+}
+
+// String returns a one-line summary such as "3 goroutines: chan receive
+// (2), select (1)", which is handy for alerts.
+func (d *DeadlockInfo) String() string {
+	states := make([]string, 0, len(d.States))
+	for s := range d.States {
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if d.States[states[i]] != d.States[states[j]] {
+			return d.States[states[i]] > d.States[states[j]]
+		}
+		return states[i] < states[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d goroutines", d.Goroutines)
+	for i, s := range states {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s (%d)", s, d.States[s])
+	}
+
+	return b.String()
+}
+
+// MemoryInfo holds the numbers the runtime prints when it runs out of
+// memory. Either may be zero if the runtime didn't print it.
+type MemoryInfo struct {
+	// Requested is the size in bytes of the allocation that failed.
+	Requested uint64 `json:"requested"`
+
+	// InUse is the number of bytes the heap had in use at the time.
+	InUse uint64 `json:"in_use"`
+}
+
+var memoryRe = regexp.MustCompile(`cannot allocate ([0-9]+)-byte block \(([0-9]+) in use\)`)
+
+// classify returns the CrashKind of the given panic text with the given
+// value, as returned by parseValue.
+func classify(text, value string) CrashKind {
+	fatal := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "fatal error:") {
+			fatal = true
+			break
+		}
+	}
+	if !fatal {
+		return KindPanic
+	}
+
+	switch {
+	case value == "all goroutines are asleep - deadlock!":
+		return KindDeadlock
+	case strings.Contains(value, "out of memory"),
+		strings.Contains(value, "cannot allocate memory"):
+		return KindOutOfMemory
+	default:
+		return KindFatal
+	}
+}
+
+// parseMemory extracts the MemoryInfo from the given out of memory crash.
+func parseMemory(text string) *MemoryInfo {
+	result := new(MemoryInfo)
+	if m := memoryRe.FindStringSubmatch(text); m != nil {
+		result.Requested, _ = strconv.ParseUint(m[1], 10, 64)
+		result.InUse, _ = strconv.ParseUint(m[2], 10, 64)
+	}
+
+	return result
+}
+
+// summarizeDeadlock summarizes the given goroutines of a deadlock.
+func summarizeDeadlock(goroutines []Goroutine) *DeadlockInfo {
+	result := &DeadlockInfo{States: make(map[string]int)}
+	for _, g := range goroutines {
+		// Strip the details such as ", 5 minutes" or ", locked to
+		// thread" so that goroutines blocked on the same thing are
+		// counted together.
+		state, _, _ := strings.Cut(g.State, ",")
+		result.Goroutines++
+		result.States[state]++
+	}
+
+	return result
+}
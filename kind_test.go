@@ -0,0 +1,72 @@
+package panicwrap
+
+import (
+	"testing"
+)
+
+const testDeadlockText = `fatal error: all goroutines are asleep - deadlock!
+
+goroutine 1 [chan receive]:
+main.main()
+	/home/user/app/main.go:9 +0x2d
+
+goroutine 6 [chan receive, 2 minutes]:
+main.worker()
+	/home/user/app/main.go:14 +0x25
+created by main.main in goroutine 1
+	/home/user/app/main.go:7 +0x1a
+
+goroutine 7 [sync.Mutex.Lock]:
+main.locker()
+	/home/user/app/main.go:20 +0x25
+created by main.main in goroutine 1
+	/home/user/app/main.go:8 +0x1a
+`
+
+const testOOMText = `runtime: out of memory: cannot allocate 1073741824-byte block (3976200192 in use)
+fatal error: out of memory
+
+goroutine 1 [running]:
+runtime.throw({0x4a6e6b?, 0x4?})
+	/usr/local/go/src/runtime/panic.go:1023 +0x5c fp=0xc000069e68 sp=0xc000069e38 pc=0x43623c
+main.main()
+	/home/user/app/main.go:6 +0x1e fp=0xc000069f50 sp=0xc000069f28 pc=0x45a4de
+`
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected CrashKind
+	}{
+		{testPanicText, KindPanic},
+		{testDeadlockText, KindDeadlock},
+		{"fatal error: concurrent map writes\n", KindFatal},
+		{testOOMText, KindOutOfMemory},
+		{"fatal error: runtime: cannot allocate memory\n", KindOutOfMemory},
+	}
+
+	for _, tc := range cases {
+		if actual := classify(tc.text, parseValue(tc.text)); actual != tc.expected {
+			t.Fatalf("%q: %s != %s", tc.text, actual, tc.expected)
+		}
+	}
+}
+
+func TestSummarizeDeadlock(t *testing.T) {
+	d := summarizeDeadlock(parseGoroutines(testDeadlockText, nil))
+	if d.Goroutines != 3 {
+		t.Fatalf("bad: %#v", d)
+	}
+
+	expected := "3 goroutines: chan receive (2), sync.Mutex.Lock (1)"
+	if actual := d.String(); actual != expected {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	m := parseMemory(testOOMText)
+	if m.Requested != 1073741824 || m.InUse != 3976200192 {
+		t.Fatalf("bad: %#v", m)
+	}
+}
@@ -0,0 +1,136 @@
+package panicwrap
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// LeakConfig has the goroutine watchdog of the parent, which samples the
+// goroutine count of the child over the control channel and raises a
+// Leak once it grows steadily past a threshold, as an early warning
+// before the child runs out of memory. Heartbeats of the child count as
+// samples too.
+type LeakConfig struct {
+	// Threshold is the goroutine count past which growth is a leak. It
+	// must be set.
+	Threshold int
+
+	// Samples is how many samples in a row must never fall, growing
+	// overall, before a leak is raised. Defaults to 5.
+	Samples int
+
+	// Interval is how often the parent asks the child for a sample.
+	// Defaults to 30 seconds.
+	Interval time.Duration
+}
+
+// Leak is a steady growth of the goroutines of the child that the
+// watchdog of WrapConfig.LeakWatchdog found.
+type Leak struct {
+	// Goroutines are the goroutine counts of the samples that grew, the
+	// oldest first. The last one is past LeakConfig.Threshold.
+	Goroutines []int
+
+	// Metadata holds the entries the child set with SetMetadata up to
+	// the leak.
+	Metadata map[string]string
+
+	// PID is the process ID of the child, Worker the index of its worker
+	// and Time when the parent took the last sample.
+	PID    int
+	Worker int
+	Time   time.Time
+}
+
+// LeakHandlerFunc is the type called when the watchdog finds a leak.
+type LeakHandlerFunc func(*Leak)
+
+// sampleMessage carries the goroutine count of the child, in answer to a
+// messageSample of the parent or with a heartbeat.
+type sampleMessage struct {
+	Goroutines int `json:"goroutines,omitempty"`
+}
+
+// currentSample returns a sample of this process.
+func currentSample() sampleMessage {
+	return sampleMessage{Goroutines: runtime.NumGoroutine()}
+}
+
+// leakWatchdog keeps the samples of one child.
+type leakWatchdog struct {
+	l *LeakConfig
+
+	mu      sync.Mutex
+	samples []int
+}
+
+// add adds a sample, and returns the samples of a leak if it completes
+// one. The samples start over after a leak, so that it is raised again
+// only if the growth goes on for as long again.
+func (w *leakWatchdog) add(n int) []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) > 0 && n < w.samples[len(w.samples)-1] {
+		w.samples = w.samples[:0]
+	}
+	w.samples = append(w.samples, n)
+
+	want := w.l.Samples
+	if want == 0 {
+		want = 5
+	}
+	if len(w.samples) > want {
+		w.samples = append(w.samples[:0], w.samples[len(w.samples)-want:]...)
+	}
+	if len(w.samples) < want || n <= w.l.Threshold || n == w.samples[0] {
+		return nil
+	}
+
+	leak := append([]int(nil), w.samples...)
+	w.samples = append(w.samples[:0], n)
+	return leak
+}
+
+// sample asks the child for a sample every LeakConfig.Interval until the
+// control channel is closed.
+func (p *parentControl) sample() {
+	interval := p.c.LeakWatchdog.Interval
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+	for {
+		select {
+		case <-p.c.Clock.After(interval):
+		case <-p.done:
+			return
+		}
+		if p.send(messageSample, struct{}{}) != nil {
+			return
+		}
+	}
+}
+
+// addSample passes a sample of the child to the watchdog, and the leak it
+// completes, if any, to WrapConfig.LeakHandler.
+func (p *parentControl) addSample(m sampleMessage, pid int) {
+	if p.leaks == nil || m.Goroutines == 0 {
+		return
+	}
+
+	counts := p.leaks.add(m.Goroutines)
+	if counts == nil {
+		return
+	}
+	debugf(p.c, "the goroutines of child %d grew to %d", pid, m.Goroutines)
+	if p.c.LeakHandler != nil {
+		p.c.LeakHandler(&Leak{
+			Goroutines: counts,
+			Metadata:   p.copyMetadata(),
+			PID:        pid,
+			Worker:     p.worker,
+			Time:       p.c.Clock.Now(),
+		})
+	}
+}
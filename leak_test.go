@@ -0,0 +1,70 @@
+package panicwrap
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLeakWatchdog(t *testing.T) {
+	w := &leakWatchdog{l: &LeakConfig{Threshold: 10, Samples: 3}}
+
+	for _, n := range []int{5, 12, 11, 11, 11} {
+		if leak := w.add(n); leak != nil {
+			t.Fatalf("shouldn't leak at %d: %v", n, leak)
+		}
+	}
+	if leak := w.add(13); !reflect.DeepEqual(leak, []int{11, 11, 13}) {
+		t.Fatalf("bad: %v", leak)
+	}
+
+	// The samples start over after a leak.
+	if leak := w.add(14); leak != nil {
+		t.Fatalf("bad: %v", leak)
+	}
+	if leak := w.add(15); !reflect.DeepEqual(leak, []int{13, 14, 15}) {
+		t.Fatalf("bad: %v", leak)
+	}
+}
+
+func TestParentControl_leak(t *testing.T) {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer inR.Close()
+
+	clock := newFakeClock()
+	var leak *Leak
+	c := &WrapConfig{
+		Clock:        clock,
+		LeakWatchdog: &LeakConfig{Threshold: 100, Samples: 2, Interval: time.Minute},
+		LeakHandler:  func(l *Leak) { leak = l },
+	}
+	p := newParentControl(c, 1, nil, outR, inW)
+
+	// Play the child.
+	writeMessage(outW, messageHandshake, handshakeMessage{Version: protocolVersion, PID: 42})
+	if typ, _, err := readMessage(inR); err != nil || typ != messageHandshake {
+		t.Fatalf("bad: %d, %v", typ, err)
+	}
+	writeMessage(outW, messageHeartbeat, sampleMessage{Goroutines: 90})
+
+	<-clock.waiting
+	clock.Advance(time.Minute)
+	if typ, _, err := readMessage(inR); err != nil || typ != messageSample {
+		t.Fatalf("bad: %d, %v", typ, err)
+	}
+	writeMessage(outW, messageSample, sampleMessage{Goroutines: 150})
+	outW.Close()
+
+	p.close()
+	if leak == nil || !reflect.DeepEqual(leak.Goroutines, []int{90, 150}) || leak.PID != 42 || leak.Worker != 1 {
+		t.Fatalf("bad: %#v", leak)
+	}
+}
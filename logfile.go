@@ -0,0 +1,136 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LogConfig configures the log file the parent tees the output of the
+// child into. It is only used if WrapConfig.Log is set.
+type LogConfig struct {
+	// Path is the path of the log file. Rotated files are kept next to it
+	// with the time of the rotation appended to the name, such as
+	// "app.log.20060102-150405.000".
+	Path string
+
+	// If greater than zero, the log file is rotated before it grows
+	// larger than this many bytes.
+	MaxSize int64
+
+	// If greater than zero, the log file is rotated once it is this old.
+	MaxAge time.Duration
+
+	// If greater than zero, only this many rotated files are kept and
+	// older ones are removed.
+	MaxFiles int
+}
+
+// rotatedTimeFormat is appended to the names of rotated log files. It
+// sorts in time order.
+const rotatedTimeFormat = "20060102-150405.000"
+
+// rotatingFile is the log file of a LogConfig. Writing to it never fails,
+// so that the logging can't get in the way of forwarding the output.
+type rotatingFile struct {
+	mu     sync.Mutex
+	config LogConfig
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(config *LogConfig) (*rotatingFile, error) {
+	r := &rotatingFile{config: *config}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	r.f, r.size, r.opened = f, 0, time.Now()
+	if fi, err := f.Stat(); err == nil {
+		r.size = fi.Size()
+	}
+
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil && r.size > 0 && r.needsRotation(len(p)) {
+		r.rotate()
+	}
+	if r.f == nil {
+		// Rotating failed to open a new file. Try again with every
+		// write, since this may be temporary.
+		if r.open() != nil {
+			return len(p), nil
+		}
+	}
+
+	n, _ := r.f.Write(p)
+	r.size += int64(n)
+	return len(p), nil
+}
+
+func (r *rotatingFile) needsRotation(n int) bool {
+	c := r.config
+	return (c.MaxSize > 0 && r.size+int64(n) > c.MaxSize) ||
+		(c.MaxAge > 0 && time.Since(r.opened) >= c.MaxAge)
+}
+
+// rotate moves the current log file aside, opens a new one and removes the
+// rotated files beyond MaxFiles.
+func (r *rotatingFile) rotate() {
+	r.f.Close()
+	r.f = nil
+
+	rotated := r.config.Path + "." + time.Now().Format(rotatedTimeFormat)
+	if os.Rename(r.config.Path, rotated) != nil {
+		return
+	}
+	r.open()
+
+	if r.config.MaxFiles <= 0 {
+		return
+	}
+
+	var files []string
+	matches, _ := filepath.Glob(r.config.Path + ".*")
+	for _, m := range matches {
+		suffix := m[len(r.config.Path)+1:]
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			files = append(files, m)
+		}
+	}
+
+	sort.Strings(files)
+	for len(files) > r.config.MaxFiles {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
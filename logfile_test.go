@@ -0,0 +1,94 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := openRotatingFile(&LogConfig{Path: path, MaxSize: 10, MaxFiles: 2})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	for _, s := range []string{"aaaaaaaa", "bbbbbbbb", "cccccccc", "dddddddd"} {
+		// Rotated files are named after the time of the rotation.
+		time.Sleep(2 * time.Millisecond)
+		if n, err := r.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("bad: %d, %s", n, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "dddddddd" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Fatalf("should keep 2 rotated files: %v", rotated)
+	}
+	data, err = os.ReadFile(rotated[0])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "bbbbbbbb" {
+		t.Fatalf("should remove the oldest file: %q", data)
+	}
+}
+
+func TestRotatingFile_age(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := openRotatingFile(&LogConfig{Path: path, MaxAge: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("old\n"))
+	r.Write([]byte("old\n"))
+	time.Sleep(20 * time.Millisecond)
+	r.Write([]byte("new\n"))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "new\n" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 1 {
+		t.Fatalf("bad: %v", rotated)
+	}
+}
+
+func TestRotatingFile_append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("before\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r, err := openRotatingFile(&LogConfig{Path: path})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.Write([]byte("after\n"))
+	r.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "before\nafter\n" {
+		t.Fatalf("bad: %q", data)
+	}
+}
@@ -0,0 +1,130 @@
+package panicwrap
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// budgetUse is what the parent holds output in memory for, in the order
+// in which they give way once WrapConfig.MemoryBudget runs out.
+type budgetUse int
+
+const (
+	// useRecording is the end of stderr kept for RecordDir.
+	useRecording budgetUse = iota
+
+	// useStartup is the output held back for DetectStartup.
+	useStartup
+
+	// usePanic is the text of a panic while it is being detected.
+	usePanic
+)
+
+// droppedLine ends the text of a panic that was cut short by the memory
+// budget.
+const droppedLine = "\n[panicwrap: %d more bytes of this crash were dropped: out of MemoryBudget]\n"
+
+// budgetShare is the part of the budget, in quarters, up to which each use
+// may take it, together with the others. Recordings stop growing at half
+// of the budget and held startup output at three quarters, so that what
+// is left goes to panics.
+var budgetShare = [...]int64{
+	useRecording: 2,
+	useStartup:   3,
+	usePanic:     4,
+}
+
+// memoryBudget caps the output that the parent holds in memory for all of
+// its children. See WrapConfig.MemoryBudget. A nil budget has no cap.
+type memoryBudget struct {
+	max  int64
+	used atomic.Int64
+}
+
+// newMemoryBudget returns the budget of the configuration, which is what
+// is left of MemoryBudget after the read buffers, or nil if it has none.
+func newMemoryBudget(c *WrapConfig) *memoryBudget {
+	if c.MemoryBudget == 0 {
+		return nil
+	}
+	return &memoryBudget{max: int64(c.MemoryBudget) - readBuffersSize(c)}
+}
+
+// reserve takes n bytes from the budget for the given use, and returns
+// false if there aren't enough left for it.
+func (b *memoryBudget) reserve(use budgetUse, n int) bool {
+	if b == nil {
+		return true
+	}
+
+	limit := b.max * budgetShare[use] / 4
+	for {
+		used := b.used.Load()
+		if used+int64(n) > limit {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+// reserveUpTo takes up to n bytes from the budget for the given use, and
+// returns how many it took.
+func (b *memoryBudget) reserveUpTo(use budgetUse, n int) int {
+	if b == nil {
+		return n
+	}
+
+	limit := b.max * budgetShare[use] / 4
+	for {
+		used := b.used.Load()
+		took := min(int64(n), max(limit-used, 0))
+		if took == 0 || b.used.CompareAndSwap(used, used+took) {
+			return int(took)
+		}
+	}
+}
+
+// release returns n bytes to the budget.
+func (b *memoryBudget) release(n int) {
+	if b != nil {
+		b.used.Add(-int64(n))
+	}
+}
+
+// inUse returns the number of bytes taken from the budget.
+func (b *memoryBudget) inUse() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
+
+// readBuffersSize returns the memory of the read buffers of all children,
+// which the parent needs whatever their output.
+func readBuffersSize(c *WrapConfig) int64 {
+	size := func(b *StreamBuffers, def int) int64 {
+		if b != nil && b.ReadSize > 0 {
+			return int64(b.ReadSize)
+		}
+		return int64(def)
+	}
+
+	// The stderr of the child is read twice: once from the pipe, and
+	// once more by the panic detection.
+	perChild := size(c.StdoutBuffers, 32<<10) + size(c.StderrBuffers, 32<<10) + size(c.StderrBuffers, defaultTrackSize)
+	return perChild * int64(max(c.Workers, 1))
+}
+
+// validateMemoryBudget checks that the budget leaves room for more than
+// the read buffers.
+func validateMemoryBudget(c *WrapConfig) error {
+	if c.MemoryBudget < 0 {
+		return fmt.Errorf("MemoryBudget must not be negative, got %d", c.MemoryBudget)
+	}
+	if c.MemoryBudget > 0 && int64(c.MemoryBudget) <= readBuffersSize(c) {
+		return fmt.Errorf("MemoryBudget must be more than the %d bytes of the read buffers", readBuffersSize(c))
+	}
+	return nil
+}
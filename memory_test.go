@@ -0,0 +1,116 @@
+package panicwrap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	b := &memoryBudget{max: 400}
+
+	if !b.reserve(useRecording, 200) || b.reserve(useRecording, 1) {
+		t.Fatal("recordings should stop at half")
+	}
+	if !b.reserve(useStartup, 100) || b.reserve(useStartup, 1) {
+		t.Fatal("startup output should stop at three quarters")
+	}
+	if !b.reserve(usePanic, 100) || b.reserve(usePanic, 1) {
+		t.Fatal("panics should stop at the budget")
+	}
+
+	b.release(400)
+	if b.inUse() != 0 {
+		t.Fatalf("bad: %d", b.inUse())
+	}
+
+	var none *memoryBudget
+	if !none.reserve(usePanic, 1<<30) {
+		t.Fatal("no budget should have no cap")
+	}
+}
+
+func TestRecorder_budget(t *testing.T) {
+	b := &memoryBudget{max: 40}
+	r := &recorder{max: 100, budget: b}
+	r.Write([]byte(strings.Repeat("a", 15)))
+	r.Write([]byte("bcdefghij"))
+
+	if string(r.bytes()) != "aaaaaaaaaaabcdefghij" || b.inUse() != 20 {
+		t.Fatalf("should keep what the budget has room for: %q, %d", r.bytes(), b.inUse())
+	}
+
+	r.free()
+	if b.inUse() != 0 {
+		t.Fatalf("bad: %d", b.inUse())
+	}
+}
+
+func TestStartupWriter_budget(t *testing.T) {
+	out := new(bytes.Buffer)
+	b := &memoryBudget{max: 8}
+	s := &startupWriter{w: out, budget: b}
+
+	s.Write([]byte("early\n"))
+	s.Write([]byte("later\n"))
+	if out.String() != "early\nlater\n" {
+		t.Fatalf("should let the output through: %q", out.String())
+	}
+
+	output, failed := s.finish(true)
+	if !failed || output != "early\n" || b.inUse() != 0 {
+		t.Fatalf("bad: %t %q %d", failed, output, b.inUse())
+	}
+}
+
+func TestTrackPanic_budget(t *testing.T) {
+	b := &memoryBudget{max: 64}
+	out := new(bytes.Buffer)
+	result := make(chan string, 1)
+	r := &chunkReader{chunks: []string{"starting\n", "panic: boom\n\n", strings.Repeat("x", 100)}}
+	trackPanic(r, out, time.Minute, 0, realClock{}, defaultTrackSize, false, headerRules{}, nil, b, result)
+
+	text := <-result
+	if text != "panic: boom\n\n"+fmt.Sprintf(droppedLine, 100) {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "starting\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+	if b.inUse() != 0 {
+		t.Fatalf("should release the budget: %d", b.inUse())
+	}
+}
+
+func TestTrackPanic_budgetExhausted(t *testing.T) {
+	b := &memoryBudget{max: 64}
+	b.reserve(usePanic, 60)
+	out := new(bytes.Buffer)
+	result := make(chan string, 1)
+	r := &chunkReader{chunks: []string{"starting\n", "panic: boom\n\n"}}
+	trackPanic(r, out, time.Minute, 0, realClock{}, defaultTrackSize, false, headerRules{}, nil, b, result)
+
+	if text, ok := <-result; ok {
+		t.Fatalf("shouldn't be tracked: %q", text)
+	}
+	if out.String() != "starting\npanic: boom\n\n" {
+		t.Fatalf("should forward the panic: %q", out.String())
+	}
+}
+
+// chunkReader returns one chunk per read.
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
@@ -0,0 +1,120 @@
+package panicwrap
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// BuildInfo describes the binary that panicked, as recorded by the Go
+// toolchain at build time. This is what is needed to tell which release is
+// crashing and to symbolicate its stacks.
+type BuildInfo struct {
+	// Path is the package path of the main package and Module the path
+	// of the main module, with its Version.
+	Path    string `json:"path"`
+	Module  string `json:"module"`
+	Version string `json:"version"`
+
+	// GoVersion is the version of the Go toolchain that built the binary.
+	GoVersion string `json:"go_version"`
+
+	// Revision and Time identify the version control commit the binary
+	// was built from. Modified is true if the working tree had local
+	// changes. These are empty if the binary was built without VCS info.
+	Revision string    `json:"revision"`
+	Time     time.Time `json:"time"`
+	Modified bool      `json:"modified"`
+}
+
+// readBuildInfo returns the BuildInfo of the running binary, which is the
+// same binary as the child, or nil if it isn't available.
+func readBuildInfo() *BuildInfo {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	result := &BuildInfo{
+		Path:      bi.Path,
+		Module:    bi.Main.Path,
+		Version:   bi.Main.Version,
+		GoVersion: bi.GoVersion,
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			result.Revision = s.Value
+		case "vcs.time":
+			result.Time, _ = time.Parse(time.RFC3339, s.Value)
+		case "vcs.modified":
+			result.Modified = s.Value == "true"
+		}
+	}
+
+	return result
+}
+
+// captureEnv returns the variables of the child's environment whose names
+// match one of the given patterns. Patterns are either exact names or
+// path.Match patterns such as "DEPLOY_*". It returns nil if nothing
+// matches, which is always the case with no patterns.
+func captureEnv(patterns []string) map[string]string {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	var result map[string]string
+	for _, kv := range os.Environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+
+		for _, p := range patterns {
+			if matched, _ := path.Match(p, k); matched {
+				if result == nil {
+					result = make(map[string]string)
+				}
+				result[k] = v
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// HostInfo describes the machine the child runs on.
+type HostInfo struct {
+	Hostname string `json:"hostname"`
+
+	// OS and Arch are the GOOS and GOARCH of the binary.
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+
+	// Kernel is the kernel release, such as "6.1.0-18-amd64". It is only
+	// filled in on Linux.
+	Kernel string `json:"kernel"`
+
+	// Container is a hint about the container runtime the child runs
+	// under, such as "docker", "podman" or "kubernetes". It is empty if
+	// no container runtime was detected.
+	Container string `json:"container"`
+}
+
+// readHostInfo gathers the HostInfo of the current machine. Anything that
+// can't be determined is left empty.
+func readHostInfo() *HostInfo {
+	hostname, _ := os.Hostname()
+	return &HostInfo{
+		Hostname:  hostname,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Kernel:    kernelVersion(),
+		Container: containerRuntime(),
+	}
+}
@@ -0,0 +1,44 @@
+package panicwrap
+
+import (
+	"os"
+	"strings"
+)
+
+func kernelVersion() string {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func containerRuntime() string {
+	// Kubernetes injects this into every pod, whatever the runtime is.
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+
+	data, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return ""
+	}
+
+	cgroup := string(data)
+	for _, name := range []string{"docker", "containerd", "lxc"} {
+		if strings.Contains(cgroup, name) {
+			return name
+		}
+	}
+
+	return ""
+}
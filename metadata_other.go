@@ -0,0 +1,11 @@
+//go:build !linux
+
+package panicwrap
+
+func kernelVersion() string {
+	return ""
+}
+
+func containerRuntime() string {
+	return ""
+}
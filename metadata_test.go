@@ -0,0 +1,44 @@
+package panicwrap
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestReadBuildInfo(t *testing.T) {
+	bi := readBuildInfo()
+	if bi == nil {
+		t.Skip("no build info available")
+	}
+
+	if bi.GoVersion != runtime.Version() {
+		t.Fatalf("bad: %#v", bi)
+	}
+}
+
+func TestCaptureEnv(t *testing.T) {
+	t.Setenv("PANICWRAP_TEST_REGION", "eu")
+	t.Setenv("PANICWRAP_TEST_DEPLOY_ENV", "prod")
+	t.Setenv("PANICWRAP_TEST_SECRET", "hunter2")
+
+	env := captureEnv([]string{"PANICWRAP_TEST_REGION", "PANICWRAP_TEST_DEPLOY_*"})
+	expected := map[string]string{
+		"PANICWRAP_TEST_REGION":     "eu",
+		"PANICWRAP_TEST_DEPLOY_ENV": "prod",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("bad: %#v", env)
+	}
+
+	if env := captureEnv(nil); env != nil {
+		t.Fatalf("bad: %#v", env)
+	}
+}
+
+func TestReadHostInfo(t *testing.T) {
+	host := readHostInfo()
+	if host.OS != runtime.GOOS || host.Arch != runtime.GOARCH {
+		t.Fatalf("bad: %#v", host)
+	}
+}
@@ -0,0 +1,21 @@
+package panicwrap
+
+// Namespaces is a set of Linux namespaces. See WrapConfig.Namespaces.
+type Namespaces int
+
+const (
+	// NamespaceMount gives the child its own mount table, so that what
+	// it mounts and unmounts doesn't affect the host.
+	NamespaceMount Namespaces = 1 << iota
+
+	// NamespacePID gives the child its own process IDs, in which it is
+	// process 1 and can't see or signal the other processes of the host.
+	// PanicInfo.PID is still the process ID as the parent sees it, but
+	// the child sees no parent, so VerifyParent can't be used with it.
+	NamespacePID
+
+	// NamespaceNetwork gives the child its own network stack, which has
+	// no interfaces other than a loopback that is down, cutting it off
+	// the network.
+	NamespaceNetwork
+)
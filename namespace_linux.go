@@ -0,0 +1,26 @@
+package panicwrap
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setNamespaces makes the command run in new namespaces of the given
+// kinds.
+func setNamespaces(cmd *exec.Cmd, ns Namespaces) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+
+	if ns&NamespaceMount != 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	}
+	if ns&NamespacePID != 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWPID
+	}
+	if ns&NamespaceNetwork != 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package panicwrap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestWrap_namespaces(t *testing.T) {
+	e := &fakeExecutor{}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:    func(string) {},
+		Namespaces: NamespacePID | NamespaceNetwork,
+		Executor:   e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if e.cmd.SysProcAttr.Cloneflags != syscall.CLONE_NEWPID|syscall.CLONE_NEWNET {
+		t.Fatalf("bad: %x", e.cmd.SysProcAttr.Cloneflags)
+	}
+}
+
+func TestWrap_namespacesVerifyParent(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:      func(string) {},
+		Namespaces:   NamespacePID,
+		VerifyParent: true,
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestPanicWrap_namespaces(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root")
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("namespaces")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s\n%s", err, stderr)
+	}
+
+	mnt, _ := os.Readlink("/proc/self/ns/mnt")
+	net, _ := os.Readlink("/proc/self/ns/net")
+	var pid int
+	var childMnt, childNet string
+	if _, err := fmt.Sscanf(stdout.String(), "%d %s %s", &pid, &childMnt, &childNet); err != nil {
+		t.Fatalf("err: %s: %#v", err, stdout.String())
+	}
+
+	if pid != 1 {
+		t.Fatalf("should be process 1: %d", pid)
+	}
+	if childMnt == mnt || childNet == net {
+		t.Fatalf("should be in new namespaces: %s %s", childMnt, childNet)
+	}
+}
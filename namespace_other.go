@@ -0,0 +1,12 @@
+//go:build !linux
+
+package panicwrap
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setNamespaces(*exec.Cmd, Namespaces) error {
+	return errors.New("panicwrap: Namespaces are only supported on Linux")
+}
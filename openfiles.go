@@ -0,0 +1,20 @@
+package panicwrap
+
+// OpenFile is a file descriptor the child had open when it crashed. See
+// WrapConfig.OpenFiles.
+type OpenFile struct {
+	// FD is the number of the descriptor.
+	FD int `json:"fd"`
+
+	// Type is the type of the descriptor, as in FDWarning.Types.
+	Type string `json:"type"`
+
+	// Target is what the descriptor refers to, such as the path of a
+	// file or "socket:[12345]".
+	Target string `json:"target"`
+
+	// Socket describes the socket the descriptor refers to, if it could
+	// be found, such as "tcp 127.0.0.1:8080->10.0.0.2:5432 ESTABLISHED"
+	// or "unix /run/app.sock".
+	Socket string `json:"socket,omitempty"`
+}
@@ -0,0 +1,154 @@
+package panicwrap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// readOpenFiles lists the open file descriptors of the process, from the
+// links of its fd directory, and describes its sockets from the socket
+// tables of its network namespace, like lsof does.
+func readOpenFiles(pid int) ([]OpenFile, error) {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sockets map[string]string
+	files := make([]OpenFile, 0, len(entries))
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// A descriptor closed since the directory was read is skipped.
+		target, err := os.Readlink(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+
+		f := OpenFile{FD: fd, Type: fdType(target), Target: target}
+		if inode, ok := socketInode(target); ok {
+			if sockets == nil {
+				sockets = readSockets(pid)
+			}
+			f.Socket = sockets[inode]
+		}
+		files = append(files, f)
+	}
+	slices.SortFunc(files, func(a, b OpenFile) int { return a.FD - b.FD })
+
+	return files, nil
+}
+
+// socketInode returns the inode of the socket a descriptor link such as
+// "socket:[12345]" refers to.
+func socketInode(target string) (string, bool) {
+	rest, ok := strings.CutPrefix(target, "socket:[")
+	if !ok {
+		return "", false
+	}
+	return strings.CutSuffix(rest, "]")
+}
+
+// readSockets describes the sockets in the network namespace of the
+// process by inode. Tables that can't be read are skipped.
+func readSockets(pid int) map[string]string {
+	sockets := make(map[string]string)
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/net/%s", pid, proto))
+		if err != nil {
+			continue
+		}
+		parseInetSockets(sockets, strings.TrimSuffix(proto, "6"), data)
+	}
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/net/unix", pid)); err == nil {
+		parseUnixSockets(sockets, data)
+	}
+	return sockets
+}
+
+// tcpStates are the names of the states of the tcp tables.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// parseInetSockets adds the sockets of a tcp or udp table to sockets.
+func parseInetSockets(sockets map[string]string, proto string, data []byte) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Scan() // The header.
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, remote := inetAddr(fields[1]), inetAddr(fields[2])
+		desc := proto + " " + local
+		if !strings.HasSuffix(remote, ":0") {
+			desc += "->" + remote
+		}
+		if state, ok := tcpStates[fields[3]]; ok && proto == "tcp" {
+			desc += " " + state
+		}
+		sockets[fields[9]] = desc
+	}
+}
+
+// inetAddr formats an address of the tcp and udp tables, such as
+// "0100007F:1F90", which holds the IP address as 32-bit words in host
+// byte order.
+func inetAddr(s string) string {
+	ip, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return s
+	}
+	b, err := hex.DecodeString(ip)
+	if err != nil || len(b)%4 != 0 {
+		return s
+	}
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(b[i:], binary.NativeEndian.Uint32(b[i:]))
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return s
+	}
+	return net.JoinHostPort(net.IP(b).String(), strconv.FormatUint(p, 10))
+}
+
+// parseUnixSockets adds the sockets of the unix table to sockets.
+func parseUnixSockets(sockets map[string]string, data []byte) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Scan() // The header.
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		desc := "unix"
+		if len(fields) > 7 {
+			desc += " " + fields[7]
+		}
+		sockets[fields[6]] = desc
+	}
+}
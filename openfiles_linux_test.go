@@ -0,0 +1,61 @@
+package panicwrap
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadOpenFiles(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer l.Close()
+
+	files, err := readOpenFiles(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	want := "tcp " + l.Addr().String() + " LISTEN"
+	found := false
+	for _, f := range files {
+		if f.Socket == want {
+			found = f.Type == "socket" && strings.HasPrefix(f.Target, "socket:[")
+		}
+	}
+	if !found {
+		t.Fatalf("should describe the listener as %q: %#v", want, files)
+	}
+}
+
+func TestParseInetSockets(t *testing.T) {
+	data := []byte(`  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1111 1 0 100 0 0 10 0
+   1: 0100007F:C350 0200000A:1538 01 00000000:00000000 00:00000000 00000000     0        0 2222 1 0 20 4 30 10 -1
+`)
+	sockets := make(map[string]string)
+	parseInetSockets(sockets, "tcp", data)
+
+	if sockets["1111"] != "tcp 127.0.0.1:8080 LISTEN" {
+		t.Fatalf("bad: %q", sockets["1111"])
+	}
+	if sockets["2222"] != "tcp 127.0.0.1:50000->10.0.0.2:5432 ESTABLISHED" {
+		t.Fatalf("bad: %q", sockets["2222"])
+	}
+}
+
+func TestParseUnixSockets(t *testing.T) {
+	data := []byte(`Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 3333 /run/app.sock
+0000000000000000: 00000003 00000000 00000000 0001 03 4444
+`)
+	sockets := make(map[string]string)
+	parseUnixSockets(sockets, data)
+
+	if sockets["3333"] != "unix /run/app.sock" || sockets["4444"] != "unix" {
+		t.Fatalf("bad: %#v", sockets)
+	}
+}
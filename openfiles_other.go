@@ -0,0 +1,9 @@
+//go:build !linux
+
+package panicwrap
+
+import "errors"
+
+func readOpenFiles(int) ([]OpenFile, error) {
+	return nil, errors.New("panicwrap: OpenFiles isn't supported on this platform")
+}
@@ -0,0 +1,110 @@
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The environment variables that override the WrapConfig, so that
+// operators can tune a program without rebuilding it. They are read by
+// Wrap unless WrapConfig.IgnoreEnv is set. An invalid value makes Wrap
+// fail.
+const (
+	// EnvDetectDuration overrides DetectDuration, such as "500ms".
+	EnvDetectDuration = "PANICWRAP_DETECT_DURATION"
+
+	// EnvDetectTimeout overrides DetectTimeout, "flush" or "crash".
+	EnvDetectTimeout = "PANICWRAP_DETECT_TIMEOUT"
+
+	// EnvHidePanic overrides HidePanic, such as "true" or "0".
+	EnvHidePanic = "PANICWRAP_HIDE_PANIC"
+
+	// EnvDebug overrides Debug.
+	EnvDebug = "PANICWRAP_DEBUG"
+
+	// EnvDrainTimeout overrides DrainTimeout.
+	EnvDrainTimeout = "PANICWRAP_DRAIN_TIMEOUT"
+
+	// EnvDedupWindow overrides DedupWindow.
+	EnvDedupWindow = "PANICWRAP_DEDUP_WINDOW"
+
+	// EnvSuppressAfter overrides SuppressAfter.
+	EnvSuppressAfter = "PANICWRAP_SUPPRESS_AFTER"
+
+	// EnvGoTraceback overrides GoTraceback.
+	EnvGoTraceback = "PANICWRAP_GOTRACEBACK"
+)
+
+// applyEnvOverrides sets the fields of the configuration that are
+// overridden in the environment.
+func applyEnvOverrides(c *WrapConfig) error {
+	durations := []struct {
+		key   string
+		field *time.Duration
+	}{
+		{EnvDetectDuration, &c.DetectDuration},
+		{EnvDrainTimeout, &c.DrainTimeout},
+		{EnvDedupWindow, &c.DedupWindow},
+	}
+	for _, d := range durations {
+		if v, ok := os.LookupEnv(d.key); ok {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed < 0 {
+				return fmt.Errorf("invalid %s %q", d.key, v)
+			}
+			*d.field = parsed
+		}
+	}
+
+	bools := []struct {
+		key   string
+		field *bool
+	}{
+		{EnvHidePanic, &c.HidePanic},
+		{EnvDebug, &c.Debug},
+	}
+	for _, b := range bools {
+		if v, ok := os.LookupEnv(b.key); ok {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", b.key, v)
+			}
+			*b.field = parsed
+		}
+	}
+
+	if v, ok := os.LookupEnv(EnvSuppressAfter); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s %q", EnvSuppressAfter, v)
+		}
+		c.SuppressAfter = n
+	}
+
+	if v, ok := os.LookupEnv(EnvDetectTimeout); ok {
+		switch v {
+		case "flush":
+			c.DetectTimeout = DetectTimeoutFlush
+		case "crash":
+			c.DetectTimeout = DetectTimeoutCrash
+		default:
+			return fmt.Errorf("invalid %s %q", EnvDetectTimeout, v)
+		}
+	}
+
+	if v, ok := os.LookupEnv(EnvGoTraceback); ok {
+		c.GoTraceback = v
+	}
+
+	return nil
+}
+
+// debugf prints what the parent does to stderr if WrapConfig.Debug is
+// set.
+func debugf(c *WrapConfig, format string, args ...interface{}) {
+	if c.Debug {
+		fmt.Fprintf(os.Stderr, "panicwrap: "+format+"\n", args...)
+	}
+}
@@ -0,0 +1,62 @@
+package panicwrap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyEnvOverrides(t *testing.T) {
+	t.Setenv(EnvDetectDuration, "1s")
+	t.Setenv(EnvHidePanic, "true")
+	t.Setenv(EnvDebug, "1")
+	t.Setenv(EnvSuppressAfter, "3")
+	t.Setenv(EnvGoTraceback, "all")
+	t.Setenv(EnvDetectTimeout, "crash")
+
+	c := &WrapConfig{DetectDuration: time.Millisecond, SuppressAfter: 10}
+	if err := applyEnvOverrides(c); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.DetectDuration != time.Second || !c.HidePanic || !c.Debug || c.SuppressAfter != 3 || c.GoTraceback != "all" || c.DetectTimeout != DetectTimeoutCrash {
+		t.Fatalf("bad: %#v", c)
+	}
+	if c.DrainTimeout != 0 || c.DedupWindow != 0 {
+		t.Fatalf("should leave the rest alone: %#v", c)
+	}
+}
+
+func TestApplyEnvOverrides_invalid(t *testing.T) {
+	cases := []struct {
+		key, value string
+	}{
+		{EnvDetectDuration, "soon"},
+		{EnvDrainTimeout, "-1s"},
+		{EnvHidePanic, "maybe"},
+		{EnvSuppressAfter, "-1"},
+		{EnvDetectTimeout, "hold"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.key, func(t *testing.T) {
+			t.Setenv(tc.key, tc.value)
+			if err := applyEnvOverrides(new(WrapConfig)); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+}
+
+func TestWrap_ignoreEnv(t *testing.T) {
+	t.Setenv(EnvDetectDuration, "soon")
+
+	_, _, err := Wrap(&WrapConfig{Handler: func(string) {}, Executor: &fakeExecutor{}})
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	_, _, err = Wrap(&WrapConfig{Handler: func(string) {}, Executor: &fakeExecutor{}, IgnoreEnv: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,425 @@
+package panicwrap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PanicInfo is the structured form of a detected panic. It is what an
+// InfoHandler receives.
+type PanicInfo struct {
+	// Text is the raw panic output, exactly as it is passed to Handler.
+	Text string `json:"text"`
+
+	// Value is the panic value or fatal error message: the text after
+	// "panic: " or "fatal error: ", which may span multiple lines.
+	Value string `json:"value"`
+
+	// Values are all panic values, in the order they were raised. There
+	// is more than one if a panic was recovered and re-raised, or another
+	// panic was raised while it was unwinding, as is common with
+	// middleware. Value is the first of them.
+	Values []string `json:"values,omitempty"`
+
+	// Synthetic is true for fake panics passed to InjectCrash.
+	Synthetic bool `json:"synthetic"`
+
+	// Subprocess is true for the crash of a process the child started
+	// with StartSubprocess. See WrapConfig.SubprocessHandler.
+	Subprocess bool `json:"subprocess"`
+
+	// Recovered is true for a panic that the child recovered from and
+	// reported with ReportRecovered, rather than one it crashed with.
+	// Request is the HTTP request or gRPC call it was serving, if it was
+	// reported by panicwraphttp or panicwrapgrpc.
+	Recovered bool         `json:"recovered"`
+	Request   *RequestInfo `json:"request,omitempty"`
+
+	// Kind classifies the crash.
+	Kind CrashKind `json:"kind"`
+
+	// Severity is how urgent the crash is, according to its Kind and
+	// WrapConfig.Severities.
+	Severity Severity `json:"severity,omitempty"`
+
+	// Deadlock summarizes the blocked goroutines if Kind is
+	// KindDeadlock, and is nil otherwise.
+	Deadlock *DeadlockInfo `json:"deadlock,omitempty"`
+
+	// Memory holds the heap numbers printed by the runtime if Kind is
+	// KindOutOfMemory, and is nil otherwise.
+	Memory *MemoryInfo `json:"memory,omitempty"`
+
+	// ExitStatus is the exit status of the child process that panicked.
+	ExitStatus int `json:"exit_status"`
+
+	// Signal is the number of the signal that killed the child, or 0 if
+	// it exited by itself.
+	Signal int `json:"signal"`
+
+	// Restarts is the number of times the child had already been
+	// restarted under WrapConfig.Restart when it panicked, since it last
+	// ran for RestartPolicy.ResetAfter if that is set. It is 0 for the
+	// first child.
+	Restarts int `json:"restarts"`
+
+	// SinceFirstCrash is the time elapsed since the first crash of the
+	// current crash loop, meaning the first time the child exited with a
+	// non-zero status under this parent, or since it last ran for
+	// RestartPolicy.ResetAfter. It is 0 for the first crash.
+	SinceFirstCrash time.Duration `json:"since_first_crash"`
+
+	// Backoff is the delay before the child is restarted. It is 0 if the
+	// child won't be restarted.
+	Backoff time.Duration `json:"backoff"`
+
+	// SafeMode is the safe mode the child is restarted in after this
+	// crash, if RestartPolicy.SafeMode is set and the crashes put it
+	// there. It is nil if the child is restarted normally.
+	SafeMode *SafeModeInfo `json:"safe_mode,omitempty"`
+
+	// Fingerprint identifies the panic independently of the things that
+	// change between runs of the same bug, such as goroutine IDs, pointer
+	// values and program counter offsets. Identical crashes share it.
+	Fingerprint string `json:"fingerprint"`
+
+	// Occurrence is the number of times a panic with this Fingerprint has
+	// been seen by this parent within WrapConfig.DedupWindow, including
+	// this one. It is 1 the first time a panic is seen.
+	Occurrence int `json:"occurrence"`
+
+	// RateLimited is the number of crashes whose handlers weren't called
+	// because of WrapConfig.HandlerLimit since the previous crash whose
+	// handlers were.
+	RateLimited int `json:"rate_limited,omitempty"`
+
+	// State is the crash state kept in WrapConfig.StateFile, including
+	// this panic. It is nil if no StateFile is configured or it couldn't
+	// be updated.
+	State *CrashState `json:"state,omitempty"`
+
+	// Build describes the binary that panicked. It is nil if the binary
+	// was built without module support.
+	Build *BuildInfo `json:"build,omitempty"`
+
+	// Env holds the variables of the child's environment that were
+	// allowed by WrapConfig.CaptureEnv.
+	Env map[string]string `json:"env,omitempty"`
+
+	// Host describes the machine the child ran on.
+	Host *HostInfo `json:"host,omitempty"`
+
+	// Executable is the path of the binary that crashed.
+	Executable string `json:"executable"`
+
+	// ExecutableModTime is when the binary was last modified as of the
+	// start of the child, and ExecutableSHA256 its hex encoded SHA-256
+	// digest. The digest is empty if the binary changed on disk since the
+	// child started, such as during a deploy, or couldn't be read.
+	ExecutableModTime time.Time `json:"executable_mod_time"`
+	ExecutableSHA256  string    `json:"executable_sha256"`
+
+	// Args are the command line arguments of the child, starting with the
+	// path it was started as.
+	Args []string `json:"args,omitempty"`
+
+	// GoTraceback is the GOTRACEBACK level the child ran with, which
+	// decides which goroutines and frames the panic text includes. See
+	// WrapConfig.GoTraceback.
+	GoTraceback string `json:"go_traceback"`
+
+	// PID is the process ID of the child that panicked and ParentPID the
+	// process ID of the wrapping parent.
+	PID       int `json:"pid"`
+	ParentPID int `json:"parent_pid"`
+
+	// StartTime is when the parent started the child. Along with PID, it
+	// finds the logs of the same process, such as in journald. It is zero
+	// for InjectCrash and Replay.
+	StartTime time.Time `json:"start_time"`
+
+	// RunID is the ID of the start of the child that panicked, which the
+	// child reads with RunID. It is empty for InjectCrash and Replay.
+	RunID string `json:"run_id"`
+
+	// TraceParent is the W3C traceparent the parent passed to the child.
+	// See WrapConfig.TraceContext.
+	TraceParent string `json:"trace_parent"`
+
+	// Worker is the index of the worker that panicked if the parent runs
+	// several. See WrapConfig.Workers.
+	Worker int `json:"worker"`
+
+	// Metadata holds the entries the child set with SetMetadata before it
+	// panicked. See WrapConfig.Control.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Goroutines are the parsed goroutine stacks of the panic. The first
+	// one is the goroutine that panicked.
+	Goroutines []Goroutine `json:"goroutines,omitempty"`
+
+	// Source holds the source code around the frame that panicked if
+	// WrapConfig.SourceContext is set and the source could be read.
+	Source *SourceSnippet `json:"source,omitempty"`
+
+	// Core describes the core file the child dumped, if it did. See
+	// WrapConfig.CoreDir.
+	Core *CoreInfo `json:"core,omitempty"`
+
+	// OpenFiles are the file descriptors the child had open when it
+	// crashed, if WrapConfig.OpenFiles is set and they could be read.
+	OpenFiles []OpenFile `json:"open_files,omitempty"`
+
+	// Proc is the status and memory summary of the child when it crashed,
+	// if WrapConfig.ProcStatus is set and they could be read.
+	Proc *ProcStatus `json:"proc,omitempty"`
+
+	// LeftBehind are the processes the child left running when it
+	// crashed, which the parent adopted, if WrapConfig.Subreaper is set.
+	LeftBehind []LeftBehindProcess `json:"left_behind,omitempty"`
+
+	// KernelLog holds the recent kernel log lines that mention the child,
+	// such as those of the OOM killer, if WrapConfig.KernelLog is set and
+	// the kernel log could be read.
+	KernelLog []string `json:"kernel_log,omitempty"`
+
+	// DiagnosticReport is the path of the report the crash reporter of
+	// macOS wrote for the child, if WrapConfig.DiagnosticReports is set
+	// and it showed up in time.
+	DiagnosticReport string `json:"diagnostic_report,omitempty"`
+
+	// WER describes the minidump and the report that Windows Error
+	// Reporting wrote for the child, if WrapConfig.WERReports is set and
+	// either showed up in time.
+	WER *WERReport `json:"wer,omitempty"`
+
+	// PostMortem is the outcome of the WrapConfig.PostMortem command, or
+	// nil if it wasn't run.
+	PostMortem *PostMortem `json:"post_mortem,omitempty"`
+
+	// Recording is the path of the raw stderr output of the child saved
+	// with WrapConfig.RecordDir, or empty if it wasn't saved.
+	Recording string `json:"recording"`
+
+	// StdoutTail and StderrTail are the end of the output the child wrote
+	// to stdout and stderr before it crashed, if WrapConfig.TailSize is
+	// set. StderrTail doesn't include Text.
+	StdoutTail string `json:"stdout_tail,omitempty"`
+	StderrTail string `json:"stderr_tail,omitempty"`
+
+	// Breadcrumbs are the last messages the child wrote with Breadcrumb,
+	// oldest first, if WrapConfig.BreadcrumbSize is set.
+	Breadcrumbs []string `json:"breadcrumbs,omitempty"`
+
+	// Cgroup describes the resource usage of the child in the cgroup of
+	// its own, if WrapConfig.Cgroup is set.
+	Cgroup *CgroupStats `json:"cgroup,omitempty"`
+
+	// Profiles are the paths of the most recent profiles the child wrote
+	// to WrapConfig.ProfileDir before it crashed, keyed by profile name,
+	// such as "heap" or "goroutine".
+	Profiles map[string]string `json:"profiles,omitempty"`
+}
+
+// parseValue extracts the panic value or fatal error message from the given
+// panic text, as printed by the latest Go version. For chains of re-raised
+// panics, this is the first one.
+func parseValue(text string) string {
+	values := parseValues(text, latestQuirks)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+var valueRecoveredRe = regexp.MustCompile(` \[recovered(?:, [a-z]+)?\]$`)
+
+// parseValues extracts the panic values from the given panic text in the
+// order they were raised. There is more than one if a panic was recovered
+// and another one raised while it was still unwinding, which the runtime
+// prints as:
+//
+//	panic: first [recovered]
+//		panic: second
+//
+// The values end at the signal description or at the blank line before the
+// goroutine stacks, and may contain newlines of their own. Newer runtimes
+// indent continuation lines with a tab, which is removed.
+func parseValues(text string, q formatQuirks) []string {
+	lines := strings.Split(text, "\n")
+	start := -1
+	var first string
+	for i, line := range lines {
+		for _, prefix := range []string{"panic: ", "fatal error: "} {
+			if strings.HasPrefix(line, prefix) {
+				start, first = i, line[len(prefix):]
+				break
+			}
+		}
+		if start >= 0 {
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	var result []string
+	value := []string{first}
+	indent := 0
+	for i := start + 1; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "[signal ") || strings.HasPrefix(line, "goroutine ") {
+			break
+		}
+		if line == "" && (i+1 == len(lines) || isStackStart(lines[i+1])) {
+			break
+		}
+
+		trimmed := strings.TrimLeft(line, "\t")
+		if strings.HasPrefix(trimmed, "panic: ") && len(trimmed) < len(line) {
+			result = append(result, joinValue(value))
+			value = []string{trimmed[len("panic: "):]}
+			indent = len(line) - len(trimmed)
+			continue
+		}
+
+		if q.indentedValues {
+			for j := 0; j <= indent && strings.HasPrefix(line, "\t"); j++ {
+				line = line[1:]
+			}
+		}
+		value = append(value, line)
+	}
+
+	return append(result, joinValue(value))
+}
+
+// joinValue joins the lines of a single panic value, removing the marker
+// the runtime adds to recovered panics.
+func joinValue(lines []string) string {
+	value := strings.TrimRight(strings.Join(lines, "\n"), "\r")
+	return valueRecoveredRe.ReplaceAllString(value, "")
+}
+
+// isStackStart returns whether the given line starts the goroutine stacks
+// or the runtime stack that follows the panic value.
+func isStackStart(line string) bool {
+	return stackGoroutineRe.MatchString(line) || line == "runtime stack:"
+}
+
+var (
+	fingerprintHexRe = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	fingerprintNumRe = regexp.MustCompile(`[0-9]+`)
+)
+
+// fingerprint computes the Fingerprint of the given panic text. Only the
+// message and the frames of the first goroutine, which is the one that
+// panicked, are taken into account. Runtime frames are skipped since which
+// of them are shown depends on GOTRACEBACK. File paths are normalized with
+// the given trimmer, which may be nil.
+func fingerprint(text string, trimmer *pathTrimmer) string {
+	h := sha256.New()
+	for _, line := range strings.Split(text, "\n") {
+		if isStackStart(line) {
+			break
+		}
+
+		// The message often contains values (indexes, addresses) that
+		// differ between otherwise identical panics.
+		line = fingerprintHexRe.ReplaceAllString(strings.TrimSpace(line), "N")
+		line = fingerprintNumRe.ReplaceAllString(line, "N")
+		io.WriteString(h, line+"\n")
+	}
+
+	if gs := parseGoroutines(text, trimmer); len(gs) > 0 {
+		for _, f := range gs[0].Frames {
+			if !f.isRuntime() {
+				fmt.Fprintf(h, "%s %s:%d\n", f.Function, f.File, f.Line)
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// crashTracker remembers the fingerprints of recent panics so that repeated
+// occurrences of the same panic can be counted and suppressed.
+type crashTracker struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*crashRecord
+
+	// handled has the times the handlers were called within the window
+	// of WrapConfig.HandlerLimit, and limited the number of crashes they
+	// weren't called for since.
+	handled []time.Time
+	limited int
+}
+
+type crashRecord struct {
+	count int
+	last  time.Time
+}
+
+func newCrashTracker(window time.Duration) *crashTracker {
+	return &crashTracker{
+		window: window,
+		seen:   make(map[string]*crashRecord),
+	}
+}
+
+// record notes an occurrence of the given fingerprint at the given time
+// and returns how many times it has been seen within the window.
+func (t *crashTracker) record(fp string, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for k, r := range t.seen {
+		if now.Sub(r.last) > t.window {
+			delete(t.seen, k)
+		}
+	}
+
+	r, ok := t.seen[fp]
+	if !ok {
+		r = new(crashRecord)
+		t.seen[fp] = r
+	}
+
+	r.count++
+	r.last = now
+	return r.count
+}
+
+// limit reports whether the handlers may be called at the given time
+// without exceeding max calls within the window. If they may, it notes the
+// call and returns the number of crashes they weren't called for since the
+// previous one.
+func (t *crashTracker) limit(now time.Time, max int, window time.Duration) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := 0
+	for i < len(t.handled) && now.Sub(t.handled[i]) >= window {
+		i++
+	}
+	t.handled = t.handled[i:]
+
+	if len(t.handled) >= max {
+		t.limited++
+		return 0, false
+	}
+
+	t.handled = append(t.handled, now)
+	limited := t.limited
+	t.limited = 0
+	return limited, true
+}
@@ -0,0 +1,217 @@
+package panicwrap
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPanicText = `panic: runtime error: index out of range [5] with length 3
+
+goroutine 1 [running]:
+main.lookup(0xc000012345, 0x3, 0x5)
+	/home/user/app/main.go:12 +0x1d
+main.main()
+	/home/user/app/main.go:7 +0x45
+exit status 2
+`
+
+const testPanicTextOther = `panic: runtime error: index out of range [9] with length 1
+
+goroutine 17 [running]:
+main.lookup(0xc000098765, 0x1, 0x9)
+	/home/user/app/main.go:12 +0x1d
+main.main()
+	/home/user/app/main.go:7 +0x52
+exit status 2
+`
+
+func TestFingerprint(t *testing.T) {
+	a := fingerprint(testPanicText, nil)
+	b := fingerprint(testPanicTextOther, nil)
+	if a != b {
+		t.Fatalf("fingerprints differ: %s != %s", a, b)
+	}
+
+	c := fingerprint(`panic: oh no
+
+goroutine 1 [running]:
+main.main()
+	/home/user/app/main.go:8 +0x45
+`, nil)
+	if a == c {
+		t.Fatalf("fingerprints should differ: %s", a)
+	}
+}
+
+func TestCrashTracker(t *testing.T) {
+	now := time.Now()
+	tr := newCrashTracker(time.Minute)
+
+	if n := tr.record("a", now); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := tr.record("a", now.Add(time.Second)); n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+	if n := tr.record("b", now.Add(time.Second)); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Past the window the count starts over.
+	if n := tr.record("a", now.Add(2*time.Minute)); n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestCrashTracker_limit(t *testing.T) {
+	now := time.Now()
+	tr := newCrashTracker(time.Minute)
+
+	for i, expected := range []bool{true, true, false, false} {
+		if _, ok := tr.limit(now.Add(time.Duration(i)*time.Second), 2, time.Minute); ok != expected {
+			t.Fatalf("%d: bad: %t", i, ok)
+		}
+	}
+
+	// Once the first call is out of the window, the next one goes out with
+	// the number of crashes that didn't.
+	if n, ok := tr.limit(now.Add(time.Minute), 2, time.Minute); !ok || n != 2 {
+		t.Fatalf("bad: %d, %t", n, ok)
+	}
+	if n, ok := tr.limit(now.Add(time.Minute+time.Second), 2, time.Minute); !ok || n != 0 {
+		t.Fatalf("bad: %d, %t", n, ok)
+	}
+}
+
+func TestHandlePanic_handlerLimit(t *testing.T) {
+	clock := newFakeClock()
+	var handled []int
+	stderr := new(bytes.Buffer)
+	c := &WrapConfig{
+		InfoHandler:  func(info *PanicInfo) { handled = append(handled, info.RateLimited) },
+		Writer:       stderr,
+		Clock:        clock,
+		HandlerLimit: 1,
+	}
+	setDefaults(c)
+
+	tracker := newCrashTracker(c.DedupWindow)
+	for range 3 {
+		if err := handlePanic(c, tracker, &PanicInfo{Text: testPanicText}, false); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	clock.Advance(time.Minute)
+	if err := handlePanic(c, tracker, &PanicInfo{Text: testPanicText}, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(handled, []int{0, 2}) {
+		t.Fatalf("bad: %v", handled)
+	}
+	if n := strings.Count(stderr.String(), "index out of range"); n != 4 {
+		t.Fatalf("should mirror every panic: %d", n)
+	}
+}
+
+func TestFingerprint_trimPaths(t *testing.T) {
+	a := fingerprint(testPanicText, nil)
+	b := fingerprint(strings.ReplaceAll(testPanicText, "/home/user/", "/builds/ci/"), nil)
+	if a == b {
+		t.Fatal("fingerprints should differ without trimming")
+	}
+
+	c := &WrapConfig{TrimPathPrefixes: []string{"/home/user/", "/builds/ci/"}}
+	a = fingerprint(testPanicText, newPathTrimmer(c, testPanicText))
+	b = fingerprint(strings.ReplaceAll(testPanicText, "/home/user/", "/builds/ci/"), newPathTrimmer(c, testPanicText))
+	if a != b {
+		t.Fatalf("fingerprints differ: %s != %s", a, b)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{
+			testPanicText,
+			"runtime error: index out of range [5] with length 3",
+		},
+		{
+			"fatal error: all goroutines are asleep - deadlock!\n\ngoroutine 1 [chan receive]:\n",
+			"all goroutines are asleep - deadlock!",
+		},
+		{
+			"panic: first line\nsecond line\n\nthird line\n\ngoroutine 1 [running]:\n",
+			"first line\nsecond line\n\nthird line",
+		},
+		{
+			"panic: first line\n\tsecond line\n\ngoroutine 1 [running]:\n",
+			"first line\nsecond line",
+		},
+		{
+			"panic: runtime error: invalid memory address or nil pointer dereference\n" +
+				"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x47e0b6]\n\n" +
+				"goroutine 1 [running]:\n",
+			"runtime error: invalid memory address or nil pointer dereference",
+		},
+		{
+			"panic: oh no",
+			"oh no",
+		},
+		{
+			"nothing to see here",
+			"",
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := parseValue(tc.text); actual != tc.expected {
+			t.Fatalf("%q: %q != %q", tc.text, actual, tc.expected)
+		}
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected []string
+	}{
+		{
+			testPanicText,
+			[]string{"runtime error: index out of range [5] with length 3"},
+		},
+		{
+			"panic: first [recovered]\n\tpanic: second\n\ngoroutine 1 [running]:\n",
+			[]string{"first", "second"},
+		},
+		{
+			"panic: first [recovered]\n\tpanic: second [recovered]\n\t\tpanic: third\n\n" +
+				"goroutine 1 [running]:\n",
+			[]string{"first", "second", "third"},
+		},
+		{
+			"panic: first\n\tline [recovered]\n\tpanic: second\n\t\tline\n\n" +
+				"goroutine 1 [running]:\n",
+			[]string{"first\nline", "second\nline"},
+		},
+		{
+			"panic: same [recovered, repanicked]\n\ngoroutine 1 [running]:\n",
+			[]string{"same"},
+		},
+		{
+			"nothing to see here",
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := parseValues(tc.text, latestQuirks); !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("%q: %q != %q", tc.text, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package panicwrap
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// PanicInfoSchemaVersion is the version of the JSON encoding of
+// PanicInfo, which it carries in its "schema_version" field. Fields may
+// be added within a version, but none are renamed or removed, and none
+// change their meaning.
+const PanicInfoSchemaVersion = 1
+
+// PanicInfoSchema is the JSON Schema of the encoding of PanicInfo.
+//
+//go:embed panicinfo.schema.json
+var PanicInfoSchema string
+
+// MarshalJSON encodes the PanicInfo as described by PanicInfoSchema.
+// Durations are in nanoseconds and times in RFC 3339.
+func (p PanicInfo) MarshalJSON() ([]byte, error) {
+	type plain PanicInfo
+	return json.Marshal(struct {
+		SchemaVersion int `json:"schema_version"`
+		plain
+	}{PanicInfoSchemaVersion, plain(p)})
+}
+
+// UnmarshalJSON decodes a PanicInfo encoded by MarshalJSON. An error is
+// returned for a later version of the encoding than this package knows.
+func (p *PanicInfo) UnmarshalJSON(data []byte) error {
+	type plain PanicInfo
+	v := struct {
+		SchemaVersion int `json:"schema_version"`
+		*plain
+	}{plain: (*plain)(p)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.SchemaVersion > PanicInfoSchemaVersion {
+		return fmt.Errorf("panicwrap: unsupported schema version %d of PanicInfo", v.SchemaVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package panicwrap
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicInfo_json(t *testing.T) {
+	info := &PanicInfo{
+		Text:            "panic: boom\n",
+		Value:           "boom",
+		Kind:            KindPanic,
+		ExitStatus:      2,
+		SinceFirstCrash: time.Minute,
+		PID:             4242,
+		StartTime:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Goroutines:      []Goroutine{{ID: 1, State: "running", Frames: []Frame{{Function: "main.main", File: "/app/main.go", Line: 5}}}},
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, s := range []string{`"schema_version":1`, `"text":"panic: boom\n"`, `"since_first_crash":60000000000`, `"start_time":"2024-01-02T03:04:05Z"`, `"function":"main.main"`} {
+		if !strings.Contains(string(data), s) {
+			t.Fatalf("should contain %s: %s", s, data)
+		}
+	}
+
+	var decoded PanicInfo
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(&decoded, info) {
+		t.Fatalf("bad: %#v", decoded)
+	}
+}
+
+func TestPanicInfo_jsonLaterVersion(t *testing.T) {
+	var info PanicInfo
+	if err := json.Unmarshal([]byte(`{"schema_version":2,"text":"panic: boom\n"}`), &info); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestPanicInfoSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(PanicInfoSchema), &schema); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Every field of the encoding is in the schema, and the other way
+	// around.
+	data, err := json.Marshal(PanicInfo{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	for name := range fields {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("missing from the schema: %s", name)
+		}
+	}
+
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	typ := reflect.TypeOf(PanicInfo{})
+	if len(names) != typ.NumField()+1 {
+		t.Fatalf("the schema has %d properties for %d fields: %v", len(names), typ.NumField(), names)
+	}
+}
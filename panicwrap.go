@@ -7,18 +7,27 @@
 // Panics are only detected when the subprocess exits with a non-zero
 // exit status, since this is the only time panics are real. Otherwise,
 // "panic-like" output is ignored.
+//
+// The functions that act on the running child, such as DumpStacks, Stats
+// or Pause, can be called from any goroutine of the parent while Wrap is
+// running. They return an error if no Wrap call is running.
 package panicwrap
 
 import (
 	"bytes"
-	"errors"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 )
 
@@ -30,6 +39,10 @@ const (
 // HandlerFunc is the type called when a panic is detected.
 type HandlerFunc func(string)
 
+// InfoHandlerFunc is the type called with the structured form of a panic
+// when one is detected.
+type InfoHandlerFunc func(*PanicInfo)
+
 // WrapConfig is the configuration for panicwrap when wrapping an existing
 // binary. To get started, in general, you only need the BasicWrap function
 // that will set this up for you. However, for more customizability,
@@ -38,29 +51,370 @@ type WrapConfig struct {
 	// Handler is the function called when a panic occurs.
 	Handler HandlerFunc
 
+	// InfoHandler is called with a PanicInfo when a panic occurs. It may
+	// be set instead of, or in addition to, Handler.
+	InfoHandler InfoHandlerFunc
+
+	// PanicWriter, if set, receives the text of every detected panic, and
+	// nothing else. This is independent of Writer, which receives all of
+	// stderr, and may be set instead of, or in addition to, the handlers.
+	// Like the handlers, it doesn't receive suppressed panics (see
+	// SuppressAfter).
+	PanicWriter io.Writer
+
+	// PanicTemplate, if set, is the layout of the panics that PanicWriter
+	// and PanicSinks receive, instead of their raw text, such as
+	// DefaultPanicTemplate. See PanicTemplate.
+	PanicTemplate string
+
+	// OOMHandler, if set, is called instead of Handler and InfoHandler
+	// when the child runs out of memory (see KindOutOfMemory), or is
+	// killed for going over the memory.max of its cgroup (see
+	// KindOOMKill). Running out of memory usually calls for capacity
+	// follow-up rather than bug triage, so this allows routing it
+	// elsewhere.
+	OOMHandler InfoHandlerFunc
+
+	// If HandlerProcess is set, Handler, InfoHandler and OOMHandler are
+	// called in a helper process rather than in the parent, which may be
+	// short of memory or file descriptors after the crash it handles. The
+	// parent starts its own executable again, with the same arguments and
+	// the PanicInfo of the crash on a pipe, and Wrap in that process calls
+	// the handlers and returns true, so that the program exits. The parent
+	// waits for it, and calls the handlers itself if it can't be started.
+	HandlerProcess bool
+
+	// HandlerSidecar, if set, calls Handler, InfoHandler and OOMHandler
+	// in a helper process like HandlerProcess does, except that the parent
+	// starts it before the child and keeps it running, and passes it the
+	// crashes over a pipe, so that no process has to be started after a
+	// crash. The helper finishes handling a crash it took even if the
+	// parent dies meanwhile. The parent checks that it answers, starts it
+	// again if it doesn't, and calls the handlers itself for a crash that
+	// it couldn't hand over. The parent still parses and scrubs the crash.
+	HandlerSidecar *SidecarConfig
+
+	// Severities maps the kinds of crashes to their PanicInfo.Severity,
+	// such as KindOutOfMemory to SeverityWarning, for the handlers to
+	// route them by. The kinds that aren't in it are SeverityError.
+	Severities map[CrashKind]Severity
+
+	// HandlerCommands are external programs run for every crash along
+	// with the handlers, including the crashes that go to OOMHandler, so
+	// that a crash can be handled with a script. See HandlerCommand.
+	HandlerCommands []HandlerCommand
+
+	// DumpHandler, if set, is called when the child prints a goroutine
+	// dump because it received SIGQUIT. Such dumps are never treated as
+	// panics and are always mirrored to Writer.
+	DumpHandler DumpHandlerFunc
+
+	// DigestHandler, if set, is called with a Digest of the crashes
+	// handled within a window of DigestWindow, which starts with the first
+	// crash after the previous window, instead of once per crash. Leave the
+	// other handlers unset, or set SuppressAfter or HandlerLimit, to keep
+	// crash loops from flooding a chat channel with one message per crash.
+	// It is called from a goroutine of its own, and the window in progress
+	// is cut short when Wrap returns.
+	DigestHandler DigestHandlerFunc
+
+	// The window of DigestHandler. Defaults to 5 minutes.
+	DigestWindow time.Duration
+
+	// ReportHandler, if set, is called with the problems the child reports
+	// with SendReport. It is called from a goroutine of its own while the
+	// child keeps running. This requires Control.
+	ReportHandler ReportHandlerFunc
+
+	// SubprocessHandler, if set, is called with the crashes of the
+	// processes the child started with StartSubprocess. PanicInfo.PID is
+	// the process ID of the subprocess, and ParentPID that of the child.
+	// It is called from a goroutine of its own while the child keeps
+	// running, and the crash doesn't count as one of the child. This
+	// requires Control.
+	SubprocessHandler func(*PanicInfo)
+
+	// LeakHandler, if set, is called with the goroutine leaks that
+	// LeakWatchdog finds. It is called from a goroutine of its own while
+	// the child keeps running.
+	LeakHandler LeakHandlerFunc
+
+	// RSSHandler, if set, is called once the child grows past the
+	// threshold of RSSWatchdog. It is called from a goroutine of its own.
+	RSSHandler RSSHandlerFunc
+
+	// SpinHandler, if set, is called with the goroutine dump of the child
+	// once it pegs the CPU past the threshold of SpinWatchdog. It is
+	// called from a goroutine of its own.
+	SpinHandler SpinHandlerFunc
+
+	// FDHandler, if set, is called once the open file descriptors of the
+	// child approach its limit. It is called from a goroutine of its own.
+	// See FDWatchdog.
+	FDHandler FDHandlerFunc
+
+	// InternalErrorHandler, if set, is called with the failures of the
+	// parent itself that it recovered from, as *InternalError, such as a
+	// writer that failed or panicked. They are printed to stderr
+	// otherwise. The parent carries on after them, and always returns the
+	// exit status of the child.
+	InternalErrorHandler func(error)
+
+	// StderrDetachedHandler, if set, is called with the process ID of a
+	// child that closed its stderr, or redirected it elsewhere, and keeps
+	// running. Its panics can't be detected from then on, though its exit
+	// status is still returned and signals still reach it. It is called
+	// from a goroutine of its own.
+	StderrDetachedHandler func(pid int)
+
+	// If true, the handlers for a crash of the child, and DumpHandler,
+	// run in a goroutine of their own while the parent carries on: it
+	// restarts the child under Restart without waiting for them and keeps
+	// forwarding the output of the restarted child, so that a handler
+	// that takes long, such as one that uploads a report, doesn't hold
+	// up the output. Wrap waits for them before it returns. The handlers
+	// may then run at the same time as each other, and one that makes
+	// the parent exit cuts the others short.
+	ConcurrentHandlers bool
+
+	// PanicExitStatus, if set, is the exit status Wrap returns when the
+	// last child exited from a detected crash, instead of the exit status
+	// of the child, such as 70 to tell an orchestrator that the crash was
+	// captured. Any other exit returns the exit status of the child.
+	PanicExitStatus int
+
+	// If true, a child that was killed by signal N exits with the status
+	// 128+N, as a shell reports it, rather than -1, which Wrap otherwise
+	// also returns in the child. This applies to Restart.ExitStatuses
+	// and PanicInfo.ExitStatus too. PanicInfo.Signal has the signal
+	// either way.
+	SignalExitStatus bool
+
+	// If true, a child that exits with a non-zero status before its call
+	// to Wrap returned, which is when it counts as having come up, is
+	// reported with KindStartup even if it didn't panic. Its stderr is
+	// held back until it comes up, and is the Text of the report if it
+	// doesn't. This tells a child that never came up, such as after a
+	// broken deployment, from one that crashed later. This isn't
+	// supported on Windows.
+	DetectStartup bool
+
 	// The cookie key and value are used within environmental variables
 	// to tell the child process that it is already executing so that
 	// wrap doesn't re-wrap itself.
 	CookieKey   string
 	CookieValue string
 
+	// If true, Wrapped also checks that the parent process is the one that
+	// set the cookie, which the parent passes along with it. Otherwise, a
+	// program started by the child, such as through a shell, inherits the
+	// cookie and thinks it is wrapped if it is the same executable or uses
+	// the same cookie.
+	VerifyParent bool
+
+	// Supervisor decides what Wrap does when the process already runs
+	// under something that captures its crashes, such as another
+	// panicwrap layer, systemd-coredump or a debugger. Wrapping under a
+	// supervisor doubles the processes and interleaves the crash output.
+	// See DetectSupervisor.
+	Supervisor SupervisorPolicy
+
+	// If true, the child is started from /proc/self/exe on Linux, which is
+	// the binary the parent runs, rather than from its path. This keeps
+	// restarts working when the binary was deleted or replaced on disk,
+	// such as by a deploy. The child still sees the path as os.Args[0].
+	// This is ignored on other platforms.
+	ProcSelfExe bool
+
+	// If set, the parent checks that the binary it starts as the child has
+	// this hex encoded SHA-256 digest right before starting it, and Wrap
+	// returns ErrExecutableMismatch instead of starting a child that
+	// doesn't. On Linux, the child is started from the file that was
+	// checked, so it can't be swapped in between.
+	ExecutableSHA256 string
+
+	// If true, the binary the parent starts as the child must be the one
+	// the parent runs: Wrap sets ExecutableSHA256 to the digest of the
+	// running binary, unless it is already set.
+	VerifyExecutable bool
+
+	// If set, the child runs as this user and these groups, which the
+	// parent must be privileged enough to switch to, while the parent
+	// keeps its own. This lets a privileged parent write crash reports
+	// where the child can't. The directories the child writes to, such
+	// as Profiling.Dir, must be writable by it. This isn't supported on
+	// Windows.
+	Credential *Credential
+
+	// If set, the child runs with this directory as its root, while the
+	// parent, which writes the crash reports, stays outside. The binary
+	// must be at the same path inside the directory, and paths the child
+	// uses itself, such as Profiling.Dir, are inside it. The parent must
+	// be privileged enough to chroot, and should combine this with
+	// Credential, since root can leave a chroot. ProcSelfExe and
+	// ExecutableSHA256 need /proc to be mounted inside it on Linux. This
+	// isn't supported on Windows.
+	Chroot string
+
+	// If true, the parent becomes the reaper of the processes the child
+	// starts, with PR_SET_CHILD_SUBREAPER on Linux and
+	// procctl(PROC_REAP_ACQUIRE) on FreeBSD: those that outlive the child
+	// are reparented to the parent rather than to init, which reaps them
+	// as they exit. What a crashed child left running is passed to the
+	// handlers in PanicInfo.LeftBehind. Linux doesn't tell which
+	// processes descend from the child, so the parent looks every second
+	// and when the child crashes, and doesn't adopt those that were
+	// started and orphaned in between. This is only supported on Linux
+	// and 64-bit FreeBSD.
+	Subreaper bool
+
+	// If set, what a child left running when it exited, including after
+	// a crash and on shutdown, is sent this signal, such as os.Kill, so
+	// that a restarted child doesn't find orphaned grandchildren holding
+	// on to its ports or files. See Subreaper.
+	SubreaperSignal os.Signal
+
+	// If true, the child is started in a process contract of its own on
+	// illumos, which the processes it starts are in too, even those that
+	// daemonize with a double fork. Once the child exited, the parent
+	// waits for the rest of its contract to exit as well before it counts
+	// the child as gone, so that a child that daemonizes isn't restarted
+	// alongside the daemon it left, and the daemon's crashes still reach
+	// the handlers if it keeps stderr. Whatever is left once the worker
+	// stops is killed. This is only supported on illumos, with cgo.
+	Contract bool
+
+	// The Linux namespaces the child gets new ones of, isolating it from
+	// the host, such as NamespacePID|NamespaceNetwork. The parent stays
+	// in its own namespaces and must be privileged enough to create them.
+	// This is only supported on Linux.
+	Namespaces Namespaces
+
+	// Cgroup, if set, makes the parent run each child in a cgroup of its
+	// own, which limits the resources of the child. See CgroupConfig.
+	Cgroup *CgroupConfig
+
+	// Resource limits of the child, such as a RLIMIT_CORE high enough for
+	// the core dumps CoreDir looks for, which leave the limits of the
+	// parent alone. Go can't set them between fork and exec, so the child
+	// sets them on itself in Wrap, before any code after it runs. Wrap
+	// returns an error in the child if that fails. This isn't supported
+	// on Windows.
+	Rlimits []Rlimit
+
+	// Priority, if set, lowers the CPU and IO priority of the child. This
+	// isn't supported on Windows. See Priority.
+	Priority *Priority
+
+	// The CPUs the child may run on, numbered from 0, such as []int{2, 3}
+	// to pin it to the third and fourth CPU. On Linux, the child starts
+	// on them. On Windows, where only the first 64 CPUs can be used, or
+	// 32 from a 32-bit parent, they are set right after the child
+	// started. This isn't supported on other platforms.
+	CPUAffinity []int
+
 	// If true, the panic will not be mirrored to the configured writer
 	// and will instead ONLY go to the handler. This lets you effectively
 	// hide panics from the end user. This is not recommended because if
 	// your handler fails, the panic is effectively lost.
 	HidePanic bool
 
+	// If true, the output from a panic header on is forwarded to Writer
+	// as it arrives, rather than once the child exited, so that a huge
+	// crash doesn't look like a hang. It is still gathered in full for
+	// the handlers. Since it isn't known yet whether it is a crash, it
+	// is marked with lines of its own: one that starts with "panicwrap:
+	// possible crash" before it, and after it either "panicwrap: end of
+	// the crash" or one that says that it wasn't one. This can't be
+	// combined with HidePanic.
+	StreamPanics bool
+
+	// If true, lines of stderr that are JSON objects, as structured
+	// loggers write them, are never taken for the start of a crash, even
+	// if a field holds "panic:" or another header. Only the raw output of
+	// the runtime is matched. A JSON line that is written in pieces is
+	// held back until it is complete, for up to PartialHeaderWait.
+	IgnoreJSONLines bool
+
+	// If true, panicwrap is stricter about what is a crash: a header such
+	// as "panic:" or "fatal error:" must start a line, and be followed by
+	// the stack of a goroutine, which starts with a "goroutine N [" line,
+	// before the child exits. Otherwise the output is written out as
+	// usual. This keeps applications that log those words from being
+	// taken for crashing, but can't be combined with a GoTraceback of
+	// "none", which leaves out the stacks.
+	StrictDetection bool
+
+	// IgnorePatterns, if set, are known benign lines that look like the
+	// start of a crash, such as those of a library that prints "panic:
+	// recovered" as it runs as usual, or a test that echoes crash text. A
+	// panic header in a line that matches one of them is taken for
+	// ordinary output. The line is matched as far as it arrived with the
+	// header.
+	IgnorePatterns []*regexp.Regexp
+
+	// If true, crash text isn't scrubbed with DefaultScrubPatterns. By
+	// default, common shapes of secrets, such as AWS access keys, bearer
+	// tokens, PEM blocks and long tokens next to words like "password"
+	// or "token", are masked in the text of panics and dumps, and in
+	// recordings, before it reaches the handlers, PanicWriter, the
+	// mirror to Writer, or any file. The rest of stderr, and the panics
+	// StreamPanics forwards, are written out as the child wrote them.
+	DisableScrubbing bool
+
+	// ScrubPatterns mask more data in crash text, such as email
+	// addresses or the format of customer IDs, after the default
+	// patterns. They apply even with DisableScrubbing.
+	ScrubPatterns []ScrubPattern
+
+	// Banners, if set, are the lines written around a panic that is
+	// mirrored to Writer, such as ones with its process ID and
+	// fingerprint for log collectors. See CrashBanners.
+	Banners *CrashBanners
+
 	// The amount of time that a process must exit within after detecting
 	// a panic header for panicwrap to assume it is a panic. Defaults to
-	// 300 milliseconds.
+	// 300 milliseconds. Only the output that follows a panic header is
+	// held back that long, while the rest of stderr is forwarded as it
+	// arrives. What happens once it is over is up to DetectTimeout.
 	DetectDuration time.Duration
 
+	// What happens to the output that follows a panic header once the
+	// child didn't exit within DetectDuration. Defaults to
+	// DetectTimeoutFlush. See DetectTimeoutAction.
+	DetectTimeout DetectTimeoutAction
+
+	// How long the parent waits for the rest of a panic header when
+	// stderr ends with what may be its start, such as "pan", at the start
+	// of a line. Otherwise a panic the child writes in pieces can go
+	// undetected. Only such output is held back. Defaults to 300
+	// milliseconds.
+	PartialHeaderWait time.Duration
+
+	// How long the parent waits for the rest of the output once the child
+	// exited, which only takes longer if a process the child started
+	// still holds its stdout or stderr. The rest is dropped after that.
+	// Defaults to 0, which waits until all of them closed it.
+	TrailingOutputWait time.Duration
+
+	// TrailingOutputMax, if set, makes TrailingOutputWait a grace period
+	// that starts over whenever output comes, so that the output that is
+	// still on its way once the child exited, such as the end of a crash
+	// that the parent is behind on, reaches the handlers and the writers.
+	// The parent stops waiting once the output went quiet for
+	// TrailingOutputWait, or once every process closed it, and
+	// TrailingOutputMax after the child exited at the latest.
+	TrailingOutputMax time.Duration
+
 	// The writer to send the stderr to. If this is nil, then it defaults
 	// to os.Stderr.
 	Writer io.Writer
 
 	// The writer to send stdout to. If this is nil, then it defaults to
-	// os.Stdout.
+	// os.Stdout. Like Writer, it can be any writer the parent owns, such
+	// as a file or a bufio.Writer: it is flushed once a child exited and
+	// by Drain. Unless the output is processed, such as for Log or
+	// Timestamps, a file is given to the child as its stdout directly.
 	Stdout io.Writer
 
 	// Catch and igore these signals in the parent process, let the child
@@ -73,6 +427,462 @@ type WrapConfig struct {
 	// signals like SIGTERM are only sent to the parent process and need
 	// to be forwarded. This defaults to empty.
 	ForwardSignals []os.Signal
+
+	// If true, the signals a program is asked to stop or reload with are
+	// forwarded to the child as well, except for those in IgnoreSignals.
+	// These are SIGHUP, SIGINT, SIGQUIT, SIGTERM, SIGUSR1 and SIGUSR2 on
+	// Unix, and os.Interrupt and SIGTERM on Windows. Signals that the
+	// terminal sends to the whole process group anyway, or that concern
+	// the parent itself such as SIGCHLD, are never forwarded this way.
+	ForwardAll bool
+
+	// If true and stdin is a terminal, the child runs on a pseudo-terminal
+	// of its own, for interactive programs with line editing and the like.
+	// The parent puts its terminal in raw mode, passes what is typed to
+	// the child byte by byte, including Ctrl+C, and copies the window
+	// size. The terminal is restored once the child exited, also after a
+	// crash, before the handlers run, and its output is copied for up to
+	// DrainTimeout more, even if processes it left behind still hold the
+	// pseudo-terminal. Stdout of the child goes through the
+	// pseudo-terminal while stderr is still piped to detect panics. This
+	// is only supported on Linux, and ignored elsewhere if stdin isn't a
+	// terminal.
+	Terminal bool
+
+	// If true, the child is started in a process group of its own on
+	// Windows, so that console control events can be sent to it alone.
+	// The child then no longer receives Ctrl+C from the console itself.
+	// Instead, the parent sends it a CTRL_BREAK_EVENT, which the child
+	// receives as os.Interrupt, for the signals in IgnoreSignals and
+	// ForwardSignals and for Interrupt. Go delivers closing the console
+	// and shutting down to the parent as syscall.SIGTERM. This does
+	// nothing on other platforms.
+	ConsoleGroup bool
+
+	// If true, the child is started without a console window on Windows,
+	// so that a GUI program that wraps itself doesn't flash one. Its
+	// output is still captured. A child without a console doesn't get
+	// console control events, so this can't be combined with
+	// ConsoleGroup. This does nothing on other platforms.
+	HideConsole bool
+
+	// The encoding the child writes its stderr in, if it isn't UTF-8 or
+	// ASCII, such as EncodingUTF16LE. Otherwise the panic headers aren't
+	// found in it. The parent decodes it to UTF-8 before detecting panics
+	// and forwarding it, though RecordDir keeps it as is.
+	StderrEncoding string
+
+	// The sizes of the buffers for the stdout and stderr of the child,
+	// such as larger ones for a service that logs a lot, or smaller ones
+	// for hundreds of children on one host. StdoutBuffers has no effect
+	// when Stdout is a file that is given to the child directly. The read
+	// size of stderr is also how much of it is inspected for panics at
+	// once. See StreamBuffers.
+	StdoutBuffers *StreamBuffers
+	StderrBuffers *StreamBuffers
+
+	// OutputRate, if set, limits the rate at which the output of each
+	// child is forwarded, dropping or throttling what is over it, and
+	// collapses runs of duplicate lines. See OutputRateConfig.
+	OutputRate *OutputRateConfig
+
+	// Restart, if set, makes the parent re-execute the child whenever it
+	// exits with a non-zero status, or on the exits the policy asks for,
+	// turning panicwrap into a minimal supervisor. See RestartPolicy.
+	Restart *RestartPolicy
+
+	// If true, parent and child talk over a pair of pipes with a small
+	// message protocol, besides the environment variable that marks the
+	// child. The child can then attach metadata to its panics with
+	// SetMetadata, report problems with SendReport, send a Heartbeat and
+	// learn from ShutdownRequested that the parent asks it to shut down.
+	// This isn't supported on Windows.
+	Control bool
+
+	// What the child does if its parent speaks another version of the
+	// protocol between them, which happens when they are different builds.
+	// Defaults to VersionWarn. See VersionPolicy.
+	VersionMismatch VersionPolicy
+
+	// CommandSocket, if set, is the path of a Unix socket on which the
+	// parent accepts commands, such as from SendCommand or the
+	// panicwrapctl tool, while it runs. See CommandStatus for the
+	// commands. The socket is only accessible to the user the parent runs
+	// as. A socket left behind at the path is replaced, but Wrap fails if
+	// another parent still listens on it.
+	CommandSocket string
+
+	// Reload, if set, is called when the parent receives SIGHUP, or on
+	// Reload or CommandReload, and the parent switches to the
+	// PanicWriter, PanicSinks, Log, Restart and DetectDuration of the
+	// configuration it returns, without restarting the children. The log
+	// file is reopened even if its path stays the same, so this also
+	// suits rotating it with an external tool. Nothing changes if it
+	// returns an error. With ForwardAll, SIGHUP is no longer forwarded
+	// then.
+	Reload ReloadFunc
+
+	// If greater than 1, the parent runs this many copies of the child at
+	// once, as workers of a pre-fork server do. Each worker is restarted
+	// on its own under Restart, and its panics are reported with its
+	// index in PanicInfo.Worker. The child learns its index from Worker.
+	// The output of all workers goes to the same writers, a whole line at
+	// a time.
+	// Wrap returns once all workers exited, with the first non-zero exit
+	// status among them. Signals and Interrupt reach all workers, while
+	// DumpStacks, CaptureProfiles, Pause and Resume only address the
+	// first one. This can't be combined with Terminal.
+	Workers int
+
+	// ExtraFiles are passed to every child, which gets them from Files.
+	// They are usually listeners that the children share, which lets a
+	// child started by Upgrade accept connections on them before the one
+	// it replaces stops. This isn't supported on Windows.
+	ExtraFiles []*os.File
+
+	// The window within which panics with the same fingerprint are
+	// considered repeats of each other. See PanicInfo.Occurrence. Defaults
+	// to 10 minutes.
+	DedupWindow time.Duration
+
+	// If greater than zero, the handlers are no longer called for a panic
+	// once its fingerprint has been seen this many times within
+	// DedupWindow. The panic is still mirrored to Writer unless HidePanic
+	// is set. This keeps a crash loop from flooding reports.
+	SuppressAfter int
+
+	// If greater than zero, the handlers are called for at most this many
+	// crashes within HandlerLimitWindow, whatever their fingerprints, so
+	// that a crash loop can't flood the systems they notify. The crashes
+	// beyond the limit are still mirrored to Writer, recorded and counted,
+	// and the next crash whose handlers are called gets their number in
+	// PanicInfo.RateLimited.
+	HandlerLimit int
+
+	// The window of HandlerLimit. Defaults to 1 minute.
+	HandlerLimitWindow time.Duration
+
+	// If set, the parent keeps a small record of the panics it has seen in
+	// this file (see CrashState), which survives parent restarts. It is
+	// best-effort: failures to read or write it are ignored. Use
+	// LoadCrashState to read it.
+	StateFile string
+
+	// The names of the environment variables of the child to include in
+	// PanicInfo.Env, such as "DEPLOY_ENV" or "POD_NAME". Names may be
+	// patterns as accepted by path.Match, such as "DEPLOY_*". Nothing is
+	// captured by default: the full environment often contains secrets,
+	// so only list variables that are safe to end up in crash reports.
+	CaptureEnv []string
+
+	// If true, the parent passes a W3C traceparent to the child in the
+	// TRACEPARENT environment variable, and includes it in
+	// PanicInfo.TraceParent, which links a crash to the distributed trace
+	// it happened in. It is TraceParent if that is set, or the
+	// TRACEPARENT of the environment of the parent, or a new one. The
+	// child reads it with the TraceParent function.
+	TraceContext bool
+
+	// The traceparent for TraceContext, such as the one of the request
+	// that started the parent. It is passed on even without
+	// TraceContext. Wrap sets it to the one it picked for TraceContext.
+	TraceParent string
+
+	// If greater than zero, the parent tries to read this many lines of
+	// source code on each side of the frame that panicked and attaches
+	// them as PanicInfo.Source. This only works where the sources are
+	// available at the paths recorded in the binary, such as on
+	// development machines.
+	SourceContext int
+
+	// If true, file paths in stack frames are normalized to the form the
+	// Go toolchain produces with -trimpath before they are used, such as
+	// for the fingerprint: GOROOT, module cache and vendor directory
+	// prefixes are removed. This keeps fingerprints stable across hosts,
+	// checkouts and build modes. PanicInfo.Text is never modified.
+	TrimPaths bool
+
+	// Path prefixes to remove from the file paths in stack frames, such
+	// as the directory the binary was built in. These apply with or
+	// without TrimPaths.
+	TrimPathPrefixes []string
+
+	// If set, the child writes heap and goroutine profiles to this
+	// directory right after Wrap returns, every ProfileInterval and
+	// whenever CaptureProfiles asks for them. The child can't write
+	// anything once it crashes, so the most recent profiles are attached
+	// to the crash as PanicInfo.Profiles. The profiles of children that
+	// exit cleanly are removed.
+	ProfileDir string
+
+	// How often the child refreshes its profiles in ProfileDir. Defaults
+	// to 1 minute.
+	ProfileInterval time.Duration
+
+	// GoTraceback, if set, is the GOTRACEBACK level the child runs with:
+	// "none", "single", "all", "system" or "crash", or "wer" on Windows
+	// to have Windows Error Reporting see the crash, see WERReports. It
+	// overrides any GOTRACEBACK in the environment. With "all" and above,
+	// crash reports include every goroutine. See PanicInfo.GoTraceback.
+	GoTraceback string
+
+	// If set, core files that the child dumps when it crashes are moved
+	// to this directory, so that they don't pile up wherever the system
+	// puts them. Cores are found whether or not this is set, see
+	// PanicInfo.Core.
+	CoreDir string
+
+	// OpenFiles, if set, lists the file descriptors the child has open
+	// as soon as it starts writing a crash, while it is usually still
+	// writing the stacks, and passes them to the handlers in
+	// PanicInfo.OpenFiles, along with the addresses of its sockets. A
+	// child that exited before they were read has none. This is only
+	// supported on Linux.
+	OpenFiles bool
+
+	// ProcStatus, if set, reads the status of the child and a summary of
+	// its memory mappings from /proc as soon as it starts writing a
+	// crash, like OpenFiles, and passes them to the handlers in
+	// PanicInfo.Proc. This is only supported on Linux.
+	ProcStatus bool
+
+	// KernelLog, if set, reports a child that was killed by SIGKILL,
+	// SIGSEGV or SIGBUS without writing a crash, which is otherwise only
+	// restarted, with KindSignal. The recent lines of the kernel log that
+	// mention its process ID are passed to the handlers in
+	// PanicInfo.KernelLog, which is how an OOM kill or a hardware fault
+	// shows. They are read from /dev/kmsg, or with dmesg, which may need
+	// privileges, and only match if the parent shares the PID namespace
+	// of the kernel log. This is only supported on Linux.
+	KernelLog bool
+
+	// DiagnosticReports, if set, looks for the report that the crash
+	// reporter of macOS writes to Library/Logs/DiagnosticReports when the
+	// child is killed by the signal of a crash, such as SIGSEGV in cgo
+	// code or SIGABRT with a GoTraceback of "crash", and passes its path
+	// to the handlers in PanicInfo.DiagnosticReport. A child killed so
+	// without writing a crash is reported with KindSignal. This is only
+	// supported on macOS.
+	DiagnosticReports bool
+
+	// The time the parent waits for the report of DiagnosticReports,
+	// which the crash reporter writes a few seconds after the child died,
+	// before calling the handlers without it. Defaults to 10 seconds.
+	DiagnosticReportWait time.Duration
+
+	// WERReports, if set, looks for the minidump and the report that
+	// Windows Error Reporting writes when the child crashes with a
+	// GoTraceback of "wer", or dies of an exception in native code, and
+	// passes their paths to the handlers in PanicInfo.WER. Minidumps are
+	// found in the DumpFolder of the LocalDumps key of the registry, which
+	// must be set up for Windows to write them, and in
+	// %LOCALAPPDATA%\CrashDumps, and are copied to CoreDir if that is
+	// set. A child that died of an exception without writing a crash is
+	// reported with KindSignal. This is only supported on Windows.
+	WERReports bool
+
+	// The time the parent waits for the minidump and the report of
+	// WERReports before calling the handlers without them. Defaults to 10
+	// seconds.
+	WERReportWait time.Duration
+
+	// PostMortem, if set, is a command the parent runs after a crash,
+	// such as a debugger, a symbolizer or a minidump tool. Its output is
+	// attached as PanicInfo.PostMortem. The placeholders "{exe}", "{core}"
+	// and "{pid}" in the arguments are replaced with the path of the
+	// binary, the path of its core file (see PanicInfo.Core) and the
+	// process ID of the child. If an argument uses "{core}" and there is
+	// no core file, the command isn't run. For example:
+	//
+	//	[]string{"dlv", "core", "{exe}", "{core}", "--init", "bt.dlv"}
+	//
+	// The command isn't run for suppressed panics, see SuppressAfter.
+	PostMortem []string
+
+	// The time the PostMortem command may take before it is killed.
+	// Defaults to 1 minute.
+	PostMortemTimeout time.Duration
+
+	// CoverDir, if set, is the GOCOVERDIR of a child built with -cover,
+	// overriding any GOCOVERDIR in the environment, which the child
+	// inherits otherwise. With -covermode=atomic, the parent also writes
+	// its own coverage there before Wrap returns.
+	CoverDir string
+
+	// If set, a child built with -cover -covermode=atomic writes its
+	// coverage counters to GOCOVERDIR this often. The runtime only writes
+	// them when the program exits normally, so without this the coverage
+	// of a child that crashes is lost. The runtime doesn't support this
+	// for the other cover modes.
+	CoverFlushInterval time.Duration
+
+	// Profiling, if set, turns on CPU, mutex and block profiling in the
+	// child and collects the profiles. See ProfilingConfig.
+	Profiling *ProfilingConfig
+
+	// Log, if set, makes the parent tee the stdout and stderr of the child
+	// into a log file, which is rotated as configured. The output is still
+	// forwarded to Stdout and Writer as usual. See LogConfig.
+	Log *LogConfig
+
+	// Daemon, if set, makes the parent detach into the background: Wrap
+	// starts a copy of the program in a new session without a terminal,
+	// with its output going to the configured files, and returns right
+	// away with exit status 0. The copy supervises the child as usual,
+	// including restarts and the handlers. See DaemonConfig.
+	Daemon *DaemonConfig
+
+	// If set, the parent prefixes every line of the output of the child
+	// with the time it arrived, before it is forwarded and logged. This
+	// is one of TimestampRFC3339 or TimestampRelative.
+	Timestamps string
+
+	// If true, the parent prefixes every line of the output of the child
+	// with the stream it came from, "out | " or "err | ", after the
+	// timestamp if there is one. This tells them apart where stdout and
+	// stderr end up in the same place, such as in the Log.
+	StreamLabels bool
+
+	// If true, the parent forwards every line of the output of the child
+	// as a JSON object on a line of its own, for log shippers:
+	//
+	//	{"ts":"2006-01-02T15:04:05.999999999Z","stream":"stderr","line":"..."}
+	//
+	// The handlers still receive panics as plain text. This can't be
+	// combined with Timestamps or StreamLabels, which it includes.
+	JSONLines bool
+
+	// Additional writers for the stdout and stderr of the child, which
+	// receive the same output as Stdout and Writer, and for the panics,
+	// alongside PanicWriter. Unlike with io.MultiWriter, each Sink decides
+	// what happens when it fails (see ErrorPolicy). Stdout itself aborts
+	// the stream when it fails while Writer and PanicWriter are ignored,
+	// as they are without sinks.
+	StdoutSinks []Sink
+	StderrSinks []Sink
+	PanicSinks  []Sink
+
+	// The longest the parent waits for the output writers to flush what
+	// they hold back once a child exited, before calling the handlers
+	// anyway. Defaults to 5 seconds. See Drain.
+	DrainTimeout time.Duration
+
+	// If set, the parent saves the raw stderr output of a child that
+	// panicked to a file in this directory, exactly as it received it,
+	// and sets PanicInfo.Recording to its path. Use Replay to run it
+	// through the detection and handlers again.
+	RecordDir string
+
+	// The number of bytes at the end of the stderr output of the child
+	// that are recorded with RecordDir. Defaults to 1 MiB.
+	RecordSize int
+
+	// TailSize, if greater than zero, is the number of bytes at the end
+	// of the stdout and stderr output of the child that are kept and
+	// passed to the handlers in PanicInfo.StdoutTail and StderrTail, for
+	// the context that led up to a crash. The crash text itself isn't
+	// part of the stderr tail.
+	TailSize int
+
+	// BreadcrumbSize, if greater than zero, is the size in bytes of a
+	// ring of breadcrumbs, short messages the child writes with
+	// Breadcrumb, in memory that the parent and the child share. The
+	// parent reads them once the child exited and passes them to the
+	// handlers in PanicInfo.Breadcrumbs. The ring holds a breadcrumb for
+	// every 128 bytes after a header of 64, and the oldest ones are
+	// overwritten. It isn't supported on Windows, Plan 9 and wasm.
+	BreadcrumbSize int
+
+	// Encrypter, if set, encrypts the crash files the parent writes: the
+	// recordings of RecordDir and the cores and minidumps it moves to
+	// CoreDir. They get the suffix of the Encrypter and are only readable
+	// by the owner of the file. A file that can't be encrypted is removed
+	// rather than left in the clear. panicwrapage.NewEncrypter encrypts
+	// them for age recipients, which `age -d -i key.txt` decrypts.
+	Encrypter Encrypter
+
+	// SigningKey, if set, signs the crash files the parent writes, after
+	// they are encrypted with Encrypter: the recordings of
+	// RecordDir and the cores it moves to CoreDir. The Ed25519ph
+	// signature over the SHA-512 digest of each file is written next to
+	// it with a ".sig" suffix, and VerifyFile checks it against the public
+	// key, so that the files can be shown not to have been changed on the
+	// host before they were collected.
+	SigningKey ed25519.PrivateKey
+
+	// MemoryBudget, if greater than zero, caps the bytes of output the
+	// parent holds in memory for all of its children, so that its own
+	// footprint is predictable. It must be more than the read buffers of
+	// the children, see StdoutBuffers and StderrBuffers, which come out of
+	// it first. Once the rest runs out, the parent gives way in this
+	// order:
+	//
+	//  1. The recordings of RecordDir keep less of the end of stderr.
+	//  2. The output held back for DetectStartup is let through early.
+	//  3. The text of a panic being detected is cut short: the rest of it
+	//     is dropped, and a line that says how much was dropped ends it.
+	//     A panic that starts once nothing is left goes undetected and is
+	//     forwarded as ordinary output.
+	//
+	// Recordings stop growing at half of what is left and held startup
+	// output at three quarters, so that the last quarter goes to panics.
+	MemoryBudget int
+
+	// LeakWatchdog, if set, samples the goroutine count of the child
+	// and passes its steady growth to LeakHandler. This requires Control.
+	// See LeakConfig.
+	LeakWatchdog *LeakConfig
+
+	// RSSWatchdog, if set, polls the resident set size of the child and
+	// passes it to RSSHandler once it grows past a threshold, restarting
+	// it if asked to. See RSSConfig.
+	RSSWatchdog *RSSConfig
+
+	// SpinWatchdog, if set, measures the CPU utilization of the child
+	// and passes its goroutine dump to SpinHandler once it spins. See
+	// SpinConfig.
+	SpinWatchdog *SpinConfig
+
+	// FDWatchdog, if set, counts the open file descriptors of the child
+	// and passes a summary of them to FDHandler once they approach its
+	// limit. See FDConfig.
+	FDWatchdog *FDConfig
+
+	// EventLog, if set, writes every crash to the Application event log
+	// of Windows, before the handlers are called. See EventLogConfig.
+	EventLog *EventLogConfig
+
+	// UnifiedLog, if set, logs a summary of every crash to the unified
+	// logging system of macOS, before the handlers are called. See
+	// UnifiedLogConfig.
+	UnifiedLog *UnifiedLogConfig
+
+	// Collector, if set, sends the PanicInfo of every crash to a remote
+	// collector over a mutually authenticated TLS connection, before the
+	// handlers are called, and keeps the crashes that it didn't take yet
+	// until it does. See CollectorConfig.
+	Collector *CollectorConfig
+
+	// Probes, if set, has marker files that the parent keeps for the
+	// liveness and readiness probes of a container. See ProbeConfig.
+	Probes *ProbeConfig
+
+	// Executor starts the child processes. It is meant for tests, and
+	// defaults to running the child with os/exec. See Executor.
+	Executor Executor
+
+	// Clock is the source of time for detecting panics, the restart
+	// backoff and crash times. It is meant for tests, and defaults to the
+	// system clock. See Clock.
+	Clock Clock
+
+	// If true, the parent prints what it does to stderr, such as starting
+	// and restarting the child, to debug the wrapping itself.
+	Debug bool
+
+	// If true, the environment variables that override this
+	// configuration, such as EnvDetectDuration, are ignored.
+	IgnoreEnv bool
 }
 
 // BasicWrap calls Wrap with the given handler function, using defaults
@@ -84,13 +894,69 @@ func BasicWrap(f HandlerFunc) (bool, int, error) {
 	})
 }
 
+// setDefaults fills in the defaults of the configuration.
+func setDefaults(c *WrapConfig) {
+	if c.DetectDuration == 0 {
+		c.DetectDuration = 300 * time.Millisecond
+	}
+
+	if c.PartialHeaderWait == 0 {
+		c.PartialHeaderWait = 300 * time.Millisecond
+	}
+
+	if c.DedupWindow == 0 {
+		c.DedupWindow = 10 * time.Minute
+	}
+
+	if c.DigestWindow == 0 {
+		c.DigestWindow = 5 * time.Minute
+	}
+
+	if c.HandlerLimitWindow == 0 {
+		c.HandlerLimitWindow = time.Minute
+	}
+
+	if c.Writer == nil {
+		c.Writer = os.Stderr
+	}
+
+	if c.RecordSize == 0 {
+		c.RecordSize = 1 << 20
+	}
+
+	if c.Clock == nil {
+		c.Clock = realClock{}
+	}
+
+	if c.CookieKey == "" {
+		c.CookieKey = DEFAULT_COOKIE_KEY
+	}
+
+	if c.CookieValue == "" {
+		c.CookieValue = DEFAULT_COOKIE_VAL
+	}
+
+	if c.DrainTimeout == 0 {
+		c.DrainTimeout = 5 * time.Second
+	}
+
+	if c.DiagnosticReportWait == 0 {
+		c.DiagnosticReportWait = 10 * time.Second
+	}
+
+	if c.WERReportWait == 0 {
+		c.WERReportWait = 10 * time.Second
+	}
+}
+
 // Wrap wraps the current executable in a handler to catch panics. It
 // returns an error if there was an error during the wrapping process.
 // If the error is nil, then the int result indicates the exit status of the
 // child process. If the exit status is -1, then this is the child process,
 // and execution should continue as normal. Otherwise, this is the parent
 // process and the child successfully ran already, and you should exit the
-// process with the returned exit status.
+// process with the returned exit status. If a handler panicked, the exit
+// status is returned along with a *HandlerPanicError.
 //
 // This function should be called very very early in your program's execution.
 // Ideally, this runs as the first line of code of main.
@@ -98,65 +964,1011 @@ func BasicWrap(f HandlerFunc) (bool, int, error) {
 // Once this is called, the given WrapConfig shouldn't be modified or used
 // any further.
 func Wrap(c *WrapConfig) (bool, int, error) {
-	if c.Handler == nil {
-		return false, -1, errors.New("handler must be set")
+	return wrap(c, nil)
+}
+
+// wrap is Wrap, which calls supervising, if set, once the parent is about
+// to supervise the child. See Run.
+func wrap(c *WrapConfig, supervising func(*child)) (bool, int, error) {
+	if !c.IgnoreEnv {
+		if err := applyEnvOverrides(c); err != nil {
+			return false, -1, err
+		}
 	}
 
-	if c.DetectDuration == 0 {
-		c.DetectDuration = 300 * time.Millisecond
+	if err := c.Validate(); err != nil {
+		return false, -1, err
 	}
 
-	if c.Writer == nil {
-		c.Writer = os.Stderr
+	setDefaults(c)
+
+	timestamp := timestampPrefix(c.Timestamps, time.Now())
+
+	// There is no wrapping where we can't execute ourselves, so just run
+	// unprotected.
+	if !Supported() {
+		return false, -1, nil
+	}
+
+	if isHandlerSidecar() {
+		exitStatus, err := serveHandlerSidecar(c)
+		return true, exitStatus, err
+	}
+	if isHandlerProcess() {
+		exitStatus, err := serveHandlerProcess(c)
+		return true, exitStatus, err
 	}
 
 	// If we're already wrapped, exit out.
 	if Wrapped(c) {
+		fallback, err := checkVersion(c)
+		if err != nil {
+			return false, -1, err
+		}
+		if err := startRlimits(); err != nil {
+			return false, -1, err
+		}
+		if err := startFiles(); err != nil {
+			return false, -1, err
+		}
+		if err := startBreadcrumbs(); err != nil {
+			return false, -1, err
+		}
+		if !fallback {
+			if err := startControl(); err != nil {
+				return false, -1, err
+			}
+		}
+		if c.ProfileDir != "" {
+			startProfiler(c)
+		}
+		startCoverage(c)
+		if c.Profiling != nil {
+			startProfiling(c.Profiling)
+		}
+		signalStartup()
+
+		return false, -1, nil
+	}
+
+	if c.Supervisor == SupervisorSkip && DetectSupervisor() != "" {
 		return false, -1, nil
 	}
 
+	dirs := []string{c.ProfileDir, c.CoverDir}
+	if c.Profiling != nil {
+		dirs = append(dirs, c.Profiling.Dir)
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return false, -1, err
+		}
+	}
+
 	// Get the path to our current executable
 	exePath, err := os.Executable()
 	if err != nil {
 		return false, -1, err
 	}
 
-	// Pipe the stderr so we can read all the data as we look for panics
-	stderr_r, stderr_w := io.Pipe()
+	// Detach into the background, where the copy we start takes over. It
+	// goes on to supervise the child as usual.
+	if c.Daemon != nil {
+		if !isDaemon() {
+			if err := startDaemon(c.Daemon, exePath); err != nil {
+				return false, -1, err
+			}
+
+			return true, 0, nil
+		}
+
+		if c.Daemon.PIDFile != "" {
+			if err := writePIDFile(c.Daemon.PIDFile); err != nil {
+				return false, -1, err
+			}
+			defer os.Remove(c.Daemon.PIDFile)
+		}
+	}
+
+	if c.TraceContext && c.TraceParent == "" {
+		c.TraceParent = traceParent()
+	}
+
+	if c.VerifyExecutable && c.ExecutableSHA256 == "" {
+		c.ExecutableSHA256, err = fileSHA256(runningExecutable(exePath))
+		if err != nil {
+			return false, -1, err
+		}
+	}
+
+	outputs := outputWriters(c)
+	if len(c.StdoutSinks) > 0 {
+		stdout := c.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		c.Stdout = newTee(append([]Sink{{Writer: stdout, OnError: ErrorAbort}}, c.StdoutSinks...))
+	}
+	if len(c.StderrSinks) > 0 {
+		c.Writer = newTee(append([]Sink{{Writer: c.Writer, OnError: ErrorIgnore}}, c.StderrSinks...))
+	}
+	c.PanicWriter = panicOutput(c)
+
+	// The parts that Reload switches are read through the reloader from
+	// here on.
+	reload := newReloader(c)
+	if c.Reload != nil {
+		reload.panics = &swapWriter{w: c.PanicWriter}
+		c.PanicWriter = reload.panics
+	}
+
+	if c.Log != nil || c.Reload != nil {
+		lf := new(logWriter)
+		if err := lf.open(c.Log); err != nil {
+			return false, -1, err
+		}
+		defer lf.Close()
+		reload.log = lf
+
+		stdout := c.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		c.Stdout = io.MultiWriter(stdout, lf)
+		c.Writer = io.MultiWriter(c.Writer, lf)
+	}
+
+	if outPrefix, errPrefix := linePrefixes(timestamp, c.StreamLabels); outPrefix != nil {
+		stdout := c.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		c.Stdout = newPrefixWriter(stdout, outPrefix)
+		c.Writer = newPrefixWriter(c.Writer, errPrefix)
+	}
+
+	if c.JSONLines {
+		stdout := c.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		c.Stdout = newJSONLineWriter(stdout, "stdout")
+		c.Writer = newJSONLineWriter(c.Writer, "stderr")
+		outputs = append([]io.Writer{c.Stdout, c.Writer}, outputs...)
+	}
+
+	if c.Workers > 1 {
+		stdout := c.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		c.Stdout = &sharedWriter{w: stdout}
+		c.Writer = &sharedWriter{w: c.Writer}
+	}
 
 	// doneCh is closed when we're done, signaling any other goroutines
 	// to end immediately.
 	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	// Listen to signals and capture them forever. We allow the child
+	// process to handle them in some way. The signals are forwarded to
+	// whichever child is currently running, so this outlives restarts.
+	ch := new(child)
+	if c.Workers > 1 {
+		ch.workers = []*child{ch}
+		for i := 1; i < c.Workers; i++ {
+			ch.workers = append(ch.workers, &child{index: i})
+		}
+	}
+	sigCh := make(chan os.Signal, 1)
+	fwdSigCh := make(chan os.Signal, 1)
+	reloadCh := make(chan os.Signal, 1)
+	if len(c.IgnoreSignals) == 0 {
+		c.IgnoreSignals = []os.Signal{os.Interrupt}
+	}
+	signal.Notify(sigCh, c.IgnoreSignals...)
+	if forward := forwardedSignals(c); len(forward) > 0 {
+		// Notify with no signals would relay every signal, including
+		// the SIGCHLD of our own child.
+		signal.Notify(fwdSigCh, forward...)
+	}
+	if c.Reload != nil && reloadSignal != nil {
+		signal.Notify(reloadCh, reloadSignal)
+	}
+	// A child in a process group of its own doesn't get the console
+	// events that make us receive the ignored signals, so pass them on.
+	relayIgnored := c.ConsoleGroup && runtime.GOOS == "windows"
+	go func() {
+		defer signal.Stop(sigCh)
+		defer signal.Stop(fwdSigCh)
+		defer signal.Stop(reloadCh)
+		for {
+			select {
+			case <-doneCh:
+				return
+			case s := <-fwdSigCh:
+				ch.each(func(w *child) { w.signal(s) })
+			case s := <-sigCh:
+				if relayIgnored {
+					ch.each(func(w *child) { w.signal(s) })
+				} else {
+					ch.each((*child).stop)
+				}
+			case <-reloadCh:
+				if err := reload.reload(); err != nil {
+					fmt.Fprintf(c.Writer, "panicwrap: reload failed: %s\n", err)
+				}
+			}
+		}
+	}()
+
+	tracker := newCrashTracker(c.DedupWindow)
+	build := readBuildInfo()
+	env := captureEnv(c.CaptureEnv)
+	host := readHostInfo()
+	traceback := goTraceback(c)
+
+	// handlerErr is the first panic of a handler, which is returned along
+	// with the exit status.
+	var handlerMu sync.Mutex
+	var handlerErr error
+	handled := func(err error) error {
+		handlerMu.Lock()
+		defer handlerMu.Unlock()
+		if handlerErr == nil {
+			handlerErr = err
+		}
+		return err
+	}
+	// handle runs the handlers for a crash or dump of a child. See
+	// ConcurrentHandlers.
+	var handlers sync.WaitGroup
+	handle := func(f func() error) {
+		if !c.ConcurrentHandlers {
+			handled(f())
+			return
+		}
+
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			handled(f())
+		}()
+	}
+	stats := newWrapStats(c.Clock)
+	budget := newMemoryBudget(c)
+	safeMode := newSafeMode()
+	ch.each(func(w *child) { w.stats, w.budget, w.safeMode = stats, budget, safeMode })
+	digest := newDigester(c, func(err error) { handled(err) })
+	var probes *prober
+	if c.Probes != nil {
+		probes = startProber(c, ch)
+		defer probes.stop()
+	}
+	if c.RSSWatchdog != nil {
+		defer startRSSWatcher(c, ch).stop()
+	}
+	if c.SpinWatchdog != nil {
+		defer startSpinWatcher(c, ch).stop()
+	}
+	if c.FDWatchdog != nil {
+		defer startFDWatcher(c, ch).stop()
+	}
+	// handleCrash handles a crash and records it in the statistics.
+	handleCrash := func(info *PanicInfo, streamed bool) error {
+		err := handlePanic(c, tracker, info, streamed)
+		stats.crashed(info.Kind, err)
+		digest.add(info)
+		if probes != nil {
+			probes.update()
+		}
+		emit(Event{Type: EventHandlerFinished, Time: c.Clock.Now(), Worker: info.Worker, PID: info.PID, RunID: info.RunID, Panic: info, Err: err})
+		return err
+	}
+	ch.inject = func(info *PanicInfo) error {
+		info.Text = scrub(c, info.Text)
+		info.Build = build
+		info.Env = env
+		info.Host = host
+		info.ParentPID = os.Getpid()
+		info.GoTraceback = traceback
+		info.Executable = exePath
+		info.TraceParent = c.TraceParent
+		ch.setLastCrash(info.Text)
+		return handled(handleCrash(info, false))
+	}
+	// crashInfo describes the panic of a child that exited.
+	exeDigests := new(exeDigestCache)
+	crashInfo := func(w *child, res *childResult, now time.Time) *PanicInfo {
+		info := &PanicInfo{
+			Text:        scrub(c, res.panicTxt),
+			ExitStatus:  res.exitStatus,
+			Signal:      res.signal,
+			Build:       build,
+			Env:         env,
+			Host:        host,
+			PID:         res.pid,
+			ParentPID:   os.Getpid(),
+			StartTime:   res.started,
+			RunID:       res.runID,
+			GoTraceback: traceback,
+			Executable:  exePath,
+			TraceParent: c.TraceParent,
+			Worker:      w.index,
+			Metadata:    res.metadata,
+		}
+		if res.coreDumped {
+			var err error
+			info.Core, err = findCore(res.pid, exePath, c.CoreDir, c.Encrypter)
+			if err != nil {
+				reportInternal(c, "encrypting the core", err)
+			}
+			if c.SigningKey != nil && c.CoreDir != "" && info.Core.Path != "" {
+				signFile(info.Core.Path, c.SigningKey)
+			}
+		}
+		if res.recording != nil {
+			info.Recording = saveRecording(c.RecordDir, res.pid, []byte(scrub(c, string(res.recording))), now, c.Encrypter)
+			if c.SigningKey != nil && info.Recording != "" {
+				signFile(info.Recording, c.SigningKey)
+			}
+		}
+		if c.DiagnosticReports && crashSignal(res.signal) {
+			info.DiagnosticReport = waitDiagnosticReport(c, diagnosticReportDirs(), res.exe, res.pid, res.started)
+		}
+		if c.WERReports && (traceback == "wer" || werException(res.exitStatus)) {
+			info.WER = waitWERReport(c, werReportDirs(res.exe), res.exe, res.pid, res.started)
+			if c.SigningKey != nil && c.CoreDir != "" && info.WER != nil && info.WER.Dump != "" {
+				signFile(info.WER.Dump, c.SigningKey)
+			}
+		}
+		info.OpenFiles = res.crash.files
+		info.LeftBehind = res.leftBehind
+		info.Proc = res.crash.proc
+		info.StdoutTail = scrub(c, res.stdoutTail)
+		info.StderrTail = scrub(c, res.stderrTail)
+		for _, b := range res.breadcrumbs {
+			info.Breadcrumbs = append(info.Breadcrumbs, scrub(c, b))
+		}
+		info.Cgroup = res.cgroup
+		info.Args = res.args
+		info.ExecutableModTime = res.exeModTime
+		bestEffort(c, "hashing the executable", func() {
+			info.ExecutableSHA256 = exeDigests.executableDigest(c, res.exe, res.exeModTime)
+		})
+		if res.startupFailed {
+			info.Kind = KindStartup
+		}
+		return info
+	}
+	ch.upgrade = func(w *child, timeout time.Duration) error {
+		res, err := upgradeChild(reload.config(), exePath, w, timeout)
+		if res != nil && res.panicTxt != "" && !isDump(res.panicTxt) {
+			info := crashInfo(w, res, c.Clock.Now())
+			ch.setLastCrash(info.Text)
+			handled(handleCrash(info, res.streamed))
+		}
+
+		return err
+	}
+	if c.Reload != nil {
+		ch.reload = reload.reload
+	}
+	ch.bench = func(bc *BenchConfig) ([]BenchResult, error) {
+		results, err := benchmark(bc, reload.config())
+		if err == nil {
+			stats.benched(results)
+		}
+		return results, err
+	}
+	ch.drain = func(timeout time.Duration) error {
+		return drainOutput(outputs, timeout, c.Clock)
+	}
+	if c.Subreaper {
+		r, err := startReaper(c, ch)
+		if err != nil {
+			return false, -1, err
+		}
+		defer r.stop()
+	}
+	if c.Terminal {
+		if ch.term, err = newTerminal(os.Stdin); err != nil {
+			return false, -1, err
+		}
+		if ch.term != nil {
+			defer ch.term.stop()
+		}
+	}
+	if c.Collector != nil {
+		col, err := startCollector(c)
+		if err != nil {
+			return false, -1, err
+		}
+		activeCollector.Store(col)
+		defer col.close()
+		defer activeCollector.CompareAndSwap(col, nil)
+	}
+	if c.HandlerSidecar != nil {
+		s := startSidecar(c)
+		activeSidecar.Store(s)
+		defer s.close()
+		defer activeSidecar.CompareAndSwap(s, nil)
+	}
+	activeChild.Store(ch)
+	defer activeChild.CompareAndSwap(ch, nil)
+	defer detectionDisabled.Store(false)
+	if c.CommandSocket != "" {
+		l, err := listenCommands(c.CommandSocket, ch)
+		if err != nil {
+			return false, -1, err
+		}
+		defer os.Remove(c.CommandSocket)
+		defer l.Close()
+	}
+	if supervising != nil {
+		supervising(ch)
+	}
+
+	// supervise runs the child of a worker, restarting it as configured,
+	// and returns its last exit status.
+	supervise := func(w *child) (int, error) {
+		var firstCrash time.Time
+		var upgraded <-chan childRun
+		for restarts := 0; ; {
+			rc := reload.config()
+			var res *childResult
+			var err error
+			if upgraded != nil {
+				// A child started by Upgrade took over.
+				r := <-upgraded
+				upgraded = nil
+				w.release()
+				res, err = r.res, r.err
+			} else {
+				res, err = runChild(rc, exePath, w)
+			}
+			if err != nil {
+				return 1, err
+			}
+			exitStatus := res.exitStatus
+
+			// Make sure the output of the child is out before the handlers
+			// see the panic, which may make the parent exit.
+			ch.drain(c.DrainTimeout)
+
+			now := c.Clock.Now()
+			emit(Event{Type: EventChildExited, Time: now, Worker: w.index, PID: res.pid, RunID: res.runID, ExitStatus: exitStatus})
+			if rc.Restart.healthy(now.Sub(res.started)) {
+				restarts = 0
+				firstCrash = time.Time{}
+			}
+			if exitStatus != 0 && firstCrash.IsZero() {
+				firstCrash = now
+			}
+
+			upgraded = w.takeOver()
+			forced := w.takeRestart()
+			restart := upgraded == nil && !w.stopping() && (forced || rc.Restart.restartsOn(exitStatus) && rc.Restart.allow(restarts))
+			var backoff time.Duration
+			if restart && !forced {
+				backoff = rc.Restart.delay(restarts)
+			}
+
+			if isDump(res.panicTxt) {
+				d := &Dump{
+					Text: scrub(c, res.panicTxt),
+					PID:  res.pid,
+					Time: now,
+				}
+				handle(func() error {
+					err := handleDump(c, w, d, res.streamed)
+					stats.dumped(err)
+					emit(Event{Type: EventHandlerFinished, Time: c.Clock.Now(), Worker: w.index, PID: d.PID, RunID: res.runID, Dump: d, Err: err})
+					return err
+				})
+			} else if res.panicTxt != "" || res.startupFailed || oomKilled(res) || c.KernelLog && kernelKill(res.signal) || c.DiagnosticReports && crashSignal(res.signal) || c.WERReports && werException(res.exitStatus) {
+				// A child killed without a word is reported with what
+				// the kernel logged about it.
+				killed := res.panicTxt == "" && !res.startupFailed
+				if killed && werException(res.exitStatus) {
+					res.panicTxt = exceptionText(res.exitStatus)
+				} else if killed && oomKilled(res) {
+					res.panicTxt = signalText(res.signal) + oomKillText
+				} else if killed {
+					res.panicTxt = signalText(res.signal)
+				}
+				if c.PanicExitStatus != 0 {
+					exitStatus = c.PanicExitStatus
+				}
+				info := crashInfo(w, res, now)
+				if killed && oomKilled(res) {
+					info.Kind = KindOOMKill
+				} else if killed {
+					info.Kind = KindSignal
+				}
+				if killed && c.KernelLog {
+					bestEffort(c, "reading the kernel log", func() { info.KernelLog, _ = readKernelLog(res.pid) })
+				}
+				info.Restarts = restarts
+				info.SinceFirstCrash = now.Sub(firstCrash)
+				info.Backoff = backoff
+				if restart && rc.Restart != nil && rc.Restart.SafeMode != nil {
+					info.SafeMode = w.safeMode.record(rc.Restart.SafeMode, fingerprint(info.Text, newPathTrimmer(c, info.Text)), now)
+					if info.SafeMode != nil && info.SafeMode.Entered {
+						debugf(c, "restarting the child of run %s in safe mode for crashes %s", res.runID, info.SafeMode.Fingerprint)
+					}
+				}
+				ch.setLastCrash(info.Text)
+				handle(func() error { return handleCrash(info, res.streamed) })
+			}
+
+			if c.ProfileDir != "" && res.panicTxt == "" && exitStatus == 0 {
+				removeProfiles(c.ProfileDir, res.pid)
+			}
+
+			if c.Profiling != nil {
+				paths := collectProfiling(c.Profiling.Dir, res.pid)
+				if c.Profiling.Collect != nil && len(paths) > 0 {
+					bestEffort(c, "collecting profiles", func() { c.Profiling.Collect(paths) })
+				}
+			}
+
+			if upgraded != nil {
+				continue
+			}
+			if !restart {
+				return exitStatus, nil
+			}
+
+			debugf(c, "restarting the child of run %s in %s", res.runID, backoff)
+			emit(Event{Type: EventRestartScheduled, Time: c.Clock.Now(), Worker: w.index, PID: res.pid, RunID: res.runID, Backoff: backoff})
+			<-c.Clock.After(backoff)
+			restarts++
+			stats.restarted()
+		}
+	}
+
+	var exitStatus int
+	if c.Workers > 1 {
+		exitStatus, err = superviseWorkers(ch, supervise)
+	} else {
+		exitStatus, err = supervise(ch)
+	}
+	handlers.Wait()
+	digest.close()
+	if err != nil {
+		return true, 1, err
+	}
+
+	if c.CoverDir != "" {
+		writeCoverage(c.CoverDir)
+	}
+
+	handlerMu.Lock()
+	defer handlerMu.Unlock()
+	return true, exitStatus, handlerErr
+}
+
+// mirrorPanic writes the panic to the configured writer between its
+// banners, or only the closing banner if it was streamed there already.
+func mirrorPanic(c *WrapConfig, info *PanicInfo, streamed bool) {
+	if c.Banners == nil {
+		if !streamed {
+			c.Writer.Write([]byte(info.Text))
+		}
+		return
+	}
+
+	// The streamed crash already ended with a line of its own.
+	before := ""
+	if !streamed {
+		writeBanner(c, c.Writer, "Start", c.Banners.Start, "", info)
+		c.Writer.Write([]byte(info.Text))
+		before = info.Text
+	}
+	writeBanner(c, c.Writer, "End", c.Banners.End, before, info)
+}
+
+// handlePanic fills in the rest of the PanicInfo for a detected panic,
+// mirrors the panic to the configured writer unless it was streamed there
+// already, and calls the handlers. It returns a *HandlerPanicError if one
+// of them panicked.
+func handlePanic(c *WrapConfig, tracker *crashTracker, info *PanicInfo, streamed bool) error {
+	bestEffort(c, "analyzing a panic", func() { analyzePanic(c, tracker, info) })
+	debugf(c, "handling a %s of child %d, run %s", info.Kind, info.PID, info.RunID)
+	emit(Event{Type: EventPanicDetected, Time: c.Clock.Now(), Worker: info.Worker, PID: info.PID, RunID: info.RunID, Panic: info})
+
+	if !c.HidePanic {
+		bestEffort(c, "mirroring a panic", func() { mirrorPanic(c, info, streamed) })
+	}
+
+	if c.SuppressAfter > 0 && info.Occurrence > c.SuppressAfter {
+		return nil
+	}
+
+	// The child is still running after a recovered panic.
+	if !info.Recovered {
+		bestEffort(c, "running the post-mortem commands", func() { info.PostMortem = runPostMortem(c, info) })
+	}
+
+	if c.PanicWriter != nil {
+		bestEffort(c, "writing to PanicWriter", func() { c.PanicWriter.Write([]byte(formatPanic(c, info))) })
+	}
+
+	if c.EventLog != nil {
+		bestEffort(c, "writing to the event log", func() { writeEventLog(c, info) })
+	}
+
+	if c.UnifiedLog != nil {
+		bestEffort(c, "writing to the unified log", func() { writeUnifiedLog(c, info) })
+	}
+
+	if col := activeCollector.Load(); col != nil {
+		bestEffort(c, "sending to the collector", func() { col.add(info) })
+	}
+
+	if c.HandlerLimit > 0 {
+		limited, ok := tracker.limit(c.Clock.Now(), c.HandlerLimit, c.HandlerLimitWindow)
+		if !ok {
+			return nil
+		}
+		info.RateLimited = limited
+	}
+
+	cmdErr := runHandlerCommands(c, info)
+
+	var err error
+	if s := activeSidecar.Load(); s != nil {
+		var handed bool
+		handed, err = s.handle(info)
+		if !handed {
+			reportInternal(c, "handing a crash to the handler sidecar", err)
+			err = callHandlers(c, info)
+		}
+	} else if c.HandlerProcess {
+		var started bool
+		started, err = runHandlerProcess(c, info)
+		if !started {
+			reportInternal(c, "starting the handler process", err)
+			err = callHandlers(c, info)
+		}
+	} else {
+		err = callHandlers(c, info)
+	}
+	if err == nil {
+		err = cmdErr
+	}
+
+	return err
+}
+
+// callHandlers calls the handlers for the crash, and returns the first
+// *HandlerPanicError if any of them panics.
+func callHandlers(c *WrapConfig, info *PanicInfo) error {
+	if (info.Kind == KindOutOfMemory || info.Kind == KindOOMKill) && c.OOMHandler != nil {
+		return callHandler(info.Text, func() { c.OOMHandler(info) })
+	}
+
+	// Both handlers are called even if the first one panics.
+	var err error
+	if c.Handler != nil {
+		err = callHandler(info.Text, func() { c.Handler(info.Text) })
+	}
+	if c.InfoHandler != nil {
+		if ierr := callHandler(info.Text, func() { c.InfoHandler(info) }); err == nil {
+			err = ierr
+		}
+	}
+
+	return err
+}
+
+// analyzePanic fills in the PanicInfo from the text of the panic and what
+// the parent knows about the crash.
+func analyzePanic(c *WrapConfig, tracker *crashTracker, info *PanicInfo) {
+	now := c.Clock.Now()
+	quirks := latestQuirks
+	if info.Build != nil {
+		quirks = quirksFor(info.Build.GoVersion)
+	}
+	info.Values = parseValues(info.Text, quirks)
+	if len(info.Values) > 0 {
+		info.Value = info.Values[0]
+	}
+	trimmer := newPathTrimmer(c, info.Text)
+	info.Fingerprint = fingerprint(info.Text, trimmer)
+	info.Goroutines = parseGoroutines(info.Text, trimmer)
+	if info.Kind == "" {
+		info.Kind = classify(info.Text, info.Value)
+	}
+	info.Severity = severity(c, info.Kind)
+	switch info.Kind {
+	case KindDeadlock:
+		info.Deadlock = summarizeDeadlock(info.Goroutines)
+	case KindOutOfMemory:
+		info.Memory = parseMemory(info.Text)
+	}
+	info.Occurrence = tracker.record(info.Fingerprint, now)
+	if c.ProfileDir != "" {
+		info.Profiles = readProfiles(c.ProfileDir, info.PID)
+	}
+	if c.SourceContext > 0 {
+		info.Source = readSource(info.Text, c.SourceContext)
+	}
+	if c.StateFile != "" && !info.Synthetic {
+		info.State = recordCrashState(c.StateFile, info.Fingerprint, now)
+	}
+}
+
+// childResult is the outcome of a single run of the child.
+type childResult struct {
+	exitStatus int
+
+	// panicTxt is the detected panic, or empty if there was none.
+	panicTxt string
+
+	// pid is the process ID of the child and started when it started.
+	pid     int
+	started time.Time
+
+	// runID is the ID of this start of the child. See RunID.
+	runID string
+
+	// args are the arguments the child was started with, and exe and
+	// exeModTime the path of its binary and when that was modified then.
+	args       []string
+	exe        string
+	exeModTime time.Time
+
+	// signal is the signal that killed the child, if one did.
+	signal int
+
+	// coreDumped is whether the child dumped a core file.
+	coreDumped bool
+
+	// recording is the end of the raw stderr output of the child if
+	// WrapConfig.RecordDir is set.
+	recording []byte
+
+	// stdoutTail and stderrTail are the end of the output of the child
+	// if WrapConfig.TailSize is set.
+	stdoutTail, stderrTail string
+
+	// breadcrumbs are what the child wrote with Breadcrumb, if
+	// WrapConfig.BreadcrumbSize is set.
+	breadcrumbs []string
+
+	// crash is what was read from /proc when the child crashed, if
+	// WrapConfig.OpenFiles or ProcStatus is set.
+	crash crashSnapshot
+
+	// leftBehind is what the child left running when it exited, if
+	// WrapConfig.Subreaper is set.
+	leftBehind []LeftBehindProcess
+
+	// cgroup is the resource usage of the child if WrapConfig.Cgroup is
+	// set.
+	cgroup *CgroupStats
+
+	// metadata is what the child set with SetMetadata.
+	metadata map[string]string
+
+	// startupFailed is whether the child failed before it came up, in
+	// which case panicTxt is its output. See WrapConfig.DetectStartup.
+	startupFailed bool
+
+	// streamed is whether panicTxt was already written out as it arrived.
+	// See WrapConfig.StreamPanics.
+	streamed bool
+}
+
+// runChild re-executes ourselves once and waits for that child to exit.
+func runChild(c *WrapConfig, exePath string, ch *child) (*childResult, error) {
+	// Pipe the stderr so we can read all the data as we look for panics
+	stderr_r, stderr_w := io.Pipe()
 
 	// panicCh is the channel on which the panic text will actually be
 	// sent.
 	panicCh := make(chan string)
 
-	// On close, make sure to finish off the copying of data to stderr
+	// Create the writer for stdout that we're going to use
+	var stdout_w io.Writer = os.Stdout
+	if c.Stdout != nil {
+		stdout_w = c.Stdout
+	}
+
+	// The output that isn't a crash goes through the rate writers, if
+	// there are any.
+	var stderr_out io.Writer = c.Writer
+
+	// The output of workers goes out a whole line at a time.
+	var lines []*lineWriter
+	if c.Workers > 1 {
+		stdout_w, stderr_out = newLineWriter(stdout_w), newLineWriter(stderr_out)
+		for _, w := range []io.Writer{stdout_w, stderr_out} {
+			if l, ok := w.(*lineWriter); ok {
+				lines = append(lines, l)
+			}
+		}
+	}
+	if c.OutputRate != nil {
+		var stdoutSuppressed, stderrSuppressed *atomic.Int64
+		if ch.stats != nil {
+			stdoutSuppressed, stderrSuppressed = &ch.stats.stdoutSuppressed, &ch.stats.stderrSuppressed
+		}
+		stdoutRate := newRateWriter(c, stdout_w, "stdout", stdoutSuppressed)
+		stderrRate := newRateWriter(c, stderr_out, "stderr", stderrSuppressed)
+		stdout_w, stderr_out = stdoutRate, stderrRate
+		defer stdoutRate.flush()
+		defer stderrRate.flush()
+	}
+
+	// The tails keep what was written out, so that a crash that was
+	// detected isn't part of them.
+	var stdoutTail, stderrTail *recorder
+	if c.TailSize > 0 {
+		stdoutTail = &recorder{max: c.TailSize, budget: ch.budget}
+		stderrTail = &recorder{max: c.TailSize, budget: ch.budget}
+		defer stdoutTail.free()
+		defer stderrTail.free()
+		stdout_w = io.MultiWriter(stdout_w, stdoutTail)
+		stderr_out = io.MultiWriter(stderr_out, stderrTail)
+	}
+
+	// On close, make sure to finish off the copying of data to stderr.
+	// If the child exited cleanly while output that looked like a panic
+	// was still being tracked, it isn't a panic and is written out as is.
 	defer func() {
-		defer close(doneCh)
 		stderr_w.Close()
-		<-panicCh
+		txt := <-panicCh
+		for _, l := range lines {
+			l.flush()
+		}
+		if txt != "" {
+			if c.StreamPanics {
+				writeStreamEnd(c.Writer, []byte(txt), streamNotCrashLine)
+			} else {
+				c.Writer.Write([]byte(txt))
+			}
+		}
 	}()
 
 	// Start the goroutine that will watch stderr for any panics
-	go trackPanic(stderr_r, c.Writer, c.DetectDuration, panicCh)
-
-	// Create the writer for stdout that we're going to use
-	var stdout_w io.Writer = os.Stdout
-	if c.Stdout != nil {
-		stdout_w = c.Stdout
+	trackSize := defaultTrackSize
+	if c.StderrBuffers != nil && c.StderrBuffers.ReadSize > 0 {
+		trackSize = c.StderrBuffers.ReadSize
 	}
+	go trackPanicContained(c, stderr_r, stderr_out, detectWindow(c), c.PartialHeaderWait, c.Clock, trackSize, c.StreamPanics, newHeaderRules(c), &detectionDisabled, ch.budget, panicCh)
 
 	// Build a subcommand to re-execute ourselves. We make sure to
 	// set the environmental variable to include our cookie. We also
 	// set stdin/stdout to match the config. Finally, we pipe stderr
 	// through ourselves in order to watch for panics.
-	cmd := exec.Command(exePath, os.Args[1:]...)
-	cmd.Env = append(os.Environ(), c.CookieKey+"="+c.CookieValue)
+	path := exePath
+	if c.ProcSelfExe && runtime.GOOS == "linux" {
+		path = "/proc/self/exe"
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Args[0] = exePath
+
+	// Check the binary before anything is set up for the child.
+	var verified *os.File
+	if c.ExecutableSHA256 != "" {
+		f, err := openVerified(path, c.ExecutableSHA256)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		verified = f
+	}
+
+	runID := newRunID()
+	cmd.Env = append(os.Environ(),
+		c.CookieKey+"="+c.CookieValue,
+		parentPIDEnvKey+"="+strconv.Itoa(os.Getpid()),
+		protocolEnvKey+"="+strconv.Itoa(protocolVersion),
+		runIDEnvKey+"="+runID)
+	if c.GoTraceback != "" {
+		cmd.Env = append(cmd.Env, "GOTRACEBACK="+c.GoTraceback)
+	}
+	if c.CoverDir != "" {
+		cmd.Env = append(cmd.Env, "GOCOVERDIR="+c.CoverDir)
+	}
+	if c.TraceParent != "" {
+		cmd.Env = append(cmd.Env, traceParentEnvKey+"="+c.TraceParent)
+	}
+	if len(c.Rlimits) > 0 {
+		cmd.Env = append(cmd.Env, rlimitEnvKey+"="+encodeRlimits(c.Rlimits))
+	}
+	if c.Workers > 1 {
+		cmd.Env = append(cmd.Env, workerEnvKey+"="+strconv.Itoa(ch.index))
+	}
+	if c.Restart != nil {
+		if fp := ch.safeMode.fingerprint(c.Restart.SafeMode, c.Clock.Now()); fp != "" {
+			cmd.Env, cmd.Args = safeModeMarker(c.Restart.SafeMode, fp, cmd.Env, cmd.Args)
+		}
+	}
+
+	if c.ConsoleGroup {
+		setConsoleGroup(cmd)
+	}
+	if c.HideConsole {
+		setHideConsole(cmd)
+	}
+	if c.Credential != nil {
+		if err := setCredential(cmd, c.Credential); err != nil {
+			return nil, err
+		}
+	}
+	if c.Chroot != "" {
+		if err := setChroot(cmd, c.Chroot); err != nil {
+			return nil, err
+		}
+	}
+	if c.Namespaces != 0 {
+		if err := setNamespaces(cmd, c.Namespaces); err != nil {
+			return nil, err
+		}
+	}
+
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = stdout_w
-	cmd.Stderr = stderr_w
+	if _, ok := stdout_w.(*os.File); !ok {
+		counted := stdout_w
+		if ch.stats != nil {
+			counted = &countingWriter{w: stdout_w, n: &ch.stats.stdoutBytes}
+		}
+
+		// The output is copied, which may fail.
+		cmd.Stdout = &reportingWriter{w: counted, report: func(err error) {
+			reportInternal(c, "forwarding stdout", err)
+		}}
+		if c.StdoutBuffers != nil {
+			cmd.Stdout = &bufferWriter{w: cmd.Stdout, config: c.StdoutBuffers, report: func(err error) {
+				reportInternal(c, "setting the pipe size of stdout", err)
+			}}
+		}
+	}
+	var counted io.Writer = stderr_w
+	if ch.stats != nil {
+		counted = &countingWriter{w: stderr_w, n: &ch.stats.stderrBytes}
+	}
+	cmd.Stderr = counted
+	if c.StderrEncoding != "" {
+		cmd.Stderr = newDecodingWriter(counted, c.StderrEncoding)
+	}
+
+	var tty *pty
+	if ch.term != nil {
+		var err error
+		if tty, err = ch.term.attach(c, cmd, stdout_w); err != nil {
+			return nil, err
+		}
+	}
+
+	// Hold back the output until the child came up. It comes before the
+	// recording, which keeps the output as it arrives.
+	var startup *startupWriter
+	if c.DetectStartup {
+		startup = &startupWriter{w: cmd.Stderr, budget: ch.budget}
+		cmd.Stderr = startup
+	}
+
+	var rec *recorder
+	if c.RecordDir != "" {
+		rec = &recorder{max: c.RecordSize, budget: ch.budget}
+		defer rec.free()
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, rec)
+	}
+
+	tap := newCrashTap(c)
+	if tap != nil {
+		cmd.Stderr = io.MultiWriter(tap, cmd.Stderr)
+	}
 
 	// Windows doesn't support this, but on other platforms pass in
 	// the original file descriptors so they can be used.
@@ -164,127 +1976,450 @@ func Wrap(c *WrapConfig) (bool, int, error) {
 		cmd.ExtraFiles = []*os.File{os.Stdin, os.Stdout, os.Stderr}
 	}
 
-	if err := cmd.Start(); err != nil {
-		return true, 1, err
+	// Pass in the pipes through which CaptureProfiles reaches the child.
+	// They must directly follow the files above, see profileRequestFd.
+	var profiles *profilePipes
+	var childEnds []*os.File
+	if c.ProfileDir != "" && runtime.GOOS != "windows" {
+		reqR, reqW, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		defer reqW.Close()
+
+		replyR, replyW, err := os.Pipe()
+		if err != nil {
+			reqR.Close()
+			return nil, err
+		}
+		defer replyR.Close()
+
+		cmd.ExtraFiles = append(cmd.ExtraFiles, reqR, replyW)
+		cmd.Env = append(cmd.Env, profileEnvKey+"=1")
+		profiles = &profilePipes{dir: c.ProfileDir, req: reqW, reply: replyR}
+		childEnds = []*os.File{reqR, replyW}
 	}
 
-	// Listen to signals and capture them forever. We allow the child
-	// process to handle them in some way.
-	sigCh := make(chan os.Signal, 1)
-	fwdSigCh := make(chan os.Signal, 1)
-	if len(c.IgnoreSignals) == 0 {
-		c.IgnoreSignals = []os.Signal{os.Interrupt}
+	// Pass in the control channel, and where to find it.
+	var control *parentControl
+	if c.Control {
+		inR, inW, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+
+		outR, outW, err := os.Pipe()
+		if err != nil {
+			inR.Close()
+			inW.Close()
+			return nil, err
+		}
+
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", controlEnvKey, 3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, inR, outW)
+		childEnds = append(childEnds, inR, outW)
+		control = newParentControl(c, ch.index, ch.ready, outR, inW)
+		defer control.close()
 	}
-	signal.Notify(sigCh, c.IgnoreSignals...)
-	signal.Notify(fwdSigCh, c.ForwardSignals...)
-	go func() {
-		defer signal.Stop(sigCh)
-		defer signal.Stop(fwdSigCh)
-		for {
-			select {
-			case <-doneCh:
-				return
-			case s := <-fwdSigCh:
-				if cmd.Process != nil {
-					cmd.Process.Signal(s)
+
+	// Pass in the ring of breadcrumbs, and where to find it.
+	var crumbs *parentBreadcrumbs
+	if c.BreadcrumbSize > 0 {
+		var err error
+		if crumbs, err = createBreadcrumbs(c.BreadcrumbSize); err != nil {
+			return nil, err
+		}
+		defer crumbs.close()
+
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", breadcrumbsEnvKey, 3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, crumbs.f)
+	}
+
+	// Pass in the files to share, and where to find them.
+	if len(c.ExtraFiles) > 0 {
+		fds := make([]string, len(c.ExtraFiles))
+		for i := range c.ExtraFiles {
+			fds[i] = strconv.Itoa(3 + len(cmd.ExtraFiles) + i)
+		}
+		cmd.Env = append(cmd.Env, filesEnvKey+"="+strings.Join(fds, ","))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, c.ExtraFiles...)
+	}
+
+	// Pass in the pipe through which the child tells us it came up.
+	var startupDone chan struct{}
+	if startup != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", startupEnvKey, 3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+		childEnds = append(childEnds, w)
+		startupDone = make(chan struct{})
+		go watchStartup(r, startup, startupDone)
+	}
+
+	// On Linux, start the child from the binary that was checked. It is
+	// passed as one of the files above, since the other descriptors of
+	// the parent may be replaced by them before the child execs. The
+	// child inherits the descriptor, which is read-only.
+	if verified != nil && runtime.GOOS == "linux" {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, verified)
+		cmd.Path = fmt.Sprintf("/proc/self/fd/%d", 2+len(cmd.ExtraFiles))
+	}
+
+	var cg *cgroup
+	if c.Cgroup != nil {
+		var err error
+		if cg, err = newCgroup(c.Cgroup); err != nil {
+			return nil, err
+		}
+		defer cg.remove()
+		setCgroup(cmd, cg)
+	}
+
+	if c.StderrBuffers != nil {
+		cmd.Stderr = &bufferWriter{w: cmd.Stderr, config: c.StderrBuffers, report: func(err error) {
+			reportInternal(c, "setting the pipe size of stderr", err)
+		}}
+	}
+
+	// Notice if the child detaches its stderr while it keeps running.
+	var stderrEOF chan struct{}
+	if c.StderrDetachedHandler != nil {
+		stderrEOF = make(chan struct{})
+		cmd.Stderr = &eofWriter{w: cmd.Stderr, eof: stderrEOF}
+	}
+
+	// Copy the output from pipes of our own, rather than those of the
+	// command, to decide how long to wait for the rest of it.
+	var trailing []*trailingPipe
+	if c.TrailingOutputMax > 0 {
+		for _, stream := range []*io.Writer{&cmd.Stdout, &cmd.Stderr} {
+			if _, ok := (*stream).(*os.File); ok || *stream == nil {
+				continue
+			}
+			p, err := startTrailingPipe(c.Clock, *stream)
+			if err != nil {
+				for _, f := range childEnds {
+					f.Close()
 				}
-			case <-sigCh:
+				return nil, err
 			}
+			defer p.w.Close()
+			trailing = append(trailing, p)
+			*stream = p.w
 		}
-	}()
+	} else {
+		cmd.WaitDelay = c.TrailingOutputWait
+	}
 
-	if err := cmd.Wait(); err != nil {
-		exitErr, ok := err.(*exec.ExitError)
-		if !ok {
-			// This is some other kind of subprocessing error.
-			return true, 1, err
+	executor := c.Executor
+	if executor == nil {
+		executor = execExecutor{}
+	}
+
+	start := func() (Process, error) {
+		return executor.Start(cmd)
+	}
+	var contract int
+	if c.Contract {
+		execStart := start
+		start = func() (proc Process, err error) {
+			proc, contract, err = startInContract(c, execStart)
+			return proc, err
 		}
+	}
+	proc, err := startChild(c, start)
+	// The child has its own copies of its ends of the pipes once it
+	// started, and closing ours makes reading from the others fail when
+	// it exits.
+	for _, f := range childEnds {
+		f.Close()
+	}
+	if tty != nil {
+		tty.started()
+		defer tty.close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := &childResult{pid: proc.Pid(), started: c.Clock.Now(), runID: runID, args: cmd.Args, exe: path}
+	if fi, err := os.Stat(path); err == nil {
+		res.exeModTime = fi.ModTime()
+	}
+	debugf(c, "started child %d, run %s", res.pid, res.runID)
+	if stderrEOF != nil {
+		exited := make(chan struct{})
+		defer close(exited)
+		go watchStderr(c, res.pid, stderrEOF, exited)
+	}
 
-		exitStatus := 1
-		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-			exitStatus = status.ExitStatus()
+	ch.set(proc)
+	defer ch.set(nil)
+	emit(Event{Type: EventChildStarted, Time: res.started, Worker: ch.index, PID: res.pid, RunID: runID})
+	if tap != nil {
+		tap.setPID(res.pid)
+	}
+	if profiles != nil {
+		profiles.pid = res.pid
+		ch.setProfiles(profiles)
+		defer ch.setProfiles(nil)
+	}
+	if control != nil {
+		ch.setControl(control)
+		defer ch.setControl(nil)
+	}
+
+	exit, err := proc.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if waitTrailing(trailing, c.TrailingOutputWait, c.TrailingOutputMax, c.Clock) {
+		debugf(c, "cut off the output of child %d, which kept coming", res.pid)
+	}
+	if contract != 0 {
+		waitContract(c, ch, contract)
+	}
+	if c.Subreaper {
+		res.leftBehind = leftBehind(c, res.pid)
+	}
+	if c.SignalExitStatus && exit.Signal > 0 {
+		exit.Status = 128 + exit.Signal
+	}
+	debugf(c, "child %d of run %s exited with status %d", res.pid, res.runID, exit.Status)
+	if tty != nil {
+		// Make sure the output is out before it is drained.
+		tty.close()
+	}
+	if cg != nil {
+		res.cgroup = cg.stats()
+	}
+	if control != nil {
+		res.metadata = control.close()
+	}
+	if crumbs != nil {
+		res.breadcrumbs = crumbs.read()
+	}
+	if startup != nil {
+		<-startupDone
+		var output string
+		if output, res.startupFailed = startup.finish(exit.Status != 0); res.startupFailed {
+			res.exitStatus = exit.Status
+			res.signal = exit.Signal
+			res.coreDumped = exit.CoreDumped
+			res.panicTxt = output
+			if rec != nil {
+				res.recording = rec.bytes()
+			}
+			if stdoutTail != nil {
+				res.stdoutTail, res.stderrTail = stdoutTail.tail(), stderrTail.tail()
+			}
+			if tap != nil {
+				res.crash = tap.snapshot()
+			}
+			return res, nil
 		}
+	}
+
+	if exit.Status != 0 {
+		res.exitStatus = exit.Status
+		res.signal = exit.Signal
+		res.coreDumped = exit.CoreDumped
 
 		// Close the writer end so that the tracker goroutine ends at some point
 		stderr_w.Close()
 
 		// Wait on the panic data
-		panicTxt := <-panicCh
-		if panicTxt != "" {
-			if !c.HidePanic {
-				c.Writer.Write([]byte(panicTxt))
-			}
-
-			c.Handler(panicTxt)
+		res.panicTxt = <-panicCh
+		if c.StreamPanics && res.panicTxt != "" {
+			writeStreamEnd(c.Writer, []byte(res.panicTxt), streamCrashLine)
+			res.streamed = true
+		}
+		if rec != nil {
+			res.recording = rec.bytes()
+		}
+		if stdoutTail != nil {
+			res.stdoutTail, res.stderrTail = stdoutTail.tail(), stderrTail.tail()
+		}
+		if tap != nil {
+			res.crash = tap.snapshot()
 		}
-
-		return true, exitStatus, nil
 	}
 
-	return true, 0, nil
+	return res, nil
 }
 
 // Wrapped checks if we're already wrapped according to the configuration
 // given.
 //
-// It must be only called once with a non-nil configuration as it unsets
-// the environment variable it uses to check if we are already wrapped.
-// This prevents false positive if your program tries to execute itself
+// The check is only done once per process, by the first call that has a
+// configuration, and later calls return its cached result. It unsets the
+// environment variable it uses to check if we are already wrapped, which
+// prevents false positive if your program tries to execute itself
 // recursively.
 //
 // Wrapped is very cheap and can be used early to short-circuit some pre-wrap
-// logic your application may have.
+// logic your application may have. It is safe to call from several
+// goroutines at once.
 //
-// If the given configuration is nil, then this will return a cached
-// value of Wrapped. This is useful because Wrapped is usually called early
-// to verify a process hasn't been wrapped before wrapping. After this,
-// the value of Wrapped hardly changes and is process-global, so other
-// libraries can check with Wrapped(nil).
+// If the given configuration is nil, then the configuration given to
+// SetWrappedConfig is used, if any. Otherwise, this returns false until
+// Wrapped was called with a configuration, which Wrap does. This is useful
+// because Wrapped is usually called early to verify a process hasn't been
+// wrapped before wrapping. After this, the value of Wrapped hardly changes
+// and is process-global, so other libraries can check with Wrapped(nil).
 func Wrapped(c *WrapConfig) bool {
+	if wrapDone.Load() {
+		return wrapResult.Load()
+	}
+
+	wrapMu.Lock()
+	defer wrapMu.Unlock()
+	if wrapDone.Load() {
+		return wrapResult.Load()
+	}
+
+	if c == nil {
+		c = wrapConfig
+	}
 	if c == nil {
-		return wrapCache.Load().(bool)
+		return false
 	}
 
-	if c.CookieKey == "" {
-		c.CookieKey = DEFAULT_COOKIE_KEY
+	key, value := c.CookieKey, c.CookieValue
+	if key == "" {
+		key = DEFAULT_COOKIE_KEY
 	}
 
-	if c.CookieValue == "" {
-		c.CookieValue = DEFAULT_COOKIE_VAL
+	if value == "" {
+		value = DEFAULT_COOKIE_VAL
 	}
 
 	// If the cookie key/value match our environment, then we are the
 	// child, so just exit now and tell the caller that we're the child
-	result := os.Getenv(c.CookieKey) == c.CookieValue
+	result := os.Getenv(key) == value
+	if c.VerifyParent {
+		result = result && os.Getenv(parentPIDEnvKey) == strconv.Itoa(os.Getppid())
+	}
 	if result {
-		os.Unsetenv(c.CookieKey)
+		os.Unsetenv(key)
+		os.Unsetenv(parentPIDEnvKey)
 	}
-	wrapCache.Store(result)
+	wrapResult.Store(result)
+	wrapDone.Store(true)
 	return result
 }
 
-// wrapCache is the cached value for Wrapped when called with nil
-var wrapCache atomic.Value
+// SetWrappedConfig sets the configuration that Wrapped(nil) checks if it
+// is called before Wrapped was called with a configuration. This lets
+// libraries that call Wrapped(nil) get the right answer before Wrap runs,
+// if the program passes the same configuration to Wrap. The configuration
+// is copied, and it has no effect once Wrapped did its check.
+func SetWrappedConfig(c *WrapConfig) {
+	wrapMu.Lock()
+	defer wrapMu.Unlock()
 
-func init() {
-	wrapCache.Store(false)
+	wrapConfig = &WrapConfig{
+		CookieKey:    c.CookieKey,
+		CookieValue:  c.CookieValue,
+		VerifyParent: c.VerifyParent,
+	}
 }
 
+// The process-global state of Wrapped. wrapResult is only valid once
+// wrapDone is set. The configuration given to SetWrappedConfig is guarded
+// by wrapMu.
+var (
+	wrapMu     sync.Mutex
+	wrapConfig *WrapConfig
+	wrapDone   atomic.Bool
+	wrapResult atomic.Bool
+)
+
+// parentPIDEnvKey passes the process ID of the parent to the child along
+// with the cookie. See WrapConfig.VerifyParent.
+const parentPIDEnvKey = "PANICWRAP_PARENT_PID"
+
 // trackPanic monitors the given reader for a panic. If a panic is detected,
 // it is outputted on the result channel. This will close the channel once
-// it is complete.
-func trackPanic(r io.Reader, w io.Writer, dur time.Duration, result chan<- string) {
+// it is complete. If a read ends with what may be the start of a panic
+// header, it is held back for up to hold for the rest of the header. If
+// stream is set, what may be a panic is also written out as it arrives,
+// between the lines of WrapConfig.StreamPanics. The rules decide which
+// headers count. While bypass is set, the output is written out as is
+// unless a panic is being tracked already.
+//
+// If dur is detectForever, what follows a header is tracked until the
+// output ends.
+func trackPanic(r io.Reader, w io.Writer, dur, hold time.Duration, clock Clock, size int, stream bool, rules headerRules, bypass *atomic.Bool, budget *memoryBudget, result chan<- string) {
 	defer close(result)
 
 	var panicTimer <-chan time.Time
 	panicBuf := new(bytes.Buffer)
-	panicHeaders := [][]byte{
-		[]byte("panic:"),
-		[]byte("fatal error:"),
+	startTimer := func() <-chan time.Time {
+		if dur == detectForever {
+			return make(chan time.Time)
+		}
+		return clock.After(dur)
+	}
+
+	// capture adds to the panic being tracked what the memory budget has
+	// room for, and counts what it drops. See WrapConfig.MemoryBudget.
+	var reserved, dropped int
+	defer func() { budget.release(reserved) }()
+	capture := func(p []byte) bool {
+		if dropped > 0 || !budget.reserve(usePanic, len(p)) {
+			dropped += len(p)
+			return false
+		}
+		reserved += len(p)
+		panicBuf.Write(p)
+		return true
+	}
+	// resetCapture forgets the panic being tracked.
+	resetCapture := func() {
+		panicBuf.Reset()
+		budget.release(reserved)
+		reserved, dropped = 0, 0
+	}
+	// captured returns the text of the panic being tracked.
+	captured := func() string {
+		if dropped > 0 {
+			return panicBuf.String() + fmt.Sprintf(droppedLine, dropped)
+		}
+		return panicBuf.String()
 	}
 	panicType := -1
 
-	tempBuf := make([]byte, 2048)
+	// Reads happen in a goroutine of their own, so that what is held
+	// back isn't held any longer while the next read blocks. It reads
+	// again once the previous read was dealt with.
+	reads := make(chan trackRead, 1)
+	next := make(chan struct{})
+	defer close(next)
+	go func() {
+		buf := make([]byte, size)
+		for {
+			n, err := r.Read(buf)
+			reads <- trackRead{buf[:n], err}
+			if err != nil {
+				return
+			}
+			if _, ok := <-next; !ok {
+				return
+			}
+		}
+	}()
+
+	var held []byte
+	var holdTimer <-chan time.Time
+	reading, eof := false, false
+
+	// midLine is whether the output inspected so far ends in the middle
+	// of a line. See headerRules.strict.
+	midLine := false
 	for {
 		var buf []byte
 		var n int
@@ -296,25 +2431,68 @@ func trackPanic(r io.Reader, w io.Writer, dur time.Duration, result chan<- strin
 
 			// First, remove the previous panic header so we don't loop
 			w.Write(panicBuf.Next(len(panicHeaders[panicType])))
+			midLine = true
 
 			// Next, assume that this is our new buffer to inspect
 			n = panicBuf.Len()
 			buf = make([]byte, n)
 			copy(buf, panicBuf.Bytes())
-			panicBuf.Reset()
+			resetCapture()
 		} else {
-			var err error
-			buf = tempBuf
-			n, err = r.Read(buf)
-			if n <= 0 && err == io.EOF {
+			if eof {
+				if panicBuf.Len() > 0 && rules.strict && dropped == 0 && !isDump(panicBuf.String()) && !goroutineHeaderRe.Match(panicBuf.Bytes()) {
+					// Without the stacks that follow a crash, it is
+					// ordinary output that looks like one.
+					if !stream {
+						panicTimer = nil
+						continue
+					}
+					writeStreamEnd(w, panicBuf.Bytes(), streamNotCrashLine)
+					resetCapture()
+				}
+				// What was held back goes out before the result, since
+				// the parent writes to w itself once it has it.
+				w.Write(held)
 				if panicBuf.Len() > 0 {
 					// We were tracking a panic, assume it was a panic
 					// and return that as the result.
-					result <- panicBuf.String()
+					result <- captured()
 				}
 
 				return
 			}
+
+			if reading {
+				next <- struct{}{}
+				reading = false
+			}
+
+			var read trackRead
+			select {
+			case read = <-reads:
+			case <-holdTimer:
+				// The rest of the header didn't come in time.
+				w.Write(held)
+				midLine = held[len(held)-1] != '\n'
+				held, holdTimer = nil, nil
+				continue
+			}
+			reading, eof = true, read.err != nil
+
+			buf = read.data
+			if len(held) > 0 {
+				buf = append(held, buf...)
+				held, holdTimer = nil, nil
+			}
+			n = len(buf)
+		}
+
+		if panicTimer == nil && bypass != nil && bypass.Load() {
+			w.Write(buf[0:n])
+			if n > 0 {
+				midLine = buf[n-1] != '\n'
+			}
+			continue
 		}
 
 		if panicTimer != nil {
@@ -327,22 +2505,42 @@ func trackPanic(r io.Reader, w io.Writer, dur time.Duration, result chan<- strin
 			default:
 			}
 
-			// No matter what, buffer the text some more.
-			panicBuf.Write(buf[0:n])
-
-			if !isPanic {
-				// It isn't a panic, stop tracking. Clean-up will happen
-				// on the next iteration.
+			if stream && !isPanic {
+				// What was tracked is already out, but what just
+				// arrived is inspected as usual.
+				writeStreamEnd(w, panicBuf.Bytes(), streamNotCrashLine)
+				resetCapture()
 				panicTimer = nil
+			} else {
+				// No matter what, buffer the text some more.
+				capture(buf[0:n])
+				if stream {
+					w.Write(buf[0:n])
+				}
+
+				if !isPanic {
+					// It isn't a panic, stop tracking. Clean-up will
+					// happen on the next iteration.
+					panicTimer = nil
+				}
+
+				continue
 			}
+		}
 
-			continue
+		// A JSON line that isn't complete yet is held back until it is,
+		// so that its headers can be told apart.
+		tail := n
+		if rules.skipJSON && hold > 0 && !eof {
+			if k := jsonTail(buf[0:n]); k >= 0 && n-k < size {
+				tail = k
+			}
 		}
 
 		panicType = -1
 		flushIdx := n
 		for i, header := range panicHeaders {
-			idx := bytes.Index(buf[0:n], header)
+			idx := indexHeader(buf[0:tail], header, rules, midLine)
 			if idx >= 0 {
 				panicType = i
 				flushIdx = idx
@@ -350,8 +2548,24 @@ func trackPanic(r io.Reader, w io.Writer, dur time.Duration, result chan<- strin
 			}
 		}
 
+		if panicType == -1 && tail < n {
+			flushIdx = tail
+			held = append([]byte(nil), buf[tail:n]...)
+			holdTimer = clock.After(hold)
+		} else if panicType == -1 && hold > 0 && !eof {
+			// Hold back what may be the start of a header.
+			if k := partialHeader(buf[0:n], panicHeaders); k > 0 {
+				flushIdx = n - k
+				held = append([]byte(nil), buf[flushIdx:n]...)
+				holdTimer = clock.After(hold)
+			}
+		}
+
 		// Flush to stderr what isn't a panic
 		w.Write(buf[0:flushIdx])
+		if flushIdx > 0 {
+			midLine = buf[flushIdx-1] != '\n'
+		}
 
 		if panicType == -1 {
 			// Not a panic so just continue along
@@ -359,7 +2573,156 @@ func trackPanic(r io.Reader, w io.Writer, dur time.Duration, result chan<- strin
 		}
 
 		// We have a panic header. Write we assume is a panic os far.
-		panicBuf.Write(buf[flushIdx:n])
-		panicTimer = time.After(dur)
+		if !capture(buf[flushIdx:n]) {
+			// There is no room for it, so it is forwarded as is.
+			resetCapture()
+			w.Write(buf[flushIdx:n])
+			continue
+		}
+		panicTimer = startTimer()
+		if stream {
+			io.WriteString(w, streamStartLine)
+			w.Write(buf[flushIdx:n])
+		}
+	}
+}
+
+// panicHeaders are the headers that start what is tracked for a panic.
+var panicHeaders = [][]byte{
+	[]byte("panic:"),
+	[]byte("fatal error:"),
+
+	// The runtime prints the heap numbers on this line right before the
+	// "fatal error: out of memory" header.
+	[]byte("runtime: out of memory:"),
+
+	// Goroutine dumps are tracked like panics so that they are kept
+	// together, but aren't handled as one. See isDump.
+	[]byte(dumpHeader),
+}
+
+// goroutineHeaderRe matches the header of the stack of a goroutine, which
+// follows every crash of the runtime unless GOTRACEBACK is "none".
+var goroutineHeaderRe = regexp.MustCompile(`(?m)^goroutine [0-9]+ \[`)
+
+// headerRules decide which panic headers count, beyond the header itself.
+type headerRules struct {
+	// skipJSON skips headers in lines that are JSON objects. See
+	// WrapConfig.IgnoreJSONLines.
+	skipJSON bool
+
+	// strict skips headers that don't start a line, and makes trackPanic
+	// require the stacks of a goroutine after them. See
+	// WrapConfig.StrictDetection.
+	strict bool
+
+	// ignore skips headers in lines that match one of the patterns. See
+	// WrapConfig.IgnorePatterns.
+	ignore []*regexp.Regexp
+}
+
+// newHeaderRules returns the header rules of the configuration.
+func newHeaderRules(c *WrapConfig) headerRules {
+	return headerRules{skipJSON: c.IgnoreJSONLines, strict: c.StrictDetection, ignore: c.IgnorePatterns}
+}
+
+// indexHeader returns the index of the first header in buf that counts
+// under the rules, or -1 if there is none. midLine is whether buf starts
+// in the middle of a line.
+func indexHeader(buf, header []byte, rules headerRules, midLine bool) int {
+	if !rules.skipJSON && !rules.strict && len(rules.ignore) == 0 {
+		return bytes.Index(buf, header)
+	}
+
+	for off := 0; ; {
+		idx := bytes.Index(buf[off:], header)
+		if idx < 0 {
+			return -1
+		}
+		idx += off
+		off = idx + len(header)
+
+		start := bytes.LastIndexByte(buf[:idx], '\n') + 1
+		if rules.strict && (idx != start || idx == 0 && midLine) {
+			continue
+		}
+		end := len(buf)
+		if i := bytes.IndexByte(buf[idx:], '\n'); i >= 0 {
+			end = idx + i
+			if rules.skipJSON && isJSONLine(buf[start:end]) {
+				continue
+			}
+		}
+		if matchesAny(rules.ignore, buf[start:end]) {
+			continue
+		}
+
+		return idx
+	}
+}
+
+// matchesAny returns whether the line matches one of the patterns.
+func matchesAny(patterns []*regexp.Regexp, line []byte) bool {
+	for _, re := range patterns {
+		if re.Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTail returns the start of the last line of buf if it isn't complete
+// and looks like the start of a JSON object, and -1 otherwise.
+func jsonTail(buf []byte) int {
+	start := bytes.LastIndexByte(buf, '\n') + 1
+	if start == len(buf) || !bytes.HasPrefix(bytes.TrimLeft(buf[start:], " \t"), []byte("{")) {
+		return -1
+	}
+
+	return start
+}
+
+// isJSONLine returns whether the line, without its newline, is a JSON
+// object, as structured loggers write them.
+func isJSONLine(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return len(line) > 0 && line[0] == '{' && json.Valid(line)
+}
+
+// detectForever is the duration of trackPanic that never runs out.
+const detectForever time.Duration = -1
+
+// detectWindow returns the duration of trackPanic for the configuration.
+// See WrapConfig.DetectTimeout.
+func detectWindow(c *WrapConfig) time.Duration {
+	if c.DetectTimeout == DetectTimeoutCrash {
+		return detectForever
+	}
+	return c.DetectDuration
+}
+
+// trackRead is the outcome of a read of trackPanic.
+type trackRead struct {
+	data []byte
+	err  error
+}
+
+// partialHeader returns the length of the end of buf that is the start,
+// but not the whole, of one of the headers, if it is at the start of a
+// line or of buf, and 0 otherwise.
+func partialHeader(buf []byte, headers [][]byte) int {
+	for start := 0; start < len(buf); start++ {
+		if start > 0 && buf[start-1] != '\n' {
+			continue
+		}
+
+		tail := buf[start:]
+		for _, header := range headers {
+			if len(tail) < len(header) && bytes.HasPrefix(header, tail) {
+				return len(tail)
+			}
+		}
 	}
+
+	return 0
 }
@@ -1,12 +1,20 @@
 package panicwrap
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -164,6 +172,374 @@ func TestHelperProcess(*testing.T) {
 			panic("uh oh")
 		}
 
+		os.Exit(exitStatus)
+	case "restart":
+		config := &WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Fprintf(os.Stdout, "occurrence: %d\n", info.Occurrence)
+				fmt.Fprintf(os.Stdout, "restarts: %d backoff: %s\n", info.Restarts, info.Backoff)
+			},
+			Restart: &RestartPolicy{
+				MaxRestarts: 2,
+				Backoff:     time.Millisecond,
+			},
+			SuppressAfter: 2,
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			panic("again")
+		}
+
+		os.Exit(exitStatus)
+	case "handler-process":
+		config := &WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Fprintf(os.Stdout, "handled %q in %d, started by %d", info.Value, os.Getpid(), os.Getppid())
+			},
+			HandlerProcess: true,
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "handler-sidecar", "handler-sidecar-dead", "handler-sidecar-restart":
+		if os.Getenv("PANICWRAP_HANDLER_PROCESS") == "sidecar" {
+			switch cmd {
+			case "handler-sidecar-dead":
+				os.Exit(3)
+			case "handler-sidecar-restart":
+				// Only the first sidecar dies.
+				if f, err := os.OpenFile(args[0], os.O_CREATE|os.O_EXCL, 0o600); err == nil {
+					f.Close()
+					os.Exit(3)
+				}
+			}
+		}
+		config := &WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Fprintf(os.Stderr, "handled %q in %d, started by %d\n", info.Value, os.Getpid(), os.Getppid())
+			},
+			HandlerSidecar: &SidecarConfig{Interval: 50 * time.Millisecond, Timeout: time.Second},
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			if cmd == "handler-sidecar-restart" {
+				// Let the parent check the sidecar.
+				time.Sleep(500 * time.Millisecond)
+			}
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "dump":
+		config := &WrapConfig{
+			Handler: panicHandler,
+			DumpHandler: func(d *Dump) {
+				fmt.Fprintf(os.Stdout, "dump: %d goroutines", len(d.Goroutines))
+			},
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			p, _ := os.FindProcess(os.Getpid())
+			p.Signal(syscall.SIGQUIT)
+			time.Sleep(time.Minute)
+		}
+
+		os.Exit(exitStatus)
+	case "dump-stacks":
+		config := &WrapConfig{
+			Handler: panicHandler,
+		}
+
+		go func() {
+			if Wrapped(nil) {
+				return
+			}
+
+			// Wait for the child to start.
+			time.Sleep(500 * time.Millisecond)
+			d, err := DumpStacks(5 * time.Second)
+			if err != nil {
+				fmt.Fprintf(os.Stdout, "dump error: %s", err)
+				return
+			}
+			fmt.Fprintf(os.Stdout, "dump: pid %d, %d goroutines", d.PID, len(d.Goroutines))
+		}()
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			time.Sleep(time.Minute)
+		}
+
+		// Give the goroutine above time to print the result.
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(exitStatus)
+	case "profile":
+		config := &WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Fprintf(os.Stdout, "crash profiles: %d\n", len(info.Profiles))
+			},
+			ProfileDir: args[0],
+		}
+
+		go func() {
+			if Wrapped(nil) {
+				return
+			}
+
+			// Wait for the child to start.
+			time.Sleep(500 * time.Millisecond)
+			profiles, err := CaptureProfiles(5 * time.Second)
+			if err != nil {
+				fmt.Fprintf(os.Stdout, "profile error: %s\n", err)
+				return
+			}
+			fmt.Fprintf(os.Stdout, "requested profiles: %d\n", len(profiles))
+		}()
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			time.Sleep(time.Second)
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "traceback":
+		config := &WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Fprintf(os.Stdout, "traceback: %s, runtime frames: %t\n",
+					info.GoTraceback, strings.Contains(info.Text, "runtime.goexit"))
+			},
+			GoTraceback: "system",
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "cover-dir":
+		config := &WrapConfig{
+			Handler:  panicHandler,
+			CoverDir: args[0],
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Fprintf(os.Stdout, "GOCOVERDIR=%s\n", os.Getenv("GOCOVERDIR"))
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "profiling":
+		config := &WrapConfig{
+			Handler: panicHandler,
+			Profiling: &ProfilingConfig{
+				Dir:                  args[0],
+				CPU:                  true,
+				CPUSegment:           200 * time.Millisecond,
+				MutexProfileFraction: 1,
+				BlockProfileRate:     1,
+				Collect: func(paths []string) {
+					for _, path := range paths {
+						fmt.Fprintf(os.Stdout, "profile: %s\n", filepath.Base(path))
+					}
+				},
+			},
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			time.Sleep(500 * time.Millisecond)
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "log":
+		config := &WrapConfig{
+			Handler:      panicHandler,
+			Log:          &LogConfig{Path: args[0]},
+			StreamLabels: len(args) > 1 && args[1] == "labels",
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Fprint(os.Stdout, "i am output\n")
+			os.Stdout.Sync()
+			time.Sleep(10 * time.Millisecond)
+			fmt.Fprint(os.Stderr, "stderr out\n")
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "json-lines":
+		config := &WrapConfig{
+			Handler:   panicHandler,
+			JSONLines: true,
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Fprint(os.Stdout, "i am output\n")
+			fmt.Fprint(os.Stderr, "stderr out")
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "drain":
+		done, exitStatus, err := BasicWrap(panicHandler)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Fprint(os.Stderr, "panic: is only logged\n")
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "panic-writer":
+		config := &WrapConfig{
+			PanicWriter: os.Stdout,
+			HidePanic:   true,
+		}
+		if len(args) > 0 && args[0] == "sinks" {
+			config = &WrapConfig{
+				HidePanic:   true,
+				Stdout:      new(bytes.Buffer),
+				StdoutSinks: []Sink{{Writer: os.Stdout}},
+				StderrSinks: []Sink{{Writer: os.Stdout}},
+				PanicSinks:  []Sink{{Writer: os.Stdout}},
+			}
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Fprint(os.Stderr, "stderr out\n")
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "record":
+		config := &WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Fprintf(os.Stdout, "recording: %s\n", info.Recording)
+			},
+			HidePanic: true,
+			RecordDir: args[0],
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Fprint(os.Stderr, "stderr out\n")
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "inject":
+		config := &WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Fprintf(os.Stdout, "synthetic: %t, value: %s, pid: %d\n",
+					info.Synthetic, info.Value, info.ParentPID)
+			},
+			HidePanic: true,
+		}
+
+		go func() {
+			if Wrapped(nil) {
+				return
+			}
+
+			time.Sleep(200 * time.Millisecond)
+			if err := InjectCrash(""); err != nil {
+				fmt.Fprintf(os.Stdout, "inject error: %s\n", err)
+			}
+		}()
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			time.Sleep(500 * time.Millisecond)
+			os.Exit(0)
+		}
+
 		os.Exit(exitStatus)
 	case "wrapped":
 		child := false
@@ -180,140 +556,961 @@ func TestHelperProcess(*testing.T) {
 			os.Exit(1)
 		}
 
-		if !done {
-			if child {
-				fmt.Printf("%v", Wrapped(nil))
-			}
-			os.Exit(0)
-		}
+		if !done {
+			if child {
+				fmt.Printf("%v", Wrapped(nil))
+			}
+			os.Exit(0)
+		}
+
+		if !child {
+			fmt.Printf("%v", Wrapped(nil))
+		}
+		os.Exit(exitStatus)
+	case "verify-parent":
+		config := &WrapConfig{
+			Handler:      panicHandler,
+			VerifyParent: true,
+		}
+
+		done, exitStatus, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Printf("%v", Wrapped(nil))
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "proc-self-exe":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:     panicHandler,
+			ProcSelfExe: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "verify-executable":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:          panicHandler,
+			VerifyExecutable: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "chroot":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler: panicHandler,
+			Chroot:  args[0],
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			if _, err := os.Stat(args[0]); err == nil {
+				fmt.Fprint(os.Stderr, "not in the chroot")
+				os.Exit(1)
+			}
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "namespaces":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:    panicHandler,
+			Namespaces: NamespaceMount | NamespacePID | NamespaceNetwork,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			mnt, _ := os.Readlink("/proc/self/ns/mnt")
+			net, _ := os.Readlink("/proc/self/ns/net")
+			fmt.Printf("%d %s %s", os.Getpid(), mnt, net)
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "control":
+		shutdown := len(args) > 0 && args[0] == "shutdown"
+		if shutdown {
+			go func() {
+				for {
+					if t, err := LastHeartbeat(); err == nil && !t.IsZero() {
+						RequestShutdown()
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}()
+		}
+
+		done, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Printf("metadata: %s\n", info.Metadata["request"])
+				os.Exit(0)
+			},
+			ReportHandler: func(r *Report) {
+				fmt.Printf("report: %s\n", r.Text)
+			},
+			Control: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			if shutdown {
+				Heartbeat()
+				<-ShutdownRequested()
+				fmt.Println("shutting down")
+				os.Exit(0)
+			}
+
+			SetMetadata("request", "42")
+			SendReport("slow")
+			panic("boom")
+		}
+
+		os.Exit(exitStatus)
+	case "breadcrumbs":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Printf("breadcrumbs: %q\n", info.Breadcrumbs)
+			},
+			HidePanic:      true,
+			BreadcrumbSize: 64 + 3*128,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			for i := 0; i < 5; i++ {
+				Breadcrumb(fmt.Sprintf("step %d", i))
+			}
+			panic("boom")
+		}
+
+		os.Exit(exitStatus)
+	case "recovered":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Printf("%s %t %s %s %s\n", info.Kind, info.Recovered, info.Value, info.Request.Method, info.Request.URL)
+			},
+			HidePanic: true,
+			Control:   true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			func() {
+				defer func() {
+					ReportRecovered(recover(), debug.Stack(), &RequestInfo{Method: "GET", URL: "/boom"})
+				}()
+				panic("boom")
+			}()
+			fmt.Println("still running")
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "subprocess":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler: panicHandler,
+			SubprocessHandler: func(info *PanicInfo) {
+				fmt.Printf("subprocess %d of %d: %s %s\n", info.PID, info.ParentPID, info.Kind, info.Value)
+			},
+			Control: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			cmd := exec.Command("sh", "-c", "echo starting >&2; printf 'panic: boom\\n\\ngoroutine 1 [running]:\\nmain.main()\\n' >&2; exit 2")
+			s, err := StartSubprocess(cmd, true)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "start error: %s", err)
+				os.Exit(1)
+			}
+			s.Wait()
+			fmt.Printf("started %d\n", cmd.Process.Pid)
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "startup":
+		// The child fails before it comes up, unless asked not to.
+		if os.Getenv(DEFAULT_COOKIE_KEY) == DEFAULT_COOKIE_VAL && len(args) == 0 {
+			fmt.Fprint(os.Stderr, "error while loading shared libraries: libfoo.so\n")
+			os.Exit(127)
+		}
+
+		done, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Printf("%s: %q\n", info.Kind, info.Text)
+			},
+			HidePanic:     true,
+			DetectStartup: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Fprint(os.Stderr, "came up\n")
+			panic("later")
+		}
+
+		os.Exit(exitStatus)
+	case "detach-stderr":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler: panicHandler,
+			StderrDetachedHandler: func(pid int) {
+				fmt.Println("detached")
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			os.Stderr.Close()
+			time.Sleep(stderrDetachGrace + 500*time.Millisecond)
+			os.Exit(3)
+		}
+
+		os.Exit(exitStatus)
+	case "buffers":
+		buffers := &StreamBuffers{ReadSize: 7, PipeSize: 4096}
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:       panicHandler,
+			Stdout:        struct{ io.Writer }{os.Stdout},
+			StdoutBuffers: buffers,
+			StderrBuffers: buffers,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Println(strings.Repeat("output ", 1000))
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "stream-panics":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:      panicHandler,
+			StreamPanics: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "concurrent-handlers":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				time.Sleep(500 * time.Millisecond)
+				fmt.Printf("handled %d\n", info.Restarts)
+			},
+			HidePanic:          true,
+			Restart:            &RestartPolicy{MaxRestarts: 1, Backoff: time.Millisecond},
+			ConcurrentHandlers: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			fmt.Println("child")
+			panic("uh oh")
+		}
+
+		fmt.Println("done")
+		os.Exit(exitStatus)
+	case "trailing-output":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:            panicHandler,
+			TrailingOutputWait: 100 * time.Millisecond,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			// The process it starts keeps stderr open after it exits.
+			cmd := exec.Command("sleep", "10")
+			cmd.Stderr = os.Stderr
+			if err := cmd.Start(); err != nil {
+				fmt.Fprintf(os.Stderr, "start error: %s", err)
+			}
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "trailing-output-max":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:            panicHandler,
+			TrailingOutputWait: 500 * time.Millisecond,
+			TrailingOutputMax:  3 * time.Second,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			// The process it starts writes after it exited, and then keeps
+			// stderr open.
+			cmd := exec.Command("sh", "-c", "sleep 0.2; echo late >&2; exec sleep 10")
+			cmd.Stderr = os.Stderr
+			if err := cmd.Start(); err != nil {
+				fmt.Fprintf(os.Stderr, "start error: %s", err)
+			}
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "reload":
+		dir := args[0]
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:   func(string) {},
+			HidePanic: true,
+			Reload: func() (*WrapConfig, error) {
+				defer os.WriteFile(filepath.Join(dir, "reloaded"), nil, 0644)
+				return &WrapConfig{PanicWriter: os.Stdout}, nil
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			parent, _ := os.FindProcess(os.Getppid())
+			parent.Signal(syscall.SIGHUP)
+			for {
+				if _, err := os.Stat(filepath.Join(dir, "reloaded")); err == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			panic("boom")
+		}
+
+		os.Exit(exitStatus)
+	case "upgrade":
+		ready := len(args) == 0 || args[0] != "timeout"
+		r, w, err := os.Pipe()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pipe error: %s", err)
+			os.Exit(1)
+		}
+		defer r.Close()
+		defer w.Close()
+
+		if !Wrapped(nil) {
+			go func() {
+				for {
+					if t, err := LastHeartbeat(); err == nil && !t.IsZero() {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+
+				os.Setenv("PANICWRAP_TEST_UPGRADED", "1")
+				fmt.Printf("upgrade: %v\n", Upgrade(time.Second))
+				if !ready {
+					RequestShutdown()
+				}
+			}()
+		}
+
+		done, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				fmt.Printf("handled: %s\n", info.Value)
+			},
+			Control:    true,
+			ExtraFiles: []*os.File{r},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			if os.Getenv("PANICWRAP_TEST_UPGRADED") == "" {
+				Heartbeat()
+				<-ShutdownRequested()
+				fmt.Println("old exiting")
+				os.Exit(0)
+			}
+
+			fmt.Printf("files: %d\n", len(Files()))
+			if !ready {
+				time.Sleep(time.Minute)
+			}
+			Ready()
+			panic("new")
+		}
+
+		fmt.Printf("exit: %d\n", exitStatus)
+		os.Exit(0)
+	case "daemon":
+		dir := args[0]
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler: panicHandler,
+			Daemon: &DaemonConfig{
+				PIDFile: filepath.Join(dir, "pid"),
+				Stdout:  filepath.Join(dir, "out"),
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			data, _ := os.ReadFile(filepath.Join(dir, "pid"))
+			fmt.Printf("%s %d\n", strings.TrimSpace(string(data)), os.Getppid())
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "terminal":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:  panicHandler,
+			Terminal: true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			tty, _ := os.Readlink("/proc/self/fd/0")
+			fmt.Printf("ready %s\n", tty)
+
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			fmt.Printf("got %s", line)
+			panic("boom")
+		}
+
+		os.Exit(exitStatus)
+	case "cgroup":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			InfoHandler: func(info *PanicInfo) {
+				if info.Cgroup != nil {
+					fmt.Printf("cgroup: %s", info.Cgroup.Path)
+				}
+				os.Exit(0)
+			},
+			Cgroup: &CgroupConfig{Dir: args[0]},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			panic("uh oh")
+		}
+
+		os.Exit(exitStatus)
+	case "priority":
+		done, exitStatus, err := Wrap(&WrapConfig{
+			Handler:  panicHandler,
+			Priority: &Priority{Nice: 5},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if !done {
+			// The niceness is the 19th field, and the name in the second
+			// one has no spaces.
+			data, _ := os.ReadFile("/proc/self/stat")
+			fmt.Print(strings.Fields(string(data))[18])
+			os.Exit(0)
+		}
+
+		os.Exit(exitStatus)
+	case "recursive":
+		config := &WrapConfig{
+			Handler: panicHandler,
+		}
+
+		if len(args) > 0 && args[0] == "child" {
+			fmt.Printf("%v", Wrapped(config))
+			os.Exit(0)
+		}
+
+		_, exitCode, err := Wrap(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+			os.Exit(1)
+		}
+
+		if Wrapped(nil) {
+			p := helperProcess("recursive", "child")
+			if err := p.Run(); err != nil {
+				fmt.Fprintf(os.Stderr, "wrap error: %s", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		os.Exit(exitCode)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %q\n", cmd)
+		os.Exit(2)
+	}
+}
+
+func TestPanicWrap_Output(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("no-panic-output")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(stdout.String(), "i am output") {
+		t.Fatalf("didn't forward: %#v", stdout.String())
+	}
+
+	if !strings.Contains(stderr.String(), "stderr out") {
+		t.Fatalf("didn't forward: %#v", stderr.String())
+	}
+}
+
+/*
+TODO(mitchellh): This property would be nice to gain.
+func TestPanicWrap_Output_Order(t *testing.T) {
+	output := new(bytes.Buffer)
+
+	p := helperProcess("no-panic-ordered-output")
+	p.Stdout = output
+	p.Stderr = output
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expectedBuf := new(bytes.Buffer)
+	for i := 0; i < 1000; i++ {
+		expectedBuf.WriteString("ab")
+	}
+
+	actual := strings.TrimSpace(output.String())
+	expected := strings.TrimSpace(expectedBuf.String())
+
+	if actual != expected {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+*/
+
+func TestPanicWrap_panicHide(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("panic", "hide")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if wrapRe.FindString(stdout.String()) == "" {
+		t.Fatalf("didn't wrap: %#v", stdout.String())
+	}
+
+	if strings.Contains(stderr.String(), "panic:") {
+		t.Fatalf("shouldn't have panic: %#v", stderr.String())
+	}
+}
+
+func TestPanicWrap_panicShow(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("panic", "show")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if wrapRe.FindString(stdout.String()) == "" {
+		t.Fatalf("didn't wrap: %#v", stdout.String())
+	}
+
+	if !strings.Contains(stderr.String(), "panic:") {
+		t.Fatalf("should have panic: %#v", stderr.String())
+	}
+}
+
+func TestPanicWrap_panicLong(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("panic-long")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if wrapRe.FindString(stdout.String()) == "" {
+		t.Fatalf("didn't wrap: %#v", stdout.String())
+	}
+}
+
+func TestPanicWrap_panicBoundary(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("panic-boundary")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The whole of "panic: oh crap" is handled.
+	if !strings.Contains(stdout.String(), "wrapped: 14") {
+		t.Fatalf("didn't wrap: %#v", stdout.String())
+	}
+}
+
+func TestPanicWrap_concurrentHandlers(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("concurrent-handlers")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err == nil {
+		t.Fatal("should exit with the status of the child")
+	}
+
+	// The child is restarted while the handler of its first crash runs,
+	// and Wrap returns once both handlers did.
+	out := stdout.String()
+	if strings.Count(out, "child\n") != 2 || !strings.HasSuffix(out, "done\n") {
+		t.Fatalf("bad: %#v", out)
+	}
+	if strings.LastIndex(out, "child\n") > strings.Index(out, "handled") {
+		t.Fatalf("should restart before the handler returned: %#v", out)
+	}
+	if !strings.Contains(out, "handled 0\n") || !strings.Contains(out, "handled 1\n") {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestPanicWrap_restart(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("restart")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	err := p.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The child crashes three times, but the third report is suppressed.
+	out := stdout.String()
+	if !strings.Contains(out, "occurrence: 1\n") ||
+		!strings.Contains(out, "occurrence: 2\n") ||
+		strings.Contains(out, "occurrence: 3\n") {
+		t.Fatalf("bad: %#v", out)
+	}
 
-		if !child {
-			fmt.Printf("%v", Wrapped(nil))
-		}
-		os.Exit(exitStatus)
-	case "recursive":
-		config := &WrapConfig{
-			Handler: panicHandler,
-		}
+	if !strings.Contains(out, "restarts: 0 backoff: 1ms\n") ||
+		!strings.Contains(out, "restarts: 1 backoff: 2ms\n") {
+		t.Fatalf("bad: %#v", out)
+	}
+}
 
-		if len(args) > 0 && args[0] == "child" {
-			fmt.Printf("%v", Wrapped(config))
-			os.Exit(0)
-		}
+func TestPanicWrap_handlerProcess(t *testing.T) {
+	stdout := new(bytes.Buffer)
 
-		_, exitCode, err := Wrap(config)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "wrap error: %s", err)
-			os.Exit(1)
-		}
+	p := helperProcess("handler-process")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	err := p.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("err: %s", err)
+	}
 
-		if Wrapped(nil) {
-			p := helperProcess("recursive", "child")
-			if err := p.Run(); err != nil {
-				fmt.Fprintf(os.Stderr, "wrap error: %s", err)
-				os.Exit(1)
-			}
-			os.Exit(0)
-		}
-		os.Exit(exitCode)
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %q\n", cmd)
-		os.Exit(2)
+	// The child prints the test failure before the handler runs.
+	out := stdout.String()
+	if i := strings.Index(out, "handled"); i >= 0 {
+		out = out[i:]
+	}
+	var value string
+	var pid, ppid int
+	if _, err := fmt.Sscanf(out, "handled %q in %d, started by %d", &value, &pid, &ppid); err != nil {
+		t.Fatalf("bad: %q", stdout.String())
+	}
+	if value != "uh oh" || ppid != p.Process.Pid || pid == ppid {
+		t.Fatalf("should call the handler in a process of its own: %q", stdout.String())
 	}
 }
 
-func TestPanicWrap_Output(t *testing.T) {
+func TestPanicWrap_dump(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no SIGQUIT on windows")
+	}
+
+	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
+
+	p := helperProcess("dump")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	p.Run()
+
+	if !strings.Contains(stdout.String(), "dump: ") {
+		t.Fatalf("didn't dump: %#v", stdout.String())
+	}
+
+	if wrapRe.FindString(stdout.String()) != "" {
+		t.Fatalf("shouldn't wrap: %#v", stdout.String())
+	}
+
+	if !strings.Contains(stderr.String(), "SIGQUIT: quit") {
+		t.Fatalf("should forward the dump: %#v", stderr.String())
+	}
+}
+
+func TestPanicWrap_dumpStacks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no SIGQUIT on windows")
+	}
+
 	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
 
-	p := helperProcess("no-panic-output")
+	p := helperProcess("dump-stacks")
 	p.Stdout = stdout
 	p.Stderr = stderr
-	if err := p.Run(); err != nil {
-		t.Fatalf("err: %s", err)
+	p.Run()
+
+	if !regexp.MustCompile(`dump: pid [1-9][0-9]*, [1-9][0-9]* goroutines`).MatchString(stdout.String()) {
+		t.Fatalf("didn't dump: %#v", stdout.String())
 	}
+}
 
-	if !strings.Contains(stdout.String(), "i am output") {
-		t.Fatalf("didn't forward: %#v", stdout.String())
+func TestPanicWrap_profile(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("profile", t.TempDir())
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	p.Run()
+
+	out := stdout.String()
+	if !strings.Contains(out, "crash profiles: 2\n") {
+		t.Fatalf("should attach the profiles: %#v", out)
 	}
 
-	if !strings.Contains(stderr.String(), "stderr out") {
-		t.Fatalf("didn't forward: %#v", stderr.String())
+	if runtime.GOOS != "windows" && !strings.Contains(out, "requested profiles: 2\n") {
+		t.Fatalf("should capture the profiles on request: %#v", out)
 	}
 }
 
-/*
-TODO(mitchellh): This property would be nice to gain.
-func TestPanicWrap_Output_Order(t *testing.T) {
-	output := new(bytes.Buffer)
+func TestPanicWrap_goTraceback(t *testing.T) {
+	stdout := new(bytes.Buffer)
 
-	p := helperProcess("no-panic-ordered-output")
-	p.Stdout = output
-	p.Stderr = output
-	if err := p.Run(); err != nil {
-		t.Fatalf("err: %s", err)
+	p := helperProcess("traceback")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	p.Run()
+
+	if !strings.Contains(stdout.String(), "traceback: system, runtime frames: true\n") {
+		t.Fatalf("bad: %#v", stdout.String())
 	}
+}
 
-	expectedBuf := new(bytes.Buffer)
-	for i := 0; i < 1000; i++ {
-		expectedBuf.WriteString("ab")
+func TestPanicWrap_coverDir(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	dir := filepath.Join(t.TempDir(), "cover")
+
+	p := helperProcess("cover-dir", dir)
+	p.Env = append(p.Env, "GOCOVERDIR=/elsewhere")
+	p.Stdout = stdout
+	p.Run()
+
+	if !strings.Contains(stdout.String(), "GOCOVERDIR="+dir+"\n") {
+		t.Fatalf("bad: %#v", stdout.String())
 	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("should create the directory: %s", err)
+	}
+}
 
-	actual := strings.TrimSpace(output.String())
-	expected := strings.TrimSpace(expectedBuf.String())
+func TestPanicWrap_profiling(t *testing.T) {
+	stdout := new(bytes.Buffer)
 
-	if actual != expected {
-		t.Fatalf("bad: %#v", actual)
+	p := helperProcess("profiling", t.TempDir())
+	p.Stdout = stdout
+	p.Run()
+
+	out := stdout.String()
+	for _, re := range []string{
+		`profile: \d+\.cpu\.0\.pprof\n`,
+		`profile: \d+\.cpu\.1\.pprof\n`,
+		`profile: \d+\.mutex\.pprof\n`,
+		`profile: \d+\.block\.pprof\n`,
+	} {
+		if !regexp.MustCompile(re).MatchString(out) {
+			t.Fatalf("missing %s: %#v", re, out)
+		}
+	}
+	if strings.Contains(out, ".tmp") {
+		t.Fatalf("shouldn't collect unfinished profiles: %#v", out)
 	}
 }
-*/
 
-func TestPanicWrap_panicHide(t *testing.T) {
+func TestPanicWrap_log(t *testing.T) {
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
+	path := filepath.Join(t.TempDir(), "child.log")
 
-	p := helperProcess("panic", "hide")
+	p := helperProcess("log", path)
 	p.Stdout = stdout
 	p.Stderr = stderr
-	if err := p.Run(); err != nil {
+	p.Run()
+
+	if !strings.Contains(stdout.String(), "i am output\n") ||
+		!strings.Contains(stderr.String(), "stderr out\n") {
+		t.Fatalf("should still forward the output: %#v, %#v", stdout.String(), stderr.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	if !strings.HasPrefix(string(data), "i am output\nstderr out\n") {
+		t.Fatalf("bad: %#v", string(data))
+	}
+}
 
-	if wrapRe.FindString(stdout.String()) == "" {
-		t.Fatalf("didn't wrap: %#v", stdout.String())
+func TestPanicWrap_streamLabels(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	path := filepath.Join(t.TempDir(), "child.log")
+
+	p := helperProcess("log", path, "labels")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	p.Run()
+
+	if !strings.Contains(stdout.String(), "out | i am output\n") {
+		t.Fatalf("bad: %#v", stdout.String())
 	}
 
-	if strings.Contains(stderr.String(), "panic:") {
-		t.Fatalf("shouldn't have panic: %#v", stderr.String())
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(string(data), "out | i am output\nerr | stderr out\n") {
+		t.Fatalf("bad: %#v", string(data))
 	}
 }
 
-func TestPanicWrap_panicShow(t *testing.T) {
+func TestPanicWrap_jsonLines(t *testing.T) {
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 
-	p := helperProcess("panic", "show")
+	p := helperProcess("json-lines")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	p.Run()
+
+	if !strings.Contains(stdout.String(), `"stream":"stdout","line":"i am output"}`) {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+
+	// The last line doesn't end, so it is only written once the child
+	// exited.
+	if !strings.Contains(stderr.String(), `"stream":"stderr","line":"stderr out"}`) {
+		t.Fatalf("bad: %#v", stderr.String())
+	}
+}
+
+func TestPanicWrap_drain(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("drain")
 	p.Stdout = stdout
 	p.Stderr = stderr
 	if err := p.Run(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if wrapRe.FindString(stdout.String()) == "" {
-		t.Fatalf("didn't wrap: %#v", stdout.String())
+	// The child exited cleanly before it was clear that this isn't a
+	// panic, so it is written out as is.
+	if stderr.String() != "panic: is only logged\n" {
+		t.Fatalf("bad: %#v", stderr.String())
 	}
-
-	if !strings.Contains(stderr.String(), "panic:") {
-		t.Fatalf("should have panic: %#v", stderr.String())
+	if stdout.String() != "" {
+		t.Fatalf("bad: %#v", stdout.String())
 	}
 }
 
-func TestPanicWrap_panicLong(t *testing.T) {
+func TestPanicWrap_procSelfExe(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only on Linux")
+	}
+
 	stdout := new(bytes.Buffer)
 
-	p := helperProcess("panic-long")
+	p := helperProcess("proc-self-exe")
 	p.Stdout = stdout
-	p.Stderr = new(bytes.Buffer)
 	if err := p.Run(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -323,15 +1520,11 @@ func TestPanicWrap_panicLong(t *testing.T) {
 	}
 }
 
-func TestPanicWrap_panicBoundary(t *testing.T) {
-	// TODO(mitchellh): panics are currently lost on boundaries
-	t.SkipNow()
-
+func TestPanicWrap_verifyExecutable(t *testing.T) {
 	stdout := new(bytes.Buffer)
 
-	p := helperProcess("panic-boundary")
+	p := helperProcess("verify-executable")
 	p.Stdout = stdout
-	//p.Stderr = new(bytes.Buffer)
 	if err := p.Run(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -341,6 +1534,94 @@ func TestPanicWrap_panicBoundary(t *testing.T) {
 	}
 }
 
+func TestPanicWrap_panicWriter(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("panic-writer")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	p.Run()
+
+	if !strings.Contains(stdout.String(), "panic: uh oh") {
+		t.Fatalf("should write the panic: %#v", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "stderr out") {
+		t.Fatalf("should only write the panic: %#v", stdout.String())
+	}
+
+	if !strings.Contains(stderr.String(), "stderr out") ||
+		strings.Contains(stderr.String(), "uh oh") {
+		t.Fatalf("bad: %#v", stderr.String())
+	}
+}
+
+func TestPanicWrap_sinks(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("panic-writer", "sinks")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	p.Run()
+
+	out := stdout.String()
+	if !strings.Contains(out, "stderr out\n") || !strings.Contains(out, "panic: uh oh") {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestPanicWrap_record(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("record", t.TempDir())
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	p.Run()
+
+	m := regexp.MustCompile(`recording: (.+)\n`).FindStringSubmatch(stdout.String())
+	if m == nil {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+
+	f, err := os.Open(m[1])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	stderr := new(bytes.Buffer)
+	var value string
+	err = Replay(f, &WrapConfig{
+		InfoHandler: func(info *PanicInfo) { value = info.Value },
+		Writer:      stderr,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.HasPrefix(stderr.String(), "stderr out\npanic: uh oh") {
+		t.Fatalf("should record stderr as is: %#v", stderr.String())
+	}
+	if !strings.HasPrefix(value, "uh oh") {
+		t.Fatalf("bad: %#v", value)
+	}
+}
+
+func TestPanicWrap_injectCrash(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("inject")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("the child should keep running: %s", err)
+	}
+
+	if !regexp.MustCompile(`synthetic: true, value: panicwrap: synthetic crash, pid: [1-9]`).MatchString(stdout.String()) {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+}
+
 func TestPanicWrap_recursive(t *testing.T) {
 	stdout := new(bytes.Buffer)
 
@@ -383,6 +1664,108 @@ func TestWrapped_parent(t *testing.T) {
 	}
 }
 
+// resetWrapped forgets the result of Wrapped for the rest of the test.
+func resetWrapped(t *testing.T) {
+	reset := func() {
+		wrapMu.Lock()
+		defer wrapMu.Unlock()
+		wrapConfig = nil
+		wrapDone.Store(false)
+		wrapResult.Store(false)
+	}
+
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestWrapped_cached(t *testing.T) {
+	resetWrapped(t)
+	t.Setenv("PANICWRAP_TEST_COOKIE", "yes")
+	config := &WrapConfig{CookieKey: "PANICWRAP_TEST_COOKIE", CookieValue: "yes"}
+
+	if Wrapped(nil) {
+		t.Fatal("nil shouldn't check without a configuration")
+	}
+
+	SetWrappedConfig(config)
+
+	var wg sync.WaitGroup
+	results := make([]bool, 8)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Wrapped(nil)
+		}()
+	}
+	wg.Wait()
+
+	for i, r := range results {
+		if !r {
+			t.Fatalf("%d: should be wrapped", i)
+		}
+	}
+	if _, ok := os.LookupEnv("PANICWRAP_TEST_COOKIE"); ok {
+		t.Fatal("should unset the cookie")
+	}
+
+	// The cookie is gone, but the result is cached.
+	if !Wrapped(config) {
+		t.Fatal("should still be wrapped")
+	}
+	if config.CookieKey != "PANICWRAP_TEST_COOKIE" || config.CookieValue != "yes" {
+		t.Fatalf("shouldn't change the configuration: %#v", config)
+	}
+}
+
+func TestWrapped_defaultCookie(t *testing.T) {
+	resetWrapped(t)
+	t.Setenv(DEFAULT_COOKIE_KEY, DEFAULT_COOKIE_VAL)
+
+	if !Wrapped(&WrapConfig{}) {
+		t.Fatal("should be wrapped")
+	}
+}
+
+func TestWrapped_verifyParent(t *testing.T) {
+	resetWrapped(t)
+	t.Setenv(DEFAULT_COOKIE_KEY, DEFAULT_COOKIE_VAL)
+	t.Setenv(parentPIDEnvKey, strconv.Itoa(os.Getppid()))
+
+	if !Wrapped(&WrapConfig{VerifyParent: true}) {
+		t.Fatal("should be wrapped")
+	}
+	if _, ok := os.LookupEnv(parentPIDEnvKey); ok {
+		t.Fatal("should unset the parent PID")
+	}
+}
+
+func TestWrapped_verifyParentInherited(t *testing.T) {
+	resetWrapped(t)
+	t.Setenv(DEFAULT_COOKIE_KEY, DEFAULT_COOKIE_VAL)
+
+	// The cookie was inherited through another process.
+	t.Setenv(parentPIDEnvKey, strconv.Itoa(os.Getppid()+1))
+
+	if Wrapped(&WrapConfig{VerifyParent: true}) {
+		t.Fatal("shouldn't be wrapped")
+	}
+}
+
+func TestWrapped_verifyParentChild(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("verify-parent")
+	p.Stdout = stdout
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if stdout.String() != "true" {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+}
+
 func TestPanicWrap_fatal(t *testing.T) {
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
@@ -0,0 +1,95 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicWrap_trailingOutput(t *testing.T) {
+	p := helperProcess("trailing-output")
+	p.Stdout = new(bytes.Buffer)
+	p.Stderr = new(bytes.Buffer)
+	p.WaitDelay = time.Second
+
+	start := time.Now()
+	// The process the child started still holds the output of the
+	// parent too.
+	if err := p.Run(); err != nil && !errors.Is(err, exec.ErrWaitDelay) {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The parent doesn't wait for the process the child started.
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("waited too long: %s", d)
+	}
+}
+
+func TestPanicWrap_trailingOutputMax(t *testing.T) {
+	stderr := new(syncBuffer)
+	p := helperProcess("trailing-output-max")
+	p.Stdout = new(bytes.Buffer)
+	p.Stderr = stderr
+	p.WaitDelay = time.Second
+
+	start := time.Now()
+	if err := p.Run(); err != nil && !errors.Is(err, exec.ErrWaitDelay) {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(stderr.String(), "late") {
+		t.Fatalf("should forward the output that came after the child exited: %q", stderr.String())
+	}
+	// The process the child started holds stderr for 10 seconds.
+	if d := time.Since(start); d > 8*time.Second {
+		t.Fatalf("waited too long: %s", d)
+	}
+}
+
+func TestExecExecutor_signal(t *testing.T) {
+	p, err := execExecutor{}.Start(exec.Command("sh", "-c", "kill -TERM $$"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	exit, err := p.Wait()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exit.Status != -1 || exit.Signal != 15 {
+		t.Fatalf("bad: %#v", exit)
+	}
+}
+
+func TestPanicWrap_subprocess(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("subprocess")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s\n%s", err, stderr)
+	}
+
+	m := regexp.MustCompile(`started ([0-9]+)`).FindStringSubmatch(stdout.String())
+	if m == nil {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+	pid := m[1]
+
+	if !regexp.MustCompile(`subprocess ` + pid + ` of [1-9][0-9]*: panic boom`).MatchString(stdout.String()) {
+		t.Fatalf("should report the crash of the subprocess: %#v", stdout.String())
+	}
+	for _, line := range []string{"[" + pid + "] starting\n", "[" + pid + "] panic: boom\n"} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Fatalf("should label the output of the subprocess: %#v", stderr.String())
+		}
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/mohsenpashna/panicwrap/panicwrapage
+
+go 1.23.2
+
+require (
+	filippo.io/age v1.2.1
+	github.com/mohsenpashna/panicwrap v0.0.0-00010101000000-000000000000
+)
+
+require (
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
+
+replace github.com/mohsenpashna/panicwrap => ../
@@ -0,0 +1,56 @@
+// The panicwrapage package encrypts the crash files that panicwrap writes,
+// such as cores and recordings of stderr, in the age format
+// (https://age-encryption.org/v1). It is a module of its own, so that
+// panicwrap doesn't depend on the age implementation.
+package panicwrapage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"github.com/mohsenpashna/panicwrap"
+)
+
+// Encrypter encrypts files for age recipients. It implements
+// panicwrap.Encrypter, so that it can be set as
+// panicwrap.WrapConfig.Encrypter.
+type Encrypter struct {
+	recipients []age.Recipient
+}
+
+var _ panicwrap.Encrypter = (*Encrypter)(nil)
+
+// NewEncrypter returns an Encrypter for the age X25519 recipients, such as
+// "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p". Any
+// of their identities decrypts the files, with `age -d -i key.txt`. Only
+// the public keys are needed, and they aren't passed to the child.
+func NewEncrypter(recipients ...string) (*Encrypter, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipients")
+	}
+
+	e := &Encrypter{}
+	for _, s := range recipients {
+		r, err := age.ParseX25519Recipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %s", s, err)
+		}
+		e.recipients = append(e.recipients, r)
+	}
+
+	return e, nil
+}
+
+// Encrypt returns a writer that writes what is written to it to w,
+// encrypted for the recipients. Closing it writes the last chunk, but
+// doesn't close w.
+func (e *Encrypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	return age.Encrypt(w, e.recipients...)
+}
+
+// Suffix returns ".age".
+func (e *Encrypter) Suffix() string {
+	return ".age"
+}
@@ -0,0 +1,72 @@
+package panicwrapage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestEncrypter(t *testing.T) {
+	first, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	second, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	e, err := NewEncrypter(first.Recipient().String(), second.Recipient().String())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Across the 64 KiB chunks of the payload.
+	plaintext := make([]byte, 3*64*1024+42)
+	rand.Read(plaintext)
+
+	var out bytes.Buffer
+	w, err := e.Encrypt(&out)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, identity := range []age.Identity{first, second} {
+		r, err := age.Decrypt(bytes.NewReader(out.Bytes()), identity)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		decrypted, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("bad: %v", err)
+		}
+	}
+	if e.Suffix() != ".age" {
+		t.Fatalf("bad: %s", e.Suffix())
+	}
+}
+
+func TestNewEncrypter_invalid(t *testing.T) {
+	if _, err := NewEncrypter("age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, recipients := range [][]string{
+		nil,
+		{"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8q"},
+		{"age1nope"},
+		{""},
+	} {
+		if _, err := NewEncrypter(recipients...); err == nil {
+			t.Fatalf("should fail: %q", recipients)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// The panicwrapcollector package is a collector for the crashes that
+// parents send with panicwrap.WrapConfig.Collector, so that the crashes of
+// a fleet are gathered in one place as soon as they happen.
+package panicwrapcollector
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mohsenpashna/panicwrap"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe once the Server
+// is closed.
+var ErrServerClosed = errors.New("panicwrapcollector: Server closed")
+
+// handshakeTimeout is how long a parent has to complete the TLS handshake.
+const handshakeTimeout = 10 * time.Second
+
+// Report is a crash that a parent sent.
+type Report struct {
+	// ID is the ID that the parent gave the crash, which is unique across
+	// parents.
+	ID string
+
+	// Crash is the crash, as the handlers of the parent received it.
+	Crash *panicwrap.PanicInfo
+
+	// Peer is the certificate that the parent presented, whose subject
+	// names the host it runs on, and Addr the address it connected from.
+	Peer *x509.Certificate
+	Addr net.Addr
+}
+
+// Server receives crashes from parents over TLS connections, on which
+// they must present a certificate, and passes them to its Handler.
+type Server struct {
+	// TLSConfig has the certificate of the collector, and in ClientCAs
+	// the authorities that the certificates of the parents are checked
+	// against. It must be set. ClientAuth defaults to
+	// tls.RequireAndVerifyClientCert, and a parent that presents no
+	// certificate is turned away whatever it is set to.
+	TLSConfig *tls.Config
+
+	// Handler is called with every crash that a parent sends, from the
+	// goroutine of its connection. If it returns an error, the crash
+	// isn't taken, and the parent sends it again once it connects again.
+	// Crashes that were sent again after they were taken are dropped, if
+	// their ID is among the last Remember that were taken, so that a
+	// crash is usually handled once, and at least once. It must be set.
+	Handler func(*Report) error
+
+	// Remember is how many IDs of crashes that were taken are kept, to
+	// drop the crashes that are sent again. Defaults to 10000.
+	Remember int
+
+	// ErrorLog, if set, logs the connections that failed. Defaults to the
+	// standard logger.
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	wg        sync.WaitGroup
+
+	// seen are the IDs of the crashes that were taken, and order the same
+	// IDs in the order they were taken, for the oldest to be forgotten.
+	seen  map[string]bool
+	order []string
+}
+
+// message is what a parent sends: a crash, and the ID it is answered
+// with once it is taken.
+type message struct {
+	ID    string               `json:"id"`
+	Crash *panicwrap.PanicInfo `json:"crash"`
+}
+
+// ListenAndServe listens on the TCP address and serves the parents that
+// connect to it. See Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts the connections of parents on l, which is a listener of
+// plain connections that Serve adds TLS to, and serves each in a
+// goroutine of its own. It closes l when it returns, which is once l
+// fails, or with ErrServerClosed once the Server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	if s.TLSConfig == nil || s.Handler == nil {
+		l.Close()
+		return errors.New("panicwrapcollector: TLSConfig and Handler must be set")
+	}
+	cfg := s.TLSConfig.Clone()
+	if cfg.ClientAuth == tls.NoClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		tc := tls.Server(conn, cfg)
+		if !s.track(tc) {
+			tc.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(tc)
+			s.serveConn(tc)
+		}()
+	}
+}
+
+// track adds a connection to those that Close closes, unless the Server
+// is closed already.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]bool)
+	}
+	s.conns[conn] = true
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	conn.Close()
+}
+
+// serveConn reads the crashes of a parent and answers those it took.
+func (s *Server) serveConn(conn *tls.Conn) {
+	addr := conn.RemoteAddr()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		s.logf("panicwrapcollector: handshake with %s: %s", addr, err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	peers := conn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		s.logf("panicwrapcollector: %s presented no certificate", addr)
+		return
+	}
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var m message
+		if err := dec.Decode(&m); err != nil {
+			if err != io.EOF && !s.isClosed() {
+				s.logf("panicwrapcollector: reading from %s: %s", addr, err)
+			}
+			return
+		}
+		if m.ID == "" || m.Crash == nil {
+			s.logf("panicwrapcollector: %s sent a crash without an ID", addr)
+			return
+		}
+
+		if !s.taken(m.ID) {
+			if err := s.Handler(&Report{ID: m.ID, Crash: m.Crash, Peer: peers[0], Addr: addr}); err != nil {
+				s.logf("panicwrapcollector: handling crash %s of %s: %s", m.ID, addr, err)
+				return
+			}
+			s.take(m.ID)
+		}
+		if err := enc.Encode(struct {
+			ID string `json:"id"`
+		}{m.ID}); err != nil {
+			return
+		}
+	}
+}
+
+// taken returns whether the crash with the ID was taken already.
+func (s *Server) taken(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen[id]
+}
+
+// take remembers that the crash with the ID was taken, and forgets the
+// oldest past Remember.
+func (s *Server) take(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	if s.seen[id] {
+		return
+	}
+	s.seen[id] = true
+	s.order = append(s.order, id)
+
+	remember := s.Remember
+	if remember <= 0 {
+		remember = 10000
+	}
+	for len(s.order) > remember {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Close stops the Server: it closes the listeners and the connections, and
+// waits for the handlers that are running to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
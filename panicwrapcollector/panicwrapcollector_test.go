@@ -0,0 +1,220 @@
+package panicwrapcollector
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestPKI returns the TLS configurations of a collector, and of a
+// parent named host-1.
+func newTestPKI(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	caKey := newKey()
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) tls.Certificate {
+		key := newKey()
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	server = &tls.Config{Certificates: []tls.Certificate{issue(2, "collector", x509.ExtKeyUsageServerAuth)}, ClientCAs: pool}
+	client = &tls.Config{Certificates: []tls.Certificate{issue(3, "host-1", x509.ExtKeyUsageClientAuth)}, RootCAs: pool}
+	return server, client
+}
+
+// serve starts the Server on a port of the loopback interface, and
+// returns its address.
+func serve(t *testing.T, s *Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-served; err != ErrServerClosed {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return l.Addr().String()
+}
+
+// send sends the crashes to the collector over a connection, and returns
+// the IDs it answered with until it closed the connection or stopped
+// answering.
+func send(t *testing.T, addr string, cfg *tls.Config, lines ...string) []string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, line := range lines {
+		conn.Write([]byte(line + "\n"))
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var acks []string
+	s := bufio.NewScanner(conn)
+	for len(acks) < len(lines) && s.Scan() {
+		var a struct{ ID string }
+		if err := json.Unmarshal(s.Bytes(), &a); err != nil {
+			t.Fatal(err)
+		}
+		acks = append(acks, a.ID)
+	}
+	return acks
+}
+
+func TestServer(t *testing.T) {
+	serverTLS, clientTLS := newTestPKI(t)
+	var mu sync.Mutex
+	var reports []*Report
+	s := &Server{
+		TLSConfig: serverTLS,
+		Handler: func(r *Report) error {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, r)
+			return nil
+		},
+	}
+	addr := serve(t, s)
+
+	acks := send(t, addr, clientTLS,
+		`{"id":"1","crash":{"value":"boom","kind":"panic"}}`,
+		`{"id":"2","crash":{"value":"bang"}}`,
+		`{"id":"1","crash":{"value":"boom","kind":"panic"}}`,
+	)
+	if strings.Join(acks, ",") != "1,2,1" {
+		t.Fatalf("should answer every crash: %q", acks)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) != 2 {
+		t.Fatalf("should drop the crash sent again: %d", len(reports))
+	}
+	r := reports[0]
+	if r.ID != "1" || r.Crash.Value != "boom" || r.Peer.Subject.CommonName != "host-1" || r.Addr == nil {
+		t.Fatalf("bad: %#v", r)
+	}
+}
+
+func TestServer_handlerError(t *testing.T) {
+	logs := new(bytes.Buffer)
+	serverTLS, clientTLS := newTestPKI(t)
+	fail := true
+	s := &Server{
+		TLSConfig: serverTLS,
+		Handler: func(r *Report) error {
+			if fail {
+				return errors.New("disk full")
+			}
+			return nil
+		},
+		ErrorLog: log.New(logs, "", 0),
+	}
+	addr := serve(t, s)
+
+	if acks := send(t, addr, clientTLS, `{"id":"1","crash":{}}`); len(acks) != 0 {
+		t.Fatalf("shouldn't take the crash: %q", acks)
+	}
+	if !strings.Contains(logs.String(), "handling crash 1 of 127.0.0.1:") || !strings.Contains(logs.String(), "disk full") {
+		t.Fatalf("bad: %q", logs)
+	}
+
+	fail = false
+	if acks := send(t, addr, clientTLS, `{"id":"1","crash":{}}`); len(acks) != 1 {
+		t.Fatalf("should take the crash sent again: %q", acks)
+	}
+}
+
+func TestServer_noCertificate(t *testing.T) {
+	serverTLS, clientTLS := newTestPKI(t)
+	called := false
+	s := &Server{
+		TLSConfig: serverTLS,
+		Handler: func(*Report) error {
+			called = true
+			return nil
+		},
+		ErrorLog: log.New(new(bytes.Buffer), "", 0),
+	}
+	addr := serve(t, s)
+
+	anonymous := &tls.Config{RootCAs: clientTLS.RootCAs}
+	conn, err := tls.Dial("tcp", addr, anonymous)
+	if err == nil {
+		// TLS 1.3 reports the rejection on the first read.
+		conn.Write([]byte(`{"id":"1","crash":{}}` + "\n"))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil || called {
+		t.Fatalf("should turn the parent away: %v", err)
+	}
+}
+
+func TestServer_remember(t *testing.T) {
+	s := &Server{Remember: 2}
+	s.take("1")
+	s.take("2")
+	s.take("3")
+
+	if s.taken("1") || !s.taken("2") || !s.taken("3") {
+		t.Fatalf("should forget the oldest: %v", s.order)
+	}
+}
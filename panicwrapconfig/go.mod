@@ -0,0 +1,11 @@
+module github.com/mohsenpashna/panicwrap/panicwrapconfig
+
+go 1.23.2
+
+require (
+	github.com/mohsenpashna/panicwrap v0.0.0-00010101000000-000000000000
+	github.com/pelletier/go-toml/v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/mohsenpashna/panicwrap => ../
@@ -0,0 +1,150 @@
+// The panicwrapconfig package reads a panicwrap.WrapConfig from YAML and
+// TOML files as well as from JSON ones. It is a module of its own, so that
+// panicwrap doesn't depend on YAML and TOML parsers.
+package panicwrapconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mohsenpashna/panicwrap"
+)
+
+// LoadConfig reads a WrapConfig from the file at path, which is YAML if it
+// ends with ".yaml" or ".yml", TOML if it ends with ".toml", and JSON
+// otherwise. It takes the same settings as panicwrap.LoadConfig, under
+// the same keys, and reports errors the same way, with the line of the
+// file they are about:
+//
+//	detect_duration: 500ms
+//	restart:
+//	  max_restarts: 5
+//	  backoff: 1s
+//	log:
+//	  path: ${LOG_DIR}/app.log
+//	workers: $WORKERS
+//
+// Environment variables are replaced in strings, and a YAML value that is
+// only a variable, such as $WORKERS above, takes the type of its value.
+// TOML has no such values, so variables there only go in strings.
+func LoadConfig(path string) (*panicwrap.WrapConfig, error) {
+	var toJSON func([]byte) ([]byte, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		toJSON = yamlToJSON
+	case ".toml":
+		toJSON = tomlToJSON
+	default:
+		return panicwrap.LoadConfig(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = toJSON(data)
+	if err != nil {
+		var se *syntaxError
+		if errors.As(err, &se) && se.line > 0 {
+			return nil, fmt.Errorf("%s:%d: %s", path, se.line, se.msg)
+		}
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return panicwrap.ParseConfig(path, data)
+}
+
+// syntaxError is an error about a line of the file, or about the whole
+// file if line is 0.
+type syntaxError struct {
+	line int
+	msg  string
+}
+
+func (e *syntaxError) Error() string {
+	return e.msg
+}
+
+// value is a value of a configuration file, on its way to JSON.
+type value struct {
+	// raw is the JSON of a scalar value.
+	raw string
+
+	// fields are those of an object, in the order of the file, and items
+	// those of a list.
+	fields []field
+	items  []*value
+	list   bool
+}
+
+// field is a key of an object and its value, with the line of the file the
+// key is on.
+type field struct {
+	key   string
+	line  int
+	value *value
+}
+
+// get returns the value of the key, or nil if it isn't set.
+func (v *value) get(key string) *value {
+	for _, f := range v.fields {
+		if f.key == key {
+			return f.value
+		}
+	}
+	return nil
+}
+
+// jsonWriter writes the JSON of a value so that each key is on the same
+// line as in the file, for panicwrap.ParseConfig to report errors on the
+// lines of the file. Keys that come before others in the JSON but after
+// them in the file, such as those of a TOML table that is filled in after
+// the next one, are on the line after those.
+type jsonWriter struct {
+	buf  bytes.Buffer
+	line int
+}
+
+func (w *jsonWriter) write(v *value) {
+	switch {
+	case v.list:
+		w.buf.WriteByte('[')
+		for i, item := range v.items {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.write(item)
+		}
+		w.buf.WriteByte(']')
+	case v.raw != "":
+		w.buf.WriteString(v.raw)
+	default:
+		w.buf.WriteByte('{')
+		for i, f := range v.fields {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			for w.line < f.line {
+				w.buf.WriteByte('\n')
+				w.line++
+			}
+			key, _ := json.Marshal(f.key)
+			w.buf.Write(key)
+			w.buf.WriteByte(':')
+			w.write(f.value)
+		}
+		w.buf.WriteByte('}')
+	}
+}
+
+// toJSON returns the JSON of the value.
+func toJSON(v *value) []byte {
+	w := &jsonWriter{line: 1}
+	w.write(v)
+	return w.buf.Bytes()
+}
@@ -0,0 +1,129 @@
+package panicwrapconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohsenpashna/panicwrap"
+)
+
+func writeConfig(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return path
+}
+
+// checkConfig checks the configuration that the YAML and TOML of the tests
+// describe.
+func checkConfig(t *testing.T, c *panicwrap.WrapConfig) {
+	if c.DetectDuration != 500*time.Millisecond || !c.HidePanic || c.Workers != 3 {
+		t.Fatalf("bad: %#v", c)
+	}
+	if !reflect.DeepEqual(c.Restart, &panicwrap.RestartPolicy{MaxRestarts: 5, Backoff: time.Second, ExitStatuses: []int{2}}) {
+		t.Fatalf("bad: %#v", c.Restart)
+	}
+	if c.Log.Path != `/var/log/"app"/app.log` || c.Log.MaxFiles != 3 {
+		t.Fatalf("bad: %#v", c.Log)
+	}
+	if !reflect.DeepEqual(c.HandlerCommands, []panicwrap.HandlerCommand{{Args: []string{"notify.sh", "--team", "ops"}, Timeout: 5 * time.Second}}) {
+		t.Fatalf("bad: %#v", c.HandlerCommands)
+	}
+	if len(c.IgnorePatterns) != 1 || c.IgnorePatterns[0].String() != "^echo " {
+		t.Fatalf("bad: %#v", c.IgnorePatterns)
+	}
+}
+
+func TestLoadConfig_yaml(t *testing.T) {
+	t.Setenv("LOG_DIR", `/var/log/"app"`)
+	t.Setenv("WORKERS", "3")
+
+	c, err := LoadConfig(writeConfig(t, "app.yaml", `
+# The settings of the app.
+detect_duration: 500ms
+hide_panic: true
+workers: $WORKERS
+restart:
+  max_restarts: 5
+  backoff: 1s
+  exit_statuses: [2]
+log: {path: "${LOG_DIR}/app.log", max_files: 3}
+ignore_patterns:
+  - "^echo "
+handler_commands:
+  - args: [notify.sh, --team, ops]
+    timeout: 5s
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkConfig(t, c)
+}
+
+func TestLoadConfig_toml(t *testing.T) {
+	t.Setenv("LOG_DIR", `/var/log/"app"`)
+
+	c, err := LoadConfig(writeConfig(t, "app.toml", `
+# The settings of the app.
+detect_duration = "500ms"
+hide_panic = true
+workers = 3
+ignore_patterns = ['^echo ']
+log = {path = "${LOG_DIR}/app.log", max_files = 3}
+
+[restart]
+max_restarts = 5
+backoff = "1s"
+exit_statuses = [2]
+
+[[handler_commands]]
+args = ["notify.sh", "--team", "ops"]
+timeout = "5s"
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkConfig(t, c)
+}
+
+func TestLoadConfig_json(t *testing.T) {
+	c, err := LoadConfig(writeConfig(t, "app.json", `{"workers": 3}`))
+	if err != nil || c.Workers != 3 {
+		t.Fatalf("bad: %#v, %v", c, err)
+	}
+}
+
+func TestLoadConfig_errors(t *testing.T) {
+	cases := []struct {
+		name     string
+		file     string
+		data     string
+		expected string
+	}{
+		{"yaml syntax", "app.yaml", "debug: true\nrestart:\n  backoff: [1s\n", "app.yaml:2: did not find expected"},
+		{"yaml unknown", "app.yml", "debug: true\n\nhandler: x\n", `app.yml:3: unknown setting "handler"`},
+		{"yaml type", "app.yaml", "restart:\n  max_restarts: 1\n  backoff: soon\n", `app.yaml:3: invalid backoff: time: invalid duration "soon"`},
+		{"yaml validation", "app.yaml", "handler_limit_window: 1s\nhandler_limit: 1\nhide_panic: true\n", "app.yaml:3: HidePanic can't be combined with HandlerLimit"},
+		{"toml syntax", "app.toml", "debug = true\nworkers = \n", "app.toml:2: "},
+		{"toml duplicate", "app.toml", "debug = true\ndebug = false\n", "app.toml:2: debug is already set"},
+		{"toml type", "app.toml", "debug = true\n\n[restart]\nbackoff = 1\n", "app.toml:4: backoff must be a duration"},
+		{"toml validation", "app.toml", "[restart]\nmax_restarts = 1\n\n[log]\nmax_files = 1\n\n[restart.safe_mode]\nafter = -1\n", "app.toml:1: Restart.SafeMode must not have negative values"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tc.file, tc.data))
+			if err == nil {
+				t.Fatal("should fail")
+			}
+			if msg := filepath.Base(err.Error()); !strings.HasPrefix(msg, tc.expected) {
+				t.Fatalf("bad: %s", err)
+			}
+		})
+	}
+}
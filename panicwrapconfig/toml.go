@@ -0,0 +1,168 @@
+package panicwrapconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// tomlToJSON converts a TOML document to JSON with its keys on the same
+// lines.
+func tomlToJSON(data []byte) ([]byte, error) {
+	t := &tomlDoc{root: new(value)}
+	t.p.Reset(data)
+
+	cur := t.root
+	for t.p.NextExpression() {
+		e := t.p.Expression()
+		var err error
+		switch e.Kind {
+		case unstable.Table:
+			cur, err = t.table(t.root, e.Key(), false)
+		case unstable.ArrayTable:
+			cur, err = t.table(t.root, e.Key(), true)
+		case unstable.KeyValue:
+			err = t.set(cur, e)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := t.p.Error(); err != nil {
+		var pe *unstable.ParserError
+		if errors.As(err, &pe) && len(pe.Highlight) > 0 {
+			return nil, &syntaxError{t.p.Shape(t.p.Range(pe.Highlight)).Start.Line, pe.Message}
+		}
+		return nil, &syntaxError{0, err.Error()}
+	}
+
+	return toJSON(t.root), nil
+}
+
+// tomlDoc is a TOML document being converted.
+type tomlDoc struct {
+	p    unstable.Parser
+	root *value
+}
+
+// line returns the line of the node, which has a range in the document.
+func (t *tomlDoc) line(n *unstable.Node) int {
+	return t.p.Shape(n.Raw).Start.Line
+}
+
+// table returns the table of the key under v, which it creates if it isn't
+// defined yet, or appends to the array of tables of the key if array is
+// set.
+func (t *tomlDoc) table(v *value, key unstable.Iterator, array bool) (*value, error) {
+	for key.Next() {
+		k := key.Node()
+		name, line := string(k.Data), t.line(k)
+		next := v.get(name)
+		last := key.IsLast()
+		switch {
+		case next == nil && last && array:
+			next = &value{list: true}
+			v.fields = append(v.fields, field{name, line, next})
+		case next == nil:
+			next = new(value)
+			v.fields = append(v.fields, field{name, line, next})
+		case next.raw != "" || last && next.list != array:
+			return nil, &syntaxError{line, fmt.Sprintf("%s is already set", name)}
+		}
+
+		if next.list {
+			if last && array {
+				next.items = append(next.items, new(value))
+			}
+			if len(next.items) == 0 {
+				return nil, &syntaxError{line, fmt.Sprintf("%s is not a table", name)}
+			}
+			next = next.items[len(next.items)-1]
+		}
+		v = next
+	}
+
+	return v, nil
+}
+
+// set sets the value of the key-value expression in the table v.
+func (t *tomlDoc) set(v *value, e *unstable.Node) error {
+	// The key may be dotted, with tables before the last part.
+	var parts []*unstable.Node
+	key := e.Key()
+	for key.Next() {
+		parts = append(parts, key.Node())
+	}
+	for _, k := range parts[:len(parts)-1] {
+		next := v.get(string(k.Data))
+		if next == nil {
+			next = new(value)
+			v.fields = append(v.fields, field{string(k.Data), t.line(k), next})
+		} else if next.raw != "" || next.list {
+			return &syntaxError{t.line(k), fmt.Sprintf("%s is not a table", k.Data)}
+		}
+		v = next
+	}
+
+	k := parts[len(parts)-1]
+	if v.get(string(k.Data)) != nil {
+		return &syntaxError{t.line(k), fmt.Sprintf("%s is already set", k.Data)}
+	}
+	val, err := t.value(e.Value(), t.line(k))
+	if err != nil {
+		return err
+	}
+	v.fields = append(v.fields, field{string(k.Data), t.line(k), val})
+	return nil
+}
+
+// value converts a TOML value on the given line.
+func (t *tomlDoc) value(n *unstable.Node, line int) (*value, error) {
+	data := string(n.Data)
+	switch n.Kind {
+	case unstable.String, unstable.LocalDate, unstable.LocalTime, unstable.LocalDateTime, unstable.DateTime:
+		raw, _ := json.Marshal(data)
+		return &value{raw: string(raw)}, nil
+	case unstable.Bool:
+		return &value{raw: data}, nil
+	case unstable.Integer:
+		i, err := strconv.ParseInt(strings.ReplaceAll(data, "_", ""), 0, 64)
+		if err != nil {
+			return nil, &syntaxError{line, fmt.Sprintf("invalid integer %s", data)}
+		}
+		return &value{raw: strconv.FormatInt(i, 10)}, nil
+	case unstable.Float:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(data, "_", ""), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, &syntaxError{line, fmt.Sprintf("unsupported float %s", data)}
+		}
+		return &value{raw: strconv.FormatFloat(f, 'g', -1, 64)}, nil
+	case unstable.Array:
+		v := &value{list: true}
+		items := n.Children()
+		for items.Next() {
+			item, err := t.value(items.Node(), line)
+			if err != nil {
+				return nil, err
+			}
+			v.items = append(v.items, item)
+		}
+		return v, nil
+	case unstable.InlineTable:
+		v := new(value)
+		kvs := n.Children()
+		for kvs.Next() {
+			if err := t.set(v, kvs.Node()); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+
+	return nil, &syntaxError{line, fmt.Sprintf("unsupported value %s", data)}
+}
@@ -0,0 +1,94 @@
+package panicwrapconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envValue matches a value that is only an environment variable.
+var envValue = regexp.MustCompile(`^\$(\w+|\{\w+\})$`)
+
+// yamlToJSON converts a YAML document to JSON with its keys on the same
+// lines.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, yamlError(err)
+	}
+	if len(doc.Content) == 0 {
+		return []byte("{}"), nil
+	}
+
+	v, err := fromYAML(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	return toJSON(v), nil
+}
+
+func fromYAML(n *yaml.Node) (*value, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return fromYAML(n.Alias)
+	case yaml.MappingNode:
+		v := new(value)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+			if k.Kind != yaml.ScalarNode {
+				return nil, &syntaxError{k.Line, "keys must be strings"}
+			}
+			fv, err := fromYAML(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			v.fields = append(v.fields, field{k.Value, k.Line, fv})
+		}
+		return v, nil
+	case yaml.SequenceNode:
+		v := &value{list: true}
+		for _, item := range n.Content {
+			iv, err := fromYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			v.items = append(v.items, iv)
+		}
+		return v, nil
+	case yaml.ScalarNode:
+		// The variable is replaced by panicwrap.ParseConfig, outside of a
+		// string so that it can be a number.
+		if n.Style == 0 && n.ShortTag() == "!!str" && envValue.MatchString(n.Value) {
+			return &value{raw: n.Value}, nil
+		}
+		var x interface{}
+		if err := n.Decode(&x); err != nil {
+			return nil, &syntaxError{n.Line, err.Error()}
+		}
+		raw, err := json.Marshal(x)
+		if err != nil {
+			return nil, &syntaxError{n.Line, fmt.Sprintf("unsupported value %q", n.Value)}
+		}
+		return &value{raw: string(raw)}, nil
+	}
+
+	return nil, &syntaxError{n.Line, "unsupported YAML node"}
+}
+
+// yamlError turns the "yaml: line N: message" of the parser into an error
+// about the line.
+func yamlError(err error) error {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	if rest, ok := strings.CutPrefix(msg, "line "); ok {
+		if n, m, ok := strings.Cut(rest, ": "); ok {
+			if line, err := strconv.Atoi(n); err == nil {
+				return &syntaxError{line, m}
+			}
+		}
+	}
+	return &syntaxError{0, msg}
+}
@@ -0,0 +1,98 @@
+// The panicwrapgrpc package recovers the panics of gRPC handlers in a
+// wrapped child and reports them to the parent, so that they end up in the
+// same places as the panics that crash the child, in the same form. It is
+// a module of its own, so that panicwrap doesn't depend on gRPC.
+package panicwrapgrpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"strings"
+
+	"github.com/mohsenpashna/panicwrap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// credentialKeys are the metadata keys that aren't reported, since they
+// carry credentials.
+var credentialKeys = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-api-key":           true,
+}
+
+// UnaryServerInterceptor returns an interceptor that recovers from the
+// panics of unary handlers: the call fails with codes.Internal, and the
+// panic is reported to the parent with panicwrap.ReportRecovered, along
+// with the method, the peer and the metadata of the call, without its
+// credentials and binary values. If there is no control channel to the
+// parent, it is logged instead.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = report(ctx, info.FullMethod, v, debug.Stack())
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming
+// handlers.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = report(ss.Context(), info.FullMethod, v, debug.Stack())
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// report reports the panic of the call, and returns the error the call
+// fails with.
+func report(ctx context.Context, method string, v interface{}, stack []byte) error {
+	req := &panicwrap.RequestInfo{Method: method, Metadata: callMetadata(ctx)}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		req.RemoteAddr = p.Addr.String()
+	}
+
+	if err := panicwrap.ReportRecovered(v, stack, req); errors.Is(err, panicwrap.ErrNoControl) {
+		log.Printf("grpc: panic serving %s: %v\n%s", method, v, stack)
+	}
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// callMetadata returns the incoming metadata of the call that is reported,
+// with the values of a key joined by commas.
+func callMetadata(ctx context.Context) map[string]string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	result := make(map[string]string, len(md))
+	for key, values := range md {
+		if credentialKeys[key] || strings.HasSuffix(key, "-bin") {
+			continue
+		}
+		result[key] = strings.Join(values, ",")
+	}
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
@@ -0,0 +1,86 @@
+package panicwrapgrpc
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+	_, err := UnaryServerInterceptor()(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("bad: %v", err)
+	}
+	// Without a parent, it is logged.
+	if out := logs.String(); !strings.Contains(out, "grpc: panic serving /pkg.Service/Method: boom\n") || !strings.Contains(out, "goroutine ") {
+		t.Fatalf("bad: %q", out)
+	}
+}
+
+func TestUnaryServerInterceptor_noPanic(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+	resp, err := UnaryServerInterceptor()(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	if resp != "ok" || err != nil {
+		t.Fatalf("bad: %v %v", resp, err)
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+}
+
+func (testStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	log.SetOutput(new(bytes.Buffer))
+	defer log.SetOutput(os.Stderr)
+
+	info := &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream"}
+	err := StreamServerInterceptor()(nil, testStream{}, info, func(interface{}, grpc.ServerStream) error {
+		panic("boom")
+	})
+
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestCallMetadata(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-request-id", "7",
+		"tenant", "a",
+		"tenant", "b",
+		"authorization", "Bearer secret",
+		"trace-bin", "\x00",
+	))
+
+	md := callMetadata(ctx)
+	if len(md) != 2 || md["x-request-id"] != "7" || md["tenant"] != "a,b" {
+		t.Fatalf("bad: %#v", md)
+	}
+
+	if md := callMetadata(context.Background()); md != nil {
+		t.Fatalf("bad: %#v", md)
+	}
+}
@@ -0,0 +1,84 @@
+// The panicwraphttp package recovers the panics of HTTP handlers in a
+// wrapped child and reports them to the parent, so that they end up in the
+// same places as the panics that crash the child, in the same form.
+package panicwraphttp
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/mohsenpashna/panicwrap"
+)
+
+// Handler returns a handler that serves with next, and recovers from its
+// panics: the client gets a 500 Internal Server Error if nothing was
+// written to it yet, and the panic is reported to the parent with
+// panicwrap.ReportRecovered, along with the request. If there is no
+// control channel to the parent, it is logged the way net/http logs the
+// panics of handlers instead.
+//
+// A panic with http.ErrAbortHandler is passed on, since it is how a
+// handler aborts a response on purpose.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			stack := debug.Stack()
+			if !rw.written {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+
+			req := &panicwrap.RequestInfo{Method: r.Method, URL: r.URL.String(), RemoteAddr: r.RemoteAddr}
+			if err := panicwrap.ReportRecovered(v, stack, req); errors.Is(err, panicwrap.ErrNoControl) {
+				log.Printf("http: panic serving %s: %v\n%s", r.RemoteAddr, v, stack)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// responseWriter tracks whether the response was started.
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush and Hijack keep the wrapped writer usable by handlers that look
+// for http.Flusher or http.Hijacker.
+func (w *responseWriter) Flush() {
+	w.written = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.written = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
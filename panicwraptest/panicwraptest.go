@@ -0,0 +1,183 @@
+// The panicwraptest package provides helpers for testing programs that use
+// panicwrap. Since panicwrap works by re-executing the running binary, a
+// crash can only be observed from another process. Run takes care of that
+// by re-executing the test binary, so that tests don't have to maintain
+// helper processes of their own.
+package panicwraptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mohsenpashna/panicwrap"
+)
+
+// The environment variables through which Run tells the test binary it
+// re-executed to act as the wrapping parent.
+const (
+	envHelper = "PANICWRAPTEST_HELPER"
+	envResult = "PANICWRAPTEST_RESULT"
+)
+
+// Result is what happened when running a function with Run.
+type Result struct {
+	// ExitStatus is the exit status that Wrap returned in the parent.
+	ExitStatus int
+
+	// Panics are the panics the parent handled, in order.
+	Panics []*panicwrap.PanicInfo
+
+	// Stdout and Stderr are the output of the parent, which includes the
+	// output of the child.
+	Stdout string
+	Stderr string
+}
+
+// Run runs fn in a child wrapped with the given configuration, and returns
+// what happened. The handlers of the configuration are called as usual,
+// in the parent process.
+//
+// This works by re-executing the test binary to run only the calling test,
+// which calls Run again. That time, Run wraps itself with the
+// configuration and calls fn in the child, and never returns. Anything the
+// test does before calling Run is done in every process, so Run should be
+// called first.
+func Run(t testing.TB, config *panicwrap.WrapConfig, fn func()) *Result {
+	t.Helper()
+
+	if os.Getenv(envHelper) == t.Name() {
+		runHelper(config, fn)
+	}
+
+	resultPath := filepath.Join(t.TempDir(), "result.json")
+	cmd := exec.Command(os.Args[0], "-test.run="+runPattern(t.Name()), "-test.count=1")
+	cmd.Env = append(os.Environ(),
+		envHelper+"="+t.Name(),
+		envResult+"="+resultPath)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			t.Fatalf("panicwraptest: running the test binary: %s", err)
+		}
+	}
+
+	data, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatalf("panicwraptest: the parent didn't finish: %s\nstderr:\n%s", err, stderr)
+	}
+
+	r := new(Result)
+	if err := json.Unmarshal(data, r); err != nil {
+		t.Fatalf("panicwraptest: reading the result: %s", err)
+	}
+	r.Stdout, r.Stderr = stdout.String(), stderr.String()
+	return r
+}
+
+// runHelper is Run in the re-executed test binary. It never returns.
+func runHelper(config *panicwrap.WrapConfig, fn func()) {
+	var r Result
+	infoHandler := config.InfoHandler
+	config.InfoHandler = func(info *panicwrap.PanicInfo) {
+		r.Panics = append(r.Panics, info)
+		if infoHandler != nil {
+			infoHandler(info)
+		}
+	}
+
+	done, exitStatus, err := panicwrap.Wrap(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "panicwraptest: wrap error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if !done {
+		fn()
+		os.Exit(0)
+	}
+
+	r.ExitStatus = exitStatus
+	data, err := json.Marshal(&r)
+	if err == nil {
+		err = os.WriteFile(os.Getenv(envResult), data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "panicwraptest: writing the result: %s\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(exitStatus)
+}
+
+// runPattern returns the -test.run pattern that matches exactly the test
+// with the given name, which may be a subtest.
+func runPattern(name string) string {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(p) + "$"
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// Panic returns the first panic that was handled, or nil if there was
+// none.
+func (r *Result) Panic() *panicwrap.PanicInfo {
+	if len(r.Panics) == 0 {
+		return nil
+	}
+
+	return r.Panics[0]
+}
+
+// AssertPanicked fails the test unless a panic with the given value, such
+// as "boom" for panic("boom"), was handled.
+func (r *Result) AssertPanicked(t testing.TB, value string) {
+	t.Helper()
+
+	p := r.Panic()
+	if p == nil {
+		t.Fatalf("expected a panic with value %q, got none\nstderr:\n%s", value, r.Stderr)
+	}
+	if p.Value != value {
+		t.Fatalf("expected a panic with value %q, got %q", value, p.Value)
+	}
+}
+
+// AssertNoPanic fails the test if a panic was handled.
+func (r *Result) AssertNoPanic(t testing.TB) {
+	t.Helper()
+
+	if p := r.Panic(); p != nil {
+		t.Fatalf("expected no panic, got:\n%s", p.Text)
+	}
+}
+
+// AssertFrame fails the test unless the goroutine that panicked has a
+// frame in the given function, such as "main.handleRequest".
+func (r *Result) AssertFrame(t testing.TB, function string) {
+	t.Helper()
+
+	p := r.Panic()
+	if p == nil {
+		t.Fatalf("expected a panic in %s, got none", function)
+	}
+	if len(p.Goroutines) > 0 {
+		for _, f := range p.Goroutines[0].Frames {
+			if f.Function == function {
+				return
+			}
+		}
+	}
+
+	t.Fatalf("expected a panic in %s, got:\n%s", function, p.Text)
+}
@@ -0,0 +1,70 @@
+package panicwraptest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mohsenpashna/panicwrap"
+)
+
+func TestRun_panic(t *testing.T) {
+	var handled bool
+	r := Run(t, &panicwrap.WrapConfig{
+		Handler: func(string) { handled = true },
+	}, func() {
+		explode()
+	})
+
+	// The handler ran in the parent, not in this process.
+	if handled {
+		t.Fatal("shouldn't call the handler in this process")
+	}
+
+	r.AssertPanicked(t, "boom")
+	r.AssertFrame(t, "github.com/mohsenpashna/panicwrap/panicwraptest.explode")
+	if r.ExitStatus == 0 {
+		t.Fatal("should exit with a non-zero status")
+	}
+	if !strings.Contains(r.Stderr, "panic: boom") {
+		t.Fatalf("bad: %q", r.Stderr)
+	}
+}
+
+func TestRun_noPanic(t *testing.T) {
+	r := Run(t, &panicwrap.WrapConfig{
+		Handler: func(string) {},
+	}, func() {
+		fmt.Fprint(os.Stdout, "all good")
+	})
+
+	r.AssertNoPanic(t)
+	if r.ExitStatus != 0 || !strings.Contains(r.Stdout, "all good") {
+		t.Fatalf("bad: %#v", r)
+	}
+}
+
+func TestRun_subtest(t *testing.T) {
+	t.Run("with space", func(t *testing.T) {
+		r := Run(t, &panicwrap.WrapConfig{
+			Handler: func(string) {},
+		}, func() {
+			panic("sub")
+		})
+
+		r.AssertPanicked(t, "sub")
+	})
+}
+
+func TestRunPattern(t *testing.T) {
+	got := runPattern("TestFoo/with_space(1)")
+	if got != `^TestFoo$/^with_space\(1\)$` {
+		t.Fatalf("bad: %s", got)
+	}
+}
+
+//go:noinline
+func explode() {
+	panic("boom")
+}
@@ -0,0 +1,78 @@
+package panicwrap
+
+import (
+	"strings"
+)
+
+// pathTrimmer normalizes the file paths of stack frames to the canonical
+// form the Go toolchain produces when building with -trimpath: standard
+// library files relative to GOROOT/src, dependencies as
+// "module@version/file.go", and vendored packages by their import path.
+// This keeps fingerprints stable across machines and checkouts.
+type pathTrimmer struct {
+	prefixes []string
+
+	// builtin enables the -trimpath style normalization.
+	builtin bool
+	goroot  string
+}
+
+// newPathTrimmer returns the pathTrimmer configured by the WrapConfig for
+// the given panic text, or nil if no trimming is configured. GOROOT is
+// discovered from the runtime frames in the text, since the GOROOT the
+// binary was built with is usually not around where it runs.
+func newPathTrimmer(c *WrapConfig, text string) *pathTrimmer {
+	if !c.TrimPaths && len(c.TrimPathPrefixes) == 0 {
+		return nil
+	}
+
+	t := &pathTrimmer{
+		prefixes: c.TrimPathPrefixes,
+		builtin:  c.TrimPaths,
+	}
+	if t.builtin {
+		for _, line := range strings.Split(text, "\n") {
+			idx := strings.Index(line, "/src/runtime/")
+			if strings.HasPrefix(line, "\t") && idx >= 0 {
+				t.goroot = strings.TrimSpace(line[:idx+len("/src/")])
+				break
+			}
+		}
+	}
+
+	return t
+}
+
+// trim normalizes the given file path. It is safe to call on a nil
+// pathTrimmer, in which case the path is returned as-is.
+func (t *pathTrimmer) trim(file string) string {
+	if t == nil {
+		return file
+	}
+
+	for _, p := range t.prefixes {
+		if strings.HasPrefix(file, p) {
+			return strings.TrimPrefix(file[len(p):], "/")
+		}
+	}
+
+	if !t.builtin {
+		return file
+	}
+
+	// GOROOT comes first since toolchains downloaded by the go command
+	// live in the module cache.
+	if t.goroot != "" && strings.HasPrefix(file, t.goroot) {
+		return file[len(t.goroot):]
+	}
+
+	if idx := strings.LastIndex(file, "/vendor/"); idx >= 0 {
+		return file[idx+len("/vendor/"):]
+	}
+
+	if idx := strings.Index(file, "/pkg/mod/"); idx >= 0 {
+		return file[idx+len("/pkg/mod/"):]
+	}
+
+	return file
+}
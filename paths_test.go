@@ -0,0 +1,38 @@
+package panicwrap
+
+import (
+	"testing"
+)
+
+func TestPathTrimmer(t *testing.T) {
+	text := "goroutine 1 [running]:\nruntime.gopanic()\n\t/usr/local/go/src/runtime/panic.go:770 +0x132\n"
+	trimmer := newPathTrimmer(&WrapConfig{
+		TrimPaths:        true,
+		TrimPathPrefixes: []string{"/builds/ci"},
+	}, text)
+
+	cases := map[string]string{
+		"/usr/local/go/src/runtime/panic.go":                     "runtime/panic.go",
+		"/home/user/go/pkg/mod/github.com/foo/bar@v1.2.3/baz.go": "github.com/foo/bar@v1.2.3/baz.go",
+		"/builds/ci/vendor/github.com/foo/bar/baz.go":            "vendor/github.com/foo/bar/baz.go",
+		"/home/user/app/vendor/github.com/foo/bar/baz.go":        "github.com/foo/bar/baz.go",
+		"/builds/ci/main.go":                                     "main.go",
+		"example.com/app/main.go":                                "example.com/app/main.go",
+	}
+	for input, expected := range cases {
+		if actual := trimmer.trim(input); actual != expected {
+			t.Fatalf("%s: %s != %s", input, actual, expected)
+		}
+	}
+}
+
+func TestPathTrimmer_disabled(t *testing.T) {
+	trimmer := newPathTrimmer(&WrapConfig{}, "")
+	if trimmer != nil {
+		t.Fatalf("bad: %#v", trimmer)
+	}
+
+	if actual := trimmer.trim("/usr/local/go/src/runtime/panic.go"); actual != "/usr/local/go/src/runtime/panic.go" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
@@ -0,0 +1,28 @@
+package panicwrap
+
+import "errors"
+
+// Pause freezes the running child without killing it, so that it can be
+// inspected, for example with a debugger or by reading its memory. Only
+// the child itself is frozen, not the processes it started. Detection and
+// supervision go on as usual, and a paused child must be resumed before
+// it can shut down. This sends SIGSTOP on Unix and suspends the threads
+// of the child on Windows.
+func Pause() error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	return ch.with(pauseProcess)
+}
+
+// Resume lets a child that was frozen by Pause run again.
+func Resume() error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	return ch.with(resumeProcess)
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package panicwrap
+
+import "errors"
+
+func pauseProcess(Process) error {
+	return errors.New("panicwrap: Pause isn't supported on this platform")
+}
+
+func resumeProcess(Process) error {
+	return errors.New("panicwrap: Resume isn't supported on this platform")
+}
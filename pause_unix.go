@@ -0,0 +1,13 @@
+//go:build unix
+
+package panicwrap
+
+import "syscall"
+
+func pauseProcess(p Process) error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+func resumeProcess(p Process) error {
+	return p.Signal(syscall.SIGCONT)
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestPause_notWrapping(t *testing.T) {
+	if err := Pause(); err == nil {
+		t.Fatal("should error")
+	}
+	if err := Resume(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestPause(t *testing.T) {
+	e := &fakeExecutor{}
+	ch := new(child)
+	ch.set(&fakeProcess{e: e})
+	activeChild.Store(ch)
+	defer activeChild.Store(nil)
+
+	if err := Pause(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := Resume(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(e.signals, []os.Signal{syscall.SIGSTOP, syscall.SIGCONT}) {
+		t.Fatalf("bad: %#v", e.signals)
+	}
+	if ch.stopping() {
+		t.Fatal("should still restart the child")
+	}
+}
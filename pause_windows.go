@@ -0,0 +1,36 @@
+package panicwrap
+
+import "syscall"
+
+var (
+	ntdll                = syscall.NewLazyDLL("ntdll.dll")
+	procNtSuspendProcess = ntdll.NewProc("NtSuspendProcess")
+	procNtResumeProcess  = ntdll.NewProc("NtResumeProcess")
+)
+
+// processSuspendResume is the PROCESS_SUSPEND_RESUME access right.
+const processSuspendResume = 0x0800
+
+func pauseProcess(p Process) error {
+	return callProcess(procNtSuspendProcess, p.Pid())
+}
+
+func resumeProcess(p Process) error {
+	return callProcess(procNtResumeProcess, p.Pid())
+}
+
+// callProcess calls the given native function, which returns an NTSTATUS,
+// with a handle to the process.
+func callProcess(proc *syscall.LazyProc, pid int) error {
+	h, err := syscall.OpenProcess(processSuspendResume, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+
+	if status, _, _ := proc.Call(uintptr(h)); status != 0 {
+		return syscall.Errno(status)
+	}
+
+	return nil
+}
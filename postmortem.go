@@ -0,0 +1,67 @@
+package panicwrap
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostMortem is the outcome of the WrapConfig.PostMortem command.
+type PostMortem struct {
+	// Args is the command that was run, after expanding the
+	// placeholders.
+	Args []string `json:"args,omitempty"`
+
+	// Output is the combined stdout and stderr of the command.
+	Output string `json:"output"`
+
+	// Err describes why the command failed, such as its exit status or
+	// that it timed out. It is empty if the command succeeded.
+	Err string `json:"err"`
+}
+
+// runPostMortem runs the configured post-mortem command for the given
+// crash. It returns nil if there is no command to run, including when the
+// command needs a core file and there is none.
+func runPostMortem(c *WrapConfig, info *PanicInfo) *PostMortem {
+	if len(c.PostMortem) == 0 {
+		return nil
+	}
+
+	var core string
+	if info.Core != nil {
+		core = info.Core.Path
+	}
+
+	r := strings.NewReplacer(
+		"{exe}", info.Executable,
+		"{core}", core,
+		"{pid}", strconv.Itoa(info.PID),
+	)
+	args := make([]string, len(c.PostMortem))
+	for i, arg := range c.PostMortem {
+		if core == "" && strings.Contains(arg, "{core}") {
+			return nil
+		}
+		args[i] = r.Replace(arg)
+	}
+
+	timeout := c.PostMortemTimeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	pm := &PostMortem{Args: args, Output: string(out)}
+	if ctx.Err() != nil {
+		pm.Err = "timed out after " + timeout.String()
+	} else if err != nil {
+		pm.Err = err.Error()
+	}
+
+	return pm
+}
@@ -0,0 +1,67 @@
+package panicwrap
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRunPostMortem(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+
+	info := &PanicInfo{
+		Executable: "/usr/bin/foo",
+		PID:        42,
+		Core:       &CoreInfo{Path: "/tmp/core.42"},
+	}
+	c := &WrapConfig{
+		PostMortem: []string{"sh", "-c", `echo "$0 $1 $2"`, "{exe}", "{core}", "{pid}"},
+	}
+
+	pm := runPostMortem(c, info)
+	if pm == nil {
+		t.Fatal("should run")
+	}
+	if pm.Output != "/usr/bin/foo /tmp/core.42 42\n" || pm.Err != "" {
+		t.Fatalf("bad: %#v", pm)
+	}
+	if pm.Args[3] != "/usr/bin/foo" {
+		t.Fatalf("bad: %#v", pm.Args)
+	}
+
+	info.Core = nil
+	if pm := runPostMortem(c, info); pm != nil {
+		t.Fatalf("shouldn't run without a core: %#v", pm)
+	}
+}
+
+func TestRunPostMortem_failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+
+	c := &WrapConfig{
+		PostMortem: []string{"sh", "-c", "echo oops; exit 3"},
+	}
+	pm := runPostMortem(c, new(PanicInfo))
+	if pm.Output != "oops\n" || pm.Err != "exit status 3" {
+		t.Fatalf("bad: %#v", pm)
+	}
+
+	c = &WrapConfig{
+		PostMortem:        []string{"sleep", "5"},
+		PostMortemTimeout: 100 * time.Millisecond,
+	}
+	pm = runPostMortem(c, new(PanicInfo))
+	if pm.Err != "timed out after 100ms" {
+		t.Fatalf("bad: %#v", pm)
+	}
+}
+
+func TestRunPostMortem_unset(t *testing.T) {
+	if pm := runPostMortem(new(WrapConfig), new(PanicInfo)); pm != nil {
+		t.Fatalf("bad: %#v", pm)
+	}
+}
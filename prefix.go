@@ -0,0 +1,104 @@
+package panicwrap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The values of WrapConfig.Timestamps.
+const (
+	// TimestampRFC3339 prefixes lines with the time they arrived, in
+	// RFC 3339 format with milliseconds.
+	TimestampRFC3339 = "rfc3339"
+
+	// TimestampRelative prefixes lines with the seconds elapsed since the
+	// parent started wrapping, which spans restarts of the child.
+	TimestampRelative = "relative"
+)
+
+// timestampPrefix returns the function that prefixes lines for the given
+// WrapConfig.Timestamps value, or nil if it isn't valid.
+func timestampPrefix(format string, start time.Time) func() string {
+	switch format {
+	case TimestampRFC3339:
+		return func() string {
+			return time.Now().Format("2006-01-02T15:04:05.000Z07:00") + " "
+		}
+	case TimestampRelative:
+		return func() string {
+			return fmt.Sprintf("[%11.6f] ", time.Since(start).Seconds())
+		}
+	default:
+		return nil
+	}
+}
+
+// The labels of WrapConfig.StreamLabels.
+const (
+	stdoutLabel = "out | "
+	stderrLabel = "err | "
+)
+
+// linePrefixes returns the functions that prefix the lines of the stdout
+// and the stderr of the child, given the timestamp function, which may be
+// nil, and whether to label the streams. Both are nil if lines aren't
+// prefixed at all.
+func linePrefixes(timestamp func() string, labels bool) (stdout, stderr func() string) {
+	if !labels {
+		return timestamp, timestamp
+	}
+
+	label := func(l string) func() string {
+		if timestamp == nil {
+			return func() string { return l }
+		}
+		return func() string { return timestamp() + l }
+	}
+
+	return label(stdoutLabel), label(stderrLabel)
+}
+
+// prefixWriter writes a prefix at the start of every line written through
+// it. Lines may span several writes.
+type prefixWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	prefix  func() string
+	midLine bool
+}
+
+func newPrefixWriter(w io.Writer, prefix func() string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The prefixed data is written at once, so that it isn't split up any
+	// further than it was.
+	var buf bytes.Buffer
+	prefix := w.prefix()
+	for rest := p; len(rest) > 0; {
+		if !w.midLine {
+			buf.WriteString(prefix)
+		}
+
+		line := rest
+		if idx := bytes.IndexByte(rest, '\n'); idx >= 0 {
+			line = rest[:idx+1]
+		}
+		buf.Write(line)
+		rest = rest[len(line):]
+		w.midLine = line[len(line)-1] != '\n'
+	}
+
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,76 @@
+package panicwrap
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := newPrefixWriter(buf, func() string { return "> " })
+
+	for _, s := range []string{"one\ntw", "o\n", "\nthree\nfour"} {
+		if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("bad: %d, %s", n, err)
+		}
+	}
+
+	expected := "> one\n> two\n> \n> three\n> four"
+	if buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+func TestTimestampPrefix(t *testing.T) {
+	start := time.Now().Add(-1500 * time.Millisecond)
+
+	cases := map[string]string{
+		TimestampRFC3339:  `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}(Z|[+-]\d\d:\d\d) $`,
+		TimestampRelative: `^\[ +1\.5\d{5}\] $`,
+	}
+	for format, re := range cases {
+		prefix := timestampPrefix(format, start)
+		if got := prefix(); !regexp.MustCompile(re).MatchString(got) {
+			t.Errorf("%s: bad: %q", format, got)
+		}
+	}
+
+	if timestampPrefix("unix", start) != nil {
+		t.Fatal("should reject unknown formats")
+	}
+}
+
+func TestWrap_invalidTimestamps(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:    func(string) {},
+		Timestamps: "unix",
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestLinePrefixes(t *testing.T) {
+	stdout, stderr := linePrefixes(nil, false)
+	if stdout != nil || stderr != nil {
+		t.Fatal("shouldn't prefix")
+	}
+
+	stdout, stderr = linePrefixes(nil, true)
+	if stdout() != "out | " || stderr() != "err | " {
+		t.Fatalf("bad: %q, %q", stdout(), stderr())
+	}
+
+	timestamp := func() string { return "now " }
+	stdout, stderr = linePrefixes(timestamp, false)
+	if stdout() != "now " || stderr() != "now " {
+		t.Fatalf("bad: %q, %q", stdout(), stderr())
+	}
+
+	stdout, stderr = linePrefixes(timestamp, true)
+	if stdout() != "now out | " || stderr() != "now err | " {
+		t.Fatalf("bad: %q, %q", stdout(), stderr())
+	}
+}
@@ -0,0 +1,43 @@
+package panicwrap
+
+// Priority lowers the CPU and IO priority of the child, so that it can't
+// starve the host. It is only used if WrapConfig.Priority is set.
+type Priority struct {
+	// Nice is added to the niceness of the parent for the child, like
+	// with nice(1): 10 makes the child yield the CPU to most processes.
+	// Negative values raise the priority, which requires privileges. On
+	// Linux, the child starts with it. Elsewhere, it is set right after
+	// the child started.
+	Nice int
+
+	// The IO scheduling class and level of the child, like with
+	// ionice(1). The level goes from 0, the highest, to 7 and only
+	// applies to IOClassRealtime and IOClassBestEffort. This is only
+	// supported on Linux.
+	IOClass IOClass
+	IOLevel int
+}
+
+// IOClass is an IO scheduling class of Linux. See Priority.IOClass.
+type IOClass int
+
+const (
+	// IOClassNone leaves the IO priority of the child alone.
+	IOClassNone IOClass = iota
+
+	// IOClassRealtime gets access to the disk first. It requires
+	// privileges.
+	IOClassRealtime
+
+	// IOClassBestEffort is the class processes have by default.
+	IOClassBestEffort
+
+	// IOClassIdle only gets access to the disk when no other process
+	// needs it.
+	IOClassIdle
+)
+
+// clampNice limits a niceness to the range the kernel accepts.
+func clampNice(nice int) int {
+	return min(max(nice, -20), 19)
+}
@@ -0,0 +1,147 @@
+package panicwrap
+
+import (
+	"os"
+	"time"
+)
+
+// ProbeConfig has the marker files the parent keeps for the liveness and
+// readiness probes of a container, such as the exec probes of Kubernetes,
+// so that they reflect the health of the child as the parent sees it
+// without a sidecar:
+//
+//	livenessProbe:
+//	  exec:
+//	    command: ["sh", "-c", "test $(($(date +%s) - $(stat -c %Y /tmp/live))) -lt 30"]
+//	readinessProbe:
+//	  exec:
+//	    command: ["test", "-e", "/tmp/ready"]
+//
+// With several Workers, the child is healthy if all of them are.
+type ProbeConfig struct {
+	// LivenessFile, if set, is touched every Interval while the child is
+	// alive, and removed as soon as it crashes, exits or hangs, until it
+	// is running again.
+	LivenessFile string
+
+	// ReadinessFile, if set, exists while the child is alive and ready:
+	// with WrapConfig.Control, once it called Ready, and otherwise once it
+	// started.
+	ReadinessFile string
+
+	// Interval is how often the files are brought up to date. Defaults
+	// to 5 seconds.
+	Interval time.Duration
+
+	// If HeartbeatTimeout is set, a child that called Heartbeat before but
+	// hasn't for this long is hung, and so isn't alive. This requires
+	// WrapConfig.Control.
+	HeartbeatTimeout time.Duration
+}
+
+// prober keeps the marker files of a ProbeConfig.
+type prober struct {
+	c    *WrapConfig
+	p    *ProbeConfig
+	ch   *child
+	kick chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+// startProber starts keeping the marker files up to date for the child
+// until stop is called.
+func startProber(c *WrapConfig, ch *child) *prober {
+	pr := &prober{c: c, p: c.Probes, ch: ch, kick: make(chan struct{}, 1), quit: make(chan struct{}), done: make(chan struct{})}
+	go pr.run()
+	return pr
+}
+
+func (pr *prober) run() {
+	defer close(pr.done)
+	interval := pr.p.Interval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		alive, ready := pr.health()
+		pr.mark(pr.p.LivenessFile, alive, true)
+		pr.mark(pr.p.ReadinessFile, ready, false)
+
+		select {
+		case <-pr.c.Clock.After(interval):
+		case <-pr.kick:
+		case <-pr.quit:
+			pr.mark(pr.p.LivenessFile, false, false)
+			pr.mark(pr.p.ReadinessFile, false, false)
+			return
+		}
+	}
+}
+
+// health returns whether every worker is alive, and whether every worker
+// is ready.
+func (pr *prober) health() (alive, ready bool) {
+	alive, ready = true, true
+	now := pr.c.Clock.Now()
+	pr.ch.each(func(w *child) {
+		if w.with(func(Process) error { return nil }) != nil {
+			alive, ready = false, false
+			return
+		}
+
+		p, err := w.getControl()
+		if err != nil {
+			return
+		}
+		hb := p.lastHeartbeat()
+		if pr.p.HeartbeatTimeout > 0 && !hb.IsZero() && now.Sub(hb) > pr.p.HeartbeatTimeout {
+			alive, ready = false, false
+		}
+		if !p.isReady() {
+			ready = false
+		}
+	})
+
+	return alive, ready
+}
+
+// mark creates or removes the file. A file that exists is only touched if
+// touch is set, and is otherwise left as it is.
+func (pr *prober) mark(path string, exists, touch bool) {
+	if path == "" {
+		return
+	}
+	if !exists {
+		os.Remove(path)
+		return
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if touch {
+			now := time.Now()
+			os.Chtimes(path, now, now)
+		}
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		debugf(pr.c, "creating the probe file %s: %s", path, err)
+		return
+	}
+	f.Close()
+}
+
+// update brings the files up to date now, such as right after a crash.
+func (pr *prober) update() {
+	select {
+	case pr.kick <- struct{}{}:
+	default:
+	}
+}
+
+// stop removes the files and stops keeping them.
+func (pr *prober) stop() {
+	close(pr.quit)
+	<-pr.done
+}
@@ -0,0 +1,75 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestProber(t *testing.T) {
+	dir := t.TempDir()
+	live, ready := filepath.Join(dir, "live"), filepath.Join(dir, "ready")
+	clock := newFakeClock()
+	c := &WrapConfig{
+		Clock:  clock,
+		Probes: &ProbeConfig{LivenessFile: live, ReadinessFile: ready, HeartbeatTimeout: time.Minute},
+	}
+	ch := new(child)
+	ch.set(&fakeProcess{e: new(fakeExecutor)})
+	control := &parentControl{c: c}
+	ch.setControl(control)
+
+	pr := startProber(c, ch)
+	<-clock.waiting
+	if !exists(live) || exists(ready) {
+		t.Fatal("should be alive but not ready")
+	}
+
+	control.mu.Lock()
+	control.readied = true
+	control.heartbeat = clock.Now()
+	control.mu.Unlock()
+	clock.Advance(5 * time.Second)
+	<-clock.waiting
+	if !exists(live) || !exists(ready) {
+		t.Fatal("should be alive and ready")
+	}
+
+	// A child that stopped calling Heartbeat is hung.
+	clock.Advance(2 * time.Minute)
+	<-clock.waiting
+	if exists(live) || exists(ready) {
+		t.Fatal("should be hung")
+	}
+
+	control.mu.Lock()
+	control.heartbeat = clock.Now()
+	control.mu.Unlock()
+	pr.update()
+	<-clock.waiting
+	if !exists(live) || !exists(ready) {
+		t.Fatal("should be alive and ready again")
+	}
+
+	// A child that exited is neither alive nor ready.
+	ch.set(nil)
+	pr.update()
+	<-clock.waiting
+	if exists(live) || exists(ready) {
+		t.Fatal("should be down")
+	}
+
+	ch.set(&fakeProcess{e: new(fakeExecutor)})
+	pr.update()
+	<-clock.waiting
+	pr.stop()
+	if exists(live) || exists(ready) {
+		t.Fatal("should remove the files")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package panicwrap
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setCredential(*exec.Cmd, *Credential) error {
+	return errors.New("panicwrap: Credential isn't supported on this platform")
+}
+
+func setChroot(*exec.Cmd, string) error {
+	return errors.New("panicwrap: Chroot isn't supported on this platform")
+}
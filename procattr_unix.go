@@ -0,0 +1,36 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setCredential makes the command run as the given user and groups.
+func setCredential(cmd *exec.Cmd, c *Credential) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    c.UID,
+		Gid:    c.GID,
+		Groups: c.Groups,
+	}
+
+	return nil
+}
+
+// setChroot makes the command run with the given directory as its root.
+func setChroot(cmd *exec.Cmd, dir string) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Chroot = dir
+
+	// Otherwise the child starts out in the working directory of the
+	// parent, outside of the new root.
+	cmd.Dir = "/"
+
+	return nil
+}
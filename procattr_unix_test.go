@@ -0,0 +1,109 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"bytes"
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestWrap_credential(t *testing.T) {
+	e := &fakeExecutor{}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:    func(string) {},
+		Credential: &Credential{UID: 1000, GID: 100, Groups: []uint32{27}},
+		Executor:   e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &syscall.Credential{Uid: 1000, Gid: 100, Groups: []uint32{27}}
+	if e.cmd.SysProcAttr == nil || !reflect.DeepEqual(e.cmd.SysProcAttr.Credential, expected) {
+		t.Fatalf("bad: %#v", e.cmd.SysProcAttr)
+	}
+}
+
+func TestPanicWrap_chroot(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root")
+	}
+
+	// The binary must be at the same path inside the chroot.
+	root := t.TempDir()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, filepath.Dir(exe)), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, exe), data, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	copyLibraries(t, root, exe)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("chroot", root)
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s\n%s", err, stderr)
+	}
+
+	if wrapRe.FindString(stdout.String()) == "" {
+		t.Fatalf("didn't wrap: %#v\n%s", stdout.String(), stderr)
+	}
+}
+
+// copyLibraries copies the shared libraries of a dynamically linked binary,
+// such as a test binary built with cgo, to the same paths inside root.
+func copyLibraries(t *testing.T, root, exe string) {
+	f, err := elf.Open(exe)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	dynamic := false
+	for _, p := range f.Progs {
+		dynamic = dynamic || p.Type == elf.PT_INTERP
+	}
+	if !dynamic {
+		return
+	}
+
+	out, err := exec.Command("ldd", exe).Output()
+	if err != nil {
+		t.Skipf("can't list the libraries of the dynamically linked binary: %s", err)
+	}
+	for _, field := range strings.Fields(string(out)) {
+		if !strings.HasPrefix(field, "/") {
+			continue
+		}
+
+		data, err := os.ReadFile(field)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(field)), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, field), data, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
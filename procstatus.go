@@ -0,0 +1,39 @@
+package panicwrap
+
+// ProcStatus is the status of the child and a summary of its memory when
+// it crashed. See WrapConfig.ProcStatus.
+type ProcStatus struct {
+	// Status holds the fields of /proc/<pid>/status by name, such as
+	// "VmRSS": "10240 kB" or "Threads": "12".
+	Status map[string]string `json:"status"`
+
+	// Memory sums up the memory mappings of the child, from
+	// /proc/<pid>/smaps_rollup. It is nil if the kernel doesn't have it,
+	// which it does since Linux 4.14.
+	Memory *MemorySummary `json:"memory,omitempty"`
+}
+
+// MemorySummary sums up the memory mappings of a process, in bytes.
+type MemorySummary struct {
+	// RSS is the resident set size and PSS the proportional set size,
+	// which splits shared pages among the processes that map them.
+	RSS int64 `json:"rss"`
+	PSS int64 `json:"pss"`
+
+	// Anonymous is the resident memory that isn't backed by a file, such
+	// as the Go heap, and PrivateDirty the memory no other process
+	// shares that was written to.
+	Anonymous    int64 `json:"anonymous"`
+	PrivateDirty int64 `json:"private_dirty"`
+
+	// Swap is the memory that was swapped out.
+	Swap int64 `json:"swap"`
+
+	// AnonHugePages is the anonymous memory backed by transparent huge
+	// pages, and Hugetlb the memory of hugetlbfs mappings.
+	AnonHugePages int64 `json:"anon_huge_pages"`
+	Hugetlb       int64 `json:"hugetlb"`
+
+	// Locked is the memory locked with mlock.
+	Locked int64 `json:"locked"`
+}
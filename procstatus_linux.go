@@ -0,0 +1,68 @@
+package panicwrap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readProcStatus reads the status and the memory summary of the process
+// from /proc.
+func readProcStatus(pid int) (*ProcStatus, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ProcStatus{Status: make(map[string]string)}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		if name, value, ok := strings.Cut(s.Text(), ":"); ok {
+			p.Status[name] = strings.TrimSpace(value)
+		}
+	}
+
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/smaps_rollup", pid)); err == nil {
+		p.Memory = parseSmapsRollup(data)
+	}
+
+	return p, nil
+}
+
+// parseSmapsRollup sums up the fields of smaps_rollup, which are in kB.
+func parseSmapsRollup(data []byte) *MemorySummary {
+	m := new(MemorySummary)
+	fields := map[string]*int64{
+		"Rss":             &m.RSS,
+		"Pss":             &m.PSS,
+		"Anonymous":       &m.Anonymous,
+		"Private_Dirty":   &m.PrivateDirty,
+		"Swap":            &m.Swap,
+		"AnonHugePages":   &m.AnonHugePages,
+		"Shared_Hugetlb":  &m.Hugetlb,
+		"Private_Hugetlb": &m.Hugetlb,
+		"Locked":          &m.Locked,
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		name, value, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+		if err != nil {
+			continue
+		}
+		*field += kb << 10
+	}
+
+	return m
+}
@@ -0,0 +1,49 @@
+package panicwrap
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestReadProcStatus(t *testing.T) {
+	p, err := readProcStatus(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.Status["Pid"] != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("bad status: %#v", p.Status)
+	}
+	if p.Memory != nil && p.Memory.RSS <= 0 {
+		t.Fatalf("should have a resident set: %#v", p.Memory)
+	}
+}
+
+func TestParseSmapsRollup(t *testing.T) {
+	data := []byte(`560e8d631000-7ffcd3f04000 ---p 00000000 00:00 0                          [rollup]
+Rss:                1328 kB
+Pss:                 480 kB
+Private_Dirty:       104 kB
+Anonymous:           104 kB
+AnonHugePages:      2048 kB
+Shared_Hugetlb:        4 kB
+Private_Hugetlb:       8 kB
+Swap:                 16 kB
+Locked:                0 kB
+`)
+	m := parseSmapsRollup(data)
+
+	want := MemorySummary{
+		RSS:           1328 << 10,
+		PSS:           480 << 10,
+		Anonymous:     104 << 10,
+		PrivateDirty:  104 << 10,
+		Swap:          16 << 10,
+		AnonHugePages: 2048 << 10,
+		Hugetlb:       12 << 10,
+	}
+	if *m != want {
+		t.Fatalf("bad: %#v", m)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package panicwrap
+
+import "errors"
+
+func readProcStatus(int) (*ProcStatus, error) {
+	return nil, errors.New("panicwrap: ProcStatus isn't supported on this platform")
+}
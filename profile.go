@@ -0,0 +1,150 @@
+package panicwrap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// profileNames are the runtime profiles the child writes to
+// WrapConfig.ProfileDir.
+var profileNames = []string{"heap", "goroutine"}
+
+// profileEnvKey tells the child that the parent passed it the profile
+// request pipes as extra files.
+const profileEnvKey = "PANICWRAP_PROFILE_PIPES"
+
+// The file descriptors of the profile request pipes in the child. They
+// follow the stdin, stdout and stderr passed in runChild.
+const (
+	profileRequestFd = 6
+	profileReplyFd   = 7
+)
+
+// startProfiler starts the child side of WrapConfig.ProfileDir: it writes
+// the profiles right away and then every ProfileInterval, and whenever the
+// parent asks for them.
+func startProfiler(c *WrapConfig) {
+	interval := c.ProfileInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	var mu sync.Mutex
+	write := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		writeProfiles(c.ProfileDir, os.Getpid())
+	}
+
+	write()
+	go func() {
+		for range time.Tick(interval) {
+			write()
+		}
+	}()
+
+	if os.Getenv(profileEnvKey) != "1" {
+		return
+	}
+	os.Unsetenv(profileEnvKey)
+
+	req := os.NewFile(profileRequestFd, "panicwrap-profile-request")
+	reply := os.NewFile(profileReplyFd, "panicwrap-profile-reply")
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := req.Read(buf); err != nil {
+				return
+			}
+
+			write()
+			if _, err := reply.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// writeProfiles writes the profiles of the current process to the given
+// directory. Each one is written to a temporary file first, so that the
+// parent never sees a partial profile if the child crashes midway.
+func writeProfiles(dir string, pid int) {
+	for _, name := range profileNames {
+		f, err := os.CreateTemp(dir, fmt.Sprintf("%d.%s.tmp", pid, name))
+		if err != nil {
+			continue
+		}
+
+		err = pprof.Lookup(name).WriteTo(f, 0)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), profilePath(dir, pid, name))
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}
+}
+
+func profilePath(dir string, pid int, name string) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.%s.pprof", pid, name))
+}
+
+// readProfiles returns the paths of the profiles the child with the given
+// process ID wrote, keyed by profile name, or nil if there are none.
+func readProfiles(dir string, pid int) map[string]string {
+	var result map[string]string
+	for _, name := range profileNames {
+		path := profilePath(dir, pid, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		if result == nil {
+			result = make(map[string]string)
+		}
+		result[name] = path
+	}
+
+	return result
+}
+
+// removeProfiles removes the profiles of the child with the given process
+// ID, which are of no use once it exited cleanly.
+func removeProfiles(dir string, pid int) {
+	for _, name := range profileNames {
+		os.Remove(profilePath(dir, pid, name))
+	}
+}
+
+// profilePipes is the parent side of the pipes through which the parent
+// asks the child to write its profiles: a byte written to req is answered
+// with a byte on reply once the profiles are written.
+type profilePipes struct {
+	dir string
+	pid int
+
+	req   *os.File
+	reply *os.File
+}
+
+// CaptureProfiles asks the running child to write its profiles to
+// WrapConfig.ProfileDir now and returns their paths, keyed by profile name
+// such as "heap" or "goroutine". It can be called from any goroutine of the
+// parent while Wrap is running. This isn't supported on Windows, where the
+// child only writes its profiles every ProfileInterval.
+func CaptureProfiles(timeout time.Duration) (map[string]string, error) {
+	ch := activeChild.Load()
+	if ch == nil {
+		return nil, errors.New("panicwrap: not wrapping a child")
+	}
+
+	return ch.captureProfiles(timeout)
+}
@@ -0,0 +1,49 @@
+package panicwrap
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriteProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeProfiles(dir, 42)
+
+	profiles := readProfiles(dir, 42)
+	if len(profiles) != len(profileNames) {
+		t.Fatalf("bad: %#v", profiles)
+	}
+	for _, name := range profileNames {
+		fi, err := os.Stat(profiles[name])
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if fi.Size() == 0 {
+			t.Fatalf("empty %s profile", name)
+		}
+	}
+
+	if readProfiles(dir, 43) != nil {
+		t.Fatal("should only read profiles of the given process")
+	}
+
+	removeProfiles(dir, 42)
+	if readProfiles(dir, 42) != nil {
+		t.Fatal("should remove profiles")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("should leave no temporary files: %v", entries)
+	}
+}
+
+func TestCaptureProfiles_notWrapping(t *testing.T) {
+	if _, err := CaptureProfiles(time.Second); err == nil {
+		t.Fatal("should error")
+	}
+}
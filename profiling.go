@@ -0,0 +1,140 @@
+package panicwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"time"
+)
+
+// ProfilingConfig turns on profiling of the child for performance
+// investigations. It is only used if WrapConfig.Profiling is set.
+type ProfilingConfig struct {
+	// Dir is the directory the child writes its profiles to. It is
+	// required. Profile file names start with the process ID of the
+	// child.
+	Dir string
+
+	// CPU turns on CPU profiling. A child can't finish its CPU profile
+	// when it exits, so it writes one every CPUSegment instead, and only
+	// the last, unfinished one is lost. go tool pprof accepts several
+	// profiles at once to look at them together.
+	CPU bool
+
+	// The duration of each CPU profile. Defaults to 30 seconds.
+	CPUSegment time.Duration
+
+	// If greater than zero, these are passed to
+	// runtime.SetMutexProfileFraction and runtime.SetBlockProfileRate in
+	// the child, and the mutex and block profiles are written every
+	// CPUSegment.
+	MutexProfileFraction int
+	BlockProfileRate     int
+
+	// Collect, if set, is called in the parent with the paths of the
+	// profiles of each child once it exited.
+	Collect func(paths []string)
+}
+
+// startProfiling starts the child side of the given profiling
+// configuration.
+func startProfiling(p *ProfilingConfig) {
+	if p.MutexProfileFraction > 0 {
+		runtime.SetMutexProfileFraction(p.MutexProfileFraction)
+	}
+	if p.BlockProfileRate > 0 {
+		runtime.SetBlockProfileRate(p.BlockProfileRate)
+	}
+
+	segment := p.CPUSegment
+	if segment == 0 {
+		segment = 30 * time.Second
+	}
+
+	pid := os.Getpid()
+	var cpu *os.File
+	startCPU := func(n int) {
+		if !p.CPU {
+			return
+		}
+
+		// The profile is written to a temporary file until it is
+		// finished, so that the parent can tell it apart.
+		f, err := os.Create(profilingPath(p.Dir, pid, fmt.Sprintf("cpu.%d", n)) + ".tmp")
+		if err != nil {
+			return
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return
+		}
+		cpu = f
+	}
+
+	startCPU(0)
+	go func() {
+		for n := 1; ; n++ {
+			time.Sleep(segment)
+
+			if cpu != nil {
+				pprof.StopCPUProfile()
+				cpu.Close()
+				os.Rename(cpu.Name(), cpu.Name()[:len(cpu.Name())-len(".tmp")])
+				cpu = nil
+			}
+
+			if p.MutexProfileFraction > 0 {
+				writeProfilingProfile(p.Dir, pid, "mutex")
+			}
+			if p.BlockProfileRate > 0 {
+				writeProfilingProfile(p.Dir, pid, "block")
+			}
+
+			startCPU(n)
+		}
+	}()
+}
+
+// writeProfilingProfile writes the named runtime profile of the current
+// process to the given directory.
+func writeProfilingProfile(dir string, pid int, name string) {
+	path := profilingPath(dir, pid, name)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return
+	}
+
+	err = pprof.Lookup(name).WriteTo(f, 0)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func profilingPath(dir string, pid int, name string) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.%s.pprof", pid, name))
+}
+
+// collectProfiling returns the finished profiles of the child with the
+// given process ID and removes the unfinished ones.
+func collectProfiling(dir string, pid int) []string {
+	prefix := filepath.Join(dir, fmt.Sprintf("%d.", pid))
+
+	tmp, _ := filepath.Glob(prefix + "*.pprof.tmp")
+	for _, path := range tmp {
+		os.Remove(path)
+	}
+
+	paths, _ := filepath.Glob(prefix + "*.pprof")
+	sort.Strings(paths)
+	return paths
+}
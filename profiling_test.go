@@ -0,0 +1,45 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollectProfiling(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"42.cpu.0.pprof",
+		"42.cpu.1.pprof.tmp",
+		"42.mutex.pprof",
+		"43.cpu.0.pprof",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	paths := collectProfiling(dir, 42)
+	expected := []string{
+		filepath.Join(dir, "42.cpu.0.pprof"),
+		filepath.Join(dir, "42.mutex.pprof"),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("bad: %#v", paths)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "42.cpu.1.pprof.tmp")); !os.IsNotExist(err) {
+		t.Fatal("should remove unfinished profiles")
+	}
+}
+
+func TestWrap_profilingDir(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:   func(string) {},
+		Profiling: new(ProfilingConfig),
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
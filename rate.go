@@ -0,0 +1,249 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OutputRateConfig limits the output the parent forwards for each stream
+// of a child, so that a log storm doesn't saturate the parent and the log
+// shippers behind it. Crashes are detected and written out in full
+// whatever the rate.
+type OutputRateConfig struct {
+	// BytesPerSecond, if greater than zero, is the rate at which each of
+	// stdout and stderr is forwarded on average. Lines over it are
+	// dropped, and a line that says how many were dropped is written once
+	// the rate allows output again.
+	BytesPerSecond int
+
+	// Burst is how many bytes a stream may forward at once above the
+	// rate. Defaults to BytesPerSecond.
+	Burst int
+
+	// If Throttle is true, output over the rate isn't dropped: the parent
+	// reads it no faster than the rate, which slows down the child as its
+	// writes block. A crash that follows a lot of output is then
+	// detected late.
+	Throttle bool
+
+	// If CollapseDuplicates is true, a run of identical lines is
+	// forwarded as its first line and a line that says how many more
+	// were suppressed, once the run ends. Lines written in pieces are
+	// never collapsed.
+	CollapseDuplicates bool
+}
+
+// Lines that the rate writer adds to the output.
+const (
+	rateDroppedLine    = "[panicwrap: dropped %s lines (%s bytes) of %s over OutputRate]\n"
+	rateDuplicatesLine = "[panicwrap: suppressed %s duplicate lines of %s]\n"
+)
+
+// rateWriter applies an OutputRateConfig to one stream of a child. Like
+// prefixWriter, it tracks lines across writes.
+type rateWriter struct {
+	mu         sync.Mutex
+	w          io.Writer
+	r          *OutputRateConfig
+	clock      Clock
+	name       string
+	suppressed *atomic.Int64
+
+	// tokens are the bytes the stream may forward now, as of last. They
+	// go below zero while a line over them is forwarded.
+	tokens float64
+	last   time.Time
+
+	// midLine is whether a line is in progress, and dropping whether it
+	// is being dropped.
+	midLine  bool
+	dropping bool
+
+	// droppedLines and droppedBytes are what was dropped since output was
+	// last forwarded.
+	droppedLines int64
+	droppedBytes int64
+
+	// prev is the last line forwarded, if it was written whole, and
+	// duplicates the number of copies of it suppressed since.
+	prev       []byte
+	duplicates int64
+}
+
+// newRateWriter returns a writer that forwards the stream with the given
+// name to w at the rate of the configuration, counting the lines it
+// suppresses, if suppressed is set.
+func newRateWriter(c *WrapConfig, w io.Writer, name string, suppressed *atomic.Int64) *rateWriter {
+	rw := &rateWriter{w: w, r: c.OutputRate, clock: c.Clock, name: name, suppressed: suppressed, last: c.Clock.Now()}
+	rw.tokens = float64(rw.burst())
+	return rw
+}
+
+func (rw *rateWriter) burst() int {
+	if rw.r.Burst > 0 {
+		return rw.r.Burst
+	}
+	return rw.r.BytesPerSecond
+}
+
+func (rw *rateWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	var out bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		line := rest
+		if idx := bytes.IndexByte(rest, '\n'); idx >= 0 {
+			line = rest[:idx+1]
+		}
+		rest = rest[len(line):]
+		whole := line[len(line)-1] == '\n'
+
+		if rw.midLine {
+			rw.midLine = !whole
+			if rw.dropping {
+				rw.droppedBytes += int64(len(line))
+				continue
+			}
+			if err := rw.admit(&out, len(line), true); err != nil {
+				return 0, err
+			}
+			out.Write(line)
+			continue
+		}
+		rw.midLine = !whole
+
+		if rw.r.CollapseDuplicates && whole && rw.prev != nil && bytes.Equal(line, rw.prev) {
+			rw.duplicates++
+			rw.suppress()
+			continue
+		}
+		rw.writeDuplicates(&out)
+
+		if err := rw.admit(&out, len(line), false); err != nil {
+			if err != errRateDrop {
+				return 0, err
+			}
+			rw.dropping = true
+			rw.droppedLines++
+			rw.droppedBytes += int64(len(line))
+			rw.prev = nil
+			rw.suppress()
+			continue
+		}
+		rw.dropping = false
+		rw.writeDropped(&out)
+		out.Write(line)
+
+		rw.prev = nil
+		if whole && rw.r.CollapseDuplicates {
+			rw.prev = append(rw.prev, line...)
+		}
+	}
+
+	if out.Len() > 0 {
+		if _, err := rw.w.Write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// errRateDrop is returned by admit for a line over the rate.
+var errRateDrop = errors.New("over the output rate")
+
+// admit takes n bytes from the tokens. A line that continues one that was
+// admitted always is. Otherwise, a line is admitted while there are
+// tokens left, and errRateDrop is returned if there aren't, unless the
+// stream is throttled: then what is in out is written and admit waits
+// for the tokens.
+func (rw *rateWriter) admit(out *bytes.Buffer, n int, continued bool) error {
+	if rw.r.BytesPerSecond <= 0 {
+		return nil
+	}
+
+	now := rw.clock.Now()
+	rate := float64(rw.r.BytesPerSecond)
+	rw.tokens = min(rw.tokens+now.Sub(rw.last).Seconds()*rate, float64(rw.burst()))
+	rw.last = now
+
+	if rw.tokens <= 0 && !continued {
+		if !rw.r.Throttle {
+			return errRateDrop
+		}
+		if out.Len() > 0 {
+			if _, err := rw.w.Write(out.Bytes()); err != nil {
+				return err
+			}
+			out.Reset()
+		}
+
+		wait := time.Duration((1 - rw.tokens) / rate * float64(time.Second))
+		<-rw.clock.After(wait)
+		now = rw.clock.Now()
+		rw.tokens += now.Sub(rw.last).Seconds() * rate
+		rw.last = now
+	}
+
+	rw.tokens -= float64(n)
+	return nil
+}
+
+func (rw *rateWriter) suppress() {
+	if rw.suppressed != nil {
+		rw.suppressed.Add(1)
+	}
+}
+
+// writeDuplicates writes the line for the duplicates suppressed, if any.
+func (rw *rateWriter) writeDuplicates(out *bytes.Buffer) {
+	if rw.duplicates > 0 {
+		fmt.Fprintf(out, rateDuplicatesLine, humanCount(rw.duplicates), rw.name)
+		rw.duplicates = 0
+	}
+}
+
+// writeDropped writes the line for the lines dropped, if any.
+func (rw *rateWriter) writeDropped(out *bytes.Buffer) {
+	if rw.droppedLines > 0 {
+		fmt.Fprintf(out, rateDroppedLine, humanCount(rw.droppedLines), humanCount(rw.droppedBytes), rw.name)
+		rw.droppedLines, rw.droppedBytes = 0, 0
+	}
+}
+
+// flush writes the lines for what was suppressed at the end of the
+// output. It is called once the child exited.
+func (rw *rateWriter) flush() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	var out bytes.Buffer
+	if rw.midLine && !rw.dropping && (rw.duplicates > 0 || rw.droppedLines > 0) {
+		out.WriteByte('\n')
+	}
+	rw.writeDuplicates(&out)
+	rw.writeDropped(&out)
+	if out.Len() > 0 {
+		rw.w.Write(out.Bytes())
+	}
+}
+
+// humanCount formats n with a metric suffix, such as 1.2M.
+func humanCount(n int64) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprintf("%d", n)
+	case n < 1000000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	case n < 1000000000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	default:
+		return fmt.Sprintf("%.1fG", float64(n)/1e9)
+	}
+}
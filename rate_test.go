@@ -0,0 +1,170 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateWriter_drop(t *testing.T) {
+	out := new(bytes.Buffer)
+	clock := newFakeClock()
+	var suppressed atomic.Int64
+	c := &WrapConfig{Clock: clock, OutputRate: &OutputRateConfig{BytesPerSecond: 10}}
+	w := newRateWriter(c, out, "stdout", &suppressed)
+
+	w.Write([]byte("aaaa\nbbbbbbbb\ncc\n"))
+	w.Write([]byte("dd"))
+	w.Write([]byte("d\n"))
+	if out.String() != "aaaa\nbbbbbbbb\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+
+	clock.Advance(time.Second)
+	w.Write([]byte("ee\n"))
+	if want := "aaaa\nbbbbbbbb\n[panicwrap: dropped 2 lines (7 bytes) of stdout over OutputRate]\nee\n"; out.String() != want {
+		t.Fatalf("bad: %q", out.String())
+	}
+	if suppressed.Load() != 2 {
+		t.Fatalf("bad: %d", suppressed.Load())
+	}
+}
+
+func TestRateWriter_duplicates(t *testing.T) {
+	out := new(bytes.Buffer)
+	c := &WrapConfig{Clock: newFakeClock(), OutputRate: &OutputRateConfig{CollapseDuplicates: true}}
+	w := newRateWriter(c, out, "stderr", nil)
+
+	w.Write([]byte("x\nx\nx\n"))
+	w.Write([]byte("x\ny\n"))
+	w.Write([]byte("y"))
+	w.Write([]byte("\ny\n"))
+	w.flush()
+
+	want := "x\n[panicwrap: suppressed 3 duplicate lines of stderr]\ny\ny\ny\n"
+	if out.String() != want {
+		t.Fatalf("bad: %q", out.String())
+	}
+
+	w.Write([]byte("y\ny\n"))
+	w.flush()
+	if want += "[panicwrap: suppressed 2 duplicate lines of stderr]\n"; out.String() != want {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestRateWriter_throttle(t *testing.T) {
+	out := new(bytes.Buffer)
+	clock := newFakeClock()
+	c := &WrapConfig{Clock: clock, OutputRate: &OutputRateConfig{BytesPerSecond: 10, Burst: 5, Throttle: true}}
+	w := newRateWriter(c, out, "stdout", nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Write([]byte("aaaa\nbbbb\n"))
+	}()
+
+	<-clock.waiting
+	if out.String() != "aaaa\n" {
+		t.Fatalf("should write what is admitted before it waits: %q", out.String())
+	}
+	clock.Advance(time.Second)
+	<-done
+	if out.String() != "aaaa\nbbbb\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestHumanCount(t *testing.T) {
+	cases := map[int64]string{
+		12:            "12",
+		340000:        "340.0k",
+		1200000:       "1.2M",
+		3400000000:    "3.4G",
+		999:           "999",
+		1000:          "1.0k",
+		999999999 + 1: "1.0G",
+	}
+	for n, want := range cases {
+		if got := humanCount(n); got != want {
+			t.Errorf("%d: got %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestWrap_outputRate(t *testing.T) {
+	var info *PanicInfo
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	e := &fakeExecutor{
+		stdout: []string{strings.Repeat("retrying\n", 100)},
+		stderr: []string{testPanicText},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		Stdout:      stdout,
+		Writer:      stderr,
+		OutputRate:  &OutputRateConfig{CollapseDuplicates: true},
+		Executor:    e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if stdout.String() != "retrying\n[panicwrap: suppressed 99 duplicate lines of stdout]\n" {
+		t.Fatalf("bad: %q", stdout.String())
+	}
+	if info == nil || !strings.Contains(stderr.String(), "goroutine 1 [running]") {
+		t.Fatalf("the crash should go through: %#v, %q", info, stderr.String())
+	}
+}
+
+// halfLineExecutor starts processes that write their lines of stderr in
+// two halves, with a pause in between.
+type halfLineExecutor struct {
+	fakeExecutor
+}
+
+func (e *halfLineExecutor) Start(cmd *exec.Cmd) (Process, error) {
+	p, err := e.fakeExecutor.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &halfLineProcess{p.(*fakeProcess)}, nil
+}
+
+type halfLineProcess struct {
+	*fakeProcess
+}
+
+func (p *halfLineProcess) Wait() (ProcessExit, error) {
+	for i := 0; i < 20; i++ {
+		p.cmd.Stderr.Write([]byte("a whole "))
+		time.Sleep(time.Millisecond)
+		p.cmd.Stderr.Write([]byte("line\n"))
+	}
+	return ProcessExit{}, nil
+}
+
+func TestWrap_outputRateWorkers(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	_, _, err := Wrap(&WrapConfig{
+		Handler:    func(string) {},
+		Writer:     stderr,
+		Workers:    2,
+		OutputRate: &OutputRateConfig{BytesPerSecond: 1000},
+		Executor:   new(halfLineExecutor),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if stderr.String() != strings.Repeat("a whole line\n", 40) {
+		t.Fatalf("should write whole lines: %q", stderr.String())
+	}
+}
@@ -0,0 +1,94 @@
+package panicwrap
+
+import (
+	"time"
+)
+
+// reapInterval is how often the parent reaps the descendants of its
+// children that were reparented to it. See WrapConfig.Subreaper.
+const reapInterval = time.Second
+
+// LeftBehindProcess is a process that a child that exited left running,
+// which the parent adopted. See WrapConfig.Subreaper.
+type LeftBehindProcess struct {
+	// PID is the process ID.
+	PID int `json:"pid"`
+
+	// Command is the name of the command of the process, such as
+	// "worker", if it could be told.
+	Command string `json:"command,omitempty"`
+}
+
+// reaper reaps the descendants of the children that outlived their
+// parents and were reparented to the parent, once they exited.
+type reaper struct {
+	c    *WrapConfig
+	ch   *child
+	quit chan struct{}
+	done chan struct{}
+}
+
+// startReaper makes the parent the reaper of its descendants, and reaps
+// those that exit until stop is called.
+func startReaper(c *WrapConfig, ch *child) (*reaper, error) {
+	if err := acquireReaper(); err != nil {
+		return nil, err
+	}
+
+	r := &reaper{c: c, ch: ch, quit: make(chan struct{}), done: make(chan struct{})}
+	go r.run()
+	return r, nil
+}
+
+func (r *reaper) run() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.c.Clock.After(reapInterval):
+		case <-r.quit:
+			r.reap()
+			return
+		}
+		r.reap()
+	}
+}
+
+// reap reaps the orphans that exited. Where the system doesn't keep
+// track of which processes descend from the children, it notes the
+// descendants of the running ones too.
+func (r *reaper) reap() {
+	var children []int
+	r.ch.each(func(wk *child) {
+		wk.with(func(p Process) error {
+			children = append(children, p.Pid())
+			return nil
+		})
+	})
+	for _, pid := range reapOrphans(children) {
+		debugf(r.c, "reaped orphaned descendant %d", pid)
+	}
+}
+
+// stop stops reaping, after reaping what exited by then.
+func (r *reaper) stop() {
+	close(r.quit)
+	<-r.done
+}
+
+// leftBehind returns what the child with the given process ID left
+// running when it exited, and sends it WrapConfig.SubreaperSignal if
+// that is set.
+func leftBehind(c *WrapConfig, pid int) []LeftBehindProcess {
+	procs := orphansOf(pid)
+	if len(procs) == 0 || c.SubreaperSignal == nil {
+		return procs
+	}
+
+	n, err := killSubtree(pid, c.SubreaperSignal)
+	if err != nil {
+		reportInternal(c, "signaling the descendants of the child", err)
+	} else if n > 0 {
+		debugf(c, "signaled %d descendants that child %d left", n, pid)
+	}
+	return procs
+}
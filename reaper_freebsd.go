@@ -0,0 +1,144 @@
+//go:build freebsd && !386 && !arm
+
+package panicwrap
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// subreaperSupported is whether WrapConfig.Subreaper can be used.
+const subreaperSupported = true
+
+// The procctl commands and flags of the reaper, see procctl(2).
+const (
+	procReapAcquire = 2
+	procReapGetPIDs = 5
+	procReapKill    = 6
+
+	reaperPIDInfoValid  = 0x1
+	reaperPIDInfoChild  = 0x2
+	reaperPIDInfoZombie = 0x8
+
+	reaperKillSubtree = 0x2
+
+	pPID = 0
+)
+
+// reaperPIDInfo is struct procctl_reaper_pidinfo.
+type reaperPIDInfo struct {
+	pid     int32
+	subtree int32
+	flags   uint32
+	_       [15]uint32
+}
+
+// reaperPIDs is struct procctl_reaper_pids.
+type reaperPIDs struct {
+	count uint32
+	_     [15]uint32
+	pids  *reaperPIDInfo
+}
+
+// reaperKill is struct procctl_reaper_kill.
+type reaperKill struct {
+	sig     int32
+	flags   uint32
+	subtree int32
+	killed  uint32
+	fpid    int32
+	_       [15]uint32
+}
+
+// procctl calls procctl(2) on the parent.
+func procctl(cmd int, data unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_PROCCTL, pPID, uintptr(os.Getpid()), uintptr(cmd), uintptr(data), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// acquireReaper makes the parent the reaper of its descendants, which
+// are reparented to it rather than to init once their parent exited.
+func acquireReaper() error {
+	return procctl(procReapAcquire, nil)
+}
+
+// reaperPIDList returns the descendants of the parent.
+func reaperPIDList() []reaperPIDInfo {
+	for size := 64; ; size *= 2 {
+		pids := make([]reaperPIDInfo, size)
+		req := reaperPIDs{count: uint32(size), pids: &pids[0]}
+		if err := procctl(procReapGetPIDs, unsafe.Pointer(&req)); err != nil {
+			return nil
+		}
+		// The list is cut short if it doesn't fit.
+		if pids[size-1].flags&reaperPIDInfoValid == 0 {
+			return pids
+		}
+	}
+}
+
+// orphan returns whether the descendant was reparented to the parent. A
+// child of the parent heads a subtree of its own, while one that was
+// reparented is still in the subtree of the child it descends from, so
+// the children the parent started itself are left to whoever waits for
+// them.
+func (p reaperPIDInfo) orphan() bool {
+	return p.flags&reaperPIDInfoChild != 0 && p.pid != p.subtree
+}
+
+// reapOrphans reaps the descendants that were reparented to the parent
+// and exited, and returns their process IDs. The system keeps track of
+// the subtrees, so the children don't matter.
+func reapOrphans([]int) []int {
+	var reaped []int
+	for _, p := range reaperPIDList() {
+		if p.flags&reaperPIDInfoValid == 0 {
+			break
+		}
+		if !p.orphan() {
+			continue
+		}
+		var status syscall.WaitStatus
+		if pid, err := syscall.Wait4(int(p.pid), &status, syscall.WNOHANG, nil); err == nil && pid > 0 {
+			reaped = append(reaped, pid)
+		}
+	}
+	return reaped
+}
+
+// orphansOf returns the processes the child with the given process ID
+// left running that were reparented to the parent. Their commands aren't
+// told.
+func orphansOf(pid int) []LeftBehindProcess {
+	var procs []LeftBehindProcess
+	for _, p := range reaperPIDList() {
+		if p.flags&reaperPIDInfoValid == 0 {
+			break
+		}
+		if p.orphan() && int(p.subtree) == pid && p.flags&reaperPIDInfoZombie == 0 {
+			procs = append(procs, LeftBehindProcess{PID: int(p.pid)})
+		}
+	}
+	return procs
+}
+
+// trackDescendants does nothing, since the system keeps track of the
+// subtrees.
+func trackDescendants(int) {}
+
+// killSubtree sends the signal to the descendants of the child with the
+// given process ID, and returns how many it reached.
+func killSubtree(pid int, sig os.Signal) (int, error) {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return 0, syscall.EINVAL
+	}
+	req := reaperKill{sig: int32(s), flags: reaperKillSubtree, subtree: int32(pid)}
+	if err := procctl(procReapKill, unsafe.Pointer(&req)); err != nil && err != syscall.ESRCH {
+		return 0, err
+	}
+	return int(req.killed), nil
+}
@@ -0,0 +1,218 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// subreaperSupported is whether WrapConfig.Subreaper can be used.
+const subreaperSupported = true
+
+// prSetChildSubreaper is the PR_SET_CHILD_SUBREAPER option of prctl.
+const prSetChildSubreaper = 36
+
+// descendants are the processes seen to descend from a child, by process
+// ID. Linux doesn't tell which child an orphan that was reparented to the
+// parent descends from, or that it was reparented at all, so this is how
+// orphans are told apart from the children the parent started itself,
+// which are left to whoever waits for them. Processes that were started
+// and orphaned in between two looks aren't seen.
+var descendants = struct {
+	sync.Mutex
+	m map[int]descendant
+}{m: make(map[int]descendant)}
+
+// descendant is a process seen to descend from a child.
+type descendant struct {
+	// start is the start time of the process, which tells it apart from a
+	// later one with the same process ID.
+	start uint64
+
+	// root is the process ID of the child it descends from.
+	root int
+}
+
+// procEntry is a process, from its stat file.
+type procEntry struct {
+	ppid    int
+	state   byte
+	start   uint64
+	command string
+}
+
+// acquireReaper makes the parent the subreaper of its descendants, which
+// are reparented to it rather than to init once their parent exited.
+func acquireReaper() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readProcTable reads the processes of the system by process ID.
+func readProcTable() map[int]procEntry {
+	paths, _ := filepath.Glob("/proc/[0-9]*/stat")
+	table := make(map[int]procEntry, len(paths))
+	for _, path := range paths {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if e, ok := parseProcStat(data); ok {
+			table[pid] = e
+		}
+	}
+	return table
+}
+
+// parseProcStat parses a stat file, such as
+// "42 (worker) S 1 42 42 0 -1 ...", whose command may hold spaces and
+// parentheses itself.
+func parseProcStat(data []byte) (procEntry, bool) {
+	open, end := bytes.IndexByte(data, '('), bytes.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procEntry{}, false
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 || len(fields[0]) != 1 {
+		return procEntry{}, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procEntry{}, false
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procEntry{}, false
+	}
+	return procEntry{ppid: ppid, state: fields[0][0], start: start, command: string(data[open+1 : end])}, true
+}
+
+// noteDescendants adds the processes of the table that descend from one
+// of the children, or from a descendant seen before, to descendants.
+// The caller holds its lock.
+func noteDescendants(table map[int]procEntry, children []int) {
+	roots := make(map[int]int, len(children))
+	for _, pid := range children {
+		roots[pid] = pid
+	}
+	self := os.Getpid()
+
+	// rootOf returns the child the process descends from, or 0.
+	var rootOf func(pid, depth int) int
+	rootOf = func(pid, depth int) int {
+		if root, ok := roots[pid]; ok {
+			return root
+		}
+		e, ok := table[pid]
+		if !ok || depth > len(table) {
+			return 0
+		}
+		root := 0
+		if d, ok := descendants.m[pid]; ok && d.start == e.start {
+			root = d.root
+		} else if e.ppid > 1 && e.ppid != self {
+			root = rootOf(e.ppid, depth+1)
+		}
+		roots[pid] = root
+		return root
+	}
+
+	for pid, e := range table {
+		if _, ok := descendants.m[pid]; ok {
+			continue
+		}
+		if root := rootOf(pid, 0); root != 0 && root != pid {
+			descendants.m[pid] = descendant{start: e.start, root: root}
+		}
+	}
+}
+
+// reapOrphans notes the descendants of the children, reaps those that
+// were reparented to the parent and exited, and returns their process
+// IDs.
+func reapOrphans(children []int) []int {
+	table := readProcTable()
+	self := os.Getpid()
+
+	descendants.Lock()
+	defer descendants.Unlock()
+	noteDescendants(table, children)
+
+	var reaped []int
+	for pid, d := range descendants.m {
+		e, ok := table[pid]
+		if !ok || e.start != d.start {
+			// It was reaped by its parent.
+			delete(descendants.m, pid)
+			continue
+		}
+		if e.ppid != self || e.state != 'Z' {
+			continue
+		}
+		var status syscall.WaitStatus
+		if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err == nil && wpid > 0 {
+			reaped = append(reaped, pid)
+			delete(descendants.m, pid)
+		}
+	}
+	return reaped
+}
+
+// trackDescendants notes the descendants of the child with the given
+// process ID right now, such as when it crashes, so that those it started
+// since the reaper last looked are known once it exited.
+func trackDescendants(pid int) {
+	table := readProcTable()
+
+	descendants.Lock()
+	defer descendants.Unlock()
+	noteDescendants(table, []int{pid})
+}
+
+// orphansOf returns the processes the child with the given process ID
+// left running that were reparented to the parent.
+func orphansOf(pid int) []LeftBehindProcess {
+	table := readProcTable()
+	self := os.Getpid()
+
+	descendants.Lock()
+	defer descendants.Unlock()
+
+	var procs []LeftBehindProcess
+	for p, d := range descendants.m {
+		e, ok := table[p]
+		if d.root != pid || !ok || e.start != d.start || e.ppid != self || e.state == 'Z' {
+			continue
+		}
+		procs = append(procs, LeftBehindProcess{PID: p, Command: e.command})
+	}
+	slices.SortFunc(procs, func(a, b LeftBehindProcess) int { return a.PID - b.PID })
+	return procs
+}
+
+// killSubtree sends the signal to the processes the child with the given
+// process ID left running, and returns how many it reached.
+func killSubtree(pid int, sig os.Signal) (int, error) {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return 0, syscall.EINVAL
+	}
+	n := 0
+	for _, p := range orphansOf(pid) {
+		if syscall.Kill(p.PID, s) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
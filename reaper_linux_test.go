@@ -0,0 +1,99 @@
+package panicwrap
+
+import (
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	data := []byte("42 (my (odd) worker) Z 7 42 42 0 -1 4194560 100 0 0 0 0 0 0 0 20 0 1 0 12345 0 0\n")
+	e, ok := parseProcStat(data)
+	if !ok {
+		t.Fatal("should parse")
+	}
+	if e.ppid != 7 || e.state != 'Z' || e.start != 12345 || e.command != "my (odd) worker" {
+		t.Fatalf("bad: %#v", e)
+	}
+
+	if _, ok := parseProcStat([]byte("42 (short) S 1")); ok {
+		t.Fatal("should reject a short stat")
+	}
+}
+
+func TestNoteDescendants(t *testing.T) {
+	descendants.Lock()
+	defer descendants.Unlock()
+	saved := descendants.m
+	defer func() { descendants.m = saved }()
+	descendants.m = map[int]descendant{500: {start: 9, root: 100}}
+
+	table := map[int]procEntry{
+		100: {ppid: 1, start: 1},
+		101: {ppid: 100, start: 2},
+		102: {ppid: 101, start: 3},
+		200: {ppid: 1, start: 4},
+		500: {ppid: 1, start: 9},
+		501: {ppid: 500, start: 10},
+	}
+	noteDescendants(table, []int{100})
+
+	for pid, root := range map[int]int{101: 100, 102: 100, 501: 100} {
+		if d, ok := descendants.m[pid]; !ok || d.root != root {
+			t.Fatalf("%d should descend from %d: %#v", pid, root, descendants.m)
+		}
+	}
+	for _, pid := range []int{100, 200} {
+		if _, ok := descendants.m[pid]; ok {
+			t.Fatalf("%d isn't a descendant", pid)
+		}
+	}
+}
+
+func TestSubreaper(t *testing.T) {
+	if err := acquireReaper(); err != nil {
+		t.Skipf("can't become a subreaper: %s", err)
+	}
+
+	cmd := exec.Command("sh", "-c", "sleep 30 >/dev/null & echo $!; read x")
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	line := make([]byte, 32)
+	n, _ := stdout.Read(line)
+	sleep, err := strconv.Atoi(strings.TrimSpace(string(line[:n])))
+	if err != nil {
+		t.Fatalf("bad pid %q: %s", line[:n], err)
+	}
+
+	trackDescendants(cmd.Process.Pid)
+	stdin.Close()
+	io.Copy(io.Discard, stdout)
+	cmd.Wait()
+
+	procs := orphansOf(cmd.Process.Pid)
+	if len(procs) != 1 || procs[0].PID != sleep || procs[0].Command != "sleep" {
+		t.Fatalf("should adopt the sleep: %#v", procs)
+	}
+
+	if n, err := killSubtree(cmd.Process.Pid, syscall.SIGKILL); err != nil || n != 1 {
+		t.Fatalf("should kill it: %d %v", n, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reaped := reapOrphans(nil)
+		if len(reaped) == 1 && reaped[0] == sleep {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("should reap it")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !linux && (!freebsd || 386 || arm)
+
+package panicwrap
+
+import (
+	"errors"
+	"os"
+)
+
+// subreaperSupported is whether WrapConfig.Subreaper can be used.
+const subreaperSupported = false
+
+var errSubreaperUnsupported = errors.New("panicwrap: Subreaper isn't supported on this platform")
+
+func acquireReaper() error {
+	return errSubreaperUnsupported
+}
+
+func reapOrphans([]int) []int {
+	return nil
+}
+
+func orphansOf(int) []LeftBehindProcess {
+	return nil
+}
+
+func trackDescendants(int) {}
+
+func killSubtree(int, os.Signal) (int, error) {
+	return 0, errSubreaperUnsupported
+}
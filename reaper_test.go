@@ -0,0 +1,22 @@
+package panicwrap
+
+import (
+	"testing"
+)
+
+func TestValidate_subreaperUnsupported(t *testing.T) {
+	if subreaperSupported {
+		t.Skip("Subreaper is supported here")
+	}
+
+	err := (&WrapConfig{Handler: func(string) {}, Subreaper: true}).Validate()
+	if err == nil || err.Error() != "Subreaper is only supported on Linux and 64-bit FreeBSD" {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestLeftBehind_none(t *testing.T) {
+	if procs := leftBehind(&WrapConfig{SubreaperSignal: nil}, 1<<30); len(procs) != 0 {
+		t.Fatalf("bad: %#v", procs)
+	}
+}
@@ -0,0 +1,167 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// recorder keeps the last bytes the child wrote to stderr, exactly as the
+// parent received them. See WrapConfig.RecordDir and WrapConfig.TailSize.
+type recorder struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+
+	// cut is whether the recorder dropped output from the start.
+	cut bool
+
+	// The recorder keeps no more than it reserved from the budget, if
+	// any. See WrapConfig.MemoryBudget.
+	budget   *memoryBudget
+	reserved int
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limit := r.max
+	if r.budget != nil {
+		if want := min(len(r.buf)+len(p), r.max); want > r.reserved {
+			r.reserved += r.budget.reserveUpTo(useRecording, want-r.reserved)
+		}
+		limit = r.reserved
+	}
+
+	r.buf = append(r.buf, p...)
+	if extra := len(r.buf) - limit; extra > 0 {
+		r.buf = append(r.buf[:0], r.buf[extra:]...)
+		r.cut = true
+	}
+
+	return len(p), nil
+}
+
+// free returns what the recorder reserved to the budget.
+func (r *recorder) free() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.budget.release(r.reserved)
+	r.reserved = 0
+}
+
+func (r *recorder) bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]byte(nil), r.buf...)
+}
+
+// tail returns what the recorder kept as text, without the partial line
+// it starts with if output was dropped before it.
+func (r *recorder) tail() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.buf
+	if r.cut {
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			b = b[i+1:]
+		}
+	}
+	return string(b)
+}
+
+// saveRecording writes the recorded stderr of the child with the given
+// process ID to the given directory, encrypted if e is set, and returns
+// its path. This is best-effort: an empty path is
+// returned if it can't be written.
+func saveRecording(dir string, pid int, data []byte, now time.Time, e Encrypter) string {
+	name := fmt.Sprintf("%s-%d.stderr", now.UTC().Format("20060102T150405.000Z"), pid)
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ""
+	}
+	if e != nil {
+		return saveEncrypted(path+e.Suffix(), data, e)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// saveEncrypted writes the data encrypted to the path, which it returns,
+// or an empty path if it can't be written.
+func saveEncrypted(path string, data []byte, e Encrypter) string {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return ""
+	}
+	err = writeEncrypted(f, bytes.NewReader(data), e)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return ""
+	}
+
+	return path
+}
+
+// Replay runs the given stderr output, such as a recording made with
+// WrapConfig.RecordDir, through the same detection and handling as the
+// output of a child, as if the child exited with status 2 once the output
+// ended. The output that isn't part of a panic goes to the configured
+// Writer as usual. This is meant for reproducing reports of panics that
+// weren't detected or handled as expected.
+//
+// Since the output is read at once, the DetectDuration doesn't apply:
+// everything after a panic header is taken as part of the panic. Build,
+// Host and the other details about the crashed process are left empty.
+// Recordings are kept as the child wrote them, so they are decoded with
+// the StderrEncoding of the configuration. ErrNoPanic is returned if no
+// panic was found, and a *HandlerPanicError if a handler panicked.
+func Replay(r io.Reader, c *WrapConfig) error {
+	if c.Handler == nil && c.InfoHandler == nil && c.PanicWriter == nil {
+		return errors.New("handler must be set")
+	}
+	setDefaults(c)
+
+	if c.StderrEncoding != "" {
+		pr, pw := io.Pipe()
+		go func(r io.Reader) {
+			_, err := io.Copy(newDecodingWriter(pw, c.StderrEncoding), r)
+			pw.CloseWithError(err)
+		}(r)
+		r = pr
+	}
+
+	panicCh := make(chan string)
+	go trackPanicContained(c, r, c.Writer, time.Hour, time.Hour, c.Clock, defaultTrackSize, false, newHeaderRules(c), nil, nil, panicCh)
+	text := <-panicCh
+	for range panicCh {
+	}
+	text = scrub(c, text)
+
+	switch {
+	case text == "":
+		return ErrNoPanic
+	case isDump(text):
+		return handleDump(c, new(child), &Dump{Text: text, Time: c.Clock.Now()}, false)
+	default:
+		return handlePanic(c, newCrashTracker(c.DedupWindow), &PanicInfo{
+			Text:       text,
+			ExitStatus: 2,
+		}, false)
+	}
+}
+
+// ErrNoPanic is returned by Replay when the output contains no panic.
+var ErrNoPanic = errors.New("panicwrap: no panic found")
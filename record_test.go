@@ -0,0 +1,154 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	r := &recorder{max: 5}
+	r.Write([]byte("abc"))
+	r.Write([]byte("defg"))
+
+	if string(r.bytes()) != "cdefg" {
+		t.Fatalf("should keep the end: %q", r.bytes())
+	}
+}
+
+func TestRecorder_tail(t *testing.T) {
+	r := &recorder{max: 10}
+	r.Write([]byte("one\ntwo\n"))
+	if r.tail() != "one\ntwo\n" {
+		t.Fatalf("should keep all of it: %q", r.tail())
+	}
+
+	r.Write([]byte("three\n"))
+	if r.tail() != "three\n" {
+		t.Fatalf("should drop the partial line: %q", r.tail())
+	}
+}
+
+func TestWrap_tails(t *testing.T) {
+	var info *PanicInfo
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		TailSize:    64,
+		Stdout:      new(bytes.Buffer),
+		Writer:      new(bytes.Buffer),
+		Executor: &fakeExecutor{
+			stdout: []string{"serving requests\n", "request done\n"},
+			stderr: []string{"warning: slow\n", testPanicText},
+			exit:   ProcessExit{Status: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if info == nil {
+		t.Fatal("should call the handler")
+	}
+	if info.StdoutTail != "serving requests\nrequest done\n" {
+		t.Fatalf("bad stdout tail: %q", info.StdoutTail)
+	}
+	if info.StderrTail != "warning: slow\n" {
+		t.Fatalf("bad stderr tail: %q", info.StderrTail)
+	}
+}
+
+func TestSaveRecording(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	path := saveRecording(dir, 42, []byte("raw"), now, nil)
+	if !strings.HasSuffix(path, "20200102T030405.000Z-42.stderr") {
+		t.Fatalf("bad: %s", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "raw" {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestSaveRecording_encrypt(t *testing.T) {
+	path := saveRecording(t.TempDir(), 42, []byte("raw"), time.Now(), &xorEncrypter{})
+	if !strings.HasSuffix(path, ".stderr.xor") {
+		t.Fatalf("bad: %s", path)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if decrypted, err := xorDecrypt(data); err != nil || string(decrypted) != "raw" {
+		t.Fatalf("bad: %q, %v", decrypted, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	var info *PanicInfo
+	c := &WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		Writer:      stderr,
+	}
+
+	if err := Replay(strings.NewReader("starting\n"+testPanicText), c); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if info == nil {
+		t.Fatal("should call the handler")
+	}
+	if info.Value != "runtime error: index out of range [5] with length 3" {
+		t.Fatalf("bad: %#v", info.Value)
+	}
+	if info.Fingerprint != fingerprint(testPanicText, nil) {
+		t.Fatal("should fingerprint the panic")
+	}
+	if stderr.String() != "starting\n"+testPanicText {
+		t.Fatalf("bad: %q", stderr.String())
+	}
+}
+
+func TestReplay_dump(t *testing.T) {
+	var dump *Dump
+	c := &WrapConfig{
+		Handler:     func(string) { t.Fatal("shouldn't handle dumps as panics") },
+		DumpHandler: func(d *Dump) { dump = d },
+		Writer:      new(bytes.Buffer),
+	}
+
+	text := "SIGQUIT: quit\nPC=0x0 m=0 sigcode=0\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:10 +0x1d\n"
+	if err := Replay(strings.NewReader(text), c); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if dump == nil || len(dump.Goroutines) != 1 {
+		t.Fatalf("bad: %#v", dump)
+	}
+}
+
+func TestReplay_noPanic(t *testing.T) {
+	c := &WrapConfig{
+		Handler: func(string) { t.Fatal("shouldn't be called") },
+		Writer:  new(bytes.Buffer),
+	}
+
+	if err := Replay(strings.NewReader("all good\n"), c); err != ErrNoPanic {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package panicwrap
+
+import (
+	"fmt"
+)
+
+// RequestInfo is the HTTP request or gRPC call a child was serving when it recovered
+// from a panic. See PanicInfo.Request.
+type RequestInfo struct {
+	// Method is the HTTP method, or the full name of the gRPC method,
+	// such as "/pkg.Service/Method".
+	Method     string `json:"method"`
+	URL        string `json:"url,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// Metadata is the metadata of a gRPC call, without its credentials.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type recoveredMessage struct {
+	Text    string       `json:"text"`
+	Request *RequestInfo `json:"request,omitempty"`
+}
+
+// ReportRecovered reports a panic that the child recovered from to the
+// parent, which handles it the way it handles a crash of the child: it is
+// analyzed, mirrored and passed to PanicWriter, the logs and the handlers,
+// marked as Recovered. It doesn't restart the child. v is the value that
+// was recovered, and stack is the stack of the goroutine that panicked, as
+// runtime/debug.Stack returns it when called from the deferred function.
+// The request, if any, is the HTTP request or gRPC call that was being
+// served.
+//
+// It is meant to be called from the child and returns ErrNoControl if
+// there is no control channel to the parent. The panicwraphttp and
+// panicwrapgrpc packages call it for the panics of HTTP and gRPC handlers.
+func ReportRecovered(v interface{}, stack []byte, req *RequestInfo) error {
+	return sendControl(messageRecovered, recoveredMessage{Text: recoveredText(v, stack), Request: req})
+}
+
+// recoveredText returns the text of a recovered panic in the form the
+// runtime prints panics in.
+func recoveredText(v interface{}, stack []byte) string {
+	return fmt.Sprintf("panic: %v [recovered]\n\n%s", v, stack)
+}
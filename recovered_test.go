@@ -0,0 +1,39 @@
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReportRecovered_noControl(t *testing.T) {
+	if err := ReportRecovered("boom", nil, nil); err != ErrNoControl {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestRecoveredText(t *testing.T) {
+	text := recoveredText("boom", []byte("goroutine 1 [running]:\nmain.main()\n"))
+	if text != "panic: boom [recovered]\n\ngoroutine 1 [running]:\nmain.main()\n" {
+		t.Fatalf("bad: %q", text)
+	}
+	if values := parseValues(text, latestQuirks); len(values) != 1 || values[0] != "boom" {
+		t.Fatalf("bad: %#v", values)
+	}
+}
+
+func TestPanicWrap_recovered(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("recovered")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	out := stdout.String()
+	if !strings.Contains(out, "still running\n") || !strings.Contains(out, "panic true boom GET /boom\n") {
+		t.Fatalf("bad: %#v", out)
+	}
+}
@@ -0,0 +1,175 @@
+package panicwrap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ReloadFunc is the type called to reload the configuration of a running
+// Wrap. See WrapConfig.Reload.
+type ReloadFunc func() (*WrapConfig, error)
+
+// Reload makes the running Wrap call WrapConfig.Reload and switch to the
+// configuration it returns, as SIGHUP does. The children keep running.
+func Reload() error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+	if ch.reload == nil {
+		return errors.New("panicwrap: Reload isn't set")
+	}
+
+	return ch.reload()
+}
+
+// reloader holds the parts of the configuration of a running Wrap that a
+// reload switches.
+type reloader struct {
+	c *WrapConfig
+
+	mu      sync.Mutex
+	restart *RestartPolicy
+	detect  time.Duration
+
+	// panics is the PanicWriter and log the Log of the configuration.
+	panics *swapWriter
+	log    *logWriter
+}
+
+func newReloader(c *WrapConfig) *reloader {
+	return &reloader{c: c, restart: c.Restart, detect: c.DetectDuration}
+}
+
+// config returns the configuration to run the next child with.
+func (r *reloader) config() *WrapConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := *r.c
+	c.Restart = r.restart
+	c.DetectDuration = r.detect
+	return &c
+}
+
+// reload calls WrapConfig.Reload and switches to what it returns. Nothing
+// is switched if it fails or the configuration is invalid.
+func (r *reloader) reload() error {
+	c, err := r.c.Reload()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return errors.New("panicwrap: Reload returned no configuration")
+	}
+	if r.c.Handler == nil && r.c.InfoHandler == nil && c.PanicWriter == nil && len(c.PanicSinks) == 0 && r.c.DigestHandler == nil && len(r.c.HandlerCommands) == 0 {
+		return errors.New("panicwrap: handler must be set")
+	}
+	if c.Log != nil && c.Log.Path == "" {
+		return errors.New("panicwrap: Log.Path must be set")
+	}
+	if c.DetectDuration < 0 {
+		return fmt.Errorf("panicwrap: DetectDuration must not be negative, got %s", c.DetectDuration)
+	}
+	if err := validateRestart(c.Restart); err != nil {
+		return fmt.Errorf("panicwrap: %w", err)
+	}
+	if c.DetectDuration == 0 {
+		c.DetectDuration = 300 * time.Millisecond
+	}
+
+	if err := r.log.open(c.Log); err != nil {
+		return err
+	}
+	r.panics.swap(panicOutput(c))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restart = c.Restart
+	r.detect = c.DetectDuration
+	debugf(r.c, "reloaded the configuration")
+	return nil
+}
+
+// panicOutput returns the writer for the PanicWriter and PanicSinks of
+// the configuration.
+func panicOutput(c *WrapConfig) io.Writer {
+	if len(c.PanicSinks) == 0 {
+		return c.PanicWriter
+	}
+
+	sinks := c.PanicSinks
+	if c.PanicWriter != nil {
+		sinks = append([]Sink{{Writer: c.PanicWriter, OnError: ErrorIgnore}}, sinks...)
+	}
+
+	return newTee(sinks)
+}
+
+// swapWriter writes to a writer that can be switched while it is in use.
+// Writes go nowhere while it has none.
+type swapWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *swapWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return len(p), nil
+	}
+
+	return s.w.Write(p)
+}
+
+func (s *swapWriter) swap(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w = w
+}
+
+// logWriter is the log file of WrapConfig.Log, which a reload can switch
+// to another one or turn off.
+type logWriter struct {
+	mu sync.Mutex
+	f  *rotatingFile
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return len(p), nil
+	}
+
+	return l.f.Write(p)
+}
+
+// open switches to the log file of the given configuration, or to none if
+// it is nil. The current log file is closed once the new one is open,
+// which is reopened even if it has the same path.
+func (l *logWriter) open(config *LogConfig) error {
+	var f *rotatingFile
+	if config != nil {
+		var err error
+		if f, err = openRotatingFile(config); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f = f
+	return nil
+}
+
+func (l *logWriter) Close() error {
+	return l.open(nil)
+}
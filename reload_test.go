@@ -0,0 +1,74 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReload_notWrapping(t *testing.T) {
+	if err := Reload(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	panics := new(bytes.Buffer)
+	var next *WrapConfig
+	c := &WrapConfig{
+		Handler: func(string) {},
+		Restart: &RestartPolicy{MaxRestarts: 1},
+		Reload: func() (*WrapConfig, error) {
+			if next == nil {
+				return nil, errors.New("broken")
+			}
+			return next, nil
+		},
+	}
+	setDefaults(c)
+
+	r := newReloader(c)
+	r.panics = new(swapWriter)
+	r.log = new(logWriter)
+	defer r.log.Close()
+
+	if err := r.reload(); err == nil {
+		t.Fatal("should error")
+	}
+	if got := r.config(); got.Restart != c.Restart || got.DetectDuration != c.DetectDuration {
+		t.Fatalf("shouldn't change: %#v", got)
+	}
+
+	next = &WrapConfig{
+		PanicWriter: panics,
+		Restart:     &RestartPolicy{Always: true},
+		Log:         &LogConfig{Path: filepath.Join(dir, "app.log")},
+	}
+	if err := r.reload(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	got := r.config()
+	if got.Restart != next.Restart || got.DetectDuration != 300*time.Millisecond {
+		t.Fatalf("bad: %#v", got)
+	}
+
+	r.panics.Write([]byte("panic: boom\n"))
+	r.log.Write([]byte("output\n"))
+	if panics.String() != "panic: boom\n" {
+		t.Fatalf("bad: %#v", panics.String())
+	}
+	if data, _ := os.ReadFile(next.Log.Path); string(data) != "output\n" {
+		t.Fatalf("bad: %#v", string(data))
+	}
+
+	// A log file without a path is rejected.
+	next = &WrapConfig{Log: &LogConfig{}}
+	if err := r.reload(); err == nil {
+		t.Fatal("should error")
+	}
+}
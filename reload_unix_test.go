@@ -0,0 +1,25 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPanicWrap_reload(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("reload", t.TempDir())
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err == nil {
+		t.Fatal("should exit with the status of the child")
+	}
+
+	// The panic goes to the PanicWriter of the reloaded configuration.
+	if !strings.Contains(stdout.String(), "panic: boom") {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+}
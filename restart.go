@@ -0,0 +1,330 @@
+package panicwrap
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RestartPolicy configures how the parent re-executes the child after it
+// exits with a non-zero status, or after any exit for a service that must
+// keep running. It is only used if WrapConfig.Restart is set. The child
+// is never restarted after the parent itself received one of the
+// IgnoreSignals, or forwarded SIGINT, SIGTERM or os.Kill, since that
+// means someone asked the program to stop.
+type RestartPolicy struct {
+	// The maximum number of times the child is restarted. If this is
+	// zero, the child is restarted forever.
+	MaxRestarts int
+
+	// The delay before the first restart. It doubles after every restart
+	// up to MaxBackoff. Defaults to 1 second.
+	Backoff time.Duration
+
+	// The maximum delay between restarts. Defaults to 1 minute.
+	MaxBackoff time.Duration
+
+	// ResetAfter, if set, is how long the child must have run for the
+	// parent to consider it healthy again when it exits: the count of
+	// restarts, which MaxRestarts and the backoff go by, starts over,
+	// and so does PanicInfo.SinceFirstCrash. Otherwise they keep counting
+	// for as long as the parent runs.
+	ResetAfter time.Duration
+
+	// If true, the child is also restarted after it exited cleanly, so
+	// that the parent keeps the program running like a minimal init.
+	Always bool
+
+	// If set, the child is only restarted after it exited with one of
+	// these statuses, which may include 0. Use -1 for a child that was
+	// killed by a signal, or 128+N with WrapConfig.SignalExitStatus.
+	ExitStatuses []int
+
+	// SafeMode, if set, restarts the child in safe mode once it keeps
+	// crashing the same way. The decision is recorded in
+	// PanicInfo.SafeMode. See SafeModeConfig.
+	SafeMode *SafeModeConfig
+}
+
+// restartsOn returns whether the policy restarts a child that exited with
+// the given status.
+func (p *RestartPolicy) restartsOn(status int) bool {
+	if p == nil {
+		return false
+	}
+
+	if len(p.ExitStatuses) > 0 {
+		for _, s := range p.ExitStatuses {
+			if s == status {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return status != 0 || p.Always
+}
+
+// allow returns whether another restart is allowed after the given number
+// of restarts have already happened.
+func (p *RestartPolicy) allow(restarts int) bool {
+	if p == nil {
+		return false
+	}
+
+	return p.MaxRestarts == 0 || restarts < p.MaxRestarts
+}
+
+// healthy returns whether a child that ran for the given time was
+// healthy, so that the count of restarts starts over.
+func (p *RestartPolicy) healthy(ran time.Duration) bool {
+	return p != nil && p.ResetAfter > 0 && ran >= p.ResetAfter
+}
+
+// delay returns how long to wait before the next restart after the given
+// number of restarts have already happened.
+func (p *RestartPolicy) delay(restarts int) time.Duration {
+	d := p.Backoff
+	if d == 0 {
+		d = time.Second
+	}
+
+	max := p.MaxBackoff
+	if max == 0 {
+		max = time.Minute
+	}
+
+	for i := 0; i < restarts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	return d
+}
+
+// child tracks the currently running child process so that signals can
+// be delivered to it across restarts.
+type child struct {
+	sync.Mutex
+	proc    Process
+	stopped bool
+
+	// dumpWaiters are waiting for the next goroutine dump. See
+	// DumpStacks.
+	dumpWaiters []chan *Dump
+
+	// profiles are the profile request pipes of the running child, if
+	// WrapConfig.ProfileDir is set. profileMu serializes requests.
+	profiles  *profilePipes
+	profileMu sync.Mutex
+
+	// control is the control channel of the running child, if
+	// WrapConfig.Control is set.
+	control *parentControl
+
+	// restartNow makes the next exit of the child restart it regardless
+	// of the policy, and lastCrash is the text of the last panic. See
+	// WrapConfig.CommandSocket.
+	restartNow bool
+	lastCrash  string
+
+	// inject handles a panic that didn't come from the child. It is set
+	// once before the first child starts. See InjectCrash.
+	inject func(*PanicInfo) error
+
+	// drain flushes the output of the child. It is set once before the
+	// first child starts. See Drain.
+	drain func(timeout time.Duration) error
+
+	// term is the terminal of the parent, if the child runs on a
+	// pseudo-terminal. It is set once before the first child starts. See
+	// WrapConfig.Terminal.
+	term *terminal
+
+	// index is the index of the worker this child runs as, and workers
+	// are all workers, if the parent runs several. They are only set on
+	// the first worker. See WrapConfig.Workers.
+	index   int
+	workers []*child
+
+	// next is the child that Upgrade started to take over from this one,
+	// which signals reach as well, and takeover delivers its outcome once
+	// it does. See Upgrade.
+	next     *child
+	takeover chan childRun
+
+	// ready is closed once a child that Upgrade started calls Ready, and
+	// abandoned is set once it is no longer wanted.
+	ready     chan struct{}
+	abandoned bool
+
+	// upgrade is Upgrade for a single worker, and reload is Reload if
+	// WrapConfig.Reload is set. They are set once before the first child
+	// starts.
+	upgrade func(w *child, timeout time.Duration) error
+	reload  func() error
+
+	// bench is Benchmark with the configuration of the Wrap call, which
+	// records the results in stats. It is set once before the first
+	// child starts.
+	bench func(c *BenchConfig) ([]BenchResult, error)
+
+	// stats gathers the statistics of the Wrap call. It is set once
+	// before the first child starts, on every worker and on the children
+	// that Upgrade starts. See Stats.
+	stats *wrapStats
+
+	// budget is the WrapConfig.MemoryBudget that all workers share, if
+	// any. It is set along with stats.
+	budget *memoryBudget
+
+	// safeMode tracks whether the children run in safe mode, for all
+	// workers. It is set along with stats. See RestartPolicy.SafeMode.
+	safeMode *safeMode
+}
+
+func (c *child) set(p Process) {
+	c.Lock()
+	defer c.Unlock()
+	c.proc = p
+	if p != nil && c.abandoned {
+		p.Signal(os.Kill)
+	}
+}
+
+// signal forwards the signal to the running child, if there is one, and
+// marks the child as stopping if the signal asks it to stop.
+func (c *child) signal(s os.Signal) {
+	c.Lock()
+	defer c.Unlock()
+	if slices.Contains(stopSignals, s) {
+		c.stopped = true
+	}
+	if c.proc != nil {
+		c.proc.Signal(s)
+	}
+	if c.next != nil {
+		c.next.signal(s)
+	}
+}
+
+// send sends the signal to the running child without marking it as
+// stopping.
+func (c *child) send(s os.Signal) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.proc == nil {
+		return errors.New("no child is running")
+	}
+
+	return c.proc.Signal(s)
+}
+
+// with calls the function with the running child.
+func (c *child) with(f func(Process) error) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.proc == nil {
+		return errors.New("no child is running")
+	}
+
+	return f(c.proc)
+}
+
+// waitDump returns a channel on which the next goroutine dump the child
+// prints is delivered.
+func (c *child) waitDump() <-chan *Dump {
+	c.Lock()
+	defer c.Unlock()
+	ch := make(chan *Dump, 1)
+	c.dumpWaiters = append(c.dumpWaiters, ch)
+	return ch
+}
+
+// deliverDump passes the dump to everyone waiting for one.
+func (c *child) deliverDump(d *Dump) {
+	c.Lock()
+	defer c.Unlock()
+	for _, ch := range c.dumpWaiters {
+		ch <- d
+	}
+	c.dumpWaiters = nil
+}
+
+func (c *child) setProfiles(p *profilePipes) {
+	c.Lock()
+	defer c.Unlock()
+	c.profiles = p
+}
+
+// captureProfiles asks the running child to write its profiles and
+// returns their paths.
+func (c *child) captureProfiles(timeout time.Duration) (map[string]string, error) {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+
+	c.Lock()
+	p := c.profiles
+	c.Unlock()
+	if p == nil {
+		return nil, errors.New("panicwrap: the child isn't profiling")
+	}
+
+	if err := p.reply.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := p.req.Write([]byte{0}); err != nil {
+		return nil, err
+	}
+	if _, err := p.reply.Read(make([]byte, 1)); err != nil {
+		return nil, err
+	}
+
+	return readProfiles(p.dir, p.pid), nil
+}
+
+// stop marks the child as stopping so that it isn't restarted.
+func (c *child) stop() {
+	c.Lock()
+	defer c.Unlock()
+	c.stopped = true
+}
+
+// requestRestart makes the next exit of the child restart it.
+func (c *child) requestRestart() {
+	c.Lock()
+	defer c.Unlock()
+	c.restartNow = true
+}
+
+// takeRestart returns whether a restart was requested and resets it.
+func (c *child) takeRestart() bool {
+	c.Lock()
+	defer c.Unlock()
+	r := c.restartNow
+	c.restartNow = false
+	return r
+}
+
+func (c *child) setLastCrash(text string) {
+	c.Lock()
+	defer c.Unlock()
+	c.lastCrash = text
+}
+
+func (c *child) lastCrashText() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.lastCrash
+}
+
+func (c *child) stopping() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.stopped
+}
@@ -0,0 +1,92 @@
+package panicwrap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRestartPolicy_allow(t *testing.T) {
+	var nilPolicy *RestartPolicy
+	if nilPolicy.allow(0) {
+		t.Fatal("nil policy should not allow restarts")
+	}
+
+	p := &RestartPolicy{MaxRestarts: 2}
+	if !p.allow(1) {
+		t.Fatal("should allow")
+	}
+	if p.allow(2) {
+		t.Fatal("should not allow")
+	}
+
+	p = &RestartPolicy{}
+	if !p.allow(1000) {
+		t.Fatal("should allow forever")
+	}
+}
+
+func TestRestartPolicy_delay(t *testing.T) {
+	p := &RestartPolicy{
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	}
+
+	cases := []struct {
+		restarts int
+		expected time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{2, 40 * time.Millisecond},
+		{3, 50 * time.Millisecond},
+		{100, 50 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		if d := p.delay(tc.restarts); d != tc.expected {
+			t.Fatalf("restarts %d: %s != %s", tc.restarts, d, tc.expected)
+		}
+	}
+}
+
+func TestRestartPolicy_restartsOn(t *testing.T) {
+	var nilPolicy *RestartPolicy
+	if nilPolicy.restartsOn(1) {
+		t.Fatal("nil policy should not restart")
+	}
+
+	cases := []struct {
+		policy   RestartPolicy
+		status   int
+		expected bool
+	}{
+		{RestartPolicy{}, 2, true},
+		{RestartPolicy{}, 0, false},
+		{RestartPolicy{Always: true}, 0, true},
+		{RestartPolicy{ExitStatuses: []int{0, 75}}, 0, true},
+		{RestartPolicy{ExitStatuses: []int{0, 75}}, 75, true},
+		{RestartPolicy{ExitStatuses: []int{0, 75}}, 2, false},
+	}
+	for _, tc := range cases {
+		if tc.policy.restartsOn(tc.status) != tc.expected {
+			t.Fatalf("%#v, %d: should be %t", tc.policy, tc.status, tc.expected)
+		}
+	}
+}
+
+func TestWrap_restartAlways(t *testing.T) {
+	e := &fakeExecutor{}
+	_, exitStatus, err := Wrap(&WrapConfig{
+		Handler:  func(string) { t.Fatal("shouldn't be called") },
+		Writer:   new(bytes.Buffer),
+		Restart:  &RestartPolicy{MaxRestarts: 2, Backoff: time.Millisecond, Always: true},
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if e.started != 3 || exitStatus != 0 {
+		t.Fatalf("bad: %d, %d", e.started, exitStatus)
+	}
+}
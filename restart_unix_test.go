@@ -0,0 +1,46 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// usr1Executor starts a first child that the parent forwards SIGUSR1 to,
+// and which exits once it got it.
+type usr1Executor struct {
+	signaledExecutor
+	started int
+}
+
+func (e *usr1Executor) Start(cmd *exec.Cmd) (Process, error) {
+	e.started++
+	if e.started > 1 {
+		return (&fakeExecutor{}).Start(cmd)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	return &signaledProcess{e: &e.signaledExecutor}, nil
+}
+
+func TestWrap_forwardedSignalRestarts(t *testing.T) {
+	e := &usr1Executor{signaledExecutor: signaledExecutor{signals: make(chan os.Signal, 1)}}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:        func(string) {},
+		Writer:         new(bytes.Buffer),
+		Executor:       e,
+		ForwardSignals: []os.Signal{syscall.SIGUSR1},
+		Restart:        &RestartPolicy{MaxRestarts: 1, Backoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.started != 2 {
+		t.Fatalf("should still restart after a forwarded SIGUSR1: %d", e.started)
+	}
+}
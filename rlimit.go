@@ -0,0 +1,61 @@
+package panicwrap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RlimitInfinity is the value of an unlimited Rlimit.
+const RlimitInfinity = ^uint64(0)
+
+// Rlimit is a resource limit of the child. See WrapConfig.Rlimits.
+type Rlimit struct {
+	// Resource is the number of the resource on the platform, such as
+	// syscall.RLIMIT_CORE, syscall.RLIMIT_NOFILE, syscall.RLIMIT_AS or
+	// unix.RLIMIT_NPROC.
+	Resource int
+
+	// The soft and hard limits. Raising the hard limit requires
+	// privileges.
+	Cur uint64
+	Max uint64
+}
+
+// rlimitEnvKey passes WrapConfig.Rlimits to the child, which applies
+// them to itself.
+const rlimitEnvKey = "PANICWRAP_RLIMITS"
+
+func encodeRlimits(limits []Rlimit) string {
+	parts := make([]string, len(limits))
+	for i, l := range limits {
+		parts[i] = fmt.Sprintf("%d:%d:%d", l.Resource, l.Cur, l.Max)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func decodeRlimits(s string) ([]Rlimit, error) {
+	var limits []Rlimit
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("panicwrap: invalid rlimit %q", part)
+		}
+
+		var l Rlimit
+		var err error
+		if l.Resource, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, err
+		}
+		if l.Cur, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return nil, err
+		}
+		if l.Max, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+			return nil, err
+		}
+		limits = append(limits, l)
+	}
+
+	return limits, nil
+}
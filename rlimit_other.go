@@ -0,0 +1,7 @@
+//go:build !unix
+
+package panicwrap
+
+func startRlimits() error {
+	return nil
+}
@@ -0,0 +1,42 @@
+package panicwrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRlimits(t *testing.T) {
+	limits := []Rlimit{
+		{Resource: 4, Cur: RlimitInfinity, Max: RlimitInfinity},
+		{Resource: 7, Cur: 1024, Max: 4096},
+	}
+
+	actual, err := decodeRlimits(encodeRlimits(limits))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, limits) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if _, err := decodeRlimits("4:1"); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestWrap_rlimits(t *testing.T) {
+	e := &fakeExecutor{}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:  func(string) {},
+		Rlimits:  []Rlimit{{Resource: 4, Cur: 0, Max: 0}},
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := rlimitEnvKey + "=4:0:0"
+	if env := e.cmd.Env; env[len(env)-1] != expected {
+		t.Fatalf("bad: %#v", env)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+)
+
+// startRlimits applies the resource limits the parent passed to the
+// child.
+func startRlimits() error {
+	s := os.Getenv(rlimitEnvKey)
+	if s == "" {
+		return nil
+	}
+	os.Unsetenv(rlimitEnvKey)
+
+	limits, err := decodeRlimits(s)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range limits {
+		var r syscall.Rlimit
+		r.Cur = rlimitValue(l.Cur, r.Cur)
+		r.Max = rlimitValue(l.Max, r.Max)
+		if err := syscall.Setrlimit(l.Resource, &r); err != nil {
+			return fmt.Errorf("panicwrap: setting rlimit %d: %w", l.Resource, err)
+		}
+	}
+
+	return nil
+}
+
+// rlimitValue converts a limit to the type syscall.Rlimit uses on the
+// platform, which is signed on some BSDs. Values that don't fit, such as
+// RlimitInfinity, are infinite there too.
+func rlimitValue[T int64 | uint64](v uint64, _ T) T {
+	if T(v) < 0 {
+		return math.MaxInt64
+	}
+	return T(v)
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestStartRlimits(t *testing.T) {
+	var orig syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &orig); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &orig)
+
+	cur := uint64(orig.Cur) - 1
+	limit := strconv.Itoa(syscall.RLIMIT_NOFILE) + ":" + strconv.FormatUint(cur, 10) + ":" + strconv.FormatUint(uint64(orig.Max), 10)
+	t.Setenv(rlimitEnvKey, limit)
+
+	if err := startRlimits(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &actual); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if uint64(actual.Cur) != cur {
+		t.Fatalf("bad: %d", actual.Cur)
+	}
+	if _, ok := os.LookupEnv(rlimitEnvKey); ok {
+		t.Fatal("should unset the variable")
+	}
+}
@@ -0,0 +1,170 @@
+package panicwrap
+
+import (
+	"os"
+	"time"
+)
+
+// RSSAction is what the watchdog of WrapConfig.RSSWatchdog does once the
+// child grows past RSSConfig.MaxRSS.
+type RSSAction int
+
+const (
+	// RSSNotify passes the RSSAlert to WrapConfig.RSSHandler and leaves
+	// the child running.
+	RSSNotify RSSAction = iota
+
+	// RSSRestart also asks the child for a goroutine dump, which makes
+	// it exit, and restarts it regardless of WrapConfig.Restart. The
+	// dump is attached to the alert, and passed to DumpHandler as usual.
+	RSSRestart
+)
+
+// rssDumpTimeout is how long the watchdog waits for the goroutine dump of
+// RSSRestart.
+const rssDumpTimeout = 10 * time.Second
+
+// RSSConfig has the memory watchdog of the parent, which polls the
+// resident set size of the child and acts once it grows past a threshold,
+// so that a runaway child is caught with its diagnostics before the
+// kernel kills it for running out of memory. This is supported on Linux,
+// where the size comes from procfs, and on Windows.
+type RSSConfig struct {
+	// MaxRSS is the resident set size in bytes past which the watchdog
+	// acts. It must be set.
+	MaxRSS int64
+
+	// Interval is how often the size is polled. Defaults to 10 seconds.
+	Interval time.Duration
+
+	// Action is what the watchdog does. Defaults to RSSNotify.
+	Action RSSAction
+}
+
+// RSSAlert is a child that grew past RSSConfig.MaxRSS. The watchdog acts
+// once per child, until its size falls below the threshold again.
+type RSSAlert struct {
+	// RSS is the resident set size of the child in bytes.
+	RSS int64
+
+	// Profiles are the paths of the profiles the child wrote right
+	// then, if WrapConfig.ProfileDir is set, such as its heap profile.
+	// See CaptureProfiles.
+	Profiles map[string]string
+
+	// Dump is the goroutine dump of the child, for RSSRestart, unless it
+	// didn't print one in time.
+	Dump *Dump
+
+	// PID is the process ID of the child, Worker the index of its worker
+	// and Time when the parent found it past the threshold.
+	PID    int
+	Worker int
+	Time   time.Time
+}
+
+// RSSHandlerFunc is the type called when the child grows past
+// RSSConfig.MaxRSS.
+type RSSHandlerFunc func(*RSSAlert)
+
+// rssWatcher polls the size of the children of an RSSConfig.
+type rssWatcher struct {
+	c    *WrapConfig
+	r    *RSSConfig
+	ch   *child
+	quit chan struct{}
+	done chan struct{}
+
+	// alerted has the process ID of the child of each worker that the
+	// watchdog acted on.
+	alerted map[*child]int
+}
+
+// startRSSWatcher starts polling the size of the child until stop is
+// called.
+func startRSSWatcher(c *WrapConfig, ch *child) *rssWatcher {
+	w := &rssWatcher{c: c, r: c.RSSWatchdog, ch: ch, quit: make(chan struct{}), done: make(chan struct{}), alerted: make(map[*child]int)}
+	go w.run()
+	return w
+}
+
+func (w *rssWatcher) run() {
+	defer close(w.done)
+	interval := w.r.Interval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	for {
+		select {
+		case <-w.c.Clock.After(interval):
+		case <-w.quit:
+			return
+		}
+		w.check()
+	}
+}
+
+// check polls the size of every worker and acts on those past the
+// threshold.
+func (w *rssWatcher) check() {
+	w.ch.each(func(wk *child) {
+		pid := 0
+		wk.with(func(p Process) error {
+			pid = p.Pid()
+			return nil
+		})
+		if pid == 0 {
+			return
+		}
+
+		rss, err := readRSS(pid)
+		if err != nil {
+			debugf(w.c, "reading the size of child %d: %s", pid, err)
+			return
+		}
+		if rss <= w.r.MaxRSS {
+			delete(w.alerted, wk)
+			return
+		}
+		if w.alerted[wk] == pid {
+			return
+		}
+		w.alerted[wk] = pid
+
+		debugf(w.c, "child %d grew to %d bytes", pid, rss)
+		w.alert(wk, &RSSAlert{RSS: rss, PID: pid, Worker: wk.index, Time: w.c.Clock.Now()})
+	})
+}
+
+// alert gathers the diagnostics of the child, restarts it if the action
+// asks for it, and passes the alert to WrapConfig.RSSHandler.
+func (w *rssWatcher) alert(wk *child, a *RSSAlert) {
+	if w.c.ProfileDir != "" {
+		if profiles, err := wk.captureProfiles(rssDumpTimeout); err == nil {
+			a.Profiles = profiles
+		}
+	}
+
+	if w.r.Action == RSSRestart {
+		dumpCh := wk.waitDump()
+		wk.requestRestart()
+		if err := wk.send(quitSignal); err != nil {
+			wk.send(os.Kill)
+		} else {
+			select {
+			case a.Dump = <-dumpCh:
+			case <-time.After(rssDumpTimeout):
+			}
+		}
+	}
+
+	if w.c.RSSHandler != nil {
+		w.c.RSSHandler(a)
+	}
+}
+
+// stop stops polling.
+func (w *rssWatcher) stop() {
+	close(w.quit)
+	<-w.done
+}
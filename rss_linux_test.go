@@ -0,0 +1,99 @@
+package panicwrap
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// selfProcess is a fakeProcess with the process ID of the test, so that
+// there is a real size to read.
+type selfProcess struct {
+	fakeProcess
+}
+
+func (p *selfProcess) Pid() int { return os.Getpid() }
+
+func TestReadRSS(t *testing.T) {
+	rss, err := readRSS(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if rss <= 0 {
+		t.Fatalf("bad: %d", rss)
+	}
+}
+
+func TestRSSWatcher(t *testing.T) {
+	clock := newFakeClock()
+	alerts := make(chan *RSSAlert, 2)
+	c := &WrapConfig{
+		Clock:       clock,
+		RSSWatchdog: &RSSConfig{MaxRSS: 1, Interval: time.Second},
+		RSSHandler:  func(a *RSSAlert) { alerts <- a },
+	}
+	e := new(fakeExecutor)
+	ch := &child{index: 3}
+	ch.set(&selfProcess{fakeProcess{e: e}})
+
+	w := startRSSWatcher(c, ch)
+	defer w.stop()
+	<-clock.waiting
+	clock.Advance(time.Second)
+	<-clock.waiting
+
+	a := <-alerts
+	if a.RSS <= 1 || a.PID != os.Getpid() || a.Worker != 3 || a.Dump != nil {
+		t.Fatalf("bad: %#v", a)
+	}
+	if len(e.signals) != 0 {
+		t.Fatalf("should leave the child running: %v", e.signals)
+	}
+
+	// The watchdog acts once per child.
+	clock.Advance(time.Second)
+	<-clock.waiting
+	select {
+	case a := <-alerts:
+		t.Fatalf("bad: %#v", a)
+	default:
+	}
+}
+
+func TestRSSWatcher_restart(t *testing.T) {
+	clock := newFakeClock()
+	alerts := make(chan *RSSAlert, 1)
+	c := &WrapConfig{
+		Clock:       clock,
+		RSSWatchdog: &RSSConfig{MaxRSS: 1, Action: RSSRestart},
+		RSSHandler:  func(a *RSSAlert) { alerts <- a },
+	}
+	e := new(fakeExecutor)
+	ch := new(child)
+	ch.set(&selfProcess{fakeProcess{e: e}})
+
+	w := startRSSWatcher(c, ch)
+	defer w.stop()
+	<-clock.waiting
+	clock.Advance(10 * time.Second)
+
+	// Play the child printing its dump.
+	for {
+		e.mu.Lock()
+		n := len(e.signals)
+		e.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ch.deliverDump(&Dump{Text: "SIGQUIT: quit"})
+
+	a := <-alerts
+	if a.Dump == nil || a.Dump.Text != "SIGQUIT: quit" {
+		t.Fatalf("bad: %#v", a)
+	}
+	if e.signals[0] != quitSignal || !ch.takeRestart() {
+		t.Fatalf("should restart the child: %v", e.signals)
+	}
+}
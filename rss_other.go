@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package panicwrap
+
+import "errors"
+
+func readRSS(int) (int64, error) {
+	return 0, errors.New("panicwrap: RSSWatchdog isn't supported on this platform")
+}
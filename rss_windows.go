@@ -0,0 +1,44 @@
+package panicwrap
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetProcessMemoryInfo = syscall.NewLazyDLL("psapi.dll").NewProc("GetProcessMemoryInfo")
+
+// processQueryLimitedInformation is the PROCESS_QUERY_LIMITED_INFORMATION
+// access right.
+const processQueryLimitedInformation = 0x1000
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+}
+
+// readRSS returns the working set size of the process in bytes, which is
+// what Windows has for its resident set size.
+func readRSS(pid int) (int64, error) {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(h)
+
+	var m processMemoryCounters
+	m.cb = uint32(unsafe.Sizeof(m))
+	if ok, _, err := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&m)), uintptr(m.cb)); ok == 0 {
+		return 0, err
+	}
+
+	return int64(m.workingSetSize), nil
+}
@@ -0,0 +1,70 @@
+package panicwrap
+
+import (
+	"context"
+)
+
+// Result is the outcome of the child supervised by Run. It is what Wrap
+// returns, for a parent that went on to supervise the child.
+type Result struct {
+	// ExitStatus is the exit status of the child, which the process
+	// should exit with once it is done.
+	ExitStatus int
+
+	// Err is the error of the wrapping, or the *HandlerPanicError of a
+	// handler that panicked.
+	Err error
+}
+
+// Run is Wrap for programs that run other long-running parts next to it
+// in the parent, such as with an errgroup.Group. It returns once it is
+// clear what this process is, and supervises the child on a goroutine of
+// its own, which sends the Result on the returned channel once it is
+// done and closes it.
+//
+// If this is the child, or Wrap wouldn't wrap here for another reason,
+// the channel is nil and the program should go on as usual. An error is
+// returned if the wrapping failed before the child started. If the
+// context is done first, the child is asked to shut down as with
+// Interrupt, and the Result comes once it did.
+//
+// Like Wrap, this should be called very early, and only once.
+func Run(ctx context.Context, c *WrapConfig) (<-chan Result, error) {
+	started := make(chan *child, 1)
+	done := make(chan Result, 1)
+	wrapped := make(chan bool, 1)
+	go func() {
+		ok, exitStatus, err := wrap(c, func(ch *child) { started <- ch })
+		wrapped <- ok
+		done <- Result{ExitStatus: exitStatus, Err: err}
+	}()
+
+	results := make(chan Result, 1)
+	select {
+	case ch := <-started:
+		go func() {
+			defer close(results)
+			select {
+			case r := <-done:
+				results <- r
+			case <-ctx.Done():
+				interruptChild(ch)
+				results <- <-done
+			}
+		}()
+
+		return results, nil
+	case ok := <-wrapped:
+		r := <-done
+		if !ok {
+			// In the child, the process goes on as usual.
+			return nil, r.Err
+		}
+
+		// The parent is done already, such as one that started a
+		// daemon.
+		results <- r
+		close(results)
+		return results, nil
+	}
+}
@@ -0,0 +1,89 @@
+package panicwrap
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// signaledExecutor starts processes that run until they get a signal.
+type signaledExecutor struct {
+	signals chan os.Signal
+}
+
+func (e *signaledExecutor) Start(cmd *exec.Cmd) (Process, error) {
+	return &signaledProcess{e: e}, nil
+}
+
+type signaledProcess struct {
+	e *signaledExecutor
+}
+
+func (p *signaledProcess) Pid() int { return 4242 }
+func (p *signaledProcess) Signal(s os.Signal) error {
+	p.e.signals <- s
+	return nil
+}
+func (p *signaledProcess) Wait() (ProcessExit, error) {
+	<-p.e.signals
+	return ProcessExit{Status: 1}, nil
+}
+
+func TestRun(t *testing.T) {
+	var text string
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+	results, err := Run(context.Background(), &WrapConfig{
+		Handler:  func(s string) { text = s },
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if results == nil {
+		t.Fatal("should supervise")
+	}
+
+	r, ok := <-results
+	if !ok || r.ExitStatus != 2 || r.Err != nil {
+		t.Fatalf("bad: %#v", r)
+	}
+	if text == "" {
+		t.Fatal("should handle the panic")
+	}
+	if _, ok := <-results; ok {
+		t.Fatal("should be closed")
+	}
+}
+
+func TestRun_cancel(t *testing.T) {
+	e := &signaledExecutor{signals: make(chan os.Signal, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := Run(ctx, &WrapConfig{
+		Handler:  func(string) {},
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+		Restart:  &RestartPolicy{},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cancel()
+	r := <-results
+	if r.ExitStatus != 1 || r.Err != nil {
+		t.Fatalf("bad: %#v", r)
+	}
+}
+
+func TestRun_invalid(t *testing.T) {
+	results, err := Run(context.Background(), &WrapConfig{Handler: func(string) {}, Workers: -1})
+	if err == nil || results != nil {
+		t.Fatalf("bad: %v, %v", results, err)
+	}
+}
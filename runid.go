@@ -0,0 +1,25 @@
+package panicwrap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+// runIDEnvKey passes the run ID of the child to it. See RunID.
+const runIDEnvKey = "PANICWRAP_RUN_ID"
+
+// RunID returns the ID the parent gave this start of the child, which is
+// new for every start, including restarts, and is the RunID of its
+// PanicInfo. Logging it ties the logs of a run to its crash report and to
+// the restart that followed. It is empty if the process isn't wrapped.
+func RunID() string {
+	return os.Getenv(runIDEnvKey)
+}
+
+// newRunID returns a new random run ID.
+func newRunID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,41 @@
+package panicwrap
+
+import (
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRunID_notWrapped(t *testing.T) {
+	if id := RunID(); id != "" {
+		t.Fatalf("bad: %q", id)
+	}
+}
+
+func TestWrap_runID(t *testing.T) {
+	var ids []string
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(info *PanicInfo) { ids = append(ids, info.RunID) },
+		Writer:      io.Discard,
+		Executor:    e,
+		Restart:     &RestartPolicy{MaxRestarts: 1, Backoff: time.Millisecond},
+		IgnoreEnv:   true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Every start gets an ID of its own, which the child is given.
+	if len(ids) != 2 || ids[0] == "" || ids[0] == ids[1] {
+		t.Fatalf("bad: %q", ids)
+	}
+	if !slices.Contains(e.cmd.Env, runIDEnvKey+"="+ids[1]) {
+		t.Fatal("should pass it to the child")
+	}
+}
@@ -0,0 +1,144 @@
+package panicwrap
+
+import (
+	"sync"
+	"time"
+)
+
+// SafeModeConfig configures the safe mode of RestartPolicy.SafeMode: once
+// the child crashed the same way After times within Window, it is
+// restarted with a marker that tells it to run without the subsystem
+// that crashes, so that a crash loop turns into a degraded service that
+// stays up.
+type SafeModeConfig struct {
+	// After is how many crashes with the same fingerprint within Window
+	// put the child in safe mode. Defaults to 3.
+	After int
+
+	// The window of After. Defaults to 10 minutes.
+	Window time.Duration
+
+	// Env is the environment variable that the children in safe mode get,
+	// set to the fingerprint of the crashes that put them in it. Defaults
+	// to PANICWRAP_SAFE_MODE.
+	Env string
+
+	// Args, if set, are added to the arguments of the children in safe
+	// mode.
+	Args []string
+
+	// Duration, if set, is how long safe mode lasts, after which the next
+	// child runs normally again, to see whether what crashed recovered.
+	// Otherwise the children run in safe mode until the parent exits.
+	Duration time.Duration
+}
+
+// SafeModeInfo is the safe mode the child is restarted in after a crash.
+// See RestartPolicy.SafeMode.
+type SafeModeInfo struct {
+	// Fingerprint is that of the crashes that put the child in safe mode.
+	Fingerprint string `json:"fingerprint"`
+
+	// Since is when the child was put in safe mode.
+	Since time.Time `json:"since"`
+
+	// Entered is whether this crash put the child in safe mode, rather
+	// than the child having run in it already.
+	Entered bool `json:"entered"`
+}
+
+// safeModeEnvKey is the default SafeModeConfig.Env.
+const safeModeEnvKey = "PANICWRAP_SAFE_MODE"
+
+// safeMode tracks the crashes of the children of a Wrap call by their
+// fingerprints, and whether they run in safe mode. It is shared by the
+// workers, since they run the same code.
+type safeMode struct {
+	mu      sync.Mutex
+	crashes map[string][]time.Time
+
+	// active is the safe mode the children run in, or nil.
+	active *SafeModeInfo
+}
+
+func newSafeMode() *safeMode {
+	return &safeMode{crashes: make(map[string][]time.Time)}
+}
+
+// record notes a crash with the fingerprint, and returns the safe mode
+// that the next child runs in, or nil if it runs normally.
+func (s *safeMode) record(c *SafeModeConfig, fp string, now time.Time) *SafeModeInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window := c.Window
+	if window == 0 {
+		window = 10 * time.Minute
+	}
+	after := c.After
+	if after == 0 {
+		after = 3
+	}
+
+	for k, times := range s.crashes {
+		for len(times) > 0 && now.Sub(times[0]) > window {
+			times = times[1:]
+		}
+		if len(times) == 0 {
+			delete(s.crashes, k)
+		} else {
+			s.crashes[k] = times
+		}
+	}
+	s.crashes[fp] = append(s.crashes[fp], now)
+
+	s.expire(c, now)
+	if s.active != nil {
+		info := *s.active
+		return &info
+	}
+	if len(s.crashes[fp]) < after {
+		return nil
+	}
+
+	// The crashes that put the child in safe mode don't count towards
+	// the next time, once it expired.
+	delete(s.crashes, fp)
+	s.active = &SafeModeInfo{Fingerprint: fp, Since: now}
+	info := *s.active
+	info.Entered = true
+	return &info
+}
+
+// fingerprint returns the fingerprint of the crashes that put the child
+// in safe mode, or "" if a child started now runs normally.
+func (s *safeMode) fingerprint(c *SafeModeConfig, now time.Time) string {
+	if s == nil || c == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(c, now)
+	if s.active == nil {
+		return ""
+	}
+	return s.active.Fingerprint
+}
+
+// expire leaves safe mode once its Duration is over.
+func (s *safeMode) expire(c *SafeModeConfig, now time.Time) {
+	if s.active != nil && c.Duration > 0 && now.Sub(s.active.Since) >= c.Duration {
+		s.active = nil
+	}
+}
+
+// safeModeMarker adds the marker of safe mode to the environment and the
+// arguments of a child.
+func safeModeMarker(c *SafeModeConfig, fp string, env, args []string) ([]string, []string) {
+	key := c.Env
+	if key == "" {
+		key = safeModeEnvKey
+	}
+	return append(env, key+"="+fp), append(args, c.Args...)
+}
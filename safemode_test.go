@@ -0,0 +1,82 @@
+package panicwrap
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSafeMode_record(t *testing.T) {
+	s := newSafeMode()
+	c := &SafeModeConfig{After: 2, Window: time.Minute, Duration: time.Hour}
+	now := time.Now()
+
+	if info := s.record(c, "a", now); info != nil {
+		t.Fatalf("bad: %#v", info)
+	}
+	if info := s.record(c, "b", now); info != nil {
+		t.Fatalf("should count the fingerprints apart: %#v", info)
+	}
+	if info := s.record(c, "a", now.Add(2*time.Minute)); info != nil {
+		t.Fatalf("should forget the crashes out of the window: %#v", info)
+	}
+
+	info := s.record(c, "a", now.Add(2*time.Minute+time.Second))
+	if info == nil || !info.Entered || info.Fingerprint != "a" {
+		t.Fatalf("should enter safe mode: %#v", info)
+	}
+	if fp := s.fingerprint(c, now.Add(3*time.Minute)); fp != "a" {
+		t.Fatalf("bad: %q", fp)
+	}
+	if info := s.record(c, "b", now.Add(3*time.Minute)); info == nil || info.Entered || info.Fingerprint != "a" {
+		t.Fatalf("should stay in safe mode: %#v", info)
+	}
+
+	if fp := s.fingerprint(c, now.Add(2*time.Hour)); fp != "" {
+		t.Fatalf("should leave safe mode after its Duration: %q", fp)
+	}
+	if info := s.record(c, "a", now.Add(2*time.Hour)); info != nil {
+		t.Fatalf("should count again: %#v", info)
+	}
+}
+
+func TestWrap_safeMode(t *testing.T) {
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+	var infos []*PanicInfo
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { infos = append(infos, i) },
+		Writer:      new(bytes.Buffer),
+		Executor:    e,
+		Restart: &RestartPolicy{
+			MaxRestarts: 3,
+			Backoff:     time.Millisecond,
+			SafeMode:    &SafeModeConfig{After: 2, Args: []string{"-safe"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 4 {
+		t.Fatalf("bad: %d", len(infos))
+	}
+	if infos[0].SafeMode != nil || slices.Contains(infos[1].Args, "-safe") {
+		t.Fatalf("shouldn't enter safe mode yet: %#v", infos[0].SafeMode)
+	}
+	if m := infos[1].SafeMode; m == nil || !m.Entered || m.Fingerprint != infos[1].Fingerprint {
+		t.Fatalf("should enter safe mode: %#v", m)
+	}
+	if m := infos[2].SafeMode; m == nil || m.Entered || !slices.Contains(infos[2].Args, "-safe") {
+		t.Fatalf("should restart in safe mode: %#v, %q", m, infos[2].Args)
+	}
+	if infos[3].SafeMode != nil {
+		t.Fatalf("isn't restarted: %#v", infos[3].SafeMode)
+	}
+	if !slices.Contains(e.cmd.Env, "PANICWRAP_SAFE_MODE="+infos[1].Fingerprint) {
+		t.Fatal("should mark safe mode in the environment")
+	}
+}
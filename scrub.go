@@ -0,0 +1,82 @@
+package panicwrap
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ScrubPattern masks one kind of sensitive data in crash text, such as
+// email addresses or customer IDs.
+type ScrubPattern struct {
+	// Name identifies the pattern in the errors about it, and in the
+	// default replacement.
+	Name string
+
+	// Pattern matches the data to mask.
+	Pattern *regexp.Regexp
+
+	// Replacement replaces every match, expanded as with
+	// regexp.Regexp.Expand, so that it can keep parts of the match with
+	// $1 and the like. If empty, it is "[REDACTED <Name>]".
+	Replacement string
+}
+
+// Scrub returns text with every match of the patterns replaced, in order.
+func Scrub(text string, patterns []ScrubPattern) string {
+	for _, p := range patterns {
+		replacement := p.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED " + p.Name + "]"
+		}
+		text = p.Pattern.ReplaceAllString(text, replacement)
+	}
+
+	return text
+}
+
+func (p *ScrubPattern) validate() error {
+	if p.Name == "" {
+		return errors.New("ScrubPatterns must have a Name")
+	}
+	if p.Pattern == nil {
+		return fmt.Errorf("ScrubPatterns %q must have a Pattern", p.Name)
+	}
+
+	return nil
+}
+
+// DefaultScrubPatterns mask the common shapes of secrets. Those that
+// match a value next to a keyword keep the keyword, so that it is still
+// clear what was there.
+var DefaultScrubPatterns = []ScrubPattern{
+	{
+		Name:    "pem-block",
+		Pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----[\s\S]*?-----END [A-Z0-9 ]+-----`),
+	},
+	{
+		Name:    "aws-access-key",
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	},
+	{
+		Name:        "bearer-token",
+		Pattern:     regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]{8,}=*`),
+		Replacement: "${1}[REDACTED bearer-token]",
+	},
+	{
+		Name:        "keyword-secret",
+		Pattern:     regexp.MustCompile(`(?i)((?:token|password|passwd|secret|api_?key|access_?key|credentials?)[A-Za-z_\-]*\s*(?:[=:]|\s)\s*["']?)[A-Za-z0-9+/_\-]{16,}={0,2}`),
+		Replacement: "${1}[REDACTED keyword-secret]",
+	},
+}
+
+// scrub masks the secrets in the crash text with DefaultScrubPatterns,
+// unless WrapConfig.DisableScrubbing is set, and then with
+// WrapConfig.ScrubPatterns.
+func scrub(c *WrapConfig, text string) string {
+	if !c.DisableScrubbing {
+		text = Scrub(text, DefaultScrubPatterns)
+	}
+
+	return Scrub(text, c.ScrubPatterns)
+}
@@ -0,0 +1,38 @@
+package panicwrap
+
+// Severity is how urgent a crash is, so that notification handlers can
+// decide whether it pages someone, opens a ticket or is only logged. See
+// WrapConfig.Severities.
+type Severity string
+
+const (
+	// SeverityCritical calls for someone to act now, such as paging the
+	// on-call engineer.
+	SeverityCritical Severity = "critical"
+
+	// SeverityError calls for a fix, such as a ticket. It is the default.
+	SeverityError Severity = "error"
+
+	// SeverityWarning calls for a look, but not necessarily a fix.
+	SeverityWarning Severity = "warning"
+
+	// SeverityInfo is only logged.
+	SeverityInfo Severity = "info"
+)
+
+// severity returns the severity of a crash of the given kind.
+func severity(c *WrapConfig, kind CrashKind) Severity {
+	if s, ok := c.Severities[kind]; ok {
+		return s
+	}
+	return SeverityError
+}
+
+// validSeverity returns whether s is one of the severities.
+func validSeverity(s Severity) bool {
+	switch s {
+	case SeverityCritical, SeverityError, SeverityWarning, SeverityInfo:
+		return true
+	}
+	return false
+}
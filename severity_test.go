@@ -0,0 +1,26 @@
+package panicwrap
+
+import "testing"
+
+func TestSeverity(t *testing.T) {
+	c := &WrapConfig{
+		Clock:      realClock{},
+		Severities: map[CrashKind]Severity{KindDeadlock: SeverityCritical, KindOutOfMemory: SeverityWarning},
+	}
+
+	cases := []struct {
+		text     string
+		expected Severity
+	}{
+		{testPanicText, SeverityError},
+		{"fatal error: all goroutines are asleep - deadlock!\n", SeverityCritical},
+		{"fatal error: runtime: out of memory\n", SeverityWarning},
+	}
+	for _, tc := range cases {
+		info := &PanicInfo{Text: tc.text}
+		analyzePanic(c, newCrashTracker(0), info)
+		if info.Severity != tc.expected {
+			t.Errorf("%s: got %s, want %s", info.Kind, info.Severity, tc.expected)
+		}
+	}
+}
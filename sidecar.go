@@ -0,0 +1,328 @@
+package panicwrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// handlerSidecarEnv is the value of handlerProcessEnv in the environment
+// of the sidecar. See WrapConfig.HandlerSidecar.
+const handlerSidecarEnv = "sidecar"
+
+// SidecarConfig has the helper process that calls the handlers for the
+// crashes of the child, which the parent starts before the child and
+// keeps running, so that a crash can be handled out of the parent when
+// it no longer could start a process, such as once the host runs out of
+// file descriptors or memory.
+type SidecarConfig struct {
+	// Interval is how often the parent checks that the sidecar answers,
+	// and starts it again if it doesn't. Defaults to 10 seconds.
+	Interval time.Duration
+
+	// Timeout is how long the sidecar has to answer a check, or to take a
+	// crash before the parent handles it itself. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// sidecarRequest is what the parent sends the sidecar: a crash to handle,
+// or a check that it answers if Crash is nil.
+type sidecarRequest struct {
+	ID    uint64     `json:"id"`
+	Crash *PanicInfo `json:"crash,omitempty"`
+}
+
+// sidecarReply is what the sidecar answers a request with. A crash is
+// answered twice: with Taken as soon as it arrives, and with Error, if a
+// handler failed, once it was handled.
+type sidecarReply struct {
+	ID    uint64 `json:"id"`
+	Taken bool   `json:"taken,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// activeSidecar is the sidecar of the running Wrap call, if any.
+var activeSidecar atomic.Pointer[sidecar]
+
+// sidecar is the parent end of WrapConfig.HandlerSidecar. Requests are
+// sent one at a time.
+type sidecar struct {
+	c        *WrapConfig
+	interval time.Duration
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	proc   *sidecarProc
+	nextID uint64
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// sidecarProc is a running sidecar.
+type sidecarProc struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	enc     *json.Encoder
+	replies chan sidecarReply
+	exited  chan struct{}
+}
+
+// startSidecar starts the sidecar and the checks that it answers. If it
+// can't be started, it is tried again at the next check.
+func startSidecar(c *WrapConfig) *sidecar {
+	s := &sidecar{
+		c:        c,
+		interval: c.HandlerSidecar.Interval,
+		timeout:  c.HandlerSidecar.Timeout,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if s.interval == 0 {
+		s.interval = 10 * time.Second
+	}
+	if s.timeout == 0 {
+		s.timeout = 5 * time.Second
+	}
+
+	s.mu.Lock()
+	s.restart()
+	s.mu.Unlock()
+	go s.run()
+
+	return s
+}
+
+func (s *sidecar) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.c.Clock.After(s.interval):
+		case <-s.quit:
+			return
+		}
+		// A sidecar that is handling a crash is checked by that.
+		if s.mu.TryLock() {
+			s.check()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// check makes sure the sidecar answers, and starts it again if it
+// doesn't.
+func (s *sidecar) check() {
+	if s.proc != nil {
+		_, err := s.send(nil)
+		if err == nil {
+			return
+		}
+		reportInternal(s.c, "checking the handler sidecar", err)
+	}
+	s.restart()
+}
+
+// restart stops the sidecar if it is running and starts it again.
+func (s *sidecar) restart() {
+	if s.proc != nil {
+		s.proc.kill()
+		s.proc = nil
+	}
+
+	p, err := startSidecarProc()
+	if err != nil {
+		reportInternal(s.c, "starting the handler sidecar", err)
+		return
+	}
+	debugf(s.c, "started the handler sidecar %d", p.cmd.Process.Pid)
+	s.proc = p
+}
+
+// handle hands the crash over to the sidecar and waits for it to be
+// handled. It returns false if the sidecar didn't take it, in which case
+// the parent calls the handlers itself.
+func (s *sidecar) handle(info *PanicInfo) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proc == nil {
+		s.restart()
+		if s.proc == nil {
+			return false, errors.New("the handler sidecar isn't running")
+		}
+	}
+
+	id, err := s.send(info)
+	if err != nil {
+		s.restart()
+		return false, err
+	}
+	debugf(s.c, "handling a crash in the handler sidecar %d", s.proc.cmd.Process.Pid)
+
+	// Handlers may take long, so a crash that was taken is waited for as
+	// long as the sidecar runs.
+	for r := range s.proc.replies {
+		if r.ID != id {
+			continue
+		}
+		if r.Error != "" {
+			return true, &HandlerProcessError{Err: errors.New(r.Error)}
+		}
+		return true, nil
+	}
+	s.restart()
+	return true, &HandlerProcessError{Err: errors.New("the sidecar exited while handling the crash")}
+}
+
+// send sends a request to the sidecar and waits until it answers it, or
+// takes the crash, for the timeout. It returns the ID of the request.
+func (s *sidecar) send(crash *PanicInfo) (uint64, error) {
+	s.nextID++
+	id := s.nextID
+	if err := s.proc.enc.Encode(sidecarRequest{ID: id, Crash: crash}); err != nil {
+		return 0, fmt.Errorf("writing to the handler sidecar: %w", err)
+	}
+
+	timeout := s.c.Clock.After(s.timeout)
+	for {
+		select {
+		case r, ok := <-s.proc.replies:
+			if !ok {
+				return 0, errors.New("the handler sidecar exited")
+			}
+			// Replies to requests that timed out are stale.
+			if r.ID == id {
+				return id, nil
+			}
+		case <-timeout:
+			return 0, fmt.Errorf("the handler sidecar didn't answer within %s", s.timeout)
+		}
+	}
+}
+
+// close stops the checks, and the sidecar once it handled what it took.
+func (s *sidecar) close() {
+	close(s.quit)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proc == nil {
+		return
+	}
+	s.proc.stdin.Close()
+	go func(p *sidecarProc) {
+		for range p.replies {
+		}
+	}(s.proc)
+	select {
+	case <-s.proc.exited:
+	case <-s.c.Clock.After(s.timeout):
+		s.proc.kill()
+	}
+	s.proc = nil
+}
+
+// startSidecarProc starts our own executable again as the sidecar.
+func startSidecarProc() (*sidecarProc, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), handlerProcessEnv+"="+handlerSidecarEnv)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &sidecarProc{
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     json.NewEncoder(stdin),
+		replies: make(chan sidecarReply, 1),
+		exited:  make(chan struct{}),
+	}
+	go func() {
+		defer close(p.exited)
+		dec := json.NewDecoder(stdout)
+		for {
+			var r sidecarReply
+			if err := dec.Decode(&r); err != nil {
+				break
+			}
+			p.replies <- r
+		}
+		close(p.replies)
+		cmd.Wait()
+	}()
+
+	return p, nil
+}
+
+// kill stops the sidecar at once, and waits for it to exit.
+func (p *sidecarProc) kill() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	for range p.replies {
+	}
+	<-p.exited
+}
+
+// isHandlerSidecar returns whether this process is the sidecar that calls
+// the handlers for the crashes of the child.
+func isHandlerSidecar() bool {
+	return os.Getenv(handlerProcessEnv) == handlerSidecarEnv
+}
+
+// serveHandlerSidecar answers the requests of the parent until it closes
+// the pipe. It returns the exit status of the sidecar.
+func serveHandlerSidecar(c *WrapConfig) (int, error) {
+	// Replies go to stdout, so what the handlers print goes to stderr. The
+	// sidecar outlives the parent to finish a crash it took, so it leaves
+	// interrupts to the parent, and a failed reply to the parent must not
+	// kill it.
+	replies := json.NewEncoder(os.Stdout)
+	os.Stdout = os.Stderr
+	signal.Ignore(os.Interrupt)
+	if pipeSignal != nil {
+		signal.Ignore(pipeSignal)
+	}
+
+	dec := json.NewDecoder(os.Stdin)
+	for {
+		var req sidecarRequest
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF {
+				return 0, nil
+			}
+			return 1, fmt.Errorf("panicwrap: reading the request of the parent: %w", err)
+		}
+		if req.Crash == nil {
+			replies.Encode(sidecarReply{ID: req.ID})
+			continue
+		}
+
+		replies.Encode(sidecarReply{ID: req.ID, Taken: true})
+		reply := sidecarReply{ID: req.ID}
+		if err := callHandlers(c, req.Crash); err != nil {
+			reply.Error = err.Error()
+		}
+		replies.Encode(reply)
+	}
+}
@@ -0,0 +1,77 @@
+package panicwrap
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// handledRe matches what the handler of the handler-sidecar helpers
+// prints.
+var handledRe = regexp.MustCompile(`handled "uh oh" in (\d+), started by (\d+)`)
+
+func TestPanicWrap_handlerSidecar(t *testing.T) {
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("handler-sidecar")
+	p.Stdout = new(bytes.Buffer)
+	p.Stderr = stderr
+	err := p.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("err: %s", err)
+	}
+
+	m := handledRe.FindAllStringSubmatch(stderr.String(), -1)
+	if len(m) != 1 {
+		t.Fatalf("should handle the crash once: %q", stderr.String())
+	}
+	pid, _ := strconv.Atoi(m[0][1])
+	ppid, _ := strconv.Atoi(m[0][2])
+	if ppid != p.Process.Pid || pid == ppid {
+		t.Fatalf("should call the handler in the sidecar: %q", stderr.String())
+	}
+}
+
+func TestPanicWrap_handlerSidecarDead(t *testing.T) {
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("handler-sidecar-dead")
+	p.Stdout = new(bytes.Buffer)
+	p.Stderr = stderr
+	err := p.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("err: %s", err)
+	}
+
+	m := handledRe.FindAllStringSubmatch(stderr.String(), -1)
+	if len(m) != 1 || m[0][1] != fmt.Sprint(p.Process.Pid) {
+		t.Fatalf("should call the handler in the parent: %q", stderr.String())
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("handing a crash to the handler sidecar")) {
+		t.Fatalf("should report the failed handover: %q", stderr.String())
+	}
+}
+
+func TestPanicWrap_handlerSidecarRestart(t *testing.T) {
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("handler-sidecar-restart", filepath.Join(t.TempDir(), "died"))
+	p.Stdout = new(bytes.Buffer)
+	p.Stderr = stderr
+	err := p.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !bytes.Contains(stderr.Bytes(), []byte("checking the handler sidecar")) {
+		t.Fatalf("should find the sidecar dead: %q", stderr.String())
+	}
+	m := handledRe.FindAllStringSubmatch(stderr.String(), -1)
+	if len(m) != 1 || m[0][2] != fmt.Sprint(p.Process.Pid) || m[0][1] == m[0][2] {
+		t.Fatalf("should call the handler in the restarted sidecar: %q", stderr.String())
+	}
+}
@@ -0,0 +1,70 @@
+package panicwrap
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"os"
+)
+
+// sigSuffix is appended to the path of a crash file to name its detached
+// signature. See WrapConfig.SigningKey.
+const sigSuffix = ".sig"
+
+// signOptions makes the signatures Ed25519ph over the SHA-512 digest of
+// the file, so that cores don't have to be read into memory to be signed.
+var signOptions = &ed25519.Options{Hash: crypto.SHA512}
+
+// signFile writes the detached signature of the file at path with the key
+// to path+".sig". This is best-effort, like writing the file itself.
+func signFile(path string, key ed25519.PrivateKey) {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return
+	}
+	sig, err := key.Sign(nil, digest, signOptions)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path+sigSuffix, sig, 0644); err != nil {
+		os.Remove(path + sigSuffix)
+	}
+}
+
+// VerifyFile checks the detached signature that the parent wrote next to
+// the crash file at path with WrapConfig.SigningKey, against the public
+// half of that key. It returns an error if the signature is missing or
+// doesn't match the contents of the file.
+func VerifyFile(path string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid ed25519 public key")
+	}
+	sig, err := os.ReadFile(path + sigSuffix)
+	if err != nil {
+		return err
+	}
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+
+	return ed25519.VerifyWithOptions(key, digest, sig, signOptions)
+}
+
+// fileDigest returns the SHA-512 digest of the file at path.
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha512.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
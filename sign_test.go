@@ -0,0 +1,67 @@
+package panicwrap
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "crash.stderr")
+	if err := os.WriteFile(path, []byte(testPanicText), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := VerifyFile(path, pub); err == nil {
+		t.Fatal("should fail without a signature")
+	}
+
+	signFile(path, key)
+	if err := VerifyFile(path, pub); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	if err := VerifyFile(path, other); err == nil {
+		t.Fatal("should fail with another key")
+	}
+
+	if err := os.WriteFile(path, []byte(testPanicText+"\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := VerifyFile(path, pub); err == nil {
+		t.Fatal("should fail once the file changed")
+	}
+}
+
+func TestWrap_signingKey(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var info *PanicInfo
+	_, _, err = Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) { info = i },
+		Writer:      new(bytes.Buffer),
+		Executor:    &fakeExecutor{stderr: []string{testPanicText}, exit: ProcessExit{Status: 2}},
+		RecordDir:   t.TempDir(),
+		SigningKey:  key,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info == nil || info.Recording == "" {
+		t.Fatalf("should record the crash: %#v", info)
+	}
+	if err := VerifyFile(info.Recording, pub); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,35 @@
+package panicwrap
+
+import "os"
+
+// forwardedSignals returns the signals that the parent forwards to the
+// child: the ForwardSignals of the configuration and, with ForwardAll,
+// the forwardAllSignals of this platform that aren't ignored instead or
+// used for Reload.
+func forwardedSignals(c *WrapConfig) []os.Signal {
+	if !c.ForwardAll {
+		return c.ForwardSignals
+	}
+
+	result := append([]os.Signal(nil), c.ForwardSignals...)
+	for _, s := range forwardAllSignals {
+		if c.Reload != nil && s == reloadSignal {
+			continue
+		}
+		if !hasSignal(c.IgnoreSignals, s) && !hasSignal(result, s) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+func hasSignal(signals []os.Signal, s os.Signal) bool {
+	for _, other := range signals {
+		if other == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package panicwrap
+
+import "os"
+
+var forwardAllSignals = []os.Signal{os.Interrupt}
+
+var reloadSignal os.Signal
+
+var pipeSignal os.Signal
+
+// quitSignal is never sent, since Wrap doesn't start a child here. See
+// Supported.
+var quitSignal os.Signal = os.Kill
+
+var stopSignals = []os.Signal{os.Interrupt, os.Kill}
@@ -0,0 +1,47 @@
+package panicwrap
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestForwardedSignals(t *testing.T) {
+	c := &WrapConfig{ForwardSignals: []os.Signal{syscall.SIGTERM}}
+	if s := forwardedSignals(c); !reflect.DeepEqual(s, c.ForwardSignals) {
+		t.Fatalf("bad: %#v", s)
+	}
+
+	c.ForwardAll = true
+	c.IgnoreSignals = []os.Signal{os.Interrupt}
+	s := forwardedSignals(c)
+	if s[0] != syscall.SIGTERM {
+		t.Fatalf("should keep ForwardSignals first: %#v", s)
+	}
+	if hasSignal(s, os.Interrupt) {
+		t.Fatalf("shouldn't forward ignored signals: %#v", s)
+	}
+	for _, sig := range forwardAllSignals {
+		if sig != os.Interrupt && !hasSignal(s, sig) {
+			t.Fatalf("should forward %s: %#v", sig, s)
+		}
+	}
+	if len(s) != len(forwardAllSignals)-1 {
+		t.Fatalf("shouldn't forward twice: %#v", s)
+	}
+}
+
+func TestForwardedSignals_reload(t *testing.T) {
+	if reloadSignal == nil {
+		t.Skip("no reload signal on this platform")
+	}
+
+	c := &WrapConfig{
+		ForwardAll: true,
+		Reload:     func() (*WrapConfig, error) { return nil, nil },
+	}
+	if s := forwardedSignals(c); hasSignal(s, reloadSignal) {
+		t.Fatalf("shouldn't forward the reload signal: %#v", s)
+	}
+}
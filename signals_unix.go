@@ -0,0 +1,34 @@
+//go:build unix
+
+package panicwrap
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardAllSignals are the signals a program is asked to stop or reload
+// with. Signals that the terminal already sends to the whole process
+// group, such as SIGWINCH and the job control signals, and those that are
+// about the parent itself, such as SIGCHLD and SIGPIPE, are left out.
+var forwardAllSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// reloadSignal asks the parent to reload. See WrapConfig.Reload.
+var reloadSignal os.Signal = syscall.SIGHUP
+
+// pipeSignal is sent for a write to a broken pipe.
+var pipeSignal os.Signal = syscall.SIGPIPE
+
+// quitSignal makes a Go program exit with a goroutine dump.
+var quitSignal os.Signal = syscall.SIGQUIT
+
+// stopSignals are the signals that ask a program to stop, after which a
+// child they were forwarded to isn't restarted.
+var stopSignals = []os.Signal{os.Interrupt, os.Kill, syscall.SIGTERM}
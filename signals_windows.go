@@ -0,0 +1,28 @@
+package panicwrap
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardAllSignals are the signals Go delivers for console control
+// events: os.Interrupt for Ctrl+C and Ctrl+Break, and syscall.SIGTERM for
+// closing the console, logging off and shutting down.
+var forwardAllSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGTERM,
+}
+
+// reloadSignal is nil since there is no signal to reload with on Windows.
+// Reload and CommandReload still work.
+var reloadSignal os.Signal
+
+// pipeSignal is nil since a write to a broken pipe only fails on Windows.
+var pipeSignal os.Signal
+
+// quitSignal can't be delivered on Windows, so DumpStacks fails there.
+var quitSignal os.Signal = syscall.SIGQUIT
+
+// stopSignals are the signals that ask a program to stop, after which a
+// child they were forwarded to isn't restarted.
+var stopSignals = []os.Signal{os.Interrupt, os.Kill, syscall.SIGTERM}
@@ -0,0 +1,79 @@
+package panicwrap
+
+import (
+	"io"
+	"sync"
+)
+
+// ErrorPolicy decides what happens when writing to a Sink fails.
+type ErrorPolicy int
+
+const (
+	// ErrorIgnore keeps writing to the sink after a failed write, which
+	// suits sinks that may recover, such as network connections.
+	ErrorIgnore ErrorPolicy = iota
+
+	// ErrorDrop stops writing to the sink after its first failed write.
+	// The other writers of the stream carry on.
+	ErrorDrop
+
+	// ErrorAbort stops forwarding the stream to all of its writers after
+	// a failed write. For stdout, the child's writes fail from then on,
+	// as they would if the parent's stdout was closed. Panics are still
+	// detected on stderr.
+	ErrorAbort
+)
+
+// Sink is an additional writer for one of the streams of the child. See
+// WrapConfig.StdoutSinks.
+type Sink struct {
+	Writer  io.Writer
+	OnError ErrorPolicy
+}
+
+// tee writes to several sinks, applying their error policies.
+type tee struct {
+	mu      sync.Mutex
+	sinks   []Sink
+	dropped []bool
+	err     error
+}
+
+func newTee(sinks []Sink) *tee {
+	return &tee{
+		sinks:   sinks,
+		dropped: make([]bool, len(sinks)),
+	}
+}
+
+func (t *tee) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return 0, t.err
+	}
+
+	for i, s := range t.sinks {
+		if t.dropped[i] {
+			continue
+		}
+
+		n, err := s.Writer.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			continue
+		}
+
+		switch s.OnError {
+		case ErrorDrop:
+			t.dropped[i] = true
+		case ErrorAbort:
+			t.err = err
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,71 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// failingWriter fails every write after the first n.
+type failingWriter struct {
+	n      int
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > w.n {
+		return 0, errors.New("broken")
+	}
+
+	return len(p), nil
+}
+
+func TestTee_policies(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ignore := &failingWriter{n: 1}
+	drop := &failingWriter{n: 1}
+	tw := newTee([]Sink{
+		{Writer: buf},
+		{Writer: ignore, OnError: ErrorIgnore},
+		{Writer: drop, OnError: ErrorDrop},
+	})
+
+	for i := 0; i < 3; i++ {
+		if n, err := tw.Write([]byte("a")); n != 1 || err != nil {
+			t.Fatalf("bad: %d, %s", n, err)
+		}
+	}
+
+	if buf.String() != "aaa" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+	if ignore.writes != 3 {
+		t.Fatalf("should keep writing to ignored sinks: %d", ignore.writes)
+	}
+	if drop.writes != 2 {
+		t.Fatalf("should stop writing to dropped sinks: %d", drop.writes)
+	}
+}
+
+func TestTee_abort(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := newTee([]Sink{
+		{Writer: &failingWriter{n: 1}, OnError: ErrorAbort},
+		{Writer: buf},
+	})
+
+	if _, err := tw.Write([]byte("a")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := tw.Write([]byte("b")); err == nil {
+		t.Fatal("should abort")
+	}
+	if _, err := tw.Write([]byte("c")); err == nil {
+		t.Fatal("should stay aborted")
+	}
+
+	if buf.String() != "a" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
@@ -0,0 +1,73 @@
+package panicwrap
+
+import (
+	"bufio"
+	"os"
+)
+
+// SourceSnippet holds the lines of source code around the frame that
+// panicked.
+type SourceSnippet struct {
+	// File and Line are the location of the frame that panicked.
+	File string `json:"file"`
+	Line int    `json:"line"`
+
+	// FirstLine is the line number of the first entry of Lines.
+	FirstLine int      `json:"first_line"`
+	Lines     []string `json:"lines,omitempty"`
+}
+
+// topFrame returns the frame that panicked, which is the innermost frame
+// of the first goroutine that isn't part of the runtime.
+func topFrame(goroutines []Goroutine) *Frame {
+	if len(goroutines) == 0 {
+		return nil
+	}
+
+	for i, f := range goroutines[0].Frames {
+		if !f.isRuntime() {
+			return &goroutines[0].Frames[i]
+		}
+	}
+
+	return nil
+}
+
+// readSource reads the given number of lines of context on each side of
+// the frame that panicked. It returns nil if the source isn't available,
+// which is the usual case outside of development machines.
+func readSource(text string, context int) *SourceSnippet {
+	// The paths must not be trimmed in order to find the files.
+	frame := topFrame(parseGoroutines(text, nil))
+	if frame == nil || frame.File == "" {
+		return nil
+	}
+	file, line := frame.File, frame.Line
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	result := &SourceSnippet{
+		File:      file,
+		Line:      line,
+		FirstLine: line - context,
+	}
+	if result.FirstLine < 1 {
+		result.FirstLine = 1
+	}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan() && n <= line+context; n++ {
+		if n >= result.FirstLine {
+			result.Lines = append(result.Lines, scanner.Text())
+		}
+	}
+	if scanner.Err() != nil || len(result.Lines) == 0 {
+		return nil
+	}
+
+	return result
+}
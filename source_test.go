@@ -0,0 +1,57 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTopFrame(t *testing.T) {
+	text := `panic: oh no
+
+goroutine 1 [running]:
+panic({0x4b8f40, 0xc000012345})
+	/usr/local/go/src/runtime/panic.go:770 +0x132
+main.lookup(...)
+	/home/user/app/main.go:12
+main.main()
+	/home/user/app/main.go:7 +0x45
+`
+
+	frame := topFrame(parseGoroutines(text, nil))
+	if frame == nil {
+		t.Fatal("should find frame")
+	}
+	if frame.File != "/home/user/app/main.go" || frame.Line != 12 {
+		t.Fatalf("bad: %#v", frame)
+	}
+}
+
+func TestReadSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	src := "package main\n\nfunc main() {\n\tpanic(\"oh no\")\n}\n"
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	text := "panic: oh no\n\ngoroutine 1 [running]:\nmain.main()\n\t" + path + ":4 +0x45\n"
+	snippet := readSource(text, 1)
+	if snippet == nil {
+		t.Fatal("should read source")
+	}
+
+	expected := &SourceSnippet{
+		File:      path,
+		Line:      4,
+		FirstLine: 3,
+		Lines:     []string{"func main() {", "\tpanic(\"oh no\")", "}"},
+	}
+	if !reflect.DeepEqual(snippet, expected) {
+		t.Fatalf("bad: %#v", snippet)
+	}
+
+	if readSource("panic: oh no\n", 1) != nil {
+		t.Fatal("should not read source without a frame")
+	}
+}
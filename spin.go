@@ -0,0 +1,233 @@
+package panicwrap
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+// spinDumpTimeout is how long the watchdog of WrapConfig.SpinWatchdog
+// waits for the goroutine dump of the child.
+const spinDumpTimeout = 10 * time.Second
+
+// maxStacksSize limits the goroutine dump the child sends over the
+// control channel, so that it fits in a message.
+const maxStacksSize = maxMessageSize / 2
+
+// SpinConfig has the CPU watchdog of the parent, which measures the CPU
+// time the child uses over a window and captures a goroutine dump once it
+// pegs the CPU, so that busy loops are caught with their stacks without a
+// human noticing them first. This is supported on Linux, where the time
+// comes from procfs, and on Windows.
+type SpinConfig struct {
+	// MaxCPU is the utilization over a Window past which the child
+	// spins, in CPUs: 0.9 is 90% of one CPU, and 3.5 is three and a half
+	// CPUs. It must be set.
+	MaxCPU float64
+
+	// Window is the period over which the utilization is measured.
+	// Defaults to 30 seconds.
+	Window time.Duration
+}
+
+// Spin is a child that used more CPU than SpinConfig.MaxCPU over a window.
+// The watchdog acts once per child, until its utilization falls below the
+// threshold again.
+type Spin struct {
+	// CPU is the utilization of the child over the window, in CPUs.
+	CPU float64
+
+	// Dump is the goroutine dump of the child, unless it didn't send one
+	// in time. With WrapConfig.Control, the child sends it over the
+	// control channel and keeps running. Otherwise it is requested like
+	// DumpStacks does, which makes the child exit: it is restarted if
+	// WrapConfig.Restart allows it, and the dump is passed to DumpHandler
+	// as well.
+	Dump *Dump
+
+	// PID is the process ID of the child, Worker the index of its worker
+	// and Time the end of the window.
+	PID    int
+	Worker int
+	Time   time.Time
+}
+
+// SpinHandlerFunc is the type called when the child spins.
+type SpinHandlerFunc func(*Spin)
+
+// stacksMessage carries the goroutine dump of the child, in answer to a
+// messageStacks of the parent.
+type stacksMessage struct {
+	Text string `json:"text"`
+}
+
+// currentStacks returns the goroutine dump of this process, cut short at
+// maxStacksSize.
+func currentStacks() stacksMessage {
+	buf := make([]byte, maxStacksSize)
+	return stacksMessage{Text: string(buf[:runtime.Stack(buf, true)])}
+}
+
+// spinSample is the CPU time of a child at a point in time.
+type spinSample struct {
+	pid  int
+	cpu  time.Duration
+	time time.Time
+}
+
+// spinWatcher measures the utilization of the children of a SpinConfig.
+type spinWatcher struct {
+	c    *WrapConfig
+	s    *SpinConfig
+	ch   *child
+	quit chan struct{}
+	done chan struct{}
+
+	// last has the previous sample of each worker, and spun the process
+	// ID of the child of each worker that the watchdog acted on.
+	last map[*child]spinSample
+	spun map[*child]int
+}
+
+// startSpinWatcher starts measuring the utilization of the child until
+// stop is called.
+func startSpinWatcher(c *WrapConfig, ch *child) *spinWatcher {
+	w := &spinWatcher{
+		c:    c,
+		s:    c.SpinWatchdog,
+		ch:   ch,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+		last: make(map[*child]spinSample),
+		spun: make(map[*child]int),
+	}
+	go w.run()
+	return w
+}
+
+func (w *spinWatcher) run() {
+	defer close(w.done)
+	window := w.s.Window
+	if window == 0 {
+		window = 30 * time.Second
+	}
+	for {
+		w.check()
+		select {
+		case <-w.c.Clock.After(window):
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// check samples the CPU time of every worker and acts on those that spun
+// since the previous sample.
+func (w *spinWatcher) check() {
+	w.ch.each(func(wk *child) {
+		pid := 0
+		wk.with(func(p Process) error {
+			pid = p.Pid()
+			return nil
+		})
+		if pid == 0 {
+			delete(w.last, wk)
+			return
+		}
+
+		cpu, err := readCPUTime(pid)
+		if err != nil {
+			debugf(w.c, "reading the CPU time of child %d: %s", pid, err)
+			return
+		}
+		now := w.c.Clock.Now()
+		last, ok := w.last[wk]
+		w.last[wk] = spinSample{pid: pid, cpu: cpu, time: now}
+		if !ok || last.pid != pid || !now.After(last.time) {
+			return
+		}
+
+		usage := float64(cpu-last.cpu) / float64(now.Sub(last.time))
+		if usage <= w.s.MaxCPU {
+			delete(w.spun, wk)
+			return
+		}
+		if w.spun[wk] == pid {
+			return
+		}
+		w.spun[wk] = pid
+
+		debugf(w.c, "child %d used %.2f CPUs", pid, usage)
+		s := &Spin{CPU: usage, PID: pid, Worker: wk.index, Time: now}
+		s.Dump = w.dump(wk, pid)
+		if w.c.SpinHandler != nil {
+			w.c.SpinHandler(s)
+		}
+	})
+}
+
+// dump returns the goroutine dump of the child, or nil if it didn't send
+// one in time.
+func (w *spinWatcher) dump(wk *child, pid int) *Dump {
+	if p, err := wk.getControl(); err == nil {
+		text, err := p.stacks(spinDumpTimeout)
+		if err != nil {
+			debugf(w.c, "asking child %d for its stacks: %s", pid, err)
+			return nil
+		}
+		return &Dump{
+			Text:       text,
+			Goroutines: parseGoroutines(text, newPathTrimmer(w.c, text)),
+			PID:        pid,
+			Time:       w.c.Clock.Now(),
+		}
+	}
+
+	dumpCh := wk.waitDump()
+	if err := wk.send(quitSignal); err != nil {
+		return nil
+	}
+	select {
+	case d := <-dumpCh:
+		return d
+	case <-time.After(spinDumpTimeout):
+		return nil
+	}
+}
+
+// stop stops measuring.
+func (w *spinWatcher) stop() {
+	close(w.quit)
+	<-w.done
+}
+
+// stacks asks the child for its goroutine dump and waits for it.
+func (p *parentControl) stacks(timeout time.Duration) (string, error) {
+	reply := make(chan string, 1)
+	p.mu.Lock()
+	p.stackWaiters = append(p.stackWaiters, reply)
+	p.mu.Unlock()
+
+	if err := p.send(messageStacks, struct{}{}); err != nil {
+		return "", err
+	}
+	select {
+	case text := <-reply:
+		return text, nil
+	case <-p.done:
+		return "", errors.New("panicwrap: the control channel was closed")
+	case <-time.After(timeout):
+		return "", errors.New("panicwrap: timed out waiting for the stacks of the child")
+	}
+}
+
+// deliverStacks passes the goroutine dump of the child to everyone
+// waiting for one.
+func (p *parentControl) deliverStacks(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, reply := range p.stackWaiters {
+		reply <- text
+	}
+	p.stackWaiters = nil
+}
@@ -0,0 +1,68 @@
+package panicwrap
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// burnCPU keeps the CPU busy for the duration.
+func burnCPU(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func TestReadCPUTime(t *testing.T) {
+	before, err := readCPUTime(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	burnCPU(50 * time.Millisecond)
+	after, err := readCPUTime(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if after <= before {
+		t.Fatalf("bad: %s, %s", before, after)
+	}
+}
+
+func TestSpinWatcher(t *testing.T) {
+	clock := newFakeClock()
+	spins := make(chan *Spin, 2)
+	c := &WrapConfig{
+		Clock:        clock,
+		SpinWatchdog: &SpinConfig{MaxCPU: 0.01, Window: time.Second},
+		SpinHandler:  func(s *Spin) { spins <- s },
+	}
+	e := new(fakeExecutor)
+	ch := &child{index: 2}
+	ch.set(&selfProcess{fakeProcess{e: e}})
+
+	w := startSpinWatcher(c, ch)
+	defer w.stop()
+	<-clock.waiting
+
+	burnCPU(100 * time.Millisecond)
+	clock.Advance(time.Second)
+
+	// Play the child printing its dump.
+	for {
+		e.mu.Lock()
+		n := len(e.signals)
+		e.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ch.deliverDump(&Dump{Text: "SIGQUIT: quit"})
+
+	s := <-spins
+	if s.CPU <= 0.01 || s.PID != os.Getpid() || s.Worker != 2 || s.Dump == nil || s.Dump.Text != "SIGQUIT: quit" {
+		t.Fatalf("bad: %#v", s)
+	}
+	if e.signals[0] != quitSignal {
+		t.Fatalf("bad: %v", e.signals)
+	}
+}
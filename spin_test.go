@@ -0,0 +1,50 @@
+package panicwrap
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCurrentStacks(t *testing.T) {
+	m := currentStacks()
+	if !strings.HasPrefix(m.Text, "goroutine ") || !strings.Contains(m.Text, "TestCurrentStacks") {
+		t.Fatalf("bad: %q", m.Text)
+	}
+}
+
+func TestParentControl_stacks(t *testing.T) {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer inR.Close()
+
+	p := newParentControl(&WrapConfig{Clock: realClock{}}, 0, nil, outR, inW)
+	defer p.close()
+
+	// Play the child.
+	writeMessage(outW, messageHandshake, handshakeMessage{Version: protocolVersion, PID: 42})
+	if typ, _, err := readMessage(inR); err != nil || typ != messageHandshake {
+		t.Fatalf("bad: %d, %v", typ, err)
+	}
+	go func() {
+		defer outW.Close()
+		if typ, _, err := readMessage(inR); err == nil && typ == messageStacks {
+			writeMessage(outW, messageStacks, stacksMessage{Text: "goroutine 1 [running]:\n"})
+		}
+	}()
+
+	text, err := p.stacks(time.Minute)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if text != "goroutine 1 [running]:\n" {
+		t.Fatalf("bad: %q", text)
+	}
+}
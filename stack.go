@@ -0,0 +1,142 @@
+package panicwrap
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Goroutine is one of the goroutine stacks printed with a panic.
+type Goroutine struct {
+	// ID is the goroutine ID and State what the runtime printed about
+	// it in brackets, such as "running" or "chan receive, 5 minutes".
+	ID    int    `json:"id"`
+	State string `json:"state"`
+
+	// Frames are the stack frames, innermost first.
+	Frames []Frame `json:"frames,omitempty"`
+
+	// CreatedBy is the go statement that started the goroutine. It is nil
+	// for the main goroutine.
+	CreatedBy *Frame `json:"created_by,omitempty"`
+}
+
+// Frame is a single stack frame.
+type Frame struct {
+	// Function is the fully qualified function name, such as
+	// "github.com/foo/bar.(*Server).Serve", and Package its import path,
+	// such as "github.com/foo/bar".
+	Function string `json:"function"`
+	Package  string `json:"package"`
+
+	// File and Line are the source location of the frame. File is
+	// normalized if WrapConfig.TrimPaths or TrimPathPrefixes are set.
+	File string `json:"file"`
+	Line int    `json:"line"`
+
+	// Offset is the program counter offset within the function, or 0 if
+	// the runtime didn't print one.
+	Offset int `json:"offset"`
+}
+
+var (
+	stackGoroutineRe = regexp.MustCompile(`^goroutine ([0-9]+) .*\[(.*)\]:$`)
+	stackFileRe      = regexp.MustCompile(`^\t(.+):([0-9]+)(?: \+0x([0-9a-fA-F]+))?`)
+	stackCreatedRe   = regexp.MustCompile(`^created by (.+?)(?: in goroutine [0-9]+)?$`)
+)
+
+// parseGoroutines parses the goroutine stacks in the given panic text. File
+// paths are normalized with the given trimmer, which may be nil. Lines that
+// aren't understood are skipped.
+func parseGoroutines(text string, trimmer *pathTrimmer) []Goroutine {
+	var result []Goroutine
+	var g *Goroutine
+
+	// frame is the frame whose file:line line comes next.
+	var frame *Frame
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := stackGoroutineRe.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			result = append(result, Goroutine{ID: id, State: m[2]})
+			g = &result[len(result)-1]
+			frame = nil
+			continue
+		}
+
+		if g == nil {
+			continue
+		}
+
+		if m := stackFileRe.FindStringSubmatch(line); m != nil {
+			if frame == nil {
+				continue
+			}
+
+			frame.File = trimmer.trim(m[1])
+			frame.Line, _ = strconv.Atoi(m[2])
+			if m[3] != "" {
+				offset, _ := strconv.ParseInt(m[3], 16, 64)
+				frame.Offset = int(offset)
+			}
+
+			frame = nil
+			continue
+		}
+
+		switch {
+		case line == "":
+			// The end of this goroutine's stack.
+			g = nil
+			frame = nil
+		case strings.HasPrefix(line, "created by "):
+			m := stackCreatedRe.FindStringSubmatch(line)
+			g.CreatedBy = newFrame(m[1])
+			frame = g.CreatedBy
+		case strings.HasSuffix(line, ")"):
+			name := line
+			if idx := strings.LastIndex(line, "("); idx > 0 {
+				name = line[:idx]
+			}
+
+			g.Frames = append(g.Frames, *newFrame(name))
+			frame = &g.Frames[len(g.Frames)-1]
+		default:
+			// Something like "...additional frames elided...".
+			frame = nil
+		}
+	}
+
+	return result
+}
+
+// newFrame returns a Frame for the given fully qualified function name.
+func newFrame(function string) *Frame {
+	return &Frame{
+		Function: function,
+		Package:  functionPackage(function),
+	}
+}
+
+// functionPackage returns the import path of the package of the given
+// fully qualified function name. The package name ends at the first dot
+// after the last slash: the runtime escapes dots in the last element of
+// import paths as "%2e" and function names can't contain slashes.
+func functionPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+
+	return strings.ReplaceAll(function[:slash+1+dot], "%2e", ".")
+}
+
+// isRuntime returns whether the frame is part of the runtime. This includes
+// functions the runtime implements for other packages, such as sync.fatal,
+// which are recognized by their file.
+func (f *Frame) isRuntime() bool {
+	return f.Package == "runtime" || f.Function == "panic" ||
+		strings.Contains(f.File, "/src/runtime/")
+}
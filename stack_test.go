@@ -0,0 +1,104 @@
+package panicwrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testStackText = `panic: oh no
+
+goroutine 1 [running]:
+panic({0x4b8f40, 0xc000012345})
+	/usr/local/go/src/runtime/panic.go:770 +0x132
+github.com/foo/bar.(*Server).handle(0xc000010000, {0x4d2e60, 0x5})
+	/home/user/go/pkg/mod/github.com/foo/bar@v1.2.3/server.go:42 +0x1d
+main.main()
+	/home/user/app/main.go:7
+
+goroutine 7 [chan receive, 2 minutes]:
+main.worker(...)
+	/home/user/app/worker.go:12 +0x25
+created by main.main in goroutine 1
+	/home/user/app/main.go:5 +0x3c
+`
+
+func TestParseGoroutines(t *testing.T) {
+	actual := parseGoroutines(testStackText, nil)
+	expected := []Goroutine{
+		{
+			ID:    1,
+			State: "running",
+			Frames: []Frame{
+				{
+					Function: "panic",
+					File:     "/usr/local/go/src/runtime/panic.go",
+					Line:     770,
+					Offset:   0x132,
+				},
+				{
+					Function: "github.com/foo/bar.(*Server).handle",
+					Package:  "github.com/foo/bar",
+					File:     "/home/user/go/pkg/mod/github.com/foo/bar@v1.2.3/server.go",
+					Line:     42,
+					Offset:   0x1d,
+				},
+				{
+					Function: "main.main",
+					Package:  "main",
+					File:     "/home/user/app/main.go",
+					Line:     7,
+				},
+			},
+		},
+		{
+			ID:    7,
+			State: "chan receive, 2 minutes",
+			Frames: []Frame{
+				{
+					Function: "main.worker",
+					Package:  "main",
+					File:     "/home/user/app/worker.go",
+					Line:     12,
+					Offset:   0x25,
+				},
+			},
+			CreatedBy: &Frame{
+				Function: "main.main",
+				Package:  "main",
+				File:     "/home/user/app/main.go",
+				Line:     5,
+				Offset:   0x3c,
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestParseGoroutines_trimPaths(t *testing.T) {
+	trimmer := newPathTrimmer(&WrapConfig{TrimPaths: true}, testStackText)
+	gs := parseGoroutines(testStackText, trimmer)
+
+	if f := gs[0].Frames[0].File; f != "runtime/panic.go" {
+		t.Fatalf("bad: %s", f)
+	}
+	if f := gs[0].Frames[1].File; f != "github.com/foo/bar@v1.2.3/server.go" {
+		t.Fatalf("bad: %s", f)
+	}
+}
+
+func TestFunctionPackage(t *testing.T) {
+	cases := map[string]string{
+		"main.main":                           "main",
+		"github.com/foo/bar.(*Server).handle": "github.com/foo/bar",
+		"gopkg.in/yaml%2ev3.Unmarshal":        "gopkg.in/yaml.v3",
+		"panic":                               "",
+	}
+	for input, expected := range cases {
+		if actual := functionPackage(input); actual != expected {
+			t.Fatalf("%s: %s != %s", input, actual, expected)
+		}
+	}
+}
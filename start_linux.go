@@ -0,0 +1,101 @@
+package panicwrap
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// startChild starts the child with the priority and CPU affinity of the
+// configuration. They are per thread on Linux and inherited by new
+// processes, so the child is started from a thread of its own that has
+// them. That thread is thrown away afterwards, as its priority may not be
+// reversible.
+func startChild(c *WrapConfig, start func() (Process, error)) (Process, error) {
+	if c.Priority == nil && len(c.CPUAffinity) == 0 {
+		return start()
+	}
+
+	resCh := make(chan startResult)
+	go startOnThread(c, start, resCh)
+
+	res := <-resCh
+	return res.proc, res.err
+}
+
+type startResult struct {
+	proc Process
+	err  error
+}
+
+func startOnThread(c *WrapConfig, start func() (Process, error), resCh chan<- startResult) {
+	// Exiting the goroutine without unlocking it terminates the thread.
+	runtime.LockOSThread()
+
+	// Except for the main thread, which would keep the attributes.
+	// Holding on to it makes another goroutine run on another thread.
+	if syscall.Gettid() == syscall.Getpid() {
+		defer runtime.UnlockOSThread()
+
+		ch := make(chan startResult)
+		go startOnThread(c, start, ch)
+		resCh <- <-ch
+		return
+	}
+
+	if err := setThreadAttrs(c); err != nil {
+		resCh <- startResult{nil, err}
+		return
+	}
+
+	proc, err := start()
+	resCh <- startResult{proc, err}
+}
+
+// ioprioWhoProcess is IOPRIO_WHO_PROCESS, which with a thread ID sets
+// the IO priority of that thread.
+const ioprioWhoProcess = 1
+
+// setThreadAttrs sets the priority and the CPU affinity of the
+// configuration on the current thread.
+func setThreadAttrs(c *WrapConfig) error {
+	tid := syscall.Gettid()
+	if p := c.Priority; p != nil && p.Nice != 0 {
+		// The system call returns 20 minus the niceness.
+		prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+		if err != nil {
+			return err
+		}
+
+		nice := clampNice(20 - prio + p.Nice)
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil {
+			return err
+		}
+	}
+
+	if p := c.Priority; p != nil && p.IOClass != IOClassNone {
+		ioprio := uintptr(p.IOClass)<<13 | uintptr(p.IOLevel)
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprio)
+		if errno != 0 {
+			return errno
+		}
+	}
+
+	if len(c.CPUAffinity) > 0 {
+		var mask []uint64
+		for _, cpu := range c.CPUAffinity {
+			for len(mask) <= cpu/64 {
+				mask = append(mask, 0)
+			}
+			mask[cpu/64] |= 1 << (cpu % 64)
+		}
+
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY,
+			uintptr(tid), uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+		if errno != 0 {
+			return errno
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestStartChild(t *testing.T) {
+	var nice, ioprio int
+	var mask uint64
+	start := func() (Process, error) {
+		tid := syscall.Gettid()
+		prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, tid)
+		if err != nil {
+			return nil, err
+		}
+		nice = 20 - prio
+
+		r, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(tid), 0)
+		if errno != 0 {
+			return nil, errno
+		}
+		ioprio = int(r)
+
+		_, _, errno = syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, uintptr(tid), 8, uintptr(unsafe.Pointer(&mask)))
+		if errno != 0 {
+			return nil, errno
+		}
+
+		return nil, errors.New("not started")
+	}
+
+	parent := processNice(t)
+
+	_, err := startChild(&WrapConfig{
+		Priority:    &Priority{Nice: 3, IOClass: IOClassIdle},
+		CPUAffinity: []int{0},
+	}, start)
+	if err == nil || err.Error() != "not started" {
+		t.Fatalf("err: %v", err)
+	}
+
+	if nice != clampNice(parent+3) {
+		t.Fatalf("bad nice: %d", nice)
+	}
+	if ioprio != int(IOClassIdle)<<13 {
+		t.Fatalf("bad ioprio: %x", ioprio)
+	}
+	if mask != 1 {
+		t.Fatalf("bad affinity: %x", mask)
+	}
+
+	// The parent keeps its priority.
+	if n := processNice(t); n != parent {
+		t.Fatalf("bad parent niceness: %d", n)
+	}
+}
+
+// processNice returns the niceness of the main thread of the process,
+// which is what tools such as ps show.
+func processNice(t *testing.T) int {
+	// The niceness is the 19th field, and the name in the second one has
+	// no spaces.
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	nice, err := strconv.Atoi(strings.Fields(string(data))[18])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return nice
+}
+
+func TestPanicWrap_priority(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("priority")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s\n%s", err, stderr)
+	}
+
+	if expected := strconv.Itoa(clampNice(processNice(t) + 5)); stdout.String() != expected {
+		t.Fatalf("bad: %#v, want %s", stdout.String(), expected)
+	}
+}
+
+func TestWrap_invalidCPUAffinity(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:     func(string) {},
+		CPUAffinity: []int{-1},
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
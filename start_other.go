@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package panicwrap
+
+import "errors"
+
+func startChild(c *WrapConfig, start func() (Process, error)) (Process, error) {
+	if c.Priority != nil || len(c.CPUAffinity) > 0 {
+		return nil, errors.New("panicwrap: Priority and CPUAffinity aren't supported on this platform")
+	}
+
+	return start()
+}
@@ -0,0 +1,44 @@
+//go:build unix && !linux
+
+package panicwrap
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// startChild starts the child and then sets its niceness, which is per
+// process on this platform.
+func startChild(c *WrapConfig, start func() (Process, error)) (Process, error) {
+	if len(c.CPUAffinity) > 0 {
+		return nil, errors.New("panicwrap: CPUAffinity isn't supported on this platform")
+	}
+
+	p := c.Priority
+	if p == nil {
+		return start()
+	}
+	if p.IOClass != IOClassNone {
+		return nil, errors.New("panicwrap: Priority.IOClass is only supported on Linux")
+	}
+
+	nice, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	proc, err := start()
+	if err != nil || p.Nice == 0 {
+		return proc, err
+	}
+
+	err = syscall.Setpriority(syscall.PRIO_PROCESS, proc.Pid(), clampNice(nice+p.Nice))
+	if err != nil {
+		proc.Signal(os.Kill)
+		proc.Wait()
+		return nil, err
+	}
+
+	return proc, nil
+}
@@ -0,0 +1,56 @@
+package panicwrap
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"syscall"
+)
+
+var procSetProcessAffinityMask = syscall.NewLazyDLL("kernel32.dll").NewProc("SetProcessAffinityMask")
+
+// processSetInformation is the PROCESS_SET_INFORMATION access right.
+const processSetInformation = 0x0200
+
+// startChild starts the child and then sets its CPU affinity.
+func startChild(c *WrapConfig, start func() (Process, error)) (Process, error) {
+	if c.Priority != nil {
+		return nil, errors.New("panicwrap: Priority isn't supported on Windows")
+	}
+
+	proc, err := start()
+	if err != nil || len(c.CPUAffinity) == 0 {
+		return proc, err
+	}
+
+	if err := setAffinity(proc.Pid(), c.CPUAffinity); err != nil {
+		proc.Signal(os.Kill)
+		proc.Wait()
+		return nil, err
+	}
+
+	return proc, nil
+}
+
+func setAffinity(pid int, cpus []int) error {
+	var mask uintptr
+	for _, cpu := range cpus {
+		if cpu >= bits.UintSize {
+			return fmt.Errorf("panicwrap: CPUAffinity only supports the first %d CPUs on Windows", bits.UintSize)
+		}
+		mask |= 1 << cpu
+	}
+
+	h, err := syscall.OpenProcess(processSetInformation, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+
+	if r, _, err := procSetProcessAffinityMask.Call(uintptr(h), mask); r == 0 {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package panicwrap
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// startupEnvKey passes the file descriptor of the pipe on which the child
+// tells the parent that it came up. See WrapConfig.DetectStartup.
+const startupEnvKey = "PANICWRAP_STARTUP_FD"
+
+// maxStartupOutput limits the output that is held back until the child
+// came up. Beyond it, the output is forwarded anyway.
+const maxStartupOutput = 64 << 10
+
+// signalStartup tells the parent that the child came up, if it asked.
+func signalStartup() {
+	v := os.Getenv(startupEnvKey)
+	if v == "" {
+		return
+	}
+	os.Unsetenv(startupEnvKey)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "panicwrap-startup")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+// startupWriter holds back the stderr output of the child until it came
+// up, so that the output of a child that fails before is reported as its
+// crash rather than forwarded.
+type startupWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	held    []byte
+	passing bool
+	started bool
+
+	// budget is the WrapConfig.MemoryBudget, if any, that the held output
+	// is taken from.
+	budget *memoryBudget
+}
+
+func (s *startupWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.passing {
+		return s.w.Write(p)
+	}
+
+	if !s.budget.reserve(useStartup, len(p)) {
+		// Holding back any more would take the memory that panics need.
+		// The output held so far is still reported if it fails to
+		// start.
+		s.passing = true
+		s.w.Write(s.held)
+		s.w.Write(p)
+		return len(p), nil
+	}
+
+	s.held = append(s.held, p...)
+	if len(s.held) > maxStartupOutput {
+		// Holding back any more could block the child for good. The
+		// output held so far is still reported if it fails to start.
+		s.passing = true
+		s.w.Write(s.held)
+		s.budget.release(len(s.held) - maxStartupOutput)
+		s.held = s.held[:maxStartupOutput]
+	}
+
+	return len(p), nil
+}
+
+// start forwards the held output once the child came up.
+func (s *startupWriter) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+	if !s.passing {
+		s.passing = true
+		s.w.Write(s.held)
+	}
+	s.budget.release(len(s.held))
+	s.held = nil
+}
+
+// finish is called once the child exited, with whether it failed. It
+// returns the output of a child that failed without coming up, and
+// forwards the held output otherwise.
+func (s *startupWriter) finish(failed bool) (output string, startupFailed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return "", false
+	}
+
+	output = string(s.held)
+	if !s.passing {
+		s.passing = true
+		if !failed {
+			s.w.Write(s.held)
+		}
+	}
+	s.budget.release(len(s.held))
+	s.held = nil
+
+	return output, failed
+}
+
+// watchStartup starts s once the child writes to the read end of the
+// startup pipe, and closes done once it did or the pipe ended.
+func watchStartup(r *os.File, s *startupWriter, done chan<- struct{}) {
+	defer close(done)
+	defer r.Close()
+
+	if n, _ := r.Read(make([]byte, 1)); n == 1 {
+		s.start()
+	}
+}
@@ -0,0 +1,98 @@
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStartupWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	s := &startupWriter{w: out}
+
+	s.Write([]byte("early\n"))
+	if out.Len() != 0 {
+		t.Fatalf("should hold back: %#v", out.String())
+	}
+
+	s.start()
+	s.Write([]byte("later\n"))
+	if out.String() != "early\nlater\n" {
+		t.Fatalf("bad: %#v", out.String())
+	}
+	if _, failed := s.finish(true); failed {
+		t.Fatal("came up")
+	}
+}
+
+func TestStartupWriter_failed(t *testing.T) {
+	out := new(bytes.Buffer)
+	s := &startupWriter{w: out}
+
+	s.Write([]byte("no such library\n"))
+	output, failed := s.finish(true)
+	if !failed || output != "no such library\n" || out.Len() != 0 {
+		t.Fatalf("bad: %t %#v %#v", failed, output, out.String())
+	}
+}
+
+func TestStartupWriter_exitedCleanly(t *testing.T) {
+	out := new(bytes.Buffer)
+	s := &startupWriter{w: out}
+
+	s.Write([]byte("usage\n"))
+	if _, failed := s.finish(false); failed {
+		t.Fatal("shouldn't fail")
+	}
+	if out.String() != "usage\n" {
+		t.Fatalf("should forward: %#v", out.String())
+	}
+}
+
+func TestStartupWriter_overflow(t *testing.T) {
+	out := new(bytes.Buffer)
+	s := &startupWriter{w: out}
+
+	s.Write(bytes.Repeat([]byte("x"), maxStartupOutput+1))
+	if out.Len() != maxStartupOutput+1 {
+		t.Fatalf("should forward once full: %d", out.Len())
+	}
+	if output, failed := s.finish(true); !failed || len(output) != maxStartupOutput {
+		t.Fatalf("bad: %t %d", failed, len(output))
+	}
+}
+
+func TestPanicWrap_startup(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("startup")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err == nil {
+		t.Fatal("should fail")
+	}
+
+	expected := `startup: "error while loading shared libraries: libfoo.so\n"`
+	if !strings.Contains(stdout.String(), expected) {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+}
+
+func TestPanicWrap_startupCameUp(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("startup", "up")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err == nil {
+		t.Fatal("should fail")
+	}
+
+	if !strings.Contains(stdout.String(), "panic: ") || strings.Contains(stdout.String(), "startup: ") {
+		t.Fatalf("bad: %#v", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "came up\n") {
+		t.Fatalf("bad: %#v", stderr.String())
+	}
+}
@@ -0,0 +1,100 @@
+package panicwrap
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CrashState is the small record of past crashes that the parent maintains
+// in WrapConfig.StateFile. Since it is kept on disk, it survives restarts
+// of the parent and answers whether, and when, the binary has crashed on
+// this host.
+type CrashState struct {
+	// Crashes is the total number of panics recorded.
+	Crashes int `json:"crashes"`
+
+	// FirstCrash and LastCrash are the times of the first and the most
+	// recent recorded panic.
+	FirstCrash time.Time `json:"first_crash"`
+	LastCrash  time.Time `json:"last_crash"`
+
+	// LastFingerprint is the PanicInfo.Fingerprint of the most recent
+	// recorded panic.
+	LastFingerprint string `json:"last_fingerprint"`
+}
+
+// LoadCrashState reads the crash state from the given path. If the file
+// doesn't exist yet, an empty state is returned.
+func LoadCrashState(path string) (*CrashState, error) {
+	var s CrashState
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// record adds a panic with the given fingerprint to the state.
+func (s *CrashState) record(fp string, now time.Time) {
+	if s.Crashes == 0 {
+		s.FirstCrash = now
+	}
+
+	s.Crashes++
+	s.LastCrash = now
+	s.LastFingerprint = fp
+}
+
+// save atomically writes the state to the given path, so that a crash of
+// the parent midway never leaves a truncated file behind.
+func (s *CrashState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// recordCrashState records a panic in the state file at the given path and
+// returns the updated state. This is best-effort: a state file that can't
+// be read or written must never get in the way of handling the panic, so
+// nil is returned in that case.
+func recordCrashState(path, fp string, now time.Time) *CrashState {
+	s, err := LoadCrashState(path)
+	if err != nil {
+		// Start over rather than failing forever on a corrupt file.
+		s = new(CrashState)
+	}
+
+	s.record(fp, now)
+	if err := s.save(path); err != nil {
+		return nil
+	}
+
+	return s
+}
@@ -0,0 +1,57 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadCrashState_missing(t *testing.T) {
+	s, err := LoadCrashState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if s.Crashes != 0 {
+		t.Fatalf("bad: %#v", s)
+	}
+}
+
+func TestRecordCrashState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	recordCrashState(path, "aaa", first)
+	if s := recordCrashState(path, "bbb", second); s == nil {
+		t.Fatal("state should be recorded")
+	}
+
+	s, err := LoadCrashState(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if s.Crashes != 2 {
+		t.Fatalf("bad: %d", s.Crashes)
+	}
+	if !s.FirstCrash.Equal(first) || !s.LastCrash.Equal(second) {
+		t.Fatalf("bad: %#v", s)
+	}
+	if s.LastFingerprint != "bbb" {
+		t.Fatalf("bad: %s", s.LastFingerprint)
+	}
+}
+
+func TestRecordCrashState_corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{nope"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := recordCrashState(path, "aaa", time.Now())
+	if s == nil || s.Crashes != 1 {
+		t.Fatalf("bad: %#v", s)
+	}
+}
@@ -0,0 +1,200 @@
+package panicwrap
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WrapStats is a snapshot of what the parent of the running Wrap call
+// knows about its children. See Stats.
+type WrapStats struct {
+	// Started is when Wrap started, and Uptime how long ago that was.
+	Started time.Time     `json:"started"`
+	Uptime  time.Duration `json:"uptime"`
+
+	// Children has the state of the child, or of every worker.
+	Children []ChildStats `json:"children"`
+
+	// Restarts is the number of times a child was restarted, across all
+	// workers.
+	Restarts int `json:"restarts"`
+
+	// Crashes is the number of crashes that were handled, by kind,
+	// including the ones of InjectCrash, and Dumps the number of
+	// goroutine dumps.
+	Crashes map[CrashKind]int `json:"crashes,omitempty"`
+	Dumps   int               `json:"dumps"`
+
+	// StdoutBytes and StderrBytes are the number of bytes of output the
+	// children wrote. Stdout isn't counted while it goes to the stdout of
+	// the parent directly, which is when WrapConfig.Stdout is unset or a
+	// file.
+	StdoutBytes int64 `json:"stdout_bytes"`
+	StderrBytes int64 `json:"stderr_bytes"`
+
+	// StdoutSuppressed and StderrSuppressed are the number of lines of
+	// output that WrapConfig.OutputRate dropped or collapsed as
+	// duplicates.
+	StdoutSuppressed int64 `json:"stdout_suppressed"`
+	StderrSuppressed int64 `json:"stderr_suppressed"`
+
+	// BufferedBytes is the output the parent holds in memory for the
+	// children, out of WrapConfig.MemoryBudget, not counting the read
+	// buffers. It is only counted with a MemoryBudget.
+	BufferedBytes int64 `json:"buffered_bytes"`
+
+	// HandlersSucceeded and HandlersFailed are the number of crashes and
+	// dumps whose handlers returned, and whose handlers panicked or
+	// required HandlerCommands failed.
+	HandlersSucceeded int `json:"handlers_succeeded"`
+	HandlersFailed    int `json:"handlers_failed"`
+
+	// Benchmark is what the latest Benchmark in the parent measured, if
+	// any. See CommandBench.
+	Benchmark []BenchResult `json:"benchmark,omitempty"`
+}
+
+// ChildStats is the state of a child in WrapStats.
+type ChildStats struct {
+	// Worker is the index of the worker. See WrapConfig.Workers.
+	Worker int `json:"worker"`
+
+	// PID is the process ID of the child if it is running, and 0
+	// otherwise, such as while it waits to be restarted.
+	PID int `json:"pid,omitempty"`
+
+	// Stopping is set once the child was asked to shut down and won't be
+	// restarted.
+	Stopping bool `json:"stopping,omitempty"`
+}
+
+// Stats returns a snapshot of the statistics of the running Wrap call.
+func Stats() (*WrapStats, error) {
+	ch := activeChild.Load()
+	if ch == nil {
+		return nil, errors.New("panicwrap: not wrapping a child")
+	}
+
+	return ch.stats.snapshot(ch), nil
+}
+
+// wrapStats gathers the statistics of a Wrap call, which all of its
+// children share.
+type wrapStats struct {
+	clock   Clock
+	started time.Time
+
+	mu                sync.Mutex
+	restarts          int
+	crashes           map[CrashKind]int
+	dumps             int
+	handlersSucceeded int
+	handlersFailed    int
+	bench             []BenchResult
+
+	stdoutBytes atomic.Int64
+	stderrBytes atomic.Int64
+
+	stdoutSuppressed atomic.Int64
+	stderrSuppressed atomic.Int64
+}
+
+func newWrapStats(clock Clock) *wrapStats {
+	return &wrapStats{
+		clock:   clock,
+		started: clock.Now(),
+		crashes: make(map[CrashKind]int),
+	}
+}
+
+func (s *wrapStats) restarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restarts++
+}
+
+// crashed records a crash of the given kind and the outcome of its
+// handlers.
+func (s *wrapStats) crashed(kind CrashKind, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crashes[kind]++
+	s.handlerDone(err)
+}
+
+// dumped records a goroutine dump and the outcome of its handler.
+func (s *wrapStats) dumped(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dumps++
+	s.handlerDone(err)
+}
+
+// benched records the results of Benchmark.
+func (s *wrapStats) benched(results []BenchResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bench = results
+}
+
+func (s *wrapStats) handlerDone(err error) {
+	if err != nil {
+		s.handlersFailed++
+	} else {
+		s.handlersSucceeded++
+	}
+}
+
+func (s *wrapStats) snapshot(ch *child) *WrapStats {
+	st := &WrapStats{
+		Started:     s.started,
+		Uptime:      s.clock.Now().Sub(s.started),
+		StdoutBytes: s.stdoutBytes.Load(),
+		StderrBytes: s.stderrBytes.Load(),
+
+		StdoutSuppressed: s.stdoutSuppressed.Load(),
+		StderrSuppressed: s.stderrSuppressed.Load(),
+	}
+	st.BufferedBytes = ch.budget.inUse()
+
+	ch.each(func(w *child) {
+		cs := ChildStats{Worker: w.index, Stopping: w.stopping()}
+		w.with(func(p Process) error {
+			cs.PID = p.Pid()
+			return nil
+		})
+		st.Children = append(st.Children, cs)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.Restarts = s.restarts
+	st.Dumps = s.dumps
+	st.HandlersSucceeded = s.handlersSucceeded
+	st.HandlersFailed = s.handlersFailed
+	st.Benchmark = slices.Clone(s.bench)
+	if len(s.crashes) > 0 {
+		st.Crashes = make(map[CrashKind]int, len(s.crashes))
+		for k, n := range s.crashes {
+			st.Crashes[k] = n
+		}
+	}
+
+	return st
+}
+
+// countingWriter adds the number of bytes written through it to n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,79 @@
+package panicwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	if _, err := Stats(); err == nil {
+		t.Fatal("should fail without a child")
+	}
+
+	e := &fakeExecutor{
+		stdout: []string{"hello\n"},
+		stderr: []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	var snapshots []*WrapStats
+	_, _, err := Wrap(&WrapConfig{
+		InfoHandler: func(*PanicInfo) {
+			st, err := Stats()
+			if err != nil {
+				t.Errorf("err: %s", err)
+				return
+			}
+			snapshots = append(snapshots, st)
+		},
+		Stdout:   new(bytes.Buffer),
+		Writer:   new(bytes.Buffer),
+		Executor: e,
+		Restart:  &RestartPolicy{MaxRestarts: 1, Backoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("bad: %d", len(snapshots))
+	}
+
+	// The second crash is seen after the first one was handled and the
+	// child restarted.
+	st := snapshots[1]
+	if st.Restarts != 1 || st.HandlersSucceeded != 1 || st.HandlersFailed != 0 || st.Dumps != 0 {
+		t.Fatalf("bad: %#v", st)
+	}
+	if !reflect.DeepEqual(st.Crashes, map[CrashKind]int{KindPanic: 1}) {
+		t.Fatalf("bad: %#v", st.Crashes)
+	}
+	if st.StdoutBytes != 2*int64(len(e.stdout[0])) || st.StderrBytes != 2*int64(len(e.stderr[0])) {
+		t.Fatalf("bad: %d, %d", st.StdoutBytes, st.StderrBytes)
+	}
+	if len(st.Children) != 1 || st.Children[0].Worker != 0 || st.Started.IsZero() || st.Uptime < 0 {
+		t.Fatalf("bad: %#v", st)
+	}
+}
+
+func TestWrapStats_json(t *testing.T) {
+	s := newWrapStats(realClock{})
+	s.crashed(KindDeadlock, nil)
+	s.dumped(&HandlerPanicError{})
+	s.restarted()
+
+	data, err := json.Marshal(s.snapshot(new(child)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var st WrapStats
+	if err := json.Unmarshal(data, &st); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if st.Crashes[KindDeadlock] != 1 || st.Dumps != 1 || st.HandlersFailed != 1 || st.HandlersSucceeded != 1 || st.Restarts != 1 {
+		t.Fatalf("bad: %s", data)
+	}
+}
@@ -0,0 +1,24 @@
+package panicwrap
+
+import (
+	"bytes"
+	"io"
+)
+
+// The lines around the output that WrapConfig.StreamPanics forwards as it
+// arrives. Whether it was a crash is only known at the end.
+const (
+	streamStartLine    = "panicwrap: possible crash, forwarding it as it arrives\n"
+	streamCrashLine    = "panicwrap: end of the crash\n"
+	streamNotCrashLine = "panicwrap: end of the output, which wasn't a crash\n"
+)
+
+// writeStreamEnd writes the line that ends the streamed output, on a line
+// of its own.
+func writeStreamEnd(w io.Writer, streamed []byte, line string) {
+	if len(streamed) > 0 && !bytes.HasSuffix(streamed, []byte("\n")) {
+		line = "\n" + line
+	}
+
+	io.WriteString(w, line)
+}
@@ -0,0 +1,82 @@
+package panicwrap
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackPanic_stream(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, 0, clock, defaultTrackSize, true, headerRules{}, nil, nil, result)
+
+	// The panic is out before the child exited.
+	w.Write([]byte("starting\npanic: boom\n"))
+	<-clock.waiting
+	for out.String() != "starting\n"+streamStartLine+"panic: boom\n" {
+		time.Sleep(time.Millisecond)
+	}
+
+	w.Write([]byte("\ngoroutine 1 [running]:\n"))
+	w.Close()
+	if text := <-result; text != "panic: boom\n\ngoroutine 1 [running]:\n" {
+		t.Fatalf("bad: %q", text)
+	}
+	if out.String() != "starting\n"+streamStartLine+"panic: boom\n\ngoroutine 1 [running]:\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestTrackPanic_streamNotPanic(t *testing.T) {
+	clock := newFakeClock()
+	r, w := io.Pipe()
+	out := new(syncBuffer)
+	result := make(chan string, 1)
+	go trackPanic(r, out, time.Second, 0, clock, defaultTrackSize, true, headerRules{}, nil, nil, result)
+
+	w.Write([]byte("panic: not really"))
+	<-clock.waiting
+	clock.Advance(time.Second)
+	w.Write([]byte("still running\n"))
+	w.Close()
+
+	if text, ok := <-result; ok {
+		t.Fatalf("shouldn't be a panic: %q", text)
+	}
+	expected := streamStartLine + "panic: not really\n" + streamNotCrashLine + "still running\n"
+	if out.String() != expected {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestPanicWrap_streamPanics(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	p := helperProcess("stream-panics")
+	p.Stdout = stdout
+	p.Stderr = stderr
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if wrapRe.FindString(stdout.String()) == "" {
+		t.Fatalf("didn't wrap: %#v", stdout.String())
+	}
+
+	// The panic is forwarded once, between the lines.
+	out := stderr.String()
+	start := strings.Index(out, streamStartLine)
+	end := strings.Index(out, streamCrashLine)
+	if start < 0 || end < start || strings.Count(out, "panic: uh oh") != 1 {
+		t.Fatalf("bad: %#v", out)
+	}
+	if !strings.Contains(out[start:end], "panic: uh oh") {
+		t.Fatalf("bad: %#v", out)
+	}
+}
@@ -0,0 +1,133 @@
+package panicwrap
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// subprocessDetectDuration is WrapConfig.DetectDuration for the stderr of
+// a subprocess.
+const subprocessDetectDuration = 300 * time.Millisecond
+
+// subprocessReportWait is how long Subprocess.Wait waits for the crash of
+// the subprocess to be reported once it exited, in case a process it
+// started still holds its stderr.
+const subprocessReportWait = time.Second
+
+// Subprocess is a command started with StartSubprocess.
+type Subprocess struct {
+	Cmd *exec.Cmd
+
+	// done is closed once the stderr of the command ended and its crash,
+	// if any, was reported.
+	done chan struct{}
+}
+
+// Wait waits for the command to exit like Cmd.Wait, and for its crash to
+// be reported to the parent, if it crashed.
+func (s *Subprocess) Wait() error {
+	err := s.Cmd.Wait()
+	select {
+	case <-s.done:
+	case <-time.After(subprocessReportWait):
+	}
+
+	return err
+}
+
+type subprocessCrashMessage struct {
+	PID  int      `json:"pid"`
+	Args []string `json:"args"`
+	Text string   `json:"text"`
+}
+
+// StartSubprocess starts the command like cmd.Start, on a stderr pipe of
+// its own, so that its crashes are told apart from those of the child
+// and of its other subprocesses, rather than mixed into the stderr of the
+// child. It is meant to be called from the child. The stderr of the
+// command goes on to cmd.Stderr, or the stderr of the child if it is
+// unset, with each line prefixed with the process ID of the command in
+// brackets if label is set. A panic of the command, or of the processes
+// it starts in turn, is reported to the parent, which passes it to
+// WrapConfig.SubprocessHandler. Wait for the command with Subprocess.Wait
+// rather than cmd.Wait, so that the report isn't cut short.
+//
+// Without a control channel to the parent, the command is started as
+// usual. See WrapConfig.Control.
+func StartSubprocess(cmd *exec.Cmd, label bool) (*Subprocess, error) {
+	s := &Subprocess{Cmd: cmd, done: make(chan struct{})}
+	if activeControl.Load() == nil {
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		close(s.done)
+		return s, nil
+	}
+
+	out := cmd.Stderr
+	if out == nil {
+		out = os.Stderr
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	pid := cmd.Process.Pid
+	if label {
+		prefix := "[" + strconv.Itoa(pid) + "] "
+		out = newPrefixWriter(out, func() string { return prefix })
+	}
+
+	// The pipe ends once the command and everything that shares its
+	// stderr exited, which is when what was tracked last counts as a
+	// crash.
+	result := make(chan string)
+	go trackPanic(r, out, subprocessDetectDuration, subprocessDetectDuration, realClock{}, defaultTrackSize, false, headerRules{}, nil, nil, result)
+	go func() {
+		defer close(s.done)
+		defer r.Close()
+		text := <-result
+		if text == "" {
+			return
+		}
+
+		out.Write([]byte(text))
+		sendControl(messageSubprocessCrash, subprocessCrashMessage{PID: pid, Args: cmd.Args, Text: text})
+	}()
+
+	return s, nil
+}
+
+// subprocessCrash describes the crash of a subprocess of the child with
+// the given process ID.
+func subprocessCrash(c *WrapConfig, m *subprocessCrashMessage, childPID, worker int) *PanicInfo {
+	info := &PanicInfo{
+		Text:       scrub(c, m.Text),
+		Subprocess: true,
+		PID:        m.PID,
+		ParentPID:  childPID,
+		Args:       m.Args,
+		Worker:     worker,
+	}
+	info.Values = parseValues(info.Text, latestQuirks)
+	if len(info.Values) > 0 {
+		info.Value = info.Values[0]
+	}
+	trimmer := newPathTrimmer(c, info.Text)
+	info.Fingerprint = fingerprint(info.Text, trimmer)
+	info.Goroutines = parseGoroutines(info.Text, trimmer)
+	info.Kind = classify(info.Text, info.Value)
+	info.Severity = severity(c, info.Kind)
+
+	return info
+}
@@ -0,0 +1,57 @@
+package panicwrap
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SupervisorPolicy decides what Wrap does when the process already runs
+// under something that captures its crashes. See WrapConfig.Supervisor.
+type SupervisorPolicy int
+
+const (
+	// SupervisorIgnore wraps the process anyway. This is the default.
+	SupervisorIgnore SupervisorPolicy = iota
+
+	// SupervisorSkip doesn't wrap the process. Wrap returns as it does in
+	// the child, so the program runs on in this process and its crashes
+	// are left to the supervisor. Wrapped still returns false.
+	SupervisorSkip
+)
+
+// The supervisors DetectSupervisor finds.
+const (
+	// SupervisorPanicwrap is the parent of another panicwrap layer, one
+	// that uses a different cookie, such as a launcher that wraps itself
+	// and starts this program.
+	SupervisorPanicwrap = "panicwrap"
+
+	// SupervisorSystemd is a systemd service with systemd-coredump
+	// capturing the crashes.
+	SupervisorSystemd = "systemd-coredump"
+
+	// SupervisorDebugger is a debugger attached to the process. This is
+	// only detected on Linux.
+	SupervisorDebugger = "debugger"
+)
+
+// DetectSupervisor returns the supervisor that captures the crashes of
+// the current process, or an empty string if there is none that it knows
+// of.
+func DetectSupervisor() string {
+	if pid := os.Getenv(parentPIDEnvKey); pid != "" && pid == strconv.Itoa(os.Getppid()) {
+		return SupervisorPanicwrap
+	}
+
+	if tracerPID() != 0 {
+		return SupervisorDebugger
+	}
+
+	// systemd sets INVOCATION_ID for the processes of its services.
+	if os.Getenv("INVOCATION_ID") != "" && strings.Contains(corePattern(), "systemd-coredump") {
+		return SupervisorSystemd
+	}
+
+	return ""
+}
@@ -0,0 +1,28 @@
+package panicwrap
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tracerPID returns the process ID of the process tracing the current
+// one, such as a debugger, or 0.
+func tracerPID() int {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v, ok := strings.CutPrefix(s.Text(), "TracerPid:"); ok {
+			pid, _ := strconv.Atoi(strings.TrimSpace(v))
+			return pid
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package panicwrap
+
+func tracerPID() int {
+	return 0
+}
@@ -0,0 +1,62 @@
+package panicwrap
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestDetectSupervisor(t *testing.T) {
+	t.Setenv(parentPIDEnvKey, "")
+	t.Setenv("INVOCATION_ID", "")
+	if tracerPID() != 0 {
+		t.Skip("running under a debugger")
+	}
+
+	if s := DetectSupervisor(); s != "" {
+		t.Fatalf("bad: %q", s)
+	}
+}
+
+func TestDetectSupervisor_panicwrap(t *testing.T) {
+	t.Setenv(parentPIDEnvKey, strconv.Itoa(os.Getppid()))
+
+	if s := DetectSupervisor(); s != SupervisorPanicwrap {
+		t.Fatalf("bad: %q", s)
+	}
+}
+
+func TestDetectSupervisor_inherited(t *testing.T) {
+	t.Setenv(parentPIDEnvKey, strconv.Itoa(os.Getppid()+1))
+	t.Setenv("INVOCATION_ID", "")
+	if tracerPID() != 0 {
+		t.Skip("running under a debugger")
+	}
+
+	if s := DetectSupervisor(); s != "" {
+		t.Fatalf("bad: %q", s)
+	}
+}
+
+func TestWrap_supervisorSkip(t *testing.T) {
+	t.Setenv(parentPIDEnvKey, strconv.Itoa(os.Getppid()))
+	e := &fakeExecutor{}
+
+	done, exitStatus, err := Wrap(&WrapConfig{
+		Handler:    func(string) {},
+		Supervisor: SupervisorSkip,
+		Executor:   e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if done || exitStatus != -1 {
+		t.Fatalf("bad: %v %d", done, exitStatus)
+	}
+	if e.started != 0 {
+		t.Fatalf("shouldn't start a child: %d", e.started)
+	}
+	if Wrapped(nil) {
+		t.Fatal("shouldn't be wrapped")
+	}
+}
@@ -0,0 +1,11 @@
+package panicwrap
+
+// Supported reports whether Wrap can wrap the program on this platform.
+// Where it can't, such as on js/wasm, wasip1 and plan9, which can't
+// execute themselves, Wrap only validates its configuration and returns
+// as if it were called in the child, so the program runs as usual without
+// panic handling. This lets programs built for several platforms call
+// Wrap the same way on all of them.
+func Supported() bool {
+	return supported
+}
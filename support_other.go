@@ -0,0 +1,5 @@
+//go:build js || wasip1 || plan9
+
+package panicwrap
+
+const supported = false
@@ -0,0 +1,19 @@
+package panicwrap
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestSupported(t *testing.T) {
+	switch runtime.GOOS {
+	case "js", "wasip1", "plan9":
+		if Supported() {
+			t.Fatal("shouldn't be supported")
+		}
+	default:
+		if !Supported() {
+			t.Fatal("should be supported")
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package panicwrap
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// DefaultPanicTemplate is a short layout for a crash, for messages that
+// people read, such as an email or a chat message. See PanicTemplate.
+const DefaultPanicTemplate = `{{.Kind}} in {{.Executable}} (pid {{.PID}}): {{truncate 200 .Value}}
+{{range topFrames 5 .}}  {{.Function}}
+    {{.File}}:{{.Line}}
+{{end}}`
+
+// PanicTemplate formats crashes with a text/template, so that the places
+// that show them to people share a layout rather than each hard-coding
+// its own. The template is executed with the *PanicInfo of the crash, so
+// all of its fields are available, along with these functions:
+//
+//	truncate N S  S cut to N characters, with "..." if it was longer
+//	topFrames N   the top N frames of the goroutine that crashed, given the
+//	              PanicInfo, or of a Goroutine
+//	indent N S    S with every line indented by N spaces
+//
+// For example:
+//
+//	{{.Kind}}: {{truncate 80 .Value}}
+//	{{range topFrames 3 .}}{{.Function}} at {{.File}}:{{.Line}}
+//	{{end}}
+type PanicTemplate struct {
+	t *template.Template
+}
+
+// ParsePanicTemplate parses a PanicTemplate.
+func ParsePanicTemplate(text string) (*PanicTemplate, error) {
+	t, err := template.New("panic").Funcs(template.FuncMap{
+		"truncate":  truncate,
+		"topFrames": topFrames,
+		"indent":    indent,
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PanicTemplate{t: t}, nil
+}
+
+// Format formats the crash.
+func (t *PanicTemplate) Format(info *PanicInfo) (string, error) {
+	var b bytes.Buffer
+	if err := t.t.Execute(&b, info); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// formatPanic returns the text of the crash that PanicWriter receives,
+// which is formatted with WrapConfig.PanicTemplate if that is set.
+func formatPanic(c *WrapConfig, info *PanicInfo) string {
+	if c.PanicTemplate == "" {
+		return info.Text
+	}
+
+	t, err := ParsePanicTemplate(c.PanicTemplate)
+	if err == nil {
+		var text string
+		if text, err = t.Format(info); err == nil {
+			return text
+		}
+	}
+	reportInternal(c, "formatting a panic", err)
+	return info.Text
+}
+
+// truncate cuts s to n characters.
+func truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
+
+// topFrames returns the top n frames of the goroutine that crashed, given
+// a *PanicInfo, or of the given Goroutine.
+func topFrames(n int, v interface{}) ([]Frame, error) {
+	var frames []Frame
+	switch v := v.(type) {
+	case *PanicInfo:
+		if len(v.Goroutines) > 0 {
+			frames = v.Goroutines[0].Frames
+		}
+	case Goroutine:
+		frames = v.Frames
+	case *Goroutine:
+		frames = v.Frames
+	default:
+		return nil, fmt.Errorf("topFrames of a %T", v)
+	}
+
+	return frames[:min(n, len(frames))], nil
+}
+
+// indent indents every line of s by n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
@@ -0,0 +1,82 @@
+package panicwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPanicTemplate(t *testing.T) {
+	info := &PanicInfo{Text: testPanicText}
+	analyzePanic(&WrapConfig{Clock: realClock{}}, newCrashTracker(0), info)
+	info.Executable = "/usr/bin/app"
+	info.PID = 42
+
+	tmpl, err := ParsePanicTemplate(DefaultPanicTemplate)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	text, err := tmpl.Format(info)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "panic in /usr/bin/app (pid 42): runtime error: index out of range [5] with length 3\n" +
+		"  main.lookup\n    /home/user/app/main.go:12\n"
+	if !strings.HasPrefix(text, expected) {
+		t.Fatalf("bad: %q", text)
+	}
+}
+
+func TestPanicTemplate_funcs(t *testing.T) {
+	info := &PanicInfo{
+		Value:      "a very long value",
+		Goroutines: []Goroutine{{Frames: []Frame{{Function: "a"}, {Function: "b"}, {Function: "c"}}}},
+	}
+
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{`{{truncate 6 .Value}}`, "a very..."},
+		{`{{truncate 60 .Value}}`, "a very long value"},
+		{`{{range topFrames 2 .}}{{.Function}}{{end}}`, "ab"},
+		{`{{range topFrames 5 (index .Goroutines 0)}}{{.Function}}{{end}}`, "abc"},
+		{`{{indent 2 "a\nb"}}`, "  a\n  b"},
+	}
+	for _, tc := range cases {
+		tmpl, err := ParsePanicTemplate(tc.text)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		text, err := tmpl.Format(info)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.text, err)
+		}
+		if text != tc.expected {
+			t.Errorf("%s: got %q, want %q", tc.text, text, tc.expected)
+		}
+	}
+
+	tmpl, _ := ParsePanicTemplate(`{{topFrames 1 .Value}}`)
+	if _, err := tmpl.Format(info); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestWrap_panicTemplate(t *testing.T) {
+	panics := new(bytes.Buffer)
+	_, _, err := Wrap(&WrapConfig{
+		PanicWriter:   panics,
+		PanicTemplate: "{{.Kind}}: {{.Value}}\n",
+		Writer:        new(bytes.Buffer),
+		Executor:      &fakeExecutor{stderr: []string{testPanicText}, exit: ProcessExit{Status: 2}},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if panics.String() != "panic: runtime error: index out of range [5] with length 3\n" {
+		t.Fatalf("bad: %q", panics.String())
+	}
+}
@@ -0,0 +1,230 @@
+package panicwrap
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// terminal is the terminal of the parent while the child runs on a
+// pseudo-terminal of its own. See WrapConfig.Terminal.
+type terminal struct {
+	in    *os.File
+	saved syscall.Termios
+	winch chan os.Signal
+
+	// master is the pseudo-terminal of the running child, if any.
+	mu     sync.Mutex
+	master *os.File
+}
+
+// newTerminal starts passing the input of the given terminal to the
+// pseudo-terminal of the running child. If it isn't a terminal, nil is
+// returned.
+func newTerminal(in *os.File) (*terminal, error) {
+	t := &terminal{in: in, winch: make(chan os.Signal, 1)}
+	if err := ioctl(in, syscall.TCGETS, unsafe.Pointer(&t.saved)); err != nil {
+		return nil, nil
+	}
+
+	signal.Notify(t.winch, syscall.SIGWINCH)
+	go func() {
+		for range t.winch {
+			t.mu.Lock()
+			if t.master != nil {
+				t.resize(t.master)
+			}
+			t.mu.Unlock()
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := in.Read(buf)
+			if n > 0 {
+				// Input that arrives while no child runs is dropped.
+				t.mu.Lock()
+				master := t.master
+				t.mu.Unlock()
+				if master != nil {
+					master.Write(buf[:n])
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return t, nil
+}
+
+// stop stops following the window size of the terminal.
+func (t *terminal) stop() {
+	signal.Stop(t.winch)
+	close(t.winch)
+}
+
+// makeRaw puts the terminal in raw mode, so that everything typed is
+// passed on as is.
+func (t *terminal) makeRaw() error {
+	raw := t.saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	// Output processing is left on, so that what the parent itself
+	// writes while the child runs still starts its lines at the left.
+	return ioctl(t.in, syscall.TCSETS, unsafe.Pointer(&raw))
+}
+
+// restore puts the terminal back in the mode it was in before.
+func (t *terminal) restore() {
+	ioctl(t.in, syscall.TCSETS, unsafe.Pointer(&t.saved))
+}
+
+// resize gives the pseudo-terminal the window size of the terminal.
+func (t *terminal) resize(master *os.File) {
+	var size [4]uint16
+	if ioctl(t.in, syscall.TIOCGWINSZ, unsafe.Pointer(&size)) == nil {
+		ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+	}
+}
+
+// pty is the pseudo-terminal a child runs on.
+type pty struct {
+	t      *terminal
+	master *os.File
+	slave  *os.File
+	done   chan struct{}
+	once   sync.Once
+
+	// close waits up to timeout on clock for the output to be copied.
+	clock   Clock
+	timeout time.Duration
+}
+
+// attach makes the command run on a new pseudo-terminal as its
+// controlling terminal, with its stdin and stdout connected to it. What
+// the child writes to it is copied to the given writer.
+func (t *terminal) attach(c *WrapConfig, cmd *exec.Cmd, stdout io.Writer) (*pty, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	t.resize(master)
+	if err := t.makeRaw(); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, err
+	}
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+
+	p := &pty{t: t, master: master, slave: slave, done: make(chan struct{}), clock: c.Clock, timeout: c.DrainTimeout}
+	go p.copy(stdout)
+
+	t.mu.Lock()
+	t.master = master
+	t.mu.Unlock()
+
+	return p, nil
+}
+
+// copy copies what the child writes to the pseudo-terminal to stdout.
+func (p *pty) copy(stdout io.Writer) {
+	defer close(p.done)
+	// Reading fails with EIO once the child and everything it started
+	// closed the other end, or once close closed this one.
+	io.Copy(stdout, p.master)
+}
+
+// started closes the end of the pseudo-terminal that only the child
+// needs, once it started or failed to.
+func (p *pty) started() {
+	p.slave.Close()
+}
+
+// close restores the terminal, waits until the output of the child is
+// copied and releases the pseudo-terminal. This happens before the
+// handlers run, since they may exit the parent. A process that the child
+// started in the background may hold the pseudo-terminal for as long as
+// it runs, so what it writes after the timeout is dropped.
+func (p *pty) close() {
+	p.once.Do(func() {
+		p.t.restore()
+		select {
+		case <-p.done:
+		case <-p.clock.After(p.timeout):
+		}
+
+		p.t.mu.Lock()
+		p.t.master = nil
+		p.t.mu.Unlock()
+		p.master.Close()
+	})
+}
+
+// openPTY opens a new pseudo-terminal pair.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock int32
+	var n uint32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package panicwrap
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestOpenPTY(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	slave.Write([]byte("hello\n"))
+	buf := make([]byte, 16)
+	n, err := master.Read(buf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(buf[:n]) != "hello\r\n" {
+		t.Fatalf("bad: %#v", string(buf[:n]))
+	}
+}
+
+func TestNewTerminal_notTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	term, err := newTerminal(r)
+	if err != nil || term != nil {
+		t.Fatalf("bad: %#v, %v", term, err)
+	}
+}
+
+func TestPTY_closeHeld(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// A process the child started in the background holds the other end.
+	defer slave.Close()
+
+	clock := newFakeClock()
+	p := &pty{t: &terminal{in: slave}, master: master, done: make(chan struct{}), clock: clock, timeout: time.Second}
+	out := new(syncBuffer)
+	go p.copy(out)
+
+	closed := make(chan struct{})
+	go func() {
+		p.close()
+		close(closed)
+	}()
+	clock.waitTimer(time.Second)
+	clock.Advance(time.Second)
+	<-closed
+}
+
+func TestPanicWrap_terminal(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	p := helperProcess("terminal")
+	p.Stdin = slave
+	p.Stdout = w
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	w.Close()
+
+	// Input is only passed on once the child runs.
+	var out strings.Builder
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		out.WriteString(lines.Text() + "\n")
+		if strings.HasPrefix(lines.Text(), "ready") {
+			break
+		}
+	}
+	master.Write([]byte("hi\r"))
+	for lines.Scan() {
+		out.WriteString(lines.Text() + "\n")
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("err: %s\n%s", err, out.String())
+	}
+
+	// The child runs on a pseudo-terminal of its own.
+	if !strings.Contains(out.String(), "ready /dev/pts/") || strings.Contains(out.String(), "ready "+slave.Name()) {
+		t.Fatalf("bad: %#v", out.String())
+	}
+	if !strings.Contains(out.String(), "got hi") {
+		t.Fatalf("should pass the input: %#v", out.String())
+	}
+	if !strings.Contains(out.String(), "wrapped:") {
+		t.Fatalf("should handle the panic: %#v", out.String())
+	}
+
+	var termios syscall.Termios
+	if err := ioctl(slave, syscall.TCGETS, unsafe.Pointer(&termios)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if termios.Lflag&syscall.ICANON == 0 || termios.Lflag&syscall.ECHO == 0 {
+		t.Fatal("should restore the terminal")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package panicwrap
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+type terminal struct{}
+
+// newTerminal returns nil if the file isn't a terminal, as it does on
+// Linux, since the child can then be given it as it is.
+func newTerminal(in *os.File) (*terminal, error) {
+	if fi, err := in.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil, nil
+	}
+	return nil, errors.New("panicwrap: Terminal is only supported on Linux")
+}
+
+func (*terminal) stop() {}
+
+type pty struct{}
+
+func (*terminal) attach(*WrapConfig, *exec.Cmd, io.Writer) (*pty, error) { return nil, nil }
+
+func (*pty) started() {}
+
+func (*pty) close() {}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package panicwrap
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNewTerminal_notTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	term, err := newTerminal(r)
+	if err != nil || term != nil {
+		t.Fatalf("bad: %#v, %v", term, err)
+	}
+}
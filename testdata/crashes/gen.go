@@ -0,0 +1,192 @@
+//go:build ignore
+
+// This program regenerates the crash corpus in this directory. For every
+// Go toolchain given on the command line, it builds itself with that
+// toolchain, runs every scenario below and stores the stderr output as
+// <version>/<scenario>.txt. Toolchains are fetched via GOTOOLCHAIN, and
+// the ones before Go 1.21, which has none, are given as their go command.
+//
+//	go run gen.go ~/sdk/go1.20.14/bin/go go1.21.13 go1.22.12
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type T struct{ x int }
+
+var scenarios = map[string]func(){
+	"panic-string": func() {
+		panic("oh no")
+	},
+	"panic-error": func() {
+		panic(fmt.Errorf("reading config: %w", io.ErrUnexpectedEOF))
+	},
+	"panic-custom": func() {
+		panic(T{x: 42})
+	},
+	"panic-multiline": func() {
+		panic("first line\nsecond line")
+	},
+	"nil-deref": func() {
+		var t *T
+		t.x = 1
+	},
+	"index": func() {
+		s := []int{1, 2, 3}
+		i := len(os.Args) + 4
+		_ = s[i]
+	},
+	"goroutine": func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			panic("in goroutine")
+		}()
+		<-done
+	},
+	"deadlock": func() {
+		var mu sync.Mutex
+		ch := make(chan int)
+		go func() { <-ch }()
+		go func() { mu.Lock(); mu.Lock() }()
+		<-ch
+	},
+	"repanic": func() {
+		defer func() {
+			r := recover()
+			panic(fmt.Sprintf("re-raised: %v", r))
+		}()
+		panic("original")
+	},
+	"repanic-same": func() {
+		defer func() {
+			panic(recover())
+		}()
+		panic("same value")
+	},
+	"unlock-unlocked": func() {
+		var mu sync.Mutex
+		mu.Unlock()
+	},
+	"goexit-deadlock": func() {
+		select {}
+	},
+}
+
+// tracebacks are the GOTRACEBACK levels some scenarios are run with, in
+// addition to the default. The other levels are huge, so this is kept to
+// the scenarios where they make a difference.
+var tracebacks = map[string][]string{
+	"panic-string": {"system"},
+	"nil-deref":    {"system"},
+	"goroutine":    {"all", "system"},
+	"deadlock":     {"system"},
+}
+
+func main() {
+	if s := os.Getenv("CRASHGEN_SCENARIO"); s != "" {
+		scenarios[s]()
+		return
+	}
+
+	for _, version := range os.Args[1:] {
+		if err := generate(version); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", version, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func generate(version string) error {
+	// A fixed directory keeps the paths in the corpus stable.
+	dir := filepath.Join(os.TempDir(), "crashgen")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	src, err := os.ReadFile("gen.go")
+	if err != nil {
+		return err
+	}
+	src = bytes.Replace(src, []byte("//go:build ignore\n"), nil, 1)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), src, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module crashgen\n\ngo 1.18\n"), 0644); err != nil {
+		return err
+	}
+
+	goCmd, toolchain := "go", version
+	if strings.ContainsRune(version, filepath.Separator) {
+		v, err := exec.Command(version, "env", "GOVERSION").Output()
+		if err != nil {
+			return err
+		}
+		goCmd, toolchain, version = version, "local", strings.TrimSpace(string(v))
+	}
+
+	bin := filepath.Join(dir, "crashgen")
+	build := exec.Command(goCmd, "build", "-o", bin, ".")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOTOOLCHAIN="+toolchain)
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		return err
+	}
+
+	out := strings.TrimPrefix(version, "go")
+	out = "go" + strings.Join(strings.Split(out, ".")[:2], ".")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, tb := range append([]string{""}, tracebacks[name]...) {
+			file := name
+			if tb != "" {
+				file += "." + tb
+			}
+
+			stderr := new(bytes.Buffer)
+			cmd := exec.Command(bin)
+			cmd.Env = append(os.Environ(), "CRASHGEN_SCENARIO="+name, "GOTRACEBACK="+tb)
+			cmd.Stderr = stderr
+			var exitErr *exec.ExitError
+			if err := cmd.Run(); !errors.As(err, &exitErr) {
+				return fmt.Errorf("%s: expected a crash, got %v", file, err)
+			}
+
+			if err := os.WriteFile(filepath.Join(out, file+".txt"), stderr.Bytes(), 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sigquit is added last, so that it doesn't move the lines of the other
+// scenarios in the corpus. It spins until the signal arrives.
+func init() {
+	scenarios["sigquit"] = func() {
+		exec.Command("kill", "-QUIT", fmt.Sprint(os.Getpid())).Run()
+		for {
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package panicwrap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// traceParentEnvKey passes the W3C traceparent to the child, under the name
+// that OpenTelemetry uses for environment variables as carriers.
+const traceParentEnvKey = "TRACEPARENT"
+
+// TraceParent returns the W3C traceparent the parent passed to the child,
+// or an empty string if there is none. See WrapConfig.TraceContext. The
+// child can make it the parent of its spans with OpenTelemetry:
+//
+//	carrier := propagation.MapCarrier{"traceparent": panicwrap.TraceParent()}
+//	ctx := propagation.TraceContext{}.Extract(context.Background(), carrier)
+func TraceParent() string {
+	return os.Getenv(traceParentEnvKey)
+}
+
+// validTraceParent returns whether s is a traceparent of version 00, with
+// a trace ID and parent ID that aren't all zeros.
+func validTraceParent(s string) bool {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return false
+	}
+
+	for i, n := range []int{32, 16, 2} {
+		part := parts[i+1]
+		if len(part) != n || strings.ToLower(part) != part {
+			return false
+		}
+		if _, err := hex.DecodeString(part); err != nil {
+			return false
+		}
+		if i < 2 && strings.Trim(part, "0") == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newTraceParent returns a traceparent with a new random trace ID and
+// parent ID, which is sampled.
+func newTraceParent() string {
+	var id [24]byte
+	rand.Read(id[:])
+	id[0] |= 1
+	id[16] |= 1
+
+	return "00-" + hex.EncodeToString(id[:16]) + "-" + hex.EncodeToString(id[16:]) + "-01"
+}
+
+// traceParent returns the traceparent the parent passes on to its
+// children: that of the environment of the parent if it has a valid one,
+// or a new one otherwise.
+func traceParent() string {
+	if s := os.Getenv(traceParentEnvKey); validTraceParent(s) {
+		return s
+	}
+
+	return newTraceParent()
+}
@@ -0,0 +1,79 @@
+package panicwrap
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestValidTraceParent(t *testing.T) {
+	cases := []struct {
+		s     string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01", false},
+		{"", false},
+	}
+
+	for _, tc := range cases {
+		if validTraceParent(tc.s) != tc.valid {
+			t.Fatalf("%q: should be %t", tc.s, tc.valid)
+		}
+	}
+}
+
+func TestNewTraceParent(t *testing.T) {
+	a, b := newTraceParent(), newTraceParent()
+	if !validTraceParent(a) || a == b {
+		t.Fatalf("bad: %q %q", a, b)
+	}
+}
+
+func TestTraceParent_env(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	t.Setenv(traceParentEnvKey, tp)
+	if s := traceParent(); s != tp {
+		t.Fatalf("bad: %q", s)
+	}
+
+	t.Setenv(traceParentEnvKey, "garbage")
+	if s := traceParent(); s == "garbage" || !validTraceParent(s) {
+		t.Fatalf("bad: %q", s)
+	}
+}
+
+func TestWrap_traceContext(t *testing.T) {
+	var info *PanicInfo
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	c := &WrapConfig{
+		InfoHandler:  func(i *PanicInfo) { info = i },
+		Writer:       io.Discard,
+		Executor:     e,
+		TraceContext: true,
+		IgnoreEnv:    true,
+	}
+	if _, _, err := Wrap(c); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !validTraceParent(c.TraceParent) {
+		t.Fatalf("bad: %q", c.TraceParent)
+	}
+	if !slices.Contains(e.cmd.Env, traceParentEnvKey+"="+c.TraceParent) {
+		t.Fatal("should pass it to the child")
+	}
+	if info == nil || info.TraceParent != c.TraceParent {
+		t.Fatalf("bad: %#v", info)
+	}
+}
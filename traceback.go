@@ -0,0 +1,52 @@
+package panicwrap
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// goTracebackLevels are the GOTRACEBACK levels documented by the runtime
+// package. "wer" is only meaningful on Windows.
+var goTracebackLevels = []string{"none", "single", "all", "system", "crash", "wer"}
+
+func validGoTraceback(level string) bool {
+	for _, l := range goTracebackLevels {
+		if level == l {
+			return true
+		}
+	}
+
+	return false
+}
+
+// goTraceback returns the GOTRACEBACK level the child runs with under the
+// given configuration, following how the runtime reads the variable: unset
+// means "single", the numeric levels 1 and 2 (or more) mean "all" and
+// "system", and anything else it doesn't understand means "none". The
+// child may still raise the level with debug.SetTraceback, which can't be
+// known here.
+func goTraceback(c *WrapConfig) string {
+	level := c.GoTraceback
+	if level == "" {
+		level = os.Getenv("GOTRACEBACK")
+	}
+
+	switch {
+	case level == "":
+		return "single"
+	case level == "wer" && runtime.GOOS != "windows":
+		return "none"
+	case validGoTraceback(level):
+		return level
+	}
+
+	switch n, err := strconv.Atoi(level); {
+	case err != nil || n <= 0:
+		return "none"
+	case n == 1:
+		return "all"
+	default:
+		return "system"
+	}
+}
@@ -0,0 +1,41 @@
+package panicwrap
+
+import (
+	"testing"
+)
+
+func TestGoTraceback(t *testing.T) {
+	cases := []struct {
+		config string
+		env    string
+		want   string
+	}{
+		{"", "", "single"},
+		{"", "all", "all"},
+		{"all", "system", "all"},
+		{"", "crash", "crash"},
+		{"", "0", "none"},
+		{"", "1", "all"},
+		{"", "2", "system"},
+		{"", "3", "system"},
+		{"", "bogus", "none"},
+	}
+
+	for _, tc := range cases {
+		t.Setenv("GOTRACEBACK", tc.env)
+		got := goTraceback(&WrapConfig{GoTraceback: tc.config})
+		if got != tc.want {
+			t.Errorf("%q, GOTRACEBACK=%q: got %q, want %q", tc.config, tc.env, got, tc.want)
+		}
+	}
+}
+
+func TestWrap_invalidGoTraceback(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:     func(string) {},
+		GoTraceback: "everything",
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
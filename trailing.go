@@ -0,0 +1,118 @@
+package panicwrap
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// trailingPipe is a stream of the child that the parent copies from a
+// pipe of its own, rather than leaving it to exec.Cmd, so that it decides
+// how long to wait for the rest of it once the child exited. See
+// WrapConfig.TrailingOutputMax.
+type trailingPipe struct {
+	r     *os.File
+	w     *os.File
+	clock Clock
+
+	// last is when output last came, in nanoseconds since the epoch, and
+	// cut is set once the parent stopped waiting for the rest.
+	last atomic.Int64
+	cut  atomic.Bool
+	done chan struct{}
+}
+
+// startTrailingPipe starts copying a new pipe into w. Its end for the
+// child is kept open until the child exited, for Executors that write the
+// output of the child themselves.
+func startTrailingPipe(clock Clock, w io.Writer) (*trailingPipe, error) {
+	r, cw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &trailingPipe{r: r, w: cw, clock: clock, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		defer r.Close()
+		io.Copy(w, &trailingReader{p})
+	}()
+
+	return p, nil
+}
+
+// trailingReader reads a trailingPipe, noting when output comes. It hides
+// the WriteTo of the pipe so that it sees every read, and passes on its
+// SyscallConn for StdoutBuffers and StderrBuffers.
+type trailingReader struct {
+	p *trailingPipe
+}
+
+func (r *trailingReader) Read(b []byte) (int, error) {
+	n, err := r.p.r.Read(b)
+	if r.p.cut.Load() {
+		return 0, io.EOF
+	}
+	if n > 0 {
+		r.p.last.Store(r.p.clock.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (r *trailingReader) SyscallConn() (syscall.RawConn, error) {
+	return r.p.r.SyscallConn()
+}
+
+// waitTrailing waits for the rest of the output once the child exited:
+// until every process that holds the pipes closed them, until no output
+// came for quiet, if it isn't 0, or for max at the latest. What comes
+// after that is dropped. It returns whether the output was cut off.
+func waitTrailing(pipes []*trailingPipe, quiet, max time.Duration, clock Clock) bool {
+	for _, p := range pipes {
+		p.w.Close()
+	}
+
+	start := clock.Now()
+	deadline := start.Add(max)
+	cut := false
+	for _, p := range pipes {
+		if !p.wait(start, deadline, quiet) {
+			cut = true
+		}
+	}
+	return cut
+}
+
+// wait waits for the rest of the output of the pipe, from start until the
+// deadline. It returns false if the output was cut off.
+func (p *trailingPipe) wait(start, deadline time.Time, quiet time.Duration) bool {
+	for {
+		now := p.clock.Now()
+		left := deadline.Sub(now)
+		if quiet > 0 {
+			since := start
+			if last := time.Unix(0, p.last.Load()); last.After(since) {
+				since = last
+			}
+			left = min(left, quiet-now.Sub(since))
+		}
+		if left <= 0 {
+			break
+		}
+
+		select {
+		case <-p.done:
+			return true
+		case <-p.clock.After(left):
+		}
+	}
+
+	// The reader sees the cut once its read returns. Closing the pipe
+	// ends the read where it can be interrupted, and otherwise it ends
+	// once the processes that hold the pipe exit.
+	p.cut.Store(true)
+	go p.r.Close()
+	return false
+}
@@ -0,0 +1,155 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowWriter is a writer that the parent is behind on.
+type slowWriter struct {
+	syncBuffer
+	delay time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.syncBuffer.Write(p)
+}
+
+// childEnd returns the end of the pipe for the child, and keeps the
+// parent from closing it, as if the child held a copy of it.
+func childEnd(t *testing.T, p *trailingPipe) *os.File {
+	t.Helper()
+	w := p.w
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.w = f
+	return w
+}
+
+func TestWaitTrailing_closed(t *testing.T) {
+	out := &slowWriter{delay: 50 * time.Millisecond}
+	p, err := startTrailingPipe(realClock{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := childEnd(t, p)
+
+	// A burst that the parent is still copying once the child exited.
+	burst := strings.Repeat("x", 4095) + "\n"
+	go func() {
+		for i := 0; i < 64; i++ {
+			w.WriteString(burst)
+		}
+		w.Close()
+	}()
+
+	if waitTrailing([]*trailingPipe{p}, 100*time.Millisecond, 10*time.Second, realClock{}) {
+		t.Fatal("shouldn't cut off the output")
+	}
+	if out.String() != strings.Repeat(burst, 64) {
+		t.Fatalf("should copy all of the output, got %d bytes", len(out.String()))
+	}
+}
+
+func TestWaitTrailing_quiet(t *testing.T) {
+	out := new(syncBuffer)
+	p, err := startTrailingPipe(realClock{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := childEnd(t, p)
+	defer w.Close()
+
+	// A process the child started holds the pipe, and writes once more.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteString("late\n")
+	}()
+
+	start := time.Now()
+	if !waitTrailing([]*trailingPipe{p}, 200*time.Millisecond, 10*time.Second, realClock{}) {
+		t.Fatal("should cut off the output")
+	}
+	if d := time.Since(start); d < 250*time.Millisecond || d > 5*time.Second {
+		t.Fatalf("should wait until the output went quiet: %s", d)
+	}
+	if out.String() != "late\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+
+	// What comes after that is dropped.
+	w.WriteString("dropped\n")
+	<-p.done
+	if out.String() != "late\n" {
+		t.Fatalf("bad: %q", out.String())
+	}
+}
+
+func TestWaitTrailing_max(t *testing.T) {
+	out := new(syncBuffer)
+	p, err := startTrailingPipe(realClock{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := childEnd(t, p)
+	defer w.Close()
+
+	// The output never goes quiet.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				w.WriteString("tick\n")
+			}
+		}
+	}()
+
+	start := time.Now()
+	if !waitTrailing([]*trailingPipe{p}, 200*time.Millisecond, 500*time.Millisecond, realClock{}) {
+		t.Fatal("should cut off the output")
+	}
+	if d := time.Since(start); d < 500*time.Millisecond || d > 5*time.Second {
+		t.Fatalf("should wait until TrailingOutputMax: %s", d)
+	}
+	if n := strings.Count(out.String(), "tick"); n < 10 {
+		t.Fatalf("should forward the output meanwhile: %d", n)
+	}
+}
+
+func TestWaitTrailing_none(t *testing.T) {
+	if waitTrailing(nil, time.Second, time.Second, realClock{}) {
+		t.Fatal("bad")
+	}
+}
+
+func TestPanicWrap_trailingOutputMaxCrash(t *testing.T) {
+	var handled string
+	stderr := new(bytes.Buffer)
+	c := &WrapConfig{
+		Handler:           func(s string) { handled = s },
+		Writer:            stderr,
+		TrailingOutputMax: time.Second,
+		DetectDuration:    50 * time.Millisecond,
+		Executor: &fakeExecutor{
+			stderr: []string{"panic: boom\n", "\ngoroutine 1 [running]:\nmain.main()\n"},
+			exit:   ProcessExit{Status: 2},
+		},
+	}
+
+	if _, _, err := Wrap(c); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(handled, "panic: boom") {
+		t.Fatalf("bad: %q", handled)
+	}
+}
@@ -0,0 +1,83 @@
+package panicwrap
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// UnifiedLogConfig writes a summary of the crashes of the child to the
+// unified logging system of macOS, so that they show up in Console.app
+// and `log stream` along with the logs of the program. Critical crashes
+// are logged as faults, errors as errors, warnings with the default
+// type and the rest as information. This needs cgo. See
+// WrapConfig.UnifiedLog.
+type UnifiedLogConfig struct {
+	// Subsystem is the subsystem the summaries are logged with, usually
+	// in reverse DNS notation, such as "com.example.server". Defaults to
+	// the name of the executable.
+	Subsystem string
+
+	// Category is the category within the subsystem. Defaults to
+	// "crash".
+	Category string
+
+	// MaxMessage is the most characters of the summary, beyond which the
+	// crash text in it is cut short. Defaults to 1024.
+	MaxMessage int
+}
+
+// The types of os_log messages.
+const (
+	osLogDefault = 0x00
+	osLogInfo    = 0x01
+	osLogError   = 0x10
+	osLogFault   = 0x11
+)
+
+// subsystem returns the subsystem of the summaries, given the path of
+// the executable.
+func (u *UnifiedLogConfig) subsystem(exePath string) string {
+	if u.Subsystem != "" {
+		return u.Subsystem
+	}
+	base := filepath.Base(exePath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// category returns the category of the summaries.
+func (u *UnifiedLogConfig) category() string {
+	if u.Category != "" {
+		return u.Category
+	}
+	return "crash"
+}
+
+// summary returns the message a crash is logged with: a line that says
+// what crashed, and the crash text, cut short to fit.
+func (u *UnifiedLogConfig) summary(info *PanicInfo) string {
+	max := u.MaxMessage
+	if max == 0 {
+		max = 1024
+	}
+	return truncate(max-len("..."), crashHeadline(info)+"\n"+info.Text)
+}
+
+// osLogType returns the os_log type of a crash of the severity.
+func osLogType(s Severity) uint8 {
+	switch s {
+	case SeverityCritical:
+		return osLogFault
+	case SeverityError, "":
+		return osLogError
+	case SeverityWarning:
+		return osLogDefault
+	default:
+		return osLogInfo
+	}
+}
+
+// writeUnifiedLog logs the crash with WrapConfig.UnifiedLog.
+func writeUnifiedLog(c *WrapConfig, info *PanicInfo) {
+	u := c.UnifiedLog
+	osLog(u.subsystem(info.Executable), u.category(), osLogType(info.Severity), u.summary(info))
+}
@@ -0,0 +1,31 @@
+//go:build darwin && cgo
+
+package panicwrap
+
+/*
+#include <os/log.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+static void panicwrap_os_log(const char *subsystem, const char *category, uint8_t type, const char *msg) {
+	os_log_t log = os_log_create(subsystem, category);
+	os_log_with_type(log, (os_log_type_t)type, "%{public}s", msg);
+	os_release(log);
+}
+*/
+import "C"
+
+import "unsafe"
+
+// unifiedLogSupported is whether WrapConfig.UnifiedLog can be used.
+const unifiedLogSupported = true
+
+// osLog logs the message with the os_log type to the unified logging
+// system, with the subsystem and category.
+func osLog(subsystem, category string, typ uint8, msg string) {
+	cs, cc, cm := C.CString(subsystem), C.CString(category), C.CString(msg)
+	defer C.free(unsafe.Pointer(cs))
+	defer C.free(unsafe.Pointer(cc))
+	defer C.free(unsafe.Pointer(cm))
+	C.panicwrap_os_log(cs, cc, C.uint8_t(typ), cm)
+}
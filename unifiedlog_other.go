@@ -0,0 +1,8 @@
+//go:build !darwin || !cgo
+
+package panicwrap
+
+// unifiedLogSupported is whether WrapConfig.UnifiedLog can be used.
+const unifiedLogSupported = false
+
+func osLog(string, string, uint8, string) {}
@@ -0,0 +1,46 @@
+package panicwrap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedLogConfig_defaults(t *testing.T) {
+	u := &UnifiedLogConfig{}
+	if s := u.subsystem("/usr/bin/server"); s != "server" {
+		t.Fatalf("bad subsystem: %q", s)
+	}
+	if c := u.category(); c != "crash" {
+		t.Fatalf("bad category: %q", c)
+	}
+
+	u = &UnifiedLogConfig{Subsystem: "com.example.server", Category: "panics"}
+	if s, c := u.subsystem("/usr/bin/server"), u.category(); s != "com.example.server" || c != "panics" {
+		t.Fatalf("bad: %q %q", s, c)
+	}
+}
+
+func TestUnifiedLogConfig_summary(t *testing.T) {
+	info := &PanicInfo{Kind: KindPanic, Executable: "/usr/bin/server", PID: 12, Text: "panic: boom\n\ngoroutine 1 [running]:\n" + strings.Repeat("main.main()\n", 200)}
+
+	summary := (&UnifiedLogConfig{}).summary(info)
+	if !strings.HasPrefix(summary, "panic of server, process 12\npanic: boom\n") {
+		t.Fatalf("bad: %q", summary)
+	}
+	if len(summary) != 1024 || !strings.HasSuffix(summary, "...") {
+		t.Fatalf("should be cut short: %d", len(summary))
+	}
+}
+
+func TestOSLogType(t *testing.T) {
+	for s, want := range map[Severity]uint8{
+		SeverityCritical: osLogFault,
+		SeverityError:    osLogError,
+		SeverityWarning:  osLogDefault,
+		SeverityInfo:     osLogInfo,
+	} {
+		if typ := osLogType(s); typ != want {
+			t.Fatalf("%s: got %#x, want %#x", s, typ, want)
+		}
+	}
+}
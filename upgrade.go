@@ -0,0 +1,202 @@
+package panicwrap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filesEnvKey passes the file descriptors of WrapConfig.ExtraFiles to the
+// child, separated by commas.
+const filesEnvKey = "PANICWRAP_FILES"
+
+// inheritedFiles are the WrapConfig.ExtraFiles of the parent, in the
+// child.
+var inheritedFiles []*os.File
+
+// startFiles picks up the files the parent passed, if any.
+func startFiles() error {
+	v := os.Getenv(filesEnvKey)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(filesEnvKey)
+
+	for _, s := range strings.Split(v, ",") {
+		fd, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("panicwrap: invalid %s %q", filesEnvKey, v)
+		}
+		inheritedFiles = append(inheritedFiles, os.NewFile(uintptr(fd), "panicwrap-file-"+s))
+	}
+
+	return nil
+}
+
+// Files returns the files the parent passes to the child, in the order of
+// WrapConfig.ExtraFiles. A listener can be rebuilt from one with
+// net.FileListener. It returns nil if the process isn't wrapped or the
+// parent passes none.
+func Files() []*os.File {
+	return inheritedFiles
+}
+
+// Ready tells the parent that the child is ready to take over from the
+// child it replaces, such as once it accepts connections on the listeners
+// of Files. See Upgrade. It returns ErrNoControl if there is no control
+// channel to the parent.
+func Ready() error {
+	return sendControl(messageReady, struct{}{})
+}
+
+// childRun is the outcome of runChild.
+type childRun struct {
+	res *childResult
+	err error
+}
+
+// Upgrade replaces the running child, or each worker in turn, with a new
+// one started from the executable as it is now, such as after the binary
+// was replaced by a newer build, without a moment where no child runs. The
+// new child gets the same ExtraFiles, so that it can accept connections on
+// the same listeners, and must call Ready within the timeout. The old
+// child is then asked to shut down as with RequestShutdown, and the new
+// one takes over once it exited. Panics of either are handled as usual
+// throughout, and signals reach both while they run side by side.
+//
+// If the new child exits or isn't ready in time, it is killed if needed,
+// the old child keeps running and an error is returned. This requires
+// WrapConfig.Control, can't be combined with Terminal, and fails with
+// ExecutableSHA256 or VerifyExecutable once the binary changed.
+func Upgrade(timeout time.Duration) error {
+	ch := activeChild.Load()
+	if ch == nil {
+		return errors.New("panicwrap: not wrapping a child")
+	}
+
+	var err error
+	ch.each(func(w *child) {
+		if err == nil {
+			err = ch.upgrade(w, timeout)
+		}
+	})
+
+	return err
+}
+
+// upgradeChild starts the new child of the worker for Upgrade and hands
+// the worker over to it once it is ready. If the new child exits before,
+// its result is returned along with the error.
+func upgradeChild(c *WrapConfig, exePath string, w *child, timeout time.Duration) (*childResult, error) {
+	if !c.Control {
+		return nil, errors.New("panicwrap: Upgrade requires Control")
+	}
+	if c.Terminal {
+		return nil, errors.New("panicwrap: Upgrade can't be combined with Terminal")
+	}
+	if w.stopping() {
+		return nil, errors.New("panicwrap: the child is stopping")
+	}
+	old, err := w.getControl()
+	if err != nil {
+		return nil, err
+	}
+
+	next := &child{index: w.index, ready: make(chan struct{}), stats: w.stats, budget: w.budget, safeMode: w.safeMode}
+	done := make(chan childRun, 1)
+	w.setNext(next)
+	go func() {
+		res, err := runChild(c, exePath, next)
+		done <- childRun{res, err}
+	}()
+
+	select {
+	case <-next.ready:
+	case r := <-done:
+		w.setNext(nil)
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		return r.res, fmt.Errorf("panicwrap: the new child exited with status %d before it was ready", r.res.exitStatus)
+	case <-c.Clock.After(timeout):
+		w.setNext(nil)
+		next.abandon()
+		r := <-done
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		return r.res, errors.New("panicwrap: the new child wasn't ready in time")
+	}
+
+	if !w.handOver(old, done) {
+		next.abandon()
+		<-done
+		return nil, errors.New("panicwrap: the child exited during the upgrade")
+	}
+
+	return nil, old.send(messageShutdown, struct{}{})
+}
+
+// setNext sets the child that Upgrade started to take over from this one.
+func (c *child) setNext(next *child) {
+	c.Lock()
+	defer c.Unlock()
+	c.next = next
+}
+
+// handOver makes the child that Upgrade started take over once the
+// running child, which has the given control channel, exited. It returns
+// false if that child already exited.
+func (c *child) handOver(old *parentControl, done chan childRun) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.control != old {
+		c.next = nil
+		return false
+	}
+
+	c.takeover = done
+	return true
+}
+
+// takeOver makes the child that Upgrade started the running one, if it
+// is to take over, and returns the channel its outcome is delivered on.
+func (c *child) takeOver() <-chan childRun {
+	c.Lock()
+	defer c.Unlock()
+	done := c.takeover
+	if done == nil {
+		return nil
+	}
+
+	next := c.next
+	next.Lock()
+	c.proc, c.profiles, c.control = next.proc, next.profiles, next.control
+	next.Unlock()
+	c.next, c.takeover = nil, nil
+	return done
+}
+
+// release forgets the child that took over once it exited.
+func (c *child) release() {
+	c.Lock()
+	defer c.Unlock()
+	c.proc, c.profiles, c.control = nil, nil, nil
+}
+
+// abandon kills a child that Upgrade started, right away or as soon as it
+// started.
+func (c *child) abandon() {
+	c.Lock()
+	defer c.Unlock()
+	c.stopped = true
+	c.abandoned = true
+	if c.proc != nil {
+		c.proc.Signal(os.Kill)
+	}
+}
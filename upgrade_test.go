@@ -0,0 +1,82 @@
+package panicwrap
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartFiles(t *testing.T) {
+	defer func() { inheritedFiles = nil }()
+
+	t.Setenv(filesEnvKey, "1000,1001")
+	if err := startFiles(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	files := Files()
+	if len(files) != 2 || files[0].Fd() != 1000 || files[1].Fd() != 1001 {
+		t.Fatalf("bad: %v", files)
+	}
+	if _, ok := os.LookupEnv(filesEnvKey); ok {
+		t.Fatal("should unset the variable")
+	}
+}
+
+func TestUpgrade_noWrap(t *testing.T) {
+	if err := Upgrade(time.Second); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestUpgradeChild_noControl(t *testing.T) {
+	c := &WrapConfig{}
+	setDefaults(c)
+	if _, err := upgradeChild(c, "", new(child), time.Second); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestPanicWrap_upgrade(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("upgrade")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The old child stops only once the new one is ready, and the panic
+	// of the new one is handled after it took over.
+	out := stdout.String()
+	files := strings.Index(out, "files: 1\n")
+	old := strings.Index(out, "old exiting\n")
+	handled := strings.Index(out, "handled: new\n")
+	exit := strings.Index(out, "exit: 2\n")
+	if files < 0 || old < files || handled < 0 || exit < handled || !strings.Contains(out, "upgrade: <nil>\n") {
+		t.Fatalf("bad: %#v", out)
+	}
+}
+
+func TestPanicWrap_upgradeTimeout(t *testing.T) {
+	stdout := new(bytes.Buffer)
+
+	p := helperProcess("upgrade", "timeout")
+	p.Stdout = stdout
+	p.Stderr = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The new child is killed and the old one keeps running until it is
+	// asked to shut down.
+	out := stdout.String()
+	upgrade := strings.Index(out, "upgrade: panicwrap: the new child wasn't ready in time\n")
+	old := strings.Index(out, "old exiting\n")
+	if upgrade < 0 || old < upgrade || !strings.Contains(out, "exit: 0\n") || strings.Contains(out, "handled") {
+		t.Fatalf("bad: %#v", out)
+	}
+}
@@ -0,0 +1,438 @@
+package panicwrap
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Validate returns an error that names the problem if the configuration
+// is invalid or contradictory, such as a negative duration or options
+// that can't be combined. Wrap calls it before it starts anything, so it
+// only needs to be called to check a configuration ahead of time, such as
+// once it was loaded. Zero values are valid and stand for the defaults.
+// It doesn't modify the configuration.
+func (c *WrapConfig) Validate() error {
+	if c.Handler == nil && c.InfoHandler == nil && c.PanicWriter == nil && len(c.PanicSinks) == 0 && c.DigestHandler == nil && len(c.HandlerCommands) == 0 {
+		return errors.New("handler must be set")
+	}
+
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"DetectDuration", c.DetectDuration},
+		{"PartialHeaderWait", c.PartialHeaderWait},
+		{"TrailingOutputWait", c.TrailingOutputWait},
+		{"TrailingOutputMax", c.TrailingOutputMax},
+		{"DedupWindow", c.DedupWindow},
+		{"HandlerLimitWindow", c.HandlerLimitWindow},
+		{"DigestWindow", c.DigestWindow},
+		{"DrainTimeout", c.DrainTimeout},
+		{"PostMortemTimeout", c.PostMortemTimeout},
+		{"ProfileInterval", c.ProfileInterval},
+		{"CoverFlushInterval", c.CoverFlushInterval},
+		{"DiagnosticReportWait", c.DiagnosticReportWait},
+		{"WERReportWait", c.WERReportWait},
+	}
+	for _, d := range durations {
+		if d.d < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", d.name, d.d)
+		}
+	}
+
+	counts := []struct {
+		name string
+		n    int
+	}{
+		{"Workers", c.Workers},
+		{"SuppressAfter", c.SuppressAfter},
+		{"HandlerLimit", c.HandlerLimit},
+		{"SourceContext", c.SourceContext},
+		{"RecordSize", c.RecordSize},
+		{"TailSize", c.TailSize},
+		{"BreadcrumbSize", c.BreadcrumbSize},
+		{"PanicExitStatus", c.PanicExitStatus},
+	}
+	for _, n := range counts {
+		if n.n < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", n.name, n.n)
+		}
+	}
+
+	for _, b := range []struct {
+		name string
+		b    *StreamBuffers
+	}{{"StdoutBuffers", c.StdoutBuffers}, {"StderrBuffers", c.StderrBuffers}} {
+		if b.b != nil && (b.b.ReadSize < 0 || b.b.PipeSize < 0) {
+			return fmt.Errorf("%s sizes must not be negative", b.name)
+		}
+	}
+
+	if err := validateMemoryBudget(c); err != nil {
+		return err
+	}
+
+	if err := validateRestart(c.Restart); err != nil {
+		return err
+	}
+
+	if c.HidePanic && c.SuppressAfter > 0 {
+		return errors.New("HidePanic can't be combined with SuppressAfter: suppressed panics would be neither handled nor mirrored")
+	}
+
+	if c.HidePanic && c.HandlerLimit > 0 {
+		return errors.New("HidePanic can't be combined with HandlerLimit: rate-limited panics would be neither handled nor mirrored")
+	}
+
+	if c.StreamPanics && c.HidePanic {
+		return errors.New("StreamPanics can't be combined with HidePanic")
+	}
+
+	if c.Banners != nil {
+		if err := c.Banners.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, hc := range c.HandlerCommands {
+		if len(hc.Args) == 0 {
+			return errors.New("HandlerCommands must have Args")
+		}
+		if hc.Timeout < 0 || hc.Retries < 0 {
+			return fmt.Errorf("HandlerCommands %s: Timeout and Retries must not be negative", hc.Args[0])
+		}
+	}
+
+	for i := range c.ScrubPatterns {
+		if err := c.ScrubPatterns[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.SigningKey != nil && len(c.SigningKey) != ed25519.PrivateKeySize {
+		return errors.New("SigningKey must be an ed25519 private key")
+	}
+
+	if c.PanicTemplate != "" {
+		if _, err := ParsePanicTemplate(c.PanicTemplate); err != nil {
+			return fmt.Errorf("invalid PanicTemplate: %s", err)
+		}
+	}
+
+	for kind, s := range c.Severities {
+		if !validSeverity(s) {
+			return fmt.Errorf("invalid Severities for %s: %q", kind, s)
+		}
+	}
+
+	if col := c.Collector; col != nil {
+		if col.Address == "" {
+			return errors.New("Collector.Address must be set")
+		}
+		if col.TLSConfig == nil && (col.CertFile == "" || col.KeyFile == "") {
+			return errors.New("Collector needs a certificate: set CertFile and KeyFile, or TLSConfig")
+		}
+		if col.TLSConfig != nil && len(col.TLSConfig.Certificates) == 0 && col.TLSConfig.GetClientCertificate == nil {
+			return errors.New("Collector.TLSConfig must have a certificate")
+		}
+		if col.MaxSpooled < 0 || col.Timeout < 0 || col.MaxBackoff < 0 {
+			return errors.New("Collector must not have negative values")
+		}
+	}
+
+	if s := c.HandlerSidecar; s != nil {
+		if c.HandlerProcess {
+			return errors.New("HandlerSidecar can't be combined with HandlerProcess")
+		}
+		if s.Interval < 0 || s.Timeout < 0 {
+			return errors.New("HandlerSidecar durations must not be negative")
+		}
+	}
+
+	if p := c.Probes; p != nil {
+		if p.LivenessFile == "" && p.ReadinessFile == "" {
+			return errors.New("Probes must have a LivenessFile or a ReadinessFile")
+		}
+		if p.Interval < 0 || p.HeartbeatTimeout < 0 {
+			return errors.New("Probes durations must not be negative")
+		}
+		if p.HeartbeatTimeout > 0 && !c.Control {
+			return errors.New("Probes.HeartbeatTimeout requires Control")
+		}
+	}
+
+	if c.TraceParent != "" && !validTraceParent(c.TraceParent) {
+		return fmt.Errorf("invalid TraceParent %q", c.TraceParent)
+	}
+
+	if l := c.LeakWatchdog; l != nil {
+		if l.Threshold <= 0 {
+			return errors.New("LeakWatchdog.Threshold must be greater than zero")
+		}
+		if l.Samples < 0 || l.Interval < 0 {
+			return errors.New("LeakWatchdog must not have negative values")
+		}
+		if l.Samples == 1 {
+			return errors.New("LeakWatchdog.Samples must be at least 2")
+		}
+		if !c.Control {
+			return errors.New("LeakWatchdog requires Control")
+		}
+	}
+
+	if r := c.RSSWatchdog; r != nil {
+		if r.MaxRSS <= 0 {
+			return errors.New("RSSWatchdog.MaxRSS must be greater than zero")
+		}
+		if r.Interval < 0 {
+			return errors.New("RSSWatchdog.Interval must not be negative")
+		}
+		if r.Action != RSSNotify && r.Action != RSSRestart {
+			return fmt.Errorf("invalid RSSWatchdog.Action %d", r.Action)
+		}
+		if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+			return errors.New("RSSWatchdog is only supported on Linux and Windows")
+		}
+	}
+
+	if sp := c.SpinWatchdog; sp != nil {
+		if sp.MaxCPU <= 0 {
+			return errors.New("SpinWatchdog.MaxCPU must be greater than zero")
+		}
+		if sp.Window < 0 {
+			return errors.New("SpinWatchdog.Window must not be negative")
+		}
+		if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+			return errors.New("SpinWatchdog is only supported on Linux and Windows")
+		}
+	}
+
+	if f := c.FDWatchdog; f != nil {
+		if f.Threshold < 0 || f.Threshold > 1 {
+			return fmt.Errorf("FDWatchdog.Threshold must be between 0 and 1, got %g", f.Threshold)
+		}
+		if f.Interval < 0 {
+			return errors.New("FDWatchdog.Interval must not be negative")
+		}
+		if runtime.GOOS != "linux" {
+			return errors.New("FDWatchdog is only supported on Linux")
+		}
+	}
+
+	if c.OpenFiles && runtime.GOOS != "linux" {
+		return errors.New("OpenFiles is only supported on Linux")
+	}
+	if c.ProcStatus && runtime.GOOS != "linux" {
+		return errors.New("ProcStatus is only supported on Linux")
+	}
+	if c.KernelLog && runtime.GOOS != "linux" {
+		return errors.New("KernelLog is only supported on Linux")
+	}
+
+	if c.BreadcrumbSize > 0 && c.BreadcrumbSize < breadcrumbHeaderSize+breadcrumbSlotSize {
+		return fmt.Errorf("BreadcrumbSize must be at least %d, got %d", breadcrumbHeaderSize+breadcrumbSlotSize, c.BreadcrumbSize)
+	}
+	if c.BreadcrumbSize > 0 && !breadcrumbsSupported {
+		return errors.New("BreadcrumbSize is not supported on this platform")
+	}
+
+	if c.Subreaper && !subreaperSupported {
+		return errors.New("Subreaper is only supported on Linux and 64-bit FreeBSD")
+	}
+
+	if c.Contract && !contractSupported {
+		return errors.New("Contract is only supported on illumos, with cgo")
+	}
+
+	if c.DiagnosticReports && runtime.GOOS != "darwin" {
+		return errors.New("DiagnosticReports is only supported on macOS")
+	}
+
+	if c.WERReports && runtime.GOOS != "windows" {
+		return errors.New("WERReports is only supported on Windows")
+	}
+
+	if e := c.EventLog; e != nil {
+		if e.MaxMessage < 0 {
+			return errors.New("EventLog.MaxMessage must not be negative")
+		}
+		for kind, id := range e.EventIDs {
+			if id < 1 || id > 1000 {
+				return fmt.Errorf("EventLog.EventIDs must be between 1 and 1000, got %d for %s", id, kind)
+			}
+		}
+		if runtime.GOOS != "windows" {
+			return errors.New("EventLog is only supported on Windows")
+		}
+	}
+
+	if u := c.UnifiedLog; u != nil {
+		if u.MaxMessage < 0 {
+			return errors.New("UnifiedLog.MaxMessage must not be negative")
+		}
+		if !unifiedLogSupported {
+			return errors.New("UnifiedLog is only supported on macOS, with cgo")
+		}
+	}
+
+	if r := c.OutputRate; r != nil {
+		if r.BytesPerSecond < 0 || r.Burst < 0 {
+			return errors.New("OutputRate must not have negative values")
+		}
+		if r.BytesPerSecond == 0 && !r.CollapseDuplicates {
+			return errors.New("OutputRate must have a BytesPerSecond or CollapseDuplicates")
+		}
+		if r.Throttle && r.BytesPerSecond == 0 {
+			return errors.New("OutputRate.Throttle requires BytesPerSecond")
+		}
+	}
+
+	if c.DetectTimeout != DetectTimeoutFlush && c.DetectTimeout != DetectTimeoutCrash {
+		return fmt.Errorf("invalid DetectTimeout %d", c.DetectTimeout)
+	}
+
+	for _, re := range c.IgnorePatterns {
+		if re == nil {
+			return errors.New("IgnorePatterns must not hold nil")
+		}
+	}
+
+	if c.StrictDetection && c.GoTraceback == "none" {
+		return errors.New("StrictDetection can't be combined with a GoTraceback of none")
+	}
+
+	if c.ReportHandler != nil && !c.Control {
+		return errors.New("ReportHandler requires Control")
+	}
+
+	if c.SubprocessHandler != nil && !c.Control {
+		return errors.New("SubprocessHandler requires Control")
+	}
+
+	if c.VersionMismatch < VersionWarn || c.VersionMismatch > VersionFail {
+		return fmt.Errorf("invalid VersionMismatch %d", c.VersionMismatch)
+	}
+
+	if c.Terminal && c.Stdout != nil && c.Stdout != os.Stdout {
+		return errors.New("Terminal can't be combined with Stdout: the child writes to the terminal")
+	}
+
+	if c.Terminal && (c.JSONLines || c.Timestamps != "" || c.StreamLabels) {
+		return errors.New("Terminal can't be combined with JSONLines, Timestamps or StreamLabels")
+	}
+
+	if c.GoTraceback != "" && !validGoTraceback(c.GoTraceback) {
+		return fmt.Errorf("invalid GoTraceback %q", c.GoTraceback)
+	}
+
+	if c.Profiling != nil && c.Profiling.Dir == "" {
+		return errors.New("Profiling.Dir must be set")
+	}
+
+	if len(c.Rlimits) > 0 && runtime.GOOS == "windows" {
+		return errors.New("Rlimits aren't supported on Windows")
+	}
+
+	if c.Priority != nil && (c.Priority.IOLevel < 0 || c.Priority.IOLevel > 7) {
+		return fmt.Errorf("invalid Priority.IOLevel %d", c.Priority.IOLevel)
+	}
+
+	for _, cpu := range c.CPUAffinity {
+		if cpu < 0 {
+			return fmt.Errorf("invalid CPUAffinity CPU %d", cpu)
+		}
+		// The affinity mask of Windows is a word.
+		if runtime.GOOS == "windows" && cpu >= bits.UintSize {
+			return fmt.Errorf("CPUAffinity CPU %d is beyond the first %d CPUs that can be used on Windows", cpu, bits.UintSize)
+		}
+	}
+
+	if c.Cgroup != nil && c.Cgroup.Dir == "" {
+		return errors.New("Cgroup.Dir must be set")
+	}
+
+	if c.Log != nil && c.Log.Path == "" {
+		return errors.New("Log.Path must be set")
+	}
+
+	if c.JSONLines && (c.Timestamps != "" || c.StreamLabels) {
+		return errors.New("JSONLines can't be combined with Timestamps or StreamLabels")
+	}
+
+	if c.StderrEncoding != "" && !validEncoding(c.StderrEncoding) {
+		return fmt.Errorf("invalid StderrEncoding %q", c.StderrEncoding)
+	}
+
+	if c.DetectStartup && runtime.GOOS == "windows" {
+		return errors.New("DetectStartup isn't supported on Windows")
+	}
+
+	if c.Control && runtime.GOOS == "windows" {
+		return errors.New("Control isn't supported on Windows")
+	}
+
+	if len(c.ExtraFiles) > 0 && runtime.GOOS == "windows" {
+		return errors.New("ExtraFiles aren't supported on Windows")
+	}
+
+	if c.Terminal && c.Workers > 1 {
+		return errors.New("Terminal can't be combined with Workers")
+	}
+
+	if c.ConsoleGroup && c.HideConsole {
+		return errors.New("ConsoleGroup can't be combined with HideConsole")
+	}
+
+	if c.VerifyParent && c.Namespaces&NamespacePID != 0 {
+		return errors.New("VerifyParent can't be combined with NamespacePID")
+	}
+
+	if c.ExecutableSHA256 != "" && !validSHA256(c.ExecutableSHA256) {
+		return fmt.Errorf("invalid ExecutableSHA256 %q", c.ExecutableSHA256)
+	}
+
+	if c.Timestamps != "" && timestampPrefix(c.Timestamps, time.Now()) == nil {
+		return fmt.Errorf("invalid Timestamps %q", c.Timestamps)
+	}
+
+	return nil
+}
+
+// validateRestart returns an error if the restart policy is invalid.
+func validateRestart(p *RestartPolicy) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.MaxRestarts < 0 {
+		return fmt.Errorf("Restart.MaxRestarts must not be negative, got %d", p.MaxRestarts)
+	}
+	if p.Backoff < 0 {
+		return fmt.Errorf("Restart.Backoff must not be negative, got %s", p.Backoff)
+	}
+	if p.MaxBackoff < 0 {
+		return fmt.Errorf("Restart.MaxBackoff must not be negative, got %s", p.MaxBackoff)
+	}
+	if p.ResetAfter < 0 {
+		return fmt.Errorf("Restart.ResetAfter must not be negative, got %s", p.ResetAfter)
+	}
+	if p.Backoff > 0 && p.MaxBackoff > 0 && p.MaxBackoff < p.Backoff {
+		return fmt.Errorf("Restart.MaxBackoff %s is less than Restart.Backoff %s", p.MaxBackoff, p.Backoff)
+	}
+	if m := p.SafeMode; m != nil {
+		if m.After < 0 || m.Window < 0 || m.Duration < 0 {
+			return errors.New("Restart.SafeMode must not have negative values")
+		}
+		if strings.ContainsAny(m.Env, "=\x00") {
+			return fmt.Errorf("invalid Restart.SafeMode.Env: %q", m.Env)
+		}
+	}
+
+	return nil
+}
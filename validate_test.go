@@ -0,0 +1,135 @@
+package panicwrap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"math/bits"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrapConfigValidate(t *testing.T) {
+	handler := func(string) {}
+
+	cases := []struct {
+		name string
+		c    WrapConfig
+		err  string
+	}{
+		{"no handler", WrapConfig{HidePanic: true}, "handler must be set"},
+		{"negative duration", WrapConfig{Handler: handler, DetectDuration: -time.Second}, "DetectDuration must not be negative"},
+		{"negative drain", WrapConfig{Handler: handler, DrainTimeout: -1}, "DrainTimeout must not be negative"},
+		{"negative workers", WrapConfig{Handler: handler, Workers: -2}, "Workers must not be negative"},
+		{"negative backoff", WrapConfig{Handler: handler, Restart: &RestartPolicy{Backoff: -time.Second}}, "Restart.Backoff must not be negative"},
+		{"negative reset after", WrapConfig{Handler: handler, Restart: &RestartPolicy{ResetAfter: -time.Second}}, "Restart.ResetAfter must not be negative"},
+		{"backoff above max", WrapConfig{Handler: handler, Restart: &RestartPolicy{Backoff: time.Minute, MaxBackoff: time.Second}}, "is less than Restart.Backoff"},
+		{"negative safe mode", WrapConfig{Handler: handler, Restart: &RestartPolicy{SafeMode: &SafeModeConfig{After: -1}}}, "Restart.SafeMode must not have negative values"},
+		{"invalid safe mode env", WrapConfig{Handler: handler, Restart: &RestartPolicy{SafeMode: &SafeModeConfig{Env: "A=B"}}}, "invalid Restart.SafeMode.Env"},
+		{"hide and limit", WrapConfig{Handler: handler, HidePanic: true, HandlerLimit: 3}, "HidePanic can't be combined with HandlerLimit"},
+		{"hide and suppress", WrapConfig{Handler: handler, HidePanic: true, SuppressAfter: 3}, "HidePanic can't be combined with SuppressAfter"},
+		{"unnamed scrub pattern", WrapConfig{Handler: handler, ScrubPatterns: []ScrubPattern{{Pattern: regexp.MustCompile("x")}}}, "ScrubPatterns must have a Name"},
+		{"scrub pattern without pattern", WrapConfig{Handler: handler, ScrubPatterns: []ScrubPattern{{Name: "email"}}}, `ScrubPatterns "email" must have a Pattern`},
+		{"short signing key", WrapConfig{Handler: handler, SigningKey: make([]byte, 32)}, "SigningKey must be an ed25519 private key"},
+		{"handler command without args", WrapConfig{HandlerCommands: []HandlerCommand{{}}}, "HandlerCommands must have Args"},
+		{"invalid panic template", WrapConfig{Handler: handler, PanicTemplate: "{{.Kind"}, "invalid PanicTemplate"},
+		{"invalid severity", WrapConfig{Handler: handler, Severities: map[CrashKind]Severity{KindPanic: "page"}}, "invalid Severities for panic"},
+		{"probes without files", WrapConfig{Handler: handler, Probes: &ProbeConfig{}}, "Probes must have a LivenessFile or a ReadinessFile"},
+		{"probe heartbeats without control", WrapConfig{Handler: handler, Probes: &ProbeConfig{LivenessFile: "live", HeartbeatTimeout: time.Second}}, "Probes.HeartbeatTimeout requires Control"},
+		{"small memory budget", WrapConfig{Handler: handler, MemoryBudget: 64 << 10}, "MemoryBudget must be more than the 67584 bytes of the read buffers"},
+		{"leak watchdog without threshold", WrapConfig{Handler: handler, Control: true, LeakWatchdog: &LeakConfig{}}, "LeakWatchdog.Threshold must be greater than zero"},
+		{"leak watchdog without control", WrapConfig{Handler: handler, LeakWatchdog: &LeakConfig{Threshold: 100}}, "LeakWatchdog requires Control"},
+		{"rss watchdog without threshold", WrapConfig{Handler: handler, RSSWatchdog: &RSSConfig{}}, "RSSWatchdog.MaxRSS must be greater than zero"},
+		{"invalid rss action", WrapConfig{Handler: handler, RSSWatchdog: &RSSConfig{MaxRSS: 1, Action: 5}}, "invalid RSSWatchdog.Action 5"},
+		{"spin watchdog without threshold", WrapConfig{Handler: handler, SpinWatchdog: &SpinConfig{}}, "SpinWatchdog.MaxCPU must be greater than zero"},
+		{"fd watchdog threshold too large", WrapConfig{Handler: handler, FDWatchdog: &FDConfig{Threshold: 1.5}}, "FDWatchdog.Threshold must be between 0 and 1, got 1.5"},
+		{"empty output rate", WrapConfig{Handler: handler, OutputRate: &OutputRateConfig{}}, "OutputRate must have a BytesPerSecond or CollapseDuplicates"},
+		{"throttle without rate", WrapConfig{Handler: handler, OutputRate: &OutputRateConfig{Throttle: true, CollapseDuplicates: true}}, "OutputRate.Throttle requires BytesPerSecond"},
+		{"strict detection without stacks", WrapConfig{Handler: handler, StrictDetection: true, GoTraceback: "none"}, "StrictDetection can't be combined with a GoTraceback of none"},
+		{"invalid detect timeout", WrapConfig{Handler: handler, DetectTimeout: 7}, "invalid DetectTimeout 7"},
+		{"nil ignore pattern", WrapConfig{Handler: handler, IgnorePatterns: []*regexp.Regexp{nil}}, "IgnorePatterns must not hold nil"},
+		{"negative tail size", WrapConfig{Handler: handler, TailSize: -1}, "TailSize must not be negative, got -1"},
+		{"event log id out of range", WrapConfig{Handler: handler, EventLog: &EventLogConfig{EventIDs: map[CrashKind]uint32{KindPanic: 1001}}}, "EventLog.EventIDs must be between 1 and 1000, got 1001 for panic"},
+		{"negative diagnostic report wait", WrapConfig{Handler: handler, DiagnosticReportWait: -time.Second}, "DiagnosticReportWait must not be negative, got -1s"},
+		{"negative WER report wait", WrapConfig{Handler: handler, WERReportWait: -time.Second}, "WERReportWait must not be negative, got -1s"},
+		{"negative breadcrumb size", WrapConfig{Handler: handler, BreadcrumbSize: -1}, "BreadcrumbSize must not be negative, got -1"},
+		{"small breadcrumb size", WrapConfig{Handler: handler, BreadcrumbSize: 100}, "BreadcrumbSize must be at least 192, got 100"},
+		{"collector without address", WrapConfig{Handler: handler, Collector: &CollectorConfig{CertFile: "c", KeyFile: "k"}}, "Collector.Address must be set"},
+		{"collector without certificate", WrapConfig{Handler: handler, Collector: &CollectorConfig{Address: "localhost:1", CAFile: "ca"}}, "Collector needs a certificate: set CertFile and KeyFile, or TLSConfig"},
+		{"collector tls without certificate", WrapConfig{Handler: handler, Collector: &CollectorConfig{Address: "localhost:1", TLSConfig: &tls.Config{}}}, "Collector.TLSConfig must have a certificate"},
+		{"negative collector timeout", WrapConfig{Handler: handler, Collector: &CollectorConfig{Address: "localhost:1", CertFile: "c", KeyFile: "k", Timeout: -1}}, "Collector must not have negative values"},
+		{"sidecar with handler process", WrapConfig{Handler: handler, HandlerProcess: true, HandlerSidecar: &SidecarConfig{}}, "HandlerSidecar can't be combined with HandlerProcess"},
+		{"negative sidecar timeout", WrapConfig{Handler: handler, HandlerSidecar: &SidecarConfig{Timeout: -1}}, "HandlerSidecar durations must not be negative"},
+		{"invalid traceparent", WrapConfig{Handler: handler, TraceParent: "00-abc"}, "invalid TraceParent"},
+		{"stream and hide", WrapConfig{Handler: handler, StreamPanics: true, HidePanic: true}, "StreamPanics can't be combined with HidePanic"},
+		{"subprocess handler without control", WrapConfig{Handler: handler, SubprocessHandler: func(*PanicInfo) {}}, "SubprocessHandler requires Control"},
+		{"report without control", WrapConfig{Handler: handler, ReportHandler: func(*Report) {}}, "ReportHandler requires Control"},
+		{"terminal and stdout", WrapConfig{Handler: handler, Terminal: true, Stdout: new(bytes.Buffer)}, "Terminal can't be combined with Stdout"},
+		{"terminal and timestamps", WrapConfig{Handler: handler, Terminal: true, Timestamps: TimestampRFC3339}, "Terminal can't be combined with JSONLines"},
+		{"invalid timestamps", WrapConfig{Handler: handler, Timestamps: "whenever"}, "invalid Timestamps"},
+		{"negative buffers", WrapConfig{Handler: handler, StderrBuffers: &StreamBuffers{ReadSize: -1}}, "StderrBuffers sizes must not be negative"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.c.Validate()
+			if err == nil {
+				t.Fatal("should error")
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("bad: %s", err)
+			}
+		})
+	}
+}
+
+func TestWrapConfigValidate_valid(t *testing.T) {
+	cases := []WrapConfig{
+		{Handler: func(string) {}},
+		{PanicWriter: new(bytes.Buffer), HidePanic: true},
+		{Handler: func(string) {}, Terminal: true, Stdout: os.Stdout},
+		{Handler: func(string) {}, Restart: &RestartPolicy{Backoff: time.Minute}},
+		{Handler: func(string) {}, ReportHandler: func(*Report) {}, Control: true},
+	}
+
+	for _, c := range cases {
+		if err := c.Validate(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestWrapConfigValidate_cpuAffinity(t *testing.T) {
+	c := &WrapConfig{Handler: func(string) {}, CPUAffinity: []int{0, bits.UintSize - 1}}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only Windows sets the affinity with a mask of a word.
+	c.CPUAffinity = []int{bits.UintSize}
+	err := c.Validate()
+	if runtime.GOOS != "windows" {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), "beyond the first") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestWrap_validate(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:        func(string) {},
+		DetectDuration: -time.Second,
+		Executor:       &fakeExecutor{},
+		IgnoreEnv:      true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "DetectDuration") {
+		t.Fatalf("bad: %v", err)
+	}
+}
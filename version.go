@@ -0,0 +1,61 @@
+package panicwrap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// VersionPolicy decides what the child does when its parent speaks another
+// version of the protocol between them, such as during a rolling upgrade
+// where the parent runs a binary built against another version of
+// panicwrap. See WrapConfig.VersionMismatch.
+type VersionPolicy int
+
+const (
+	// VersionWarn writes a warning to stderr and goes on as usual. This
+	// is the default.
+	VersionWarn VersionPolicy = iota
+
+	// VersionFallback goes on without the features that need the
+	// protocol, such as the control channel of WrapConfig.Control, and
+	// relies on the environment variable that marks the child alone.
+	VersionFallback
+
+	// VersionFail makes Wrap return an error that wraps
+	// ErrVersionMismatch in the child.
+	VersionFail
+)
+
+// ErrVersionMismatch is returned by Wrap in the child under VersionFail if
+// the parent speaks another protocol version.
+var ErrVersionMismatch = errors.New("panicwrap: the parent speaks another protocol version")
+
+// protocolEnvKey passes the protocol version of the parent to the child. A
+// parent that doesn't set it predates the versioning, which counts as
+// version 0.
+const protocolEnvKey = "PANICWRAP_PROTOCOL"
+
+// checkVersion compares the protocol version of the parent with ours in
+// the child and applies the policy. It returns whether the child must fall
+// back to what the parent understands.
+func checkVersion(c *WrapConfig) (fallback bool, err error) {
+	v := os.Getenv(protocolEnvKey)
+	os.Unsetenv(protocolEnvKey)
+
+	parent, _ := strconv.Atoi(v)
+	if parent == protocolVersion {
+		return false, nil
+	}
+
+	switch c.VersionMismatch {
+	case VersionFallback:
+		return true, nil
+	case VersionFail:
+		return false, fmt.Errorf("%w: parent %d, child %d", ErrVersionMismatch, parent, protocolVersion)
+	default:
+		fmt.Fprintf(os.Stderr, "panicwrap: the parent speaks protocol version %d, this child %d\n", parent, protocolVersion)
+		return false, nil
+	}
+}
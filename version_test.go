@@ -0,0 +1,58 @@
+package panicwrap
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestCheckVersion(t *testing.T) {
+	cases := []struct {
+		parent   string
+		policy   VersionPolicy
+		fallback bool
+		err      bool
+	}{
+		{strconv.Itoa(protocolVersion), VersionFail, false, false},
+		{"", VersionWarn, false, false},
+		{"", VersionFallback, true, false},
+		{"", VersionFail, false, true},
+		{strconv.Itoa(protocolVersion + 1), VersionFallback, true, false},
+		{strconv.Itoa(protocolVersion + 1), VersionFail, false, true},
+	}
+
+	for _, tc := range cases {
+		t.Setenv(protocolEnvKey, tc.parent)
+
+		fallback, err := checkVersion(&WrapConfig{VersionMismatch: tc.policy})
+		if fallback != tc.fallback || (err != nil) != tc.err {
+			t.Fatalf("%#v: bad: %t, %v", tc, fallback, err)
+		}
+		if err != nil && !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("bad: %v", err)
+		}
+		if _, ok := os.LookupEnv(protocolEnvKey); ok {
+			t.Fatal("should unset the variable")
+		}
+	}
+}
+
+func TestWrap_protocolEnv(t *testing.T) {
+	e := &fakeExecutor{}
+	_, _, err := Wrap(&WrapConfig{
+		Handler:  func(string) {},
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := protocolEnvKey + "=" + strconv.Itoa(protocolVersion)
+	for _, v := range e.cmd.Env {
+		if v == expected {
+			return
+		}
+	}
+	t.Fatalf("should pass the protocol version: %v", e.cmd.Env)
+}
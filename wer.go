@@ -0,0 +1,212 @@
+package panicwrap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WERReport describes what Windows Error Reporting wrote for the child
+// when it crashed. See WrapConfig.WERReports.
+type WERReport struct {
+	// Dump is the path of the minidump of the child, after it was copied
+	// to WrapConfig.CoreDir if that is set, or empty if there is none.
+	// Windows only writes minidumps where the LocalDumps key of the
+	// registry is set up for it.
+	Dump string `json:"dump,omitempty"`
+
+	// DumpSize is the size of the minidump in bytes.
+	DumpSize int64 `json:"dump_size,omitempty"`
+
+	// Report is the directory of the report that Windows Error Reporting
+	// queued or archived for the child, which holds its Report.wer, or
+	// empty if there is none.
+	Report string `json:"report,omitempty"`
+}
+
+// werReportPoll is how often the parent looks for what Windows Error
+// Reporting wrote while it waits for it. See WrapConfig.WERReports.
+const werReportPoll = 500 * time.Millisecond
+
+// werDirs are the directories that Windows Error Reporting writes to:
+// those of the minidumps, and those that hold a directory for each report.
+type werDirs struct {
+	dumps   []string
+	reports []string
+}
+
+// werException returns whether the exit status is the code of an
+// exception that the child died of, rather than one it exited with. Only
+// Windows has such codes.
+func werException(status int) bool {
+	return runtime.GOOS == "windows" && status != -1 && uint32(status)&0xC0000000 == 0xC0000000
+}
+
+// exceptionText describes a child that died of an exception without
+// writing a crash.
+func exceptionText(status int) string {
+	return fmt.Sprintf("exception: 0x%08X\n", uint32(status))
+}
+
+// waitWERReport waits up to WrapConfig.WERReportWait for the minidump
+// and the report of the crashed child to show up, since Windows Error
+// Reporting may still be writing them once the child died, and returns
+// what it found, or nil if it found neither. The minidump is copied to
+// WrapConfig.CoreDir if that is set.
+func waitWERReport(c *WrapConfig, dirs werDirs, exePath string, pid int, started time.Time) *WERReport {
+	deadline := c.Clock.Now().Add(c.WERReportWait)
+	var dump, report string
+	for {
+		if dump == "" {
+			dump = findWERDump(dirs.dumps, exePath, pid, started)
+		}
+		if report == "" {
+			report = findWERReportDir(dirs.reports, exePath, started)
+		}
+		if dump != "" && report != "" || !c.Clock.Now().Before(deadline) {
+			break
+		}
+		<-c.Clock.After(werReportPoll)
+	}
+	if dump == "" && report == "" {
+		return nil
+	}
+
+	info := &WERReport{Dump: dump, Report: report}
+	if dump != "" {
+		if fi, err := os.Stat(dump); err == nil {
+			info.DumpSize = fi.Size()
+		}
+		if c.CoreDir != "" {
+			// Windows Error Reporting keeps a few minidumps of each
+			// program and removes the oldest, so the minidump is copied
+			// rather than moved.
+			if path, err := copyWERDump(dump, c.CoreDir, c.Encrypter); err == nil {
+				info.Dump = path
+			} else {
+				reportInternal(c, "copying the minidump", err)
+			}
+		}
+	}
+	return info
+}
+
+// findWERDump returns the path of the minidump of the process among those
+// of the directories, which Windows Error Reporting names after the
+// executable and the process ID, or "" if there is none.
+func findWERDump(dirs []string, exePath string, pid int, started time.Time) string {
+	name := filepath.Base(exePath) + "." + strconv.Itoa(pid) + ".dmp"
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() || fi.ModTime().Before(started) {
+			continue
+		}
+		return path
+	}
+	return ""
+}
+
+// findWERReportDir returns the newest directory among those of the
+// directories that holds a report of a crash of the executable written
+// since the process started, or "" if there is none. Report.wer doesn't
+// name the process it is about, so a report of another instance of the
+// executable that crashed at the same time can't be told apart.
+func findWERReportDir(dirs []string, exePath string, started time.Time) string {
+	prefix := strings.ToLower("AppCrash_" + filepath.Base(exePath) + "_")
+	var newest string
+	var newestTime time.Time
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() || !strings.HasPrefix(strings.ToLower(e.Name()), prefix) {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			fi, err := os.Stat(filepath.Join(path, "Report.wer"))
+			if err != nil || fi.ModTime().Before(started) {
+				continue
+			}
+			if newest == "" || fi.ModTime().After(newestTime) {
+				newest, newestTime = path, fi.ModTime()
+			}
+		}
+	}
+	return newest
+}
+
+// copyWERDump copies the minidump to dir, where it is encrypted if e is
+// set, and returns the path of the copy. The copy is removed if it can't
+// be encrypted.
+func copyWERDump(path, dir string, e Encrypter) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst := filepath.Join(dir, filepath.Base(path))
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+
+	if e != nil {
+		encrypted, err := encryptFile(dst, e)
+		if err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+		return encrypted, nil
+	}
+	return dst, nil
+}
+
+// expandWindowsEnv replaces the %NAME% variables of a REG_EXPAND_SZ value
+// of the registry with their values in the environment, and leaves those
+// that aren't set as they are.
+func expandWindowsEnv(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(s[i+1:], '%')
+		if j < 0 {
+			break
+		}
+		name := s[i+1 : i+1+j]
+		b.WriteString(s[:i])
+		if v, ok := os.LookupEnv(name); ok && name != "" {
+			b.WriteString(v)
+			s = s[i+2+j:]
+		} else {
+			// The closing % may open the next variable.
+			b.WriteString(s[i : i+1+j])
+			s = s[i+1+j:]
+		}
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package panicwrap
+
+// werReportDirs returns no directories, since Windows Error Reporting
+// only runs on Windows.
+func werReportDirs(exePath string) werDirs {
+	return werDirs{}
+}
@@ -0,0 +1,144 @@
+package panicwrap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFindWERDump(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Now().Add(-time.Minute)
+	os.WriteFile(filepath.Join(dir, "server.exe.4321.dmp"), []byte("MDMP"), 0644)
+
+	if path := findWERDump([]string{"/nonexistent", dir}, "/opt/bin/server.exe", 4321, started); filepath.Base(path) != "server.exe.4321.dmp" {
+		t.Fatalf("should find the minidump: %q", path)
+	}
+	if path := findWERDump([]string{dir}, "/opt/bin/server.exe", 432, started); path != "" {
+		t.Fatalf("should match the whole process ID: %q", path)
+	}
+	if path := findWERDump([]string{dir}, "/opt/bin/server.exe", 4321, time.Now().Add(time.Minute)); path != "" {
+		t.Fatalf("should skip minidumps from before the child started: %q", path)
+	}
+}
+
+func TestFindWERReportDir(t *testing.T) {
+	queue, archive := t.TempDir(), t.TempDir()
+	started := time.Now().Add(-time.Minute)
+	report := func(dir, name string, mtime time.Time) string {
+		path := filepath.Join(dir, name)
+		os.Mkdir(path, 0755)
+		wer := filepath.Join(path, "Report.wer")
+		os.WriteFile(wer, []byte("Version=1\n"), 0644)
+		os.Chtimes(wer, mtime, mtime)
+		return path
+	}
+	report(archive, "AppCrash_server.exe_0123_abcd_1", time.Now().Add(-time.Hour))
+	want := report(queue, "AppCrash_Server.exe_4567_ef01_2", time.Now())
+	report(archive, "AppCrash_server.exe_89ab_cdef_3", time.Now().Add(-time.Second))
+	report(queue, "AppCrash_server.exe.old_0123_abcd_4", time.Now())
+
+	if path := findWERReportDir([]string{queue, archive}, "/opt/bin/server.exe", started); path != want {
+		t.Fatalf("should find the newest report: %q", path)
+	}
+	if path := findWERReportDir([]string{queue}, "/opt/bin/other.exe", started); path != "" {
+		t.Fatalf("bad: %q", path)
+	}
+}
+
+func TestWaitWERReport(t *testing.T) {
+	dumps, reports, cores := t.TempDir(), t.TempDir(), t.TempDir()
+	clock := newFakeClock()
+	c := &WrapConfig{Clock: clock, WERReportWait: time.Second, CoreDir: cores}
+	started := time.Now().Add(-time.Minute)
+
+	os.WriteFile(filepath.Join(dumps, "server.exe.7.dmp"), []byte("MDMP"), 0644)
+	result := make(chan *WERReport)
+	go func() {
+		result <- waitWERReport(c, werDirs{[]string{dumps}, []string{reports}}, "/opt/bin/server.exe", 7, started)
+	}()
+
+	// The report is archived after the minidump was written.
+	<-clock.waiting
+	os.Mkdir(filepath.Join(reports, "AppCrash_server.exe_1"), 0755)
+	os.WriteFile(filepath.Join(reports, "AppCrash_server.exe_1", "Report.wer"), nil, 0644)
+	clock.Advance(werReportPoll)
+
+	info := <-result
+	if info == nil || info.Dump != filepath.Join(cores, "server.exe.7.dmp") || info.DumpSize != 4 || info.Report == "" {
+		t.Fatalf("bad: %#v", info)
+	}
+	if data, _ := os.ReadFile(info.Dump); string(data) != "MDMP" {
+		t.Fatalf("should copy the minidump: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dumps, "server.exe.7.dmp")); err != nil {
+		t.Fatalf("should leave the minidump of Windows Error Reporting: %v", err)
+	}
+}
+
+func TestCopyWERDump_encryptFails(t *testing.T) {
+	dump := filepath.Join(t.TempDir(), "server.exe.7.dmp")
+	os.WriteFile(dump, []byte("MDMP"), 0644)
+	cores := t.TempDir()
+
+	if _, err := copyWERDump(dump, cores, &xorEncrypter{err: errors.New("no entropy")}); err == nil {
+		t.Fatal("should fail")
+	}
+	if entries, _ := os.ReadDir(cores); len(entries) != 0 {
+		t.Fatalf("should remove the plain copy: %v", entries)
+	}
+}
+
+func TestWaitWERReport_timeout(t *testing.T) {
+	clock := newFakeClock()
+	c := &WrapConfig{Clock: clock, WERReportWait: time.Second}
+
+	result := make(chan *WERReport)
+	go func() {
+		result <- waitWERReport(c, werDirs{[]string{t.TempDir()}, nil}, "/opt/bin/server.exe", 7, time.Now())
+	}()
+
+	for range 2 {
+		<-clock.waiting
+		clock.Advance(werReportPoll)
+	}
+	if info := <-result; info != nil {
+		t.Fatalf("should give up: %#v", info)
+	}
+}
+
+func TestWERException(t *testing.T) {
+	// STATUS_ACCESS_VIOLATION, which is negative where int is 32 bits.
+	var accessViolation uint32 = 0xC0000005
+	status := int(accessViolation)
+	if runtime.GOOS != "windows" {
+		if werException(status) {
+			t.Fatal("only Windows has exception codes")
+		}
+		return
+	}
+	if !werException(status) || werException(2) || werException(-1) {
+		t.Fatal("bad")
+	}
+	if s := exceptionText(status); s != "exception: 0xC0000005\n" {
+		t.Fatalf("bad: %q", s)
+	}
+}
+
+func TestExpandWindowsEnv(t *testing.T) {
+	t.Setenv("PANICWRAP_TEST_DIR", `C:\Users\me\AppData\Local`)
+	cases := map[string]string{
+		`%PANICWRAP_TEST_DIR%\CrashDumps`:        `C:\Users\me\AppData\Local\CrashDumps`,
+		`D:\dumps`:                               `D:\dumps`,
+		`%PANICWRAP_UNSET%\%PANICWRAP_TEST_DIR%`: `%PANICWRAP_UNSET%\C:\Users\me\AppData\Local`,
+		`100%`:                                   `100%`,
+	}
+	for in, want := range cases {
+		if got := expandWindowsEnv(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+}
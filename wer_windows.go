@@ -0,0 +1,69 @@
+package panicwrap
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// werLocalDumpsKey is the registry key under HKEY_LOCAL_MACHINE that sets
+// up the minidumps of Windows Error Reporting, for every program and, in a
+// subkey named after it, for a single one.
+const werLocalDumpsKey = `SOFTWARE\Microsoft\Windows\Windows Error Reporting\LocalDumps`
+
+// werReportDirs returns the directories Windows Error Reporting writes
+// the minidumps and the reports of the executable to: the DumpFolder of
+// LocalDumps, which defaults to %LOCALAPPDATA%\CrashDumps, and the
+// queues and archives of the reports of the user and of the system.
+func werReportDirs(exePath string) werDirs {
+	var dirs werDirs
+	for _, key := range []string{werLocalDumpsKey + `\` + filepath.Base(exePath), werLocalDumpsKey} {
+		if dir := regString(key, "DumpFolder"); dir != "" {
+			dirs.dumps = append(dirs.dumps, expandWindowsEnv(dir))
+		}
+	}
+	if local := os.Getenv("LOCALAPPDATA"); local != "" {
+		dirs.dumps = append(dirs.dumps, filepath.Join(local, "CrashDumps"))
+	}
+
+	for _, root := range []string{os.Getenv("LOCALAPPDATA"), os.Getenv("ProgramData")} {
+		if root == "" {
+			continue
+		}
+		wer := filepath.Join(root, "Microsoft", "Windows", "WER")
+		dirs.reports = append(dirs.reports, filepath.Join(wer, "ReportQueue"), filepath.Join(wer, "ReportArchive"))
+	}
+	return dirs
+}
+
+// regString returns the string value of the key under HKEY_LOCAL_MACHINE,
+// or "" if it can't be read.
+func regString(key, name string) string {
+	k, err := syscall.UTF16PtrFromString(key)
+	if err != nil {
+		return ""
+	}
+	var h syscall.Handle
+	if err := syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, k, 0, syscall.KEY_READ, &h); err != nil {
+		return ""
+	}
+	defer syscall.RegCloseKey(h)
+
+	n, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return ""
+	}
+	var typ, size uint32
+	if err := syscall.RegQueryValueEx(h, n, nil, &typ, nil, &size); err != nil || size < 2 {
+		return ""
+	}
+	if typ != syscall.REG_SZ && typ != syscall.REG_EXPAND_SZ {
+		return ""
+	}
+	buf := make([]uint16, size/2)
+	if err := syscall.RegQueryValueEx(h, n, nil, &typ, (*byte)(unsafe.Pointer(&buf[0])), &size); err != nil {
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
@@ -0,0 +1,124 @@
+package panicwrap
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// workerEnvKey passes the index of the worker to the child. See
+// WrapConfig.Workers.
+const workerEnvKey = "PANICWRAP_WORKER"
+
+// Worker returns the index of the worker the child runs as, from 0 up to
+// WrapConfig.Workers. It is 0 if the parent doesn't run several workers,
+// and in the parent itself.
+func Worker() int {
+	i, _ := strconv.Atoi(os.Getenv(workerEnvKey))
+	return i
+}
+
+// each calls the function for every worker, including this one, which
+// must be the first. See WrapConfig.Workers.
+func (c *child) each(f func(*child)) {
+	if len(c.workers) == 0 {
+		f(c)
+		return
+	}
+
+	for _, w := range c.workers {
+		f(w)
+	}
+}
+
+// superviseWorkers supervises all workers at once and returns the first
+// error or else the first non-zero exit status of the workers, in the
+// order of the workers. Once one of them fails, the others aren't
+// restarted anymore.
+func superviseWorkers(ch *child, supervise func(*child) (int, error)) (int, error) {
+	statuses := make([]int, len(ch.workers))
+	errs := make([]error, len(ch.workers))
+
+	var wg sync.WaitGroup
+	for i, w := range ch.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], errs[i] = supervise(w)
+			if errs[i] != nil {
+				ch.each((*child).stop)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return 1, err
+		}
+	}
+	for _, status := range statuses {
+		if status != 0 {
+			return status, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// sharedWriter is a writer of the parent that all workers write to, one
+// write at a time.
+type sharedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *sharedWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// lineWriter writes the output of a worker to a sharedWriter a whole line
+// at a time, so that the lines of the workers don't mix. The end of a
+// line is held back until the rest of it comes, or until flush.
+type lineWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// newLineWriter returns a lineWriter for w if it is a sharedWriter, and
+// otherwise w itself.
+func newLineWriter(w io.Writer) io.Writer {
+	if _, ok := w.(*sharedWriter); !ok {
+		return w
+	}
+	return &lineWriter{w: w}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	i := bytes.LastIndexByte(l.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	_, err := l.w.Write(l.buf[:i+1])
+	l.buf = append(l.buf[:0], l.buf[i+1:]...)
+	return len(p), err
+}
+
+// flush writes the end of a line that was held back.
+func (l *lineWriter) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		l.w.Write(l.buf)
+		l.buf = nil
+	}
+}
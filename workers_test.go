@@ -0,0 +1,108 @@
+package panicwrap
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestWorker(t *testing.T) {
+	if Worker() != 0 {
+		t.Fatalf("bad: %d", Worker())
+	}
+
+	t.Setenv(workerEnvKey, "2")
+	if Worker() != 2 {
+		t.Fatalf("bad: %d", Worker())
+	}
+}
+
+func TestSuperviseWorkers(t *testing.T) {
+	ch := new(child)
+	ch.workers = []*child{ch, {index: 1}, {index: 2}}
+
+	status, err := superviseWorkers(ch, func(w *child) (int, error) {
+		return []int{0, 3, 4}[w.index], nil
+	})
+	if err != nil || status != 3 {
+		t.Fatalf("bad: %d, %v", status, err)
+	}
+
+	_, err = superviseWorkers(ch, func(w *child) (int, error) {
+		if w.index == 2 {
+			return 1, errors.New("failed to start")
+		}
+		return 0, nil
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	for _, w := range ch.workers {
+		if !w.stopping() {
+			t.Fatalf("worker %d shouldn't restart", w.index)
+		}
+	}
+}
+
+func TestWrap_workers(t *testing.T) {
+	var mu sync.Mutex
+	var workers []int
+	e := &fakeExecutor{
+		stderr: []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"},
+		exit:   ProcessExit{Status: 2},
+	}
+
+	_, exitStatus, err := Wrap(&WrapConfig{
+		InfoHandler: func(i *PanicInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			workers = append(workers, i.Worker)
+		},
+		Writer:   new(bytes.Buffer),
+		Workers:  3,
+		Executor: e,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitStatus != 2 || e.started != 3 {
+		t.Fatalf("bad: %d, %d", exitStatus, e.started)
+	}
+	sort.Ints(workers)
+	if !reflect.DeepEqual(workers, []int{0, 1, 2}) {
+		t.Fatalf("bad: %#v", workers)
+	}
+}
+
+func TestWrap_workersTerminal(t *testing.T) {
+	_, _, err := Wrap(&WrapConfig{
+		Handler:  func(string) {},
+		Workers:  2,
+		Terminal: true,
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	shared := &sharedWriter{w: out}
+	a, b := newLineWriter(shared).(*lineWriter), newLineWriter(shared).(*lineWriter)
+
+	a.Write([]byte("worker 0 sa"))
+	b.Write([]byte("worker 1 says\nworker 1 "))
+	a.Write([]byte("ys\n"))
+	b.flush()
+
+	if out.String() != "worker 1 says\nworker 0 says\nworker 1 " {
+		t.Fatalf("should write whole lines: %q", out)
+	}
+	if w := newLineWriter(out); w != out {
+		t.Fatal("should only hold back lines for a shared writer")
+	}
+}